@@ -0,0 +1,582 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const archiveDefaultEntries = 200 // archive列出内容时默认最多显示的条目数
+
+// archiveTool 创建、列出和解压归档文件的工具定义
+var archiveTool = Tool{
+	Type:        "function",
+	Name:        "archive",
+	Sequential:  true,
+	Description: "创建、列出或解压tar.gz、tar和zip归档文件，不依赖系统的tar、unzip命令。格式根据文件扩展名判断。解压时会拒绝路径位于目标目录之外的条目（如../或绝对路径，以及指向目录外的符号链接），已存在的文件默认不覆盖。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "extract", "create"},
+				"description": "操作：list列出内容，extract解压，create创建",
+			},
+			"archive": map[string]interface{}{
+				"type":        "string",
+				"description": "归档文件路径，扩展名为.tar.gz、.tgz、.tar或.zip",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "extract时解压到的目录，默认为当前工作目录，不存在时自动创建",
+			},
+			"sources": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "create时要打包的文件或目录，目录会递归打包，归档中的路径以各来源的名称开头",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"tar.gz", "tar", "zip"},
+				"description": "归档格式，默认根据扩展名判断",
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "extract时是否覆盖已存在的文件，create时是否覆盖已存在的归档，被覆盖的文件会移入回收站，默认false",
+				"default":     false,
+			},
+			"max_entries": map[string]interface{}{
+				"type":        "integer",
+				"description": "list时最多显示的条目数，默认200",
+				"minimum":     1,
+			},
+		},
+		"required": []string{"action", "archive"},
+	},
+}
+
+// archiveParams archive的参数
+type archiveParams struct {
+	Action      string   `json:"action"`
+	Archive     string   `json:"archive"`
+	Destination string   `json:"destination"`
+	Sources     []string `json:"sources"`
+	Format      string   `json:"format"`
+	Overwrite   bool     `json:"overwrite"`
+	MaxEntries  int      `json:"max_entries"`
+}
+
+// archiveEntry 归档中的一个条目，tar和zip统一为该结构
+type archiveEntry struct {
+	name     string
+	mode     os.FileMode
+	size     int64
+	modTime  string
+	linkname string
+	hardlink bool
+}
+
+// archiveFormat 根据指定的格式或扩展名确定归档格式
+func archiveFormat(name, format string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("无法根据扩展名判断%s的格式，请指定format", filepath.Base(name))
+}
+
+// archive 根据action创建、列出或解压归档
+func (a *ECNUAgent) archive(ctx context.Context, args string) (string, error) {
+	params := archiveParams{MaxEntries: archiveDefaultEntries}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Archive == "" {
+		return "", fmt.Errorf("缺少archive参数")
+	}
+	format, err := archiveFormat(params.Archive, params.Format)
+	if err != nil {
+		return fmt.Sprintf("归档操作失败: %v", err), nil
+	}
+	archivePath := a.resolvePath(params.Archive)
+	log.Printf("[归档] %s %s (%s)\n", params.Action, archivePath, format)
+
+	switch params.Action {
+	case "list":
+		return listArchive(archivePath, format, params.MaxEntries), nil
+	case "extract":
+		return a.extractArchive(ctx, archivePath, format, params), nil
+	case "create":
+		if len(params.Sources) == 0 {
+			return "", fmt.Errorf("create需要sources参数")
+		}
+		return a.createArchive(ctx, archivePath, format, params), nil
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+}
+
+// walkArchive 依次读取归档中的条目，fn中的r为普通文件的内容
+func walkArchive(archivePath, format string, fn func(e archiveEntry, r io.Reader) error) error {
+	if format == "zip" {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			e := archiveEntry{name: f.Name, mode: f.Mode(), size: int64(f.UncompressedSize64), modTime: f.Modified.Format("2006-01-02 15:04")}
+			if err := walkZipEntry(f, e, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if format == "tar.gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("读取gzip失败: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取tar失败: %v", err)
+		}
+		e := archiveEntry{name: hdr.Name, mode: hdr.FileInfo().Mode(), size: hdr.Size, modTime: hdr.ModTime.Format("2006-01-02 15:04"), linkname: hdr.Linkname, hardlink: hdr.Typeflag == tar.TypeLink}
+		if err := fn(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZipEntry 处理zip中的一个条目，符号链接的目标保存在内容中
+func walkZipEntry(f *zip.File, e archiveEntry, fn func(e archiveEntry, r io.Reader) error) error {
+	if e.mode.IsDir() {
+		return fn(e, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("读取%s失败: %v", f.Name, err)
+	}
+	defer rc.Close()
+	if e.mode&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		e.linkname = string(target)
+		return fn(e, nil)
+	}
+	return fn(e, rc)
+}
+
+// listArchive 列出归档中的条目
+func listArchive(archivePath, format string, maxEntries int) string {
+	var b strings.Builder
+	count, files := 0, 0
+	var total int64
+	err := walkArchive(archivePath, format, func(e archiveEntry, _ io.Reader) error {
+		count++
+		if e.mode.IsRegular() {
+			files++
+			total += e.size
+		}
+		if count > maxEntries {
+			return nil
+		}
+		name := e.name
+		switch {
+		case e.hardlink:
+			name += " => " + e.linkname
+		case e.mode&os.ModeSymlink != 0:
+			name += " -> " + e.linkname
+		}
+		fmt.Fprintf(&b, "%s %10d  %s  %s\n", e.mode.String(), e.size, e.modTime, name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Sprintf("读取归档失败: %v", err)
+	}
+	if count > maxEntries {
+		fmt.Fprintf(&b, "...（另有%d项未显示）\n", count-maxEntries)
+	}
+	return fmt.Sprintf("%s（%s）共%d项，其中%d个文件，解压后共%s:\n%s", archivePath, format, count, files, formatSize(total), b.String())
+}
+
+// safeExtractPath 计算条目解压后的路径，拒绝位于目标目录之外的条目
+func safeExtractPath(dest, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean(slashed)
+	if strings.HasPrefix(slashed, "/") || filepath.VolumeName(name) != "" || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("条目%q的路径位于目标目录之外", name)
+	}
+	target := filepath.Join(dest, filepath.FromSlash(clean))
+	// 已解压的符号链接可能指向目录之外，因此按解析后的路径再检查一次
+	if !withinDir(dest, resolveExisting(target)) {
+		return "", fmt.Errorf("条目%q会写到目标目录之外", name)
+	}
+	return target, nil
+}
+
+// extractArchive 把归档解压到目标目录
+func (a *ECNUAgent) extractArchive(ctx context.Context, archivePath, format string, params archiveParams) string {
+	dest := a.workingDir
+	if params.Destination != "" {
+		dest = a.resolvePath(params.Destination)
+	}
+	if err := a.checkWorkspace(dest); err != nil {
+		return fmt.Sprintf("解压失败: %v", err)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Sprintf("解压失败: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(dest); err == nil {
+		dest = resolved
+	}
+
+	// 先检查所有条目，存在不安全的条目时不解压任何文件
+	var existing []string
+	err := walkArchive(archivePath, format, func(e archiveEntry, _ io.Reader) error {
+		target, err := safeExtractPath(dest, e.name)
+		if err != nil {
+			return err
+		}
+		if !e.mode.IsDir() {
+			if _, err := os.Lstat(target); err == nil {
+				existing = append(existing, target)
+			}
+		}
+		_, err = entryLinkSource(dest, target, e)
+		return err
+	})
+	if err != nil {
+		return fmt.Sprintf("解压失败: %v", err)
+	}
+	if params.Overwrite && len(existing) > 0 {
+		list := strings.Join(existing[:min(len(existing), 10)], "\n  ")
+		if len(existing) > 10 {
+			list += fmt.Sprintf("\n  ...（共%d个）", len(existing))
+		}
+		ok, err := a.confirm(ctx, approveWrite, fmt.Sprintf("\n解压 %s 将覆盖以下文件，原内容会移入回收站:\n  %s\n是否覆盖？(y/N) ", archivePath, list))
+		if err != nil {
+			return fmt.Sprintf("解压失败: 覆盖已有文件需要用户确认: %v", err)
+		}
+		if !ok {
+			return "用户拒绝覆盖已有文件，未解压任何文件。请询问用户原因或换一种方式完成任务。"
+		}
+	}
+
+	files := 0
+	var skipped, trashed []string
+	err = walkArchive(archivePath, format, func(e archiveEntry, r io.Reader) error {
+		target, err := safeExtractPath(dest, e.name)
+		if err != nil {
+			return err
+		}
+		if target == dest {
+			return nil
+		}
+		if e.mode.IsDir() {
+			return os.MkdirAll(target, e.mode.Perm()|0700)
+		}
+		if !e.mode.IsRegular() && e.mode&os.ModeSymlink == 0 && !e.hardlink {
+			skipped = append(skipped, e.name)
+			return nil
+		}
+
+		// 链接在覆盖已有文件之前检查，避免拒绝时已经把原文件移入回收站
+		linkSource, err := entryLinkSource(dest, target, e)
+		if err != nil {
+			return err
+		}
+
+		if _, err := os.Lstat(target); err == nil {
+			if !params.Overwrite {
+				skipped = append(skipped, e.name+"（已存在）")
+				return nil
+			}
+			moved, err := a.trash.put(target)
+			if err != nil {
+				return err
+			}
+			trashed = append(trashed, moved)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		switch {
+		case e.hardlink:
+			if err := os.Link(linkSource, target); err != nil {
+				return err
+			}
+		case e.mode&os.ModeSymlink != 0:
+			if err := os.Symlink(linkSource, target); err != nil {
+				return err
+			}
+		default:
+			if err := writeArchiveFile(target, e.mode.Perm(), r); err != nil {
+				return fmt.Errorf("写入%s失败: %v", target, err)
+			}
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return fmt.Sprintf("解压失败（已解压%d项）: %v", files, err)
+	}
+	a.activity.addFile(dest)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "已将%s解压到%s，共%d项", archivePath, dest, files)
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "\n跳过%d项（如需覆盖已存在的文件请设置overwrite为true）: %s", len(skipped), strings.Join(skipped, ", "))
+	}
+	if len(trashed) > 0 {
+		fmt.Fprintf(&b, "\n覆盖了%d个已存在的文件，原文件已移入回收站", len(trashed))
+	}
+	return b.String()
+}
+
+// entryLinkSource 返回链接条目指向的路径，拒绝指向目标目录之外的链接，非链接条目返回空
+func entryLinkSource(dest, target string, e archiveEntry) (string, error) {
+	switch {
+	case e.hardlink:
+		return safeExtractPath(dest, e.linkname)
+	case e.mode&os.ModeSymlink != 0:
+		source := filepath.FromSlash(e.linkname)
+		if filepath.IsAbs(source) || !withinDir(dest, filepath.Join(filepath.Dir(target), source)) {
+			return "", fmt.Errorf("符号链接%q指向目标目录之外: %s", e.name, e.linkname)
+		}
+		return source, nil
+	}
+	return "", nil
+}
+
+// writeArchiveFile 把条目内容写入文件
+func writeArchiveFile(target string, perm os.FileMode, r io.Reader) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// archiveWriter tar和zip写入的统一接口
+type archiveWriter interface {
+	add(name string, info os.FileInfo, fullPath string) error
+	Close() error
+}
+
+// tarArchiveWriter 写入tar或tar.gz
+type tarArchiveWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+// add 添加一个条目
+func (w *tarArchiveWriter) add(name string, info os.FileInfo, fullPath string) error {
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return copyFileTo(w.tw, fullPath)
+}
+
+// Close 依次关闭tar和gzip
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// zipArchiveWriter 写入zip
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+// add 添加一个条目，符号链接把目标作为内容保存
+func (w *zipArchiveWriter) add(name string, info os.FileInfo, fullPath string) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else {
+		hdr.Method = zip.Deflate
+	}
+	out, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(out, target)
+		return err
+	case info.Mode().IsRegular():
+		return copyFileTo(out, fullPath)
+	}
+	return nil
+}
+
+// Close 关闭zip
+func (w *zipArchiveWriter) Close() error {
+	return w.zw.Close()
+}
+
+// copyFileTo 把文件内容写入w
+func copyFileTo(w io.Writer, fullPath string) error {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// createArchive 把sources打包为归档文件
+func (a *ECNUAgent) createArchive(ctx context.Context, archivePath, format string, params archiveParams) string {
+	if err := a.checkWorkspace(archivePath); err != nil {
+		return fmt.Sprintf("创建归档失败: %v", err)
+	}
+	sources := make([]string, len(params.Sources))
+	for i, s := range params.Sources {
+		sources[i] = a.resolvePath(s)
+		if _, err := os.Lstat(sources[i]); err != nil {
+			return fmt.Sprintf("创建归档失败: %v", err)
+		}
+	}
+	note, _, err := a.replaceExisting(ctx, archivePath, params.Overwrite)
+	if err != nil {
+		return fmt.Sprintf("创建归档失败: %v", err)
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Sprintf("创建归档失败: %v", err)
+	}
+	var w archiveWriter
+	if format == "zip" {
+		w = &zipArchiveWriter{zw: zip.NewWriter(file)}
+	} else {
+		tw := &tarArchiveWriter{}
+		if format == "tar.gz" {
+			tw.gz = gzip.NewWriter(file)
+			tw.tw = tar.NewWriter(tw.gz)
+		} else {
+			tw.tw = tar.NewWriter(file)
+		}
+		w = tw
+	}
+
+	files := 0
+	for _, src := range sources {
+		base := filepath.Dir(src)
+		err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// 归档文件位于来源目录中时不要把它自己打包进去
+			if p == archivePath {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, p)
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				files++
+			}
+			return w.add(filepath.ToSlash(rel), info, p)
+		})
+		if err != nil {
+			break
+		}
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return fmt.Sprintf("创建归档失败: %v", err)
+	}
+	a.activity.addFile(archivePath)
+
+	size := ""
+	if info, err := os.Stat(archivePath); err == nil {
+		size = "，大小" + formatSize(info.Size())
+	}
+	return fmt.Sprintf("成功创建归档%s（%s），共%d个文件%s%s", archivePath, format, files, size, note)
+}
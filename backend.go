@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// backend 一个可用的模型服务端点：服务商、客户端以及固定使用的模型
+type backend struct {
+	provider   *Provider
+	client     *openai.Client
+	keys       *keyPool
+	httpClient *http.Client
+	retryAfter *retryAfterTransport
+	model      string // 备用端点固定使用的模型，为空时使用配置中的模型
+
+	windows       map[string]int // 从模型列表获取的上下文窗口
+	windowsLoaded bool
+}
+
+// newBackend 为服务商创建OpenAI兼容客户端，认证头由密钥池按请求设置
+func newBackend(provider *Provider, keys []string, model string) *backend {
+	pool := newKeyPool(keys)
+	config := openai.DefaultConfig("")
+	config.BaseURL = provider.BaseURL
+	retryAfter := &retryAfterTransport{base: &authTransport{base: http.DefaultTransport, auth: provider.Auth, keys: pool}}
+	httpClient := &http.Client{Transport: retryAfter}
+	config.HTTPClient = httpClient
+
+	return &backend{
+		provider:   provider,
+		client:     openai.NewClientWithConfig(config),
+		keys:       pool,
+		httpClient: httpClient,
+		retryAfter: retryAfter,
+		model:      model,
+	}
+}
+
+// String 返回便于日志展示的端点描述
+func (b *backend) String() string {
+	if b.model != "" {
+		return fmt.Sprintf("%s (模型 %s)", b.provider.Name, b.model)
+	}
+	return b.provider.Name
+}
+
+// parseFallbacks 解析备用端点列表，格式为 "服务商[:模型],服务商[:模型]"
+func parseFallbacks(specs []string, providers map[string]*Provider) ([]*backend, error) {
+	var backends []*backend
+	for _, spec := range specs {
+		name, model, _ := strings.Cut(spec, ":")
+		provider, ok := providers[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的备用服务商: %s", name)
+		}
+		if model == "" {
+			model = provider.DefaultModel
+		}
+		if model == "" {
+			return nil, fmt.Errorf("备用服务商%s未配置默认模型，请使用 %s:<模型> 指定", name, name)
+		}
+		keys, err := provider.apiKeys("", "")
+		if err != nil {
+			return nil, fmt.Errorf("备用服务商%s: %v", name, err)
+		}
+		backends = append(backends, newBackend(provider, keys, model))
+	}
+	return backends, nil
+}
+
+// model 返回当前端点实际请求的模型名
+func (a *ECNUAgent) model() string {
+	name := a.config.Model
+	if a.backend.model != "" {
+		name = a.backend.model
+	}
+	return a.backend.provider.resolveModel(name)
+}
+
+// failover 切换到下一个备用端点，没有更多备用端点时返回false
+func (a *ECNUAgent) failover(cause error) bool {
+	next := a.backendIdx + 1
+	if next >= len(a.backends) {
+		return false
+	}
+
+	log.Printf("[切换] %s 连续调用失败 (%v)，切换到备用端点 %s\n", a.backend, cause, a.backends[next])
+	a.backendIdx = next
+	a.backend = a.backends[next]
+	return true
+}
+
+// resetBackend 每个新任务重新从主端点开始，以便主端点恢复后继续使用
+func (a *ECNUAgent) resetBackend() {
+	if a.backendIdx != 0 {
+		log.Printf("[切换] 新任务重新使用主端点 %s\n", a.backends[0])
+	}
+	a.backendIdx = 0
+	a.backend = a.backends[0]
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const backupMaxSize = 100 * 1024 * 1024 // 超过该大小的文件不备份
+
+// defaultBackupRoot 返回备份目录
+func defaultBackupRoot() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ecnu-agent-backups")
+	}
+	return filepath.Join(home, ".ecnu-agent", "backups")
+}
+
+// backupEntry 备份索引中的一条记录
+type backupEntry struct {
+	Original string    `json:"original"`
+	Backup   string    `json:"backup"`
+	Time     time.Time `json:"time"`
+}
+
+// backupStore 覆盖文件前保存原内容，按日期分目录存放
+type backupStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// save 把文件当前的内容复制到备份目录，文件不存在时返回空字符串
+func (s *backupStore) save(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+	if info.Size() > backupMaxSize {
+		log.Printf("[备份] %s超过%s，跳过备份\n", path, formatSize(backupMaxSize))
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	dir := filepath.Join(s.dir, now.Format("20060102"))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建备份目录失败: %v", err)
+	}
+	name := now.Format("150405.000") + "-" + filepath.Base(path)
+	backup := filepath.Join(dir, name)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = filepath.Join(dir, fmt.Sprintf("%s.%d", name, i))
+	}
+	if err := copyRegularFile(path, backup, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("备份%s失败: %v", path, err)
+	}
+
+	if f, err := os.OpenFile(filepath.Join(s.dir, "index.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
+		line, _ := json.Marshal(backupEntry{Original: path, Backup: backup, Time: now})
+		f.Write(append(line, '\n'))
+		f.Close()
+	}
+	log.Printf("[备份] %s -> %s\n", path, backup)
+	return backup, nil
+}
+
+// backupBeforeWrite 按配置在覆盖文件前备份原内容
+func (a *ECNUAgent) backupBeforeWrite(path string) (string, error) {
+	if !a.config.Backup {
+		return "", nil
+	}
+	return a.backups.save(path)
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，避免写到一半时损坏原文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	// 重命名会替换掉符号链接本身，因此写入链接指向的文件
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	cleanup := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return cleanup(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runSkipped 批量任务中因中断或前一个任务失败而没有执行的任务
+const runSkipped = "skipped"
+
+const batchUsage = `用法: chatecnu-agent batch [选项] <任务文件> [-- Agent参数]
+
+按顺序执行任务文件（YAML或JSON）中的提示词，每个任务的执行过程和最终回答写入结果目录，
+最后输出汇总报告。任务文件的格式:
+
+  shared: false          # true时所有任务在同一个会话中依次执行，默认每个任务使用新会话
+  timeout: 30            # 每个任务的时间上限（分钟），默认30
+  args: ["--auto-approve=safe"]   # 所有任务共用的Agent参数
+  tasks:
+    - 统计各语言的代码行数          # 只有提示词的任务
+    - name: lint
+      prompt: 运行go vet并修复发现的问题
+      workspace: ./service-a      # 任务的工作目录，相对于任务文件所在目录
+      args: ["--max-steps", "40"] # 该任务额外的Agent参数，只能用于独立会话
+      timeout: 10
+
+选项:
+  --output 目录     结果目录，默认为任务文件旁的 <文件名>-<时间>
+  --shared          所有任务在同一个会话中依次执行，覆盖任务文件中的shared
+  --stop-on-error   任务失败后不再执行剩余的任务
+
+任务无法询问用户，需要确认的操作只有在--auto-approve允许时才会执行。
+有任务未成功完成时退出码为1。
+`
+
+// batchFile 任务文件
+type batchFile struct {
+	Shared  bool        `yaml:"shared"`
+	Timeout int         `yaml:"timeout"`
+	Args    []string    `yaml:"args"`
+	Tasks   []batchTask `yaml:"tasks"`
+}
+
+// batchTask 任务文件中的一个任务
+type batchTask struct {
+	Name      string   `yaml:"name"`
+	Prompt    string   `yaml:"prompt"`
+	Workspace string   `yaml:"workspace"`
+	Args      []string `yaml:"args"`
+	Timeout   int      `yaml:"timeout"`
+}
+
+// UnmarshalYAML 允许只写提示词的任务
+func (t *batchTask) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.Prompt)
+	}
+	type plain batchTask
+	return node.Decode((*plain)(t))
+}
+
+// batchResult 一个任务的执行结果，写入汇总报告
+type batchResult struct {
+	Index      int       `json:"index"`
+	Name       string    `json:"name"`
+	Prompt     string    `json:"prompt"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Answer     string    `json:"answer,omitempty"`
+	Usage      string    `json:"usage,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Transcript string    `json:"transcript,omitempty"` // 执行过程的记录文件
+}
+
+// batchReport 汇总报告，保存为结果目录中的summary.json
+type batchReport struct {
+	File     string        `json:"file"`
+	Shared   bool          `json:"shared"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Results  []batchResult `json:"results"`
+}
+
+// batchRunner 执行一个任务文件
+type batchRunner struct {
+	file      string
+	dir       string // 任务文件所在目录，任务的相对工作目录以此为准
+	spec      batchFile
+	extra     []string // 命令行上的Agent参数，优先于任务文件中的参数
+	output    string
+	stopOnErr bool
+	shared    *ECNUAgent // 共用会话时所有任务使用的Agent
+}
+
+// batchCommand 执行batch子命令
+func batchCommand(args []string) error {
+	fs := flag.NewFlagSet("chatecnu-agent batch", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), batchUsage) }
+	output := fs.String("output", "", "结果目录")
+	shared := fs.Bool("shared", false, "所有任务在同一个会话中依次执行")
+	stopOnErr := fs.Bool("stop-on-error", false, "任务失败后不再执行剩余的任务")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("缺少任务文件\n%s", batchUsage)
+	}
+
+	r, err := loadBatch(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r.extra = fs.Args()[1:]
+	if len(r.extra) > 0 && r.extra[0] == "--" {
+		r.extra = r.extra[1:]
+	}
+	r.spec.Shared = r.spec.Shared || *shared
+	r.stopOnErr = *stopOnErr
+	r.output = *output
+	if r.output == "" {
+		name := strings.TrimSuffix(filepath.Base(r.file), filepath.Ext(r.file))
+		r.output = filepath.Join(r.dir, name+"-"+time.Now().Format("20060102-150405"))
+	}
+	if err := r.check(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := r.run(ctx)
+	if err != nil {
+		return err
+	}
+	printBatchReport(report, r.output)
+	if failed := report.failed(); failed > 0 {
+		return fmt.Errorf("%d个任务未成功完成", failed)
+	}
+	return nil
+}
+
+// loadBatch 读取任务文件
+func loadBatch(path string) (*batchRunner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取任务文件失败: %v", err)
+	}
+	r := &batchRunner{file: path, dir: filepath.Dir(path)}
+	if err := yaml.Unmarshal(data, &r.spec); err != nil {
+		return nil, fmt.Errorf("解析任务文件失败: %v", err)
+	}
+	if r.spec.Timeout == 0 {
+		r.spec.Timeout = scheduleDefaultTimeout
+	}
+	return r, nil
+}
+
+// check 检查任务文件的内容
+func (r *batchRunner) check() error {
+	if len(r.spec.Tasks) == 0 {
+		return fmt.Errorf("任务文件 %s 中没有任务", r.file)
+	}
+	if r.spec.Timeout < 0 {
+		return fmt.Errorf("timeout不能为负数，当前为%d", r.spec.Timeout)
+	}
+	for i, task := range r.spec.Tasks {
+		if strings.TrimSpace(task.Prompt) == "" {
+			return fmt.Errorf("第%d个任务缺少提示词", i+1)
+		}
+		if task.Timeout < 0 {
+			return fmt.Errorf("第%d个任务的timeout不能为负数，当前为%d", i+1, task.Timeout)
+		}
+		if r.spec.Shared && (task.Workspace != "" || len(task.Args) > 0) {
+			return fmt.Errorf("共用会话时所有任务使用同一个Agent，第%d个任务不能单独指定workspace或args", i+1)
+		}
+	}
+	return nil
+}
+
+// agentArgs 返回任务使用的Agent参数，批量任务不保存会话，也不使用流式输出和命令的实时输出
+func (r *batchRunner) agentArgs(task batchTask) []string {
+	args := []string{"--no-persist", "--no-stream", "--no-live-output"}
+	if task.Workspace != "" {
+		workspace := task.Workspace
+		if !filepath.IsAbs(workspace) {
+			workspace = filepath.Join(r.dir, workspace)
+		}
+		args = append(args, "--workspace", workspace)
+	}
+	args = append(args, r.spec.Args...)
+	args = append(args, task.Args...)
+	return append(args, r.extra...)
+}
+
+// run 依次执行全部任务，汇总报告写入结果目录
+func (r *batchRunner) run(ctx context.Context) (batchReport, error) {
+	report := batchReport{File: r.file, Shared: r.spec.Shared, Started: time.Now()}
+	if err := os.MkdirAll(r.output, 0700); err != nil {
+		return report, fmt.Errorf("创建结果目录失败: %v", err)
+	}
+	if r.spec.Shared {
+		cfg, err := loadConfig(r.agentArgs(batchTask{}))
+		if err != nil {
+			return report, fmt.Errorf("加载配置失败: %v", err)
+		}
+		if r.shared, err = NewECNUAgent("", cfg); err != nil {
+			return report, fmt.Errorf("初始化Agent失败: %v", err)
+		}
+		defer r.shared.recorder.Close()
+		defer r.shared.sandbox.close()
+	}
+
+	stopped := false
+	for i, task := range r.spec.Tasks {
+		result := batchResult{Index: i + 1, Name: task.Name, Prompt: task.Prompt}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("task-%d", i+1)
+		}
+		if stopped || ctx.Err() != nil {
+			result.Status = runSkipped
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "[批量] %d/%d %s\n", i+1, len(r.spec.Tasks), truncateRunes(firstLine(task.Prompt), schedulePreviewRunes))
+		r.execute(ctx, task, &result)
+		fmt.Fprintf(os.Stderr, "[批量] %d/%d %s: %s，用时%s\n", i+1, len(r.spec.Tasks), result.Name, result.Status, result.Finished.Sub(result.Started).Round(time.Second))
+		report.Results = append(report.Results, result)
+		stopped = r.stopOnErr && result.Status != runSuccess
+	}
+	report.Finished = time.Now()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	if err := os.WriteFile(filepath.Join(r.output, "summary.json"), data, 0600); err != nil {
+		return report, fmt.Errorf("写入汇总报告失败: %v", err)
+	}
+	return report, nil
+}
+
+// execute 执行一个任务，执行期间的日志和输出写入该任务的记录文件
+func (r *batchRunner) execute(ctx context.Context, task batchTask, result *batchResult) {
+	result.Started = time.Now()
+	defer func() { result.Finished = time.Now() }()
+	fail := func(err error) {
+		result.Status, result.Error = runFailed, err.Error()
+	}
+
+	result.Transcript = filepath.Join(r.output, fmt.Sprintf("%02d-%s.log", result.Index, batchFileName(result.Name)))
+	transcript, err := os.OpenFile(result.Transcript, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		fail(fmt.Errorf("创建记录文件失败: %v", err))
+		return
+	}
+	defer transcript.Close()
+	fmt.Fprintf(transcript, "任务: %s\n提示词: %s\n", result.Name, task.Prompt)
+
+	agent := r.shared
+	if agent == nil {
+		cfg, err := loadConfig(r.agentArgs(task))
+		if err != nil {
+			fail(fmt.Errorf("加载配置失败: %v", err))
+			return
+		}
+		if agent, err = NewECNUAgent("", cfg); err != nil {
+			fail(fmt.Errorf("初始化Agent失败: %v", err))
+			return
+		}
+		defer agent.recorder.Close()
+		defer agent.sandbox.close()
+	}
+
+	timeout := task.Timeout
+	if timeout == 0 {
+		timeout = r.spec.Timeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Minute)
+	defer cancel()
+
+	// 与定时任务一样，运行期间把日志和标准输出都转到记录文件
+	prevLog, prevStdout := log.Writer(), os.Stdout
+	log.SetOutput(newLogWriter(transcript, agent.config.logLevel(), false))
+	os.Stdout = transcript
+	err = agent.ProcessUserInput(runCtx, task.Prompt)
+	result.Answer = agent.finalAnswer()
+	result.Usage = formatStats(agent.usage.turnStats())
+	fmt.Fprintf(transcript, "\n[最终回答]\n%s\n\n[用量] %s\n", result.Answer, result.Usage)
+	log.SetOutput(prevLog)
+	os.Stdout = prevStdout
+
+	switch {
+	case ctx.Err() != nil:
+		result.Status = runInterrupted
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		result.Status, result.Error = runTimeout, fmt.Sprintf("超过%d分钟的时间上限", timeout)
+	case err != nil:
+		fail(err)
+	default:
+		result.Status = runSuccess
+	}
+}
+
+// failed 返回未成功完成的任务数
+func (r batchReport) failed() int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status != runSuccess {
+			n++
+		}
+	}
+	return n
+}
+
+// printBatchReport 输出汇总报告
+func printBatchReport(report batchReport, output string) {
+	rows := make([][]string, len(report.Results))
+	for i, result := range report.Results {
+		summary := result.Answer
+		if result.Error != "" {
+			summary = result.Error
+		}
+		duration := ""
+		if !result.Started.IsZero() {
+			duration = result.Finished.Sub(result.Started).Round(time.Second).String()
+		}
+		rows[i] = []string{fmt.Sprint(result.Index), result.Name, result.Status, duration, truncateRunes(firstLine(summary), schedulePreviewRunes)}
+	}
+	fmt.Print(formatTableRows([]string{"#", "TASK", "STATUS", "DURATION", "RESULT"}, rows))
+	fmt.Printf("\n%d个任务，%d个成功，用时%s\n", len(report.Results), len(report.Results)-report.failed(), report.Finished.Sub(report.Started).Round(time.Second))
+	fmt.Printf("执行记录和汇总报告(summary.json)已保存到 %s\n", output)
+}
+
+// batchFileName 把任务名转换为可以用作文件名的形式
+func batchFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
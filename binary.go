@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	binarySniffLen = 8000 // 判断是否为二进制文件时检查的字节数
+	maxHexdumpLen  = 4096 // 十六进制预览的最大字节数
+)
+
+// fileMagic 常见二进制格式的文件头
+var fileMagic = []struct {
+	magic string
+	kind  string
+}{
+	{"\x7fELF", "ELF可执行文件或共享库"},
+	{"MZ", "Windows可执行文件（PE）"},
+	{"\xcf\xfa\xed\xfe", "Mach-O可执行文件"},
+	{"\xca\xfe\xba\xbe", "Mach-O通用二进制或Java class文件"},
+	{"\x00asm", "WebAssembly模块"},
+	{"%PDF-", "PDF文档"},
+	{"\x89PNG\r\n\x1a\n", "PNG图片"},
+	{"\xff\xd8\xff", "JPEG图片"},
+	{"GIF8", "GIF图片"},
+	{"BM", "BMP图片"},
+	{"RIFF", "RIFF容器（WAV/AVI/WebP）"},
+	{"PK\x03\x04", "ZIP压缩包（含docx/xlsx/jar等）"},
+	{"\x1f\x8b", "gzip压缩文件"},
+	{"BZh", "bzip2压缩文件"},
+	{"\xfd7zXZ\x00", "xz压缩文件"},
+	{"\x28\xb5\x2f\xfd", "zstd压缩文件"},
+	{"7z\xbc\xaf\x27\x1c", "7z压缩包"},
+	{"Rar!\x1a\x07", "RAR压缩包"},
+	{"SQLite format 3\x00", "SQLite数据库"},
+	{"\x93NUMPY", "NumPy数组文件"},
+	{"\x89HDF\r\n\x1a\n", "HDF5数据文件"},
+	{"PAR1", "Parquet数据文件"},
+}
+
+// isBinary 根据开头部分是否含有NUL字节或大量控制字符判断内容是否为二进制
+//
+// 非UTF-8编码的文本（如GBK）不含NUL字节，不会被视为二进制。
+func isBinary(content []byte) bool {
+	sample := content
+	if len(sample) > binarySniffLen {
+		sample = sample[:binarySniffLen]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+	control := 0
+	for _, c := range sample {
+		if c < 0x20 && c != '\n' && c != '\r' && c != '\t' && c != '\f' && c != '\b' && c != 0x1b {
+			control++
+		}
+	}
+	return len(sample) > 0 && control*10 > len(sample)
+}
+
+// detectFileType 根据文件头识别文件类型
+func detectFileType(content []byte) string {
+	for _, m := range fileMagic {
+		if bytes.HasPrefix(content, []byte(m.magic)) {
+			return m.kind
+		}
+	}
+	if len(content) > 262 && string(content[257:262]) == "ustar" {
+		return "tar归档"
+	}
+	return http.DetectContentType(content)
+}
+
+// binaryFileSummary 返回二进制文件的类型、大小和可选的十六进制预览，而不是原始内容
+func binaryFileSummary(fullPath string, content []byte, hexdumpLen int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 是二进制文件，未输出原始内容\n", fullPath)
+	fmt.Fprintf(&b, "类型: %s\n", detectFileType(content))
+	fmt.Fprintf(&b, "大小: %d字节\n", len(content))
+
+	if hexdumpLen <= 0 && bytes.HasPrefix(content, []byte("%PDF-")) {
+		b.WriteString("可使用read_pdf工具提取其中的文本")
+		return b.String()
+	}
+	if hexdumpLen <= 0 {
+		b.WriteString("如需查看开头的字节，可设置hexdump参数；需要解析该文件时请使用对应的命令行工具（如file、readelf、unzip -l）")
+		return b.String()
+	}
+	if hexdumpLen > maxHexdumpLen {
+		hexdumpLen = maxHexdumpLen
+	}
+	if hexdumpLen > len(content) {
+		hexdumpLen = len(content)
+	}
+	fmt.Fprintf(&b, "前%d字节:\n%s", hexdumpLen, hex.Dump(content[:hexdumpLen]))
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// budgetError 单次任务超出预算时返回的错误
+type budgetError struct {
+	reason string
+}
+
+func (e *budgetError) Error() string {
+	return "已达到任务预算上限: " + e.reason
+}
+
+// taskBudget 单次任务的token、费用和耗时上限，超出后停止任务并询问是否继续
+type taskBudget struct {
+	maxTokens int
+	maxCost   float64
+	maxTime   time.Duration
+
+	started time.Time
+	base    usageStats // 预算开始时已消耗的用量
+}
+
+// newTaskBudget 根据配置创建预算，未设置任何上限时返回nil
+func newTaskBudget(cfg *Config, current usageStats) *taskBudget {
+	if cfg.MaxTaskTokens <= 0 && cfg.MaxTaskCost <= 0 && cfg.MaxTaskTime <= 0 {
+		return nil
+	}
+	return &taskBudget{
+		maxTokens: cfg.MaxTaskTokens,
+		maxCost:   cfg.MaxTaskCost,
+		maxTime:   time.Duration(cfg.MaxTaskTime) * time.Second,
+		started:   time.Now(),
+		base:      current,
+	}
+}
+
+// check 检查从预算开始至今的用量是否超出上限
+func (b *taskBudget) check(current usageStats) error {
+	if b == nil {
+		return nil
+	}
+	if tokens := current.total() - b.base.total(); b.maxTokens > 0 && tokens >= b.maxTokens {
+		return &budgetError{fmt.Sprintf("已使用%d tokens（上限%d）", tokens, b.maxTokens)}
+	}
+	if cost := current.Cost - b.base.Cost; b.maxCost > 0 && cost >= b.maxCost {
+		return &budgetError{fmt.Sprintf("预计费用%.4f（上限%g）", cost, b.maxCost)}
+	}
+	if elapsed := time.Since(b.started); b.maxTime > 0 && elapsed >= b.maxTime {
+		return &budgetError{fmt.Sprintf("已运行%v（上限%v）", elapsed.Round(time.Second), b.maxTime)}
+	}
+	return nil
+}
+
+// extend 以当前用量为起点重新开始计算预算
+func (b *taskBudget) extend(current usageStats) {
+	if b == nil {
+		return
+	}
+	b.started = time.Now()
+	b.base = current
+}
+
+// stopForBudget 超出预算时请模型总结目前的进展，子智能体直接返回错误
+func (a *ECNUAgent) stopForBudget(ctx context.Context, cause error) error {
+	log.Printf("[预算] %v\n", cause)
+	if a.subagent {
+		return cause
+	}
+
+	a.history = append(a.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: fmt.Sprintf("%v。请停止执行，不要调用工具，简要总结目前的进展：已经完成了什么、还有什么没有完成、继续执行的话下一步打算做什么。", cause),
+	})
+	resp, err := a.complete(ctx, nil, nil, a.config.MaxRetries)
+	if err != nil || len(resp.Choices) == 0 {
+		a.history = a.history[:len(a.history)-1]
+		return cause
+	}
+
+	message := resp.Choices[0].Message
+	a.history = append(a.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: message.Content,
+	})
+	if !a.config.Stream {
+		fmt.Fprintf(a.console, "\n[助手] %s\n", a.formatAssistant(message.Content))
+	}
+	return cause
+}
+
+// continueTask 在用户确认后重新计算预算并继续之前的任务
+func (a *ECNUAgent) continueTask(ctx context.Context) error {
+	a.budget.extend(a.usage.turnStats())
+	return a.runTask(ctx, "请继续完成之前的任务。")
+}
+
+// askYesNo 向用户提问，回答y或yes时返回true
+func askYesNo(w io.Writer, in *inputLines, prompt string) bool {
+	fmt.Fprint(w, prompt)
+	line, ok := in.next()
+	return ok && answerYes(line)
+}
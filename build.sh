@@ -26,7 +26,7 @@ go mod tidy
 
 # 构建可执行文件
 echo "编译中..."
-go build -ldflags="-s -w" -o chatecnu-agent main.go
+go build -ldflags="-s -w" -o chatecnu-agent .
 
 # 检查构建是否成功
 if [ -f "./chatecnu-agent" ]; then
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// cachedNotice 返回缓存结果时附加的说明
+const cachedNotice = "（本轮任务中已执行过相同的调用，期间没有写入操作，以下为缓存的结果）\n"
+
+// readOnlyCommands 结果只取决于文件内容、可以在两次写入之间缓存的命令
+var readOnlyCommands = map[string]bool{
+	"cat": true, "head": true, "tail": true, "ls": true, "wc": true, "file": true, "stat": true,
+	"grep": true, "egrep": true, "fgrep": true, "rg": true, "find": true, "tree": true, "du": true,
+	"pwd": true, "which": true, "whoami": true, "id": true, "uname": true, "hostname": true,
+	"realpath": true, "readlink": true, "basename": true, "dirname": true,
+	"md5sum": true, "sha1sum": true, "sha256sum": true, "sort": true, "uniq": true, "cut": true, "echo": true,
+}
+
+// isReadOnlyCommand 保守地判断命令是否只读取文件，含重定向、命令替换或多条命令时一律视为有副作用
+func isReadOnlyCommand(command string) bool {
+	if strings.ContainsAny(command, ">;&`\n") || strings.Contains(command, "$(") {
+		return false
+	}
+	for _, segment := range strings.Split(command, "|") {
+		fields := strings.Fields(segment)
+		if len(fields) == 0 || !readOnlyCommands[fields[0]] || writesViaOptions(fields) {
+			return false
+		}
+		for _, arg := range fields[1:] {
+			switch arg {
+			case "-exec", "-execdir", "-delete", "-ok", "-f", "-F", "--follow":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cacheEntry 一次只读调用的结果，done关闭后result和ok才有效
+type cacheEntry struct {
+	done   chan struct{}
+	result string
+	ok     bool
+}
+
+// toolCache 在一轮任务内缓存只读工具的结果，任何可能产生写入的调用都会清空缓存
+//
+// 同一批次中并发的相同调用只执行一次，其余调用等待第一次的结果。
+type toolCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// reset 清空缓存
+func (c *toolCache) reset() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// lookup 查找缓存的结果，没有时登记一个新条目并返回owner为true，由调用方执行后调用finish
+func (c *toolCache) lookup(key string) (entry *cacheEntry, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		return entry, false
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+	entry = &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	return entry, true
+}
+
+// finish 保存执行结果，失败的结果不保留在缓存中
+func (c *toolCache) finish(key string, entry *cacheEntry, result string, ok bool) {
+	entry.result, entry.ok = result, ok
+	close(entry.done)
+	if ok {
+		return
+	}
+	c.mu.Lock()
+	if c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+}
+
+// isCacheableCall 判断工具调用的结果能否缓存
+func (a *ECNUAgent) isCacheableCall(call openai.ToolCall) bool {
+	if call.Function.Name == "execute_command" {
+		var params struct {
+			Command string `json:"command"`
+			Reset   bool   `json:"reset"`
+		}
+		return json.Unmarshal([]byte(call.Function.Arguments), &params) == nil && !params.Reset && isReadOnlyCommand(params.Command)
+	}
+	for _, tool := range a.tools {
+		if tool.Name == call.Function.Name {
+			return tool.Cacheable
+		}
+	}
+	return false
+}
+
+// cachedToolCall 对只读调用使用缓存，其他调用执行前后清空缓存
+func (a *ECNUAgent) cachedToolCall(call openai.ToolCall, run func() (string, bool)) string {
+	if !a.isCacheableCall(call) {
+		a.cache.reset()
+		result, _ := run()
+		a.cache.reset()
+		return result
+	}
+
+	key := toolCallSignature([]openai.ToolCall{call})
+	entry, owner := a.cache.lookup(key)
+	if !owner {
+		<-entry.done
+		if entry.ok {
+			log.Printf("[缓存] %s 使用本轮任务中缓存的结果\n", call.Function.Name)
+			return cachedNotice + entry.result
+		}
+		result, _ := run()
+		return result
+	}
+	result, ok := run()
+	a.cache.finish(key, entry, result, ok)
+	return result
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// textEncoding 文件使用的文本编码
+type textEncoding struct {
+	name string
+	enc  encoding.Encoding // 为nil表示不带BOM的UTF-8，无需转换
+}
+
+var (
+	encodingUTF8       = textEncoding{name: "UTF-8"}
+	encodingUTF8BOM    = textEncoding{name: "UTF-8 (BOM)", enc: unicode.UTF8BOM}
+	encodingGBK        = textEncoding{name: "GBK", enc: simplifiedchinese.GBK}
+	encodingGB18030    = textEncoding{name: "GB18030", enc: simplifiedchinese.GB18030}
+	encodingUTF16LE    = textEncoding{name: "UTF-16LE", enc: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+	encodingUTF16BE    = textEncoding{name: "UTF-16BE", enc: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+	encodingUTF16LEBOM = textEncoding{name: "UTF-16LE (BOM)", enc: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)}
+	encodingUTF16BEBOM = textEncoding{name: "UTF-16BE (BOM)", enc: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)}
+)
+
+// encodingNames write_file的encoding参数可用的编码名称
+var encodingNames = map[string]textEncoding{
+	"utf-8":     encodingUTF8,
+	"utf8":      encodingUTF8,
+	"utf-8-bom": encodingUTF8BOM,
+	"gbk":       encodingGBK,
+	"gb2312":    encodingGBK,
+	"cp936":     encodingGBK,
+	"gb18030":   encodingGB18030,
+	"utf-16":    encodingUTF16LEBOM,
+	"utf-16le":  encodingUTF16LE,
+	"utf-16be":  encodingUTF16BE,
+}
+
+// lookupEncoding 根据名称查找编码，名称不区分大小写
+func lookupEncoding(name string) (textEncoding, error) {
+	if name == "" {
+		return encodingUTF8, nil
+	}
+	e, ok := encodingNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return textEncoding{}, fmt.Errorf("不支持的编码: %s，可用编码为utf-8、utf-8-bom、gbk、gb18030、utf-16、utf-16le、utf-16be", name)
+	}
+	return e, nil
+}
+
+// isUTF8 判断是否为不需要转换的UTF-8编码
+func (e textEncoding) isUTF8() bool {
+	return e.enc == nil
+}
+
+// detectEncoding 识别文本的编码，内容为二进制时ok为false
+//
+// 依次检查BOM、无BOM的UTF-16、UTF-8，都不符合时尝试GBK和GB18030。
+func detectEncoding(content []byte) (e textEncoding, ok bool) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xef, 0xbb, 0xbf}):
+		return encodingUTF8BOM, true
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		return encodingUTF16LEBOM, true
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		return encodingUTF16BEBOM, true
+	}
+	if e, ok := detectUTF16(content); ok {
+		return e, true
+	}
+	if isBinary(content) {
+		return textEncoding{}, false
+	}
+	if utf8.Valid(content) {
+		return encodingUTF8, true
+	}
+	for _, e := range []textEncoding{encodingGBK, encodingGB18030} {
+		if decoded, err := e.enc.NewDecoder().Bytes(content); err == nil && !bytes.ContainsRune(decoded, utf8.RuneError) {
+			return e, true
+		}
+	}
+	// 无法识别时按UTF-8处理，无效字节显示为替换字符
+	return encodingUTF8, true
+}
+
+// detectUTF16 根据NUL字节集中在奇数或偶数位置判断无BOM的UTF-16文本（以ASCII为主时有效）
+func detectUTF16(content []byte) (textEncoding, bool) {
+	sample := content
+	if len(sample) > binarySniffLen {
+		sample = sample[:binarySniffLen]
+	}
+	if len(sample) < 4 || len(sample)%2 != 0 {
+		return textEncoding{}, false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 >= pairs*9 && evenZeros == 0:
+		return encodingUTF16LE, true
+	case evenZeros*10 >= pairs*9 && oddZeros == 0:
+		return encodingUTF16BE, true
+	}
+	return textEncoding{}, false
+}
+
+// decode 将内容从该编码转换为UTF-8
+func (e textEncoding) decode(content []byte) (string, error) {
+	if e.isUTF8() {
+		return string(content), nil
+	}
+	decoded, err := e.enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return "", fmt.Errorf("按%s解码失败: %v", e.name, err)
+	}
+	return string(decoded), nil
+}
+
+// encode 将UTF-8文本转换为该编码
+func (e textEncoding) encode(text string) ([]byte, error) {
+	if e.isUTF8() {
+		return []byte(text), nil
+	}
+	encoded, err := e.enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("内容无法用%s编码: %v", e.name, err)
+	}
+	return encoded, nil
+}
+
+// decodeText 识别编码并转换为UTF-8文本，内容为二进制时ok为false
+func decodeText(content []byte) (text string, e textEncoding, ok bool) {
+	e, ok = detectEncoding(content)
+	if !ok {
+		return "", e, false
+	}
+	text, err := e.decode(content)
+	if err != nil {
+		return string(content), encodingUTF8, true
+	}
+	return text, e, true
+}
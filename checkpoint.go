@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	checkpointMaxFileSize = 20 * 1024 * 1024 // 超过该大小的文件不放入检查点
+	checkpointMaxFiles    = 20000            // 单个检查点最多包含的文件数
+)
+
+// checkpointFile 检查点中的一个文件，内容按sha256存放在objects目录下
+type checkpointFile struct {
+	Path string      `json:"path"`
+	Mode os.FileMode `json:"mode"`
+	Sum  string      `json:"sum,omitempty"`
+	Link string      `json:"link,omitempty"`
+}
+
+// checkpoint 一个检查点的清单
+type checkpoint struct {
+	ID          string           `json:"id"`
+	Created     time.Time        `json:"created"`
+	Description string           `json:"description,omitempty"`
+	Workspace   string           `json:"workspace"`
+	Files       []checkpointFile `json:"files"`
+	Skipped     []string         `json:"skipped,omitempty"`
+}
+
+// checkpointDir 返回当前工作区的检查点目录，不同工作区的检查点分开存放
+func (a *ECNUAgent) checkpointDir() string {
+	root := filepath.Join(os.TempDir(), "ecnu-agent-checkpoints")
+	if home, err := os.UserHomeDir(); err == nil {
+		root = filepath.Join(home, ".ecnu-agent", "checkpoints")
+	}
+	sum := sha256.Sum256([]byte(a.workingDir))
+	return filepath.Join(root, filepath.Base(a.workingDir)+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// objectPath 返回内容对象的存放路径
+func objectPath(dir, sum string) string {
+	return filepath.Join(dir, "objects", sum[:2], sum[2:])
+}
+
+// walkWorkspace 遍历工作区中需要纳入检查点的文件，遵循.gitignore并跳过.git、node_modules等目录
+func (a *ECNUAgent) walkWorkspace(fn func(rel, p string, d fs.DirEntry) error) error {
+	root := a.workingDir
+	rules := map[string]ignoreRules{root: ignoreRules(nil).withDir(root, "")}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		rel := relativeTo(root, p)
+		parent := rules[filepath.Dir(p)]
+		if (d.IsDir() && skippedDirs[d.Name()]) || parent.ignored(rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			rules[p] = parent.withDir(p, rel)
+			return nil
+		}
+		return fn(rel, p, d)
+	})
+}
+
+// createCheckpoint 为工作区创建检查点，内容相同的文件只保存一份
+func (a *ECNUAgent) createCheckpoint(description string) (*checkpoint, error) {
+	dir := a.checkpointDir()
+	now := time.Now()
+	cp := &checkpoint{ID: now.Format("20060102-150405"), Created: now, Description: description, Workspace: a.workingDir}
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, cp.ID+".json")); os.IsNotExist(err) {
+			break
+		}
+		cp.ID = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+	}
+
+	err := a.walkWorkspace(func(rel, p string, d fs.DirEntry) error {
+		if len(cp.Files) >= checkpointMaxFiles {
+			return fmt.Errorf("工作区中的文件超过%d个，请在.gitignore中排除不需要的目录", checkpointMaxFiles)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		file := checkpointFile{Path: rel, Mode: info.Mode()}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if file.Link, err = os.Readlink(p); err != nil {
+				return nil
+			}
+		case !info.Mode().IsRegular():
+			return nil
+		case info.Size() > checkpointMaxFileSize:
+			cp.Skipped = append(cp.Skipped, rel)
+			return nil
+		default:
+			if file.Sum, err = storeObject(dir, p); err != nil {
+				return err
+			}
+		}
+		cp.Files = append(cp.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建检查点目录失败: %v", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, cp.ID+".json"), data, 0600); err != nil {
+		return nil, fmt.Errorf("保存检查点失败: %v", err)
+	}
+	log.Printf("[检查点] 已创建%s（%d个文件）\n", cp.ID, len(cp.Files))
+	return cp, nil
+}
+
+// storeObject 把文件内容保存为对象，已存在相同内容时直接复用
+func storeObject(dir, p string) (string, error) {
+	sum, _, err := hashFile(p, sha256.New)
+	if err != nil {
+		return "", err
+	}
+	obj := objectPath(dir, sum)
+	if _, err := os.Stat(obj); err == nil {
+		return sum, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0700); err != nil {
+		return "", fmt.Errorf("创建检查点目录失败: %v", err)
+	}
+	if err := copyRegularFile(p, obj, 0600); err != nil {
+		return "", fmt.Errorf("保存%s失败: %v", p, err)
+	}
+	return sum, nil
+}
+
+// loadCheckpoint 读取检查点清单
+func (a *ECNUAgent) loadCheckpoint(id string) (*checkpoint, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("检查点ID无效: %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(a.checkpointDir(), id+".json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("检查点%s不存在", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("检查点%s已损坏: %v", id, err)
+	}
+	return &cp, nil
+}
+
+// listCheckpoints 返回当前工作区的检查点，按创建时间排列
+func (a *ECNUAgent) listCheckpoints() []*checkpoint {
+	entries, _ := os.ReadDir(a.checkpointDir())
+	var list []*checkpoint
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok {
+			if cp, err := a.loadCheckpoint(id); err == nil {
+				list = append(list, cp)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// restoreCheckpoint 把工作区恢复到检查点的状态，检查点之后新增的文件移入回收站
+func (a *ECNUAgent) restoreCheckpoint(cp *checkpoint) (restored, removed int, err error) {
+	dir := a.checkpointDir()
+	saved := make(map[string]bool, len(cp.Files))
+	for _, f := range cp.Files {
+		saved[f.Path] = true
+	}
+	for _, rel := range cp.Skipped {
+		saved[rel] = true
+	}
+
+	// 先找出检查点之后新增的文件，避免把刚恢复的文件当作新增
+	var added []string
+	err = a.walkWorkspace(func(rel, p string, d fs.DirEntry) error {
+		if !saved[rel] {
+			added = append(added, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, p := range added {
+		if _, err := a.trash.put(p); err != nil {
+			return restored, removed, err
+		}
+		removed++
+	}
+
+	for _, f := range cp.Files {
+		p := filepath.Join(a.workingDir, filepath.FromSlash(f.Path))
+		info, statErr := os.Lstat(p)
+		if f.Link != "" {
+			if statErr == nil {
+				if target, err := os.Readlink(p); err == nil && target == f.Link {
+					continue
+				}
+				if _, err := a.trash.put(p); err != nil {
+					return restored, removed, err
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return restored, removed, err
+			}
+			if err := os.Symlink(f.Link, p); err != nil {
+				return restored, removed, err
+			}
+			restored++
+			continue
+		}
+
+		if statErr == nil && info.Mode().IsRegular() && contentSum(p) == f.Sum {
+			if info.Mode().Perm() != f.Mode.Perm() {
+				os.Chmod(p, f.Mode.Perm())
+			}
+			continue
+		}
+		data, err := os.ReadFile(objectPath(dir, f.Sum))
+		if err != nil {
+			return restored, removed, fmt.Errorf("读取%s的内容失败: %v", f.Path, err)
+		}
+		if statErr == nil && !info.Mode().IsRegular() {
+			if _, err := a.trash.put(p); err != nil {
+				return restored, removed, err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return restored, removed, err
+		}
+		if err := writeFileAtomic(p, data, f.Mode.Perm()); err != nil {
+			return restored, removed, fmt.Errorf("恢复%s失败: %v", f.Path, err)
+		}
+		os.Chmod(p, f.Mode.Perm())
+		restored++
+	}
+	return restored, removed, nil
+}
+
+// checkpointCommand 处理/checkpoint命令，不带参数或带描述时创建检查点
+func (a *ECNUAgent) checkpointCommand(args []string) {
+	if len(args) == 1 && args[0] == "list" {
+		list := a.listCheckpoints()
+		if len(list) == 0 {
+			fmt.Println("当前工作区没有检查点，使用 /checkpoint [描述] 创建")
+			return
+		}
+		fmt.Printf("%s 的检查点:\n", a.workingDir)
+		for _, cp := range list {
+			line := fmt.Sprintf("  %s  %d个文件", cp.ID, len(cp.Files))
+			if cp.Description != "" {
+				line += "  " + cp.Description
+			}
+			fmt.Println(line)
+		}
+		return
+	}
+
+	cp, err := a.createCheckpoint(strings.Join(args, " "))
+	if err != nil {
+		fmt.Printf("创建检查点失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已创建检查点 %s（%d个文件），使用 /restore %s 恢复\n", cp.ID, len(cp.Files), cp.ID)
+	if len(cp.Skipped) > 0 {
+		fmt.Printf("以下文件超过%s，未放入检查点: %s\n", formatSize(checkpointMaxFileSize), strings.Join(cp.Skipped, ", "))
+	}
+}
+
+// restoreCommand 处理/restore命令，恢复前自动为当前状态创建检查点
+func (a *ECNUAgent) restoreCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Println("用法: /restore <检查点ID>，使用 /checkpoint list 查看检查点")
+		return
+	}
+	cp, err := a.loadCheckpoint(args[0])
+	if err != nil {
+		fmt.Printf("恢复失败: %v\n", err)
+		return
+	}
+	current, err := a.createCheckpoint("恢复" + cp.ID + "之前的状态")
+	if err != nil {
+		fmt.Printf("恢复失败: 无法为当前状态创建检查点: %v\n", err)
+		return
+	}
+
+	restored, removed, err := a.restoreCheckpoint(cp)
+	if err != nil {
+		fmt.Printf("恢复过程中出错（已恢复%d个文件，移除%d个文件）: %v\n", restored, removed, err)
+		fmt.Printf("恢复前的状态已保存为检查点 %s\n", current.ID)
+		return
+	}
+	summary := fmt.Sprintf("已将工作区恢复到检查点 %s：恢复%d个文件，%d个之后新增的文件已移入回收站", cp.ID, restored, removed)
+	fmt.Println(summary)
+	fmt.Printf("恢复前的状态已保存为检查点 %s，可用 /restore %s 撤回\n", current.ID, current.ID)
+
+	if restored > 0 || removed > 0 {
+		a.history = append(a.history, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: "（" + summary + "，之后请以文件的当前内容为准）",
+		})
+		a.saveState()
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// hashAlgorithms checksum支持的哈希算法
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksumTool 计算文件哈希的工具定义
+var checksumTool = Tool{
+	Type:        "function",
+	Name:        "checksum",
+	Cacheable:   true,
+	Description: "计算一个或多个文件的哈希值（md5、sha1、sha256、sha512），可以与期望值比较，用于校验下载或部署的文件，不依赖md5sum、shasum等平台相关的命令。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"paths": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "要计算的文件路径列表",
+			},
+			"algorithm": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"md5", "sha1", "sha256", "sha512"},
+				"description": "哈希算法，默认sha256",
+				"default":     "sha256",
+			},
+			"expected": map[string]interface{}{
+				"type":        "string",
+				"description": "期望的哈希值（十六进制，不区分大小写），只计算一个文件时可用",
+			},
+		},
+		"required": []string{"paths"},
+	},
+}
+
+// compareFilesTool 比较两个文件是否相同的工具定义
+var compareFilesTool = Tool{
+	Type:        "function",
+	Name:        "compare_files",
+	Cacheable:   true,
+	Description: "逐字节比较两个文件是否完全相同，不同时给出大小以及第一个不同之处的字节偏移和行号。需要查看具体差异时使用diff相关工具。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path_a": map[string]interface{}{
+				"type":        "string",
+				"description": "第一个文件路径",
+			},
+			"path_b": map[string]interface{}{
+				"type":        "string",
+				"description": "第二个文件路径",
+			},
+		},
+		"required": []string{"path_a", "path_b"},
+	},
+}
+
+// hashFile 流式计算文件的哈希值
+func hashFile(fullPath string, newHash func() hash.Hash) (string, int64, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return "", 0, fmt.Errorf("%s是目录", fullPath)
+	}
+
+	h := newHash()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// checksum 计算文件哈希，指定expected时给出校验结果
+func (a *ECNUAgent) checksum(args string) (string, error) {
+	params := struct {
+		Paths     []string `json:"paths"`
+		Algorithm string   `json:"algorithm"`
+		Expected  string   `json:"expected"`
+	}{Algorithm: "sha256"}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if len(params.Paths) == 0 {
+		return "", fmt.Errorf("缺少paths参数")
+	}
+	algorithm := strings.ToLower(params.Algorithm)
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("不支持的哈希算法: %s", params.Algorithm)
+	}
+	if params.Expected != "" && len(params.Paths) > 1 {
+		return "", fmt.Errorf("expected只能在计算单个文件时使用")
+	}
+	log.Printf("[校验和] %s (%s)\n", strings.Join(params.Paths, ", "), algorithm)
+
+	// 与sha256sum等命令的输出格式一致，便于和发布页面上的校验值对照
+	var b strings.Builder
+	for _, p := range params.Paths {
+		fullPath := a.resolvePath(p)
+		sum, size, err := hashFile(fullPath, newHash)
+		if err != nil {
+			fmt.Fprintf(&b, "%s: 计算失败: %v\n", fullPath, err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s  %s (%s)\n", sum, fullPath, formatSize(size))
+		if params.Expected != "" {
+			if strings.EqualFold(sum, strings.TrimSpace(params.Expected)) {
+				b.WriteString("校验通过: 与期望值一致\n")
+			} else {
+				fmt.Fprintf(&b, "校验失败: 期望%s，实际%s\n", strings.ToLower(strings.TrimSpace(params.Expected)), sum)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// compareFiles 逐字节比较两个文件
+func (a *ECNUAgent) compareFiles(args string) (string, error) {
+	var params struct {
+		PathA string `json:"path_a"`
+		PathB string `json:"path_b"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.PathA == "" || params.PathB == "" {
+		return "", fmt.Errorf("缺少path_a或path_b参数")
+	}
+
+	pathA, pathB := a.resolvePath(params.PathA), a.resolvePath(params.PathB)
+	log.Printf("[比较文件] %s <-> %s\n", pathA, pathB)
+
+	infoA, err := os.Stat(pathA)
+	if err != nil {
+		return fmt.Sprintf("比较失败: %v", err), nil
+	}
+	infoB, err := os.Stat(pathB)
+	if err != nil {
+		return fmt.Sprintf("比较失败: %v", err), nil
+	}
+	if infoA.IsDir() || infoB.IsDir() {
+		return "比较失败: 只能比较文件，不能比较目录", nil
+	}
+	if os.SameFile(infoA, infoB) {
+		return fmt.Sprintf("两个路径指向同一个文件: %s", pathA), nil
+	}
+
+	offset, line, err := firstDifference(pathA, pathB)
+	if err != nil {
+		return fmt.Sprintf("比较失败: %v", err), nil
+	}
+	if offset < 0 {
+		return fmt.Sprintf("文件相同: %s 与 %s（%s）", pathA, pathB, formatSize(infoA.Size())), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "文件不同: %s 与 %s\n", pathA, pathB)
+	fmt.Fprintf(&b, "大小: %d字节 / %d字节\n", infoA.Size(), infoB.Size())
+	if offset == min(infoA.Size(), infoB.Size()) {
+		fmt.Fprintf(&b, "较短的文件是另一个文件的前缀，在字节偏移%d（第%d行）处结束\n", offset, line)
+	} else {
+		fmt.Fprintf(&b, "第一个不同之处: 字节偏移%d（第%d行）\n", offset, line)
+	}
+	return b.String(), nil
+}
+
+// firstDifference 返回两个文件第一个不同字节的偏移和所在行号，相同时偏移为-1
+func firstDifference(pathA, pathB string) (int64, int, error) {
+	fa, err := os.Open(pathA)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(pathB)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fb.Close()
+
+	ra, rb := bufio.NewReaderSize(fa, 64*1024), bufio.NewReaderSize(fb, 64*1024)
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	var offset int64
+	line := 1
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return 0, 0, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return 0, 0, errB
+		}
+		n := min(na, nb)
+		for i := 0; i < n; i++ {
+			if bufA[i] != bufB[i] {
+				return offset + int64(i), line + bytes.Count(bufA[:i], []byte{'\n'}), nil
+			}
+		}
+		if na != nb {
+			return offset + int64(n), line + bytes.Count(bufA[:n], []byte{'\n'}), nil
+		}
+		if na == 0 {
+			return -1, 0, nil
+		}
+		offset += int64(n)
+		line += bytes.Count(bufA[:n], []byte{'\n'})
+	}
+}
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hostTimeout      = 30 * time.Second // 单次API请求的时间上限
+	hostDefaultLimit = 20               // 列出issue和PR时默认的条数
+	hostMaxLimit     = 100              // 列出issue和PR时最多的条数，即API单页的上限
+	hostMaxComments  = 50               // 查看issue和PR时最多显示的评论数
+	hostMaxPages     = 10               // 列表接口最多读取的页数
+	hostPromptLines  = 20               // 发布前的确认中最多显示的正文行数
+	hostMaxResponse  = 32 * 1024 * 1024 // API响应的大小上限，PR的diff可能很大
+)
+
+// hostRepoPattern owner/repo形式的仓库名，GitLab的仓库可以位于多级分组中
+var hostRepoPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+(/[A-Za-z0-9_.\-]+)+$`)
+
+// hostReviewEvents review可用的评审结论
+var hostReviewEvents = map[string]string{"COMMENT": "评论", "APPROVE": "批准", "REQUEST_CHANGES": "请求修改"}
+
+// codeHostTool GitHub和GitLab的工具定义
+var codeHostTool = Tool{
+	Type:       "function",
+	Name:       "code_host",
+	Sequential: true,
+	Description: "通过GitHub或GitLab的API处理issue、PR（GitLab的MR）和CI，用于代码评审和issue分类。默认操作工作目录git仓库的origin对应的项目。" +
+		"list_issues、get_issue列出和查看issue及其评论；list_prs、get_pr列出和查看PR的说明、修改的文件和评论；pr_diff返回PR的完整diff；ci_status查看PR或分支最新提交的CI检查结果；" +
+		"create_issue创建issue，comment在issue或PR下评论，review对PR发表评审意见并可以附带针对具体行的评论，这三项发布前会询问用户确认。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list_issues", "get_issue", "create_issue", "comment", "list_prs", "get_pr", "pr_diff", "review", "ci_status"},
+				"description": "要执行的操作",
+			},
+			"repo": map[string]interface{}{
+				"type":        "string",
+				"description": "owner/repo形式的项目，GitLab可以是group/subgroup/project，默认根据工作目录git仓库的origin推断",
+			},
+			"provider": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"github", "gitlab"},
+				"description": "代码托管平台，默认根据origin的地址推断，指定repo时默认为github",
+			},
+			"number": map[string]interface{}{
+				"type":        "integer",
+				"description": "issue或PR的编号（GitLab为iid）",
+			},
+			"pr": map[string]interface{}{
+				"type":        "boolean",
+				"description": "comment的对象是PR（GitLab的MR）而不是issue。GitLab上issue和MR分别编号，评论MR时必须设置",
+			},
+			"state": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"open", "closed", "all"},
+				"description": "list_issues和list_prs按状态筛选，默认open",
+			},
+			"labels": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "list_issues只列出带有这些标签的issue；create_issue为新issue添加的标签",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "create_issue的标题",
+			},
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "create_issue的正文，comment的评论内容，review的总体评审意见，支持Markdown",
+			},
+			"event": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"COMMENT", "APPROVE", "REQUEST_CHANGES"},
+				"description": "review的结论，默认COMMENT只评论",
+			},
+			"comments": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"path": map[string]interface{}{"type": "string", "description": "文件在仓库中的路径"},
+						"line": map[string]interface{}{"type": "integer", "description": "修改后文件中的行号，必须是diff中出现的行"},
+						"body": map[string]interface{}{"type": "string", "description": "评论内容"},
+					},
+					"required": []string{"path", "line", "body"},
+				},
+				"description": "review附带的针对具体行的评论",
+			},
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "ci_status查看的分支、标签或提交，默认为当前分支；提供number时查看该PR",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "list_issues和list_prs最多返回的条数，默认20",
+				"minimum":     1,
+				"maximum":     hostMaxLimit,
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// hostParams code_host的参数
+type hostParams struct {
+	Action   string          `json:"action"`
+	Repo     string          `json:"repo"`
+	Provider string          `json:"provider"`
+	Number   int             `json:"number"`
+	Pull     bool            `json:"pr"`
+	State    string          `json:"state"`
+	Labels   []string        `json:"labels"`
+	Title    string          `json:"title"`
+	Body     string          `json:"body"`
+	Event    string          `json:"event"`
+	Comments []reviewComment `json:"comments"`
+	Ref      string          `json:"ref"`
+	Limit    int             `json:"limit"`
+}
+
+// reviewComment 评审中针对一行的评论
+type reviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Body string `json:"body"`
+}
+
+// hostItem 一个issue或PR
+type hostItem struct {
+	number         int
+	title, state   string
+	author, url    string
+	body           string
+	labels         []string
+	comments       int
+	updated        time.Time
+	source, target string // PR的源分支和目标分支
+	draft          bool
+	merge          string // PR能否合并
+}
+
+// hostComment issue或PR中的一条评论，path和line为针对代码的评论所在的位置
+type hostComment struct {
+	author, body string
+	created      time.Time
+	path         string
+	line         int
+}
+
+// hostFile PR修改的一个文件
+type hostFile struct {
+	path, status         string
+	additions, deletions int
+}
+
+// hostCheck 一项CI检查或任务
+type hostCheck struct {
+	name, status, url string
+}
+
+// codeHost GitHub或GitLab上一个项目的API
+type codeHost interface {
+	String() string // 平台和项目，如GitHub owner/repo
+	pullName() string
+	pullRef(number int) string // PR的引用写法，如PR #2或MR !2
+	listIssues(ctx context.Context, state string, labels []string, limit int) ([]hostItem, error)
+	getIssue(ctx context.Context, number int) (hostItem, []hostComment, error)
+	createIssue(ctx context.Context, title, body string, labels []string) (hostItem, error)
+	comment(ctx context.Context, number int, pull bool, body string) (string, error)
+	listPulls(ctx context.Context, state string, limit int) ([]hostItem, error)
+	getPull(ctx context.Context, number int) (hostItem, []hostFile, []hostComment, error)
+	pullDiff(ctx context.Context, number int) (string, error)
+	review(ctx context.Context, number int, event, body string, comments []reviewComment) (string, error)
+	ciStatus(ctx context.Context, number int, ref string) (string, []hostCheck, error)
+}
+
+// hostClient 带认证的JSON API客户端
+type hostClient struct {
+	base   string
+	header string // 放置令牌的请求头
+	token  string
+	client *http.Client
+}
+
+// hostAPIError API返回的错误
+type hostAPIError struct {
+	status  int
+	message string
+}
+
+// Error 返回错误说明，附带常见状态码的原因
+func (e *hostAPIError) Error() string {
+	text := fmt.Sprintf("API返回%d", e.status)
+	if e.message != "" {
+		text += ": " + e.message
+	}
+	switch e.status {
+	case http.StatusUnauthorized:
+		text += "（令牌无效或已过期）"
+	case http.StatusForbidden:
+		text += "（令牌权限不足或达到请求频率限制）"
+	case http.StatusNotFound:
+		text += "（项目或编号不存在，私有项目需要配置有权限的令牌）"
+	case http.StatusUnprocessableEntity:
+		text += "（参数不被接受，如行号不在diff中）"
+	}
+	return text
+}
+
+// do 发送请求并返回响应内容，body不为nil时以JSON发送，out不为nil时把响应解析到out
+func (c *hostClient) do(ctx context.Context, method, path string, query url.Values, body interface{}, accept string, out interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, hostTimeout)
+	defer cancel()
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set(c.header, tokenHeaderValue(c.header, c.token))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accept == "" {
+		accept = "application/json"
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "chatecnu-agent")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, hostMaxResponse))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		json.Unmarshal(data, &e)
+		msg := e.Error
+		if e.Message != nil {
+			msg = fmt.Sprint(e.Message)
+		}
+		return nil, &hostAPIError{status: resp.StatusCode, message: msg}
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, fmt.Errorf("解析API响应失败: %v", err)
+		}
+	}
+	return data, nil
+}
+
+// list 逐页读取列表接口，对每一项调用each，each返回该项是否计入limit，读够limit项或没有下一页时停止
+func (c *hostClient) list(ctx context.Context, path string, query url.Values, limit int, each func(item json.RawMessage) (bool, error)) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("per_page", strconv.Itoa(hostMaxLimit))
+	count := 0
+	for page := 1; page <= hostMaxPages; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var items []json.RawMessage
+		if _, err := c.do(ctx, http.MethodGet, path, query, nil, "", &items); err != nil {
+			return err
+		}
+		for _, item := range items {
+			counted, err := each(item)
+			if err != nil {
+				return fmt.Errorf("解析API响应失败: %v", err)
+			}
+			if counted {
+				if count++; count >= limit {
+					return nil
+				}
+			}
+		}
+		if len(items) < hostMaxLimit {
+			return nil
+		}
+	}
+	return nil
+}
+
+// tokenHeaderValue Authorization头需要Bearer前缀，GitLab的PRIVATE-TOKEN头直接使用令牌
+func tokenHeaderValue(header, token string) string {
+	if header == "Authorization" {
+		return "Bearer " + token
+	}
+	return token
+}
+
+// parseRemoteURL 从git远程地址中解析主机和项目路径，支持https、ssh://和scp形式的地址
+func parseRemoteURL(remote string) (host, path string, ok bool) {
+	remote = strings.TrimSpace(remote)
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", false
+		}
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, found := strings.Cut(remote, ":"); found && !strings.Contains(at, "/") {
+		// git@github.com:owner/repo.git
+		host = at[strings.LastIndex(at, "@")+1:]
+		path = rest
+	} else {
+		return "", "", false
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return host, path, host != "" && hostRepoPattern.MatchString(path)
+}
+
+// openCodeHost 根据参数或工作目录git仓库的origin确定平台和项目
+func (a *ECNUAgent) openCodeHost(ctx context.Context, params hostParams) (codeHost, error) {
+	provider, repo := params.Provider, params.Repo
+	gitlabBase := strings.TrimSuffix(a.config.GitLabURL, "/")
+	if repo == "" {
+		remote, err := gitRepo{root: a.workingDir}.run(ctx, "", "remote", "get-url", "origin")
+		if err != nil {
+			return nil, fmt.Errorf("工作目录不是git仓库或没有origin远程仓库，请用repo参数指定项目")
+		}
+		host, path, ok := parseRemoteURL(remote)
+		if !ok {
+			return nil, fmt.Errorf("无法从origin的地址%s中识别项目，请用repo参数指定", remote)
+		}
+		repo = path
+		gitlabHost := ""
+		if u, err := url.Parse(gitlabBase); err == nil {
+			gitlabHost = u.Hostname()
+		}
+		switch {
+		case provider != "":
+		case host == "github.com" || strings.Contains(a.config.GitHubURL, "://"+host+"/"):
+			provider = "github"
+		case host == gitlabHost:
+			provider = "gitlab"
+		case strings.Contains(host, "gitlab"):
+			// 未配置的自建GitLab，使用origin的主机
+			provider, gitlabBase = "gitlab", "https://"+host
+		default:
+			return nil, fmt.Errorf("无法判断%s是GitHub还是GitLab，请用provider参数指定，自建GitLab请设置--gitlab-url", host)
+		}
+	}
+	if !hostRepoPattern.MatchString(repo) {
+		return nil, fmt.Errorf("项目%q不是owner/repo的形式", repo)
+	}
+	client := &http.Client{}
+	switch provider {
+	case "", "github":
+		if strings.Count(repo, "/") != 1 {
+			return nil, fmt.Errorf("GitHub项目%q应为owner/repo的形式", repo)
+		}
+		return &githubHost{repo: repo, api: &hostClient{base: strings.TrimSuffix(a.config.GitHubURL, "/"), header: "Authorization", token: a.config.githubToken(), client: client}}, nil
+	case "gitlab":
+		return &gitlabHost{repo: repo, api: &hostClient{base: gitlabBase + "/api/v4", header: "PRIVATE-TOKEN", token: a.config.gitlabToken(), client: client}}, nil
+	}
+	return nil, fmt.Errorf("不支持的平台: %s", provider)
+}
+
+// codeHostAction 根据action查看或操作GitHub和GitLab上的issue、PR和CI
+func (a *ECNUAgent) codeHostAction(ctx context.Context, args string) (string, error) {
+	params := hostParams{Limit: hostDefaultLimit, State: "open", Event: "COMMENT"}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	params.Limit = max(1, min(params.Limit, hostMaxLimit))
+	if params.State != "open" && params.State != "closed" && params.State != "all" {
+		return "", fmt.Errorf("state必须为open、closed或all")
+	}
+	switch params.Action {
+	case "get_issue", "comment", "get_pr", "pr_diff", "review":
+		if params.Number <= 0 {
+			return "", fmt.Errorf("%s需要number参数", params.Action)
+		}
+	case "create_issue":
+		if strings.TrimSpace(params.Title) == "" {
+			return "", fmt.Errorf("create_issue需要title参数")
+		}
+	case "list_issues", "list_prs", "ci_status":
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+	if params.Action == "comment" && strings.TrimSpace(params.Body) == "" {
+		return "", fmt.Errorf("comment需要body参数")
+	}
+	if params.Action == "review" {
+		if _, ok := hostReviewEvents[params.Event]; !ok {
+			return "", fmt.Errorf("event必须为COMMENT、APPROVE或REQUEST_CHANGES")
+		}
+		if strings.TrimSpace(params.Body) == "" && len(params.Comments) == 0 && params.Event != "APPROVE" {
+			return "", fmt.Errorf("review需要body或comments参数")
+		}
+		for _, c := range params.Comments {
+			if c.Path == "" || c.Line <= 0 || strings.TrimSpace(c.Body) == "" {
+				return "", fmt.Errorf("comments中的每一项都需要path、line和body")
+			}
+		}
+	}
+
+	host, err := a.openCodeHost(ctx, params)
+	if err != nil {
+		return fmt.Sprintf("访问代码托管平台失败: %v", err), nil
+	}
+	log.Printf("[代码托管] %s %s %d\n", host, params.Action, params.Number)
+	result, err := a.runHostAction(ctx, host, params)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return fmt.Sprintf("%s %s失败: %v", host, params.Action, err), nil
+	}
+	return result, nil
+}
+
+// runHostAction 执行一项操作并格式化结果
+func (a *ECNUAgent) runHostAction(ctx context.Context, host codeHost, params hostParams) (string, error) {
+	pr, ref := host.pullName(), host.pullRef(params.Number)
+	switch params.Action {
+	case "list_issues":
+		items, err := host.listIssues(ctx, params.State, params.Labels, params.Limit)
+		if err != nil {
+			return "", err
+		}
+		return formatHostItems(host, "issue", items, false), nil
+	case "list_prs":
+		items, err := host.listPulls(ctx, params.State, params.Limit)
+		if err != nil {
+			return "", err
+		}
+		return formatHostItems(host, pr, items, true), nil
+	case "get_issue":
+		item, comments, err := host.getIssue(ctx, params.Number)
+		if err != nil {
+			return "", err
+		}
+		return formatHostItem(fmt.Sprintf("issue #%d", item.number), item) + formatHostComments(comments), nil
+	case "get_pr":
+		item, files, comments, err := host.getPull(ctx, params.Number)
+		if err != nil {
+			return "", err
+		}
+		return formatHostItem(ref, item) + formatHostFiles(files) + formatHostComments(comments), nil
+	case "pr_diff":
+		diff, err := host.pullDiff(ctx, params.Number)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(diff) == "" {
+			return fmt.Sprintf("%s没有修改", ref), nil
+		}
+		added, deleted := diffLineCounts(diff)
+		return fmt.Sprintf("%s的diff（+%d -%d）:\n%s", ref, added, deleted, diff), nil
+	case "ci_status":
+		if params.Number == 0 && params.Ref == "" {
+			branch, err := gitRepo{root: a.workingDir}.run(ctx, "", "rev-parse", "--abbrev-ref", "HEAD")
+			if err != nil || branch == "HEAD" {
+				return "", fmt.Errorf("无法确定当前分支，请提供ref或number参数")
+			}
+			params.Ref = branch
+		}
+		name, checks, err := host.ciStatus(ctx, params.Number, params.Ref)
+		if err != nil {
+			return "", err
+		}
+		return formatHostChecks(name, checks), nil
+	}
+
+	// 以下操作会在平台上发布内容，需要用户确认
+	var what string
+	switch params.Action {
+	case "create_issue":
+		what = fmt.Sprintf("创建issue:\n  标题: %s\n", params.Title)
+		if len(params.Labels) > 0 {
+			what += fmt.Sprintf("  标签: %s\n", strings.Join(params.Labels, ", "))
+		}
+	case "comment":
+		what = fmt.Sprintf("在issue #%d下发表评论:\n", params.Number)
+		if params.Pull {
+			what = fmt.Sprintf("在%s下发表评论:\n", ref)
+		}
+	case "review":
+		what = fmt.Sprintf("对%s发表评审（%s，%d条行内评论）:\n", ref, hostReviewEvents[params.Event], len(params.Comments))
+		for _, c := range params.Comments {
+			what += fmt.Sprintf("  %s:%d %s\n", c.Path, c.Line, firstLine(c.Body))
+		}
+	}
+	prompt := fmt.Sprintf("\n即将在%s%s%s是否发布？(y/N) ", host, what, promptBody(params.Body))
+	ok, err := a.confirm(ctx, approveRemote, prompt)
+	if err != nil {
+		return fmt.Sprintf("发布失败: 需要用户确认: %v", err), nil
+	}
+	if !ok {
+		return "用户拒绝发布，没有在平台上留下任何内容。请询问用户原因，例如是否需要修改内容。", nil
+	}
+
+	switch params.Action {
+	case "create_issue":
+		item, err := host.createIssue(ctx, params.Title, params.Body, params.Labels)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("已创建issue #%d: %s\n%s\n", item.number, item.title, item.url), nil
+	case "comment":
+		link, err := host.comment(ctx, params.Number, params.Pull, params.Body)
+		if err != nil {
+			return "", err
+		}
+		target := fmt.Sprintf("issue #%d", params.Number)
+		if params.Pull {
+			target = ref
+		}
+		return fmt.Sprintf("已在%s下发表评论\n%s\n", target, link), nil
+	}
+	return host.review(ctx, params.Number, params.Event, params.Body, params.Comments)
+}
+
+// promptBody 返回确认中显示的正文，过长时只显示开头
+func promptBody(body string) string {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return ""
+	}
+	lines := strings.Split(body, "\n")
+	var b strings.Builder
+	b.WriteString("正文:\n")
+	for _, line := range lines[:min(len(lines), hostPromptLines)] {
+		b.WriteString("  " + line + "\n")
+	}
+	if len(lines) > hostPromptLines {
+		fmt.Fprintf(&b, "  ...其余%d行\n", len(lines)-hostPromptLines)
+	}
+	return b.String()
+}
+
+// escapeRef 转义分支名等放在URL路径中的值，保留其中的/
+func escapeRef(ref string) string {
+	parts := strings.Split(ref, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+// firstLine 返回文本的第一行
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// formatHostItems 以表格列出issue或PR
+func formatHostItems(host codeHost, kind string, items []hostItem, pulls bool) string {
+	if len(items) == 0 {
+		return fmt.Sprintf("%s中没有符合条件的%s", host, kind)
+	}
+	headers := []string{"#", "STATE", "TITLE", "AUTHOR", "LABELS", "UPDATED"}
+	if pulls {
+		headers[4] = "BRANCH"
+	}
+	rows := make([][]string, len(items))
+	for i, it := range items {
+		extra := strings.Join(it.labels, ",")
+		if pulls {
+			extra = it.source + " → " + it.target
+		}
+		state := it.state
+		if it.draft {
+			state += "(draft)"
+		}
+		rows[i] = []string{strconv.Itoa(it.number), state, it.title, it.author, extra, it.updated.Local().Format("2006-01-02 15:04")}
+	}
+	return fmt.Sprintf("%s的%s（%d个）:\n", host, kind, len(items)) + formatTableRows(headers, rows)
+}
+
+// formatHostItem 返回一个issue或PR的详细信息
+func formatHostItem(ref string, it hostItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", ref, it.title)
+	fmt.Fprintf(&b, "状态: %s", it.state)
+	if it.draft {
+		b.WriteString("（草稿）")
+	}
+	fmt.Fprintf(&b, "  作者: %s  更新: %s\n", it.author, it.updated.Local().Format("2006-01-02 15:04"))
+	if it.source != "" {
+		fmt.Fprintf(&b, "分支: %s → %s\n", it.source, it.target)
+	}
+	if it.merge != "" {
+		fmt.Fprintf(&b, "合并状态: %s\n", it.merge)
+	}
+	if len(it.labels) > 0 {
+		fmt.Fprintf(&b, "标签: %s\n", strings.Join(it.labels, ", "))
+	}
+	fmt.Fprintf(&b, "地址: %s\n", it.url)
+	if body := strings.TrimSpace(it.body); body != "" {
+		fmt.Fprintf(&b, "\n%s\n", body)
+	}
+	return b.String()
+}
+
+// formatHostFiles 以表格列出PR修改的文件
+func formatHostFiles(files []hostFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	rows := make([][]string, len(files))
+	added, deleted := 0, 0
+	for i, f := range files {
+		rows[i] = []string{f.path, f.status, strconv.Itoa(f.additions), strconv.Itoa(f.deletions)}
+		added, deleted = added+f.additions, deleted+f.deletions
+	}
+	return fmt.Sprintf("\n修改了%d个文件，+%d -%d:\n", len(files), added, deleted) + formatTableRows([]string{"FILE", "STATUS", "ADDED", "DELETED"}, rows)
+}
+
+// formatHostComments 按时间列出评论，过多时只保留最近的
+func formatHostComments(comments []hostComment) string {
+	if len(comments) == 0 {
+		return "\n没有评论\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n评论（%d条）:\n", len(comments))
+	if len(comments) > hostMaxComments {
+		fmt.Fprintf(&b, "（省略较早的%d条）\n", len(comments)-hostMaxComments)
+		comments = comments[len(comments)-hostMaxComments:]
+	}
+	for _, c := range comments {
+		fmt.Fprintf(&b, "--- %s %s", c.author, c.created.Local().Format("2006-01-02 15:04"))
+		if c.path != "" {
+			fmt.Fprintf(&b, " %s:%d", c.path, c.line)
+		}
+		fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(c.body))
+	}
+	return b.String()
+}
+
+// formatHostChecks 汇总CI检查的结果
+func formatHostChecks(name string, checks []hostCheck) string {
+	if len(checks) == 0 {
+		return fmt.Sprintf("%s没有CI检查或流水线", name)
+	}
+	counts := map[string]int{}
+	rows := make([][]string, len(checks))
+	for i, c := range checks {
+		counts[c.status]++
+		rows[i] = []string{c.name, c.status, c.url}
+	}
+	var parts []string
+	for _, s := range []string{"failure", "running", "pending", "success"} {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", s, counts[s]))
+		}
+	}
+	overall := "全部通过"
+	switch {
+	case counts["failure"] > 0:
+		overall = "有检查失败"
+	case counts["running"]+counts["pending"] > 0:
+		overall = "仍在运行"
+	case counts["success"] < len(checks):
+		overall = "没有失败，部分检查被跳过或取消"
+	}
+	return fmt.Sprintf("%s的CI: %s（%s）\n", name, overall, strings.Join(parts, ", ")) + formatTableRows([]string{"CHECK", "STATUS", "URL"}, rows)
+}
+
+// diffLineCounts 统计统一diff中增加和删除的行数
+func diffLineCounts(diff string) (int, int) {
+	added, deleted := 0, 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandResultReserve 分配输出预算时为结果头部保留的字节数
+const commandResultReserve = 512
+
+// commandResult 一次命令执行的结果
+type commandResult struct {
+	command  string
+	exitCode int
+	duration time.Duration
+	state    *os.ProcessState // 进程启动失败时为nil
+	dir      string           // 与工作目录不同时显示
+	dirNote  string           // 目录的说明，如仅本次调用
+	limits   string           // 生效的资源限制
+	sandbox  string           // 在沙箱中执行时的说明，此时进程状态属于沙箱的客户端
+	err      string           // 超时、中断、被信号结束等退出码无法表达的错误
+	stdout   []byte
+	stderr   []byte
+}
+
+// executeCommand 执行系统命令
+func (a *ECNUAgent) executeCommand(ctx context.Context, args string) (string, error) {
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+
+	command, ok := params["command"].(string)
+	if !ok {
+		return "", fmt.Errorf("缺少command参数")
+	}
+
+	timeout := 30
+	if t, ok := params["timeout"].(float64); ok {
+		timeout = int(t)
+	}
+
+	stdin, hasStdin := params["stdin"].(string)
+	if refusal := a.checkCommandPolicy(ctx, command); refusal != "" {
+		return refusal, nil
+	}
+	if reset, _ := params["reset"].(bool); reset {
+		a.shell.reset()
+	}
+
+	log.Printf("[执行命令] %s (超时: %d秒)\n", command, timeout)
+	a.activity.addCommand(command)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	// 输出超过上限时单独取消，与超时和用户中断区分
+	runCtx, kill := context.WithCancel(ctx)
+	defer kill()
+	guard := newOutputGuard(int64(a.config.CommandOutput)*1024*1024, kill)
+	prefix, limits := resourceLimits(a.config)
+
+	cwd, _ := params["cwd"].(string)
+	overrides, _ := params["env"].(map[string]interface{})
+	script, dir, env, statePath := prefix+command, a.workingDir, []string(nil), ""
+	switch {
+	case cwd != "" || len(overrides) > 0:
+		// 单次调用的覆盖不会保存到shell状态中
+		env = a.sandbox.environ()
+		if a.config.ShellSession {
+			dir, env = a.shell.current(a.workingDir)
+		}
+		var err error
+		if cwd != "" {
+			if dir, err = a.commandDir(cwd); err != nil {
+				return fmt.Sprintf("执行命令失败: %v", err), nil
+			}
+		}
+		if env, err = applyEnv(env, overrides); err != nil {
+			return "", err
+		}
+	case a.config.ShellSession:
+		var err error
+		if script, dir, env, statePath, err = a.shell.prepare(prefix+command, a.workingDir); err != nil {
+			return fmt.Sprintf("执行命令失败: %v", err), nil
+		}
+	}
+	if a.config.WorkspaceOnly {
+		if err := a.checkWorkspace(dir); err != nil {
+			// 之前的命令切换到了工作区之外，回到工作区
+			a.shell.reset()
+			if statePath != "" {
+				a.sandbox.takeState(statePath)
+			}
+			return fmt.Sprintf("拒绝执行: 当前目录%v，shell已恢复到工作区，请重新执行", err), nil
+		}
+		if err := a.checkCommandPaths(command, dir); err != nil {
+			if statePath != "" {
+				a.sandbox.takeState(statePath)
+			}
+			return fmt.Sprintf("拒绝执行: %v", err), nil
+		}
+	}
+	cmd, err := a.sandbox.command(runCtx, script, dir, env)
+	if err != nil {
+		if statePath != "" {
+			a.sandbox.takeState(statePath)
+		}
+		return fmt.Sprintf("执行命令失败: %v", err), nil
+	}
+	if hasStdin {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	result := commandResult{command: command, limits: limits, sandbox: a.sandbox.describe()}
+	start := time.Now()
+	if a.monitor != nil {
+		// 命令的状态行代替指示符显示已运行时间
+		a.spinner.end()
+		live := a.monitor.begin()
+		cmd.Stdout, cmd.Stderr = guard.wrap(&live.stdout), guard.wrap(&live.stderr)
+		err = cmd.Run()
+		result.stdout, result.stderr = live.end()
+	} else {
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = guard.wrap(&stdout), guard.wrap(&stderr)
+		err = cmd.Run()
+		result.stdout, result.stderr = stdout.Bytes(), stderr.Bytes()
+	}
+	result.duration = time.Since(start)
+	if host, ok := a.sandbox.(hostSandbox); ok {
+		result.stdout, result.stderr = host.shell.decode(result.stdout), host.shell.decode(result.stderr)
+	}
+	if statePath != "" {
+		a.shell.update(statePath)
+		if dir = a.shell.directory(); dir == "" {
+			dir = a.workingDir
+		}
+	}
+
+	result.exitCode = -1
+	if result.state = cmd.ProcessState; result.state != nil {
+		result.exitCode = result.state.ExitCode()
+	}
+	if cwd != "" {
+		result.dir, result.dirNote = dir, "仅本次调用"
+	} else if dir != a.workingDir {
+		result.dir = dir
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case guard.exceeded():
+		result.err = fmt.Sprintf("输出超过上限%dMB，命令已被终止，只保留了之前的输出", a.config.CommandOutput)
+	case err == nil:
+	case ctx.Err() == context.DeadlineExceeded:
+		result.err = fmt.Sprintf("命令执行超时（%d秒）", timeout)
+	case ctx.Err() == context.Canceled:
+		result.err = "命令已被用户中断"
+	case result.state != nil && limitExceeded(a.config, result.state) != "":
+		result.err = limitExceeded(a.config, result.state)
+	case errors.As(err, &exitErr) && result.exitCode >= 0:
+		// 非零退出码已经包含在结果中
+	default:
+		result.err = err.Error()
+	}
+
+	return a.formatCommandResult(result), nil
+}
+
+// formatCommandResult 以紧凑的结构返回命令结果，标准输出和标准错误分别放在<stdout>和<stderr>中，
+// 总大小超过工具输出上限时各自保留开头和结尾
+func (a *ECNUAgent) formatCommandResult(r commandResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", r.command)
+	fmt.Fprintf(&b, "exit_code: %d\n", r.exitCode)
+	fmt.Fprintf(&b, "duration: %s\n", r.duration.Round(time.Millisecond))
+	if r.sandbox != "" {
+		fmt.Fprintf(&b, "sandbox: %s\n", r.sandbox)
+	} else if r.state != nil {
+		// 包含命令启动的所有已结束子进程
+		user, sys := r.state.UserTime(), r.state.SystemTime()
+		fmt.Fprintf(&b, "cpu_time: %s (user %s, sys %s)\n", (user + sys).Round(time.Millisecond), user.Round(time.Millisecond), sys.Round(time.Millisecond))
+		if rss, ok := maxRSS(r.state); ok {
+			fmt.Fprintf(&b, "max_rss: %s\n", formatSize(rss))
+		}
+	}
+	if r.dir != "" {
+		if r.dirNote != "" {
+			fmt.Fprintf(&b, "cwd: %s（%s）\n", r.dir, r.dirNote)
+		} else {
+			fmt.Fprintf(&b, "cwd: %s\n", r.dir)
+		}
+	}
+	if r.limits != "" {
+		fmt.Fprintf(&b, "limits: %s\n", r.limits)
+	}
+	if r.err != "" {
+		fmt.Fprintf(&b, "error: %s\n", r.err)
+	}
+	if len(r.stdout) == 0 && len(r.stderr) == 0 {
+		b.WriteString("（没有输出）\n")
+		return b.String()
+	}
+
+	outBudget, errBudget := len(r.stdout), len(r.stderr)
+	if limit := a.config.ToolOutputLimit; limit > 0 {
+		outBudget, errBudget = splitOutputBudget(len(r.stdout), len(r.stderr), max(limit-b.Len()-commandResultReserve, limit/2))
+	}
+	a.writeCommandStream(&b, "stdout", r.stdout, outBudget)
+	a.writeCommandStream(&b, "stderr", r.stderr, errBudget)
+	return b.String()
+}
+
+// writeCommandStream 写出一路输出，超过budget字节时截断并保存完整内容
+func (a *ECNUAgent) writeCommandStream(b *strings.Builder, name string, data []byte, budget int) {
+	if len(data) == 0 {
+		return
+	}
+	text, id := a.truncateText(string(data), budget)
+	if id != "" {
+		fmt.Fprintf(b, "<%s truncated=\"true\">\n", name)
+	} else {
+		fmt.Fprintf(b, "<%s>\n", name)
+	}
+	b.WriteString(text)
+	if !strings.HasSuffix(text, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "</%s>\n", name)
+}
+
+// splitOutputBudget 在标准输出和标准错误之间分配大小预算，较短的一路尽量完整保留，其余留给另一路
+func splitOutputBudget(outLen, errLen, budget int) (int, int) {
+	if outLen+errLen <= budget {
+		return outLen, errLen
+	}
+	half := budget / 2
+	switch {
+	case errLen <= half:
+		return budget - errLen, errLen
+	case outLen <= half:
+		return outLen, budget - outLen
+	}
+	return half, budget - half
+}
+
+// outputGuard 统计命令的标准输出和标准错误的总量，超过上限时结束命令并丢弃之后的输出
+type outputGuard struct {
+	mu    sync.Mutex
+	limit int64 // 0表示不限制
+	n     int64
+	over  bool
+	kill  func()
+}
+
+// newOutputGuard 创建输出总量上限为limit字节的计数器，超出时调用kill
+func newOutputGuard(limit int64, kill func()) *outputGuard {
+	return &outputGuard{limit: limit, kill: kill}
+}
+
+// wrap 返回写入w并计入总量的Writer
+func (g *outputGuard) wrap(w io.Writer) io.Writer {
+	return &guardedWriter{g: g, w: w}
+}
+
+// exceeded 返回输出是否超过了上限
+func (g *outputGuard) exceeded() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.over
+}
+
+// guardedWriter 一路受outputGuard限制的输出
+type guardedWriter struct {
+	g *outputGuard
+	w io.Writer
+}
+
+// Write 写入上限以内的部分，超出的部分被丢弃但仍报告写入成功，避免命令在被结束前因写入错误改变行为
+func (gw *guardedWriter) Write(p []byte) (int, error) {
+	g := gw.g
+	if g.limit <= 0 {
+		return gw.w.Write(p)
+	}
+	g.mu.Lock()
+	keep := int64(len(p))
+	if g.over {
+		keep = 0
+	} else if g.n+keep > g.limit {
+		keep = g.limit - g.n
+		g.over = true
+		g.kill()
+	}
+	g.n += keep
+	g.mu.Unlock()
+	if keep > 0 {
+		if _, err := gw.w.Write(p[:keep]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// historyDefaultTurns /history默认显示的对话轮数
+const historyDefaultTurns = 5
+
+// sessionsDefaultCount /sessions默认显示的会话数
+const sessionsDefaultCount = 20
+
+// slashCommand 以'/'开头的交互命令
+type slashCommand struct {
+	name  string
+	usage string // 参数说明，显示在/help中
+	help  string
+	// run 执行命令，返回需要作为任务执行的输入，为空时不执行任务
+	run func(a *ECNUAgent, args []string) string
+}
+
+// slashCommands 全部交互命令，按/help中显示的顺序排列
+var slashCommands []slashCommand
+
+func init() {
+	// /help需要引用命令列表，因此在init中初始化
+	slashCommands = []slashCommand{
+		{name: "/help", help: "显示可用的命令", run: (*ECNUAgent).helpCommand},
+		{name: "/clear", help: "清空对话历史，开始新的对话", run: (*ECNUAgent).clearCommand},
+		{name: "/history", usage: "[轮数]", help: fmt.Sprintf("查看最近几轮对话，默认%d轮", historyDefaultTurns), run: (*ECNUAgent).historyCommand},
+		{name: "/sessions", usage: "[条数]", help: fmt.Sprintf("列出保存的会话，默认最近%d个", sessionsDefaultCount), run: (*ECNUAgent).sessionsCommand},
+		{name: "/delete-session", usage: "<会话ID>", help: "删除保存的会话", run: (*ECNUAgent).deleteSessionCommand},
+		{name: "/resume", usage: "<会话ID>", help: "切换到保存的会话，接着其中的对话继续", run: (*ECNUAgent).resumeCommand},
+		{name: "/search", usage: "<关键词...>", help: "在保存的会话中查找包含全部关键词的输入和回复", run: (*ECNUAgent).searchCommand},
+		{name: "/quote", usage: "<编号>", help: "把/search找到的消息引用到下一条输入中", run: (*ECNUAgent).quoteCommand},
+		{name: "/retry", help: "丢弃上一条请求产生的对话记录并重新执行", run: (*ECNUAgent).retryCommand},
+		{name: "/undo-turn", usage: "[轮数]", help: "从对话历史中删除最近几轮输入、工具调用和回复，默认1轮", run: (*ECNUAgent).undoTurnCommand},
+		{name: "/tools", help: "列出可用的工具及本次会话中的调用情况", run: (*ECNUAgent).toolsCommand},
+		{name: "/config", help: "查看当前生效的配置", run: func(a *ECNUAgent, args []string) string {
+			fmt.Println("当前配置:")
+			fmt.Print(a.config.describe())
+			return ""
+		}},
+		{name: "/model", usage: "[模型名]", help: "查看或切换模型", run: func(a *ECNUAgent, args []string) string {
+			if len(args) == 0 {
+				fmt.Printf("当前模型: %s\n", a.config.Model)
+				fmt.Println("用法: /model <模型名>，例如 /model ecnu-reasoner")
+				return ""
+			}
+			a.config.Model = args[0]
+			fmt.Printf("已切换模型: %s\n", a.config.Model)
+			return ""
+		}},
+		{name: "/models", help: "列出当前密钥可以访问的模型", run: func(a *ECNUAgent, args []string) string {
+			models, err := a.listModels(context.Background())
+			if err != nil {
+				fmt.Printf("获取模型列表失败: %v\n", err)
+				return ""
+			}
+			printModels(models, a.config.Model)
+			return ""
+		}},
+		{name: "/sampling", help: "查看当前的采样参数", run: func(a *ECNUAgent, args []string) string {
+			fmt.Println("当前采样参数:")
+			fmt.Print(a.config.describeSampling())
+			return ""
+		}},
+		{name: "/set", usage: "<参数> <值>", help: "修改采样参数", run: func(a *ECNUAgent, args []string) string {
+			if len(args) < 2 {
+				fmt.Println("用法: /set <参数> <值>，参数: temperature, top_p, max_tokens, frequency_penalty, presence_penalty, stop, seed")
+				return ""
+			}
+			value := strings.Join(args[1:], " ")
+			if err := a.config.setSampling(args[0], value); err != nil {
+				fmt.Printf("设置失败: %v\n", err)
+				return ""
+			}
+			fmt.Printf("已设置 %s = %s\n", args[0], value)
+			return ""
+		}},
+		{name: "/plan", usage: "[on|off]", help: "查看最近的计划，或开关先规划后执行模式", run: func(a *ECNUAgent, args []string) string {
+			if len(args) >= 1 && (args[0] == "on" || args[0] == "off") {
+				a.config.Plan = args[0] == "on"
+				fmt.Printf("先规划后执行: %v\n", a.config.Plan)
+				return ""
+			}
+			if a.plan == nil {
+				fmt.Println("暂无计划，使用 /plan on 开启先规划后执行模式")
+				return ""
+			}
+			fmt.Println("最近的计划:")
+			fmt.Print(a.plan.render())
+			return ""
+		}},
+		{name: "/keys", help: "查看各API密钥的状态", run: func(a *ECNUAgent, args []string) string {
+			fmt.Printf("%s 的API密钥:\n", a.backend)
+			fmt.Print(a.backend.keys.describe())
+			return ""
+		}},
+		{name: "/usage", help: "查看token用量", run: func(a *ECNUAgent, args []string) string {
+			fmt.Println("token用量:")
+			fmt.Print(a.usage.report())
+			return ""
+		}},
+		{name: "/undo", usage: "[task] [force] | list", help: "撤销文件修改", run: func(a *ECNUAgent, args []string) string {
+			a.undoCommand(args)
+			return ""
+		}},
+		{name: "/checkpoint", usage: "[描述] | list", help: "为工作区创建检查点", run: func(a *ECNUAgent, args []string) string {
+			a.checkpointCommand(args)
+			return ""
+		}},
+		{name: "/restore", usage: "<检查点ID>", help: "把工作区恢复到检查点", run: func(a *ECNUAgent, args []string) string {
+			a.restoreCommand(args)
+			return ""
+		}},
+		{name: "/attach", usage: "[图片路径...] | clear", help: "添加随下一条输入发送的图片", run: func(a *ECNUAgent, args []string) string {
+			a.attachCommand(args)
+			return ""
+		}},
+	}
+}
+
+// handleSlashCommand 处理以'/'开头的交互命令，返回需要作为任务执行的输入，ok为false表示不是已知命令
+func (a *ECNUAgent) handleSlashCommand(input string) (task string, ok bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return "", false
+	}
+	for _, cmd := range slashCommands {
+		if cmd.name == fields[0] {
+			return cmd.run(a, fields[1:]), true
+		}
+	}
+	return "", false
+}
+
+// helpCommand 处理/help命令
+func (a *ECNUAgent) helpCommand(args []string) string {
+	fmt.Println("可用命令:")
+	for _, cmd := range slashCommands {
+		fmt.Printf("  %s %s\n", padDisplay(strings.TrimSpace(cmd.name+" "+cmd.usage), 32), cmd.help)
+	}
+	fmt.Printf("  %s %s\n", padDisplay("/editor [初始内容]", 32), "在外部编辑器中编写输入")
+	fmt.Printf("  %s %s\n", padDisplay(`"""`, 32), `开始多行输入，以"""结尾的行结束`)
+	fmt.Printf("  %s %s\n", padDisplay("exit, quit", 32), "退出")
+	return ""
+}
+
+// clearCommand 处理/clear命令，只保留系统提示，待发送的图片和最近的计划一并清除
+func (a *ECNUAgent) clearCommand(args []string) string {
+	a.history = a.history[:1]
+	a.turnStarts = nil
+	a.attachments.take()
+	a.plan = nil
+	a.lastInput = ""
+	a.quote = ""
+	a.saveState()
+	fmt.Println("已清空对话历史")
+	return ""
+}
+
+// historyCommand 处理/history命令，显示最近几轮对话的用户输入、工具调用次数和回复
+func (a *ECNUAgent) historyCommand(args []string) string {
+	n := historyDefaultTurns
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			fmt.Println("用法: /history [轮数]")
+			return ""
+		}
+		n = v
+	}
+
+	turns := a.conversationTurns()
+	if len(turns) == 0 {
+		fmt.Println("暂无对话记录")
+		return ""
+	}
+	if len(turns) > n {
+		turns = turns[len(turns)-n:]
+	}
+	fmt.Printf("最近%d轮对话:\n", len(turns))
+	for i, turn := range turns {
+		fmt.Printf("[%d] 用户: %s\n", i+1, oneLine(messageText(turn[0]), 100))
+		calls, reply := 0, ""
+		for _, msg := range turn[1:] {
+			if msg.Role != openai.ChatMessageRoleAssistant {
+				continue
+			}
+			calls += len(msg.ToolCalls)
+			if msg.Content != "" {
+				reply = msg.Content
+			}
+		}
+		if calls > 0 {
+			fmt.Printf("    工具调用: %d次\n", calls)
+		}
+		if reply != "" {
+			fmt.Printf("    助手: %s\n", oneLine(reply, 200))
+		}
+	}
+	return ""
+}
+
+// conversationTurns 按用户的输入把对话历史分为轮次，每轮以用户输入开头，包括其后的工具调用、工具结果和回复
+//
+// 任务中途加入的观察结果、补充指示等用户消息属于所在的轮次；压缩生成的摘要等第一次输入之前的消息不属于任何轮次。
+func (a *ECNUAgent) conversationTurns() [][]openai.ChatCompletionMessage {
+	var turns [][]openai.ChatCompletionMessage
+	for i, start := range a.turnStarts {
+		end := len(a.history)
+		if i+1 < len(a.turnStarts) {
+			end = a.turnStarts[i+1]
+		}
+		if start < end {
+			turns = append(turns, a.history[start:end])
+		}
+	}
+	return turns
+}
+
+// oneLine 把文本合并为一行并按字符数截断，用于列表显示
+func oneLine(s string, limit int) string {
+	return truncateRunes(strings.Join(strings.Fields(s), " "), limit)
+}
+
+// retryCommand 处理/retry命令，删除上一条输入及之后的消息，随输入发送的图片重新排队
+//
+// 上一条输入已被压缩进摘要时保留现有历史，直接再次发送。已经执行的文件修改不会撤销，需要时先使用/undo task。
+func (a *ECNUAgent) retryCommand(args []string) string {
+	if a.lastInput == "" {
+		fmt.Println("没有可以重试的请求")
+		return ""
+	}
+	for i := len(a.history) - 1; i > 0; i-- {
+		msg := a.history[i]
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if msg.Content == a.lastInput {
+			a.history = a.history[:i]
+			break
+		}
+		if len(msg.MultiContent) > 0 && msg.MultiContent[0].Text == a.lastInput {
+			for _, part := range msg.MultiContent[1:] {
+				a.attachments.add("上次输入中的图片", part)
+			}
+			a.history = a.history[:i]
+			break
+		}
+	}
+	fmt.Printf("重新执行: %s\n", oneLine(a.lastInput, 100))
+	return a.lastInput
+}
+
+// undoTurnCommand 处理/undo-turn命令，删除最近几轮对话，每轮包括用户输入及之后的工具调用、工具结果和回复
+//
+// 只修改对话历史，已经执行的文件修改不会撤销，需要时使用/undo task。压缩生成的摘要不会被删除。
+func (a *ECNUAgent) undoTurnCommand(args []string) string {
+	n := 1
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			fmt.Println("用法: /undo-turn [轮数]")
+			return ""
+		}
+		n = v
+	}
+
+	turns := a.conversationTurns()
+	if len(turns) == 0 {
+		fmt.Println("没有可以删除的对话")
+		return ""
+	}
+	n = min(n, len(turns))
+	removed := turns[len(turns)-n:]
+	a.history = a.history[:len(a.history)-countMessages(removed)]
+	a.dropTurnsFrom(len(a.history))
+	a.lastInput = ""
+	a.saveState()
+
+	fmt.Printf("已删除最近%d轮对话:\n", n)
+	calls := 0
+	for _, turn := range removed {
+		fmt.Printf("  用户: %s\n", oneLine(messageText(turn[0]), 100))
+		for _, msg := range turn {
+			calls += len(msg.ToolCalls)
+		}
+	}
+	if calls > 0 {
+		fmt.Println("这些对话中工具所做的修改不会撤销，需要时使用 /undo task")
+	}
+	return ""
+}
+
+// countMessages 返回各轮对话的消息总数
+func countMessages(turns [][]openai.ChatCompletionMessage) int {
+	count := 0
+	for _, turn := range turns {
+		count += len(turn)
+	}
+	return count
+}
+
+// toolsCommand 处理/tools命令，列出工具的状态和本次会话中的调用次数
+func (a *ECNUAgent) toolsCommand(args []string) string {
+	fmt.Printf("可用工具 (%d个):\n", len(a.tools))
+	for _, tool := range a.tools {
+		status := "可用"
+		if tool.Name == viewImageTool.Name && !a.supportsVision() {
+			status = "当前模型不支持图片"
+		}
+		line := fmt.Sprintf("  %-22s %s", tool.Name, status)
+		if stat, ok := a.toolStats.get(tool.Name); ok {
+			line += fmt.Sprintf("  调用%d次", stat.calls)
+			if stat.failures > 0 {
+				line += fmt.Sprintf("，失败%d次（最近: %s）", stat.failures, oneLine(stat.lastError, 60))
+			}
+		}
+		fmt.Println(line)
+	}
+	return ""
+}
+
+// sessionsCommand 处理/sessions命令，列出保存的会话，当前会话标有*
+func (a *ECNUAgent) sessionsCommand(args []string) string {
+	n := sessionsDefaultCount
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			fmt.Println("用法: /sessions [条数]")
+			return ""
+		}
+		n = v
+	}
+	dir := a.config.sessionDir()
+	sessions, err := listSessions(dir)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	if len(sessions) == 0 {
+		fmt.Printf("%s中没有保存的会话\n", dir)
+		return ""
+	}
+
+	fmt.Printf("保存的会话 (%s，共%d个):\n", dir, len(sessions))
+	rows := make([][]string, 0, min(n, len(sessions)))
+	for _, info := range sessions[:min(n, len(sessions))] {
+		id := info.ID
+		if a.session != nil && id == a.session.id {
+			id += " *"
+		}
+		title := info.Title
+		if info.Running {
+			title = "[未完成] " + title
+		}
+		rows = append(rows, []string{id, info.Updated.Format("2006-01-02 15:04"), strconv.Itoa(info.Messages), info.WorkingDir, title})
+	}
+	fmt.Print(formatTableRows([]string{"ID", "UPDATED", "MESSAGES", "DIR", "TITLE"}, rows))
+	fmt.Println("启动时使用 --session <ID> 或 --resume <ID> 恢复会话")
+	return ""
+}
+
+// deleteSessionCommand 处理/delete-session命令，删除保存的会话，不能删除当前会话
+func (a *ECNUAgent) deleteSessionCommand(args []string) string {
+	if len(args) != 1 {
+		fmt.Println("用法: /delete-session <会话ID>")
+		return ""
+	}
+	id := strings.TrimSuffix(args[0], ".json")
+	if !sessionNamePattern.MatchString(id) {
+		fmt.Printf("无效的会话ID: %s\n", id)
+		return ""
+	}
+	if a.session != nil && id == a.session.id {
+		fmt.Println("不能删除当前会话，如需清空对话请使用 /clear")
+		return ""
+	}
+	dir := a.config.sessionDir()
+	if err := os.Remove(filepath.Join(dir, id+".json")); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("会话 %s 不存在，使用 /sessions 查看保存的会话\n", id)
+		} else {
+			fmt.Printf("删除会话失败: %v\n", err)
+		}
+		return ""
+	}
+	fmt.Printf("已删除会话 %s\n", id)
+	return ""
+}
+
+// resumeCommand 处理/resume命令，把当前对话换成保存的会话，当前会话已保存，之后仍可切换回来
+//
+// 工作目录随会话切换，shell恢复到初始状态；不能切换工作目录时（见checkSwitchDir）不切换会话。
+func (a *ECNUAgent) resumeCommand(args []string) string {
+	if len(args) != 1 {
+		fmt.Println("用法: /resume <会话ID>，使用 /sessions 或 /search 查找会话")
+		return ""
+	}
+	id := strings.TrimSuffix(args[0], ".json")
+	if a.session != nil && id == a.session.id {
+		fmt.Println("已经在该会话中")
+		return ""
+	}
+	state, path, err := loadSessionState(a.config.sessionDir(), id, "")
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	if state.WorkingDir != "" {
+		if err := a.checkSwitchDir(state.WorkingDir); err != nil {
+			fmt.Printf("%v，请在该目录中使用 --resume %s 启动\n", err, state.ID)
+			return ""
+		}
+	}
+	a.saveState()
+	a.restoreSession(state, path)
+	a.shell.reset()
+	a.attachments.take()
+	a.plan = nil
+	a.lastInput = ""
+	a.quote = ""
+	fmt.Printf("已切换到会话 %s，工作目录 %s\n", state.ID, a.workingDir)
+	return ""
+}
+
+// searchCommand 处理/search命令，在保存的会话中查找，结果可以用/quote引用
+func (a *ECNUAgent) searchCommand(args []string) string {
+	if len(args) == 0 {
+		fmt.Println("用法: /search <关键词...>")
+		return ""
+	}
+	query := strings.Join(args, " ")
+	matches, err := searchSessions(a.config.sessionDir(), query, searchDefaultLimit)
+	if err != nil {
+		fmt.Println(err)
+		return ""
+	}
+	a.searchResults = matches
+	if len(matches) == 0 {
+		fmt.Printf("没有找到包含\"%s\"的对话\n", query)
+		return ""
+	}
+	printSessionMatches(matches)
+	fmt.Println("\n使用 /quote <编号> 把消息引用到下一条输入中，/resume <会话ID> 切换到该会话")
+	return ""
+}
+
+// quoteCommand 处理/quote命令，把/search找到的一条消息作为引用加在下一条输入前面
+func (a *ECNUAgent) quoteCommand(args []string) string {
+	n := 0
+	if len(args) == 1 {
+		n, _ = strconv.Atoi(args[0])
+	}
+	if n < 1 || n > len(a.searchResults) {
+		if len(a.searchResults) == 0 {
+			fmt.Println("请先使用 /search 查找要引用的消息")
+		} else {
+			fmt.Printf("用法: /quote <编号>，编号应在1~%d之间\n", len(a.searchResults))
+		}
+		return ""
+	}
+	m := a.searchResults[n-1]
+	var b strings.Builder
+	fmt.Fprintf(&b, "以下内容引用自之前的会话 %s（%s）中%s的消息：\n", m.session.ID, m.session.Updated.Format("2006-01-02 15:04"), m.label())
+	for _, line := range strings.Split(strings.TrimSpace(m.text), "\n") {
+		b.WriteString("> " + line + "\n")
+	}
+	if a.quote != "" {
+		a.quote += "\n"
+	}
+	a.quote += b.String()
+	fmt.Printf("已引用 [%d] %s，将随下一条输入发送\n", n, oneLine(m.text, 60))
+	return ""
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	compactTriggerRatio = 0.8  // 历史达到预算的该比例时触发压缩
+	compactKeepRatio    = 0.4  // 压缩后保留的最近消息最多占预算的比例
+	compactToolChars    = 2000 // 摘要输入中每条工具结果保留的最大字符数
+	summaryPrefix       = "【此前对话摘要】"
+)
+
+const summarizerPrompt = `你负责压缩一个命令行智能代理的对话历史。请将给出的对话记录总结为一份简洁的中文摘要，供代理继续工作时参考。
+
+摘要需要保留：
+1. 用户提出的目标和要求，以及仍未完成的事项；
+2. 已经执行过的关键操作（命令、读写的文件路径）及其结果；
+3. 发现的重要事实、配置、错误信息和得出的结论。
+
+不要编造记录中没有的内容，不要输出与摘要无关的解释。`
+
+// compactHistory 在历史接近token预算时，将较早的对话轮次总结为一条摘要消息
+func (a *ECNUAgent) compactHistory(ctx context.Context) {
+	budget := a.config.HistoryTokens
+	if !a.config.Compact || budget <= 0 || len(a.history) <= 1 {
+		return
+	}
+
+	total := estimateHistoryTokens(a.history)
+	if float64(total) < float64(budget)*compactTriggerRatio {
+		return
+	}
+	a.summarizeOlder(ctx, budget)
+}
+
+// summarizeOlder 保留最近的消息组直至达到预算的保留比例，将更早的消息总结为一条摘要
+func (a *ECNUAgent) summarizeOlder(ctx context.Context, budget int) {
+	total := estimateHistoryTokens(a.history)
+
+	// 从最近的消息组往前保留，直至达到保留比例
+	groups := groupMessages(a.history[1:])
+	keepBudget := int(float64(budget) * compactKeepRatio)
+	keep := 0
+	kept := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		size := 0
+		for _, msg := range groups[i] {
+			size += estimateMessageTokens(msg)
+		}
+		if keep > 0 && kept+size > keepBudget {
+			break
+		}
+		kept += size
+		keep++
+	}
+	if keep >= len(groups) {
+		return
+	}
+
+	var older []openai.ChatCompletionMessage
+	for _, group := range groups[:len(groups)-keep] {
+		older = append(older, group...)
+	}
+
+	log.Printf("[压缩] 历史约 %d tokens，正在总结较早的 %d 条消息...\n", total, len(older))
+	summary, err := a.summarizeMessages(ctx, older)
+	if err != nil {
+		log.Printf("[压缩] 生成摘要失败，将直接截断历史: %v\n", err)
+		return
+	}
+
+	newHistory := []openai.ChatCompletionMessage{
+		a.history[0],
+		{
+			Role:    openai.ChatMessageRoleUser,
+			Content: summaryPrefix + "\n" + summary,
+		},
+	}
+	for _, group := range groups[len(groups)-keep:] {
+		newHistory = append(newHistory, group...)
+	}
+	a.history = newHistory
+	a.shiftTurns(len(older), 1)
+	log.Printf("[压缩] 完成，历史减少至约 %d tokens\n", estimateHistoryTokens(a.history))
+}
+
+// summarizeMessages 调用模型将一段消息总结为摘要文本
+func (a *ECNUAgent) summarizeMessages(ctx context.Context, messages []openai.ChatCompletionMessage) (string, error) {
+	req := openai.ChatCompletionRequest{
+		Model: a.backend.provider.resolveModel(a.summaryModel()),
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: summarizerPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: renderTranscript(messages)},
+		},
+		Temperature: math.SmallestNonzeroFloat32,
+	}
+
+	record, err := a.throttle(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.backend.client.CreateChatCompletion(ctx, req)
+	record(resp.Usage)
+	a.recorder.recordCompletion(a.backend.String(), req, resp, err)
+	if err != nil {
+		return "", err
+	}
+	a.usage.record(req.Model, req, resp)
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("模型返回空摘要")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// summaryModel 返回生成摘要使用的模型：优先使用配置，其次是服务商的廉价模型，最后是对话模型
+func (a *ECNUAgent) summaryModel() string {
+	if a.config.CompactModel != "" && a.backendIdx == 0 {
+		return a.config.CompactModel
+	}
+	if a.backend.provider.SummaryModel != "" {
+		return a.backend.provider.SummaryModel
+	}
+	if a.backend.model != "" {
+		return a.backend.model
+	}
+	return a.config.Model
+}
+
+// renderTranscript 将消息渲染为便于总结的纯文本记录
+func renderTranscript(messages []openai.ChatCompletionMessage) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case openai.ChatMessageRoleUser:
+			fmt.Fprintf(&b, "[用户] %s\n", messageText(msg))
+		case openai.ChatMessageRoleAssistant:
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "[助手] %s\n", msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				fmt.Fprintf(&b, "[工具调用] %s %s\n", call.Function.Name, call.Function.Arguments)
+			}
+		case openai.ChatMessageRoleTool:
+			fmt.Fprintf(&b, "[工具结果] %s\n", truncateRunes(msg.Content, compactToolChars))
+		default:
+			fmt.Fprintf(&b, "[%s] %s\n", msg.Role, msg.Content)
+		}
+	}
+	return b.String()
+}
+
+// truncateRunes 按字符数截断文本，超出部分以省略标记代替
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + fmt.Sprintf("...(省略%d字)", len(runes)-limit)
+}
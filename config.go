@@ -0,0 +1,793 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Config Agent运行配置
+type Config struct {
+	Provider          string   // 模型服务商名称
+	ProvidersFile     string   // 自定义服务商配置文件
+	BaseURL           string   // 覆盖服务商的API地址
+	KeysFile          string   // 额外的API密钥文件，每行一个密钥
+	Fallbacks         []string // 主端点失败时依次切换的备用端点，格式为"服务商[:模型]"
+	Model             string   // 对话使用的模型
+	MaxSteps          int      // 单次任务的最大步骤数
+	MaxHistory        int      // 保留的最大历史消息数，0表示不限制
+	HistoryTokens     int      // 历史记录的token预算，0表示不限制
+	ContextWindow     int      // 模型的上下文窗口大小，0表示自动识别
+	MaxRetries        int      // API调用失败时的最大尝试次数
+	LoopThreshold     int      // 连续相同工具调用达到该次数时视为循环，0表示不检测
+	ToolMode          string   // 工具调用方式：native或react
+	ToolWorkers       int      // 并发执行工具调用的最大数量
+	ToolTimeout       int      // 单个工具调用的时间上限（秒），0表示不限制
+	ToolOutputLimit   int      // 单个工具输出的最大字节数，超出时保留开头和结尾，0表示不限制
+	ReadLimit         int      // read_file单次返回的最大字节数，超出时分页读取，0表示不限制
+	RequestsPerMinute int      // 客户端每分钟最大请求数，0表示不限制
+	TokensPerMinute   int      // 客户端每分钟最大token数，0表示不限制
+	PriceFile         string   // 模型价格表文件，用于估算费用
+	RecordFile        string   // 运行记录文件，记录每次请求和响应
+	Workspace         string   // 工作区目录，默认为启动时的当前目录
+	AllowOutside      bool     // 是否允许移动、复制、删除工作区之外的文件
+	WorkspaceOnly     bool     // 是否拒绝所有访问工作区之外路径的工具调用和命令
+	DryRun            bool     // 是否只记录工具调用而不实际执行有副作用的操作
+	AutoApprove       []string // 不询问用户直接通过的操作范围，all表示全部，-范围表示排除
+	Vision            bool     // 是否视为当前模型支持图片输入
+	Sandbox           string   // execute_command的执行环境：none、docker或bwrap
+	SandboxImage      string   // docker沙箱使用的镜像
+	SandboxNetwork    bool     // 沙箱中的命令是否可以访问网络
+	SandboxArgs       []string // 启动docker沙箱容器时的额外参数
+	Shell             string   // 本机执行命令使用的解释器：auto、sh、powershell或cmd
+	K8sContext        string   // kubeconfig中使用的上下文，为空时使用当前上下文
+	K8sNamespace      string   // Pod所在的命名空间，为空时使用上下文的默认命名空间
+	K8sPod            string   // 设置后命令和文件操作都在该Pod中执行
+	K8sContainer      string   // Pod中的容器，为空时使用默认容器
+	PolicyFile        string   // 命令策略配置文件
+	CommandAllow      []string // 直接执行的命令前缀，/.../表示正则表达式
+	CommandDeny       []string // 拒绝执行的命令前缀，/.../表示正则表达式
+	CommandDefault    string   // 未匹配任何规则的命令的处理方式：allow、ask或deny，为空时使用策略文件中的设置
+	CommandCPU        int      // execute_command中每个进程的CPU时间上限（秒），0表示不限制
+	CommandMemory     int      // execute_command中每个进程的虚拟内存上限（MB），0表示不限制
+	CommandFileSize   int      // execute_command写入的单个文件的大小上限（MB），0表示不限制
+	CommandOutput     int      // execute_command捕获的输出总量上限（MB），超出时终止命令，0表示不限制
+	DownloadMaxSize   int      // download_file单个文件的大小上限（MB），0表示不限制
+	DownloadAllow     []string // download_file允许访问的域名，为空时不限制
+	GitHubToken       string   // 访问GitHub API的令牌，为空时使用环境变量GITHUB_TOKEN或GH_TOKEN
+	GitHubURL         string   // GitHub API的地址，GitHub Enterprise为https://主机/api/v3
+	GitLabToken       string   // 访问GitLab API的令牌，为空时使用环境变量GITLAB_TOKEN
+	GitLabURL         string   // GitLab实例的地址
+	Persist           bool     // 是否将会话状态保存到磁盘
+	ToolCache         bool     // 是否在本轮任务内缓存只读工具的结果
+	ShellSession      bool     // 是否在execute_command之间保留当前目录和环境变量
+	LiveOutput        bool     // 是否在终端上实时显示命令的输出
+	LineEditing       bool     // 交互式终端上是否启用行编辑和输入历史
+	HistoryFile       string   // 输入历史文件，为空时不保存
+	TUI               bool     // 是否以全屏界面运行，分开显示对话、工具日志和状态栏
+	Notify            string   // 任务结束或等待确认时的提醒方式：off、bell、osc、desktop或auto
+	NotifyAfter       int      // 任务运行超过该秒数才提醒
+	Backup            bool     // 覆盖文件前是否备份原内容到~/.ecnu-agent/backups
+	StateDir          string   // 会话状态目录，默认~/.ecnu-agent/sessions
+	Resume            string   // 启动时恢复的会话ID，last表示最近的会话
+	Continue          bool     // 启动时恢复在当前工作目录中最近进行的会话
+	Session           string   // 会话名称，该会话已保存时恢复，否则以该名称开始新会话
+	Prompt            string   // 单次运行的任务，设置后执行完即退出，不进入交互式循环
+	Output            string   // 单次运行的输出格式：text、json或jsonl
+	MaxTaskTokens     int      // 单次任务的token上限，0表示不限制
+	MaxTaskCost       float64  // 单次任务的费用上限，0表示不限制，需要配合价格表使用
+	MaxTaskTime       int      // 单次任务的耗时上限（秒），0表示不限制
+	Plan              bool     // 是否先制定计划再逐步执行
+	Verify            bool     // 任务完成后是否追加一轮验证
+	JSONMode          bool     // 要求最终回答为JSON对象并只输出JSON
+	JSONSchema        string   // 约束最终回答的JSON Schema文件，设置后自动开启JSON模式
+	Stream            bool     // 是否流式输出助手回复
+	Plain             bool     // 是否按原文输出助手回复，不渲染Markdown
+	Verbose           bool     // 是否在标准错误上显示工具参数、结果预览等详细诊断信息
+	Quiet             bool     // 是否只在标准错误上显示错误和警告
+	Compact           bool     // 历史接近预算时是否总结较早的对话
+	CompactModel      string   // 生成摘要使用的模型
+
+	// 采样参数
+	Temperature      float64  // 采样温度
+	TopP             float64  // 核采样概率，0表示使用服务端默认值
+	MaxTokens        int      // 单次回复的最大token数，0表示不限制
+	FrequencyPenalty float64  // 频率惩罚
+	PresencePenalty  float64  // 存在惩罚
+	Stop             []string // 停止序列
+	Seed             int      // 随机种子，0表示不设置
+}
+
+// defaultConfig 返回默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Provider:        "ecnu",
+		MaxSteps:        20,
+		MaxHistory:      0,
+		HistoryTokens:   24000,
+		LoopThreshold:   3,
+		ToolMode:        toolModeNative,
+		ToolWorkers:     4,
+		ToolTimeout:     300,
+		ToolOutputLimit: 16000,
+		ReadLimit:       12000,
+		Sandbox:         sandboxNone,
+		SandboxImage:    "ubuntu:24.04",
+		SandboxNetwork:  true,
+		Shell:           shellAuto,
+		CommandOutput:   64,
+		DownloadMaxSize: 500,
+		GitHubURL:       "https://api.github.com",
+		GitLabURL:       "https://gitlab.com",
+		MaxRetries:      3,
+		Stream:          true,
+		Persist:         true,
+		ToolCache:       true,
+		ShellSession:    true,
+		LiveOutput:      true,
+		LineEditing:     true,
+		HistoryFile:     defaultHistoryPath(),
+		Notify:          notifyOff,
+		NotifyAfter:     30,
+		Backup:          true,
+		Compact:         true,
+		Output:          outputText,
+		Temperature:     0.2, // 较低的温度使输出更确定、一致
+	}
+}
+
+// loadConfig 按 默认值 < 环境变量 < 命令行参数 的优先级加载配置
+func loadConfig(args []string) (*Config, error) {
+	cfg := defaultConfig()
+
+	fs := flag.NewFlagSet("chatecnu-agent", flag.ContinueOnError)
+	b := &configBinder{fs: fs}
+	b.stringVar(&cfg.Provider, "provider", "ECNU_AGENT_PROVIDER", "模型服务商：ecnu、openai、deepseek、ollama或自定义名称")
+	b.stringVar(&cfg.ProvidersFile, "providers-file", "ECNU_AGENT_PROVIDERS_FILE", "自定义服务商配置文件，默认~/.ecnu-agent/providers.json")
+	b.stringVar(&cfg.BaseURL, "base-url", "ECNU_AGENT_BASE_URL", "覆盖服务商的API地址")
+	b.stringVar(&cfg.KeysFile, "keys-file", "ECNU_AGENT_KEYS_FILE", "API密钥文件，每行一个密钥，与环境变量中的密钥合并轮换使用")
+	b.listVar(&cfg.Fallbacks, "fallback", "ECNU_AGENT_FALLBACK", "主端点失败时使用的备用端点，格式为服务商[:模型]，多个以逗号分隔")
+	b.stringVar(&cfg.Model, "model", "ECNU_MODEL", "对话使用的模型，默认为服务商的推荐模型")
+	b.intVar(&cfg.MaxSteps, "max-steps", "ECNU_AGENT_MAX_STEPS", "单次任务的最大步骤数")
+	b.intVar(&cfg.MaxHistory, "max-history", "ECNU_AGENT_MAX_HISTORY", "保留的最大历史消息数，0表示不限制")
+	b.intVar(&cfg.HistoryTokens, "history-tokens", "ECNU_AGENT_HISTORY_TOKENS", "历史记录的token预算，0表示不限制")
+	b.intVar(&cfg.ContextWindow, "context-window", "ECNU_AGENT_CONTEXT_WINDOW", "模型的上下文窗口大小（tokens），用于发送前检查请求长度，0表示自动识别")
+	b.intVar(&cfg.MaxRetries, "max-retries", "ECNU_AGENT_MAX_RETRIES", "API调用的最大尝试次数")
+	b.intVar(&cfg.LoopThreshold, "loop-threshold", "ECNU_AGENT_LOOP_THRESHOLD", "连续相同工具调用达到该次数时提醒模型更换策略，0表示不检测")
+	b.stringVar(&cfg.ToolMode, "tool-mode", "ECNU_AGENT_TOOL_MODE", "工具调用方式：native使用原生工具接口，react在提示词中描述工具，适用于不支持工具调用的模型")
+	b.intVar(&cfg.ToolWorkers, "tool-workers", "ECNU_AGENT_TOOL_WORKERS", "并发执行工具调用的最大数量")
+	b.intVar(&cfg.ToolTimeout, "tool-timeout", "ECNU_AGENT_TOOL_TIMEOUT", "单个工具调用的时间上限（秒），0表示不限制")
+	b.intVar(&cfg.ToolOutputLimit, "tool-output-limit", "ECNU_AGENT_TOOL_OUTPUT_LIMIT", "单个工具输出的最大字节数，超出时保留开头和结尾并可按需读取省略部分，0表示不限制")
+	b.intVar(&cfg.ReadLimit, "read-limit", "ECNU_AGENT_READ_LIMIT", "read_file单次返回的最大字节数，超出时返回文件信息和第一部分内容并提示分页读取，0表示不限制")
+	b.intVar(&cfg.RequestsPerMinute, "rpm", "ECNU_AGENT_RPM", "每分钟最大请求数，0表示不限制")
+	b.intVar(&cfg.TokensPerMinute, "tpm", "ECNU_AGENT_TPM", "每分钟最大token数，0表示不限制")
+	b.stringVar(&cfg.PriceFile, "price-file", "ECNU_AGENT_PRICE_FILE", "模型价格表文件（JSON，单位为每百万token），用于估算费用")
+	b.intVar(&cfg.MaxTaskTokens, "max-task-tokens", "ECNU_AGENT_MAX_TASK_TOKENS", "单次任务的token上限，超出后总结进展并询问是否继续，0表示不限制")
+	b.floatVar(&cfg.MaxTaskCost, "max-task-cost", "ECNU_AGENT_MAX_TASK_COST", "单次任务的费用上限（按价格表估算），0表示不限制")
+	b.intVar(&cfg.MaxTaskTime, "max-task-time", "ECNU_AGENT_MAX_TASK_TIME", "单次任务的耗时上限（秒），0表示不限制")
+	b.boolVar(&cfg.Plan, "plan", "ECNU_AGENT_PLAN", "先制定编号计划并展示，再逐步执行")
+	b.boolVar(&cfg.Verify, "verify", "ECNU_AGENT_VERIFY", "任务完成后让模型重新检查修改的文件或运行检查命令，确认任务确实完成")
+	b.boolVar(&cfg.JSONMode, "json", "ECNU_AGENT_JSON", "JSON模式：最终回答为JSON对象，标准输出只打印JSON")
+	b.stringVar(&cfg.JSONSchema, "json-schema", "ECNU_AGENT_JSON_SCHEMA", "约束最终回答的JSON Schema文件，设置后自动开启JSON模式")
+	b.negatedBoolVar(&cfg.Stream, "no-stream", "ECNU_AGENT_STREAM", "关闭流式输出")
+	b.boolVar(&cfg.Plain, "plain", "ECNU_AGENT_PLAIN", "按原文输出助手回复，不在终端上渲染Markdown；输出不是终端或设置了NO_COLOR时总是按原文输出")
+	b.boolVar(&cfg.Verbose, "verbose", "ECNU_AGENT_VERBOSE", "在标准错误上另外显示工具参数、工具结果的开头几行和缓存、上下文等内部细节")
+	b.boolVar(&cfg.Quiet, "quiet", "ECNU_AGENT_QUIET", "标准错误上只显示错误和警告，不显示步骤、工具调用和命令的实时输出")
+	b.negatedBoolVar(&cfg.Compact, "no-compact", "ECNU_AGENT_COMPACT", "关闭历史摘要压缩")
+	b.stringVar(&cfg.CompactModel, "compact-model", "ECNU_AGENT_COMPACT_MODEL", "生成历史摘要使用的模型，默认为服务商的廉价模型")
+	b.floatVar(&cfg.Temperature, "temperature", "ECNU_AGENT_TEMPERATURE", "采样温度，取值0~2")
+	b.floatVar(&cfg.TopP, "top-p", "ECNU_AGENT_TOP_P", "核采样概率，取值0~1，0表示使用服务端默认值")
+	b.intVar(&cfg.MaxTokens, "max-tokens", "ECNU_AGENT_MAX_TOKENS", "单次回复的最大token数，0表示不限制")
+	b.floatVar(&cfg.FrequencyPenalty, "frequency-penalty", "ECNU_AGENT_FREQUENCY_PENALTY", "频率惩罚，取值-2~2")
+	b.floatVar(&cfg.PresencePenalty, "presence-penalty", "ECNU_AGENT_PRESENCE_PENALTY", "存在惩罚，取值-2~2")
+	b.listVar(&cfg.Stop, "stop", "ECNU_AGENT_STOP", "停止序列，多个以逗号分隔")
+	b.stringVar(&cfg.Workspace, "workspace", "ECNU_AGENT_WORKSPACE", "工作区目录，Agent在该目录下工作，默认为当前目录")
+	b.boolVar(&cfg.AllowOutside, "allow-outside-workspace", "ECNU_AGENT_ALLOW_OUTSIDE_WORKSPACE", "允许移动、复制、删除工作区之外的文件")
+	b.boolVar(&cfg.WorkspaceOnly, "workspace-only", "ECNU_AGENT_WORKSPACE_ONLY", "只允许访问工作区内的文件，拒绝读写、列出工作区之外的路径以及参数中含有这些路径的命令")
+	b.boolVar(&cfg.DryRun, "dry-run", "ECNU_AGENT_DRY_RUN", "演练模式：命令和修改文件等操作只记录、不执行，向模型返回模拟的结果，任务结束时列出将会执行的操作；只读工具照常执行")
+	b.approveVar(&cfg.AutoApprove, "auto-approve", "ECNU_AGENT_AUTO_APPROVE", "不询问直接通过需要确认的操作，不带值时为全部，也可以指定范围如--auto-approve=safe,write：safe未匹配规则的命令，dangerous危险命令，write覆盖文件，delete删除文件，remote上传和信任主机；all,-dangerous表示排除，非交互模式下需要开启才能执行这些操作")
+	b.boolVar(&cfg.Vision, "vision", "ECNU_AGENT_VISION", "当前模型支持图片输入，允许使用view_image和/attach（未在服务商配置中声明时使用）")
+	b.stringVar(&cfg.Sandbox, "sandbox", "ECNU_AGENT_SANDBOX", "execute_command的执行环境：none直接在本机执行，docker在容器中执行，工作区挂载到容器中的相同路径，bwrap用bubblewrap或用户命名空间隔离，只有工作区可写")
+	b.stringVar(&cfg.SandboxImage, "sandbox-image", "ECNU_AGENT_SANDBOX_IMAGE", "docker沙箱使用的镜像")
+	b.negatedBoolVar(&cfg.SandboxNetwork, "no-sandbox-network", "ECNU_AGENT_SANDBOX_NETWORK", "禁止沙箱中的命令访问网络")
+	b.listVar(&cfg.SandboxArgs, "sandbox-args", "ECNU_AGENT_SANDBOX_ARGS", "启动docker沙箱容器时的额外参数，多个以逗号分隔，如--memory=2g,--user=1000:1000")
+	b.stringVar(&cfg.Shell, "shell", "ECNU_AGENT_SHELL", "本机执行命令使用的解释器：auto在Windows上依次使用pwsh、powershell和cmd，其他系统使用sh；也可以指定sh、powershell或cmd，后两者只能在Windows上使用")
+	b.stringVar(&cfg.K8sContext, "k8s-context", "ECNU_AGENT_K8S_CONTEXT", "kubeconfig中使用的上下文，默认为当前上下文")
+	b.stringVar(&cfg.K8sNamespace, "k8s-namespace", "ECNU_AGENT_K8S_NAMESPACE", "Pod所在的命名空间，默认为上下文的默认命名空间")
+	b.stringVar(&cfg.K8sPod, "k8s-pod", "ECNU_AGENT_K8S_POD", "在该Kubernetes Pod中执行命令和读写文件，通过kubectl访问")
+	b.stringVar(&cfg.K8sContainer, "k8s-container", "ECNU_AGENT_K8S_CONTAINER", "Pod中的容器，默认为Pod的默认容器")
+	b.stringVar(&cfg.PolicyFile, "policy-file", "ECNU_AGENT_POLICY_FILE", "命令策略配置文件，默认~/.ecnu-agent/policy.json")
+	b.listVar(&cfg.CommandAllow, "allow-command", "ECNU_AGENT_ALLOW_COMMAND", "直接执行的命令前缀，多个以逗号分隔，/.../表示正则表达式，如make test,/^npm run (lint|test)$/")
+	b.listVar(&cfg.CommandDeny, "deny-command", "ECNU_AGENT_DENY_COMMAND", "拒绝执行的命令前缀，多个以逗号分隔，/.../表示正则表达式，优先于允许规则")
+	b.stringVar(&cfg.CommandDefault, "command-default", "ECNU_AGENT_COMMAND_DEFAULT", "未匹配任何规则的命令的处理方式：allow直接执行，ask执行前询问（默认），deny拒绝执行")
+	b.intVar(&cfg.CommandCPU, "command-cpu-limit", "ECNU_AGENT_COMMAND_CPU_LIMIT", "execute_command中每个进程的CPU时间上限（秒），0表示不限制")
+	b.intVar(&cfg.CommandMemory, "command-memory-limit", "ECNU_AGENT_COMMAND_MEMORY_LIMIT", "execute_command中每个进程的虚拟内存上限（MB），0表示不限制")
+	b.intVar(&cfg.CommandFileSize, "command-file-limit", "ECNU_AGENT_COMMAND_FILE_LIMIT", "execute_command写入的单个文件的大小上限（MB），0表示不限制")
+	b.intVar(&cfg.CommandOutput, "command-output-limit", "ECNU_AGENT_COMMAND_OUTPUT_LIMIT", "execute_command的输出总量上限（MB），超出时终止命令，0表示不限制")
+	b.intVar(&cfg.DownloadMaxSize, "download-max-size", "ECNU_AGENT_DOWNLOAD_MAX_SIZE", "download_file单个文件的大小上限（MB），0表示不限制")
+	b.listVar(&cfg.DownloadAllow, "download-allow", "ECNU_AGENT_DOWNLOAD_ALLOW", "download_file允许访问的域名，多个以逗号分隔，同时允许其子域名，为空时不限制")
+	b.stringVar(&cfg.GitHubToken, "github-token", "ECNU_AGENT_GITHUB_TOKEN", "code_host访问GitHub API的令牌，默认使用环境变量GITHUB_TOKEN或GH_TOKEN")
+	b.stringVar(&cfg.GitHubURL, "github-url", "ECNU_AGENT_GITHUB_URL", "GitHub API的地址，GitHub Enterprise为https://主机/api/v3")
+	b.stringVar(&cfg.GitLabToken, "gitlab-token", "ECNU_AGENT_GITLAB_TOKEN", "code_host访问GitLab API的令牌，默认使用环境变量GITLAB_TOKEN")
+	b.stringVar(&cfg.GitLabURL, "gitlab-url", "ECNU_AGENT_GITLAB_URL", "GitLab实例的地址，自建实例如https://gitlab.example.com")
+	b.negatedBoolVar(&cfg.Persist, "no-persist", "ECNU_AGENT_PERSIST", "不保存会话状态")
+	b.negatedBoolVar(&cfg.ToolCache, "no-tool-cache", "ECNU_AGENT_TOOL_CACHE", "不缓存本轮任务内重复的只读工具调用")
+	b.negatedBoolVar(&cfg.LiveOutput, "no-live-output", "ECNU_AGENT_LIVE_OUTPUT", "命令结束前不显示其输出")
+	b.negatedBoolVar(&cfg.LineEditing, "no-line-editing", "ECNU_AGENT_LINE_EDITING", "交互式终端上不启用行编辑和输入历史，按普通方式逐行读取输入")
+	b.boolVar(&cfg.TUI, "tui", "ECNU_AGENT_TUI", "以全屏界面运行：对话、工具调用日志和状态栏（模型、token用量、步骤）分开显示")
+	b.stringVar(&cfg.HistoryFile, "history-file", "ECNU_AGENT_HISTORY_FILE", "保存主提示符下输入历史的文件，默认~/.ecnu-agent/history，设为空字符串时不保存")
+	b.stringVar(&cfg.Notify, "notify", "ECNU_AGENT_NOTIFY", "交互模式下任务结束或等待确认时提醒：off不提醒，bell终端响铃，osc发送OSC 9终端通知，desktop发送系统桌面通知，auto能发送桌面通知时使用桌面通知、否则使用OSC 9")
+	b.intVar(&cfg.NotifyAfter, "notify-after", "ECNU_AGENT_NOTIFY_AFTER", "任务运行超过该秒数才提醒，0表示总是提醒")
+	b.negatedBoolVar(&cfg.ShellSession, "no-shell-session", "ECNU_AGENT_SHELL_SESSION", "每条命令都从工作区目录和启动时的环境开始，不保留cd和export的效果")
+	b.negatedBoolVar(&cfg.Backup, "no-backup", "ECNU_AGENT_BACKUP", "覆盖文件前不备份原内容")
+	b.stringVar(&cfg.StateDir, "state-dir", "ECNU_AGENT_STATE_DIR", "会话状态目录，默认~/.ecnu-agent/sessions")
+	// 恢复会话只针对单次启动，不提供环境变量
+	fs.StringVar(&cfg.Resume, "resume", "", "恢复保存的会话并从中断处继续，值为会话ID或last（所有目录中最近的会话）")
+	fs.BoolVar(&cfg.Continue, "continue", false, "恢复在当前工作目录（或--workspace）中最近进行的会话")
+	b.stringVar(&cfg.Session, "session", "ECNU_AGENT_SESSION", "使用指定名称的会话：已保存时恢复，否则以该名称开始新会话，便于为不同项目分别保留上下文")
+	fs.StringVar(&cfg.Prompt, "p", "", "非交互地执行该任务，最终回答写入标准输出后退出，也可以直接把任务作为位置参数")
+	b.stringVar(&cfg.Output, "output", "ECNU_AGENT_OUTPUT", "单次运行的输出格式：text只输出最终回答，json结束时输出包含结果和全部事件的JSON对象，jsonl每个事件输出一行JSON")
+	b.intVar(&cfg.Seed, "seed", "ECNU_AGENT_SEED", "随机种子，配合较低的temperature使输出可复现，0表示不设置")
+	b.stringVar(&cfg.RecordFile, "record", "ECNU_AGENT_RECORD", "将每次请求和响应以JSON Lines格式追加到该文件，便于复现和调试")
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if rest := fs.Args(); len(rest) > 0 {
+		if cfg.Prompt != "" {
+			return nil, fmt.Errorf("不能同时使用-p和位置参数指定任务")
+		}
+		cfg.Prompt = strings.Join(rest, " ")
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate 检查配置取值是否合法
+func (c *Config) validate() error {
+	if strings.TrimSpace(c.Provider) == "" {
+		return fmt.Errorf("provider不能为空")
+	}
+	if c.MaxSteps < 1 {
+		return fmt.Errorf("max-steps必须大于0，当前为%d", c.MaxSteps)
+	}
+	if c.MaxHistory < 0 || c.MaxHistory == 1 {
+		return fmt.Errorf("max-history必须为0或不小于2，当前为%d", c.MaxHistory)
+	}
+	if c.HistoryTokens < 0 {
+		return fmt.Errorf("history-tokens不能为负数，当前为%d", c.HistoryTokens)
+	}
+	if c.ContextWindow < 0 {
+		return fmt.Errorf("context-window不能为负数，当前为%d", c.ContextWindow)
+	}
+	if c.MaxRetries < 1 {
+		return fmt.Errorf("max-retries必须大于0，当前为%d", c.MaxRetries)
+	}
+	if c.LoopThreshold < 0 || c.LoopThreshold == 1 {
+		return fmt.Errorf("loop-threshold必须为0或不小于2，当前为%d", c.LoopThreshold)
+	}
+	if c.ToolMode != toolModeNative && c.ToolMode != toolModeReact {
+		return fmt.Errorf("tool-mode必须为native或react，当前为%q", c.ToolMode)
+	}
+	if c.jsonOutput() && c.ToolMode == toolModeReact {
+		return fmt.Errorf("JSON模式不能与react工具调用方式同时使用")
+	}
+	if c.jsonOutput() && c.Verify {
+		return fmt.Errorf("JSON模式不能与verify同时使用")
+	}
+	if c.ToolWorkers < 1 {
+		return fmt.Errorf("tool-workers必须大于0，当前为%d", c.ToolWorkers)
+	}
+	if c.ToolTimeout < 0 {
+		return fmt.Errorf("tool-timeout不能为负数，当前为%d", c.ToolTimeout)
+	}
+	if c.ReadLimit < 0 {
+		return fmt.Errorf("read-limit不能为负数，当前为%d", c.ReadLimit)
+	}
+	if c.ToolOutputLimit < 0 {
+		return fmt.Errorf("tool-output-limit不能为负数，当前为%d", c.ToolOutputLimit)
+	}
+	if c.Sandbox != sandboxNone && c.Sandbox != sandboxDocker && c.Sandbox != sandboxBwrap {
+		return fmt.Errorf("sandbox必须为none、docker或bwrap，当前为%q", c.Sandbox)
+	}
+	if !slices.Contains(notifyModes, c.Notify) {
+		return fmt.Errorf("notify必须为%s，当前为%q", strings.Join(notifyModes, "、"), c.Notify)
+	}
+	if c.Verbose && c.Quiet {
+		return fmt.Errorf("verbose不能与quiet同时使用")
+	}
+	if c.TUI && c.jsonOutput() {
+		return fmt.Errorf("tui不能与JSON输出同时使用")
+	}
+	if !slices.Contains(outputFormats, c.Output) {
+		return fmt.Errorf("output必须为%s，当前为%q", strings.Join(outputFormats, "、"), c.Output)
+	}
+	if c.Output != outputText && c.Prompt == "" {
+		return fmt.Errorf("output=%s只能用于单次运行（-p或位置参数）", c.Output)
+	}
+	if c.Continue && c.Resume != "" {
+		return fmt.Errorf("continue不能与resume同时使用")
+	}
+	if c.Session != "" {
+		if !sessionNamePattern.MatchString(c.Session) {
+			return fmt.Errorf("session只能包含字母、数字、点、下划线和连字符，当前为%q", c.Session)
+		}
+		if c.Continue || c.Resume != "" {
+			return fmt.Errorf("session不能与continue或resume同时使用")
+		}
+		if !c.Persist {
+			return fmt.Errorf("session需要保存会话状态，不能与no-persist同时使用")
+		}
+	}
+	if c.TUI && c.Prompt != "" {
+		return fmt.Errorf("tui不能与单次运行的任务同时使用")
+	}
+	if c.NotifyAfter < 0 {
+		return fmt.Errorf("notify-after不能为负数，当前为%d", c.NotifyAfter)
+	}
+	if !slices.Contains(shellNames, c.Shell) {
+		return fmt.Errorf("shell必须为%s，当前为%q", strings.Join(shellNames, "、"), c.Shell)
+	}
+	if (c.Shell == shellPowerShell || c.Shell == shellCmd) && runtime.GOOS != "windows" {
+		return fmt.Errorf("shell=%s只能在Windows上使用", c.Shell)
+	}
+	if c.Sandbox == sandboxDocker && c.SandboxImage == "" {
+		return fmt.Errorf("使用docker沙箱时必须指定sandbox-image")
+	}
+	if c.K8sPod == "" && (c.K8sContext != "" || c.K8sNamespace != "" || c.K8sContainer != "") {
+		return fmt.Errorf("k8s-context、k8s-namespace和k8s-container需要与k8s-pod一起使用")
+	}
+	if c.WorkspaceOnly && c.AllowOutside {
+		return fmt.Errorf("workspace-only不能与allow-outside-workspace同时使用")
+	}
+	if c.WorkspaceOnly && c.K8sPod != "" {
+		return fmt.Errorf("workspace-only不能与k8s-pod同时使用")
+	}
+	if c.K8sPod != "" && c.Sandbox != sandboxNone {
+		return fmt.Errorf("k8s-pod不能与sandbox同时使用")
+	}
+	for _, scope := range c.AutoApprove {
+		if !slices.Contains(approveScopes, strings.TrimPrefix(scope, "-")) {
+			return fmt.Errorf("auto-approve的范围必须为%s，当前为%q", strings.Join(approveScopes, "、"), scope)
+		}
+	}
+	if c.CommandDefault != "" && c.CommandDefault != policyAllow && c.CommandDefault != policyAsk && c.CommandDefault != policyDeny {
+		return fmt.Errorf("command-default必须为allow、ask或deny，当前为%q", c.CommandDefault)
+	}
+	if c.CommandCPU < 0 || c.CommandMemory < 0 || c.CommandFileSize < 0 || c.CommandOutput < 0 {
+		return fmt.Errorf("command-cpu-limit、command-memory-limit、command-file-limit和command-output-limit不能为负数")
+	}
+	if c.DownloadMaxSize < 0 {
+		return fmt.Errorf("download-max-size不能为负数，当前为%d", c.DownloadMaxSize)
+	}
+	for name, value := range map[string]string{"github-url": c.GitHubURL, "gitlab-url": c.GitLabURL} {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s必须是http或https地址，当前为%q", name, value)
+		}
+	}
+	if c.RequestsPerMinute < 0 || c.TokensPerMinute < 0 {
+		return fmt.Errorf("rpm和tpm不能为负数")
+	}
+	if c.MaxTaskTokens < 0 || c.MaxTaskCost < 0 || c.MaxTaskTime < 0 {
+		return fmt.Errorf("max-task-tokens、max-task-cost和max-task-time不能为负数")
+	}
+	if c.MaxTaskCost > 0 && c.PriceFile == "" {
+		return fmt.Errorf("max-task-cost需要通过price-file提供价格表")
+	}
+	return c.validateSampling()
+}
+
+// validateSampling 检查采样参数是否在API允许的范围内
+func (c *Config) validateSampling() error {
+	if c.Temperature < 0 || c.Temperature > 2 {
+		return fmt.Errorf("temperature取值应在0~2之间，当前为%g", c.Temperature)
+	}
+	if c.TopP < 0 || c.TopP > 1 {
+		return fmt.Errorf("top-p取值应在0~1之间，当前为%g", c.TopP)
+	}
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("max-tokens不能为负数，当前为%d", c.MaxTokens)
+	}
+	if c.FrequencyPenalty < -2 || c.FrequencyPenalty > 2 {
+		return fmt.Errorf("frequency-penalty取值应在-2~2之间，当前为%g", c.FrequencyPenalty)
+	}
+	if c.PresencePenalty < -2 || c.PresencePenalty > 2 {
+		return fmt.Errorf("presence-penalty取值应在-2~2之间，当前为%g", c.PresencePenalty)
+	}
+	if len(c.Stop) > 4 {
+		return fmt.Errorf("stop最多支持4个停止序列，当前为%d个", len(c.Stop))
+	}
+	return nil
+}
+
+// setSampling 在运行时修改一个采样参数，修改失败时保持原值
+func (c *Config) setSampling(name, value string) error {
+	next := *c
+	var err error
+	switch name {
+	case "temperature":
+		next.Temperature, err = strconv.ParseFloat(value, 64)
+	case "top_p", "top-p":
+		next.TopP, err = strconv.ParseFloat(value, 64)
+	case "max_tokens", "max-tokens":
+		next.MaxTokens, err = strconv.Atoi(value)
+	case "frequency_penalty", "frequency-penalty":
+		next.FrequencyPenalty, err = strconv.ParseFloat(value, 64)
+	case "presence_penalty", "presence-penalty":
+		next.PresencePenalty, err = strconv.ParseFloat(value, 64)
+	case "stop":
+		next.Stop = splitList(value)
+	case "seed":
+		next.Seed, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("未知的采样参数: %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("参数值不合法: %q", value)
+	}
+	if err := next.validateSampling(); err != nil {
+		return err
+	}
+	*c = next
+	return nil
+}
+
+// applySampling 将采样参数写入请求
+func (c *Config) applySampling(req *openai.ChatCompletionRequest) {
+	req.Temperature = float32(c.Temperature)
+	if req.Temperature == 0 {
+		// 请求字段带omitempty，0值需要用极小值代替才能发送
+		req.Temperature = math.SmallestNonzeroFloat32
+	}
+	req.TopP = float32(c.TopP)
+	req.MaxTokens = c.MaxTokens
+	req.FrequencyPenalty = float32(c.FrequencyPenalty)
+	req.PresencePenalty = float32(c.PresencePenalty)
+	req.Stop = c.Stop
+	if c.Seed != 0 {
+		seed := c.Seed
+		req.Seed = &seed
+	}
+}
+
+// describeSampling 返回采样参数的说明
+func (c *Config) describeSampling() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  temperature:       %g\n", c.Temperature)
+	fmt.Fprintf(&b, "  top_p:             %s\n", defaultString(c.TopP == 0, strconv.FormatFloat(c.TopP, 'g', -1, 64)))
+	fmt.Fprintf(&b, "  max_tokens:        %s\n", limitString(c.MaxTokens))
+	fmt.Fprintf(&b, "  frequency_penalty: %g\n", c.FrequencyPenalty)
+	fmt.Fprintf(&b, "  presence_penalty:  %g\n", c.PresencePenalty)
+	fmt.Fprintf(&b, "  stop:              %s\n", defaultString(len(c.Stop) == 0, strings.Join(c.Stop, ", ")))
+	fmt.Fprintf(&b, "  seed:              %s\n", defaultString(c.Seed == 0, strconv.Itoa(c.Seed)))
+	return b.String()
+}
+
+// describe 返回便于展示的配置说明
+func (c *Config) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  服务商 (provider):              %s\n", c.Provider)
+	if c.BaseURL != "" {
+		fmt.Fprintf(&b, "  API地址 (base-url):             %s\n", c.BaseURL)
+	}
+	fmt.Fprintf(&b, "  模型 (model):                   %s\n", c.Model)
+	if len(c.Fallbacks) > 0 {
+		fmt.Fprintf(&b, "  备用端点 (fallback):            %s\n", strings.Join(c.Fallbacks, ", "))
+	}
+	fmt.Fprintf(&b, "  最大步骤数 (max-steps):         %d\n", c.MaxSteps)
+	fmt.Fprintf(&b, "  最大历史数 (max-history):       %s\n", limitString(c.MaxHistory))
+	fmt.Fprintf(&b, "  历史token预算 (history-tokens): %s\n", limitString(c.HistoryTokens))
+	fmt.Fprintf(&b, "  上下文窗口 (context-window):    %s\n", defaultString(c.ContextWindow == 0, strconv.Itoa(c.ContextWindow)))
+	fmt.Fprintf(&b, "  最大尝试次数 (max-retries):     %d\n", c.MaxRetries)
+	fmt.Fprintf(&b, "  循环检测 (loop-threshold):      %s\n", defaultString(c.LoopThreshold == 0, fmt.Sprintf("连续%d次", c.LoopThreshold)))
+	fmt.Fprintf(&b, "  工具调用方式 (tool-mode):       %s\n", c.ToolMode)
+	fmt.Fprintf(&b, "  工具并发 (tool-workers):        %d\n", c.ToolWorkers)
+	fmt.Fprintf(&b, "  工具时限 (tool-timeout):        %s\n", defaultString(c.ToolTimeout == 0, fmt.Sprintf("%d秒", c.ToolTimeout)))
+	fmt.Fprintf(&b, "  工具输出上限 (tool-output-limit): %s\n", defaultString(c.ToolOutputLimit == 0, fmt.Sprintf("%d字节", c.ToolOutputLimit)))
+	fmt.Fprintf(&b, "  读取文件上限 (read-limit):      %s\n", defaultString(c.ReadLimit == 0, fmt.Sprintf("%d字节", c.ReadLimit)))
+	fmt.Fprintf(&b, "  只读结果缓存 (tool-cache):      %v\n", c.ToolCache)
+	fmt.Fprintf(&b, "  保留shell状态 (shell-session):  %v\n", c.ShellSession)
+	fmt.Fprintf(&b, "  实时显示输出 (live-output):     %v\n", c.LiveOutput)
+	historyFile := c.HistoryFile
+	if historyFile == "" {
+		historyFile = "不保存"
+	}
+	fmt.Fprintf(&b, "  行编辑 (line-editing):          %v (输入历史: %s)\n", c.LineEditing, historyFile)
+	fmt.Fprintf(&b, "  全屏界面 (tui):                 %v\n", c.TUI)
+	fmt.Fprintf(&b, "  完成提醒 (notify):              %s (任务运行超过%d秒时)\n", c.Notify, c.NotifyAfter)
+	fmt.Fprintf(&b, "  覆盖前备份 (backup):            %v\n", c.Backup)
+	fmt.Fprintf(&b, "  速率限制 (rpm/tpm):             %s 请求/分钟, %s tokens/分钟\n", limitString(c.RequestsPerMinute), limitString(c.TokensPerMinute))
+	taskCost := "不限制"
+	if c.MaxTaskCost > 0 {
+		taskCost = strconv.FormatFloat(c.MaxTaskCost, 'g', -1, 64)
+	}
+	fmt.Fprintf(&b, "  任务预算 (max-task-*):          %s tokens, 费用 %s, 耗时 %s秒\n", limitString(c.MaxTaskTokens), taskCost, limitString(c.MaxTaskTime))
+	fmt.Fprintf(&b, "  先规划后执行 (plan):            %v\n", c.Plan)
+	fmt.Fprintf(&b, "  完成后验证 (verify):            %v\n", c.Verify)
+	if c.jsonOutput() {
+		fmt.Fprintf(&b, "  JSON输出 (json-schema):         %s\n", defaultString(c.JSONSchema == "", c.JSONSchema))
+	}
+	fmt.Fprintf(&b, "  工作区 (workspace):             %s (允许操作工作区之外: %v, 只允许访问工作区: %v)\n", defaultString(c.Workspace == "", c.Workspace), c.AllowOutside, c.WorkspaceOnly)
+	fmt.Fprintf(&b, "  演练模式 (dry-run):             %v\n", c.DryRun)
+	fmt.Fprintf(&b, "  自动确认 (auto-approve):        %s\n", defaultString(len(c.AutoApprove) == 0, strings.Join(c.AutoApprove, ",")))
+	fmt.Fprintf(&b, "  图片输入 (vision):              %v\n", c.Vision)
+	switch {
+	case c.K8sPod != "":
+		fmt.Fprintf(&b, "  Kubernetes Pod (k8s-*):         %s (命名空间: %s, 上下文: %s, 容器: %s)\n", c.K8sPod,
+			defaultString(c.K8sNamespace == "", c.K8sNamespace), defaultString(c.K8sContext == "", c.K8sContext), defaultString(c.K8sContainer == "", c.K8sContainer))
+	case c.Sandbox == sandboxDocker:
+		fmt.Fprintf(&b, "  命令沙箱 (sandbox):             docker (镜像: %s, 网络: %v)\n", c.SandboxImage, c.SandboxNetwork)
+	case c.Sandbox == sandboxBwrap:
+		fmt.Fprintf(&b, "  命令沙箱 (sandbox):             bwrap (网络: %v)\n", c.SandboxNetwork)
+	default:
+		fmt.Fprintf(&b, "  命令沙箱 (sandbox):             %s\n", c.Sandbox)
+		fmt.Fprintf(&b, "  命令解释器 (shell):             %s\n", c.Shell)
+	}
+	fmt.Fprintf(&b, "  命令策略 (command-default):     未匹配时 %s, 允许 %d 条, 拒绝 %d 条, 策略文件 %s\n", defaultString(c.CommandDefault == "", c.CommandDefault),
+		len(c.CommandAllow), len(c.CommandDeny), defaultString(c.PolicyFile == "", c.PolicyFile))
+	fmt.Fprintf(&b, "  命令资源限制 (command-*-limit): CPU %s, 内存 %s, 单个文件 %s, 输出 %s\n",
+		limitUnit(c.CommandCPU, "秒"), limitUnit(c.CommandMemory, "MB"), limitUnit(c.CommandFileSize, "MB"), limitUnit(c.CommandOutput, "MB"))
+	downloadSize, downloadHosts := "不限制", "不限制"
+	if c.DownloadMaxSize > 0 {
+		downloadSize = fmt.Sprintf("%dMB", c.DownloadMaxSize)
+	}
+	if len(c.DownloadAllow) > 0 {
+		downloadHosts = strings.Join(c.DownloadAllow, ", ")
+	}
+	fmt.Fprintf(&b, "  下载限制 (download-*):          大小 %s, 域名 %s\n", downloadSize, downloadHosts)
+	fmt.Fprintf(&b, "  代码托管 (github-*/gitlab-*):   GitHub %s (令牌: %s), GitLab %s (令牌: %s)\n", c.GitHubURL, tokenState(c.githubToken()), c.GitLabURL, tokenState(c.gitlabToken()))
+	fmt.Fprintf(&b, "  会话状态 (persist):             %v (目录: %s)\n", c.Persist, defaultString(c.StateDir == "", c.StateDir))
+	if c.RecordFile != "" {
+		fmt.Fprintf(&b, "  运行记录 (record):              %s\n", c.RecordFile)
+	}
+	fmt.Fprintf(&b, "  流式输出 (stream):              %v\n", c.Stream)
+	fmt.Fprintf(&b, "  原文输出 (plain):               %v\n", c.Plain)
+	fmt.Fprintf(&b, "  诊断信息 (verbose/quiet):       %s\n", logLevelNames[c.logLevel()])
+	fmt.Fprintf(&b, "  摘要压缩 (compact):             %v (模型: %s)\n", c.Compact, defaultString(c.CompactModel == "", c.CompactModel))
+	b.WriteString("采样参数:\n")
+	b.WriteString(c.describeSampling())
+	return b.String()
+}
+
+// githubToken 返回访问GitHub API的令牌，未配置时使用gh等工具通用的环境变量
+func (c *Config) githubToken() string {
+	if c.GitHubToken != "" {
+		return c.GitHubToken
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+// gitlabToken 返回访问GitLab API的令牌，未配置时使用环境变量GITLAB_TOKEN
+func (c *Config) gitlabToken() string {
+	if c.GitLabToken != "" {
+		return c.GitLabToken
+	}
+	return os.Getenv("GITLAB_TOKEN")
+}
+
+// tokenState 返回令牌是否已设置，不显示令牌本身
+func tokenState(token string) string {
+	if token == "" {
+		return "未设置"
+	}
+	return "已设置"
+}
+
+// limitString 将表示上限的整数格式化，0显示为不限制
+func limitString(n int) string {
+	if n == 0 {
+		return "不限制"
+	}
+	return strconv.Itoa(n)
+}
+
+// limitUnit 将带单位的上限格式化为字符串，0表示不限制
+func limitUnit(n int, unit string) string {
+	if n == 0 {
+		return "不限制"
+	}
+	return strconv.Itoa(n) + unit
+}
+
+// defaultString 在unset为true时返回"默认"，否则返回value
+func defaultString(unset bool, value string) string {
+	if unset {
+		return "默认"
+	}
+	return value
+}
+
+// splitList 将逗号分隔的字符串拆分为列表，忽略空白项
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configBinder 将配置项同时绑定到环境变量和命令行参数
+//
+// 环境变量的值作为命令行参数的默认值，从而实现命令行参数优先。
+// 绑定过程中遇到的第一个环境变量解析错误保存在err中。
+type configBinder struct {
+	fs  *flag.FlagSet
+	err error
+}
+
+// lookup 读取环境变量，未设置或为空时返回false
+func (b *configBinder) lookup(env string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(env))
+	return v, v != ""
+}
+
+// fail 记录第一个环境变量解析错误
+func (b *configBinder) fail(env, kind, value string) {
+	if b.err == nil {
+		b.err = fmt.Errorf("环境变量%s不是合法%s: %q", env, kind, value)
+	}
+}
+
+// usage 生成带环境变量名的参数说明
+func (b *configBinder) usage(usage, env string) string {
+	return fmt.Sprintf("%s (%s)", usage, env)
+}
+
+// stringVar 绑定字符串配置项
+func (b *configBinder) stringVar(p *string, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		*p = v
+	}
+	b.fs.StringVar(p, name, *p, b.usage(usage, env))
+}
+
+// intVar 绑定整数配置项
+func (b *configBinder) intVar(p *int, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.fail(env, "整数", v)
+		} else {
+			*p = n
+		}
+	}
+	b.fs.IntVar(p, name, *p, b.usage(usage, env))
+}
+
+// floatVar 绑定浮点数配置项
+func (b *configBinder) floatVar(p *float64, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			b.fail(env, "数字", v)
+		} else {
+			*p = f
+		}
+	}
+	b.fs.Float64Var(p, name, *p, b.usage(usage, env))
+}
+
+// boolVar 绑定布尔配置项
+func (b *configBinder) boolVar(p *bool, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			b.fail(env, "布尔值", v)
+		} else {
+			*p = parsed
+		}
+	}
+	b.fs.BoolVar(p, name, *p, b.usage(usage, env))
+}
+
+// negatedBoolVar 绑定默认开启的布尔配置项，命令行使用--no-xxx关闭，环境变量为正向取值
+func (b *configBinder) negatedBoolVar(p *bool, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			b.fail(env, "布尔值", v)
+		} else {
+			*p = parsed
+		}
+	}
+	b.fs.Var(negatedBool{p}, name, fmt.Sprintf("%s (%s=false)", usage, env))
+}
+
+// listVar 绑定逗号分隔的列表配置项
+func (b *configBinder) listVar(p *[]string, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		*p = splitList(v)
+	}
+	b.fs.Func(name, b.usage(usage, env), func(v string) error {
+		*p = splitList(v)
+		return nil
+	})
+}
+
+// approveVar 绑定--auto-approve，不带值或为true时表示全部范围，为false时表示不自动确认
+func (b *configBinder) approveVar(p *[]string, name, env, usage string) {
+	if v, ok := b.lookup(env); ok {
+		*p = parseApproveScopes(v)
+	}
+	b.fs.Var(approveFlag{p}, name, b.usage(usage, env))
+}
+
+// parseApproveScopes 解析--auto-approve的取值
+func parseApproveScopes(v string) []string {
+	if parsed, err := strconv.ParseBool(v); err == nil {
+		if parsed {
+			return []string{approveAll}
+		}
+		return nil
+	}
+	return splitList(v)
+}
+
+// approveFlag 可以不带值使用的范围列表参数
+type approveFlag struct {
+	p *[]string
+}
+
+func (f approveFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return strings.Join(*f.p, ",")
+}
+
+func (f approveFlag) Set(s string) error {
+	*f.p = parseApproveScopes(s)
+	return nil
+}
+
+func (f approveFlag) IsBoolFlag() bool { return true }
+
+// autoApproves 判断scope范围的操作是否不询问直接通过，排除项优先
+func (c *Config) autoApproves(scope string) bool {
+	if slices.Contains(c.AutoApprove, "-"+scope) {
+		return false
+	}
+	return slices.Contains(c.AutoApprove, scope) || slices.Contains(c.AutoApprove, approveAll)
+}
+
+// negatedBool 取反的布尔参数，设置为true时将目标置为false
+type negatedBool struct {
+	p *bool
+}
+
+func (n negatedBool) String() string {
+	if n.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!*n.p)
+}
+
+func (n negatedBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*n.p = !v
+	return nil
+}
+
+func (n negatedBool) IsBoolFlag() bool { return true }
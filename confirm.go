@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const confirmDiffLines = 200 // 确认覆盖时最多显示的差异行数
+
+// 需要确认的操作范围，--auto-approve可以只对其中一部分直接通过
+const (
+	approveAll       = "all"       // 所有需要确认的操作
+	approveSafe      = "safe"      // 未匹配任何命令规则的命令
+	approveDangerous = "dangerous" // 匹配了询问规则的危险命令，如sudo、rm -r
+	approveWrite     = "write"     // 覆盖已有文件和修改数据库
+	approveDelete    = "delete"    // 删除文件
+	approveRemote    = "remote"    // 上传文件和信任新的SSH主机
+)
+
+// approveScopes --auto-approve可用的操作范围
+var approveScopes = []string{approveAll, approveSafe, approveDangerous, approveWrite, approveDelete, approveRemote}
+
+// confirmRequest 一次需要用户回答y/n的确认
+type confirmRequest struct {
+	ctx    context.Context
+	prompt string
+	reply  chan bool
+}
+
+// approver 把工具执行期间的确认请求交给读取输入的主循环，非交互模式下为nil
+type approver struct {
+	requests chan confirmRequest
+}
+
+// confirm 请用户确认属于scope范围的操作，--auto-approve包含该范围时直接通过，无法询问用户时拒绝
+func (a *ECNUAgent) confirm(ctx context.Context, scope, prompt string) (bool, error) {
+	if a.config.autoApproves(scope) {
+		return true, nil
+	}
+	if a.approver == nil {
+		return false, fmt.Errorf("非交互模式下无法确认，如需允许请使用 --auto-approve=%s 启动", scope)
+	}
+	a.spinner.end()
+	// 等待用户回答的时间不计入工具的时间限制
+	deadline := toolDeadlineFrom(ctx)
+	deadline.pause()
+	defer deadline.resume()
+	req := confirmRequest{ctx: ctx, prompt: prompt, reply: make(chan bool, 1)}
+	select {
+	case a.approver.requests <- req:
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	select {
+	case ok := <-req.reply:
+		return ok, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// confirmOverwrite 显示新旧内容的差异并询问是否覆盖，内容没有变化时不询问
+func (a *ECNUAgent) confirmOverwrite(ctx context.Context, fullPath, newText string) (bool, error) {
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return true, nil
+	}
+	return a.confirmReplace(ctx, fullPath, data, newText)
+}
+
+// confirmRemove 显示将被删除或覆盖的路径及其大小并询问是否继续，action为删除或覆盖
+func (a *ECNUAgent) confirmRemove(ctx context.Context, scope, action, fullPath string, info os.FileInfo) (bool, error) {
+	what := formatSize(info.Size())
+	if info.IsDir() {
+		what = "目录"
+		if entries, err := os.ReadDir(fullPath); err == nil {
+			what = fmt.Sprintf("目录，包含%d项", len(entries))
+		}
+	}
+	return a.confirm(ctx, scope, fmt.Sprintf("\n即将%s %s（%s），原内容会移入回收站\n是否%s？(y/N) ", action, fullPath, what, action))
+}
+
+// confirmReplace 显示原内容data与newText的差异并询问是否覆盖
+func (a *ECNUAgent) confirmReplace(ctx context.Context, fullPath string, data []byte, newText string) (bool, error) {
+	var diff string
+	if oldText, _, ok := decodeText(data); ok {
+		diff = unifiedDiff(fullPath, fullPath, strings.ReplaceAll(oldText, "\r\n", "\n"), strings.ReplaceAll(newText, "\r\n", "\n"))
+		if diff == "" {
+			return true, nil
+		}
+		diff = colorDiff(diff, a.colorOutput())
+	} else {
+		diff = fmt.Sprintf("%s是二进制文件（%s），无法显示差异\n", fullPath, formatSize(int64(len(data))))
+	}
+	return a.confirm(ctx, approveWrite, fmt.Sprintf("\n即将覆盖已有文件 %s:\n%s是否覆盖？(y/N) ", fullPath, diff))
+}
+
+// colorDiff 截断过长的差异，color为true时为删除、新增和块标题加上颜色
+//
+// 能根据文件名识别语言时，代码按语言着色，删除和新增的行改用背景色区分。
+func colorDiff(diff string, color bool) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	var lang *language
+	var oldCode, newCode *highlighter
+	var b strings.Builder
+	for i, line := range lines {
+		if i == confirmDiffLines {
+			fmt.Fprintf(&b, "...（另有%d行差异未显示）\n", len(lines)-i)
+			break
+		}
+		if color {
+			switch {
+			case i < 2:
+				if i == 0 {
+					lang = languageFor(strings.TrimPrefix(line, "--- "))
+				}
+				line = "\033[1m" + line + "\033[0m"
+			case strings.HasPrefix(line, "@@"):
+				oldCode, newCode = newHighlighter(lang), newHighlighter(lang)
+				line = "\033[36m" + line + "\033[0m"
+			case lang == nil && strings.HasPrefix(line, "+"):
+				line = "\033[32m" + line + "\033[0m"
+			case lang == nil && strings.HasPrefix(line, "-"):
+				line = "\033[31m" + line + "\033[0m"
+			case strings.HasPrefix(line, "+"):
+				line = "\033[48;5;22m\033[32m+\033[39m" + newCode.line(line[1:]) + "\033[0m"
+			case strings.HasPrefix(line, "-"):
+				line = "\033[48;5;52m\033[31m-\033[39m" + oldCode.line(line[1:]) + "\033[0m"
+			case lang != nil && line != "":
+				oldCode.line(line[1:])
+				line = line[:1] + newCode.line(line[1:])
+			}
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// answerYes 判断回答是否为确认
+func answerYes(line string) bool {
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultReplyReserve 未设置max-tokens时为回复预留的token数
+const defaultReplyReserve = 2048
+
+// builtinContextWindows 常见模型的上下文窗口大小，按模型名前缀匹配，较长的前缀优先
+var builtinContextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"deepseek-chat": 64000,
+	"deepseek-r":    64000,
+	"qwen2.5":       32768,
+	"llama3":        8192,
+}
+
+// lookupContextWindow 在内置表中查找模型的上下文窗口
+func lookupContextWindow(model string) int {
+	best, window := 0, 0
+	for prefix, size := range builtinContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, window = len(prefix), size
+		}
+	}
+	return window
+}
+
+// contextWindow 返回当前模型的上下文窗口及其来源，未知时返回0
+//
+// 依次使用：命令行或环境变量配置、服务商配置中的context_windows、
+// 服务端/models接口返回的信息、内置表。
+func (a *ECNUAgent) contextWindow(ctx context.Context) (int, string) {
+	model := a.model()
+	if a.config.ContextWindow > 0 {
+		return a.config.ContextWindow, "配置"
+	}
+	if n := a.backend.provider.ContextWindows[model]; n > 0 {
+		return n, "服务商配置"
+	}
+	if n := a.discoveredContextWindow(ctx, model); n > 0 {
+		return n, "模型列表"
+	}
+	if n := lookupContextWindow(model); n > 0 {
+		return n, "内置表"
+	}
+	return 0, ""
+}
+
+// discoveredContextWindow 从服务端模型列表中获取上下文窗口，每个端点只查询一次
+func (a *ECNUAgent) discoveredContextWindow(ctx context.Context, model string) int {
+	b := a.backend
+	if !b.windowsLoaded {
+		b.windowsLoaded = true
+		b.windows = make(map[string]int)
+		models, err := a.listModels(ctx)
+		if err != nil {
+			log.Printf("[上下文] 获取模型列表失败，无法确定上下文窗口: %v\n", err)
+		}
+		for _, m := range models {
+			if m.ContextWindow > 0 {
+				b.windows[m.ID] = m.ContextWindow
+			}
+		}
+	}
+	return b.windows[model]
+}
+
+// estimateRequestTokens 估算历史和工具定义合计占用的token数
+func estimateRequestTokens(messages []openai.ChatCompletionMessage, tools []openai.Tool) int {
+	total := estimateHistoryTokens(messages)
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		total += estimateTokens(string(data))
+	}
+	return total
+}
+
+// preflight 发送请求前检查是否超出模型的上下文窗口
+//
+// 超出时先压缩或截断历史，仍然放不下（通常是单条消息或工具输出过大）时返回明确的错误，
+// 而不是等待服务端返回难以理解的400错误。
+func (a *ECNUAgent) preflight(ctx context.Context, tools []openai.Tool) error {
+	window, source := a.contextWindow(ctx)
+	if window <= 0 {
+		return nil
+	}
+	reserve := a.config.MaxTokens
+	if reserve <= 0 {
+		reserve = defaultReplyReserve
+	}
+	if reserve > window/4 {
+		reserve = window / 4
+	}
+	limit := window - reserve
+
+	need := estimateRequestTokens(a.history, tools)
+	if need <= limit {
+		return nil
+	}
+
+	log.Printf("[上下文] 请求约 %d tokens，超出模型 %s 的上下文窗口（%d tokens，来源: %s），正在缩减历史...\n", need, a.model(), window, source)
+	budget := limit - (need - estimateHistoryTokens(a.history))
+	if budget < 1 {
+		budget = 1
+	}
+	if a.config.Compact {
+		a.summarizeOlder(ctx, budget)
+	}
+	a.truncateHistoryTo(budget)
+
+	if need = estimateRequestTokens(a.history, tools); need > limit {
+		return fmt.Errorf("请求约 %d tokens，超出模型 %s 的上下文窗口 %d tokens（已为回复预留 %d）。最近的消息或工具输出过大，请缩小输出范围（例如只读取文件的一部分、过滤命令输出）或换用上下文更大的模型",
+			need, a.model(), window, reserve)
+	}
+	return nil
+}
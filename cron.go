@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchYears 查找下一次执行时间时最多向后查找的年数，如2月30日这样永远不会到来的时间会在此之后放弃
+const cronSearchYears = 5
+
+// cronAliases 常用的简写
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronMonths 和 cronWeekdays 月份和星期的英文缩写
+var (
+	cronMonths   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronField 表达式中一个字段的取值范围和名称
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // 可以用名称代替数字，第一个名称对应min
+}
+
+// cronFields 分、时、日、月、星期五个字段
+var cronFields = []cronField{
+	{name: "分钟", min: 0, max: 59},
+	{name: "小时", min: 0, max: 23},
+	{name: "日期", min: 1, max: 31},
+	{name: "月份", min: 1, max: 12, names: cronMonths},
+	{name: "星期", min: 0, max: 7, names: cronWeekdays},
+}
+
+// cronSchedule 解析后的cron表达式，每个字段是允许取值的位集合
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	dayAny, weekdayAny                bool          // 日期或星期为*，两者都有限制时满足其一即可
+	every                             time.Duration // @every的间隔，不为0时忽略其他字段
+}
+
+// parseCron 解析标准的5字段cron表达式（分 时 日 月 星期），支持*、列表、范围、步长、月份和星期的英文缩写，
+// 以及@daily、@hourly等简写和@every 30m形式的固定间隔
+func parseCron(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("@every的间隔%q无效，需要为不短于1分钟的时长，如30m、2h", rest)
+		}
+		return &cronSchedule{every: d}, nil
+	}
+	if alias, ok := cronAliases[strings.ToLower(spec)]; ok {
+		spec = alias
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron表达式%q应当有5个字段（分 时 日 月 星期），如\"0 8 * * *\"表示每天8点", spec)
+	}
+	sets := make([]uint64, len(parts))
+	for i, part := range parts {
+		set, err := cronFields[i].parse(part)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	// 星期中的7与0都表示星期日
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], day: sets[2], month: sets[3], weekday: sets[4],
+		dayAny: strings.HasPrefix(parts[2], "*"), weekdayAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parse 解析一个字段，返回允许取值的位集合
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("%s字段的步长%q无效", f.name, stepText)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// 5/15表示从5开始每15个
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s字段的范围%q起点大于终点", f.name, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value 解析字段中的一个数字或名称
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s字段的值%q无效，应为%d-%d", f.name, s, f.min, f.max)
+	}
+	return n, nil
+}
+
+// next 返回after之后（不含after所在的分钟）下一次执行的时间，找不到时返回零值
+func (c *cronSchedule) next(after time.Time) time.Time {
+	if c.every > 0 {
+		return after.Truncate(time.Minute).Add(c.every)
+	}
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches 日期和星期都有限制时满足其一即可，与crontab的规则一致
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	day := c.day&(1<<uint(t.Day())) != 0
+	weekday := c.weekday&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.dayAny && c.weekdayAny:
+		return true
+	case c.dayAny:
+		return weekday
+	case c.weekdayAny:
+		return day
+	}
+	return day || weekday
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const diffMaxContext = 20 // diff_files上下文行数的上限
+
+// diffFilesTool 比较两个文件或文件与给定内容的工具定义
+var diffFilesTool = Tool{
+	Type:        "function",
+	Name:        "diff_files",
+	Cacheable:   true,
+	Description: "以unified diff格式比较两个文本文件，或比较文件与给定的内容（例如修改前确认改动、修改后核对结果）。行尾的\\r\\n与\\n视为相同，会自动识别GBK、UTF-16等编码。内容相同时返回\"没有差异\"。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path_a": map[string]interface{}{
+				"type":        "string",
+				"description": "原文件路径，作为diff中的---一侧",
+			},
+			"path_b": map[string]interface{}{
+				"type":        "string",
+				"description": "新文件路径，作为diff中的+++一侧，与content二选一",
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "与path_a比较的新内容，与path_b二选一",
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": "每处改动前后显示的行数，默认3",
+				"minimum":     0,
+				"maximum":     diffMaxContext,
+			},
+		},
+		"required": []string{"path_a"},
+	},
+}
+
+// readDiffText 读取文件并解码为文本，二进制文件返回错误
+func readDiffText(fullPath string) (string, []byte, error) {
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", nil, err
+	}
+	text, _, ok := decodeText(data)
+	if !ok {
+		return "", data, fmt.Errorf("%s是二进制文件", fullPath)
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n"), data, nil
+}
+
+// diffFiles 生成两个文件或文件与内容之间的unified diff
+func (a *ECNUAgent) diffFiles(args string) (string, error) {
+	var params struct {
+		PathA   string  `json:"path_a"`
+		PathB   string  `json:"path_b"`
+		Content *string `json:"content"`
+		Context int     `json:"context"`
+	}
+	params.Context = diffContext
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.PathA == "" {
+		return "", fmt.Errorf("缺少path_a参数")
+	}
+	if (params.PathB == "") == (params.Content == nil) {
+		return "", fmt.Errorf("path_b和content必须且只能指定一个")
+	}
+	params.Context = max(0, min(params.Context, diffMaxContext))
+
+	pathA := a.resolvePath(params.PathA)
+	oldText, oldData, err := readDiffText(pathA)
+	if err != nil && oldData == nil {
+		return fmt.Sprintf("比较失败: %v", err), nil
+	}
+
+	newName := "(给定内容)"
+	var newText string
+	if params.Content != nil {
+		if err != nil {
+			return fmt.Sprintf("比较失败: %v", err), nil
+		}
+		newText = strings.ReplaceAll(*params.Content, "\r\n", "\n")
+	} else {
+		newName = a.resolvePath(params.PathB)
+		text, newData, newErr := readDiffText(newName)
+		if newErr != nil && newData == nil {
+			return fmt.Sprintf("比较失败: %v", newErr), nil
+		}
+		// 二进制文件无法逐行比较，只说明是否相同
+		if err != nil || newErr != nil {
+			if bytes.Equal(oldData, newData) {
+				return fmt.Sprintf("没有差异: %s 与 %s 内容相同（二进制文件）", pathA, newName), nil
+			}
+			return fmt.Sprintf("二进制文件 %s 与 %s 不同，无法生成逐行差异，可使用compare_files查看第一个不同之处", pathA, newName), nil
+		}
+		newText = text
+	}
+	log.Printf("[比较差异] %s <-> %s\n", pathA, newName)
+
+	diff := unifiedDiffContext(pathA, newName, oldText, newText, params.Context)
+	if diff == "" {
+		if strings.TrimSuffix(oldText, "\n") == strings.TrimSuffix(newText, "\n") && oldText != newText {
+			return fmt.Sprintf("没有逐行差异: %s 与 %s 只有末尾换行符不同", pathA, newName), nil
+		}
+		return fmt.Sprintf("没有差异: %s 与 %s 内容相同", pathA, newName), nil
+	}
+
+	added, removed := 0, 0
+	for _, op := range diffLines(splitLines(oldText), splitLines(newText)) {
+		switch op.kind {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return fmt.Sprintf("共%d行新增、%d行删除:\n%s", added, removed, diff), nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const transferProgressInterval = 2 * time.Second // 输出下载和传输进度的间隔
+
+// downloadFileTool 下载文件的工具定义
+var downloadFileTool = Tool{
+	Type:       "function",
+	Name:       "download_file",
+	Sequential: true,
+	Description: "通过HTTP或HTTPS下载文件到本地，代替用execute_command调用wget或curl。下载中断或超时后再次调用会从断点继续；提供sha256时下载完成后校验，不一致则丢弃文件。" +
+		"覆盖已有文件前会请用户确认。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "下载地址，只支持http和https",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "保存路径，为目录或省略时使用URL中的文件名",
+			},
+			"sha256": map[string]interface{}{
+				"type":        "string",
+				"description": "期望的SHA256值（十六进制），用于校验下载的文件",
+			},
+		},
+		"required": []string{"url"},
+	},
+}
+
+// hostAllowed 判断域名是否在允许列表中，列表中的域名同时允许其子域名，列表为空时不限制
+func hostAllowed(host string, allow []string) bool {
+	if len(allow) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range allow {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "*."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDownloadURL 检查地址的协议和域名是否允许下载
+func (a *ECNUAgent) checkDownloadURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("只支持http和https地址，当前为%q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("地址中缺少域名")
+	}
+	if !hostAllowed(u.Hostname(), a.config.DownloadAllow) {
+		return fmt.Errorf("域名%s不在允许下载的列表中（--download-allow: %s）", u.Hostname(), strings.Join(a.config.DownloadAllow, ", "))
+	}
+	return nil
+}
+
+// downloadTarget 确定保存路径，path为空或为目录时使用URL中的文件名
+func (a *ECNUAgent) downloadTarget(u *url.URL, p string) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || name == "" {
+		name = "download"
+	}
+	if p == "" {
+		return a.resolvePath(name)
+	}
+	fullPath := a.resolvePath(p)
+	if strings.HasSuffix(p, "/") || strings.HasSuffix(p, `\`) {
+		return filepath.Join(fullPath, name)
+	}
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return filepath.Join(fullPath, name)
+	}
+	return fullPath
+}
+
+// transferProgress 记录下载或传输的进度并定期输出
+type transferProgress struct {
+	tag     string // 日志标签
+	name    string
+	done    int64 // 已下载的字节数，包含续传前已有的部分
+	total   int64 // 文件总大小，未知时为-1
+	start   time.Time
+	resumed int64 // 续传前已有的字节数
+	last    time.Time
+}
+
+// report 距上次输出超过间隔时输出进度，final为true时总是输出
+func (p *transferProgress) report(final bool) {
+	now := time.Now()
+	if !final && now.Sub(p.last) < transferProgressInterval {
+		return
+	}
+	p.last = now
+	speed := ""
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		speed = fmt.Sprintf(", %s/s", formatSize(int64(float64(p.done-p.resumed)/elapsed)))
+	}
+	if p.total > 0 {
+		log.Printf("[%s] %s: %s / %s (%d%%%s)\n", p.tag, p.name, formatSize(p.done), formatSize(p.total), p.done*100/p.total, speed)
+		return
+	}
+	log.Printf("[%s] %s: %s%s\n", p.tag, p.name, formatSize(p.done), speed)
+}
+
+// copyWithProgress 把响应内容写入文件并计算哈希，超过limit字节时返回错误
+func copyWithProgress(dst io.Writer, src io.Reader, h hash.Hash, progress *transferProgress, limit int64) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			progress.done += int64(n)
+			if limit > 0 && progress.done > limit {
+				return fmt.Errorf("文件超过大小上限%s", formatSize(limit))
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			h.Write(buf[:n])
+			progress.report(false)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// hashPartial 计算已下载部分的哈希，续传时在其基础上继续计算
+func hashPartial(partPath string) (hash.Hash, int64, error) {
+	h := sha256.New()
+	f, err := os.Open(partPath)
+	if os.IsNotExist(err) {
+		return h, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	n, err := io.Copy(h, f)
+	return h, n, err
+}
+
+// partMeta 与.part文件一起保存的下载信息，续传时用If-Range确认服务器上的文件没有变化
+type partMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// newPartMeta 从响应头中取出续传所需的校验信息，服务器没有提供时返回false
+func newPartMeta(u *url.URL, header http.Header) (partMeta, bool) {
+	m := partMeta{URL: u.String(), LastModified: header.Get("Last-Modified")}
+	// If-Range只能使用强校验的ETag
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		m.ETag = etag
+	}
+	return m, m.ifRange() != ""
+}
+
+// ifRange 返回续传请求中If-Range的值
+func (m partMeta) ifRange() string {
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// loadPartMeta 读取metaPath中保存的下载信息
+func loadPartMeta(metaPath string) (partMeta, bool) {
+	var m partMeta
+	data, err := os.ReadFile(metaPath)
+	if err != nil || json.Unmarshal(data, &m) != nil {
+		return partMeta{}, false
+	}
+	return m, m.ifRange() != ""
+}
+
+// removePartial 删除已下载的部分及其下载信息
+func removePartial(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + ".json")
+}
+
+// contentRangeStart 解析Content-Range响应头中的起始位置
+func contentRangeStart(value string) (int64, bool) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	first, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	return start, err == nil
+}
+
+// downloadFile 下载文件，支持断点续传和SHA256校验
+func (a *ECNUAgent) downloadFile(ctx context.Context, args string) (string, error) {
+	var params struct {
+		URL    string `json:"url"`
+		Path   string `json:"path"`
+		SHA256 string `json:"sha256"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.URL == "" {
+		return "", fmt.Errorf("缺少url参数")
+	}
+	expected := strings.ToLower(strings.TrimSpace(params.SHA256))
+	if expected != "" {
+		if b, err := hex.DecodeString(expected); err != nil || len(b) != sha256.Size {
+			return "", fmt.Errorf("sha256应为64位十六进制字符串")
+		}
+	}
+	u, err := url.Parse(strings.TrimSpace(params.URL))
+	if err != nil {
+		return "", fmt.Errorf("下载地址无效: %v", err)
+	}
+	if err := a.checkDownloadURL(u); err != nil {
+		return fmt.Sprintf("下载失败: %v", err), nil
+	}
+
+	fullPath := a.downloadTarget(u, params.Path)
+	partPath := fullPath + ".part"
+	log.Printf("[下载] %s -> %s\n", u.Redacted(), fullPath)
+
+	if info, err := os.Stat(fullPath); err == nil {
+		if info.IsDir() {
+			return fmt.Sprintf("下载失败: %s是目录", fullPath), nil
+		}
+		if expected != "" {
+			if sum, _, err := hashFile(fullPath, sha256.New); err == nil && sum == expected {
+				return fmt.Sprintf("%s 已存在且SHA256与期望值一致，无需重新下载", fullPath), nil
+			}
+		}
+		ok, err := a.confirm(ctx, approveWrite, fmt.Sprintf("\n下载 %s 将覆盖已有文件 %s（%s），是否覆盖？(y/N) ", u.Redacted(), fullPath, formatSize(info.Size())))
+		if err != nil {
+			return fmt.Sprintf("下载失败: 覆盖%s需要用户确认: %v", fullPath, err), nil
+		}
+		if !ok {
+			return fmt.Sprintf("用户拒绝覆盖文件 %s，未下载。请询问用户原因或换一种方式完成任务。", fullPath), nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Sprintf("下载失败: 创建目录失败: %v", err), nil
+	}
+
+	// 在工具时限之前结束，保留已下载的部分供下次续传
+	dlCtx := ctx
+	if limit := a.config.ToolTimeout; limit > 5 {
+		var cancel context.CancelFunc
+		dlCtx, cancel = context.WithTimeout(ctx, time.Duration(limit-5)*time.Second)
+		defer cancel()
+	}
+	limit := int64(a.config.DownloadMaxSize) * 1024 * 1024
+
+	// 已下载的部分只有来自同一地址、并且保存了校验信息时才续传，否则无法确认服务器上的文件没有变化
+	metaPath := partPath + ".json"
+	meta, resumable := loadPartMeta(metaPath)
+	if !resumable || meta.URL != u.String() {
+		removePartial(partPath)
+	}
+	h, offset, err := hashPartial(partPath)
+	if err != nil {
+		return fmt.Sprintf("下载失败: 读取已下载的部分失败: %v", err), nil
+	}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("重定向次数过多")
+		}
+		return a.checkDownloadURL(req.URL)
+	}}
+	start := time.Now()
+
+	var resp *http.Response
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	for {
+		req, err := http.NewRequestWithContext(dlCtx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", fmt.Errorf("下载地址无效: %v", err)
+		}
+		req.Header.Set("User-Agent", "chatecnu-agent")
+		if offset > 0 {
+			// 文件已变化时服务器返回完整的新文件
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", meta.ifRange())
+		}
+		if resp, err = client.Do(req); err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return fmt.Sprintf("下载失败: %v", err), nil
+		}
+		if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || offset == 0 {
+			break
+		}
+		resp.Body.Close()
+		if expected != "" && hex.EncodeToString(h.Sum(nil)) == expected {
+			// 已下载的部分就是完整文件
+			resp.Body, resp.ContentLength = io.NopCloser(strings.NewReader("")), 0
+			flags = os.O_WRONLY | os.O_APPEND
+			break
+		}
+		log.Printf("[下载] 服务器拒绝了续传范围，无法确认已下载的部分是否完整，重新下载\n")
+		removePartial(partPath)
+		h, offset = sha256.New(), 0
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case flags&os.O_APPEND != 0:
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if from, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || from != offset {
+			return fmt.Sprintf("下载失败: 服务器返回的续传范围（%s）与已下载的%d字节不符，请删除%s后重试", resp.Header.Get("Content-Range"), offset, partPath), nil
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		log.Printf("[下载] 从%s处继续下载\n", formatSize(offset))
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			log.Printf("[下载] 服务器上的文件已变化或不支持续传，重新下载\n")
+		}
+		h, offset = sha256.New(), 0
+		os.Remove(metaPath)
+		if meta, resumable = newPartMeta(u, resp.Header); resumable {
+			data, _ := json.Marshal(meta)
+			if os.WriteFile(metaPath, data, 0644) != nil {
+				resumable = false
+			}
+		}
+	default:
+		return fmt.Sprintf("下载失败: 服务器返回 %s", resp.Status), nil
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	if limit > 0 && total > limit {
+		return fmt.Sprintf("下载失败: 文件大小%s超过上限%s（--download-max-size）", formatSize(total), formatSize(limit)), nil
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Sprintf("下载失败: %v", err), nil
+	}
+	progress := &transferProgress{tag: "下载", name: filepath.Base(fullPath), done: offset, total: total, start: start, resumed: offset, last: start}
+	copyErr := copyWithProgress(f, resp.Body, h, progress, limit)
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if limit > 0 && progress.done > limit {
+			removePartial(partPath)
+			return fmt.Sprintf("下载失败: %v（--download-max-size）", copyErr), nil
+		}
+		reason := copyErr.Error()
+		if errors.Is(dlCtx.Err(), context.DeadlineExceeded) {
+			reason = "接近单个工具的时间限制"
+		}
+		return fmt.Sprintf("下载未完成: %s。已下载%s，保存在%s，%s", reason, formatSize(progress.done), partPath, resumeNote(resumable)), nil
+	}
+	if total > 0 && progress.done < total {
+		return fmt.Sprintf("下载未完成: 连接提前结束，已下载%s / %s，%s", formatSize(progress.done), formatSize(total), resumeNote(resumable)), nil
+	}
+	progress.report(true)
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expected != "" && sum != expected {
+		removePartial(partPath)
+		return fmt.Sprintf("下载失败: SHA256校验不一致，期望%s，实际%s，已删除下载的文件", expected, sum), nil
+	}
+
+	change, err := a.snapshotFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("下载失败: %v", err), nil
+	}
+	if err := os.Rename(partPath, fullPath); err != nil {
+		return fmt.Sprintf("下载失败: %v", err), nil
+	}
+	os.Remove(metaPath)
+	a.undo.record(change)
+	a.activity.addFile(fullPath)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "已下载 %s -> %s（%s，用时%s）\nSHA256: %s", u.Redacted(), fullPath, formatSize(progress.done), time.Since(start).Round(100*time.Millisecond), sum)
+	if expected != "" {
+		b.WriteString("（与期望值一致）")
+	}
+	if ct := resp.Header.Get("Content-Type"); strings.HasPrefix(ct, "text/html") && !strings.Contains(strings.ToLower(filepath.Ext(fullPath)), "htm") {
+		b.WriteString("\n注意: 服务器返回的是HTML页面，可能是登录页或错误页而不是所需的文件")
+	}
+	return b.String(), nil
+}
+
+// resumeNote 返回下载未完成时关于续传的说明
+func resumeNote(resumable bool) string {
+	if resumable {
+		return "再次调用download_file将从断点继续"
+	}
+	return "服务器没有提供ETag或Last-Modified，无法确认文件未变化，再次调用download_file将重新下载"
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// dryRunPassthrough 演练模式下仍然实际执行的工具，它们不会修改系统
+var dryRunPassthrough = map[string]bool{
+	"read_tool_output": true, "spawn_agent": true, "check_network": true,
+}
+
+// dryRunReadActions 按action区分读写的工具中只读的action，演练模式下照常执行
+var dryRunReadActions = map[string][]string{
+	"manage_processes": {"list", "details"},
+	"manage_service":   {"list", "status", "logs"},
+	"manage_packages":  {"search", "list"},
+	"git":              {"status", "diff", "log", "branches"},
+	"code_host":        {"list_issues", "get_issue", "list_prs", "get_pr", "pr_diff", "ci_status"},
+}
+
+// dryRunStep 演练模式下一次未实际执行的工具调用
+type dryRunStep struct {
+	name    string
+	preview string
+}
+
+// dryRunLog 记录本轮任务中演练模式拦截的工具调用，子智能体与主智能体共用
+type dryRunLog struct {
+	mu    sync.Mutex
+	steps []dryRunStep
+}
+
+// reset 清空记录
+func (d *dryRunLog) reset() {
+	d.mu.Lock()
+	d.steps = nil
+	d.mu.Unlock()
+}
+
+// add 记录一次调用
+func (d *dryRunLog) add(step dryRunStep) {
+	d.mu.Lock()
+	d.steps = append(d.steps, step)
+	d.mu.Unlock()
+}
+
+// snapshot 返回当前记录的副本
+func (d *dryRunLog) snapshot() []dryRunStep {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]dryRunStep(nil), d.steps...)
+}
+
+// dryRunExecutes 判断演练模式下工具是否仍然实际执行，只读工具照常执行以便模型了解系统的真实状态
+func (a *ECNUAgent) dryRunExecutes(name, args string) bool {
+	if dryRunPassthrough[name] {
+		return true
+	}
+	if actions, ok := dryRunReadActions[name]; ok {
+		var params struct {
+			Action string `json:"action"`
+		}
+		return json.Unmarshal([]byte(args), &params) == nil && slices.Contains(actions, params.Action)
+	}
+	for _, tool := range a.tools {
+		if tool.Name == name {
+			return tool.Cacheable
+		}
+	}
+	return false
+}
+
+// simulateToolCall 记录演练模式下未执行的工具调用，返回给模型的模拟结果
+func (a *ECNUAgent) simulateToolCall(call openai.ToolCall) string {
+	preview := toolPreview(call, false)
+	if call.Function.Name == "execute_command" {
+		preview += a.dryRunPolicyNote(call.Function.Arguments)
+	}
+	log.Printf("[演练] 未执行 %s\n", call.Function.Name)
+	a.dryRun.add(dryRunStep{name: call.Function.Name, preview: preview})
+	return fmt.Sprintf("（演练模式）%s没有实际执行，将会执行的操作:\n%s请假设该操作按预期成功完成，继续规划之后的步骤；依赖其输出的步骤请说明将如何根据实际结果处理。", call.Function.Name, preview)
+}
+
+// dryRunPolicyNote 说明命令在实际运行时会被命令策略如何处理，直接执行时为空
+func (a *ECNUAgent) dryRunPolicyNote(args string) string {
+	var params struct {
+		Command string `json:"command"`
+	}
+	if a.policy == nil || json.Unmarshal([]byte(args), &params) != nil {
+		return ""
+	}
+	d := a.policy.evaluate(params.Command)
+	reason := ""
+	if d.rule != nil {
+		reason = "：" + d.rule.String()
+	}
+	switch d.action {
+	case policyDeny:
+		return fmt.Sprintf("  (实际运行时会被命令策略拒绝%s)\n", reason)
+	case policyAsk:
+		return fmt.Sprintf("  (实际运行时需要用户确认%s)\n", reason)
+	}
+	return ""
+}
+
+// printDryRunReport 在任务结束时列出演练模式下所有未执行的操作
+func (a *ECNUAgent) printDryRunReport() {
+	steps := a.dryRun.snapshot()
+	if len(steps) == 0 {
+		fmt.Fprintf(a.console, "\n[演练] 本轮任务没有需要执行的修改操作\n")
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n[演练] 本轮任务中将会执行的操作（共%d项，均未实际执行）:\n", len(steps))
+	for i, step := range steps {
+		fmt.Fprintf(&b, "%d. %s\n%s", i+1, step.name, step.preview)
+	}
+	fmt.Fprint(a.console, b.String())
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// editFileTool 按行号替换或插入文件内容的工具定义
+var editFileTool = Tool{
+	Type:        "function",
+	Name:        "edit_file",
+	Sequential:  true,
+	Description: "按行号修改已存在的文件：替换start_line到end_line之间的行，或在start_line之前插入内容，返回修改前后的差异。修改大文件时应优先使用此工具而不是用write_file重写整个文件，行号以最近一次读取的文件内容为准。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要修改的文件路径（绝对路径或相对路径）",
+			},
+			"start_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "起始行号（从1开始）。插入时内容放在该行之前，等于总行数+1时追加到末尾",
+				"minimum":     1,
+			},
+			"end_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "替换的结束行号（包含），默认等于start_line，插入时忽略",
+				"minimum":     1,
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "新的内容，可以包含多行；替换时为空表示删除这些行",
+			},
+			"insert": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否为插入模式，默认false（替换）",
+				"default":     false,
+			},
+		},
+		"required": []string{"path", "start_line", "content"},
+	},
+}
+
+// searchReplaceTool 在文件中查找并替换文本的工具定义
+var searchReplaceTool = Tool{
+	Type:        "function",
+	Name:        "search_replace",
+	Sequential:  true,
+	Description: "在文件中查找并替换文本，支持精确字符串和正则表达式，返回修改前后的差异。默认要求恰好找到一处匹配，避免误改其他位置；需要替换全部匹配时设置all为true。search应包含足够的上下文以唯一确定要修改的位置。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要修改的文件路径（绝对路径或相对路径）",
+			},
+			"search": map[string]interface{}{
+				"type":        "string",
+				"description": "要查找的文本，regex为true时为Go正则表达式",
+			},
+			"replace": map[string]interface{}{
+				"type":        "string",
+				"description": "替换后的文本，正则模式下可用$1、${name}引用分组",
+			},
+			"regex": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否按正则表达式匹配，默认false（精确匹配）",
+				"default":     false,
+			},
+			"all": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否替换全部匹配，默认false（只允许一处匹配）",
+				"default":     false,
+			},
+			"expected_count": map[string]interface{}{
+				"type":        "integer",
+				"description": "预期的匹配数量，实际数量不一致时不做任何修改",
+				"minimum":     1,
+			},
+		},
+		"required": []string{"path", "search", "replace"},
+	},
+}
+
+// editFile 替换或插入文件中指定行范围的内容，保留原文件的换行风格和权限
+func (a *ECNUAgent) editFile(args string) (string, error) {
+	var params struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+		Content   string `json:"content"`
+		Insert    bool   `json:"insert"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("修改文件失败: %v", err), nil
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("修改文件失败: %v", err), nil
+	}
+	original, encoding, ok := decodeText(data)
+	if !ok {
+		return fmt.Sprintf("修改文件失败: %s 是二进制文件", fullPath), nil
+	}
+
+	newline := "\n"
+	if strings.Contains(original, "\r\n") {
+		newline = "\r\n"
+	}
+	text := strings.ReplaceAll(original, "\r\n", "\n")
+	lines := splitLines(text)
+	trailingNewline := text == "" || strings.HasSuffix(text, "\n")
+
+	start, end := params.StartLine, params.EndLine
+	if params.Insert {
+		if start < 1 || start > len(lines)+1 {
+			return fmt.Sprintf("修改文件失败: 插入位置%d超出范围，文件共%d行，可用范围为1-%d", start, len(lines), len(lines)+1), nil
+		}
+		end = start - 1
+	} else {
+		if end == 0 {
+			end = start
+		}
+		if start < 1 || end < start || end > len(lines) {
+			return fmt.Sprintf("修改文件失败: 行范围%d-%d无效，文件共%d行", start, end, len(lines)), nil
+		}
+	}
+
+	log.Printf("[修改文件] %s (第%d-%d行, 插入: %v)\n", fullPath, start, end, params.Insert)
+
+	replacement := splitLines(strings.ReplaceAll(params.Content, "\r\n", "\n"))
+	edited := make([]string, 0, len(lines)-(end-start+1)+len(replacement))
+	edited = append(edited, lines[:start-1]...)
+	edited = append(edited, replacement...)
+	edited = append(edited, lines[end:]...)
+
+	result := strings.Join(edited, "\n")
+	if trailingNewline && len(edited) > 0 {
+		result += "\n"
+	}
+	if newline != "\n" {
+		result = strings.ReplaceAll(result, "\n", newline)
+	}
+
+	return a.saveEdit(fullPath, info.Mode(), encoding, original, result)
+}
+
+// saveEdit 按文件原来的编码写回修改后的内容，返回说明和修改前后的差异
+func (a *ECNUAgent) saveEdit(fullPath string, mode os.FileMode, encoding textEncoding, original, result string) (string, error) {
+	data, err := encoding.encode(result)
+	if err != nil {
+		return fmt.Sprintf("修改文件失败: %v", err), nil
+	}
+	change, err := a.snapshotFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("修改文件失败: %v", err), nil
+	}
+	if err := writeFileAtomic(fullPath, data, mode.Perm()); err != nil {
+		return "", fmt.Errorf("写入文件失败: %v", err)
+	}
+	a.undo.record(change)
+	a.activity.addFile(fullPath)
+
+	result = strings.ReplaceAll(result, "\r\n", "\n")
+	diff := unifiedDiff(fullPath, fullPath, strings.ReplaceAll(original, "\r\n", "\n"), result)
+	if diff == "" {
+		return fmt.Sprintf("文件内容没有变化: %s", fullPath), nil
+	}
+	return fmt.Sprintf("成功修改文件: %s（现共%d行）\n%s", fullPath, len(splitLines(result)), diff), nil
+}
+
+// searchReplace 查找并替换文件中的文本，匹配数量不符合要求时不修改文件
+func (a *ECNUAgent) searchReplace(args string) (string, error) {
+	var params struct {
+		Path          string `json:"path"`
+		Search        string `json:"search"`
+		Replace       string `json:"replace"`
+		Regex         bool   `json:"regex"`
+		All           bool   `json:"all"`
+		ExpectedCount int    `json:"expected_count"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	if params.Search == "" {
+		return "", fmt.Errorf("search参数不能为空")
+	}
+
+	var re *regexp.Regexp
+	if params.Regex {
+		var err error
+		if re, err = regexp.Compile(params.Search); err != nil {
+			return fmt.Sprintf("替换失败: 正则表达式无效: %v", err), nil
+		}
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("替换失败: %v", err), nil
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("替换失败: %v", err), nil
+	}
+	original, encoding, ok := decodeText(data)
+	if !ok {
+		return fmt.Sprintf("替换失败: %s 是二进制文件", fullPath), nil
+	}
+
+	// matches为每处匹配的起止位置
+	var matches [][]int
+	if re != nil {
+		matches = re.FindAllStringSubmatchIndex(original, -1)
+	} else {
+		for offset := 0; ; {
+			i := strings.Index(original[offset:], params.Search)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			matches = append(matches, []int{start, start + len(params.Search)})
+			offset = start + len(params.Search)
+		}
+	}
+
+	log.Printf("[查找替换] %s (正则: %v, 全部: %v, 匹配: %d处)\n", fullPath, params.Regex, params.All, len(matches))
+
+	switch {
+	case len(matches) == 0:
+		return fmt.Sprintf("替换失败: 在%s中没有找到匹配的内容，请先读取文件确认准确的文本（包括缩进和空白）", fullPath), nil
+	case params.ExpectedCount > 0 && len(matches) != params.ExpectedCount:
+		return fmt.Sprintf("替换失败: 预期%d处匹配，实际找到%d处（位于第%s行），文件未修改", params.ExpectedCount, len(matches), matchLines(original, matches)), nil
+	case !params.All && params.ExpectedCount == 0 && len(matches) > 1:
+		return fmt.Sprintf("替换失败: 找到%d处匹配（位于第%s行），请在search中包含更多上下文以唯一确定位置，或设置all为true替换全部", len(matches), matchLines(original, matches)), nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(original[last:m[0]])
+		if re != nil {
+			b.Write(re.ExpandString(nil, params.Replace, original, m))
+		} else {
+			b.WriteString(params.Replace)
+		}
+		last = m[1]
+	}
+	b.WriteString(original[last:])
+
+	return a.saveEdit(fullPath, info.Mode(), encoding, original, b.String())
+}
+
+// matchLines 返回各处匹配所在的行号，以逗号分隔
+func matchLines(text string, matches [][]int) string {
+	lines := make([]string, 0, len(matches))
+	for _, m := range matches {
+		lines = append(lines, fmt.Sprint(strings.Count(text[:m[0]], "\n")+1))
+	}
+	return strings.Join(lines, ",")
+}
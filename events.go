@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 单次运行的输出格式
+const (
+	outputText  = "text"  // 只输出最终回答
+	outputJSON  = "json"  // 结束时输出一个包含结果和全部事件的JSON对象
+	outputJSONL = "jsonl" // 每个事件发生时输出一行JSON，最后一行为结果
+)
+
+// outputFormats --output可用的格式
+var outputFormats = []string{outputText, outputJSON, outputJSONL}
+
+// 事件类型
+const (
+	eventStart      = "start"
+	eventStep       = "step"
+	eventAssistant  = "assistant"
+	eventToolCall   = "tool_call"
+	eventToolResult = "tool_result"
+	eventResult     = "result"
+)
+
+// agentEvent 结构化输出中的一个事件，不同类型的事件只填写相关的字段
+type agentEvent struct {
+	Type      string          `json:"type"`
+	Time      time.Time       `json:"time"`
+	Step      int             `json:"step,omitempty"`
+	Task      string          `json:"task,omitempty"`
+	Model     string          `json:"model,omitempty"`
+	ID        string          `json:"id,omitempty"` // 工具调用ID
+	Name      string          `json:"name,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	OK        *bool           `json:"ok,omitempty"`
+	Content   string          `json:"content,omitempty"`
+
+	// 以下字段只用于结果
+	Status     string        `json:"status,omitempty"`
+	ExitCode   *int          `json:"exit_code,omitempty"`
+	Answer     string        `json:"answer,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Usage      *eventUsage   `json:"usage,omitempty"`
+	DurationMS int64         `json:"duration_ms,omitempty"`
+	Events     []*agentEvent `json:"events,omitempty"` // json格式下结果中包含的全部事件
+}
+
+// eventUsage 结果中的用量
+type eventUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost,omitempty"`
+}
+
+// eventWriter 把事件写入标准输出，jsonl格式下立即写入，json格式下在结束时连同结果一起写入
+//
+// 工具调用并发执行，写入需要加锁。
+type eventWriter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	stream bool
+	events []*agentEvent
+}
+
+// newEventWriter 创建按format写入w的事件输出，format为text时返回nil
+func newEventWriter(w io.Writer, format string) *eventWriter {
+	if format != outputJSON && format != outputJSONL {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if format == outputJSON {
+		enc.SetIndent("", "  ")
+	}
+	return &eventWriter{enc: enc, stream: format == outputJSONL}
+}
+
+// emit 记录一个事件
+func (w *eventWriter) emit(ev *agentEvent) {
+	if w == nil {
+		return
+	}
+	ev.Time = time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stream {
+		w.enc.Encode(ev)
+		return
+	}
+	w.events = append(w.events, ev)
+}
+
+// finish 写入结果，json格式下结果中包含此前的全部事件
+func (w *eventWriter) finish(result *agentEvent) {
+	if w == nil {
+		return
+	}
+	result.Type = eventResult
+	result.Time = time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stream {
+		result.Events = w.events
+	}
+	w.enc.Encode(result)
+}
+
+// toolCall 记录即将执行的工具调用
+func (w *eventWriter) toolCall(step int, call openai.ToolCall) {
+	if w == nil {
+		return
+	}
+	w.emit(&agentEvent{Type: eventToolCall, Step: step, ID: call.ID, Name: call.Function.Name, Arguments: rawArguments(call.Function.Arguments)})
+}
+
+// toolResult 记录工具调用的结果
+func (w *eventWriter) toolResult(step int, call openai.ToolCall, result string, ok bool) {
+	if w == nil {
+		return
+	}
+	w.emit(&agentEvent{Type: eventToolResult, Step: step, ID: call.ID, Name: call.Function.Name, OK: &ok, Content: result})
+}
+
+// rawArguments 返回可以直接嵌入事件的工具参数，不是合法JSON时作为字符串嵌入
+func rawArguments(args string) json.RawMessage {
+	if json.Valid([]byte(args)) {
+		return json.RawMessage(args)
+	}
+	data, _ := json.Marshal(args)
+	return data
+}
+
+// newEventUsage 转换用量统计
+func newEventUsage(s usageStats) *eventUsage {
+	return &eventUsage{
+		Requests:         s.Requests,
+		PromptTokens:     s.PromptTokens,
+		CompletionTokens: s.CompletionTokens,
+		TotalTokens:      s.total(),
+		Cost:             s.Cost,
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup 让命令在独立进程组中运行，取消时连同子进程一起终止
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// setCommandLine 只在Windows上需要原样传递命令行
+func setCommandLine(cmd *exec.Cmd, line string) {}
+
+// maxRSS 返回进程及其已等待的子进程中最大的常驻内存（字节）
+func maxRSS(state *os.ProcessState) (int64, bool) {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || usage.Maxrss == 0 {
+		return 0, false
+	}
+	// macOS以字节为单位，其他系统以KB为单位
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss), true
+	}
+	return int64(usage.Maxrss) * 1024, true
+}
+
+// resourceLimits 返回在命令之前设置资源限制的ulimit前缀和结果中显示的说明，未配置限制时都为空
+//
+// 限制由sh设置后被命令及其子进程继承；无法设置时命令不会执行。
+func resourceLimits(cfg *Config) (prefix, desc string) {
+	var cmds, parts []string
+	if cfg.CommandCPU > 0 {
+		cmds = append(cmds, fmt.Sprintf("ulimit -t %d", cfg.CommandCPU))
+		parts = append(parts, fmt.Sprintf("cpu %ds", cfg.CommandCPU))
+	}
+	if cfg.CommandMemory > 0 {
+		// -v以KB为单位
+		cmds = append(cmds, fmt.Sprintf("ulimit -v %d", cfg.CommandMemory*1024))
+		parts = append(parts, fmt.Sprintf("memory %dMB", cfg.CommandMemory))
+	}
+	if cfg.CommandFileSize > 0 {
+		// POSIX sh中-f以512字节的块为单位
+		cmds = append(cmds, fmt.Sprintf("ulimit -f %d", cfg.CommandFileSize*2048))
+		parts = append(parts, fmt.Sprintf("file %dMB", cfg.CommandFileSize))
+	}
+	if len(cmds) == 0 {
+		return "", ""
+	}
+	prefix = strings.Join(cmds, " && ") + ` || { echo "无法设置资源限制" >&2; exit 126; }; `
+	return prefix, strings.Join(parts, ", ")
+}
+
+// limitExceeded 根据命令的退出方式判断是否因超过CPU时间或文件大小上限而被系统结束
+func limitExceeded(cfg *Config, state *os.ProcessState) string {
+	sig := syscall.Signal(-1)
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		sig = status.Signal()
+	} else if code := state.ExitCode(); code > 128 {
+		// 被信号结束的子进程由sh以128+信号值的退出码报告
+		sig = syscall.Signal(code - 128)
+	}
+	// 软限制和硬限制相同，Linux上超出时可能直接以SIGKILL结束
+	cpuKilled := sig == syscall.SIGKILL && state.UserTime()+state.SystemTime() >= time.Duration(cfg.CommandCPU)*time.Second
+	switch {
+	case sig == syscall.SIGXCPU || cpuKilled:
+		if cfg.CommandCPU > 0 {
+			return "超过CPU时间上限，命令已被系统终止"
+		}
+	case sig == syscall.SIGXFSZ:
+		if cfg.CommandFileSize > 0 {
+			return "写入的文件超过大小上限，命令已被系统终止"
+		}
+	}
+	return ""
+}
+
+// processSignals manage_processes可以发送的信号
+var processSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM, "KILL": syscall.SIGKILL, "INT": syscall.SIGINT, "HUP": syscall.SIGHUP, "QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1, "USR2": syscall.SIGUSR2, "STOP": syscall.SIGSTOP, "CONT": syscall.SIGCONT,
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 取消时用taskkill结束命令及其启动的所有子进程，失败时只结束命令本身
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
+
+// setCommandLine 原样使用line作为进程的命令行，不再按参数转义
+func setCommandLine(cmd *exec.Cmd, line string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = line
+}
+
+// maxRSS 在Windows上无法在进程结束后获取内存峰值
+func maxRSS(state *os.ProcessState) (int64, bool) {
+	return 0, false
+}
+
+// resourceLimits 在Windows上不支持ulimit，不设置资源限制
+func resourceLimits(cfg *Config) (prefix, desc string) {
+	return "", ""
+}
+
+// limitExceeded 在Windows上没有因资源限制结束的信号
+func limitExceeded(cfg *Config, state *os.ProcessState) string {
+	return ""
+}
+
+// processSignals Windows上只能强制结束进程
+var processSignals = map[string]os.Signal{
+	"KILL": os.Kill,
+}
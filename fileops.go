@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// moveFileTool 移动或重命名文件的工具定义
+var moveFileTool = Tool{
+	Type:        "function",
+	Name:        "move_file",
+	Sequential:  true,
+	Description: "移动或重命名文件或目录。目标是已存在的目录时移入该目录；目标文件已存在时默认拒绝，设置overwrite为true时经用户确认后先把原文件移入回收站再覆盖。只能操作工作区内的路径。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "源路径",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "目标路径或目标目录",
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "目标已存在时是否覆盖，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"source", "destination"},
+	},
+}
+
+// copyFileTool 复制文件的工具定义
+var copyFileTool = Tool{
+	Type:        "function",
+	Name:        "copy_file",
+	Sequential:  true,
+	Description: "复制文件或目录，保留文件权限。复制目录时需要设置recursive为true；目标是已存在的目录时复制到该目录中；目标文件已存在时默认拒绝，设置overwrite为true时经用户确认后覆盖。只能操作工作区内的路径。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "源路径",
+			},
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"description": "目标路径或目标目录",
+			},
+			"recursive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否递归复制目录，默认false",
+				"default":     false,
+			},
+			"overwrite": map[string]interface{}{
+				"type":        "boolean",
+				"description": "目标已存在时是否覆盖，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"source", "destination"},
+	},
+}
+
+// deleteFileTool 删除文件的工具定义
+var deleteFileTool = Tool{
+	Type:        "function",
+	Name:        "delete_file",
+	Sequential:  true,
+	Description: "删除文件或目录，删除前会询问用户确认。删除的内容会移入本次会话的回收站而不是直接删除，结果中会给出回收站中的位置，需要时可以用move_file恢复。删除非空目录需要设置recursive为true。只能操作工作区内的路径。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要删除的文件或目录",
+			},
+			"recursive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否删除非空目录，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// defaultTrashRoot 返回回收站的根目录
+func defaultTrashRoot() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "trash")
+}
+
+// trashEntry 回收站索引中的一条记录
+type trashEntry struct {
+	Original  string    `json:"original"`
+	Trashed   string    `json:"trashed"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trashBin 本次会话的回收站，删除和被覆盖的文件都移到这里
+type trashBin struct {
+	mu  sync.Mutex
+	dir string
+	seq int
+}
+
+// newTrashBin 创建回收站，目录在第一次使用时才创建
+func newTrashBin(id string) *trashBin {
+	root := defaultTrashRoot()
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "ecnu-agent-trash")
+	}
+	return &trashBin{dir: filepath.Join(root, id)}
+}
+
+// put 把路径移入回收站并记录到索引，返回回收站中的位置
+func (t *trashBin) put(path string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return "", fmt.Errorf("创建回收站失败: %v", err)
+	}
+	t.seq++
+	trashed := filepath.Join(t.dir, fmt.Sprintf("%03d-%s", t.seq, filepath.Base(path)))
+	if err := movePath(path, trashed); err != nil {
+		return "", err
+	}
+
+	entry, _ := json.Marshal(trashEntry{Original: path, Trashed: trashed, DeletedAt: time.Now()})
+	if f, err := os.OpenFile(filepath.Join(t.dir, "index.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600); err == nil {
+		f.Write(append(entry, '\n'))
+		f.Close()
+	}
+	return trashed, nil
+}
+
+// checkWorkspace 确认路径（解析符号链接后）位于工作区或回收站内，启用--allow-outside-workspace时不检查
+func (a *ECNUAgent) checkWorkspace(path string) error {
+	if a.config.AllowOutside || withinDir(a.trash.dir, filepath.Clean(path)) {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(a.workingDir)
+	if err != nil {
+		root = a.workingDir
+	}
+	resolved := resolveExisting(path)
+	if !withinDir(root, resolved) {
+		if a.config.WorkspaceOnly {
+			return fmt.Errorf("%s 位于工作区 %s 之外，--workspace-only模式下只能访问工作区内的路径", path, a.workingDir)
+		}
+		return fmt.Errorf("%s 位于工作区 %s 之外，如确需操作请使用 --allow-outside-workspace 启动", path, a.workingDir)
+	}
+	return nil
+}
+
+// resolveExisting 解析路径中已存在部分的符号链接，不存在的部分原样拼接
+func resolveExisting(path string) string {
+	var rest []string
+	for p := path; ; p = filepath.Dir(p) {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if filepath.Dir(p) == p {
+			return path
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+	}
+}
+
+// withinDir 判断路径是否等于root或位于root之下
+func withinDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileOpParams move_file、copy_file、delete_file的参数
+type fileOpParams struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	Recursive   bool   `json:"recursive"`
+	Overwrite   bool   `json:"overwrite"`
+}
+
+// prepareTransfer 解析并检查移动或复制的源和目标，目标为已存在的目录时放入该目录
+func (a *ECNUAgent) prepareTransfer(args string) (params fileOpParams, src, dst string, srcInfo os.FileInfo, err error) {
+	if err = json.Unmarshal([]byte(args), &params); err != nil {
+		return params, "", "", nil, fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Source == "" || params.Destination == "" {
+		return params, "", "", nil, fmt.Errorf("缺少source或destination参数")
+	}
+	src, dst = a.resolvePath(params.Source), a.resolvePath(params.Destination)
+	for _, p := range []string{src, dst} {
+		if err = a.checkWorkspace(p); err != nil {
+			return
+		}
+	}
+	if srcInfo, err = os.Lstat(src); err != nil {
+		return
+	}
+	if info, statErr := os.Stat(dst); statErr == nil && info.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+	if src == dst {
+		err = fmt.Errorf("源和目标是同一个路径")
+		return
+	}
+	if srcInfo.IsDir() && withinDir(src, dst) {
+		err = fmt.Errorf("不能把目录%s放到它自己的子目录中", src)
+	}
+	return
+}
+
+// replaceExisting 目标已存在时按overwrite决定拒绝，或经用户确认后把原目标移入回收站，返回结果说明和回收站中的位置
+func (a *ECNUAgent) replaceExisting(ctx context.Context, dst string, overwrite bool) (note, trashed string, err error) {
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return "", "", nil
+	}
+	if !overwrite {
+		return "", "", fmt.Errorf("目标%s已存在，如需覆盖请设置overwrite为true", dst)
+	}
+	ok, err := a.confirmRemove(ctx, approveWrite, "覆盖", dst, info)
+	if err != nil {
+		return "", "", fmt.Errorf("覆盖%s需要用户确认: %v", dst, err)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("用户拒绝覆盖%s，没有修改任何文件。请询问用户原因或换一种方式完成任务", dst)
+	}
+	if trashed, err = a.trash.put(dst); err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("，原有的%s已移入回收站: %s", dst, trashed), trashed, nil
+}
+
+// moveFile 移动或重命名文件
+func (a *ECNUAgent) moveFile(ctx context.Context, args string) (string, error) {
+	params, src, dst, _, err := a.prepareTransfer(args)
+	if err != nil {
+		return fmt.Sprintf("移动失败: %v", err), nil
+	}
+	log.Printf("[移动文件] %s -> %s\n", src, dst)
+
+	note, replaced, err := a.replaceExisting(ctx, dst, params.Overwrite)
+	if err != nil {
+		return fmt.Sprintf("移动失败: %v", err), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := movePath(src, dst); err != nil {
+		return fmt.Sprintf("移动失败: %v", err), nil
+	}
+	a.undo.record(fileChange{op: "move", path: dst, source: src, replaced: replaced})
+	a.activity.addFile(src)
+	a.activity.addFile(dst)
+	return fmt.Sprintf("已将%s移动到%s%s", src, dst, note), nil
+}
+
+// copyFile 复制文件或目录
+func (a *ECNUAgent) copyFile(ctx context.Context, args string) (string, error) {
+	params, src, dst, info, err := a.prepareTransfer(args)
+	if err != nil {
+		return fmt.Sprintf("复制失败: %v", err), nil
+	}
+	if info.IsDir() && !params.Recursive {
+		return fmt.Sprintf("复制失败: %s是目录，复制目录需要设置recursive为true", src), nil
+	}
+	log.Printf("[复制文件] %s -> %s\n", src, dst)
+
+	note, replaced, err := a.replaceExisting(ctx, dst, params.Overwrite)
+	if err != nil {
+		return fmt.Sprintf("复制失败: %v", err), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %v", err)
+	}
+	files, err := copyPath(src, dst)
+	if err != nil {
+		return fmt.Sprintf("复制失败: %v", err), nil
+	}
+	a.undo.record(fileChange{op: "copy", path: dst, replaced: replaced})
+	a.activity.addFile(dst)
+	if info.IsDir() {
+		return fmt.Sprintf("已将目录%s复制到%s（共%d个文件）%s", src, dst, files, note), nil
+	}
+	return fmt.Sprintf("已将%s复制到%s%s", src, dst, note), nil
+}
+
+// deleteFile 经用户确认后把文件或目录移入回收站
+func (a *ECNUAgent) deleteFile(ctx context.Context, args string) (string, error) {
+	var params fileOpParams
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	if err := a.checkWorkspace(fullPath); err != nil {
+		return fmt.Sprintf("删除失败: %v", err), nil
+	}
+	if fullPath == a.workingDir {
+		return "删除失败: 不能删除工作区根目录", nil
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("删除失败: %v", err), nil
+	}
+	if info.IsDir() && !params.Recursive {
+		if entries, err := os.ReadDir(fullPath); err == nil && len(entries) > 0 {
+			return fmt.Sprintf("删除失败: %s是非空目录（%d项），删除非空目录需要设置recursive为true", fullPath, len(entries)), nil
+		}
+	}
+	ok, err := a.confirmRemove(ctx, approveDelete, "删除", fullPath, info)
+	if err != nil {
+		return fmt.Sprintf("删除失败: 删除%s需要用户确认: %v", fullPath, err), nil
+	}
+	if !ok {
+		return fmt.Sprintf("用户拒绝删除 %s，文件未修改。请询问用户原因或换一种方式完成任务。", fullPath), nil
+	}
+	log.Printf("[删除文件] %s\n", fullPath)
+
+	trashed, err := a.trash.put(fullPath)
+	if err != nil {
+		return fmt.Sprintf("删除失败: %v", err), nil
+	}
+	a.undo.record(fileChange{op: "delete", path: fullPath, backup: trashed})
+	a.activity.addFile(fullPath)
+	return fmt.Sprintf("已删除%s，内容已移入回收站: %s", fullPath, trashed), nil
+}
+
+// movePath 重命名路径，跨文件系统时先复制再删除源
+func movePath(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+	if _, err := copyPath(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath 递归复制文件、目录和符号链接并保留权限，返回复制的文件数
+func copyPath(src, dst string) (int, error) {
+	files := 0
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			files++
+			return copyRegularFile(p, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("不支持复制特殊文件%s", p)
+		}
+	})
+	return files, err
+}
+
+// copyRegularFile 复制单个普通文件
+func copyRegularFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	findDefaultDepth   = 20  // find_files默认的最大搜索深度
+	findDefaultResults = 200 // find_files默认的最大结果数
+)
+
+// errStopWalk 达到结果上限时提前结束遍历
+var errStopWalk = errors.New("stop walk")
+
+// skippedDirs 默认不进入的目录，通常体积很大且与任务无关
+var skippedDirs = map[string]bool{
+	".git": true, ".hg": true, ".svn": true, "node_modules": true, "__pycache__": true, ".venv": true,
+}
+
+// findFilesTool 按名称、glob、大小和修改时间查找文件的工具定义
+var findFilesTool = Tool{
+	Type:        "function",
+	Name:        "find_files",
+	Cacheable:   true,
+	Description: "在目录中递归查找文件，可按glob模式（如**/*.go）、名称子串、类型、大小和修改时间过滤。比拼接find命令更可靠，默认跳过隐藏文件以及.git、node_modules等目录。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "搜索的起始目录，默认为当前工作目录",
+				"default":     ".",
+			},
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "相对起始目录的glob模式，**匹配任意层目录，如**/*.go、src/**/test_*.py；不含/时只匹配文件名，如*.log",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "文件名包含的子串（不区分大小写）",
+			},
+			"type": map[string]interface{}{
+				"type":        "string",
+				"description": "结果类型，默认file",
+				"enum":        []string{"file", "dir", "any"},
+				"default":     "file",
+			},
+			"min_size": map[string]interface{}{
+				"type":        "integer",
+				"description": "最小文件大小（字节）",
+				"minimum":     0,
+			},
+			"max_size": map[string]interface{}{
+				"type":        "integer",
+				"description": "最大文件大小（字节）",
+				"minimum":     0,
+			},
+			"modified_within": map[string]interface{}{
+				"type":        "string",
+				"description": "只返回在该时间内修改过的文件，如30m、2h、7d",
+			},
+			"modified_before": map[string]interface{}{
+				"type":        "string",
+				"description": "只返回在该时间之前修改的文件，如30d表示30天以前",
+			},
+			"max_depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "最大搜索深度，起始目录下的直接子项深度为1，默认20",
+				"minimum":     1,
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "最多返回的结果数，默认200",
+				"minimum":     1,
+			},
+			"include_hidden": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否包含隐藏文件和默认跳过的目录，默认false",
+				"default":     false,
+			},
+		},
+	},
+}
+
+// findParams find_files的参数
+type findParams struct {
+	Path           string `json:"path"`
+	Pattern        string `json:"pattern"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	MinSize        int64  `json:"min_size"`
+	MaxSize        int64  `json:"max_size"`
+	ModifiedWithin string `json:"modified_within"`
+	ModifiedBefore string `json:"modified_before"`
+	MaxDepth       int    `json:"max_depth"`
+	MaxResults     int    `json:"max_results"`
+	IncludeHidden  bool   `json:"include_hidden"`
+}
+
+// findFiles 递归查找符合条件的文件
+func (a *ECNUAgent) findFiles(args string) (string, error) {
+	params := findParams{Path: ".", Type: "file", MaxDepth: findDefaultDepth, MaxResults: findDefaultResults}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+	if params.Pattern != "" {
+		if _, err := path.Match(strings.ReplaceAll(params.Pattern, "**", "*"), ""); err != nil {
+			return fmt.Sprintf("查找失败: glob模式无效: %v", err), nil
+		}
+	}
+
+	now := time.Now()
+	var newerThan, olderThan time.Time
+	if params.ModifiedWithin != "" {
+		d, err := parseAge(params.ModifiedWithin)
+		if err != nil {
+			return fmt.Sprintf("查找失败: %v", err), nil
+		}
+		newerThan = now.Add(-d)
+	}
+	if params.ModifiedBefore != "" {
+		d, err := parseAge(params.ModifiedBefore)
+		if err != nil {
+			return fmt.Sprintf("查找失败: %v", err), nil
+		}
+		olderThan = now.Add(-d)
+	}
+
+	root := a.resolvePath(params.Path)
+	log.Printf("[查找文件] %s (模式: %q, 名称: %q)\n", root, params.Pattern, params.Name)
+	if err := checkDirExists(root); err != nil {
+		return fmt.Sprintf("查找失败: %v", err), nil
+	}
+
+	var results []string
+	truncated := false
+	name := strings.ToLower(params.Name)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 无权限等错误只跳过该项
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		depth := strings.Count(rel, "/") + 1
+
+		if !params.IncludeHidden && (strings.HasPrefix(d.Name(), ".") || (d.IsDir() && skippedDirs[d.Name()])) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if matchFind(params, name, rel, d) {
+			info, err := d.Info()
+			if err == nil && matchInfo(params, info, newerThan, olderThan) {
+				if len(results) >= params.MaxResults {
+					truncated = true
+					return errStopWalk
+				}
+				results = append(results, formatFound(rel, info))
+			}
+		}
+
+		if d.IsDir() && depth >= params.MaxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return fmt.Sprintf("查找失败: %v", err), nil
+	}
+
+	if len(results) == 0 {
+		return fmt.Sprintf("在%s中没有找到符合条件的文件", root), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "在%s中找到%d个结果:\n", root, len(results))
+	for _, line := range results {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	if truncated {
+		fmt.Fprintf(&b, "...（结果超过%d个，已停止搜索，请缩小范围或增加max_results）\n", params.MaxResults)
+	}
+	return b.String(), nil
+}
+
+// matchFind 检查路径的类型、名称和glob模式
+func matchFind(params findParams, name, rel string, d fs.DirEntry) bool {
+	switch params.Type {
+	case "dir":
+		if !d.IsDir() {
+			return false
+		}
+	case "any":
+	default:
+		if d.IsDir() {
+			return false
+		}
+	}
+	if name != "" && !strings.Contains(strings.ToLower(d.Name()), name) {
+		return false
+	}
+	return params.Pattern == "" || matchGlobPath(params.Pattern, rel)
+}
+
+// matchInfo 检查文件大小和修改时间
+func matchInfo(params findParams, info fs.FileInfo, newerThan, olderThan time.Time) bool {
+	if !info.IsDir() {
+		if params.MinSize > 0 && info.Size() < params.MinSize {
+			return false
+		}
+		if params.MaxSize > 0 && info.Size() > params.MaxSize {
+			return false
+		}
+	}
+	if !newerThan.IsZero() && info.ModTime().Before(newerThan) {
+		return false
+	}
+	if !olderThan.IsZero() && info.ModTime().After(olderThan) {
+		return false
+	}
+	return true
+}
+
+// matchGlob 按路径段匹配glob模式，**匹配零个或多个路径段
+func matchGlob(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchGlob(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// formatFound 格式化一条查找结果，目录以/结尾
+func formatFound(rel string, info fs.FileInfo) string {
+	modified := info.ModTime().Format("2006-01-02 15:04")
+	if info.IsDir() {
+		return fmt.Sprintf("  %s/  (修改于 %s)", rel, modified)
+	}
+	return fmt.Sprintf("  %s  (%s, 修改于 %s)", rel, formatSize(info.Size()), modified)
+}
+
+// parseAge 解析时长，除Go的时长格式外还支持以d表示天数
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("无效的时长: %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("无效的时长: %s，示例: 30m、2h、7d", s)
+	}
+	return d, nil
+}
+
+// formatSize 将字节数格式化为易读的大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size), "KMGTPE"
+	i := -1
+	for value >= unit && i < len(suffix)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%cB", value, suffix[i])
+}
+
+// checkDirExists 确认路径存在且是目录
+func checkDirExists(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s不是目录", p)
+	}
+	return nil
+}
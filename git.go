@@ -0,0 +1,620 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	gitDefaultLog   = 20  // log默认返回的提交数
+	gitMaxLog       = 200 // log最多返回的提交数
+	gitMaxEntries   = 200 // status中每一类最多列出的文件数
+	gitPromptFiles  = 20  // 提交前的确认中最多列出的文件数
+	gitPromptCommit = 20  // 推送前的确认中最多列出的提交数
+)
+
+// gitRefPattern 提交、分支和远程仓库名，拒绝以-开头的选项和空白
+var gitRefPattern = regexp.MustCompile(`^[^-\s][^\s]*$`)
+
+// gitStatusNames porcelain状态码的含义
+var gitStatusNames = map[byte]string{
+	'M': "修改", 'A': "新增", 'D': "删除", 'R': "重命名", 'C': "复制", 'T': "类型变更",
+}
+
+// gitTool git操作的工具定义
+var gitTool = Tool{
+	Type:       "function",
+	Name:       "git",
+	Sequential: true,
+	Description: "查看和操作工作目录所在的git仓库，返回整理后的结果，代替用execute_command调用git。status列出分支、已暂存、未暂存、未跟踪和冲突的文件；diff查看修改；log列出提交；branches列出本地分支；" +
+		"add暂存指定的文件，unstage取消暂存；commit提交已暂存的修改，push推送当前分支，这两项执行前都会询问用户确认；switch切换或新建分支。" +
+		"提交消息由你根据diff撰写，先用log查看仓库已有提交消息的风格并保持一致。不支持强制推送和丢弃修改。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"status", "diff", "log", "branches", "add", "unstage", "commit", "push", "switch"},
+				"description": "要执行的操作",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "仓库中的任意目录，默认为工作目录",
+			},
+			"paths": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "add和unstage必填的文件或目录；diff和log时只查看这些路径。相对路径相对于工作目录",
+			},
+			"staged": map[string]interface{}{
+				"type":        "boolean",
+				"description": "diff是否查看已暂存（将要提交）的修改，默认false查看未暂存的修改",
+				"default":     false,
+			},
+			"ref": map[string]interface{}{
+				"type":        "string",
+				"description": "diff比较的提交或范围，如HEAD~1、main..feature；log从该提交或分支开始列出；switch新建分支时的起点",
+			},
+			"stat_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "diff只返回每个文件增删的行数，不返回具体内容",
+				"default":     false,
+			},
+			"message": map[string]interface{}{
+				"type":        "string",
+				"description": "commit的提交消息，第一行为简短的摘要，需要时空一行后写详细说明",
+			},
+			"branch": map[string]interface{}{
+				"type":        "string",
+				"description": "switch要切换到的分支",
+			},
+			"create": map[string]interface{}{
+				"type":        "boolean",
+				"description": "switch时新建分支，默认false",
+				"default":     false,
+			},
+			"remote": map[string]interface{}{
+				"type":        "string",
+				"description": "push推送到的远程仓库，默认为当前分支跟踪的远程仓库或origin",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "log返回的最多提交数，默认20",
+				"minimum":     1,
+				"maximum":     gitMaxLog,
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// gitParams git工具的参数
+type gitParams struct {
+	Action   string   `json:"action"`
+	Path     string   `json:"path"`
+	Paths    []string `json:"paths"`
+	Staged   bool     `json:"staged"`
+	Ref      string   `json:"ref"`
+	StatOnly bool     `json:"stat_only"`
+	Message  string   `json:"message"`
+	Branch   string   `json:"branch"`
+	Create   bool     `json:"create"`
+	Remote   string   `json:"remote"`
+	Limit    int      `json:"limit"`
+}
+
+// gitRepo 一次git工具调用操作的仓库
+type gitRepo struct {
+	root string // 仓库的根目录，git命令在这里执行，输出中的路径都相对于它
+}
+
+// gitStatus 解析后的git status
+type gitStatus struct {
+	head, upstream            string
+	ahead, behind, stashes    int
+	staged, unstaged          []string
+	untracked, conflicts      []string
+	hasUpstream, hasAheadInfo bool
+}
+
+// run 在仓库根目录执行git命令，禁止等待终端输入，返回合并的输出
+func (r gitRepo) run(ctx context.Context, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager", "-c", "color.ui=false", "-c", "core.quotepath=false"}, args...)...)
+	cmd.Dir = r.root
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true")
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	setProcessGroup(cmd)
+	out, err := cmd.CombinedOutput()
+	return strings.TrimRight(string(out), "\n"), err
+}
+
+// gitFailure 返回git命令失败的结果，附带常见错误的处理建议
+func gitFailure(action string, out string, err error) string {
+	result := fmt.Sprintf("git %s失败: %v\n%s\n", action, err, strings.TrimSpace(out))
+	switch {
+	case strings.Contains(out, "Please tell me who you are"):
+		result += "git没有配置提交者，请询问用户后执行 git config user.name 和 git config user.email\n"
+	case strings.Contains(out, "non-fast-forward") || strings.Contains(out, "[rejected]") || strings.Contains(out, "fetch first"):
+		result += "远程分支有本地没有的提交，请先拉取并合并（如 git pull --rebase），不要强制推送\n"
+	case strings.Contains(out, "Authentication failed") || strings.Contains(out, "could not read Username") || strings.Contains(out, "Permission denied (publickey"):
+		result += "认证失败，Agent不会输入密码，需要用户配置凭据助手或SSH密钥，也可以请用户手动推送\n"
+	case strings.Contains(out, "would be overwritten"):
+		result += "有未提交的修改会被覆盖，请先提交，或询问用户如何处理这些修改\n"
+	}
+	return result
+}
+
+// gitManage 根据action查看或操作git仓库
+func (a *ECNUAgent) gitManage(ctx context.Context, args string) (string, error) {
+	params := gitParams{Limit: gitDefaultLog}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	for name, value := range map[string]string{"ref": params.Ref, "branch": params.Branch, "remote": params.Remote} {
+		if value != "" && !gitRefPattern.MatchString(value) {
+			return "", fmt.Errorf("%s参数%q不合法", name, value)
+		}
+	}
+	switch params.Action {
+	case "add", "unstage":
+		if len(params.Paths) == 0 {
+			return "", fmt.Errorf("%s需要paths参数", params.Action)
+		}
+	case "commit":
+		if strings.TrimSpace(params.Message) == "" {
+			return "", fmt.Errorf("commit需要message参数")
+		}
+	case "switch":
+		if params.Branch == "" {
+			return "", fmt.Errorf("switch需要branch参数")
+		}
+	case "status", "diff", "log", "branches", "push":
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return "git操作失败: 未找到git命令", nil
+	}
+
+	dir := a.workingDir
+	if params.Path != "" {
+		dir = a.resolvePath(params.Path)
+	}
+	top, err := gitRepo{root: dir}.run(ctx, "", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Sprintf("git操作失败: %s不在git仓库中", dir), nil
+	}
+	repo := gitRepo{root: filepath.Clean(strings.TrimSpace(top))}
+	// 路径参数相对于工作目录，传给git时使用绝对路径
+	paths := make([]string, len(params.Paths))
+	for i, p := range params.Paths {
+		paths[i] = a.resolvePath(p)
+	}
+	log.Printf("[git] %s %s\n", params.Action, repo.root)
+
+	switch params.Action {
+	case "status":
+		return repo.statusReport(ctx), nil
+	case "diff":
+		return repo.diff(ctx, params, paths), nil
+	case "log":
+		return repo.log(ctx, params, paths), nil
+	case "branches":
+		return repo.branches(ctx), nil
+	case "add", "unstage":
+		return a.gitStage(ctx, repo, params.Action, paths), nil
+	case "commit":
+		return a.gitCommit(ctx, repo, params.Message), nil
+	case "push":
+		return a.gitPush(ctx, repo, params.Remote), nil
+	}
+	return a.gitSwitch(ctx, repo, params), nil
+}
+
+// status 读取并解析git status --porcelain=v2
+func (r gitRepo) status(ctx context.Context) (gitStatus, error) {
+	out, err := r.run(ctx, "", "status", "--porcelain=v2", "--branch", "--show-stash", "-z")
+	if err != nil {
+		return gitStatus{}, fmt.Errorf("%v: %s", err, out)
+	}
+	var st gitStatus
+	tokens := strings.Split(out, "\x00")
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if len(t) < 2 {
+			continue
+		}
+		switch t[0] {
+		case '#':
+			fields := strings.Fields(t)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "branch.head":
+				st.head = fields[2]
+			case "branch.upstream":
+				st.upstream, st.hasUpstream = fields[2], true
+			case "branch.ab":
+				if len(fields) >= 4 {
+					st.ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+					st.behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+					st.hasAheadInfo = true
+				}
+			case "stash":
+				st.stashes, _ = strconv.Atoi(fields[2])
+			}
+		case '1', '2':
+			n := 9
+			if t[0] == '2' {
+				n = 10
+			}
+			fields := strings.SplitN(t, " ", n)
+			if len(fields) < n {
+				continue
+			}
+			xy, path := fields[1], fields[n-1]
+			staged := path
+			if t[0] == '2' && i+1 < len(tokens) {
+				// 重命名和复制的原路径是下一项
+				staged = tokens[i+1] + " → " + path
+				i++
+			}
+			if xy[0] != '.' {
+				st.staged = append(st.staged, gitStatusNames[xy[0]]+" "+staged)
+			}
+			if xy[1] != '.' {
+				st.unstaged = append(st.unstaged, gitStatusNames[xy[1]]+" "+path)
+			}
+		case 'u':
+			if fields := strings.SplitN(t, " ", 11); len(fields) == 11 {
+				st.conflicts = append(st.conflicts, fields[10])
+			}
+		case '?':
+			st.untracked = append(st.untracked, t[2:])
+		}
+	}
+	return st, nil
+}
+
+// branchLine 返回当前分支和跟踪的远程分支
+func (st gitStatus) branchLine() string {
+	head := st.head + "分支"
+	if st.head == "(detached)" {
+		head = "分离的HEAD"
+	}
+	switch {
+	case !st.hasUpstream:
+		return head + "（没有跟踪远程分支）"
+	case !st.hasAheadInfo:
+		return fmt.Sprintf("%s（跟踪%s，远程分支已不存在）", head, st.upstream)
+	case st.ahead == 0 && st.behind == 0:
+		return fmt.Sprintf("%s（跟踪%s，已同步）", head, st.upstream)
+	}
+	return fmt.Sprintf("%s（跟踪%s，领先%d个提交，落后%d个提交）", head, st.upstream, st.ahead, st.behind)
+}
+
+// writeGitSection 列出一类文件，过多时只列出前gitMaxEntries个
+func writeGitSection(b *strings.Builder, title string, entries []string) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s（%d）:\n", title, len(entries))
+	for _, e := range entries[:min(len(entries), gitMaxEntries)] {
+		fmt.Fprintf(b, "  %s\n", e)
+	}
+	if len(entries) > gitMaxEntries {
+		fmt.Fprintf(b, "  ...其余%d个省略\n", len(entries)-gitMaxEntries)
+	}
+}
+
+// statusReport 返回仓库状态
+func (r gitRepo) statusReport(ctx context.Context) string {
+	st, err := r.status(ctx)
+	if err != nil {
+		return fmt.Sprintf("git status失败: %v", err)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "仓库: %s\n%s\n", r.root, st.branchLine())
+	if st.stashes > 0 {
+		fmt.Fprintf(&b, "储藏: %d项\n", st.stashes)
+	}
+	writeGitSection(&b, "冲突", st.conflicts)
+	writeGitSection(&b, "已暂存", st.staged)
+	writeGitSection(&b, "未暂存", st.unstaged)
+	writeGitSection(&b, "未跟踪", st.untracked)
+	if len(st.conflicts)+len(st.staged)+len(st.unstaged)+len(st.untracked) == 0 {
+		b.WriteString("工作区干净，没有未提交的修改\n")
+	}
+	return b.String()
+}
+
+// diffArgs 返回diff的参数
+func diffArgs(params gitParams, paths []string, extra ...string) []string {
+	args := append([]string{"diff"}, extra...)
+	if params.Staged {
+		args = append(args, "--cached")
+	}
+	if params.Ref != "" {
+		args = append(args, params.Ref)
+	}
+	return append(append(args, "--"), paths...)
+}
+
+// diff 返回每个文件增删的行数和具体的修改
+func (r gitRepo) diff(ctx context.Context, params gitParams, paths []string) string {
+	out, err := r.run(ctx, "", diffArgs(params, paths, "--numstat")...)
+	if err != nil {
+		return gitFailure("diff", out, err)
+	}
+	if out == "" {
+		if params.Staged || params.Ref != "" {
+			return "没有差异"
+		}
+		return "没有未暂存的修改；已暂存的修改请用staged: true查看"
+	}
+	var rows [][]string
+	added, deleted := 0, 0
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.SplitN(line, "\t", 3)
+		if len(f) != 3 {
+			continue
+		}
+		n, _ := strconv.Atoi(f[0])
+		m, _ := strconv.Atoi(f[1])
+		added, deleted = added+n, deleted+m
+		if f[0] == "-" {
+			f[0], f[1] = "二进制", ""
+		}
+		rows = append(rows, []string{f[2], f[0], f[1]})
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d个文件，+%d -%d:\n", len(rows), added, deleted)
+	b.WriteString(formatTableRows([]string{"FILE", "ADDED", "DELETED"}, rows))
+	if params.StatOnly {
+		return b.String()
+	}
+	patch, err := r.run(ctx, "", diffArgs(params, paths)...)
+	if err != nil {
+		return gitFailure("diff", patch, err)
+	}
+	b.WriteString("\n" + patch + "\n")
+	return b.String()
+}
+
+// log 列出提交
+func (r gitRepo) log(ctx context.Context, params gitParams, paths []string) string {
+	limit := max(1, min(params.Limit, gitMaxLog))
+	args := []string{"log", "-n", strconv.Itoa(limit), "--date=format:%Y-%m-%d %H:%M", "--format=%h%x1f%an%x1f%ad%x1f%s%x1e"}
+	if params.Ref != "" {
+		args = append(args, params.Ref)
+	}
+	out, err := r.run(ctx, "", append(append(args, "--"), paths...)...)
+	if err != nil {
+		if strings.Contains(out, "does not have any commits") {
+			return "当前分支还没有任何提交"
+		}
+		return gitFailure("log", out, err)
+	}
+	var rows [][]string
+	for _, rec := range strings.Split(out, "\x1e") {
+		if f := strings.Split(strings.TrimSpace(rec), "\x1f"); len(f) == 4 {
+			rows = append(rows, f)
+		}
+	}
+	if len(rows) == 0 {
+		return "没有符合条件的提交"
+	}
+	return fmt.Sprintf("最近%d个提交:\n", len(rows)) + formatTableRows([]string{"COMMIT", "AUTHOR", "DATE", "SUBJECT"}, rows)
+}
+
+// branches 列出本地分支及其跟踪的远程分支
+func (r gitRepo) branches(ctx context.Context) string {
+	out, err := r.run(ctx, "", "branch", "--format=%(HEAD)%1f%(refname:short)%1f%(upstream:short)%1f%(upstream:track)%1f%(committerdate:relative)%1f%(contents:subject)")
+	if err != nil {
+		return gitFailure("branch", out, err)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) != 6 {
+			continue
+		}
+		name := f[1]
+		if f[0] == "*" {
+			name = "* " + name
+		}
+		rows = append(rows, []string{name, f[2], strings.Trim(f[3], "[]"), f[4], f[5]})
+	}
+	if len(rows) == 0 {
+		return "仓库中还没有分支（没有任何提交）"
+	}
+	return fmt.Sprintf("共%d个本地分支（*为当前分支）:\n", len(rows)) + formatTableRows([]string{"BRANCH", "UPSTREAM", "TRACK", "UPDATED", "SUBJECT"}, rows)
+}
+
+// gitStage 暂存或取消暂存文件，返回之后的暂存状态
+func (a *ECNUAgent) gitStage(ctx context.Context, r gitRepo, action string, paths []string) string {
+	args := append([]string{"add", "--"}, paths...)
+	if action == "unstage" {
+		args = append([]string{"restore", "--staged", "--"}, paths...)
+	}
+	if refusal := a.policyDenied("git " + strings.Join(args, " ")); refusal != "" {
+		return refusal
+	}
+	if out, err := r.run(ctx, "", args...); err != nil {
+		return gitFailure(action, out, err)
+	}
+	st, err := r.status(ctx)
+	if err != nil {
+		return fmt.Sprintf("git status失败: %v", err)
+	}
+	var b strings.Builder
+	verb := map[string]string{"add": "已暂存", "unstage": "已取消暂存"}[action]
+	fmt.Fprintf(&b, "%s %d个路径\n", verb, len(paths))
+	writeGitSection(&b, "已暂存", st.staged)
+	writeGitSection(&b, "未暂存", st.unstaged)
+	if len(st.staged) == 0 {
+		b.WriteString("当前没有已暂存的修改\n")
+	}
+	return b.String()
+}
+
+// gitCommit 经用户确认后提交已暂存的修改
+func (a *ECNUAgent) gitCommit(ctx context.Context, r gitRepo, message string) string {
+	out, err := r.run(ctx, "", "diff", "--cached", "--numstat")
+	if err != nil {
+		return gitFailure("commit", out, err)
+	}
+	if out == "" {
+		return "没有已暂存的修改，请先用add暂存要提交的文件"
+	}
+	if refusal := a.policyDenied("git commit"); refusal != "" {
+		return refusal
+	}
+	files := strings.Split(out, "\n")
+	var list strings.Builder
+	for _, line := range files[:min(len(files), gitPromptFiles)] {
+		if f := strings.SplitN(line, "\t", 3); len(f) == 3 {
+			fmt.Fprintf(&list, "  +%s -%s %s\n", f[0], f[1], f[2])
+		}
+	}
+	if len(files) > gitPromptFiles {
+		fmt.Fprintf(&list, "  ...其余%d个文件\n", len(files)-gitPromptFiles)
+	}
+	st, _ := r.status(ctx)
+	message = strings.TrimSpace(message) + "\n"
+	ok, err := a.confirm(ctx, approveWrite, fmt.Sprintf("\n即将在%s提交%d个文件:\n%s提交消息:\n  %s是否提交？(y/N) ",
+		st.branchLine(), len(files), list.String(), strings.ReplaceAll(message, "\n", "\n  ")))
+	if err != nil {
+		return fmt.Sprintf("git commit失败: 提交需要用户确认: %v", err)
+	}
+	if !ok {
+		return "用户拒绝提交，修改仍处于暂存状态。请询问用户原因，例如是否需要修改提交消息或提交的文件。"
+	}
+	if out, err := r.run(ctx, message, "commit", "-q", "-F", "-"); err != nil {
+		return gitFailure("commit", out, err)
+	}
+	summary, _ := r.run(ctx, "", "log", "-1", "--shortstat", "--format=%h %s")
+	var parts []string
+	for _, line := range strings.Split(summary, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return "已提交: " + strings.Join(parts, "，") + "\n"
+}
+
+// gitPush 经用户确认后把当前分支推送到远程仓库，没有跟踪分支时同时设置跟踪
+func (a *ECNUAgent) gitPush(ctx context.Context, r gitRepo, remote string) string {
+	st, err := r.status(ctx)
+	if err != nil {
+		return fmt.Sprintf("git status失败: %v", err)
+	}
+	if st.head == "(detached)" {
+		return "当前处于分离的HEAD，没有可以推送的分支，请先用switch切换或新建分支"
+	}
+	upstreamRemote, _, _ := strings.Cut(st.upstream, "/")
+	if remote == "" {
+		remote = upstreamRemote
+		if remote == "" {
+			remote = "origin"
+		}
+	}
+	if out, err := r.run(ctx, "", "remote", "get-url", remote); err != nil {
+		return fmt.Sprintf("git push失败: 远程仓库%s不存在\n%s\n", remote, out)
+	}
+
+	// 列出将要推送的提交
+	setUpstream := !st.hasUpstream || !st.hasAheadInfo || remote != upstreamRemote
+	rangeArgs := []string{"@{upstream}..HEAD"}
+	if setUpstream {
+		rangeArgs = []string{"HEAD", "--not", "--remotes=" + remote}
+	} else if st.ahead == 0 {
+		return fmt.Sprintf("%s，没有需要推送的提交", st.branchLine())
+	}
+	commits, err := r.run(ctx, "", append([]string{"log", "--format=%h %s"}, rangeArgs...)...)
+	if err != nil {
+		return gitFailure("push", commits, err)
+	}
+	lines := strings.Split(commits, "\n")
+	if commits == "" {
+		lines = nil
+	}
+	var list strings.Builder
+	for _, line := range lines[:min(len(lines), gitPromptCommit)] {
+		list.WriteString("  " + line + "\n")
+	}
+	if len(lines) > gitPromptCommit {
+		fmt.Fprintf(&list, "  ...其余%d个提交\n", len(lines)-gitPromptCommit)
+	}
+
+	args := []string{"push"}
+	if setUpstream {
+		args = append(args, "-u")
+	}
+	args = append(args, remote, st.head)
+	command := "git " + strings.Join(args, " ")
+	if refusal := a.policyDenied(command); refusal != "" {
+		return refusal
+	}
+	count := fmt.Sprintf("%d个提交", len(lines))
+	if len(lines) == 0 {
+		count = "没有远程仓库中不存在的提交"
+	}
+	ok, err := a.confirm(ctx, approveRemote, fmt.Sprintf("\n即将推送%s分支到%s（%s）:\n%s  $ %s\n是否推送？(y/N) ", st.head, remote, count, list.String(), command))
+	if err != nil {
+		return fmt.Sprintf("git push失败: 推送需要用户确认: %v", err)
+	}
+	if !ok {
+		return "用户拒绝推送，提交仍只在本地。请询问用户原因或换一种方式完成任务。"
+	}
+	out, err := r.run(ctx, "", args...)
+	if err != nil {
+		return gitFailure("push", out, err)
+	}
+	return fmt.Sprintf("已推送%s分支到%s（%s）\n%s\n", st.head, remote, count, strings.TrimSpace(out))
+}
+
+// gitSwitch 切换到已有分支，或从ref新建分支并切换
+func (a *ECNUAgent) gitSwitch(ctx context.Context, r gitRepo, params gitParams) string {
+	args := []string{"switch"}
+	if params.Create {
+		args = append(args, "-c")
+	}
+	args = append(args, params.Branch)
+	if params.Create && params.Ref != "" {
+		args = append(args, params.Ref)
+	}
+	if refusal := a.policyDenied("git " + strings.Join(args, " ")); refusal != "" {
+		return refusal
+	}
+	if out, err := r.run(ctx, "", args...); err != nil {
+		return gitFailure("switch", out, err)
+	}
+	st, err := r.status(ctx)
+	if err != nil {
+		return fmt.Sprintf("git status失败: %v", err)
+	}
+	verb := "已切换到"
+	if params.Create {
+		verb = "已新建并切换到"
+	}
+	result := fmt.Sprintf("%s%s\n", verb, st.branchLine())
+	if n := len(st.staged) + len(st.unstaged); n > 0 {
+		result += fmt.Sprintf("有%d处未提交的修改随之带到了新分支\n", n)
+	}
+	return result
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubHost GitHub REST API上的一个仓库
+type githubHost struct {
+	repo string
+	api  *hostClient
+}
+
+// githubUser GitHub响应中的用户
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubIssue GitHub的issue，PR也会出现在issue接口中
+type githubIssue struct {
+	Number    int        `json:"number"`
+	Title     string     `json:"title"`
+	State     string     `json:"state"`
+	User      githubUser `json:"user"`
+	HTMLURL   string     `json:"html_url"`
+	Body      string     `json:"body"`
+	Comments  int        `json:"comments"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Labels    []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest *struct{} `json:"pull_request"`
+}
+
+// githubPull GitHub的PR
+type githubPull struct {
+	githubIssue
+	Draft          bool   `json:"draft"`
+	Merged         bool   `json:"merged"`
+	Mergeable      *bool  `json:"mergeable"`
+	MergeableState string `json:"mergeable_state"`
+	Head           struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// githubComment GitHub的issue评论、代码评论或评审
+type githubComment struct {
+	User        githubUser `json:"user"`
+	Body        string     `json:"body"`
+	HTMLURL     string     `json:"html_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	Path        string     `json:"path"`
+	Line        *int       `json:"line"`
+	OrigLine    *int       `json:"original_line"`
+	State       string     `json:"state"`
+}
+
+// String 返回平台和仓库
+func (g *githubHost) String() string { return "GitHub " + g.repo }
+
+// pullName GitHub上称为PR
+func (g *githubHost) pullName() string { return "PR" }
+
+// pullRef GitHub的PR用#引用
+func (g *githubHost) pullRef(number int) string { return fmt.Sprintf("PR #%d", number) }
+
+// path 返回仓库下的API路径
+func (g *githubHost) path(format string, args ...interface{}) string {
+	return "/repos/" + g.repo + fmt.Sprintf(format, args...)
+}
+
+// item 转换为通用的issue信息
+func (i githubIssue) item() hostItem {
+	it := hostItem{number: i.Number, title: i.Title, state: i.State, author: i.User.Login, url: i.HTMLURL, body: i.Body, comments: i.Comments, updated: i.UpdatedAt}
+	for _, l := range i.Labels {
+		it.labels = append(it.labels, l.Name)
+	}
+	return it
+}
+
+// item 转换为通用的PR信息
+func (p githubPull) item() hostItem {
+	it := p.githubIssue.item()
+	it.source, it.target, it.draft = p.Head.Ref, p.Base.Ref, p.Draft
+	switch {
+	case p.Merged:
+		it.state = "merged"
+	case p.State != "open":
+	case p.Mergeable == nil:
+		it.merge = "GitHub仍在计算"
+	case *p.Mergeable:
+		it.merge = "可以合并（" + p.MergeableState + "）"
+	default:
+		it.merge = "有冲突，无法合并"
+	}
+	return it
+}
+
+// listIssues 列出issue，跳过其中的PR
+func (g *githubHost) listIssues(ctx context.Context, state string, labels []string, limit int) ([]hostItem, error) {
+	query := url.Values{"state": {state}, "sort": {"updated"}}
+	if len(labels) > 0 {
+		query.Set("labels", strings.Join(labels, ","))
+	}
+	var items []hostItem
+	err := g.api.list(ctx, g.path("/issues"), query, limit, func(raw json.RawMessage) (bool, error) {
+		var issue githubIssue
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			return false, err
+		}
+		if issue.PullRequest != nil {
+			return false, nil
+		}
+		items = append(items, issue.item())
+		return true, nil
+	})
+	return items, err
+}
+
+// comments 读取一个列表接口中的全部评论
+func (g *githubHost) comments(ctx context.Context, path string) ([]hostComment, error) {
+	var comments []hostComment
+	err := g.api.list(ctx, path, nil, hostMaxLimit*hostMaxPages, func(raw json.RawMessage) (bool, error) {
+		var c githubComment
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return false, err
+		}
+		hc := hostComment{author: c.User.Login, body: c.Body, created: c.CreatedAt, path: c.Path}
+		if c.Line != nil {
+			hc.line = *c.Line
+		} else if c.OrigLine != nil {
+			hc.line = *c.OrigLine
+		}
+		if c.State != "" {
+			// 评审只在有内容或给出结论时显示
+			if c.Body == "" && c.State == "COMMENTED" {
+				return false, nil
+			}
+			hc.created = c.SubmittedAt
+			hc.body = fmt.Sprintf("[评审: %s] %s", c.State, c.Body)
+		}
+		comments = append(comments, hc)
+		return true, nil
+	})
+	return comments, err
+}
+
+// getIssue 返回issue和它的评论
+func (g *githubHost) getIssue(ctx context.Context, number int) (hostItem, []hostComment, error) {
+	var issue githubIssue
+	if _, err := g.api.do(ctx, http.MethodGet, g.path("/issues/%d", number), nil, nil, "", &issue); err != nil {
+		return hostItem{}, nil, err
+	}
+	comments, err := g.comments(ctx, g.path("/issues/%d/comments", number))
+	return issue.item(), comments, err
+}
+
+// createIssue 创建issue
+func (g *githubHost) createIssue(ctx context.Context, title, body string, labels []string) (hostItem, error) {
+	var issue githubIssue
+	payload := map[string]interface{}{"title": title, "body": body}
+	if len(labels) > 0 {
+		payload["labels"] = labels
+	}
+	_, err := g.api.do(ctx, http.MethodPost, g.path("/issues"), nil, payload, "", &issue)
+	return issue.item(), err
+}
+
+// comment 在issue或PR下评论，返回评论的地址。GitHub的PR和issue共用编号和评论接口
+func (g *githubHost) comment(ctx context.Context, number int, pull bool, body string) (string, error) {
+	var c githubComment
+	_, err := g.api.do(ctx, http.MethodPost, g.path("/issues/%d/comments", number), nil, map[string]string{"body": body}, "", &c)
+	return c.HTMLURL, err
+}
+
+// listPulls 列出PR，按更新时间排序
+func (g *githubHost) listPulls(ctx context.Context, state string, limit int) ([]hostItem, error) {
+	query := url.Values{"state": {state}, "sort": {"updated"}, "direction": {"desc"}}
+	var items []hostItem
+	err := g.api.list(ctx, g.path("/pulls"), query, limit, func(raw json.RawMessage) (bool, error) {
+		var pull githubPull
+		if err := json.Unmarshal(raw, &pull); err != nil {
+			return false, err
+		}
+		items = append(items, pull.item())
+		return true, nil
+	})
+	return items, err
+}
+
+// getPull 返回PR、修改的文件，以及讨论、评审和代码评论
+func (g *githubHost) getPull(ctx context.Context, number int) (hostItem, []hostFile, []hostComment, error) {
+	var pull githubPull
+	if _, err := g.api.do(ctx, http.MethodGet, g.path("/pulls/%d", number), nil, nil, "", &pull); err != nil {
+		return hostItem{}, nil, nil, err
+	}
+	var files []hostFile
+	err := g.api.list(ctx, g.path("/pulls/%d/files", number), nil, hostMaxLimit*hostMaxPages, func(raw json.RawMessage) (bool, error) {
+		var f struct {
+			Filename  string `json:"filename"`
+			Status    string `json:"status"`
+			Additions int    `json:"additions"`
+			Deletions int    `json:"deletions"`
+		}
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return false, err
+		}
+		files = append(files, hostFile{path: f.Filename, status: f.Status, additions: f.Additions, deletions: f.Deletions})
+		return true, nil
+	})
+	if err != nil {
+		return hostItem{}, nil, nil, err
+	}
+	var comments []hostComment
+	for _, path := range []string{"/issues/%d/comments", "/pulls/%d/reviews", "/pulls/%d/comments"} {
+		part, err := g.comments(ctx, g.path(path, number))
+		if err != nil {
+			return hostItem{}, nil, nil, err
+		}
+		comments = append(comments, part...)
+	}
+	slices.SortStableFunc(comments, func(a, b hostComment) int { return a.created.Compare(b.created) })
+	return pull.item(), files, comments, nil
+}
+
+// pullDiff 返回PR的统一diff
+func (g *githubHost) pullDiff(ctx context.Context, number int) (string, error) {
+	data, err := g.api.do(ctx, http.MethodGet, g.path("/pulls/%d", number), nil, nil, "application/vnd.github.v3.diff", nil)
+	return string(data), err
+}
+
+// review 提交评审，行内评论针对修改后的文件
+func (g *githubHost) review(ctx context.Context, number int, event, body string, comments []reviewComment) (string, error) {
+	payload := map[string]interface{}{"event": event}
+	if body != "" {
+		payload["body"] = body
+	}
+	if len(comments) > 0 {
+		items := make([]map[string]interface{}, len(comments))
+		for i, c := range comments {
+			items[i] = map[string]interface{}{"path": c.Path, "line": c.Line, "side": "RIGHT", "body": c.Body}
+		}
+		payload["comments"] = items
+	}
+	var result githubComment
+	if _, err := g.api.do(ctx, http.MethodPost, g.path("/pulls/%d/reviews", number), nil, payload, "", &result); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("已对%s提交评审（%s，%d条行内评论）\n%s\n", g.pullRef(number), hostReviewEvents[event], len(comments), result.HTMLURL), nil
+}
+
+// ciStatus 返回提交的check run和commit status，number不为0时查看PR的最新提交
+func (g *githubHost) ciStatus(ctx context.Context, number int, ref string) (string, []hostCheck, error) {
+	name := ref
+	if number > 0 {
+		var pull githubPull
+		if _, err := g.api.do(ctx, http.MethodGet, g.path("/pulls/%d", number), nil, nil, "", &pull); err != nil {
+			return "", nil, err
+		}
+		ref = pull.Head.SHA
+		name = fmt.Sprintf("%s（%s）", g.pullRef(number), shortSHA(ref))
+	}
+	var checks []hostCheck
+	var runs struct {
+		CheckRuns []struct {
+			Name       string `json:"name"`
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+		} `json:"check_runs"`
+	}
+	query := url.Values{"per_page": {strconv.Itoa(hostMaxLimit)}}
+	if _, err := g.api.do(ctx, http.MethodGet, g.path("/commits/%s/check-runs", escapeRef(ref)), query, nil, "", &runs); err != nil {
+		return "", nil, err
+	}
+	for _, r := range runs.CheckRuns {
+		status := r.Status
+		switch {
+		case r.Status == "in_progress":
+			status = "running"
+		case r.Status != "completed":
+			status = "pending"
+		case r.Conclusion == "success" || r.Conclusion == "neutral":
+			status = "success"
+		case r.Conclusion == "failure" || r.Conclusion == "timed_out" || r.Conclusion == "action_required" || r.Conclusion == "startup_failure":
+			status = "failure"
+		default:
+			status = r.Conclusion
+		}
+		checks = append(checks, hostCheck{name: r.Name, status: status, url: r.HTMLURL})
+	}
+	// 不使用Actions的CI通过commit status上报结果
+	var combined struct {
+		Statuses []struct {
+			Context   string `json:"context"`
+			State     string `json:"state"`
+			TargetURL string `json:"target_url"`
+		} `json:"statuses"`
+	}
+	if _, err := g.api.do(ctx, http.MethodGet, g.path("/commits/%s/status", escapeRef(ref)), nil, nil, "", &combined); err != nil {
+		return "", nil, err
+	}
+	for _, s := range combined.Statuses {
+		status := s.State
+		if status == "error" {
+			status = "failure"
+		}
+		checks = append(checks, hostCheck{name: s.Context, status: status, url: s.TargetURL})
+	}
+	return name, checks, nil
+}
+
+// shortSHA 返回提交哈希的前7位
+func shortSHA(sha string) string {
+	return sha[:min(len(sha), 7)]
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule .gitignore中的一条规则
+type ignoreRule struct {
+	base     string   // .gitignore所在目录相对遍历起点的路径，起点本身为空
+	parts    []string // 按/拆分的模式
+	negate   bool     // 以!开头，重新包含之前排除的路径
+	dirOnly  bool     // 以/结尾，只匹配目录
+	anchored bool     // 模式中包含/，相对.gitignore所在目录匹配
+}
+
+// ignoreRules 遍历过程中累积的.gitignore规则，后出现的规则优先
+type ignoreRules []ignoreRule
+
+// withDir 读取目录中的.gitignore并返回追加了其中规则的新规则集，rel为目录相对遍历起点的路径
+func (r ignoreRules) withDir(dir, rel string) ignoreRules {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return r
+	}
+	defer f.Close()
+
+	rules := append(ignoreRules(nil), r...)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: rel}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.parts = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored 判断相对遍历起点的路径是否被排除
+func (r ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			sub = rel[len(rule.base)+1:]
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchGlob(rule.parts, strings.Split(sub, "/"))
+		} else {
+			matched, _ = path.Match(rule.parts[0], path.Base(sub))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
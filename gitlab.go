@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// gitlabHost GitLab REST API上的一个项目
+type gitlabHost struct {
+	repo string
+	api  *hostClient
+}
+
+// gitlabStates issue和PR的状态在GitLab中的名称
+var gitlabStates = map[string]string{"open": "opened", "closed": "closed", "all": "all"}
+
+// gitlabUser GitLab响应中的用户
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+// gitlabIssue GitLab的issue
+type gitlabIssue struct {
+	IID         int        `json:"iid"`
+	Title       string     `json:"title"`
+	State       string     `json:"state"`
+	Author      gitlabUser `json:"author"`
+	WebURL      string     `json:"web_url"`
+	Description string     `json:"description"`
+	Labels      []string   `json:"labels"`
+	Notes       int        `json:"user_notes_count"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// gitlabMerge GitLab的MR
+type gitlabMerge struct {
+	gitlabIssue
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	Draft        bool   `json:"draft"`
+	MergeStatus  string `json:"detailed_merge_status"`
+	SHA          string `json:"sha"`
+	DiffRefs     struct {
+		BaseSHA  string `json:"base_sha"`
+		HeadSHA  string `json:"head_sha"`
+		StartSHA string `json:"start_sha"`
+	} `json:"diff_refs"`
+}
+
+// gitlabDiff MR中一个文件的修改
+type gitlabDiff struct {
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+	Diff    string `json:"diff"`
+	New     bool   `json:"new_file"`
+	Renamed bool   `json:"renamed_file"`
+	Deleted bool   `json:"deleted_file"`
+}
+
+// String 返回平台和项目
+func (g *gitlabHost) String() string { return "GitLab " + g.repo }
+
+// pullName GitLab上称为MR
+func (g *gitlabHost) pullName() string { return "MR" }
+
+// pullRef GitLab的MR用!引用
+func (g *gitlabHost) pullRef(number int) string { return fmt.Sprintf("MR !%d", number) }
+
+// path 返回项目下的API路径，项目以转义后的完整路径表示
+func (g *gitlabHost) path(format string, args ...interface{}) string {
+	return "/projects/" + url.PathEscape(g.repo) + fmt.Sprintf(format, args...)
+}
+
+// item 转换为通用的issue信息
+func (i gitlabIssue) item() hostItem {
+	state := i.State
+	if state == "opened" {
+		state = "open"
+	}
+	return hostItem{number: i.IID, title: i.Title, state: state, author: i.Author.Username, url: i.WebURL, body: i.Description, labels: i.Labels, comments: i.Notes, updated: i.UpdatedAt}
+}
+
+// item 转换为通用的PR信息
+func (m gitlabMerge) item() hostItem {
+	it := m.gitlabIssue.item()
+	it.source, it.target, it.draft = m.SourceBranch, m.TargetBranch, m.Draft
+	if it.state == "open" {
+		it.merge = m.MergeStatus
+	}
+	return it
+}
+
+// listIssues 列出issue
+func (g *gitlabHost) listIssues(ctx context.Context, state string, labels []string, limit int) ([]hostItem, error) {
+	query := url.Values{"state": {gitlabStates[state]}, "order_by": {"updated_at"}}
+	if len(labels) > 0 {
+		query.Set("labels", strings.Join(labels, ","))
+	}
+	var items []hostItem
+	err := g.api.list(ctx, g.path("/issues"), query, limit, func(raw json.RawMessage) (bool, error) {
+		var issue gitlabIssue
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			return false, err
+		}
+		items = append(items, issue.item())
+		return true, nil
+	})
+	return items, err
+}
+
+// notes 读取issue或MR的评论，跳过系统自动生成的记录
+func (g *gitlabHost) notes(ctx context.Context, path string) ([]hostComment, error) {
+	var comments []hostComment
+	query := url.Values{"sort": {"asc"}, "order_by": {"created_at"}}
+	err := g.api.list(ctx, path, query, hostMaxLimit*hostMaxPages, func(raw json.RawMessage) (bool, error) {
+		var n struct {
+			Author    gitlabUser `json:"author"`
+			Body      string     `json:"body"`
+			CreatedAt time.Time  `json:"created_at"`
+			System    bool       `json:"system"`
+			Position  *struct {
+				NewPath string `json:"new_path"`
+				NewLine int    `json:"new_line"`
+				OldPath string `json:"old_path"`
+				OldLine int    `json:"old_line"`
+			} `json:"position"`
+		}
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return false, err
+		}
+		if n.System {
+			return false, nil
+		}
+		c := hostComment{author: n.Author.Username, body: n.Body, created: n.CreatedAt}
+		if p := n.Position; p != nil {
+			c.path, c.line = p.NewPath, p.NewLine
+			if c.line == 0 {
+				c.path, c.line = p.OldPath, p.OldLine
+			}
+		}
+		comments = append(comments, c)
+		return true, nil
+	})
+	return comments, err
+}
+
+// getIssue 返回issue和它的评论
+func (g *gitlabHost) getIssue(ctx context.Context, number int) (hostItem, []hostComment, error) {
+	var issue gitlabIssue
+	if _, err := g.api.do(ctx, http.MethodGet, g.path("/issues/%d", number), nil, nil, "", &issue); err != nil {
+		return hostItem{}, nil, err
+	}
+	comments, err := g.notes(ctx, g.path("/issues/%d/notes", number))
+	return issue.item(), comments, err
+}
+
+// createIssue 创建issue
+func (g *gitlabHost) createIssue(ctx context.Context, title, body string, labels []string) (hostItem, error) {
+	var issue gitlabIssue
+	payload := map[string]string{"title": title, "description": body}
+	if len(labels) > 0 {
+		payload["labels"] = strings.Join(labels, ",")
+	}
+	_, err := g.api.do(ctx, http.MethodPost, g.path("/issues"), nil, payload, "", &issue)
+	return issue.item(), err
+}
+
+// comment 在issue或MR下评论，返回评论所在页面的地址
+func (g *gitlabHost) comment(ctx context.Context, number int, pull bool, body string) (string, error) {
+	kind := "issues"
+	if pull {
+		kind = "merge_requests"
+	}
+	var note struct {
+		ID int `json:"id"`
+	}
+	if _, err := g.api.do(ctx, http.MethodPost, g.path("/%s/%d/notes", kind, number), nil, map[string]string{"body": body}, "", &note); err != nil {
+		return "", err
+	}
+	// 评论已经发布，读取页面地址失败时只是不返回链接
+	var target gitlabIssue
+	g.api.do(ctx, http.MethodGet, g.path("/%s/%d", kind, number), nil, nil, "", &target)
+	if target.WebURL == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("%s#note_%d", target.WebURL, note.ID), nil
+}
+
+// listPulls 列出MR，按更新时间排序
+func (g *gitlabHost) listPulls(ctx context.Context, state string, limit int) ([]hostItem, error) {
+	query := url.Values{"state": {gitlabStates[state]}, "order_by": {"updated_at"}}
+	var items []hostItem
+	err := g.api.list(ctx, g.path("/merge_requests"), query, limit, func(raw json.RawMessage) (bool, error) {
+		var mr gitlabMerge
+		if err := json.Unmarshal(raw, &mr); err != nil {
+			return false, err
+		}
+		items = append(items, mr.item())
+		return true, nil
+	})
+	return items, err
+}
+
+// getMerge 读取MR
+func (g *gitlabHost) getMerge(ctx context.Context, number int) (gitlabMerge, error) {
+	var mr gitlabMerge
+	_, err := g.api.do(ctx, http.MethodGet, g.path("/merge_requests/%d", number), nil, nil, "", &mr)
+	return mr, err
+}
+
+// diffs 读取MR修改的文件，较早的GitLab没有diffs接口时使用changes
+func (g *gitlabHost) diffs(ctx context.Context, number int) ([]gitlabDiff, error) {
+	var diffs []gitlabDiff
+	err := g.api.list(ctx, g.path("/merge_requests/%d/diffs", number), nil, hostMaxLimit*hostMaxPages, func(raw json.RawMessage) (bool, error) {
+		var d gitlabDiff
+		if err := json.Unmarshal(raw, &d); err != nil {
+			return false, err
+		}
+		diffs = append(diffs, d)
+		return true, nil
+	})
+	var apiErr *hostAPIError
+	if errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound {
+		var changes struct {
+			Changes []gitlabDiff `json:"changes"`
+		}
+		_, err = g.api.do(ctx, http.MethodGet, g.path("/merge_requests/%d/changes", number), nil, nil, "", &changes)
+		diffs = changes.Changes
+	}
+	return diffs, err
+}
+
+// status 返回文件的修改类型
+func (d gitlabDiff) status() string {
+	switch {
+	case d.New:
+		return "added"
+	case d.Deleted:
+		return "removed"
+	case d.Renamed:
+		return "renamed"
+	}
+	return "modified"
+}
+
+// getPull 返回MR、修改的文件和评论
+func (g *gitlabHost) getPull(ctx context.Context, number int) (hostItem, []hostFile, []hostComment, error) {
+	mr, err := g.getMerge(ctx, number)
+	if err != nil {
+		return hostItem{}, nil, nil, err
+	}
+	diffs, err := g.diffs(ctx, number)
+	if err != nil {
+		return hostItem{}, nil, nil, err
+	}
+	files := make([]hostFile, len(diffs))
+	for i, d := range diffs {
+		added, deleted := diffLineCounts(d.Diff)
+		files[i] = hostFile{path: d.NewPath, status: d.status(), additions: added, deletions: deleted}
+	}
+	comments, err := g.notes(ctx, g.path("/merge_requests/%d/notes", number))
+	return mr.item(), files, comments, err
+}
+
+// pullDiff 把各文件的修改拼成统一diff
+func (g *gitlabHost) pullDiff(ctx context.Context, number int) (string, error) {
+	diffs, err := g.diffs(ctx, number)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, d := range diffs {
+		oldName, newName := "a/"+d.OldPath, "b/"+d.NewPath
+		if d.New {
+			oldName = "/dev/null"
+		}
+		if d.Deleted {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- %s\n+++ %s\n%s", d.OldPath, d.NewPath, oldName, newName, d.Diff)
+		if !strings.HasSuffix(d.Diff, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// review 发表评审。GitLab没有评审结论，行内评论作为讨论发布，APPROVE为批准MR，REQUEST_CHANGES作为一条评论说明
+func (g *gitlabHost) review(ctx context.Context, number int, event, body string, comments []reviewComment) (string, error) {
+	mr, err := g.getMerge(ctx, number)
+	if err != nil {
+		return "", err
+	}
+	posted := 0
+	for _, c := range comments {
+		payload := map[string]interface{}{
+			"body": c.Body,
+			"position": map[string]interface{}{
+				"position_type": "text",
+				"base_sha":      mr.DiffRefs.BaseSHA,
+				"start_sha":     mr.DiffRefs.StartSHA,
+				"head_sha":      mr.DiffRefs.HeadSHA,
+				"new_path":      c.Path,
+				"old_path":      c.Path,
+				"new_line":      c.Line,
+			},
+		}
+		if _, err := g.api.do(ctx, http.MethodPost, g.path("/merge_requests/%d/discussions", number), nil, payload, "", nil); err != nil {
+			return "", fmt.Errorf("已发布%d条行内评论，%s:%d的评论失败: %v", posted, c.Path, c.Line, err)
+		}
+		posted++
+	}
+	if event == "REQUEST_CHANGES" {
+		body = strings.TrimSpace("**请求修改**\n\n" + body)
+	}
+	if body != "" {
+		if _, err := g.api.do(ctx, http.MethodPost, g.path("/merge_requests/%d/notes", number), nil, map[string]string{"body": body}, "", nil); err != nil {
+			return "", fmt.Errorf("已发布%d条行内评论，总体评论失败: %v", posted, err)
+		}
+	}
+	if event == "APPROVE" {
+		if _, err := g.api.do(ctx, http.MethodPost, g.path("/merge_requests/%d/approve", number), nil, map[string]string{"sha": mr.SHA}, "", nil); err != nil {
+			return "", fmt.Errorf("评论已发布，批准MR失败: %v", err)
+		}
+	}
+	return fmt.Sprintf("已对%s发表评审（%s，%d条行内评论）\n%s\n", g.pullRef(number), hostReviewEvents[event], posted, mr.WebURL), nil
+}
+
+// ciStatus 返回最新流水线中的任务，number不为0时查看MR的流水线
+func (g *gitlabHost) ciStatus(ctx context.Context, number int, ref string) (string, []hostCheck, error) {
+	var pipelines []struct {
+		ID     int    `json:"id"`
+		SHA    string `json:"sha"`
+		Status string `json:"status"`
+	}
+	path, query, name := g.path("/pipelines"), url.Values{"ref": {ref}, "per_page": {"1"}}, ref
+	if number > 0 {
+		path, query, name = g.path("/merge_requests/%d/pipelines", number), url.Values{"per_page": {"1"}}, g.pullRef(number)
+	}
+	if _, err := g.api.do(ctx, http.MethodGet, path, query, nil, "", &pipelines); err != nil {
+		return "", nil, err
+	}
+	if len(pipelines) == 0 {
+		return name, nil, nil
+	}
+	p := pipelines[0]
+	name = fmt.Sprintf("%s（流水线#%d，%s，%s）", name, p.ID, shortSHA(p.SHA), p.Status)
+	var checks []hostCheck
+	err := g.api.list(ctx, g.path("/pipelines/%d/jobs", p.ID), nil, hostMaxLimit*hostMaxPages, func(raw json.RawMessage) (bool, error) {
+		var job struct {
+			Name         string `json:"name"`
+			Stage        string `json:"stage"`
+			Status       string `json:"status"`
+			WebURL       string `json:"web_url"`
+			AllowFailure bool   `json:"allow_failure"`
+		}
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return false, err
+		}
+		status := job.Status
+		switch status {
+		case "failed":
+			status = "failure"
+			if job.AllowFailure {
+				status = "allowed_failure"
+			}
+		case "canceled":
+			status = "cancelled"
+		case "created", "waiting_for_resource", "preparing", "scheduled":
+			status = "pending"
+		}
+		checks = append(checks, hostCheck{name: job.Stage + "/" + job.Name, status: status, url: job.WebURL})
+		return true, nil
+	})
+	return name, checks, err
+}
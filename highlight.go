@@ -0,0 +1,305 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 代码高亮使用的前景色，结束时只恢复默认前景色，不影响差异行的背景色
+const (
+	highlightKeyword  = "\033[35m"
+	highlightString   = "\033[32m"
+	highlightComment  = "\033[90m"
+	highlightNumber   = "\033[33m"
+	highlightVariable = "\033[36m"
+	highlightOff      = "\033[39m"
+)
+
+// colorOutput 判断提示信息能否使用颜色：未指定--plain、输出到终端且未设置NO_COLOR
+func (a *ECNUAgent) colorOutput() bool {
+	return !a.config.Plain && a.console == os.Stdout && isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+}
+
+// language 一种编程语言的词法定义，只用于终端上的简单着色
+type language struct {
+	keywords      []string
+	caseless      bool     // 关键字不区分大小写，如SQL
+	lineComments  []string // 行注释的开头
+	blockComment  [2]string
+	quotes        []string        // 字符串的引号，较长的写在前面
+	multiline     []string        // 可以跨行的字符串引号
+	raw           []string        // 不处理反斜杠转义的引号
+	variables     bool            // 是否有$name形式的变量，如shell
+	keywordLookup map[string]bool // 由keywords生成，在init中建立
+}
+
+var (
+	langGo = &language{
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+			"true", "false", "nil", "iota"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, "'", "`"},
+		multiline:    []string{"`"},
+		raw:          []string{"`"},
+	}
+	langPython = &language{
+		keywords: []string{"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield",
+			"self"},
+		lineComments: []string{"#"},
+		quotes:       []string{`"""`, `'''`, `"`, "'"},
+		multiline:    []string{`"""`, `'''`},
+	}
+	langJavaScript = &language{
+		keywords: []string{"async", "await", "break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete", "do", "else", "enum", "export", "extends", "finally", "for", "from", "function", "if", "implements", "import", "in", "instanceof", "interface", "let", "new", "of", "return", "static", "super", "switch", "this", "throw", "try", "type", "typeof", "var", "void", "while", "yield",
+			"true", "false", "null", "undefined"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, "'", "`"},
+		multiline:    []string{"`"},
+	}
+	langC = &language{
+		keywords: []string{"auto", "bool", "break", "case", "char", "class", "const", "constexpr", "continue", "default", "delete", "do", "double", "else", "enum", "extern", "float", "for", "goto", "if", "inline", "int", "long", "namespace", "new", "private", "protected", "public", "register", "return", "short", "signed", "sizeof", "static", "struct", "switch", "template", "this", "typedef", "typename", "union", "unsigned", "using", "virtual", "void", "volatile", "while",
+			"true", "false", "NULL", "nullptr", "#include", "#define", "#ifdef", "#ifndef", "#endif", "#if", "#else", "#pragma"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, "'"},
+	}
+	langJava = &language{
+		keywords: []string{"abstract", "boolean", "break", "byte", "case", "catch", "char", "class", "continue", "default", "do", "double", "else", "enum", "extends", "final", "finally", "float", "for", "fun", "if", "implements", "import", "instanceof", "int", "interface", "long", "new", "package", "private", "protected", "public", "return", "short", "static", "super", "switch", "this", "throw", "throws", "try", "val", "var", "void", "when", "while",
+			"true", "false", "null"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"""`, `"`, "'"},
+		multiline:    []string{`"""`},
+	}
+	langRust = &language{
+		keywords: []string{"as", "async", "await", "break", "const", "continue", "crate", "dyn", "else", "enum", "extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "super", "trait", "type", "unsafe", "use", "where", "while",
+			"true", "false"},
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`},
+		multiline:    []string{`"`},
+	}
+	langShell = &language{
+		keywords:     []string{"case", "do", "done", "elif", "else", "esac", "export", "fi", "for", "function", "if", "in", "local", "return", "then", "until", "while"},
+		lineComments: []string{"#"},
+		quotes:       []string{`"`, "'"},
+		raw:          []string{"'"},
+		variables:    true,
+	}
+	langJSON = &language{
+		keywords: []string{"true", "false", "null"},
+		quotes:   []string{`"`},
+	}
+	langYAML = &language{
+		keywords:     []string{"true", "false", "null", "yes", "no", "on", "off"},
+		lineComments: []string{"#"},
+		quotes:       []string{`"`, "'"},
+		raw:          []string{"'"},
+	}
+	langSQL = &language{
+		keywords:     []string{"add", "all", "alter", "and", "as", "asc", "begin", "between", "by", "case", "commit", "count", "create", "default", "delete", "desc", "distinct", "drop", "else", "end", "exists", "foreign", "from", "group", "having", "in", "index", "inner", "insert", "into", "is", "join", "key", "left", "like", "limit", "not", "null", "offset", "on", "or", "order", "outer", "primary", "references", "right", "rollback", "select", "set", "table", "then", "union", "unique", "update", "values", "view", "when", "where", "with"},
+		caseless:     true,
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{"'", `"`},
+	}
+	langDockerfile = &language{
+		keywords:     []string{"ADD", "ARG", "CMD", "COPY", "ENTRYPOINT", "ENV", "EXPOSE", "FROM", "HEALTHCHECK", "LABEL", "RUN", "SHELL", "USER", "VOLUME", "WORKDIR", "AS"},
+		lineComments: []string{"#"},
+		quotes:       []string{`"`, "'"},
+		variables:    true,
+	}
+)
+
+// languageNames 代码块的语言标记和文件扩展名对应的语言
+var languageNames = map[string]*language{
+	"go": langGo, "golang": langGo,
+	"py": langPython, "python": langPython, "python3": langPython, "pyw": langPython,
+	"js": langJavaScript, "javascript": langJavaScript, "mjs": langJavaScript, "cjs": langJavaScript, "jsx": langJavaScript,
+	"ts": langJavaScript, "typescript": langJavaScript, "tsx": langJavaScript, "vue": langJavaScript,
+	"c": langC, "h": langC, "cpp": langC, "c++": langC, "cc": langC, "cxx": langC, "hpp": langC, "hh": langC, "cs": langC, "csharp": langC,
+	"java": langJava, "kt": langJava, "kotlin": langJava, "scala": langJava,
+	"rs": langRust, "rust": langRust,
+	"sh": langShell, "bash": langShell, "zsh": langShell, "shell": langShell, "console": langShell, "makefile": langShell, "mk": langShell,
+	"json": langJSON, "jsonl": langJSON,
+	"yaml": langYAML, "yml": langYAML, "toml": langYAML, "ini": langYAML, "conf": langYAML, "cfg": langYAML,
+	"sql": langSQL, "dockerfile": langDockerfile,
+}
+
+// languageFor 根据代码块的语言标记或文件名选择语言，无法识别时返回nil
+func languageFor(name string) *language {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if lang, ok := languageNames[name]; ok {
+		return lang
+	}
+	base := filepath.Base(name)
+	if lang, ok := languageNames[base]; ok {
+		return lang
+	}
+	if strings.HasPrefix(base, "dockerfile") {
+		return langDockerfile
+	}
+	return languageNames[strings.TrimPrefix(filepath.Ext(base), ".")]
+}
+
+func init() {
+	for _, lang := range languageNames {
+		if lang.keywordLookup != nil {
+			continue
+		}
+		lang.keywordLookup = make(map[string]bool, len(lang.keywords))
+		for _, k := range lang.keywords {
+			if lang.caseless {
+				k = strings.ToLower(k)
+			}
+			lang.keywordLookup[k] = true
+		}
+	}
+}
+
+// isKeyword 判断标识符是否为关键字
+func (l *language) isKeyword(word string) bool {
+	if l.caseless {
+		word = strings.ToLower(word)
+	}
+	return l.keywordLookup[word]
+}
+
+// highlighter 逐行为代码着色，记录跨行的块注释和多行字符串
+type highlighter struct {
+	lang  *language
+	end   string // 未结束的块注释或字符串的结束标记
+	style string // 未结束部分的颜色
+	raw   bool   // 未结束的字符串是否不处理转义
+}
+
+// newHighlighter 创建高亮器，lang为nil时原样输出
+func newHighlighter(lang *language) *highlighter {
+	return &highlighter{lang: lang}
+}
+
+// line 为一行代码着色
+func (h *highlighter) line(s string) string {
+	if h == nil || h.lang == nil {
+		return s
+	}
+	lang := h.lang
+	var b strings.Builder
+	i := 0
+	if h.end != "" {
+		end := h.closing(s, 0, h.end, h.raw)
+		if end < 0 {
+			return h.style + s + highlightOff
+		}
+		b.WriteString(h.style + s[:end] + highlightOff)
+		h.end = ""
+		i = end
+	}
+
+	for i < len(s) {
+		rest := s[i:]
+		if prefix := matchPrefix(rest, lang.lineComments); prefix != "" && (prefix != "#" || i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			b.WriteString(highlightComment + rest + highlightOff)
+			break
+		}
+		if start := lang.blockComment[0]; start != "" && strings.HasPrefix(rest, start) {
+			end := h.closing(s, i+len(start), lang.blockComment[1], true)
+			if end < 0 {
+				h.end, h.style, h.raw = lang.blockComment[1], highlightComment, true
+				b.WriteString(highlightComment + rest + highlightOff)
+				break
+			}
+			b.WriteString(highlightComment + s[i:end] + highlightOff)
+			i = end
+			continue
+		}
+		if quote := matchPrefix(rest, lang.quotes); quote != "" {
+			raw := slices.Contains(lang.raw, quote)
+			end := h.closing(s, i+len(quote), quote, raw)
+			if end < 0 {
+				if slices.Contains(lang.multiline, quote) {
+					h.end, h.style, h.raw = quote, highlightString, raw
+				}
+				b.WriteString(highlightString + rest + highlightOff)
+				break
+			}
+			b.WriteString(highlightString + s[i:end] + highlightOff)
+			i = end
+			continue
+		}
+
+		c := s[i]
+		switch {
+		case lang.variables && c == '$' && i+1 < len(s) && (isWordByte(s[i+1]) || s[i+1] == '{'):
+			end := i + 1
+			if s[end] == '{' {
+				if j := strings.IndexByte(s[end:], '}'); j >= 0 {
+					end += j + 1
+				} else {
+					end = len(s)
+				}
+			} else {
+				for end < len(s) && isWordByte(s[end]) {
+					end++
+				}
+			}
+			b.WriteString(highlightVariable + s[i:end] + highlightOff)
+			i = end
+		case c >= '0' && c <= '9' && (i == 0 || !isWordByte(s[i-1])):
+			end := i
+			for end < len(s) && (isWordByte(s[end]) || s[end] == '.') {
+				end++
+			}
+			b.WriteString(highlightNumber + s[i:end] + highlightOff)
+			i = end
+		case isWordByte(c) || (c == '#' && lang == langC):
+			end := i + 1
+			for end < len(s) && isWordByte(s[end]) {
+				end++
+			}
+			if word := s[i:end]; lang.isKeyword(word) {
+				b.WriteString(highlightKeyword + word + highlightOff)
+			} else {
+				b.WriteString(word)
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// closing 从from开始查找结束标记，返回结束标记之后的位置，找不到时返回-1；raw为false时跳过反斜杠转义的字符
+func (h *highlighter) closing(s string, from int, end string, raw bool) int {
+	for i := from; i < len(s); i++ {
+		if !raw && s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], end) {
+			return i + len(end)
+		}
+	}
+	return -1
+}
+
+// matchPrefix 返回s开头的第一个候选前缀，没有时返回空字符串
+func matchPrefix(s string, prefixes []string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// isWordByte 判断字节是否可以出现在标识符中，非ASCII字符视为标识符的一部分
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
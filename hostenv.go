@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// hostDetectTimeout 启动时运行sw_vers、ver等命令读取系统版本的超时时间
+const hostDetectTimeout = 2 * time.Second
+
+// hostTools 启动时检查是否安装的常用命令，结果写入系统提示，避免模型建议不存在的命令
+var hostTools = []string{
+	"git", "python3", "python", "pip3", "pip", "node", "npm", "go", "java", "gcc", "make", "cmake",
+	"docker", "kubectl", "curl", "wget", "rg", "jq", "sudo",
+}
+
+// hostWindowsTools 只在Windows上检查的命令
+var hostWindowsTools = []string{"winget", "choco", "scoop", "wsl"}
+
+// shellRCFiles 常见登录shell的配置文件
+var shellRCFiles = map[string]string{
+	"bash": "~/.bashrc", "zsh": "~/.zshrc", "fish": "~/.config/fish/config.fish", "ksh": "~/.kshrc", "tcsh": "~/.tcshrc",
+}
+
+// hostEnvironment 启动时检测到的本机环境
+type hostEnvironment struct {
+	system    string   // 发行版或系统版本，如Ubuntu 22.04.4 LTS
+	shImpl    string   // sh实际指向的解释器，如dash、bash
+	userShell string   // 用户的登录shell，如zsh
+	tools     []string // 已安装的常用命令
+	missing   []string // 未安装的常用命令
+	packages  string   // 系统包管理器
+}
+
+// detectHostEnvironment 检测操作系统版本、sh的实现、用户的登录shell和已安装的常用命令
+func detectHostEnvironment(shell hostShell) hostEnvironment {
+	env := hostEnvironment{system: hostSystemName()}
+	if shell.kind == shellSh {
+		if target, err := filepath.EvalSymlinks(shell.path); err == nil {
+			if name := strings.TrimSuffix(filepath.Base(target), ".exe"); name != "sh" {
+				env.shImpl = name
+			}
+		}
+	}
+	if runtime.GOOS != "windows" {
+		env.userShell = filepath.Base(os.Getenv("SHELL"))
+		if env.userShell == "." {
+			env.userShell = ""
+		}
+	}
+
+	tools := hostTools
+	if runtime.GOOS == "windows" {
+		tools = append(append([]string(nil), hostTools...), hostWindowsTools...)
+	}
+	for _, name := range tools {
+		if hostToolAvailable(name) {
+			env.tools = append(env.tools, name)
+		} else {
+			env.missing = append(env.missing, name)
+		}
+	}
+	for _, m := range packageManagers {
+		if m.system || m.name == "brew" {
+			if _, err := exec.LookPath(m.bin); err == nil {
+				env.packages = m.name
+				break
+			}
+		}
+	}
+	return env
+}
+
+// hostToolAvailable 判断命令是否在PATH中，跳过Windows应用商店为python创建的占位程序
+func hostToolAvailable(name string) bool {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" && strings.HasPrefix(name, "python") && strings.Contains(strings.ToLower(path), `\windowsapps\`) {
+		return false
+	}
+	return true
+}
+
+// hostSystemName 返回发行版名称（Linux）或系统版本（macOS、Windows）以及处理器架构，读取失败时只返回系统名称
+func hostSystemName() string {
+	name := hostOSName()
+	switch runtime.GOOS {
+	case "linux":
+		if pretty := osReleaseName(); pretty != "" {
+			name = pretty
+		}
+		if data, err := os.ReadFile("/proc/version"); err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft") {
+			name += "，运行在WSL中"
+		}
+	case "darwin":
+		if version := hostCommandOutput("sw_vers", "-productVersion"); version != "" {
+			name += " " + version
+		}
+	case "windows":
+		// 输出形如Microsoft Windows [版本 10.0.22631.3880]
+		if version := hostCommandOutput("cmd", "/d", "/c", "ver"); version != "" {
+			name = version
+		}
+	}
+	return name + "（" + runtime.GOARCH + "）"
+}
+
+// osReleaseName 读取/etc/os-release中的发行版名称
+func osReleaseName() string {
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		values := make(map[string]string)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+				values[key] = strings.Trim(value, `"'`)
+			}
+		}
+		if values["PRETTY_NAME"] != "" {
+			return values["PRETTY_NAME"]
+		}
+		return strings.TrimSpace(values["NAME"] + " " + values["VERSION_ID"])
+	}
+	return ""
+}
+
+// hostCommandOutput 运行命令并返回去掉首尾空白的输出，失败时返回空字符串
+func hostCommandOutput(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), hostDetectTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(hostShell{}.decode(out)))
+}
+
+// prompt 返回系统提示中的命令解释器和已安装命令的说明
+func (e hostEnvironment) prompt(shell hostShell) string {
+	var b strings.Builder
+	b.WriteString("\n- 命令解释器: " + shell.String())
+	if e.shImpl != "" {
+		b.WriteString("，sh实际为" + e.shImpl)
+		if e.shImpl == "dash" {
+			b.WriteString("，不支持[[ ]]、数组、source等bash扩展语法，需要时使用bash -c")
+		}
+	}
+	if e.userShell != "" && e.userShell != "sh" {
+		b.WriteString("\n- 用户的登录shell: " + e.userShell)
+		if rc := shellRCFiles[e.userShell]; rc != "" {
+			b.WriteString("（配置文件为" + rc + "）")
+		}
+		b.WriteString("，execute_command不通过它执行，其中的别名和函数不可用")
+	}
+	if e.packages != "" {
+		b.WriteString("\n- 系统包管理器: " + e.packages)
+	}
+	if len(e.tools) > 0 {
+		b.WriteString("\n- 已安装的常用命令: " + strings.Join(e.tools, ", "))
+	}
+	if len(e.missing) > 0 {
+		b.WriteString("\n- 未安装的常用命令: " + strings.Join(e.missing, ", ") + "，不要直接使用这些命令，需要时先说明并征得用户同意后安装")
+	}
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 本机执行execute_command使用的命令解释器
+const (
+	shellAuto       = "auto"       // Windows上依次尝试pwsh、powershell和cmd，其他系统使用sh
+	shellSh         = "sh"         // POSIX sh，Windows上需要Git Bash、MSYS2等提供sh.exe
+	shellPowerShell = "powershell" // PowerShell，优先使用PowerShell 7的pwsh
+	shellCmd        = "cmd"        // Windows命令提示符
+)
+
+// shellNames --shell可用的值
+var shellNames = []string{shellAuto, shellSh, shellPowerShell, shellCmd}
+
+// powershellStateScript 命令结束（包括exit和出错）时把当前目录和环境变量以NUL分隔写入状态文件，并保留外部程序的退出码
+const powershellStateScript = `
+} finally {
+	if ($env:ECNU_SHELL_STATE) {
+		$ecnuState = @((Get-Location).ProviderPath) + @(Get-ChildItem Env: | ForEach-Object { $_.Name + '=' + $_.Value })
+		[IO.File]::WriteAllText($env:ECNU_SHELL_STATE, ($ecnuState -join [char]0) + [char]0)
+	}
+}
+if ($LASTEXITCODE) { exit $LASTEXITCODE }
+`
+
+// powershellPrelude 让PowerShell以UTF-8输出，避免中文Windows上的GBK乱码
+const powershellPrelude = "[Console]::OutputEncoding = [Text.Encoding]::UTF8\n$OutputEncoding = [Text.Encoding]::UTF8\n"
+
+// hostShell 本机上执行命令的解释器
+type hostShell struct {
+	kind string // sh、powershell或cmd
+	path string // 可执行文件路径
+}
+
+// findHostShell 根据--shell的值查找命令解释器
+func findHostShell(name string) (hostShell, error) {
+	if name == "" || name == shellAuto {
+		if runtime.GOOS != "windows" {
+			name = shellSh
+		} else if shell, err := findHostShell(shellPowerShell); err == nil {
+			return shell, nil
+		} else {
+			name = shellCmd
+		}
+	}
+	candidates := map[string][]string{shellSh: {"sh"}, shellPowerShell: {"pwsh", "powershell"}, shellCmd: {"cmd"}}[name]
+	if len(candidates) == 0 {
+		return hostShell{}, fmt.Errorf("shell必须为%s，当前为%q", strings.Join(shellNames, "、"), name)
+	}
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return hostShell{kind: name, path: path}, nil
+		}
+	}
+	return hostShell{}, fmt.Errorf("未找到命令解释器%s", strings.Join(candidates, "或"))
+}
+
+// command 创建执行script的命令
+func (s hostShell) command(ctx context.Context, script string) *exec.Cmd {
+	switch s.kind {
+	case shellPowerShell:
+		// 以UTF-16LE的base64传递脚本，不需要处理命令行中的引号
+		encoded := utf16.Encode([]rune(powershellPrelude + script))
+		raw := make([]byte, 0, len(encoded)*2)
+		for _, u := range encoded {
+			raw = append(raw, byte(u), byte(u>>8))
+		}
+		return exec.CommandContext(ctx, s.path, "-NoLogo", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass",
+			"-EncodedCommand", base64.StdEncoding.EncodeToString(raw))
+	case shellCmd:
+		// cmd不按常规规则解析参数，命令行需要原样传递
+		cmd := exec.CommandContext(ctx, s.path)
+		setCommandLine(cmd, `cmd /d /s /c "`+script+`"`)
+		return cmd
+	}
+	return exec.CommandContext(ctx, s.path, "-c", script)
+}
+
+// withState 在命令前后加上保存shell状态的代码，cmd无法可靠地导出状态，原样返回
+func (s hostShell) withState(command string) string {
+	switch s.kind {
+	case shellPowerShell:
+		return "try {\n" + command + powershellStateScript
+	case shellCmd:
+		return command
+	}
+	return shellStateTrap + command
+}
+
+// decode 把Windows程序以本地代码页（如GBK）或UTF-16输出的内容转换为UTF-8，其他系统原样返回
+func (s hostShell) decode(output []byte) []byte {
+	if runtime.GOOS != "windows" || utf8.Valid(output) {
+		return output
+	}
+	if text, _, ok := decodeText(output); ok {
+		return []byte(text)
+	}
+	return output
+}
+
+// String 返回系统提示中显示的名称
+func (s hostShell) String() string {
+	switch s.kind {
+	case shellPowerShell:
+		return "PowerShell（" + s.path + "）"
+	case shellCmd:
+		return "cmd（Windows命令提示符）"
+	}
+	return "sh（" + s.path + "）"
+}
+
+// note 返回加在execute_command说明中的语法提示，sh不需要提示
+func (s hostShell) note() string {
+	switch s.kind {
+	case shellPowerShell:
+		return "\n当前在Windows上通过PowerShell执行命令，请使用PowerShell语法（如Get-ChildItem、$env:NAME、Select-String），路径使用\\分隔，不要使用Linux命令和sudo。"
+	case shellCmd:
+		return "\n当前在Windows上通过cmd执行命令，请使用cmd语法（如dir、type、set NAME=值、%NAME%），路径使用\\分隔，不要使用Linux命令和sudo；" +
+			"cd和set不会保留到下一次调用，需要时用&&写在同一条命令中，或使用cwd参数。"
+	}
+	if runtime.GOOS == "windows" {
+		return "\n当前在Windows上通过sh执行命令，Windows上的路径可以写成C:/Users/name的形式。"
+	}
+	return ""
+}
+
+// hostOSName 返回系统提示中显示的操作系统名称
+func hostOSName() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Windows"
+	case "darwin":
+		return "macOS"
+	case "linux":
+		return "Linux"
+	}
+	return runtime.GOOS
+}
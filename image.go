@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	imageMaxSize = 10 * 1024 * 1024 // 单张图片的大小上限
+	imageTokens  = 800              // 估算请求长度时每张图片计入的token数
+)
+
+// imageMIMETypes 支持发送给模型的图片格式
+var imageMIMETypes = map[string]string{
+	"image/png":  "PNG",
+	"image/jpeg": "JPEG",
+	"image/gif":  "GIF",
+	"image/webp": "WebP",
+}
+
+// visionModelPatterns 服务商未声明vision_models时，模型名包含这些片段即视为支持图片输入
+var visionModelPatterns = []string{"vision", "-vl", "vl-", "gpt-4o", "gpt-4.1", "gpt-5", "llava", "minicpm-v", "gemini", "claude"}
+
+// viewImageTool 查看图片的工具定义
+var viewImageTool = Tool{
+	Type:        "function",
+	Name:        "view_image",
+	Sequential:  true,
+	Description: "查看图片文件（PNG、JPEG、GIF、WebP），图片会作为下一条消息发送给你，可用于阅读截图、图表和扫描件。仅在当前模型支持图片输入时可用。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "图片文件路径",
+			},
+			"detail": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"auto", "low", "high"},
+				"description": "图片的细节级别，low更省token，high适合阅读小字，默认auto",
+				"default":     "auto",
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// imageQueue 等待随下一条消息发送的图片
+type imageQueue struct {
+	mu    sync.Mutex
+	parts []openai.ChatMessagePart
+	names []string
+}
+
+// add 加入一张图片
+func (q *imageQueue) add(name string, part openai.ChatMessagePart) {
+	q.mu.Lock()
+	q.parts = append(q.parts, part)
+	q.names = append(q.names, name)
+	q.mu.Unlock()
+}
+
+// take 取出全部图片并清空队列
+func (q *imageQueue) take() ([]string, []openai.ChatMessagePart) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names, parts := q.names, q.parts
+	q.names, q.parts = nil, nil
+	return names, parts
+}
+
+// pending 返回队列中图片的名称
+func (q *imageQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.names...)
+}
+
+// supportsVision 判断当前模型是否支持图片输入：--vision优先，其次是服务商配置的vision_models，最后按模型名判断
+func (a *ECNUAgent) supportsVision() bool {
+	if a.config.Vision {
+		return true
+	}
+	model := strings.ToLower(a.model())
+	if models := a.backend.provider.VisionModels; models != nil {
+		for _, m := range models {
+			if strings.EqualFold(m, model) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range visionModelPatterns {
+		if strings.Contains(model, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// visionUnsupported 返回当前模型不支持图片输入时的说明
+func (a *ECNUAgent) visionUnsupported() string {
+	return fmt.Sprintf("当前模型%s不支持图片输入，请切换到支持视觉的模型；如果该模型实际支持图片，可在providers.json的vision_models中声明或使用--vision启动", a.model())
+}
+
+// loadImage 读取图片并编码为data URL形式的消息片段，同时返回格式、尺寸和大小的说明
+func loadImage(fullPath, detail string) (openai.ChatMessagePart, string, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return openai.ChatMessagePart{}, "", err
+	}
+	if info.IsDir() {
+		return openai.ChatMessagePart{}, "", fmt.Errorf("%s是目录", fullPath)
+	}
+	if info.Size() > imageMaxSize {
+		return openai.ChatMessagePart{}, "", fmt.Errorf("图片大小%s超过上限%s，请先缩小图片", formatSize(info.Size()), formatSize(imageMaxSize))
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return openai.ChatMessagePart{}, "", err
+	}
+	mime := http.DetectContentType(data)
+	kind, ok := imageMIMETypes[mime]
+	if !ok {
+		return openai.ChatMessagePart{}, "", fmt.Errorf("不支持的图片格式（%s），只支持PNG、JPEG、GIF和WebP", detectFileType(data))
+	}
+
+	desc := kind
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		desc += fmt.Sprintf("，%dx%d", cfg.Width, cfg.Height)
+	}
+	desc += "，" + formatSize(info.Size())
+
+	if detail == "" {
+		detail = string(openai.ImageURLDetailAuto)
+	}
+	part := openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{
+			URL:    "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data),
+			Detail: openai.ImageURLDetail(detail),
+		},
+	}
+	return part, desc, nil
+}
+
+// imageMessage 生成携带图片的用户消息，text为随图片发送的文字
+func imageMessage(text string, parts []openai.ChatMessagePart) openai.ChatCompletionMessage {
+	content := append([]openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}, parts...)
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: content}
+}
+
+// messageText 返回消息的文字部分，多模态消息中的图片以[图片]表示
+func messageText(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var texts []string
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			texts = append(texts, "[图片]")
+		} else if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// viewImage 读取图片并排入队列，在工具结果之后作为用户消息发送给模型
+func (a *ECNUAgent) viewImage(args string) (string, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Detail string `json:"detail"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	switch params.Detail {
+	case "", "auto", "low", "high":
+	default:
+		return "", fmt.Errorf("detail只能是auto、low或high")
+	}
+	if !a.supportsVision() {
+		return a.visionUnsupported(), nil
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	part, desc, err := loadImage(fullPath, params.Detail)
+	if err != nil {
+		return fmt.Sprintf("读取图片失败: %v", err), nil
+	}
+	log.Printf("[查看图片] %s (%s)\n", fullPath, desc)
+	a.images.add(fullPath, part)
+	return fmt.Sprintf("已读取图片 %s（%s），图片内容见下一条消息", fullPath, desc), nil
+}
+
+// attachViewedImages 把本步view_image读取的图片作为用户消息追加到历史
+func (a *ECNUAgent) attachViewedImages() {
+	names, parts := a.images.take()
+	if len(parts) == 0 {
+		return
+	}
+	a.history = append(a.history, imageMessage("（view_image读取的图片: "+strings.Join(names, ", ")+"）", parts))
+}
+
+// userMessage 生成用户消息，通过/attach添加的图片随该消息一起发送
+func (a *ECNUAgent) userMessage(text string) openai.ChatCompletionMessage {
+	if _, parts := a.attachments.take(); len(parts) > 0 {
+		return imageMessage(text, parts)
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: text}
+}
+
+// attachCommand 处理/attach命令，添加的图片随下一条输入发送
+func (a *ECNUAgent) attachCommand(args []string) {
+	if len(args) == 0 {
+		if names := a.attachments.pending(); len(names) > 0 {
+			fmt.Printf("待发送的图片: %s\n", strings.Join(names, ", "))
+			return
+		}
+		fmt.Println("用法: /attach <图片路径>...，图片随下一条输入发送；/attach clear 取消")
+		return
+	}
+	if len(args) == 1 && args[0] == "clear" {
+		a.attachments.take()
+		fmt.Println("已取消待发送的图片")
+		return
+	}
+	if !a.supportsVision() {
+		fmt.Println(a.visionUnsupported())
+		return
+	}
+	for _, p := range args {
+		fullPath := a.resolvePath(p)
+		part, desc, err := loadImage(fullPath, "")
+		if err != nil {
+			fmt.Printf("添加图片失败: %v\n", err)
+			continue
+		}
+		a.attachments.add(fullPath, part)
+		fmt.Printf("已添加图片 %s（%s）\n", fullPath, desc)
+	}
+	if names := a.attachments.pending(); len(names) > 0 {
+		fmt.Printf("%d张图片将随下一条输入发送\n", len(names))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// errInterrupted 表示当前任务被用户通过Ctrl+C中断
+var errInterrupted = errors.New("任务已被用户中断")
+
+// errMaxSteps 表示任务达到最大步骤数仍未完成
+var errMaxSteps = errors.New("达到最大步骤数限制")
+
+// runController 管理正在执行任务的取消函数，使Ctrl+C只中断当前任务而不退出程序
+type runController struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// begin 为一次任务创建可取消的上下文，任务结束后需调用返回的done
+func (r *runController) begin(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	r.mu.Lock()
+	r.cancel = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		r.cancel = nil
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// interrupt 取消正在执行的任务，没有任务时返回false
+func (r *runController) interrupt() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel == nil {
+		return false
+	}
+	r.cancel()
+	r.cancel = nil
+	return true
+}
+
+// running 判断是否有正在执行的任务
+func (r *runController) running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cancel != nil
+}
+
+// listen 开始监听SIGINT，返回停止监听的函数
+func (r *runController) listen() func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+				if r.interrupt() {
+					log.Printf("\n[中断] 正在取消当前任务...\n")
+				} else {
+					fmt.Print("\n(输入 exit 或 quit 退出)\n用户> ")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// jailPathParams 工具参数中表示路径的字段，--workspace-only时都必须位于工作区内
+var jailPathParams = map[string]bool{
+	"path": true, "paths": true, "source": true, "sources": true, "destination": true,
+	"path_a": true, "path_b": true, "local": true, "cwd": true, "archive": true,
+}
+
+// jailDevices 命令中允许出现的工作区之外的设备文件
+var jailDevices = map[string]bool{
+	"/dev/null": true, "/dev/zero": true, "/dev/stdin": true, "/dev/stdout": true, "/dev/stderr": true,
+	"/dev/random": true, "/dev/urandom": true, "/dev/tty": true,
+}
+
+// checkToolPaths 检查工具参数中的路径是否都位于工作区内，返回拒绝的原因，通过时返回空字符串
+func (a *ECNUAgent) checkToolPaths(args string) string {
+	var params map[string]interface{}
+	if json.Unmarshal([]byte(args), &params) != nil {
+		return ""
+	}
+	for name, value := range params {
+		if !jailPathParams[name] {
+			continue
+		}
+		var paths []string
+		switch v := value.(type) {
+		case string:
+			paths = append(paths, v)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					paths = append(paths, s)
+				}
+			}
+		}
+		for _, p := range paths {
+			if p == "" {
+				continue
+			}
+			if err := a.checkWorkspace(a.resolvePath(p)); err != nil {
+				return fmt.Sprintf("拒绝执行: %v", err)
+			}
+		}
+	}
+	return ""
+}
+
+// checkCommandPaths 检查命令参数中出现的路径是否位于工作区内，相对路径相对于命令的执行目录dir
+//
+// 只能识别命令中直接写出的路径，无法识别变量展开和程序自行打开的文件；需要可靠的隔离时应同时使用--sandbox bwrap。
+// 命令名本身（如/usr/bin/python3）不检查；既不存在、父目录也不存在的路径不可能被访问或创建，视为普通文本。
+func (a *ECNUAgent) checkCommandPaths(command, dir string) error {
+	home, _ := os.UserHomeDir()
+	for _, segment := range shellWords(command) {
+		if segment[0].text == "cd" && len(segment) == 1 && home != "" {
+			// 不带参数的cd进入主目录
+			if err := a.checkWorkspace(home); err != nil {
+				return err
+			}
+		}
+		named := false
+		for _, word := range segment {
+			if !named && !envAssignment(word.text) {
+				named = true
+				continue
+			}
+			text := word.text
+			// NAME=value和--option=value只检查值
+			if j := strings.IndexByte(text, '='); j >= 0 && !strings.HasPrefix(text, "/") {
+				text = text[j+1:]
+			}
+			p, ok := commandPath(text, word.tilde, home, dir)
+			if !ok || jailDevices[p] || strings.HasPrefix(p, "/dev/fd/") || strings.HasPrefix(p, "/proc/self/") {
+				continue
+			}
+			if _, err := os.Lstat(p); err != nil {
+				if _, err := os.Stat(filepath.Dir(p)); err != nil {
+					continue
+				}
+			}
+			if err := a.checkWorkspace(p); err != nil {
+				return err
+			}
+		}
+		// 之后的相对路径相对于cd切换到的目录
+		if segment[0].text == "cd" && len(segment) == 2 {
+			if p, ok := commandPath(segment[1].text, segment[1].tilde, home, dir); ok {
+				dir = p
+			} else if !strings.HasPrefix(segment[1].text, "-") && !strings.Contains(segment[1].text, "$") {
+				dir = filepath.Join(dir, segment[1].text)
+			}
+		}
+	}
+	return nil
+}
+
+// envAssignment 判断词是否为命令前的NAME=value变量赋值
+func envAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	return ok && envNamePattern.MatchString(name)
+}
+
+// commandPath 判断命令参数是否像路径，返回解析后的绝对路径
+//
+// Windows上同时识别C:\、\\server\share形式的绝对路径、..\和%USERPROFILE%。
+func commandPath(text string, tilde bool, home, dir string) (string, bool) {
+	// Windows上\和/都是路径分隔符，统一后再判断，其他系统上不变
+	slashed := filepath.ToSlash(text)
+	switch {
+	case tilde && (slashed == "~" || strings.HasPrefix(slashed, "~/")) && home != "":
+		text = home + text[1:]
+	case strings.HasPrefix(text, "$HOME") || strings.HasPrefix(text, "${HOME}"):
+		if home == "" {
+			return "", false
+		}
+		text = home + strings.TrimPrefix(strings.TrimPrefix(text, "${HOME}"), "$HOME")
+	case windowsHomePrefix(text) != "":
+		if home == "" {
+			return "", false
+		}
+		text = home + text[len(windowsHomePrefix(text)):]
+	case strings.HasPrefix(text, "/") || filepath.IsAbs(text):
+	case slashed == ".." || strings.HasPrefix(slashed, "../") || strings.Contains(slashed, "/../"):
+		text = filepath.Join(dir, text)
+	default:
+		return "", false
+	}
+	return filepath.Clean(text), true
+}
+
+// windowsHomePrefix 返回Windows上cmd或PowerShell中表示主目录的前缀，不是时返回空字符串
+func windowsHomePrefix(text string) string {
+	if runtime.GOOS != "windows" {
+		return ""
+	}
+	for _, prefix := range []string{"%USERPROFILE%", "$env:USERPROFILE"} {
+		if len(text) >= len(prefix) && strings.EqualFold(text[:len(prefix)], prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// shellWord 命令中的一个词
+type shellWord struct {
+	text     string
+	tilde    bool // 以未加引号的~开头
+	redirect bool // 输出重定向的目标文件
+}
+
+// shellWords 把命令粗略拆分为以;、|、&、括号和换行分隔的简单命令，每个简单命令是一组词
+//
+// 处理单引号、双引号和反斜杠转义（Windows上反斜杠是路径分隔符，不作为转义）；重定向符号后的文件名作为普通的词并标记输出重定向，>&2等复制文件描述符的写法被忽略。
+func shellWords(command string) [][]shellWord {
+	var segments [][]shellWord
+	var segment []shellWord
+	var word strings.Builder
+	inWord, tilde, redirect := false, false, false
+	endWord := func() {
+		if inWord {
+			segment = append(segment, shellWord{text: word.String(), tilde: tilde, redirect: redirect})
+			redirect = false
+		}
+		word.Reset()
+		inWord, tilde = false, false
+	}
+	endSegment := func() {
+		endWord()
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+		}
+		segment = nil
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'':
+			inWord = true
+			for i++; i < len(runes) && runes[i] != '\''; i++ {
+				word.WriteRune(runes[i])
+			}
+		case c == '"':
+			inWord = true
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && filepath.Separator == '/' {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+		case c == '\\' && i+1 < len(runes) && filepath.Separator == '/':
+			inWord = true
+			i++
+			word.WriteRune(runes[i])
+		case c == ';' || c == '|' || c == '&' || c == '(' || c == ')' || c == '\n' || c == '`':
+			endSegment()
+		case c == '<' || c == '>':
+			// 2>中的2是文件描述符，不是参数
+			if inWord && strings.Trim(word.String(), "0123456789") == "" {
+				word.Reset()
+				inWord = false
+			}
+			endWord()
+			output := c == '>'
+			for i+1 < len(runes) && (runes[i+1] == '>' || runes[i+1] == '<') {
+				i++
+			}
+			// 跳过>&2、2>&1中的文件描述符
+			if i+1 < len(runes) && runes[i+1] == '&' {
+				for i++; i+1 < len(runes) && (runes[i+1] >= '0' && runes[i+1] <= '9' || runes[i+1] == '-'); i++ {
+				}
+				output = false
+			}
+			redirect = output
+		case c == ' ' || c == '\t':
+			endWord()
+		default:
+			if !inWord && c == '~' {
+				tilde = true
+			}
+			inWord = true
+			word.WriteRune(c)
+		}
+	}
+	endSegment()
+	return segments
+}
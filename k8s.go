@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	podProbeTimeout = 30 * time.Second // 启动时检查Pod能否执行命令的超时时间
+	podReadMax      = 10 << 20         // read_file从Pod中读取的最大字节数
+)
+
+// podToolNames Pod模式下可用的工具，其余工具操作本机文件，不提供给模型
+var podToolNames = map[string]bool{
+	"execute_command": true, "read_file": true, "write_file": true, "list_directory": true,
+	"get_working_directory": true, "read_tool_output": true, "spawn_agent": true,
+}
+
+// podSandbox 通过kubectl exec在Kubernetes Pod中执行命令和读写文件
+//
+// 使用kubeconfig中的认证信息访问Kubernetes API，Pod中需要有sh；文件工具通过cat、ls等命令实现。
+type podSandbox struct {
+	cfg     *Config
+	workdir string   // Pod中的初始工作目录
+	env     []string // Pod中的初始环境变量
+	prefix  string   // Pod中状态文件的路径前缀，区分同时连接同一Pod的多个Agent
+
+	mu     sync.Mutex
+	nextID int
+}
+
+// newPodSandbox 检查kubectl能否连接到Pod，并读取Pod中的工作目录和环境变量
+func newPodSandbox(cfg *Config) (*podSandbox, error) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		return nil, fmt.Errorf("未找到kubectl命令: %v", err)
+	}
+	p := &podSandbox{cfg: cfg, prefix: fmt.Sprintf("/tmp/ecnu-shell-%d-%d", os.Getpid(), time.Now().UnixNano())}
+	ctx, cancel := context.WithTimeout(context.Background(), podProbeTimeout)
+	defer cancel()
+	out, err := p.run(ctx, nil, "sh", "-c", `pwd && env -0`)
+	if err != nil {
+		return nil, fmt.Errorf("无法在%s中执行命令: %v", p.target(), err)
+	}
+	dir, env, _ := bytes.Cut(out, []byte("\n"))
+	p.workdir = strings.TrimSpace(string(dir))
+	for _, kv := range bytes.Split(bytes.TrimSuffix(env, []byte{0}), []byte{0}) {
+		if name, _, ok := strings.Cut(string(kv), "="); ok && !shellIgnoredVars[name] {
+			p.env = append(p.env, string(kv))
+		}
+	}
+	log.Printf("[Pod] 已连接%s，工作目录: %s\n", p.target(), p.workdir)
+	return p, nil
+}
+
+// target 返回Pod的说明，如"Pod default/web（容器app）"
+func (p *podSandbox) target() string {
+	name := p.cfg.K8sPod
+	if p.cfg.K8sNamespace != "" {
+		name = p.cfg.K8sNamespace + "/" + name
+	}
+	if p.cfg.K8sContainer != "" {
+		name += "（容器" + p.cfg.K8sContainer + "）"
+	}
+	return "Pod " + name
+}
+
+// kubectlArgs 返回在Pod中执行command的kubectl参数
+func (p *podSandbox) kubectlArgs(command ...string) []string {
+	var args []string
+	if p.cfg.K8sContext != "" {
+		args = append(args, "--context", p.cfg.K8sContext)
+	}
+	if p.cfg.K8sNamespace != "" {
+		args = append(args, "--namespace", p.cfg.K8sNamespace)
+	}
+	args = append(args, "exec", "-i", p.cfg.K8sPod)
+	if p.cfg.K8sContainer != "" {
+		args = append(args, "--container", p.cfg.K8sContainer)
+	}
+	return append(append(args, "--"), command...)
+}
+
+// run 在Pod中执行命令并返回标准输出，失败时错误中包含标准错误的内容
+func (p *podSandbox) run(ctx context.Context, stdin []byte, command ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", p.kubectlArgs(command...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s", msg)
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// command 在Pod中执行script，中断时结束Pod中带有该命令标记的进程
+func (p *podSandbox) command(ctx context.Context, script, dir string, env []string) (*exec.Cmd, error) {
+	p.mu.Lock()
+	p.nextID++
+	marker := fmt.Sprintf("%s=%d", sandboxCommandEnv, p.nextID)
+	p.mu.Unlock()
+
+	command := []string{"env"}
+	if env != nil {
+		command = append(append(command, "-i"), env...)
+	}
+	cd := fmt.Sprintf("cd %s 2>/dev/null || { echo %s >&2; cd %s; }; ", shellQuote(dir), shellQuote("目录"+dir+"不存在，已在"+p.workdir+"中执行"), shellQuote(p.workdir))
+	command = append(command, marker, "sh", "-c", cd+script)
+
+	cmd := exec.CommandContext(ctx, "kubectl", p.kubectlArgs(command...)...)
+	cmd.Cancel = func() error {
+		kill := exec.Command("kubectl", p.kubectlArgs("sh", "-c", markerKillScript(marker))...)
+		kill.Run()
+		return cmd.Process.Kill()
+	}
+	return cmd, nil
+}
+
+func (p *podSandbox) environ() []string { return append([]string(nil), p.env...) }
+
+// isDir Pod中的目录在命令执行时由cd检查
+func (p *podSandbox) isDir(path string) bool { return true }
+
+func (p *podSandbox) stateFile() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextID++
+	return fmt.Sprintf("%s-%d", p.prefix, p.nextID), nil
+}
+
+func (p *podSandbox) takeState(statePath string) []byte {
+	ctx, cancel := context.WithTimeout(context.Background(), podProbeTimeout)
+	defer cancel()
+	out, _ := p.run(ctx, nil, "sh", "-c", `cat "$1" 2>/dev/null; rm -f "$1"`, "sh", statePath)
+	return out
+}
+
+func (p *podSandbox) describe() string { return "kubernetes（" + p.target() + "）" }
+
+func (p *podSandbox) note() string {
+	return fmt.Sprintf("命令在Kubernetes %s中执行，而不是本机。", p.target())
+}
+
+func (p *podSandbox) close() {}
+
+// resolve 将相对路径解析为Pod中基于工作目录的绝对路径
+func (p *podSandbox) resolve(name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(p.workdir, name)
+	}
+	return path.Clean(name)
+}
+
+// podTools 保留Pod模式下可用的工具，并改写文件工具的说明和参数
+func podTools(tools []Tool) []Tool {
+	var kept []Tool
+	for _, t := range tools {
+		if !podToolNames[t.Name] {
+			continue
+		}
+		switch t.Name {
+		case "read_file":
+			t.Description = "读取Pod中的文本文件。文件较大时返回第一部分，可用offset和limit按行分页读取。二进制文件只返回类型和大小。"
+			t.Parameters = keepProperties(t.Parameters, "path", "offset", "limit")
+		case "write_file":
+			t.Description = "写入或创建Pod中的文件，目录不存在时自动创建父目录。覆盖已有文件前会请用户确认。"
+			t.Parameters = keepProperties(t.Parameters, "path", "content", "append")
+		case "list_directory":
+			t.Description = "列出Pod中目录的内容。"
+		case "get_working_directory":
+			t.Description = "获取Pod中的工作目录和execute_command的当前目录。"
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+// keepProperties 返回只保留指定属性的参数定义副本
+func keepProperties(params map[string]interface{}, names ...string) map[string]interface{} {
+	result := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		result[k] = v
+	}
+	props, _ := params["properties"].(map[string]interface{})
+	kept := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if prop, ok := props[name]; ok {
+			kept[name] = prop
+		}
+	}
+	result["properties"] = kept
+	return result
+}
+
+// executePodTool 在Pod中执行文件工具，由execute_command等与文件无关的工具返回false
+//
+// 操作本机文件的工具不提供给模型，模型仍然调用时拒绝执行。
+func (a *ECNUAgent) executePodTool(ctx context.Context, pod *podSandbox, name, args string) (string, bool, error) {
+	if !podToolNames[name] {
+		return fmt.Sprintf("%s在Pod模式下不可用，请使用execute_command在%s中完成", name, pod.target()), true, nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", true, fmt.Errorf("解析参数失败: %v", err)
+	}
+	var result string
+	var err error
+	switch name {
+	case "read_file":
+		result, err = a.podReadFile(ctx, pod, params)
+	case "write_file":
+		result, err = a.podWriteFile(ctx, pod, params)
+	case "list_directory":
+		result, err = a.podListDirectory(ctx, pod, params)
+	case "get_working_directory":
+		result = fmt.Sprintf("当前工作目录: %s（%s）", pod.workdir, pod.target())
+		if dir := a.shell.directory(); a.config.ShellSession && dir != "" && dir != pod.workdir {
+			result += fmt.Sprintf("\nexecute_command的当前目录: %s（文件工具的相对路径仍相对于工作目录）", dir)
+		}
+	default:
+		return "", false, nil
+	}
+	return result, true, err
+}
+
+// podReadFile 读取Pod中的文件
+func (a *ECNUAgent) podReadFile(ctx context.Context, pod *podSandbox, params map[string]interface{}) (string, error) {
+	name, ok := params["path"].(string)
+	if !ok {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	offset, _ := params["offset"].(float64)
+	limit, _ := params["limit"].(float64)
+	fullPath := pod.resolve(name)
+
+	log.Printf("[读取文件] %s:%s\n", pod.target(), fullPath)
+
+	// 多读一个字节判断是否超过上限
+	content, err := pod.run(ctx, nil, "sh", "-c", fmt.Sprintf(`head -c %d -- "$1"`, podReadMax+1), "sh", fullPath)
+	if err != nil {
+		return fmt.Sprintf("读取文件失败: %v", err), nil
+	}
+	if len(content) > podReadMax {
+		return fmt.Sprintf("读取文件失败: %s超过%s，请用execute_command查看需要的部分", fullPath, formatSize(podReadMax)), nil
+	}
+	text, encoding, ok := decodeText(content)
+	if !ok {
+		return binaryFileSummary(fullPath, content, 0), nil
+	}
+	label := fullPath
+	if encoding != encodingUTF8 {
+		label += "，编码" + encoding.name + "，已转换为UTF-8"
+	}
+	maxBytes := a.config.ReadLimit
+	if offset == 0 && limit == 0 && (maxBytes == 0 || len(text) <= maxBytes) {
+		return fmt.Sprintf("文件内容 (%s):\n%s", label, text), nil
+	}
+	return readFilePage(label, text, int(offset), int(limit), maxBytes), nil
+}
+
+// podWriteFile 写入Pod中的文件，覆盖前显示差异并请用户确认
+func (a *ECNUAgent) podWriteFile(ctx context.Context, pod *podSandbox, params map[string]interface{}) (string, error) {
+	name, ok := params["path"].(string)
+	if !ok {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	content, ok := params["content"].(string)
+	if !ok {
+		return "", fmt.Errorf("缺少content参数")
+	}
+	appendMode, _ := params["append"].(bool)
+	fullPath := pod.resolve(name)
+
+	log.Printf("[写入文件] %s:%s (追加: %v)\n", pod.target(), fullPath, appendMode)
+
+	if !appendMode {
+		if old, err := pod.run(ctx, nil, "cat", "--", fullPath); err == nil {
+			ok, err := a.confirmReplace(ctx, fullPath, old, content)
+			if err != nil {
+				return fmt.Sprintf("写入文件失败: 覆盖%s需要用户确认: %v", fullPath, err), nil
+			}
+			if !ok {
+				return fmt.Sprintf("用户拒绝覆盖文件 %s，文件未修改。请询问用户原因或换一种方式完成任务。", fullPath), nil
+			}
+		}
+	}
+
+	redirect := ">"
+	if appendMode {
+		redirect = ">>"
+	}
+	script := fmt.Sprintf(`mkdir -p "$(dirname "$1")" && cat %s "$1"`, redirect)
+	if _, err := pod.run(ctx, []byte(content), "sh", "-c", script, "sh", fullPath); err != nil {
+		return fmt.Sprintf("写入文件失败: %v", err), nil
+	}
+	a.activity.addFile(fullPath)
+	return fmt.Sprintf("成功写入文件: %s（%s）", fullPath, pod.target()), nil
+}
+
+// podListDirectory 列出Pod中的目录
+func (a *ECNUAgent) podListDirectory(ctx context.Context, pod *podSandbox, params map[string]interface{}) (string, error) {
+	name := "."
+	if p, ok := params["path"].(string); ok && p != "" {
+		name = p
+	}
+	fullPath := pod.resolve(name)
+
+	log.Printf("[列出目录] %s:%s\n", pod.target(), fullPath)
+
+	out, err := pod.run(ctx, nil, "ls", "-lA", "--", fullPath)
+	if err != nil {
+		return fmt.Sprintf("读取目录失败: %v", err), nil
+	}
+	return fmt.Sprintf("目录内容 (%s):\n%s", fullPath, out), nil
+}
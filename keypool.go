@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyRateLimitCooldown = time.Minute // 触发限流后暂停使用该密钥的时间
+	keyQuotaCooldown     = time.Hour   // 额度用尽后暂停使用该密钥的时间
+)
+
+// apiKeyState 记录单个密钥的健康状态
+type apiKeyState struct {
+	key           string
+	requests      int       // 已发送的请求数
+	failures      int       // 触发轮换的失败次数
+	cooldownUntil time.Time // 冷却结束时间
+	disabled      bool      // 密钥无效，不再使用
+	lastError     string
+}
+
+// keyPool 管理多个API密钥，在限流或额度错误时轮换到健康的密钥
+type keyPool struct {
+	mu      sync.Mutex
+	keys    []*apiKeyState
+	current int
+}
+
+// newKeyPool 创建密钥池，自动去除空白和重复的密钥
+func newKeyPool(keys []string) *keyPool {
+	p := &keyPool{}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		p.keys = append(p.keys, &apiKeyState{key: key})
+	}
+	return p
+}
+
+// readKeysFile 读取密钥文件，每行一个密钥，忽略空行和#开头的注释
+func readKeysFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %v", err)
+	}
+	return keys, nil
+}
+
+// size 返回密钥数量
+func (p *keyPool) size() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.keys)
+}
+
+// acquire 返回当前使用的密钥并计数，没有密钥时返回空字符串
+func (p *keyPool) acquire() string {
+	if p.size() == 0 {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.keys[p.current]
+	state.requests++
+	return state.key
+}
+
+// rotate 根据错误类型标记当前密钥并切换到下一个可用密钥
+//
+// 401视为密钥无效并停用，402/403视为额度用尽，429视为限流，分别冷却不同时长。
+// 返回切换前后的密钥（已脱敏），没有可切换的密钥时ok为false。
+func (p *keyPool) rotate(err error) (from, to string, ok bool) {
+	if p.size() < 2 {
+		return "", "", false
+	}
+	code := statusCode(err)
+	if code != http.StatusUnauthorized && code != http.StatusPaymentRequired &&
+		code != http.StatusForbidden && code != http.StatusTooManyRequests {
+		return "", "", false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	state := p.keys[p.current]
+	state.failures++
+	state.lastError = fmt.Sprintf("HTTP %d", code)
+	switch code {
+	case http.StatusUnauthorized:
+		state.disabled = true
+	case http.StatusTooManyRequests:
+		state.cooldownUntil = now.Add(keyRateLimitCooldown)
+	default:
+		state.cooldownUntil = now.Add(keyQuotaCooldown)
+	}
+
+	for i := 1; i < len(p.keys); i++ {
+		idx := (p.current + i) % len(p.keys)
+		next := p.keys[idx]
+		if next.disabled || now.Before(next.cooldownUntil) {
+			continue
+		}
+		p.current = idx
+		return maskKey(state.key), maskKey(next.key), true
+	}
+	return "", "", false
+}
+
+// describe 返回各密钥的健康状态说明
+func (p *keyPool) describe() string {
+	if p.size() == 0 {
+		return "  (未配置密钥)\n"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	now := time.Now()
+	for i, state := range p.keys {
+		mark := " "
+		if i == p.current {
+			mark = "*"
+		}
+		status := "正常"
+		switch {
+		case state.disabled:
+			status = "已停用"
+		case now.Before(state.cooldownUntil):
+			status = fmt.Sprintf("冷却中 (剩余%v)", state.cooldownUntil.Sub(now).Round(time.Second))
+		}
+		fmt.Fprintf(&b, "%s %s  状态: %s  请求: %d  失败: %d", mark, maskKey(state.key), status, state.requests, state.failures)
+		if state.lastError != "" {
+			fmt.Fprintf(&b, "  最近错误: %s", state.lastError)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// maskKey 对密钥脱敏，只保留首尾少量字符
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+)
+
+// inputHistoryMax 输入历史最多保留的条数
+const inputHistoryMax = 1000
+
+// inputHistoryEntryMax 保存到历史中的单条输入的最大字节数，更长的输入（如粘贴的大段日志）不保存
+const inputHistoryEntryMax = 64 * 1024
+
+// continuationPrompt 多行输入中第二行起显示的提示符
+const continuationPrompt = "... "
+
+// inputPollInterval 后台读取输入时检查是否需要暂停（如打开外部编辑器）的间隔
+const inputPollInterval = 100 * time.Millisecond
+
+// 编辑输入行时识别的按键，控制字符之外的按键用负数表示
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27 // 转义序列的开头
+	keyBackspace = 127
+
+	keyUp = -iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyWordLeft
+	keyWordRight
+	keyAltEnter   // Alt+Enter，插入换行
+	keyPasteStart // 括号粘贴模式下粘贴内容的开头
+	keyPasteEnd   // 粘贴内容的结尾
+	keyUnknown
+)
+
+// defaultHistoryPath 默认的输入历史文件
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "history")
+}
+
+// inputHistory 主提示符下输入过的内容，追加保存到文件中，下次启动时可以继续使用
+type inputHistory struct {
+	path    string // 为空时只在本次运行中保留
+	entries []string
+}
+
+// loadInputHistory 读取历史文件，文件不存在时从空历史开始；条数远超上限时重写文件
+func loadInputHistory(path string) *inputHistory {
+	h := &inputHistory{path: path}
+	if path == "" {
+		return h
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, decodeHistoryEntry(line))
+		}
+	}
+	f.Close()
+	if len(h.entries) > inputHistoryMax {
+		overflow := len(h.entries) > 2*inputHistoryMax
+		h.entries = h.entries[len(h.entries)-inputHistoryMax:]
+		if overflow {
+			var b strings.Builder
+			for _, entry := range h.entries {
+				b.WriteString(encodeHistoryEntry(entry) + "\n")
+			}
+			writeFileAtomic(path, []byte(b.String()), 0600)
+		}
+	}
+	return h
+}
+
+// encodeHistoryEntry 把多行输入转换为带引号的一行保存，单行输入原样保存
+func encodeHistoryEntry(entry string) string {
+	if strings.Contains(entry, "\n") {
+		return strconv.Quote(entry)
+	}
+	return entry
+}
+
+// decodeHistoryEntry 还原encodeHistoryEntry保存的多行输入，恰好以引号开头的单行输入保持不变
+func decodeHistoryEntry(line string) string {
+	if strings.HasPrefix(line, `"`) {
+		if entry, err := strconv.Unquote(line); err == nil && strings.Contains(entry, "\n") {
+			return entry
+		}
+	}
+	return line
+}
+
+// add 记录一条输入，忽略空行、与上一条相同的输入、过长的输入和以空格开头的输入（用于不希望保存的内容，如临时的密钥）
+func (h *inputHistory) add(line string) {
+	line = strings.ReplaceAll(line, "\r\n", "\n")
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, " ") || len(line) > inputHistoryEntryMax {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > inputHistoryMax {
+		h.entries = h.entries[len(h.entries)-inputHistoryMax:]
+	}
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, encodeHistoryEntry(line))
+	f.Close()
+}
+
+// lineEditor 交互式终端上的行编辑：在主提示符下把终端切换到原始模式，支持光标移动、历史记录、Ctrl+R搜索和多行输入
+//
+// 任务执行期间终端保持普通模式，补充指示和确认的回答由终端自行回显，命令输出的换行不受影响。
+// 编辑时开启括号粘贴模式，粘贴的多行内容作为一条输入，不会在第一个换行处提交。
+type lineEditor struct {
+	in      *os.File
+	out     *os.File
+	history *inputHistory
+
+	mu      sync.Mutex
+	state   *term.State // 正在编辑时为切换前的终端状态
+	prompt  string
+	line    []rune
+	pos     int    // 光标在line中的位置
+	row     int    // 光标所在行相对于提示符所在行的偏移
+	browse  int    // 浏览历史时的位置，len(entries)表示正在编辑的新行
+	draft   string // 开始浏览历史前正在编辑的内容
+	cooked  []byte // 普通模式下尚未读到换行的输入
+	search  *historySearch
+	failed  bool   // 无法切换到原始模式，之后只显示提示符
+	pending []byte // 尚未处理的输入，可能以不完整的转义序列结尾
+	pasting bool   // 正在接收粘贴的内容
+	pasteCR bool   // 粘贴的内容中上一个字符是回车，紧接的换行忽略
+
+	pause chan chan struct{} // 暂停后台读取的请求，读取方收到后等待通道关闭再继续
+	done  chan struct{}      // 后台读取结束时关闭
+}
+
+// historySearch Ctrl+R反向搜索的状态
+type historySearch struct {
+	query []rune
+	match int    // 当前匹配的历史条目，-1表示没有匹配
+	saved []rune // 开始搜索前的输入，取消时恢复
+}
+
+// newLineEditor 创建行编辑器，in和out都必须是终端
+func newLineEditor(in, out *os.File, history *inputHistory) *lineEditor {
+	return &lineEditor{in: in, out: out, history: history, pause: make(chan chan struct{}), done: make(chan struct{})}
+}
+
+// begin 显示提示符并开始编辑新的一行，无法切换终端模式时只显示提示符
+func (e *lineEditor) begin(prompt string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.failed {
+		state, err := term.MakeRaw(int(e.in.Fd()))
+		if err == nil {
+			e.state = state
+		} else {
+			e.failed = true
+		}
+	}
+	if e.state == nil {
+		fmt.Fprint(e.out, prompt)
+		return
+	}
+	fmt.Fprint(e.out, "\x1b[?2004h")
+	// 普通模式下输入了一半的内容作为新行的开头
+	e.prompt, e.line, e.pos, e.row = prompt, []rune(strings.TrimRight(string(e.cooked), "\r")), 0, 0
+	e.pos, e.cooked = len(e.line), nil
+	e.browse, e.draft, e.search = len(e.history.entries), "", nil
+	e.refresh()
+}
+
+// restore 恢复终端原来的模式
+func (e *lineEditor) restore() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.finish()
+}
+
+// finish 结束编辑并恢复终端模式，调用时需持有锁
+func (e *lineEditor) finish() {
+	if e.state != nil {
+		fmt.Fprint(e.out, "\x1b[?2004l")
+		term.Restore(int(e.in.Fd()), e.state)
+		e.state = nil
+	}
+	e.pasting = false
+}
+
+// remember 把提交的输入加入历史，多行输入合并为一条
+func (e *lineEditor) remember(text string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.history.add(text)
+}
+
+// suspend 暂停后台读取，使外部程序（如编辑器）可以独占终端输入，调用返回的函数后继续读取
+func (e *lineEditor) suspend() (resume func()) {
+	ch := make(chan struct{})
+	select {
+	case e.pause <- ch:
+		return func() { close(ch) }
+	case <-e.done:
+		return func() {}
+	}
+}
+
+// wait 等待终端有输入可读，期间收到暂停请求时等待恢复，返回false表示需要重新等待
+func (e *lineEditor) wait() bool {
+	select {
+	case resume := <-e.pause:
+		<-resume
+		return false
+	default:
+	}
+	ready, err := waitInput(e.in, inputPollInterval)
+	// 无法等待时直接读取，此时不能暂停
+	return ready || err != nil
+}
+
+// deliver 把完成的行发送给读取方，等待期间也响应暂停请求
+func (e *lineEditor) deliver(lines chan<- string, line string) {
+	select {
+	case lines <- line:
+	case resume := <-e.pause:
+		<-resume
+		lines <- line
+	}
+}
+
+// run 在后台读取终端输入，把完整的行发送到lines，输入结束时返回
+func (e *lineEditor) run(lines chan<- string) error {
+	defer close(e.done)
+	buf := make([]byte, 4096)
+	for {
+		if !e.wait() {
+			continue
+		}
+		n, err := e.in.Read(buf)
+		completed, eof := e.feed(buf[:n])
+		for _, line := range completed {
+			e.deliver(lines, line)
+		}
+		if eof {
+			return nil
+		}
+		if err == io.EOF {
+			e.mu.Lock()
+			rest := string(e.cooked)
+			e.cooked = nil
+			e.mu.Unlock()
+			if rest != "" {
+				e.deliver(lines, rest)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// feed 处理读到的输入，返回完成的行；在空行上按Ctrl+D时eof为true
+func (e *lineEditor) feed(data []byte) (completed []string, eof bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending = append(e.pending, data...)
+	for len(e.pending) > 0 {
+		if e.state == nil {
+			// 普通模式下终端已经处理好编辑和回显
+			i := strings.IndexByte(string(e.pending), '\n')
+			if i < 0 {
+				e.cooked = append(e.cooked, e.pending...)
+				e.pending = nil
+				break
+			}
+			line := string(append(e.cooked, e.pending[:i]...))
+			e.cooked, e.pending = nil, e.pending[i+1:]
+			completed = append(completed, strings.TrimSuffix(line, "\r"))
+			continue
+		}
+		key, size := decodeKey(e.pending)
+		if size == 0 {
+			// 不完整的转义序列或UTF-8字符，等待后续输入
+			break
+		}
+		e.pending = e.pending[size:]
+		line, done, quit := e.handleKey(key)
+		if quit {
+			return completed, true
+		}
+		if done {
+			completed = append(completed, line)
+		}
+	}
+	return completed, false
+}
+
+// decodeKey 从输入开头解析一个按键，返回按键和占用的字节数，输入不完整时字节数为0
+func decodeKey(b []byte) (rune, int) {
+	if b[0] != keyEscape {
+		if b[0] < utf8.RuneSelf {
+			return rune(b[0]), 1
+		}
+		if !utf8.FullRune(b) {
+			return 0, 0
+		}
+		r, size := utf8.DecodeRune(b)
+		return r, size
+	}
+	if len(b) < 2 {
+		return 0, 0
+	}
+	switch b[1] {
+	case '\r', '\n':
+		return keyAltEnter, 2
+	case 'b':
+		return keyWordLeft, 2
+	case 'f':
+		return keyWordRight, 2
+	case '[', 'O':
+	default:
+		return keyUnknown, 2
+	}
+	// CSI序列以0x40-0x7e之间的字符结束
+	end := 2
+	for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+		end++
+	}
+	if end == len(b) {
+		return 0, 0
+	}
+	seq := string(b[2 : end+1])
+	keys := map[string]rune{
+		"A": keyUp, "B": keyDown, "C": keyRight, "D": keyLeft, "H": keyHome, "F": keyEnd,
+		"1~": keyHome, "7~": keyHome, "4~": keyEnd, "8~": keyEnd, "3~": keyDelete,
+		"1;5C": keyWordRight, "1;5D": keyWordLeft, "1;3C": keyWordRight, "1;3D": keyWordLeft,
+		"200~": keyPasteStart, "201~": keyPasteEnd,
+	}
+	if key, ok := keys[seq]; ok {
+		return key, end + 1
+	}
+	return keyUnknown, end + 1
+}
+
+// handleKey 处理一个按键，按回车时done为true并返回输入的行，在空行上按Ctrl+D时quit为true
+func (e *lineEditor) handleKey(key rune) (line string, done, quit bool) {
+	if e.pasting {
+		e.handlePasteKey(key)
+		return "", false, false
+	}
+	if e.search != nil {
+		if e.handleSearchKey(key) {
+			return "", false, false
+		}
+	}
+	switch key {
+	case keyEnter, keyLineFeed:
+		e.pos = len(e.line)
+		e.refresh()
+		fmt.Fprint(e.out, "\r\n")
+		line = string(e.line)
+		e.line, e.pos = nil, 0
+		e.finish()
+		return line, true, false
+	case keyCtrlD:
+		if len(e.line) == 0 {
+			fmt.Fprint(e.out, "\r\n")
+			e.finish()
+			return "", false, true
+		}
+		e.deleteRange(e.pos, e.pos+1)
+	case keyCtrlC:
+		// 与普通模式下空闲时按Ctrl+C相同，清空当前行
+		e.pos = len(e.line)
+		e.refresh()
+		fmt.Fprint(e.out, "^C\r\n(输入 exit 或 quit 退出)\r\n")
+		e.line, e.pos, e.row = nil, 0, 0
+		e.browse = len(e.history.entries)
+	case keyAltEnter:
+		e.insert([]rune{'\n'})
+	case keyPasteStart:
+		// 粘贴结束后再重新绘制，避免粘贴大段内容时逐字符刷新
+		e.pasting, e.pasteCR = true, false
+		return "", false, false
+	case keyPasteEnd:
+	case keyCtrlA, keyHome:
+		e.pos = e.lineStart(e.pos)
+	case keyCtrlE, keyEnd:
+		e.pos = e.lineEnd(e.pos)
+	case keyCtrlB, keyLeft:
+		e.pos = max(e.pos-1, 0)
+	case keyCtrlF, keyRight:
+		e.pos = min(e.pos+1, len(e.line))
+	case keyWordLeft:
+		e.pos = e.wordStart()
+	case keyWordRight:
+		for e.pos < len(e.line) && unicode.IsSpace(e.line[e.pos]) {
+			e.pos++
+		}
+		for e.pos < len(e.line) && !unicode.IsSpace(e.line[e.pos]) {
+			e.pos++
+		}
+	case keyBackspace, keyCtrlH:
+		e.deleteRange(e.pos-1, e.pos)
+	case keyDelete:
+		e.deleteRange(e.pos, e.pos+1)
+	case keyCtrlK:
+		// 在行尾时删除换行，与上下两行合并
+		e.deleteRange(e.pos, max(e.lineEnd(e.pos), e.pos+1))
+	case keyCtrlU:
+		e.deleteRange(e.lineStart(e.pos), e.pos)
+	case keyCtrlW:
+		e.deleteRange(e.wordStart(), e.pos)
+	case keyCtrlP, keyUp:
+		// 多行输入中先在行之间移动，到第一行后再浏览历史
+		if start := e.lineStart(e.pos); start > 0 {
+			e.moveToLine(e.lineStart(start-1), e.pos-start)
+		} else {
+			e.showHistory(e.browse - 1)
+		}
+	case keyCtrlN, keyDown:
+		if end := e.lineEnd(e.pos); end < len(e.line) {
+			e.moveToLine(end+1, e.pos-e.lineStart(e.pos))
+		} else {
+			e.showHistory(e.browse + 1)
+		}
+	case keyCtrlR:
+		e.search = &historySearch{match: -1, saved: append([]rune(nil), e.line...)}
+	case keyCtrlL:
+		fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		e.row = 0
+	case keyTab:
+		e.insert([]rune("    "))
+	default:
+		if key < ' ' || key == keyUnknown || !unicode.IsPrint(key) {
+			return "", false, false
+		}
+		e.insert([]rune{key})
+	}
+	e.refresh()
+	return "", false, false
+}
+
+// handlePasteKey 处理粘贴的内容，换行和制表符原样插入，不提交输入
+func (e *lineEditor) handlePasteKey(key rune) {
+	cr := e.pasteCR
+	e.pasteCR = key == keyEnter
+	switch {
+	case key == keyPasteEnd:
+		e.pasting = false
+		e.refresh()
+	case key == keyEnter || (key == keyLineFeed && !cr):
+		e.insert([]rune{'\n'})
+	case key == keyTab || (key >= ' ' && key != keyBackspace && unicode.IsPrint(key)):
+		e.insert([]rune{key})
+	}
+}
+
+// handleSearchKey 处理搜索中的按键，返回false表示结束搜索并把按键交给普通编辑处理
+func (e *lineEditor) handleSearchKey(key rune) bool {
+	s := e.search
+	switch {
+	case key == keyCtrlR:
+		// 继续向更早的历史查找
+		e.findHistory(s.match - 1)
+	case key == keyBackspace || key == keyCtrlH:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+			e.findHistory(len(e.history.entries) - 1)
+		}
+	case key == keyCtrlG || key == keyCtrlC:
+		e.line, e.pos, e.search = s.saved, len(s.saved), nil
+	case key >= ' ' && key != keyBackspace && unicode.IsPrint(key):
+		s.query = append(s.query, key)
+		start := s.match
+		if start < 0 {
+			start = len(e.history.entries) - 1
+		}
+		e.findHistory(start)
+	default:
+		// 其他按键接受当前的匹配结果
+		e.search = nil
+		e.browse = len(e.history.entries)
+		return false
+	}
+	e.refresh()
+	return true
+}
+
+// findHistory 从第from条向前查找包含搜索内容的历史，找到时显示该条
+func (e *lineEditor) findHistory(from int) {
+	s := e.search
+	for i := min(from, len(e.history.entries)-1); i >= 0; i-- {
+		if strings.Contains(e.history.entries[i], string(s.query)) {
+			s.match = i
+			e.line = []rune(e.history.entries[i])
+			e.pos = len(e.line)
+			return
+		}
+	}
+	if len(s.query) == 0 {
+		s.match = -1
+	}
+}
+
+// showHistory 显示第i条历史，超过最新一条时回到开始浏览前正在编辑的内容
+func (e *lineEditor) showHistory(i int) {
+	entries := e.history.entries
+	if i < 0 || i > len(entries) {
+		return
+	}
+	if e.browse == len(entries) {
+		e.draft = string(e.line)
+	}
+	e.browse = i
+	if i == len(entries) {
+		e.line = []rune(e.draft)
+	} else {
+		e.line = []rune(entries[i])
+	}
+	e.pos = len(e.line)
+}
+
+// insert 在光标处插入文本
+func (e *lineEditor) insert(text []rune) {
+	e.line = append(e.line[:e.pos], append(text, e.line[e.pos:]...)...)
+	e.pos += len(text)
+}
+
+// deleteRange 删除[from, to)之间的字符，光标移到from
+func (e *lineEditor) deleteRange(from, to int) {
+	from, to = max(from, 0), min(to, len(e.line))
+	if from >= to {
+		return
+	}
+	e.line = append(e.line[:from], e.line[to:]...)
+	e.pos = from
+}
+
+// lineStart 返回多行输入中i所在行的开头
+func (e *lineEditor) lineStart(i int) int {
+	for i > 0 && e.line[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// lineEnd 返回多行输入中i所在行的结尾（换行符的位置）
+func (e *lineEditor) lineEnd(i int) int {
+	for i < len(e.line) && e.line[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// moveToLine 把光标移到从start开始的一行的第col个字符，该行较短时移到行尾
+func (e *lineEditor) moveToLine(start, col int) {
+	e.pos = min(start+col, e.lineEnd(start))
+}
+
+// wordStart 返回光标左侧的单词开头
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.line[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+// refresh 重新绘制提示符和输入内容，按终端宽度计算自动折行和多行输入中光标的位置
+func (e *lineEditor) refresh() {
+	cols, _, err := term.GetSize(int(e.out.Fd()))
+	if err != nil || cols <= 0 {
+		cols = 80
+	}
+	prompt := e.prompt
+	if e.search != nil {
+		status := "搜索历史"
+		if e.search.match < 0 && len(e.search.query) > 0 {
+			status = "未找到"
+		}
+		prompt = fmt.Sprintf("(%s)'%s': ", status, string(e.search.query))
+	}
+
+	var b strings.Builder
+	if e.row > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", e.row)
+	}
+	b.WriteString("\r\x1b[J")
+	b.WriteString(prompt)
+	// row和col为下一个字符写入的位置，col等于cols时终端停在行尾，写入下一个字符前才换行
+	row, col := displayWidth(prompt)/cols, displayWidth(prompt)%cols
+	cursorRow, cursorCol := row, col
+	for i, r := range e.line {
+		text, w := string(r), displayWidth(string(r))
+		switch r {
+		case '\n':
+			text, w = "\r\n"+continuationPrompt, 0
+		case '\t':
+			text, w = "    ", 4
+		}
+		if col+w > cols {
+			row, col = row+1, 0
+		}
+		if i == e.pos {
+			cursorRow, cursorCol = row, col
+		}
+		b.WriteString(text)
+		if r == '\n' {
+			row, col = row+1, displayWidth(continuationPrompt)
+		} else {
+			col += w
+		}
+	}
+	// 正好写满一行时光标停在行尾，换到下一行开头使位置确定
+	if col >= cols {
+		b.WriteString("\r\n")
+		row, col = row+1, 0
+	}
+	if e.pos == len(e.line) {
+		cursorRow, cursorCol = row, col
+	}
+	if up := row - cursorRow; up > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", up)
+	}
+	b.WriteString("\r")
+	if cursorCol > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", cursorCol)
+	}
+	e.row = cursorRow
+	io.WriteString(e.out, b.String())
+}
+
+// displayWidth 返回文本在终端中占用的列数，中文等全角字符占两列
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r) || r < ' ':
+		case width.LookupRune(r).Kind() == width.EastAsianWide || width.LookupRune(r).Kind() == width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitInput 等待终端有输入可读，超时返回false；使用select是因为macOS上的poll不支持终端设备
+func waitInput(f *os.File, timeout time.Duration) (bool, error) {
+	fd := int(f.Fd())
+	var set unix.FdSet
+	set.Set(fd)
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	n, err := unix.Select(fd+1, &set, nil, nil, &tv)
+	if err == unix.EINTR {
+		return false, nil
+	}
+	return n > 0, err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 诊断信息的详细程度
+const (
+	logQuiet   = iota // 只显示错误和警告
+	logNormal         // 另外显示步骤、工具调用和各工具的操作
+	logVerbose        // 另外显示工具参数、结果预览和缓存、上下文等内部细节
+)
+
+// logLevelNames 各详细程度在配置说明中的名称
+var logLevelNames = []string{logQuiet: "quiet", logNormal: "normal", logVerbose: "verbose"}
+
+// resultPreviewLines 详细模式下工具结果预览的最大行数
+const resultPreviewLines = 10
+
+// 按日志开头的[标签]区分的类别
+const (
+	logKindInfo = iota
+	logKindError
+	logKindWarning
+	logKindTool
+	logKindResult
+	logKindStep
+	logKindDetail
+)
+
+// logKinds 需要特别显示的日志标签，其余标签按普通信息处理
+var logKinds = map[string]int{
+	"错误": logKindError,
+	"中断": logKindWarning, "警告": logKindWarning, "限流": logKindWarning, "重试": logKindWarning,
+	"预算": logKindWarning, "循环": logKindWarning, "截断": logKindWarning, "策略": logKindWarning,
+	"校验": logKindWarning, "提醒": logKindWarning,
+	"工具": logKindTool, "工具调用": logKindTool,
+	"结果": logKindResult,
+	"步骤": logKindStep,
+	"参数": logKindDetail, "缓存": logKindDetail, "历史": logKindDetail, "记录": logKindDetail,
+	"状态": logKindDetail, "上下文": logKindDetail, "用量": logKindDetail,
+}
+
+// logWriter 按详细程度过滤诊断信息并按类别着色，作为log包的输出
+//
+// log包保证每条日志只调用一次Write，因此可以按整条日志判断类别。
+type logWriter struct {
+	out   io.Writer
+	level int
+	color bool
+}
+
+// newLogWriter 创建写入out的诊断信息输出
+func newLogWriter(out io.Writer, level int, color bool) *logWriter {
+	return &logWriter{out: out, level: level, color: color}
+}
+
+// Write 实现io.Writer，低于详细程度的日志直接丢弃
+func (w *logWriter) Write(p []byte) (int, error) {
+	start, end := logTag(p)
+	if start < 0 {
+		// 没有标签的多为启动失败等致命错误，总是显示
+		return w.out.Write(p)
+	}
+	tag := string(p[start+1 : end])
+	if i := strings.IndexByte(tag, ' '); i >= 0 {
+		tag = tag[:i]
+	}
+	kind := logKinds[tag]
+	if logKindLevel(kind) > w.level {
+		return len(p), nil
+	}
+	if !w.color {
+		return w.out.Write(p)
+	}
+
+	var b bytes.Buffer
+	b.Write(p[:start])
+	switch kind {
+	case logKindError:
+		// 错误整条显示为红色
+		b.WriteString("\033[31m")
+		b.Write(bytes.TrimRight(p[start:], "\n"))
+		b.WriteString(styleReset)
+		b.Write(p[len(bytes.TrimRight(p, "\n")):])
+	default:
+		b.WriteString(logKindStyle(kind))
+		b.Write(p[start : end+1])
+		b.WriteString(styleReset)
+		b.Write(p[end+1:])
+	}
+	if _, err := w.out.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logTag 返回日志中第一个[标签]的起止位置，跳过log包添加的时间前缀，没有标签时返回-1
+func logTag(p []byte) (start, end int) {
+	start = bytes.IndexByte(p, '[')
+	if start < 0 || len(bytes.Trim(p[:start], "0123456789/:. \n")) > 0 {
+		return -1, -1
+	}
+	end = bytes.IndexByte(p[start:], ']')
+	if end < 0 || bytes.IndexByte(p[start:start+end], '\n') >= 0 {
+		return -1, -1
+	}
+	return start, start + end
+}
+
+// logKindLevel 返回显示该类日志所需的最低详细程度
+func logKindLevel(kind int) int {
+	switch kind {
+	case logKindError, logKindWarning:
+		return logQuiet
+	case logKindResult, logKindDetail:
+		return logVerbose
+	}
+	return logNormal
+}
+
+// logKindStyle 返回标签的ANSI样式
+func logKindStyle(kind int) string {
+	switch kind {
+	case logKindWarning:
+		return "\033[33m"
+	case logKindTool:
+		return styleBold + "\033[36m"
+	case logKindResult:
+		return "\033[32m"
+	case logKindStep:
+		return styleBold
+	case logKindDetail:
+		return styleDim
+	}
+	return "\033[34m"
+}
+
+// logLevel 返回配置的诊断信息详细程度
+func (c *Config) logLevel() int {
+	switch {
+	case c.Quiet:
+		return logQuiet
+	case c.Verbose:
+		return logVerbose
+	}
+	return logNormal
+}
+
+// colorDiagnostics 判断是否为标准错误上的诊断信息着色：未指定--plain、标准错误为终端且未设置NO_COLOR
+func (c *Config) colorDiagnostics() bool {
+	return !c.Plain && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stderr)
+}
+
+// resultPreview 返回详细模式下显示的工具结果开头几行，read_file的结果按文件的语言着色
+func resultPreview(call openai.ToolCall, result string, color bool) string {
+	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
+	more := 0
+	if len(lines) > resultPreviewLines {
+		lines, more = lines[:resultPreviewLines], len(lines)-resultPreviewLines
+	}
+
+	var code *highlighter
+	if color && call.Function.Name == "read_file" && strings.HasPrefix(result, "文件内容 (") {
+		var params struct {
+			Path string `json:"path"`
+		}
+		json.Unmarshal([]byte(call.Function.Arguments), &params)
+		code = newHighlighter(languageFor(params.Path))
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 && code != nil {
+			line = code.line(line)
+		}
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	if more > 0 {
+		fmt.Fprintf(&b, "  ...（另有%d行）\n", more)
+	}
+	return b.String()
+}
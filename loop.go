@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// loopDetector 检测模型连续使用相同参数重复调用工具
+type loopDetector struct {
+	threshold int // 连续相同调用达到该次数视为循环，0表示关闭检测
+	last      string
+	count     int
+	warned    bool // 本次任务是否已经提醒过模型
+}
+
+// observe 记录一步中的工具调用，连续相同次数达到阈值时返回true
+func (d *loopDetector) observe(calls []openai.ToolCall) bool {
+	if d.threshold <= 0 {
+		return false
+	}
+
+	sig := toolCallSignature(calls)
+	if sig == d.last {
+		d.count++
+	} else {
+		d.last = sig
+		d.count = 1
+	}
+
+	if d.count < d.threshold {
+		return false
+	}
+	d.count = 0
+	return true
+}
+
+// toolCallSignature 生成一组工具调用的规范化签名，参数JSON的键顺序不影响结果
+func toolCallSignature(calls []openai.ToolCall) string {
+	parts := make([]string, 0, len(calls))
+	for _, call := range calls {
+		args := call.Function.Arguments
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(args), &parsed); err == nil {
+			if normalized, err := json.Marshal(parsed); err == nil {
+				args = string(normalized)
+			}
+		}
+		parts = append(parts, call.Function.Name+"("+args+")")
+	}
+	return strings.Join(parts, ";")
+}
+
+// loopWarning 生成提醒模型更换策略的系统消息
+func loopWarning(calls []openai.ToolCall, times int) openai.ChatCompletionMessage {
+	names := make([]string, 0, len(calls))
+	for _, call := range calls {
+		names = append(names, call.Function.Name)
+	}
+	return openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleSystem,
+		Content: fmt.Sprintf("注意：你已经连续%d次使用完全相同的参数调用 %s，结果不会因此改变。"+
+			"请分析之前的输出，换一种方法解决问题；如果无法继续，请直接向用户说明失败原因。",
+			times, strings.Join(names, ", ")),
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -23,13 +27,15 @@ type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Sequential  bool                   `json:"-"` // 有副作用，不能与其他工具调用并发执行
+	Cacheable   bool                   `json:"-"` // 只读工具，同一轮任务内相同参数的结果可以缓存
 }
 
 // ToolCall 表示工具调用请求
 type ToolCall struct {
-	ID       string                 `json:"id"`
-	Type     string                 `json:"type"`
-	Function ToolFunction           `json:"function"`
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
 }
 
 // ToolFunction 表示工具函数
@@ -47,43 +53,177 @@ type ToolResult struct {
 
 // ECNUAgent ChatECNU Agent实现
 type ECNUAgent struct {
-	client      *openai.Client
-	model       string
-	tools       []Tool
-	history     []openai.ChatCompletionMessage
-	maxHistory  int
-	workingDir  string
+	backend    *backend   // 当前使用的端点
+	backends   []*backend // 主端点及备用端点
+	backendIdx int
+	limiter    *rateLimiter
+	usage      *usageTracker
+	recorder   *runRecorder
+
+	schemaFailures schemaTracker
+	toolStats      toolStats   // 本次会话中各工具的调用情况
+	outputs        outputStore // 被截断的完整工具输出
+	cache          toolCache   // 本轮任务内只读工具的结果缓存
+	plan           *taskPlan   // 最近一次先规划后执行的计划
+	turnStarts     []int       // 用户每次输入在历史中的位置，按顺序排列，用于划分对话轮次
+	activity       turnActivity
+	step           atomic.Int64           // 本轮任务进行到的步骤，供TUI状态栏显示
+	session        *sessionStore          // 会话状态的持久化，子智能体不保存
+	trash          *trashBin              // 本次会话删除和被覆盖文件的回收站
+	backups        *backupStore           // 覆盖文件前的原内容备份
+	undo           *undoJournal           // 本次会话可撤销的文件修改，子智能体与主智能体共用
+	sandbox        sandbox                // execute_command的执行环境，子智能体与主智能体共用
+	policy         *commandPolicy         // execute_command执行前检查的命令策略
+	dryRun         *dryRunLog             // 演练模式下未实际执行的工具调用，子智能体与主智能体共用
+	shell          *shellSession          // execute_command之间保持的当前目录和环境变量
+	monitor        *commandMonitor        // 实时显示命令输出，关闭时为nil，子智能体与主智能体共用
+	events         *eventWriter           // 单次运行时结构化输出的事件，--output=text时为nil
+	spinner        *spinner               // 等待模型回复和工具执行时显示的指示符，标准错误不是终端、--quiet和全屏界面下为nil
+	steering       *steeringQueue         // 任务执行期间用户输入的补充指示，非交互模式下为nil
+	approver       *approver              // 工具执行期间向用户确认操作，非交互模式下为nil
+	notifier       *notifier              // 耗时较长的任务结束或等待确认时提醒用户，未开启时为nil
+	images         imageQueue             // view_image读取、等待在工具结果之后发送的图片
+	attachments    imageQueue             // 通过/attach添加、随下一条输入发送的图片
+	searchResults  []sessionMatch         // 最近一次/search的结果，供/quote引用
+	quote          string                 // 通过/quote引用、加在下一条输入前面的内容
+	budget         *taskBudget            // 本轮任务的预算，子智能体与主智能体共用
+	subagent       bool                   // 子智能体不输出最终回复，也不能继续委派任务
+	outputSchema   map[string]interface{} // 约束最终回答的JSON Schema
+	console        io.Writer              // 提示信息的输出位置，JSON输出模式下为标准错误
+	lastInput      string                 // 最近一次作为任务执行的输入，供/retry重新执行
+	tools          []Tool
+	history        []openai.ChatCompletionMessage
+	workingDir     string
+	config         *Config
 }
 
 // NewECNUAgent 创建新的Agent实例
-func NewECNUAgent(apiKey string) (*ECNUAgent, error) {
-	// 加载环境变量
-	godotenv.Load()
+func NewECNUAgent(apiKey string, cfg *Config) (*ECNUAgent, error) {
+	if cfg == nil {
+		cfg = defaultConfig()
+	}
+
+	// 选择模型服务商
+	providers, err := loadProviders(cfg.ProvidersFile)
+	if err != nil {
+		return nil, err
+	}
+	provider, ok := providers[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("未知的服务商: %s（可选: %s）", cfg.Provider, strings.Join(providerNames(providers), ", "))
+	}
+	if cfg.BaseURL != "" {
+		provider.BaseURL = cfg.BaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = provider.DefaultModel
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("服务商%s未配置默认模型，请通过--model指定", provider.Name)
+	}
 
-	// 从环境变量获取API密钥（如果未提供）
-	if apiKey == "" {
-		apiKey = os.Getenv("ECNU_API_KEY")
-		if apiKey == "" {
-			return nil, fmt.Errorf("ECNU_API_KEY环境变量未设置")
+	// 从环境变量或密钥文件获取API密钥（如果未提供）
+	keys, err := provider.apiKeys(apiKey, cfg.KeysFile)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := loadPriceTable(cfg.PriceFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON输出模式下标准输出只保留最终的JSON，便于管道处理
+	schema, err := loadOutputSchema(cfg.JSONSchema)
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := newRunRecorder(cfg.RecordFile, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var session *sessionStore
+	if cfg.Persist {
+		if session, err = newSessionStore(cfg.StateDir, cfg.Session); err != nil {
+			return nil, err
 		}
 	}
 
-	// 获取工作目录
+	// 标准输出只留给JSON回答或单次运行的最终回答
+	var console io.Writer = os.Stdout
+	if cfg.jsonOutput() || cfg.Prompt != "" {
+		cfg.Stream = false
+		console = os.Stderr
+	}
+
+	// 获取工作目录，指定了工作区时使用工作区
 	wd, err := os.Getwd()
 	if err != nil {
 		wd = "."
 	}
+	if cfg.Workspace != "" {
+		if wd, err = filepath.Abs(cfg.Workspace); err != nil {
+			return nil, fmt.Errorf("解析工作区路径失败: %v", err)
+		}
+		if err := checkDirExists(wd); err != nil {
+			return nil, fmt.Errorf("工作区不可用: %v", err)
+		}
+	}
+
+	trashID := time.Now().Format("20060102-150405")
+	if session != nil {
+		trashID = session.id
+	}
+
+	// 创建OpenAI兼容客户端（chatECNU等服务均使用OpenAI兼容API）
+	primary := newBackend(provider, keys, "")
+	fallbacks, err := parseFallbacks(cfg.Fallbacks, providers)
+	if err != nil {
+		return nil, err
+	}
 
-	// 创建OpenAI兼容客户端（chatECNU使用OpenAI兼容API）
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = "https://chat.ecnu.edu.cn/open/api/v1"
-	client := openai.NewClientWithConfig(config)
+	policy, err := loadCommandPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	box, err := newSandbox(cfg, wd)
+	if err != nil {
+		return nil, err
+	}
+	// Pod模式下相对路径相对于Pod中的工作目录
+	if pod, ok := box.(*podSandbox); ok {
+		wd = pod.workdir
+	}
 
 	agent := &ECNUAgent{
-		client:     client,
-		model:      "ecnu-plus", // 使用推荐的模型
-		maxHistory: 20,          // 限制历史记录数量
-		workingDir: wd,
+		backend:      primary,
+		backends:     append([]*backend{primary}, fallbacks...),
+		limiter:      newRateLimiter(cfg.RequestsPerMinute, cfg.TokensPerMinute),
+		usage:        newUsageTracker(prices),
+		recorder:     recorder,
+		session:      session,
+		trash:        newTrashBin(trashID),
+		backups:      &backupStore{dir: defaultBackupRoot()},
+		undo:         &undoJournal{},
+		sandbox:      box,
+		policy:       policy,
+		dryRun:       &dryRunLog{},
+		shell:        &shellSession{box: box},
+		workingDir:   wd,
+		config:       cfg,
+		outputSchema: schema,
+		console:      console,
+	}
+
+	if cfg.LiveOutput && cfg.logLevel() > logQuiet {
+		agent.monitor = newCommandMonitor(os.Stderr)
+	}
+	if cfg.Prompt != "" {
+		agent.events = newEventWriter(os.Stdout, cfg.Output)
+	}
+	if !cfg.TUI && cfg.logLevel() > logQuiet {
+		agent.spinner = newSpinner(os.Stderr)
 	}
 
 	// 初始化工具列表
@@ -101,7 +241,8 @@ func (a *ECNUAgent) initTools() {
 		{
 			Type:        "function",
 			Name:        "execute_command",
-			Description: "在Linux命令行环境中执行系统命令。可以执行任何shell命令，包括管道、重定向等复杂操作。返回命令的标准输出、标准错误和退出码。",
+			Sequential:  true,
+			Description: "在命令行环境中执行系统命令。可以执行任何shell命令，包括管道、重定向等复杂操作。结果中exit_code为退出码，duration为实际耗时，cpu_time为CPU时间，max_rss为内存峰值，limits为生效的资源限制，标准输出和标准错误分别在<stdout>和<stderr>中，没有输出的一路省略。",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -114,6 +255,26 @@ func (a *ECNUAgent) initTools() {
 						"description": "命令超时时间（秒），默认30秒",
 						"default":     30,
 					},
+					"stdin": map[string]interface{}{
+						"type":        "string",
+						"description": "作为命令标准输入的内容，用于向python、bc、psql等程序输入数据，代替临时文件或heredoc；默认没有输入",
+					},
+					"cwd": map[string]interface{}{
+						"type":        "string",
+						"description": "只在本次调用中使用的执行目录，相对路径相对于工作区目录，代替cd dir &&；不影响之后的命令",
+					},
+					"env": map[string]interface{}{
+						"type":        "object",
+						"description": "只在本次调用中设置的环境变量，如{\"GOOS\": \"linux\"}，值为null表示删除该变量；不影响之后的命令",
+						"additionalProperties": map[string]interface{}{
+							"type": []string{"string", "null"},
+						},
+					},
+					"reset": map[string]interface{}{
+						"type":        "boolean",
+						"description": "执行前把shell恢复到工作区目录和启动时的环境变量，默认false",
+						"default":     false,
+					},
 				},
 				"required": []string{"command"},
 			},
@@ -121,7 +282,8 @@ func (a *ECNUAgent) initTools() {
 		{
 			Type:        "function",
 			Name:        "read_file",
-			Description: "读取文件内容。支持文本文件，自动处理UTF-8编码。如果文件不存在或无法读取，返回错误信息。",
+			Cacheable:   true,
+			Description: "读取文件内容。支持文本文件，自动处理UTF-8编码。如果文件不存在或无法读取，返回错误信息。文件较大时返回文件信息和第一部分，源代码和Markdown/LaTeX文档则返回带行号的函数、类或标题大纲，可用symbol读取某个定义，或用offset和limit按行分页读取。二进制文件只返回类型和大小，可用hexdump查看开头的字节。",
 			Parameters: map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
@@ -129,6 +291,29 @@ func (a *ECNUAgent) initTools() {
 						"type":        "string",
 						"description": "要读取的文件路径（绝对路径或相对路径）",
 					},
+					"offset": map[string]interface{}{
+						"type":        "integer",
+						"description": "从第几行开始读取（从1开始），默认从第1行开始",
+						"minimum":     1,
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "最多读取的行数，默认读取到文件末尾或大小上限",
+						"minimum":     1,
+					},
+					"hexdump": map[string]interface{}{
+						"type":        "integer",
+						"description": "读取二进制文件时以十六进制显示开头的字节数，默认0（不显示），最多4096",
+						"minimum":     0,
+					},
+					"outline": map[string]interface{}{
+						"type":        "boolean",
+						"description": "只返回文件的大纲（函数、类型、类和标题及其行范围），支持Go、Python、JS/TS、Java、C/C++、Rust、Shell、Markdown和LaTeX",
+					},
+					"symbol": map[string]interface{}{
+						"type":        "string",
+						"description": "只读取该函数、类型或标题的完整定义，可写作\"Name\"或\"Type.Name\"",
+					},
 				},
 				"required": []string{"path"},
 			},
@@ -136,6 +321,7 @@ func (a *ECNUAgent) initTools() {
 		{
 			Type:        "function",
 			Name:        "write_file",
+			Sequential:  true,
 			Description: "写入或创建文件。如果文件不存在会自动创建，如果目录不存在会自动创建父目录。写入前会先读取文件内容（如果存在）进行确认。",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -153,6 +339,12 @@ func (a *ECNUAgent) initTools() {
 						"description": "是否追加模式，默认false（覆盖）",
 						"default":     false,
 					},
+					"encoding": map[string]interface{}{
+						"type":        "string",
+						"description": "写入文件使用的编码，默认utf-8",
+						"enum":        []string{"utf-8", "utf-8-bom", "gbk", "gb18030", "utf-16", "utf-16le", "utf-16be"},
+						"default":     "utf-8",
+					},
 				},
 				"required": []string{"path", "content"},
 			},
@@ -160,6 +352,7 @@ func (a *ECNUAgent) initTools() {
 		{
 			Type:        "function",
 			Name:        "list_directory",
+			Cacheable:   true,
 			Description: "列出目录内容。返回目录中的文件和子目录列表。",
 			Parameters: map[string]interface{}{
 				"type": "object",
@@ -175,6 +368,7 @@ func (a *ECNUAgent) initTools() {
 		{
 			Type:        "function",
 			Name:        "get_working_directory",
+			Cacheable:   true,
 			Description: "获取当前工作目录的绝对路径。",
 			Parameters: map[string]interface{}{
 				"type":       "object",
@@ -182,6 +376,23 @@ func (a *ECNUAgent) initTools() {
 			},
 		},
 	}
+
+	a.tools = append(a.tools, editFileTool, searchReplaceTool, findFilesTool, searchContentTool, treeTool, statFileTool,
+		moveFileTool, copyFileTool, deleteFileTool, makeDirectoryTool, changePermissionsTool,
+		checksumTool, compareFilesTool, archiveTool, diffFilesTool, undoLastChangeTool, watchPathTool, tailFileTool, readPDFTool, readTableTool, viewImageTool, queryDataTool, querySQLiteTool, downloadFileTool, transferFileTool, scaffoldProjectTool, manageProcessesTool, manageServiceTool, managePackagesTool, gitTool, codeHostTool, checkNetworkTool, readToolOutputTool)
+	if !a.subagent {
+		a.tools = append(a.tools, spawnAgentTool)
+	}
+	if _, ok := a.sandbox.(*podSandbox); ok {
+		a.tools = podTools(a.tools)
+	} else if _, ok := a.sandbox.(hostSandbox); !ok {
+		a.tools = sandboxTools(a.tools)
+	}
+	// a.tools[0]为execute_command
+	a.tools[0].Description += a.sandbox.note()
+	if a.config.ShellSession {
+		a.tools[0].Description += "cd切换的目录和export导出的环境变量（包括激活的Python虚拟环境）会保留到之后的命令，未导出的变量、函数和别名不会保留。"
+	}
 }
 
 // initSystemPrompt 初始化系统提示
@@ -190,6 +401,10 @@ func (a *ECNUAgent) initSystemPrompt() {
 	username := "unknown"
 	if currentUser != nil {
 		username = currentUser.Username
+		// Windows上的用户名带有域名，如DESKTOP-ABC\alice
+		if i := strings.LastIndex(username, `\`); i >= 0 && runtime.GOOS == "windows" {
+			username = username[i+1:]
+		}
 	}
 
 	hostname, _ := os.Hostname()
@@ -197,24 +412,32 @@ func (a *ECNUAgent) initSystemPrompt() {
 		hostname = "unknown"
 	}
 
-	systemPrompt := fmt.Sprintf(`你是一个强大的AI助手，被设计为一个可以在Linux命令行环境中执行任务的智能代理。
+	systemPrompt := fmt.Sprintf(`你是一个强大的AI助手，被设计为一个可以在%s命令行环境中执行任务的智能代理。
 
 环境信息：
+- 操作系统: %s
 - 当前工作目录: %s
 - 当前用户: %s
 - 主机名: %s
-- 当前时间: %s
+- 当前时间: %s%s
 
 重要规则：
 1. 你可以使用提供的工具来执行命令、读写文件、列出目录等操作。
 2. 在执行任何写入文件或修改系统的关键操作前，务必先读取文件内容或检查当前状态，确认后再执行。
-3. 你拥有执行系统命令的权限，如果需要sudo权限，可以在命令前加'sudo'。
-4. 每次只执行一个工具调用，等待结果后再决定下一步操作。
+3. 你拥有执行系统命令的权限，%s使用sudo、删除或覆盖文件、卸载软件包等危险操作会先显示给用户确认，用户拒绝后不要换一种写法绕过，应询问用户的意见。
+4. 互不依赖的只读操作（如读取几个文件、搜索不同的关键词）可以在一次回复中同时发起多个工具调用；后一步依赖前一步的结果或会修改文件、系统状态时，等待结果后再决定下一步操作。
 5. 你的回答应该简洁明了，专注于任务本身。
 6. 如果遇到错误，分析错误信息并尝试修复。
 7. 完成任务后，使用自然语言向用户说明结果。
 
-请使用工具来完成用户的任务。`, a.workingDir, username, hostname, time.Now().Format("2006-01-02 15:04:05"))
+请使用工具来完成用户的任务。`, a.commandOS(), a.systemName(), a.workingDir, username, hostname, time.Now().Format("2006-01-02 15:04:05"), a.environmentNote(), a.privilegeRule())
+
+	if a.config.ToolMode == toolModeReact {
+		systemPrompt += reactPrompt(a.tools)
+	}
+	if a.responseFormat() != nil {
+		systemPrompt += jsonOutputPrompt(a.outputSchema)
+	}
 
 	a.history = []openai.ChatCompletionMessage{
 		{
@@ -224,79 +447,270 @@ func (a *ECNUAgent) initSystemPrompt() {
 	}
 }
 
-// truncateHistory 截断历史记录以控制上下文长度
+// commandOS 返回命令所在的操作系统，容器和Pod中总是Linux
+func (a *ECNUAgent) commandOS() string {
+	if _, ok := a.sandbox.(hostSandbox); ok {
+		return hostOSName()
+	}
+	return "Linux"
+}
+
+// systemName 返回系统提示中的操作系统版本，容器和Pod中的版本未知
+func (a *ECNUAgent) systemName() string {
+	if host, ok := a.sandbox.(hostSandbox); ok {
+		return host.env.system
+	}
+	return "Linux"
+}
+
+// privilegeRule 返回系统提示中如何获取管理员权限的说明，本机没有sudo时不再建议使用
+func (a *ECNUAgent) privilegeRule() string {
+	host, ok := a.sandbox.(hostSandbox)
+	switch {
+	case !ok || slices.Contains(host.env.tools, "sudo"):
+		return "如果需要sudo权限，可以在命令前加'sudo'。"
+	case runtime.GOOS == "windows":
+		return "需要管理员权限的操作请告诉用户以管理员身份运行。"
+	case os.Geteuid() == 0:
+		return "当前为root用户，不需要sudo。"
+	}
+	return "本机没有sudo，需要管理员权限的操作请告诉用户手动执行。"
+}
+
+// environmentNote 返回系统提示中的命令解释器、已安装的命令和执行环境说明
+func (a *ECNUAgent) environmentNote() string {
+	note := ""
+	if host, ok := a.sandbox.(hostSandbox); ok {
+		note += host.env.prompt(host.shell)
+	}
+	if desc := a.sandbox.describe(); desc != "" {
+		note += "\n- 执行环境: " + desc
+	}
+	if a.config.DryRun {
+		note += "\n- 当前为演练模式：命令和修改文件等操作不会实际执行，只返回模拟结果，读取文件等只读工具照常执行。请照常调用工具完成任务，给出完整的计划和命令"
+	}
+	if a.config.WorkspaceOnly {
+		note += "\n- 只能访问工作区内的文件，读写工作区之外路径的工具调用和命令会被拒绝"
+	}
+	return note
+}
+
+// truncateHistory 按配置的token预算截断历史记录以控制上下文长度
 func (a *ECNUAgent) truncateHistory() {
-	if len(a.history) <= a.maxHistory {
+	a.truncateHistoryTo(a.config.HistoryTokens)
+}
+
+// truncateHistoryTo 按给定的token预算和最大消息数截断历史记录，budget为0时只按消息数截断
+//
+// 系统消息始终保留；助手的工具调用与对应的工具结果作为一个整体删除，
+// 避免留下孤立的工具结果；最近一组消息即使超出预算也会保留。
+func (a *ECNUAgent) truncateHistoryTo(budget int) {
+	if len(a.history) <= 1 {
+		return
+	}
+
+	maxHistory := a.config.MaxHistory
+	groups := groupMessages(a.history[1:])
+
+	total := estimateHistoryTokens(a.history)
+	count := len(a.history)
+	drop := 0
+	dropped := 0
+	for drop < len(groups)-1 {
+		overTokens := budget > 0 && total > budget
+		overCount := maxHistory > 0 && count > maxHistory
+		if !overTokens && !overCount {
+			break
+		}
+		for _, msg := range groups[drop] {
+			total -= estimateMessageTokens(msg)
+			count--
+			dropped++
+		}
+		drop++
+	}
+	if drop == 0 {
 		return
 	}
 
-	// 保留系统消息和最近的对话
 	newHistory := []openai.ChatCompletionMessage{a.history[0]} // 系统消息
-	startIdx := len(a.history) - a.maxHistory + 1
-	if startIdx < 1 {
-		startIdx = 1
+	for _, group := range groups[drop:] {
+		newHistory = append(newHistory, group...)
 	}
-	newHistory = append(newHistory, a.history[startIdx:]...)
 	a.history = newHistory
+	a.shiftTurns(dropped, 0)
+	log.Printf("[历史] 已截断 %d 条早期消息，剩余约 %d tokens\n", dropped, total)
+}
+
+// groupMessages 将消息按轮次分组，工具结果归入发起调用的助手消息所在组
+func groupMessages(messages []openai.ChatCompletionMessage) [][]openai.ChatCompletionMessage {
+	var groups [][]openai.ChatCompletionMessage
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleTool && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], msg)
+			continue
+		}
+		groups = append(groups, []openai.ChatCompletionMessage{msg})
+	}
+	return groups
+}
+
+// markTurn 记录用户的一次输入从历史的当前位置开始，之后被删除的位置上的记录一并丢弃
+func (a *ECNUAgent) markTurn() {
+	a.dropTurnsFrom(len(a.history))
+	a.turnStarts = append(a.turnStarts, len(a.history))
+}
+
+// dropTurnsFrom 丢弃从历史中pos及之后的位置开始的轮次，用于删除历史末尾的消息之后
+func (a *ECNUAgent) dropTurnsFrom(pos int) {
+	for len(a.turnStarts) > 0 && a.turnStarts[len(a.turnStarts)-1] >= pos {
+		a.turnStarts = a.turnStarts[:len(a.turnStarts)-1]
+	}
+}
+
+// shiftTurns 在系统消息之后的removed条消息被删除、插入inserted条消息后更新各轮的开始位置，开头被删除的轮次不再记录
+//
+// 结果不为nil，保存后可以与早期版本没有记录轮次的会话区分。
+func (a *ECNUAgent) shiftTurns(removed, inserted int) {
+	starts := []int{}
+	for _, start := range a.turnStarts {
+		if start > removed {
+			starts = append(starts, start-removed+inserted)
+		}
+	}
+	a.turnStarts = starts
 }
 
 // callModel 调用chatECNU API
 func (a *ECNUAgent) callModel(ctx context.Context, userInput string, maxRetries int) (*openai.ChatCompletionResponse, error) {
 	// 添加用户消息
 	if userInput != "" {
-		a.history = append(a.history, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: userInput,
-		})
+		a.history = append(a.history, a.userMessage(userInput))
 	}
+	a.injectSteering()
 
-	// 截断历史
+	// 压缩并截断历史
+	a.compactHistory(ctx)
 	a.truncateHistory()
 
-	// 准备工具定义
-	tools := make([]openai.Tool, len(a.tools))
-	for i, tool := range a.tools {
-		paramsBytes, _ := json.Marshal(tool.Parameters)
-		tools[i] = openai.Tool{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        tool.Name,
-				Description: tool.Description,
-				Parameters:  paramsBytes,
-			},
+	// 准备工具定义，ReAct模式下工具已写入系统提示词
+	var tools []openai.Tool
+	if a.config.ToolMode != toolModeReact {
+		tools = make([]openai.Tool, len(a.tools))
+		for i, tool := range a.tools {
+			paramsBytes, _ := json.Marshal(tool.Parameters)
+			tools[i] = openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  paramsBytes,
+				},
+			}
+		}
+	}
+
+	if err := a.preflight(ctx, tools); err != nil {
+		return nil, err
+	}
+	a.saveState()
+
+	return a.complete(ctx, tools, a.responseFormat(), maxRetries)
+}
+
+// complete 用当前历史请求模型，当前端点不可用时切换到备用端点
+func (a *ECNUAgent) complete(ctx context.Context, tools []openai.Tool, format *openai.ChatCompletionResponseFormat, maxRetries int) (*openai.ChatCompletionResponse, error) {
+	for {
+		resp, err := a.requestWithRetries(ctx, tools, format, maxRetries)
+		if err == nil || ctx.Err() != nil || !isRetryable(err) || !a.failover(err) {
+			return resp, err
 		}
 	}
+}
 
+// requestWithRetries 向当前端点发送请求，失败时按退避策略重试
+func (a *ECNUAgent) requestWithRetries(ctx context.Context, tools []openai.Tool, format *openai.ChatCompletionResponseFormat, maxRetries int) (*openai.ChatCompletionResponse, error) {
 	var lastErr error
+	rotated := false
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			backoff := time.Duration(attempt) * time.Second
-			log.Printf("[重试 %d/%d] 等待 %v 后重试...\n", attempt+1, maxRetries, backoff)
-			time.Sleep(backoff)
+		// 切换密钥后立即重试，无需退避
+		if attempt > 0 && !rotated {
+			backoff := a.retryDelay(attempt, lastErr)
+			log.Printf("[重试 %d/%d] 等待 %v 后重试...\n", attempt+1, maxRetries, backoff.Round(time.Millisecond))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
 		}
 
 		req := openai.ChatCompletionRequest{
-			Model:       a.model,
-			Messages:    a.history,
-			Temperature: 0.2,
-			Tools:       tools,
+			Model:          a.model(),
+			Messages:       a.history,
+			Tools:          tools,
+			ResponseFormat: format,
+		}
+		a.config.applySampling(&req)
+		if a.config.ToolMode == toolModeReact && len(req.Stop) < 4 {
+			req.Stop = append(append([]string(nil), req.Stop...), reactStop)
 		}
 
-		resp, err := a.client.CreateChatCompletion(ctx, req)
+		resp, err := a.createCompletion(ctx, req)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			lastErr = err
 			log.Printf("[错误] API调用失败 (尝试 %d/%d): %v\n", attempt+1, maxRetries, err)
+			var from, to string
+			if from, to, rotated = a.backend.keys.rotate(err); rotated {
+				log.Printf("[密钥] 密钥 %s 受限，切换到 %s\n", from, to)
+				continue
+			}
+			if !isRetryable(err) {
+				return nil, fmt.Errorf("API调用失败（错误不可重试）: %w", err)
+			}
 			continue
 		}
 
 		return &resp, nil
 	}
 
-	return nil, fmt.Errorf("API调用失败，已重试%d次: %v", maxRetries, lastErr)
+	return nil, fmt.Errorf("API调用失败，已重试%d次: %w", maxRetries, lastErr)
+}
+
+// createCompletion 发送一次补全请求，服务端不支持流式时自动回退为非流式
+func (a *ECNUAgent) createCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	record, err := a.throttle(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	if a.config.Stream {
+		resp, err := a.streamCompletion(ctx, req)
+		if !errors.Is(err, errStreamUnsupported) {
+			record(resp.Usage)
+			a.recorder.recordCompletion(a.backend.String(), req, resp, err)
+			if err == nil {
+				a.usage.record(req.Model, req, resp)
+			}
+			return resp, err
+		}
+		log.Printf("[提示] 服务端不支持流式响应，已切换为非流式模式\n")
+		a.config.Stream = false
+	}
+
+	resp, err := a.backend.client.CreateChatCompletion(ctx, req)
+	record(resp.Usage)
+	a.recorder.recordCompletion(a.backend.String(), req, resp, err)
+	if err == nil {
+		a.usage.record(req.Model, req, resp)
+	}
+	return resp, err
 }
 
 // executeTool 执行工具调用
-func (a *ECNUAgent) executeTool(toolCall openai.ToolCall) (string, error) {
+func (a *ECNUAgent) executeTool(ctx context.Context, toolCall openai.ToolCall) (string, error) {
 	function := toolCall.Function
 	name := function.Name
 	args := function.Arguments
@@ -304,66 +718,128 @@ func (a *ECNUAgent) executeTool(toolCall openai.ToolCall) (string, error) {
 	log.Printf("[工具调用] %s\n", name)
 	log.Printf("[参数] %s\n", args)
 
+	// 只执行提供给模型的工具，沙箱和Pod模式下去掉的工具即使被调用也不执行
+	known := false
+	for _, tool := range a.tools {
+		if tool.Name == name {
+			if result, ok := a.checkToolArguments(tool, args); !ok {
+				return result, nil
+			}
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "", fmt.Errorf("未知的工具: %s", name)
+	}
+
+	if a.config.WorkspaceOnly {
+		if result := a.checkToolPaths(args); result != "" {
+			return result, nil
+		}
+	}
+
+	if a.config.DryRun && !a.dryRunExecutes(name, args) {
+		return a.simulateToolCall(toolCall), nil
+	}
+
+	// Pod模式下文件工具读写Pod中的文件
+	if pod, ok := a.sandbox.(*podSandbox); ok {
+		if result, handled, err := a.executePodTool(ctx, pod, name, args); handled {
+			return result, err
+		}
+	}
+
 	switch name {
 	case "execute_command":
-		return a.executeCommand(args)
+		return a.executeCommand(ctx, args)
 	case "read_file":
 		return a.readFile(args)
 	case "write_file":
-		return a.writeFile(args)
+		return a.writeFile(ctx, args)
+	case "edit_file":
+		return a.editFile(args)
+	case "search_replace":
+		return a.searchReplace(args)
+	case "find_files":
+		return a.findFiles(args)
+	case "search_content":
+		return a.searchContent(ctx, args)
+	case "tree":
+		return a.tree(args)
+	case "stat_file":
+		return a.statFile(args)
+	case "move_file":
+		return a.moveFile(ctx, args)
+	case "copy_file":
+		return a.copyFile(ctx, args)
+	case "delete_file":
+		return a.deleteFile(ctx, args)
+	case "make_directory":
+		return a.makeDirectory(args)
+	case "change_permissions":
+		return a.changePermissions(args)
+	case "checksum":
+		return a.checksum(args)
+	case "compare_files":
+		return a.compareFiles(args)
+	case "archive":
+		return a.archive(ctx, args)
+	case "diff_files":
+		return a.diffFiles(args)
+	case "undo_last_change":
+		return a.undoLastChange(args)
+	case "watch_path":
+		return a.watchPath(ctx, args)
+	case "tail_file":
+		return a.tailFile(ctx, args)
+	case "read_pdf":
+		return a.readPDF(ctx, args)
+	case "read_table":
+		return a.readTable(args)
+	case "view_image":
+		return a.viewImage(args)
+	case "query_data":
+		return a.queryData(args)
+	case "query_sqlite":
+		return a.querySQLite(ctx, args)
+	case "download_file":
+		return a.downloadFile(ctx, args)
+	case "transfer_file":
+		return a.transferFile(ctx, args)
+	case "scaffold_project":
+		return a.scaffoldProject(args)
 	case "list_directory":
 		return a.listDirectory(args)
 	case "get_working_directory":
 		return a.getWorkingDirectory(args)
+	case "manage_processes":
+		return a.manageProcesses(ctx, args)
+	case "manage_service":
+		return a.manageService(ctx, args)
+	case "manage_packages":
+		return a.managePackages(ctx, args)
+	case "git":
+		return a.gitManage(ctx, args)
+	case "code_host":
+		return a.codeHostAction(ctx, args)
+	case "check_network":
+		return a.checkNetwork(ctx, args)
+	case "read_tool_output":
+		return a.readToolOutput(args)
+	case "spawn_agent":
+		return a.spawnAgent(ctx, args)
 	default:
 		return "", fmt.Errorf("未知的工具: %s", name)
 	}
 }
 
-// executeCommand 执行系统命令
-func (a *ECNUAgent) executeCommand(args string) (string, error) {
-	var params map[string]interface{}
-	if err := json.Unmarshal([]byte(args), &params); err != nil {
-		return "", fmt.Errorf("解析参数失败: %v", err)
-	}
-
-	command, ok := params["command"].(string)
-	if !ok {
-		return "", fmt.Errorf("缺少command参数")
-	}
-
-	timeout := 30
-	if t, ok := params["timeout"].(float64); ok {
-		timeout = int(t)
-	}
-
-	log.Printf("[执行命令] %s (超时: %d秒)\n", command, timeout)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "sh", "-c", command)
-	cmd.Dir = a.workingDir
-	output, err := cmd.CombinedOutput()
-
-	var exitCode int
-	if cmd.ProcessState != nil {
-		exitCode = cmd.ProcessState.ExitCode()
-	} else if err != nil {
-		exitCode = -1
-	}
-
-	result := fmt.Sprintf("命令: %s\n退出码: %d\n", command, exitCode)
-	if len(output) > 0 {
-		result += fmt.Sprintf("输出:\n%s", string(output))
-	}
-	if err != nil && ctx.Err() == context.DeadlineExceeded {
-		result += fmt.Sprintf("\n错误: 命令执行超时（%d秒）", timeout)
-	} else if err != nil {
-		result += fmt.Sprintf("\n错误: %v", err)
+// resolvePath 将相对路径解析为基于工作目录的绝对路径
+func (a *ECNUAgent) resolvePath(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.workingDir, path)
 	}
-
-	return result, nil
+	return filepath.Clean(path)
 }
 
 // readFile 读取文件
@@ -377,13 +853,14 @@ func (a *ECNUAgent) readFile(args string) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("缺少path参数")
 	}
+	offset, _ := params["offset"].(float64)
+	limit, _ := params["limit"].(float64)
+	hexdumpLen, _ := params["hexdump"].(float64)
+	outline, _ := params["outline"].(bool)
+	symbol, _ := params["symbol"].(string)
 
 	// 解析路径
-	fullPath := path
-	if !filepath.IsAbs(path) {
-		fullPath = filepath.Join(a.workingDir, path)
-	}
-	fullPath = filepath.Clean(fullPath)
+	fullPath := a.resolvePath(path)
 
 	log.Printf("[读取文件] %s\n", fullPath)
 
@@ -391,12 +868,80 @@ func (a *ECNUAgent) readFile(args string) (string, error) {
 	if err != nil {
 		return fmt.Sprintf("读取文件失败: %v", err), nil
 	}
+	text, encoding, ok := decodeText(content)
+	if !ok {
+		return binaryFileSummary(fullPath, content, int(hexdumpLen)), nil
+	}
+	label := fullPath
+	if encoding != encodingUTF8 {
+		label += "，编码" + encoding.name + "，已转换为UTF-8"
+	}
 
-	return fmt.Sprintf("文件内容 (%s):\n%s", fullPath, string(content)), nil
+	maxBytes := a.config.ReadLimit
+	if symbol != "" {
+		return readSymbol(label, fullPath, text, symbol, maxBytes), nil
+	}
+	if outline {
+		lang := outlineLanguageFor(fullPath)
+		if lang == nil {
+			return fmt.Sprintf("读取文件失败: 不支持生成%s文件的大纲，请使用offset和limit", filepath.Ext(fullPath)), nil
+		}
+		lines := splitLines(text)
+		return formatOutline(label, lang, buildOutline(lang, lines), len(lines), maxBytes), nil
+	}
+	if offset == 0 && limit == 0 && (maxBytes == 0 || len(text) <= maxBytes) {
+		return fmt.Sprintf("文件内容 (%s):\n%s", label, text), nil
+	}
+	// 超过上限的源代码返回大纲，比只显示开头更容易找到需要的部分
+	if lang := outlineLanguageFor(fullPath); offset == 0 && limit == 0 && lang != nil {
+		lines := splitLines(text)
+		if symbols := buildOutline(lang, lines); len(symbols) > 0 {
+			return fmt.Sprintf("文件大小%d字节超过单次读取上限%d字节，以下为文件大纲。\n", len(text), maxBytes) + formatOutline(label, lang, symbols, len(lines), maxBytes), nil
+		}
+	}
+	return readFilePage(label, text, int(offset), int(limit), maxBytes), nil
+}
+
+// readFilePage 返回文件中从第offset行开始的最多limit行，总大小不超过maxBytes，并说明如何继续读取
+func readFilePage(label, content string, offset, limit, maxBytes int) string {
+	lines := splitLines(content)
+	if offset == 0 {
+		offset = 1
+	}
+	if offset > len(lines) {
+		return fmt.Sprintf("读取文件失败: 起始行%d超出范围，文件共%d行", offset, len(lines))
+	}
+
+	end := len(lines)
+	if limit > 0 && offset-1+limit < end {
+		end = offset - 1 + limit
+	}
+	var b strings.Builder
+	size := 0
+	for i := offset - 1; i < end; i++ {
+		line := lines[i]
+		if maxBytes > 0 && size+len(line)+1 > maxBytes {
+			if i > offset-1 {
+				end = i
+				break
+			}
+			// 单行就超过上限时只返回该行的开头
+			line = truncateBytes(line, maxBytes) + " ...（该行过长，已截断）"
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+		size += len(line) + 1
+	}
+
+	header := fmt.Sprintf("文件内容 (%s，第%d-%d行，共%d行，%d字节):\n", label, offset, end, len(lines), len(content))
+	if end < len(lines) {
+		fmt.Fprintf(&b, "\n...（文件还有%d行未显示，可使用offset=%d继续读取）", len(lines)-end, end+1)
+	}
+	return header + b.String()
 }
 
 // writeFile 写入文件
-func (a *ECNUAgent) writeFile(args string) (string, error) {
+func (a *ECNUAgent) writeFile(ctx context.Context, args string) (string, error) {
 	var params map[string]interface{}
 	if err := json.Unmarshal([]byte(args), &params); err != nil {
 		return "", fmt.Errorf("解析参数失败: %v", err)
@@ -417,6 +962,16 @@ func (a *ECNUAgent) writeFile(args string) (string, error) {
 		append = a
 	}
 
+	name, _ := params["encoding"].(string)
+	encoding, err := lookupEncoding(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := encoding.encode(content)
+	if err != nil {
+		return fmt.Sprintf("写入文件失败: %v", err), nil
+	}
+
 	// 解析路径
 	fullPath := path
 	if !filepath.IsAbs(path) {
@@ -426,29 +981,46 @@ func (a *ECNUAgent) writeFile(args string) (string, error) {
 
 	log.Printf("[写入文件] %s (追加: %v)\n", fullPath, append)
 
+	if !append {
+		ok, err := a.confirmOverwrite(ctx, fullPath, content)
+		if err != nil {
+			return fmt.Sprintf("写入文件失败: 覆盖%s需要用户确认: %v", fullPath, err), nil
+		}
+		if !ok {
+			return fmt.Sprintf("用户拒绝覆盖文件 %s，文件未修改。请询问用户原因或换一种方式完成任务。", fullPath), nil
+		}
+	}
+
 	// 创建父目录
 	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
 		return "", fmt.Errorf("创建目录失败: %v", err)
 	}
 
-	// 写入文件
-	flags := os.O_WRONLY | os.O_CREATE
-	if append {
-		flags |= os.O_APPEND
-	} else {
-		flags |= os.O_TRUNC
-	}
-
-	file, err := os.OpenFile(fullPath, flags, 0644)
+	change, err := a.snapshotFile(fullPath)
 	if err != nil {
-		return "", fmt.Errorf("打开文件失败: %v", err)
+		return fmt.Sprintf("写入文件失败: %v", err), nil
 	}
-	defer file.Close()
 
-	if _, err := file.WriteString(content); err != nil {
+	// 覆盖写入时先写临时文件再重命名，追加时直接写入原文件
+	if append {
+		file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return "", fmt.Errorf("打开文件失败: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := file.Write(data); err != nil {
+			return "", fmt.Errorf("写入文件失败: %v", err)
+		}
+	} else if err := writeFileAtomic(fullPath, data, 0644); err != nil {
 		return "", fmt.Errorf("写入文件失败: %v", err)
 	}
+	a.undo.record(change)
+	a.activity.addFile(fullPath)
 
+	if !encoding.isUTF8() {
+		return fmt.Sprintf("成功写入文件: %s（编码: %s）", fullPath, encoding.name), nil
+	}
 	return fmt.Sprintf("成功写入文件: %s", fullPath), nil
 }
 
@@ -498,18 +1070,87 @@ func (a *ECNUAgent) getWorkingDirectory(args string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("获取工作目录失败: %v", err)
 	}
-	return fmt.Sprintf("当前工作目录: %s", wd), nil
+	result := fmt.Sprintf("当前工作目录: %s", wd)
+	if dir := a.shell.directory(); a.config.ShellSession && dir != "" && dir != wd {
+		result += fmt.Sprintf("\nexecute_command的当前目录: %s（文件工具的相对路径仍相对于工作目录）", dir)
+	}
+	return result, nil
+}
+
+// appendToolResults 将助手的工具调用及其结果加入历史，ReAct模式下结果作为Observation消息
+func (a *ECNUAgent) appendToolResults(message openai.ChatCompletionMessage, results []openai.ChatCompletionMessage) {
+	if a.config.ToolMode == toolModeReact {
+		a.history = append(a.history, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: message.Content,
+		}, reactObservation(results))
+		a.attachViewedImages()
+		return
+	}
+	a.history = append(a.history, message)
+	a.history = append(a.history, results...)
+	a.attachViewedImages()
+}
+
+// startTurn 重置每轮任务的端点、用量、活动记录、缓存和预算，并开始新的撤销分组
+func (a *ECNUAgent) startTurn() {
+	a.resetBackend()
+	a.usage.startTurn()
+	a.activity.reset()
+	a.step.Store(0)
+	a.cache.reset()
+	a.dryRun.reset()
+	a.undo.nextTask()
+	a.budget = newTaskBudget(a.config, a.usage.turnStats())
 }
 
 // ProcessUserInput 处理用户输入
 func (a *ECNUAgent) ProcessUserInput(ctx context.Context, userInput string) error {
-	maxSteps := 20 // 防止无限循环
+	a.startTurn()
+	a.markTurn()
+	a.beginTask(userInput)
+	defer a.endTask()
+	if a.config.DryRun {
+		defer a.printDryRunReport()
+	}
+
+	run := a.runTask
+	if a.config.Plan {
+		run = a.runPlanned
+	}
+	if err := run(ctx, userInput); err != nil {
+		return err
+	}
+
+	if a.config.Verify {
+		if err := a.verifyTask(ctx); err != nil {
+			return err
+		}
+	}
+
+	if a.responseFormat() != nil && a.events == nil {
+		fmt.Println(extractJSONAnswer(a.finalAnswer()))
+	}
+	return nil
+}
+
+// runTask 运行智能体循环，直到模型给出最终回复或达到步骤上限
+func (a *ECNUAgent) runTask(ctx context.Context, userInput string) error {
+	maxSteps := a.config.MaxSteps // 防止无限循环
 	stepCount := 0
 	firstStep := true
+	loops := &loopDetector{threshold: a.config.LoopThreshold}
+	repairs := 0
 
 	for stepCount < maxSteps {
+		if err := a.budget.check(a.usage.turnStats()); err != nil {
+			return a.stopForBudget(ctx, err)
+		}
+
 		stepCount++
+		a.step.Store(int64(stepCount))
 		log.Printf("\n[步骤 %d]\n", stepCount)
+		a.events.emit(&agentEvent{Type: eventStep, Step: stepCount})
 
 		// 只在第一步传入用户输入
 		inputForModel := ""
@@ -518,9 +1159,14 @@ func (a *ECNUAgent) ProcessUserInput(ctx context.Context, userInput string) erro
 			firstStep = false
 		}
 
-		// 调用模型
-		resp, err := a.callModel(ctx, inputForModel, 3)
+		// 调用模型，流式输出时收到回复内容即停止显示指示符
+		a.spinner.begin(fmt.Sprintf("思考中（步骤%d）", stepCount))
+		resp, err := a.callModel(ctx, inputForModel, a.config.MaxRetries)
+		a.spinner.end()
 		if err != nil {
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
 			return fmt.Errorf("调用模型失败: %v", err)
 		}
 
@@ -531,26 +1177,51 @@ func (a *ECNUAgent) ProcessUserInput(ctx context.Context, userInput string) erro
 		choice := resp.Choices[0]
 		message := choice.Message
 
+		// ReAct模式下从文本中解析工具调用
+		final := message.Content
+		if a.config.ToolMode == toolModeReact {
+			var call *openai.ToolCall
+			if call, final = parseReactResponse(message.Content, stepCount); call != nil {
+				message.ToolCalls = []openai.ToolCall{*call}
+			}
+		}
+
+		if final != "" {
+			a.events.emit(&agentEvent{Type: eventAssistant, Step: stepCount, Content: final})
+		}
+
 		// 检查是否有工具调用
 		if len(message.ToolCalls) > 0 {
-			// 执行所有工具调用
-			var toolResults []openai.ChatCompletionMessage
-			for _, toolCall := range message.ToolCalls {
-				result, err := a.executeTool(toolCall)
-				if err != nil {
-					result = fmt.Sprintf("工具执行失败: %v", err)
+			// 流式输出时已在收到调用时显示预览
+			if !a.config.Stream || a.config.ToolMode == toolModeReact {
+				for _, call := range message.ToolCalls {
+					a.showToolIntent(call)
 				}
-
-				toolResults = append(toolResults, openai.ChatCompletionMessage{
-					Role:       openai.ChatMessageRoleTool,
-					Content:    result,
-					ToolCallID: toolCall.ID,
-				})
 			}
 
+			// 执行所有工具调用，执行期间记录待完成的调用以便崩溃后恢复
+			a.setPending(&message)
+			a.spinner.begin(fmt.Sprintf("执行工具（步骤%d）", stepCount))
+			toolResults := a.runToolCalls(ctx, message.ToolCalls)
+			a.spinner.end()
+
 			// 添加助手消息和工具结果到历史
-			a.history = append(a.history, message)
-			a.history = append(a.history, toolResults...)
+			a.appendToolResults(message, toolResults)
+			a.setPending(nil)
+
+			if ctx.Err() != nil {
+				return errInterrupted
+			}
+
+			// 检测重复调用：首次提醒模型更换策略，再次出现则终止任务
+			if loops.observe(message.ToolCalls) {
+				if loops.warned {
+					return fmt.Errorf("检测到重复的工具调用，模型在提醒后仍未更换策略，已终止任务")
+				}
+				log.Printf("[循环] 检测到连续%d次相同的工具调用，提醒模型更换策略\n", loops.threshold)
+				a.history = append(a.history, loopWarning(message.ToolCalls, loops.threshold))
+				loops.warned = true
+			}
 
 			// 继续下一轮（不添加用户输入）
 			continue
@@ -558,14 +1229,31 @@ func (a *ECNUAgent) ProcessUserInput(ctx context.Context, userInput string) erro
 
 		// 没有工具调用，显示最终回复
 		if message.Content != "" {
-			fmt.Printf("\n[助手] %s\n", message.Content)
 			a.history = append(a.history, message)
+
+			// JSON输出模式下校验回答，不符合要求时让模型修正
+			if a.responseFormat() != nil {
+				if problems := a.checkJSONAnswer(message.Content); len(problems) > 0 {
+					if repairs >= jsonRepairAttempts {
+						return fmt.Errorf("最终回答不符合JSON格式要求: %s %s", problems[0].Path, problems[0].Message)
+					}
+					repairs++
+					log.Printf("[校验] 最终回答不符合JSON格式要求，请求模型修正（%d/%d）\n", repairs, jsonRepairAttempts)
+					a.history = append(a.history, jsonRepairMessage(problems))
+					continue
+				}
+				break
+			}
+
+			if !a.config.Stream && !a.subagent && a.config.Prompt == "" {
+				fmt.Printf("\n[助手] %s\n", a.formatAssistant(final))
+			}
 			break
 		}
 	}
 
 	if stepCount >= maxSteps {
-		return fmt.Errorf("达到最大步骤数限制（%d步）", maxSteps)
+		return fmt.Errorf("%w（%d步）", errMaxSteps, maxSteps)
 	}
 
 	return nil
@@ -573,44 +1261,252 @@ func (a *ECNUAgent) ProcessUserInput(ctx context.Context, userInput string) erro
 
 // Run 运行交互式循环
 func (a *ECNUAgent) Run() {
-	fmt.Println("\n=== ChatECNU Agent 已启动 ===")
-	fmt.Println("输入命令或'exit'退出\n")
+	// 交互式终端下，任务执行期间输入的内容作为补充指示发送给模型
+	var in *inputLines
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) && a.console == os.Stdout && a.config.LineEditing {
+		in = readTerminalLines(os.Stdin, os.Stdout, loadInputHistory(a.config.HistoryFile))
+	} else {
+		in = readInputLines(os.Stdin)
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	ctx := context.Background()
+	// Ctrl+C只取消当前任务，不退出程序
+	var runs runController
+	stopListening := runs.listen()
+	defer stopListening()
 
-	for {
-		fmt.Print("用户> ")
-		if !scanner.Scan() {
-			break
+	a.repl(in, &runs)
+	in.restore()
+	a.printSessionSummary()
+}
+
+// repl 从in读取输入并逐条执行，直到输入结束或用户退出
+func (a *ECNUAgent) repl(in *inputLines, runs *runController) {
+	fmt.Fprintln(a.console, "\n=== ChatECNU Agent 已启动 ===")
+	fmt.Fprint(a.console, "输入命令或'exit'退出，输入'/help'查看可用命令\n\n")
+
+	if isTerminal(os.Stdin) {
+		a.steering = &steeringQueue{}
+		a.approver = &approver{requests: make(chan confirmRequest)}
+	}
+	a.notifier = newNotifier(a.config, a.console)
+
+	// 上次异常退出时任务仍在执行，从中断处继续
+	if task, ok := a.interruptedTask(); ok {
+		log.Printf("[恢复] 继续执行中断的任务: %s\n", truncateRunes(task, 100))
+		ctx, done := runs.begin(context.Background())
+		a.notifier.begin()
+		err := a.runSteerable(in, func() error { return a.resumeTask(ctx) })
+		done()
+		if err != nil {
+			log.Printf("[错误] %v\n", err)
 		}
+		a.notifier.taskDone(task, err)
+	}
 
-		userInput := strings.TrimSpace(scanner.Text())
+	for {
+		// 任务结束后才收到的补充指示作为新的输入
+		userInput := strings.Join(a.steering.drain(), "\n")
+		if userInput != "" {
+			log.Printf("[引导] 任务已结束，补充指示将作为新的任务执行\n")
+		} else {
+			line, ok := in.prompt(a.console, "用户> ")
+			if !ok {
+				break
+			}
+			// 以"""开始的多行输入块，或用/editor在外部编辑器中编写输入
+			if strings.HasPrefix(strings.TrimSpace(line), blockDelimiter) {
+				line = readBlock(in, a.console, line)
+			} else if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "/editor" {
+				if in.editor == nil {
+					fmt.Fprintln(a.console, "/editor 只能在启用行编辑的交互式终端中使用")
+					continue
+				}
+				text, err := editInput(in, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "/editor")))
+				if err != nil {
+					log.Printf("[错误] %v\n", err)
+					continue
+				}
+				if text == "" {
+					fmt.Fprintln(a.console, "编辑的内容为空，已取消")
+					continue
+				}
+				fmt.Fprintf(a.console, "[编辑器] 已读取%d行输入\n", strings.Count(text, "\n")+1)
+				line = text
+			}
+			in.remember(line)
+			userInput = strings.TrimSpace(line)
+		}
 		if userInput == "" {
 			continue
 		}
 
 		if userInput == "exit" || userInput == "quit" {
-			fmt.Println("再见！")
+			fmt.Fprintln(a.console, "再见！")
 			break
 		}
 
-		if err := a.ProcessUserInput(ctx, userInput); err != nil {
+		if strings.HasPrefix(userInput, "/") {
+			task, ok := a.handleSlashCommand(userInput)
+			if !ok {
+				fmt.Printf("未知命令: %s，输入 /help 查看可用命令\n", strings.Fields(userInput)[0])
+			}
+			if task == "" {
+				continue
+			}
+			userInput = task
+		}
+		if a.quote != "" {
+			// 会话标题取自用户自己的输入，而不是引用的开头
+			if a.session != nil && a.session.title == "" {
+				a.session.title = truncateRunes(firstLine(strings.TrimSpace(userInput)), sessionTitleRunes)
+			}
+			userInput = a.quote + "\n" + userInput
+			a.quote = ""
+		}
+		a.lastInput = userInput
+
+		ctx, done := runs.begin(context.Background())
+		a.notifier.begin()
+		err := a.runSteerable(in, func() error { return a.ProcessUserInput(ctx, userInput) })
+		done()
+
+		// 超出预算时询问是否继续
+		var budgetErr *budgetError
+		for errors.As(err, &budgetErr) {
+			a.notifier.confirmNeeded("已达到任务预算上限，是否继续执行？")
+			if !askYesNo(a.console, in, "\n已达到任务预算上限，是否继续执行？(y/N) ") {
+				break
+			}
+			ctx, done := runs.begin(context.Background())
+			err = a.runSteerable(in, func() error { return a.continueTask(ctx) })
+			done()
+		}
+		a.notifier.taskDone(userInput, err)
+
+		if errors.Is(err, errInterrupted) {
+			log.Printf("[中断] %v，已保留对话历史\n", err)
+		} else if err != nil {
 			log.Printf("[错误] %v\n", err)
 		}
+		log.Printf("[用量] 本轮%s\n", formatStats(a.usage.turnStats()))
 	}
 
-	if err := scanner.Err(); err != nil {
+	if err := in.err; err != nil {
 		log.Printf("[错误] 读取输入失败: %v\n", err)
 	}
 }
 
+// printSessionSummary 退出前打印会话的用量统计和恢复方式
+func (a *ECNUAgent) printSessionSummary() {
+	fmt.Fprintln(a.console, "\n会话用量统计:")
+	fmt.Fprint(a.console, a.usage.report())
+	if a.session != nil {
+		if _, err := os.Stat(a.session.path); err == nil {
+			fmt.Fprintf(a.console, "会话已保存，可使用 --continue 或 --resume %s 恢复\n", a.session.id)
+		}
+	}
+}
+
 func main() {
-	agent, err := NewECNUAgent("")
+	// 加载环境变量
+	godotenv.Load()
+
+	// 子命令
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "schedule" {
+		if err := scheduleCommand(args[1:]); err != nil {
+			log.Fatalf("定时任务: %v\n", err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "history" {
+		if err := historySubcommand(args[1:]); err != nil {
+			log.Fatalf("历史记录: %v\n", err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "batch" {
+		if err := batchCommand(args[1:]); err != nil {
+			log.Fatalf("批量任务: %v\n", err)
+		}
+		return
+	}
+	subcommand := ""
+	if len(args) > 0 && args[0] == "models" {
+		subcommand, args = args[0], args[1:]
+	}
+
+	cfg, err := loadConfig(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Printf("加载配置失败: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	// 助手回复写入标准输出，日志、工具调用和命令输出等诊断信息写入标准错误
+	logs := newLogWriter(os.Stderr, cfg.logLevel(), cfg.colorDiagnostics())
+	log.SetOutput(logs)
+
+	agent, err := NewECNUAgent("", cfg)
 	if err != nil {
-		log.Fatalf("初始化Agent失败: %v\n", err)
+		exitSetup(cfg, "初始化Agent失败: %v\n", err)
+	}
+	defer agent.recorder.Close()
+	defer agent.sandbox.close()
+	if agent.spinner != nil {
+		// 日志经由指示符写入，避免与指示符显示在同一行
+		logs.out = agent.spinner
+	}
+
+	if cfg.Resume != "" || cfg.Continue {
+		id, workingDir := cfg.Resume, ""
+		if cfg.Continue {
+			id, workingDir = resumeLast, agent.workingDir
+		}
+		state, path, err := loadSessionState(cfg.StateDir, id, workingDir)
+		if err != nil {
+			exitSetup(cfg, "恢复会话失败: %v\n", err)
+		}
+		agent.restoreSession(state, path)
+	}
+	if cfg.Session != "" {
+		// 指定名称的会话已存在时恢复，否则以该名称开始新会话
+		state, path, err := loadSessionState(cfg.StateDir, cfg.Session, "")
+		switch {
+		case err == nil:
+			agent.restoreSession(state, path)
+		case errors.Is(err, os.ErrNotExist):
+			log.Printf("[恢复] 会话 %s 不存在，已创建新会话\n", cfg.Session)
+		default:
+			exitSetup(cfg, "恢复会话失败: %v\n", err)
+		}
+	}
+
+	if subcommand == "models" {
+		models, err := agent.listModels(context.Background())
+		if err != nil {
+			log.Fatalf("获取模型列表失败: %v\n", err)
+		}
+		printModels(models, cfg.Model)
+		return
 	}
 
+	if cfg.Prompt != "" {
+		task, err := agent.withStdin(cfg.Prompt, os.Stdin)
+		if err != nil {
+			exitSetup(cfg, "%v\n", err)
+		}
+		code := agent.RunOnce(task)
+		agent.recorder.Close()
+		agent.sandbox.close()
+		os.Exit(code)
+	}
+	if cfg.TUI {
+		if err := agent.RunTUI(); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		return
+	}
 	agent.Run()
 }
-
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI样式，结束时只关闭对应的属性，便于嵌套
+const (
+	styleBold      = "\033[1m"
+	styleBoldOff   = "\033[22m"
+	styleDim       = "\033[2m"
+	styleItalic    = "\033[3m"
+	styleItalicOff = "\033[23m"
+	styleUnder     = "\033[4m"
+	styleUnderOff  = "\033[24m"
+	styleCode      = "\033[36m"
+	styleColorOff  = "\033[39m"
+	styleReset     = "\033[0m"
+)
+
+// markdownRuleWidth 水平分割线的宽度
+const markdownRuleWidth = 40
+
+// renderMarkdown 判断是否渲染助手回复中的Markdown：未指定--plain、输出为终端且未设置NO_COLOR
+func (a *ECNUAgent) renderMarkdown() bool {
+	return !a.config.Plain && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+}
+
+// formatAssistant 返回终端上显示的助手回复，需要时渲染Markdown
+func (a *ECNUAgent) formatAssistant(content string) string {
+	if !a.renderMarkdown() {
+		return content
+	}
+	var r markdownRenderer
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = r.line(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownRenderer 逐行把Markdown转换为带ANSI样式的文本，记录是否处在代码块中
+//
+// 只处理标题、列表、引用、分割线、代码块和行内的强调、代码与链接，其余内容原样输出；
+// 代码块按标注的语言着色，未标注或无法识别的语言原样输出。
+type markdownRenderer struct {
+	fence string       // 当前代码块的围栏，如```，不在代码块中时为空
+	code  *highlighter // 按代码块标注的语言为代码着色
+}
+
+// line 渲染一行
+func (r *markdownRenderer) line(s string) string {
+	trimmed := strings.TrimLeft(s, " ")
+	indent := s[:len(s)-len(trimmed)]
+
+	if r.fence != "" {
+		if strings.HasPrefix(trimmed, r.fence) && strings.Trim(trimmed, r.fence[:1]+" ") == "" {
+			r.fence, r.code = "", nil
+			return styleDim + s + styleReset
+		}
+		return r.code.line(s)
+	}
+	if fence := fenceMarker(trimmed); fence != "" {
+		r.fence = fence
+		info := strings.Fields(strings.TrimLeft(trimmed, fence[:1]))
+		if len(info) > 0 {
+			r.code = newHighlighter(languageFor(info[0]))
+		}
+		return styleDim + s + styleReset
+	}
+
+	switch {
+	case headingLevel(trimmed) > 0:
+		level := headingLevel(trimmed)
+		text := r.inline(strings.TrimSpace(strings.TrimRight(trimmed[level:], "# ")))
+		switch level {
+		case 1:
+			return indent + styleBold + styleUnder + "\033[35m" + text + styleReset
+		case 2:
+			return indent + styleBold + "\033[35m" + text + styleReset
+		default:
+			return indent + styleBold + text + styleReset
+		}
+	case isHorizontalRule(trimmed):
+		return indent + styleDim + strings.Repeat("─", markdownRuleWidth) + styleReset
+	case strings.HasPrefix(trimmed, ">"):
+		text := strings.TrimPrefix(strings.TrimPrefix(trimmed, ">"), " ")
+		return indent + styleDim + "│ " + styleReset + styleItalic + r.inline(text) + styleReset
+	case len(trimmed) >= 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && trimmed[1] == ' ':
+		item := trimmed[2:]
+		// 任务列表
+		if strings.HasPrefix(item, "[ ] ") {
+			item = "☐ " + item[4:]
+		} else if strings.HasPrefix(item, "[x] ") || strings.HasPrefix(item, "[X] ") {
+			item = "☑ " + item[4:]
+		}
+		return indent + "• " + r.inline(item)
+	case orderedMarker(trimmed) > 0:
+		n := orderedMarker(trimmed)
+		return indent + styleBold + trimmed[:n] + styleBoldOff + r.inline(trimmed[n:])
+	case isTableSeparator(trimmed):
+		return styleDim + s + styleReset
+	}
+	return indent + r.inline(trimmed)
+}
+
+// inline 渲染行内的代码、粗体、斜体和链接，反斜杠转义的字符原样输出
+func (r *markdownRenderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()#+-.!|>~", s[i+1]) >= 0:
+			b.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			ticks := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			marker := s[i : i+ticks]
+			if end := strings.Index(s[i+ticks:], marker); end >= 0 {
+				code := strings.TrimSpace(s[i+ticks : i+ticks+end])
+				b.WriteString(styleCode + code + styleColorOff)
+				i += ticks + end + ticks
+				continue
+			}
+			b.WriteString(marker)
+			i += ticks
+			continue
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			marker := s[i : i+2]
+			if end := strings.Index(s[i+2:], marker); end > 0 && s[i+2] != ' ' {
+				b.WriteString(styleBold + r.inline(s[i+2:i+2+end]) + styleBoldOff)
+				i += 2 + end + 2
+				continue
+			}
+		case c == '*' && i+1 < len(s) && s[i+1] != ' ':
+			if end := strings.IndexByte(s[i+1:], '*'); end > 0 && s[i+end] != ' ' {
+				b.WriteString(styleItalic + r.inline(s[i+1:i+1+end]) + styleItalicOff)
+				i += end + 2
+				continue
+			}
+		case c == '[':
+			if text, url, n := parseLink(s[i:]); n > 0 {
+				b.WriteString(styleUnder + r.inline(text) + styleUnderOff)
+				if url != text {
+					b.WriteString(styleDim + " (" + url + ")" + styleReset)
+				}
+				i += n
+				continue
+			}
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// parseLink 解析[文字](地址)形式的链接，返回文字、地址和链接的长度，不是链接时长度为0
+func parseLink(s string) (text, url string, n int) {
+	mid := strings.Index(s, "](")
+	if mid < 1 || strings.Contains(s[1:mid], "[") {
+		return "", "", 0
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0
+	}
+	return s[1:mid], s[mid+2 : mid+2+end], mid + 2 + end + 1
+}
+
+// fenceMarker 返回代码块开始行的围栏（```或~~~），不是代码块开始时返回空字符串
+func fenceMarker(s string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(s) - len(strings.TrimLeft(s, c))
+		if n >= 3 && !strings.Contains(s[n:], c) {
+			return s[:n]
+		}
+	}
+	return ""
+}
+
+// headingLevel 返回ATX标题的级别，不是标题时返回0
+func headingLevel(s string) int {
+	n := len(s) - len(strings.TrimLeft(s, "#"))
+	if n == 0 || n > 6 || (len(s) > n && s[n] != ' ') {
+		return 0
+	}
+	return n
+}
+
+// isHorizontalRule 判断一行是否为由-、*或_组成的分割线
+func isHorizontalRule(s string) bool {
+	s = strings.ReplaceAll(s, " ", "")
+	if len(s) < 3 {
+		return false
+	}
+	return strings.Trim(s, s[:1]) == "" && strings.ContainsRune("-*_", rune(s[0]))
+}
+
+// orderedMarker 返回有序列表项编号（如"1. "）的长度，不是有序列表项时返回0
+func orderedMarker(s string) int {
+	n := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	if n == 0 || n > 9 || len(s) < n+2 || (s[n] != '.' && s[n] != ')') || s[n+1] != ' ' {
+		return 0
+	}
+	return n + 2
+}
+
+// isTableSeparator 判断一行是否为表格的表头分隔行，如|---|:---:|
+func isTableSeparator(s string) bool {
+	return strings.Contains(s, "|") && strings.Contains(s, "-") && strings.Trim(s, "|-: ") == ""
+}
+
+// markdownWriter 逐行渲染流式输出的Markdown，未结束的行在下一次换行或flush时输出
+type markdownWriter struct {
+	w       io.Writer
+	render  bool
+	r       markdownRenderer
+	pending strings.Builder
+}
+
+// newMarkdownWriter 创建写入w的流式输出，render为false时原样输出
+func newMarkdownWriter(w io.Writer, render bool) *markdownWriter {
+	return &markdownWriter{w: w, render: render}
+}
+
+// write 写入一段回复
+func (m *markdownWriter) write(s string) {
+	if !m.render {
+		io.WriteString(m.w, s)
+		return
+	}
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			m.pending.WriteString(s)
+			return
+		}
+		m.pending.WriteString(s[:i])
+		io.WriteString(m.w, m.r.line(m.pending.String())+"\n")
+		m.pending.Reset()
+		s = s[i+1:]
+	}
+}
+
+// flush 输出尚未结束的最后一行
+func (m *markdownWriter) flush() {
+	if m.pending.Len() > 0 {
+		io.WriteString(m.w, m.r.line(m.pending.String()))
+		m.pending.Reset()
+	}
+}
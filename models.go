@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// modelInfo 描述API返回的一个可用模型
+type modelInfo struct {
+	ID            string
+	OwnedBy       string
+	ContextWindow int // 上下文窗口大小，0表示服务端未提供
+}
+
+// contextWindowKeys 各服务商在模型列表中表示上下文窗口的字段名
+var contextWindowKeys = []string{"context_window", "context_length", "max_context_length", "max_model_len"}
+
+// listModels 调用服务端的/models接口获取当前密钥可用的模型
+func (a *ECNUAgent) listModels(ctx context.Context) ([]modelInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	url := strings.TrimRight(a.backend.provider.BaseURL, "/") + "/models"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	resp, err := a.backend.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求模型列表失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求模型列表失败 (HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("解析模型列表失败: %v", err)
+	}
+
+	models := make([]modelInfo, 0, len(payload.Data))
+	for _, item := range payload.Data {
+		id, _ := item["id"].(string)
+		if id == "" {
+			continue
+		}
+		info := modelInfo{ID: id}
+		info.OwnedBy, _ = item["owned_by"].(string)
+		for _, key := range contextWindowKeys {
+			if n, ok := item[key].(float64); ok && n > 0 {
+				info.ContextWindow = int(n)
+				break
+			}
+		}
+		models = append(models, info)
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
+
+// printModels 以表格形式输出模型列表，当前使用的模型以*标记
+func printModels(models []modelInfo, current string) {
+	if len(models) == 0 {
+		fmt.Println("没有可用的模型")
+		return
+	}
+
+	fmt.Printf("可用模型 (%d个):\n", len(models))
+	for _, m := range models {
+		mark := " "
+		if m.ID == current {
+			mark = "*"
+		}
+		line := fmt.Sprintf("%s %-24s", mark, m.ID)
+		if m.ContextWindow > 0 {
+			line += fmt.Sprintf("  上下文: %d tokens", m.ContextWindow)
+		}
+		if m.OwnedBy != "" {
+			line += fmt.Sprintf("  提供方: %s", m.OwnedBy)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+}
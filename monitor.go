@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	monitorInterval     = 100 * time.Millisecond // 状态行的刷新间隔
+	monitorSummaryAfter = 3 * time.Second        // 运行超过该时间的命令结束时显示用时
+	monitorStatusWidth  = 60                     // 状态行中显示的未换行输出的最大字符数
+)
+
+// monitorFrames 状态行中转动的指示符
+var monitorFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// commandMonitor 在终端上实时显示正在执行的命令的输出，并用状态行显示已运行时间
+//
+// 多个命令并发执行时共用一个状态行，输出行前标注命令编号。输出不是终端时只逐行显示输出。
+type commandMonitor struct {
+	mu      sync.Mutex
+	out     io.Writer
+	tty     bool
+	running []*liveCommand
+	nextID  int
+	status  bool // 终端上是否正显示状态行
+	frame   int
+	stop    chan struct{}
+}
+
+// newCommandMonitor 创建向out显示命令输出的监视器
+func newCommandMonitor(out io.Writer) *commandMonitor {
+	f, ok := out.(*os.File)
+	return &commandMonitor{out: out, tty: ok && isTerminal(f)}
+}
+
+// liveCommand 一个正在执行的命令，标准输出和标准错误分别保存，按产生的顺序显示
+type liveCommand struct {
+	m      *commandMonitor
+	id     int
+	start  time.Time
+	stdout liveStream
+	stderr liveStream
+}
+
+// liveStream 命令的一路输出
+type liveStream struct {
+	c       *liveCommand
+	buf     bytes.Buffer // 完整输出，作为工具结果
+	pending []byte       // 尚未换行的部分
+}
+
+// begin 开始显示一个命令的输出
+func (m *commandMonitor) begin() *liveCommand {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	l := &liveCommand{m: m, id: m.nextID, start: time.Now()}
+	l.stdout.c, l.stderr.c = l, l
+	m.running = append(m.running, l)
+	if m.tty && m.stop == nil {
+		m.stop = make(chan struct{})
+		go m.tick(m.stop)
+	}
+	return l
+}
+
+// tick 定时刷新状态行，直到stop被关闭
+func (m *commandMonitor) tick(stop chan struct{}) {
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			m.drawStatus()
+			m.mu.Unlock()
+		}
+	}
+}
+
+// drawStatus 显示最早开始的命令的已运行时间和未换行的输出（如进度条），调用时需持有锁
+func (m *commandMonitor) drawStatus() {
+	if len(m.running) == 0 {
+		return
+	}
+	first := m.running[0]
+	m.frame = (m.frame + 1) % len(monitorFrames)
+	text := fmt.Sprintf("  %s 已运行 %s", monitorFrames[m.frame], formatElapsed(time.Since(first.start)))
+	if len(m.running) > 1 {
+		text = fmt.Sprintf("  %s %d个命令执行中，已运行 %s", monitorFrames[m.frame], len(m.running), formatElapsed(time.Since(first.start)))
+	} else {
+		// pip、curl等程序的进度条通常写到标准错误
+		progress := lastSegment(first.stderr.pending)
+		if len(progress) == 0 {
+			progress = lastSegment(first.stdout.pending)
+		}
+		if len(progress) > 0 {
+			text += "  " + truncateRunes(string(progress), monitorStatusWidth)
+		}
+	}
+	fmt.Fprint(m.out, "\r\033[K"+text)
+	m.status = true
+}
+
+// clearStatus 清除状态行，调用时需持有锁
+func (m *commandMonitor) clearStatus() {
+	if m.status {
+		fmt.Fprint(m.out, "\r\033[K")
+		m.status = false
+	}
+}
+
+// printLine 显示一行输出，调用时需持有锁
+func (m *commandMonitor) printLine(l *liveCommand, line []byte) {
+	m.clearStatus()
+	prefix := "  │ "
+	if len(m.running) > 1 {
+		prefix = fmt.Sprintf("  │[%d] ", l.id)
+	}
+	fmt.Fprintf(m.out, "%s%s\n", prefix, line)
+}
+
+// Write 保存输出并显示其中完整的行
+func (s *liveStream) Write(p []byte) (int, error) {
+	m := s.c.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.buf.Write(p)
+	s.pending = append(s.pending, p...)
+	for {
+		i := bytes.IndexByte(s.pending, '\n')
+		if i < 0 {
+			break
+		}
+		m.printLine(s.c, lastSegment(s.pending[:i]))
+		s.pending = s.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// end 结束显示，输出最后不完整的行，返回命令的完整标准输出和标准错误
+func (l *liveCommand) end() (stdout, stderr []byte) {
+	m := l.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range []*liveStream{&l.stdout, &l.stderr} {
+		if line := lastSegment(s.pending); len(line) > 0 {
+			m.printLine(l, line)
+		}
+	}
+	for i, r := range m.running {
+		if r == l {
+			m.running = append(m.running[:i], m.running[i+1:]...)
+			break
+		}
+	}
+	m.clearStatus()
+	if elapsed := time.Since(l.start); elapsed >= monitorSummaryAfter {
+		fmt.Fprintf(m.out, "  └ 用时 %s\n", formatElapsed(elapsed))
+	}
+	if len(m.running) == 0 && m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	return l.stdout.buf.Bytes(), l.stderr.buf.Bytes()
+}
+
+// lastSegment 返回行中最后一个\r之后的部分，进度条等用\r覆盖的输出只显示最新的内容
+func lastSegment(line []byte) []byte {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		return line[i+1:]
+	}
+	return line
+}
+
+// formatElapsed 将耗时格式化为"12.3秒"或"1分05秒"
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1f秒", d.Seconds())
+	}
+	d = d.Round(time.Second)
+	if d < time.Hour {
+		return fmt.Sprintf("%d分%02d秒", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%d小时%02d分%02d秒", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// blockDelimiter 多行输入块的开始和结束标记
+const blockDelimiter = `"""`
+
+// readBlock 读取以"""开始的多行输入，直到某一行以"""结尾，first为开始标记所在的行
+//
+// 标记所在行的其余内容也作为输入的一部分；输入在块结束前中断时返回已读取的内容。
+func readBlock(in *inputLines, w io.Writer, first string) string {
+	first = strings.TrimPrefix(strings.TrimLeft(first, " \t"), blockDelimiter)
+	if rest, ok := strings.CutSuffix(strings.TrimRight(first, " \t\r"), blockDelimiter); ok {
+		return rest
+	}
+	lines := []string{}
+	if strings.TrimSpace(first) != "" {
+		lines = append(lines, first)
+	}
+	for {
+		line, ok := in.prompt(w, continuationPrompt)
+		if !ok {
+			break
+		}
+		if rest, ok := strings.CutSuffix(strings.TrimRight(line, " \t\r"), blockDelimiter); ok {
+			if rest != "" {
+				lines = append(lines, rest)
+			}
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// editorCommand 返回编辑多行输入使用的编辑器命令，依次取VISUAL、EDITOR，未设置时使用系统默认的编辑器
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(name)); len(fields) > 0 {
+			return fields
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editInput 在外部编辑器中编写输入，保存退出后返回编辑的内容，initial为编辑器中的初始内容
+func editInput(in *inputLines, initial string) (string, error) {
+	f, err := os.CreateTemp("", "ecnu-agent-*.md")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, err = f.WriteString(initial)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("写入临时文件失败: %w", err)
+	}
+
+	// 编辑器运行期间停止后台读取，避免按键被当作输入
+	resume := in.suspend()
+	args := editorCommand()
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	resume()
+	if err != nil {
+		return "", fmt.Errorf("运行编辑器 %s 失败: %w", args[0], err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("读取编辑的内容失败: %w", err)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n")), nil
+}
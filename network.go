@@ -0,0 +1,678 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	networkDefaultTimeout = 5 * time.Second  // DNS、端口和HTTP检查的默认超时
+	networkTraceTimeout   = 2 * time.Second  // 路由追踪中每一跳的默认超时
+	networkMaxTimeout     = 30 * time.Second // 超时参数的上限
+	networkMaxPorts       = 100              // 一次最多检查的端口数
+	networkPortWorkers    = 20               // 并发检查的端口数
+	networkMaxRedirects   = 10               // HTTP检查最多跟随的重定向次数
+	networkDefaultHops    = 30               // 路由追踪默认的最大跳数
+	networkMaxHops        = 64               // 路由追踪最大跳数的上限
+	networkTraceSilence   = 5                // 连续多少跳无响应后停止路由追踪
+)
+
+// networkRecordTypes dns支持的记录类型，all查询其中除PTR以外的全部类型
+var networkRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "SRV", "PTR"}
+
+// checkNetworkTool 网络诊断的工具定义
+var checkNetworkTool = Tool{
+	Type: "function",
+	Name: "check_network",
+	Description: "诊断网络连通性，不依赖系统中的ping、nc、dig、curl、traceroute等命令。dns查询域名的解析记录，可以指定DNS服务器；port检查TCP端口能否连接，区分端口开放、拒绝连接、超时和不可达；" +
+		"http发送HEAD请求，返回状态码、重定向链、响应头、各阶段耗时和TLS证书信息；trace逐跳追踪到目标主机的路由，找出在哪一跳中断。排查\"为什么连不上某个服务\"时可以依次使用dns、port、http和trace。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"dns", "port", "http", "trace"},
+				"description": "要执行的检查",
+			},
+			"host": map[string]interface{}{
+				"type":        "string",
+				"description": "dns、port和trace的目标域名或IP地址",
+			},
+			"ports": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "integer"},
+				"description": "port要检查的TCP端口，最多100个",
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "http要检查的地址，只支持http和https",
+			},
+			"method": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"HEAD", "GET"},
+				"description": "http的请求方法，默认HEAD，服务器不支持HEAD时自动改用GET（不读取响应内容）",
+			},
+			"record_type": map[string]interface{}{
+				"type":        "string",
+				"enum":        append(slices.Clone(networkRecordTypes), "all"),
+				"description": "dns查询的记录类型，默认查询A、AAAA和CNAME，host为IP地址时查询PTR",
+			},
+			"server": map[string]interface{}{
+				"type":        "string",
+				"description": "dns使用的DNS服务器，如8.8.8.8或1.1.1.1:53，默认使用系统配置的服务器",
+			},
+			"timeout": map[string]interface{}{
+				"type":        "integer",
+				"description": "超时秒数，默认5秒，trace时为每一跳的超时，默认2秒，最多30秒",
+				"minimum":     1,
+				"maximum":     int(networkMaxTimeout / time.Second),
+			},
+			"max_hops": map[string]interface{}{
+				"type":        "integer",
+				"description": "trace的最大跳数，默认30",
+				"minimum":     1,
+				"maximum":     networkMaxHops,
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// networkParams check_network的参数
+type networkParams struct {
+	Action     string `json:"action"`
+	Host       string `json:"host"`
+	Ports      []int  `json:"ports"`
+	URL        string `json:"url"`
+	Method     string `json:"method"`
+	RecordType string `json:"record_type"`
+	Server     string `json:"server"`
+	Timeout    int    `json:"timeout"`
+	MaxHops    int    `json:"max_hops"`
+}
+
+// checkNetwork 根据action执行一项网络检查
+func (a *ECNUAgent) checkNetwork(ctx context.Context, args string) (string, error) {
+	var params networkParams
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	timeout := networkDefaultTimeout
+	if params.Action == "trace" {
+		timeout = networkTraceTimeout
+	}
+	if params.Timeout > 0 {
+		timeout = min(time.Duration(params.Timeout)*time.Second, networkMaxTimeout)
+	}
+
+	switch params.Action {
+	case "dns", "port", "trace":
+		params.Host = strings.TrimSuffix(strings.TrimSpace(params.Host), ".")
+		if params.Host == "" {
+			return "", fmt.Errorf("%s需要host参数", params.Action)
+		}
+		// 去掉误写的协议和端口，如https://example.com:8443/
+		if u, err := url.Parse(params.Host); err == nil && u.Host != "" {
+			params.Host = u.Hostname()
+		} else if h, _, err := net.SplitHostPort(params.Host); err == nil {
+			params.Host = h
+		}
+	case "http":
+		if params.URL == "" {
+			return "", fmt.Errorf("http需要url参数")
+		}
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+	log.Printf("[网络] %s %s%s\n", params.Action, params.Host, params.URL)
+
+	switch params.Action {
+	case "dns":
+		return lookupRecords(ctx, params, timeout)
+	case "port":
+		if len(params.Ports) == 0 {
+			return "", fmt.Errorf("port需要ports参数")
+		}
+		if len(params.Ports) > networkMaxPorts {
+			return "", fmt.Errorf("一次最多检查%d个端口", networkMaxPorts)
+		}
+		for _, p := range params.Ports {
+			if p < 1 || p > 65535 {
+				return "", fmt.Errorf("端口%d不合法", p)
+			}
+		}
+		return checkPorts(ctx, params.Host, params.Ports, timeout), nil
+	case "http":
+		return probeHTTP(ctx, params, timeout)
+	}
+	hops := networkDefaultHops
+	if params.MaxHops > 0 {
+		hops = min(params.MaxHops, networkMaxHops)
+	}
+	return traceRoute(ctx, params.Host, hops, timeout)
+}
+
+// networkResolver 返回使用指定DNS服务器的解析器，server为空时使用系统配置
+func networkResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// systemNameservers 返回/etc/resolv.conf中配置的DNS服务器，用于说明系统解析器的来源
+func systemNameservers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// dnsErrorText 把解析错误转换为说明
+func dnsErrorText(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return "无记录"
+		case dnsErr.IsTimeout:
+			return "超时，DNS服务器无响应"
+		}
+		return dnsErr.Err
+	}
+	return err.Error()
+}
+
+// lookupRecords 查询域名的解析记录
+func lookupRecords(ctx context.Context, params networkParams, timeout time.Duration) (string, error) {
+	host := params.Host
+	types := []string{"A", "AAAA", "CNAME"}
+	switch t := strings.ToUpper(params.RecordType); {
+	case t == "ALL":
+		types = networkRecordTypes[:len(networkRecordTypes)-1]
+	case t != "":
+		if !slices.Contains(networkRecordTypes, t) {
+			return "", fmt.Errorf("不支持的记录类型: %s", params.RecordType)
+		}
+		types = []string{t}
+	case net.ParseIP(host) != nil:
+		types = []string{"PTR"}
+	}
+	if net.ParseIP(host) != nil && !slices.Equal(types, []string{"PTR"}) {
+		return "", fmt.Errorf("%s是IP地址，只能查询PTR记录", host)
+	}
+
+	resolver := networkResolver(params.Server)
+	var b strings.Builder
+	if params.Server != "" {
+		fmt.Fprintf(&b, "DNS服务器: %s\n", params.Server)
+	} else if servers := systemNameservers(); len(servers) > 0 {
+		fmt.Fprintf(&b, "DNS服务器: 系统配置（%s）\n", strings.Join(servers, ", "))
+	} else {
+		b.WriteString("DNS服务器: 系统配置\n")
+	}
+	failed := 0
+	for _, t := range types {
+		qctx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		values, err := lookupRecord(qctx, resolver, t, host)
+		elapsed := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %s（%s）\n", t, dnsErrorText(err), formatLatency(elapsed))
+			failed++
+			continue
+		}
+		fmt.Fprintf(&b, "%s（%s）:\n", t, formatLatency(elapsed))
+		for _, v := range values {
+			fmt.Fprintf(&b, "  %s\n", v)
+		}
+	}
+	if failed == len(types) {
+		fmt.Fprintf(&b, "%s没有查到任何记录，检查域名拼写，或用server参数换一个DNS服务器对比\n", host)
+	}
+	return b.String(), nil
+}
+
+// lookupRecord 查询一种类型的记录，返回每条记录的文本
+func lookupRecord(ctx context.Context, r *net.Resolver, recordType, host string) ([]string, error) {
+	var values []string
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			values = append(values, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSuffix(cname, ".") == host {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		values = append(values, cname)
+	case "MX":
+		records, err := r.LookupMX(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range records {
+			values = append(values, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "NS":
+		records, err := r.LookupNS(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range records {
+			values = append(values, ns.Host)
+		}
+	case "TXT":
+		records, err := r.LookupTXT(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, txt := range records {
+			values = append(values, strconv.Quote(txt))
+		}
+	case "SRV":
+		_, records, err := r.LookupSRV(ctx, "", "", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			values = append(values, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	case "PTR":
+		names, err := r.LookupAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		values = names
+	}
+	if len(values) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return values, nil
+}
+
+// formatLatency 以毫秒显示耗时
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
+
+// portResult 一个端口的检查结果
+type portResult struct {
+	port    int
+	state   string
+	remote  string
+	latency time.Duration
+	note    string
+}
+
+// dialState 根据连接错误判断端口状态
+func dialState(err error) (state, note string) {
+	var netErr net.Error
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	switch {
+	case err == nil:
+		return "open", ""
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout", "无响应，可能被防火墙丢弃或主机不在线"
+	case errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(msg, "refused"):
+		return "closed", "拒绝连接，该端口没有程序监听或被防火墙拒绝"
+	case errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) || strings.Contains(msg, "unreachable"):
+		return "unreachable", "网络或主机不可达，检查路由或使用trace"
+	case errors.Is(err, syscall.ECONNRESET) || strings.Contains(msg, "reset"):
+		return "reset", "连接被重置"
+	}
+	return "error", msg
+}
+
+// checkPorts 并发检查主机的多个TCP端口
+func checkPorts(ctx context.Context, host string, ports []int, timeout time.Duration) string {
+	var b strings.Builder
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	addrs, err := net.DefaultResolver.LookupHost(rctx, host)
+	cancel()
+	if err != nil {
+		return fmt.Sprintf("检查端口失败: 解析%s失败: %s", host, dnsErrorText(err))
+	}
+	if net.ParseIP(host) == nil {
+		fmt.Fprintf(&b, "%s解析为 %s\n", host, strings.Join(addrs, ", "))
+	}
+
+	results := make([]portResult, len(ports))
+	sem := make(chan struct{}, networkPortWorkers)
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		wg.Add(1)
+		go func(i, port int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			d := net.Dialer{Timeout: timeout}
+			start := time.Now()
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			r := portResult{port: port, latency: time.Since(start)}
+			r.state, r.note = dialState(err)
+			if conn != nil {
+				r.remote = conn.RemoteAddr().String()
+				conn.Close()
+			}
+			results[i] = r
+		}(i, port)
+	}
+	wg.Wait()
+
+	rows := make([][]string, 0, len(results))
+	open := 0
+	for _, r := range results {
+		if r.state == "open" {
+			open++
+		}
+		rows = append(rows, []string{strconv.Itoa(r.port), r.state, formatLatency(r.latency), r.remote, r.note})
+	}
+	fmt.Fprintf(&b, "%d个端口中%d个可以连接:\n", len(ports), open)
+	b.WriteString(formatTableRows([]string{"PORT", "STATE", "TIME", "REMOTE", "NOTE"}, rows))
+	return b.String()
+}
+
+// httpTiming 一次HTTP请求各阶段的耗时
+type httpTiming struct {
+	start, dnsStart, dnsDone, connStart, connDone, tlsStart, tlsDone, firstByte time.Time
+	reused                                                                      bool
+}
+
+// String 返回各阶段的耗时
+func (t *httpTiming) String() string {
+	var parts []string
+	if !t.dnsDone.IsZero() && !t.dnsStart.IsZero() {
+		parts = append(parts, "DNS "+formatLatency(t.dnsDone.Sub(t.dnsStart)))
+	}
+	if !t.connDone.IsZero() && !t.connStart.IsZero() {
+		parts = append(parts, "连接 "+formatLatency(t.connDone.Sub(t.connStart)))
+	}
+	if !t.tlsDone.IsZero() && !t.tlsStart.IsZero() {
+		parts = append(parts, "TLS "+formatLatency(t.tlsDone.Sub(t.tlsStart)))
+	}
+	if t.reused {
+		parts = append(parts, "复用连接")
+	}
+	if !t.firstByte.IsZero() {
+		parts = append(parts, "首字节 "+formatLatency(t.firstByte.Sub(t.start)))
+	}
+	return strings.Join(parts, "，")
+}
+
+// networkHeaders http结果中显示的响应头
+var networkHeaders = []string{"Location", "Server", "Content-Type", "Content-Length", "Cache-Control", "Strict-Transport-Security", "WWW-Authenticate", "Retry-After", "Via"}
+
+// probeHTTP 发送HEAD请求并逐个跟随重定向，返回每一步的状态、耗时和最终的TLS证书信息
+func probeHTTP(ctx context.Context, params networkParams, timeout time.Duration) (string, error) {
+	u, err := url.Parse(params.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url必须是http或https地址: %s", params.URL)
+	}
+	method := strings.ToUpper(params.Method)
+	if method == "" {
+		method = http.MethodHead
+	}
+	if method != http.MethodHead && method != http.MethodGet {
+		return "", fmt.Errorf("不支持的请求方法: %s", params.Method)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var b strings.Builder
+	for i := 0; ; i++ {
+		if proxy, err := transport.Proxy(&http.Request{URL: u}); err == nil && proxy != nil {
+			fmt.Fprintf(&b, "通过代理 %s\n", proxy.Redacted())
+		}
+		resp, timing, err := httpRequest(ctx, client, method, u)
+		if err == nil && method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			resp.Body.Close()
+			fmt.Fprintf(&b, "HEAD %s → %s，改用GET\n", u, resp.Status)
+			resp, timing, err = httpRequest(ctx, client, http.MethodGet, u)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			fmt.Fprintf(&b, "%s %s 失败（%s）: %s\n", method, u, timing, httpErrorText(err))
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) && len(certErr.UnverifiedCertificates) > 0 {
+				b.WriteString(describeCertificate(certErr.UnverifiedCertificates[0], u.Hostname()))
+			}
+			return b.String(), nil
+		}
+		resp.Body.Close()
+		fmt.Fprintf(&b, "%s %s → %s（%s）\n", resp.Request.Method, u, resp.Status, timing)
+		for _, h := range networkHeaders {
+			if v := resp.Header.Get(h); v != "" {
+				fmt.Fprintf(&b, "  %s: %s\n", h, v)
+			}
+		}
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+				fmt.Fprintf(&b, "TLS版本: %s\n", tls.VersionName(resp.TLS.Version))
+				b.WriteString(describeCertificate(resp.TLS.PeerCertificates[0], u.Hostname()))
+			}
+			return b.String(), nil
+		}
+		if i >= networkMaxRedirects {
+			fmt.Fprintf(&b, "重定向超过%d次，停止跟随\n", networkMaxRedirects)
+			return b.String(), nil
+		}
+		next, err := u.Parse(location)
+		if err != nil {
+			fmt.Fprintf(&b, "重定向地址无效: %v\n", err)
+			return b.String(), nil
+		}
+		u = next
+	}
+}
+
+// httpRequest 发送一次请求并记录各阶段的耗时
+func httpRequest(ctx context.Context, client *http.Client, method string, u *url.URL) (*http.Response, *httpTiming, error) {
+	timing := &httpTiming{}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { timing.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { timing.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { timing.connStart = time.Now() },
+		ConnectDone:          func(string, string, error) { timing.connDone = time.Now() },
+		TLSHandshakeStart:    func() { timing.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { timing.tlsDone = time.Now() },
+		GotConn:              func(info httptrace.GotConnInfo) { timing.reused = info.Reused },
+		GotFirstResponseByte: func() { timing.firstByte = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, u.String(), nil)
+	if err != nil {
+		return nil, timing, err
+	}
+	req.Header.Set("User-Agent", "chatecnu-agent")
+	timing.start = time.Now()
+	resp, err := client.Do(req)
+	if err == nil && method == http.MethodGet {
+		// 只需要状态和响应头，不读取大的响应内容
+		io.CopyN(io.Discard, resp.Body, 64*1024)
+	}
+	return resp, timing, err
+}
+
+// httpErrorText 把请求错误转换为说明
+func httpErrorText(err error) string {
+	var certErr *tls.CertificateVerificationError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &certErr):
+		return "TLS证书校验失败: " + certErr.Err.Error()
+	case errors.As(err, &dnsErr):
+		return "域名解析失败: " + dnsErrorText(dnsErr)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "超时: " + err.Error()
+	}
+	if state, note := dialState(err); state != "error" {
+		return note + ": " + err.Error()
+	}
+	return err.Error()
+}
+
+// describeCertificate 返回证书的主体、签发者、有效期和包含的域名
+func describeCertificate(cert *x509.Certificate, host string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "证书主体: %s\n", cert.Subject.String())
+	fmt.Fprintf(&b, "签发者: %s\n", cert.Issuer.String())
+	now := time.Now()
+	switch {
+	case now.After(cert.NotAfter):
+		fmt.Fprintf(&b, "有效期: %s 至 %s（已过期%d天）\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"), int(now.Sub(cert.NotAfter).Hours()/24))
+	case now.Before(cert.NotBefore):
+		fmt.Fprintf(&b, "有效期: %s 至 %s（尚未生效）\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+	default:
+		fmt.Fprintf(&b, "有效期: %s 至 %s（剩余%d天）\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"), int(cert.NotAfter.Sub(now).Hours()/24))
+	}
+	if len(cert.DNSNames) > 0 {
+		names := cert.DNSNames
+		if len(names) > 10 {
+			names = append(slices.Clone(names[:10]), fmt.Sprintf("等%d个", len(cert.DNSNames)))
+		}
+		fmt.Fprintf(&b, "证书域名: %s\n", strings.Join(names, ", "))
+	}
+	if err := cert.VerifyHostname(host); err != nil {
+		fmt.Fprintf(&b, "证书与域名%s不匹配\n", host)
+	}
+	return b.String()
+}
+
+// traceHop 路由追踪中一跳的结果
+type traceHop struct {
+	addr    net.IP        // 回应的路由器或目标主机，无响应时为nil
+	rtt     time.Duration // 往返时间
+	reached bool          // 已到达目标主机
+	note    string        // 目标不可达等说明
+}
+
+// traceRoute 逐跳增加TTL发送探测包，列出沿途回应的路由器
+func traceRoute(ctx context.Context, host string, maxHops int, timeout time.Duration) (string, error) {
+	rctx, cancel := context.WithTimeout(ctx, networkDefaultTimeout)
+	ips, err := net.DefaultResolver.LookupIP(rctx, "ip", host)
+	cancel()
+	if err != nil {
+		return fmt.Sprintf("路由追踪失败: 解析%s失败: %s", host, dnsErrorText(err)), nil
+	}
+	dst := ips[0]
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			dst = ip
+			break
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "追踪到 %s（%s）的路由，最多%d跳:\n", host, dst, maxHops)
+	var rows [][]string
+	silent := 0
+	summary := fmt.Sprintf("%d跳内没有到达目标主机\n", maxHops)
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		hop, err := traceProbe(ctx, dst, ttl, timeout)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			b.WriteString(formatTableRows([]string{"HOP", "ADDRESS", "NAME", "RTT"}, rows))
+			fmt.Fprintf(&b, "路由追踪失败: %v\n", err)
+			return b.String(), nil
+		}
+		if hop.addr == nil {
+			rows = append(rows, []string{strconv.Itoa(ttl), "*", "", ""})
+			if silent++; silent >= networkTraceSilence {
+				summary = fmt.Sprintf("连续%d跳没有响应，停止追踪。之后的路由器可能不回应探测包，或者数据包在此被丢弃\n", silent)
+				break
+			}
+			continue
+		}
+		silent = 0
+		rows = append(rows, []string{strconv.Itoa(ttl), hop.addr.String(), hopName(ctx, hop.addr), formatLatency(hop.rtt)})
+		if hop.reached {
+			summary = fmt.Sprintf("第%d跳到达目标主机\n", ttl)
+			break
+		}
+		if hop.note != "" {
+			summary = fmt.Sprintf("第%d跳的%s返回%s\n", ttl, hop.addr, hop.note)
+			break
+		}
+	}
+	b.WriteString(formatTableRows([]string{"HOP", "ADDRESS", "NAME", "RTT"}, rows))
+	b.WriteString(summary)
+	return b.String(), nil
+}
+
+// hopName 反向解析路由器的域名，查不到时为空
+func hopName(ctx context.Context, ip net.IP) string {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	traceBasePort     = 33434 // 探测包的目标端口从traceroute惯用的33434开始递增
+	soEEOriginICMP    = 2     // sock_extended_err.ee_origin: 来自ICMP
+	soEEOriginICMP6   = 3     // sock_extended_err.ee_origin: 来自ICMPv6
+	sockExtendedErrSz = 16    // struct sock_extended_err的大小，其后是回应者的地址
+)
+
+// traceProbe 以指定TTL向目标发送一个UDP探测包，通过IP_RECVERR读取路由器返回的ICMP错误，不需要root权限
+func traceProbe(ctx context.Context, dst net.IP, ttl int, timeout time.Duration) (traceHop, error) {
+	network, level, ttlOpt, errOpt := "udp4", syscall.IPPROTO_IP, syscall.IP_TTL, syscall.IP_RECVERR
+	if dst.To4() == nil {
+		network, level, ttlOpt, errOpt = "udp6", syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, syscall.IPV6_RECVERR
+	}
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return traceHop{}, fmt.Errorf("创建探测socket失败: %v", err)
+	}
+	defer conn.Close()
+	rc, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		return traceHop{}, err
+	}
+	var sockErr error
+	if err := rc.Control(func(fd uintptr) {
+		if sockErr = syscall.SetsockoptInt(int(fd), level, errOpt, 1); sockErr == nil {
+			sockErr = syscall.SetsockoptInt(int(fd), level, ttlOpt, ttl)
+		}
+	}); err != nil || sockErr != nil {
+		return traceHop{}, fmt.Errorf("设置探测socket失败: %v", errors.Join(err, sockErr))
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	start := time.Now()
+	if _, err := conn.WriteTo([]byte("chatecnu-agent"), &net.UDPAddr{IP: dst, Port: traceBasePort + ttl}); err != nil {
+		return traceHop{}, fmt.Errorf("发送探测包失败: %v", err)
+	}
+
+	var hop traceHop
+	buf, oob := make([]byte, 512), make([]byte, 512)
+	err = rc.Read(func(fd uintptr) bool {
+		_, oobn, _, _, err := syscall.Recvmsg(int(fd), buf, oob, syscall.MSG_ERRQUEUE)
+		if err == syscall.EAGAIN {
+			return false
+		}
+		if err != nil {
+			return true
+		}
+		hop.rtt = time.Since(start)
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return true
+		}
+		for _, m := range msgs {
+			if m.Header.Level == int32(level) && m.Header.Type == int32(errOpt) && len(m.Data) >= sockExtendedErrSz {
+				parseICMPError(m.Data, dst, &hop)
+			}
+		}
+		// 本机产生的错误（如MTU）不是路由器的回应，继续等待
+		return hop.addr != nil
+	})
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return traceHop{}, err
+	}
+	return hop, nil
+}
+
+// parseICMPError 解析sock_extended_err中的ICMP类型和回应者地址
+func parseICMPError(data []byte, dst net.IP, hop *traceHop) {
+	origin, icmpType, code := data[4], data[5], data[6]
+	offender := data[sockExtendedErrSz:]
+	switch {
+	case origin == soEEOriginICMP && len(offender) >= 8:
+		hop.addr = net.IP(append([]byte(nil), offender[4:8]...))
+		switch {
+		case icmpType == 11: // Time Exceeded
+		case icmpType == 3 && code == 3: // Port Unreachable，探测包到达了目标
+			hop.reached = true
+		case icmpType == 3:
+			hop.note = icmpUnreachable(code)
+		}
+	case origin == soEEOriginICMP6 && len(offender) >= 24:
+		hop.addr = net.IP(append([]byte(nil), offender[8:24]...))
+		switch {
+		case icmpType == 3: // Time Exceeded
+		case icmpType == 1 && code == 4: // Port Unreachable
+			hop.reached = true
+		case icmpType == 1:
+			hop.note = "目标不可达"
+			if code == 1 {
+				hop.note = "目标不可达（被管理策略禁止）"
+			}
+		}
+	}
+	if hop.addr != nil && hop.addr.Equal(dst) {
+		hop.reached = true
+	}
+}
+
+// icmpUnreachable 返回ICMP Destination Unreachable各代码的含义
+func icmpUnreachable(code byte) string {
+	switch code {
+	case 0:
+		return "网络不可达"
+	case 1:
+		return "主机不可达"
+	case 2:
+		return "协议不可达"
+	case 4:
+		return "需要分片但设置了不分片"
+	case 9, 10, 13:
+		return "目标不可达（被管理策略禁止）"
+	}
+	return fmt.Sprintf("目标不可达（代码%d）", code)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"time"
+)
+
+// traceProbe 非Linux系统上无法在没有管理员权限时读取ICMP错误，不支持路由追踪
+func traceProbe(ctx context.Context, dst net.IP, ttl int, timeout time.Duration) (traceHop, error) {
+	command := "traceroute"
+	if runtime.GOOS == "windows" {
+		command = "tracert"
+	}
+	return traceHop{}, fmt.Errorf("当前系统（%s）不支持路由追踪，请通过execute_command使用%s %s", runtime.GOOS, command, dst)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务结束或等待确认时提醒用户的方式
+const (
+	notifyOff     = "off"     // 不提醒
+	notifyBell    = "bell"    // 终端响铃
+	notifyOSC     = "osc"     // OSC 9终端通知，iTerm2、Windows Terminal、WezTerm、kitty等支持
+	notifyDesktop = "desktop" // 系统桌面通知：Linux上使用notify-send，macOS上使用osascript，Windows上使用PowerShell
+	notifyAuto    = "auto"    // 能发送桌面通知时使用桌面通知，否则使用OSC 9，同时响铃
+)
+
+// notifyModes --notify可用的值
+var notifyModes = []string{notifyOff, notifyBell, notifyOSC, notifyDesktop, notifyAuto}
+
+// notifyTitle 桌面通知的标题
+const notifyTitle = "ChatECNU Agent"
+
+// notifyCommandTimeout 发送桌面通知的命令的超时时间，Windows上的气泡通知需要保持显示
+const notifyCommandTimeout = 15 * time.Second
+
+// notifier 在耗时较长的任务结束或等待确认时提醒用户，便于在任务执行期间切换到其他窗口
+type notifier struct {
+	mode    string        // osc或desktop，只响铃时为空
+	bell    bool          // 是否同时响铃
+	after   time.Duration // 任务运行超过该时长才提醒
+	out     io.Writer     // 输出响铃和终端通知的终端
+	started time.Time     // 当前任务开始的时间
+	warned  bool          // 已提示过桌面通知发送失败
+}
+
+// newNotifier 根据配置创建提醒，未开启时返回nil
+func newNotifier(cfg *Config, out io.Writer) *notifier {
+	if cfg.Notify == "" || cfg.Notify == notifyOff {
+		return nil
+	}
+	n := &notifier{mode: cfg.Notify, bell: cfg.Notify != notifyOSC, after: time.Duration(cfg.NotifyAfter) * time.Second, out: out}
+	switch {
+	case cfg.Notify == notifyBell:
+		n.mode = ""
+	case cfg.Notify == notifyAuto && desktopNotifyAvailable():
+		n.mode = notifyDesktop
+	case cfg.Notify == notifyAuto:
+		n.mode = notifyOSC
+	}
+	return n
+}
+
+// begin 记录任务开始的时间
+func (n *notifier) begin() {
+	if n != nil {
+		n.started = time.Now()
+	}
+}
+
+// taskDone 任务运行超过提醒时长时通知结果，用户主动中断的任务不提醒
+func (n *notifier) taskDone(task string, err error) {
+	if n == nil || errors.Is(err, errInterrupted) {
+		return
+	}
+	elapsed := time.Since(n.started)
+	if elapsed < n.after {
+		return
+	}
+	body := fmt.Sprintf("任务已完成（用时%s）: %s", elapsed.Round(time.Second), truncateRunes(firstLine(task), 60))
+	if err != nil {
+		body = fmt.Sprintf("任务失败（用时%s）: %s", elapsed.Round(time.Second), truncateRunes(err.Error(), 80))
+	}
+	n.send(body)
+}
+
+// confirmNeeded 任务运行超过提醒时长后需要用户确认时提醒
+func (n *notifier) confirmNeeded(prompt string) {
+	if n == nil || time.Since(n.started) < n.after {
+		return
+	}
+	// 确认提示的前两行说明要执行的操作，如“即将执行命令:”和命令本身
+	lines := strings.Split(strings.TrimSpace(prompt), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	n.send("等待确认: " + truncateRunes(strings.Join(lines[:min(len(lines), 2)], " "), 80))
+}
+
+// send 按配置的方式发送提醒
+func (n *notifier) send(body string) {
+	switch n.mode {
+	case notifyOSC:
+		// 通知内容中不能出现结束序列的控制字符
+		fmt.Fprintf(n.out, "\x1b]9;%s\a", strings.Map(func(r rune) rune {
+			if r < ' ' || r == 0x7f {
+				return ' '
+			}
+			return r
+		}, notifyTitle+": "+body))
+	case notifyDesktop:
+		if err := sendDesktopNotification(notifyTitle, body); err != nil && !n.warned {
+			log.Printf("[提醒] 发送桌面通知失败，只使用终端响铃: %v\n", err)
+			n.warned = true
+		}
+	}
+	if n.bell {
+		fmt.Fprint(n.out, "\a")
+	}
+}
+
+// desktopNotifyAvailable 判断当前系统能否发送桌面通知，Linux上需要图形会话和notify-send
+func desktopNotifyAvailable() bool {
+	switch runtime.GOOS {
+	case "linux":
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return false
+		}
+		_, err := exec.LookPath("notify-send")
+		return err == nil
+	case "darwin":
+		_, err := exec.LookPath("osascript")
+		return err == nil
+	case "windows":
+		_, err := findHostShell(shellPowerShell)
+		return err == nil
+	}
+	return false
+}
+
+// sendDesktopNotification 在后台发送系统桌面通知，不等待通知关闭
+func sendDesktopNotification(title, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyCommandTimeout)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name", title, title, body)
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "osascript", "-e", fmt.Sprintf("display notification %s with title %s", strconv.Quote(body), strconv.Quote(title)))
+	case "windows":
+		shell, err := findHostShell(shellPowerShell)
+		if err != nil {
+			cancel()
+			return err
+		}
+		quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+		cmd = shell.command(ctx, "Add-Type -AssemblyName System.Windows.Forms\n"+
+			"$n = New-Object System.Windows.Forms.NotifyIcon\n"+
+			"$n.Icon = [System.Drawing.SystemIcons]::Information\n"+
+			"$n.BalloonTipTitle = "+quote(title)+"\n"+
+			"$n.BalloonTipText = "+quote(body)+"\n"+
+			"$n.Visible = $true\n$n.ShowBalloonTip(10000)\nStart-Sleep -Seconds 10\n$n.Dispose()\n")
+	default:
+		cancel()
+		return fmt.Errorf("当前系统（%s）不支持桌面通知", runtime.GOOS)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	go func() {
+		cmd.Wait()
+		cancel()
+	}()
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// stdinMaxBytes 单次运行时从管道读取的标准输入的上限
+const stdinMaxBytes = 16 << 20
+
+// 单次运行的退出码
+const (
+	exitSuccess     = 0   // 任务完成
+	exitFailure     = 1   // 任务失败
+	exitUsage       = 2   // 参数或配置错误
+	exitMaxSteps    = 3   // 达到最大步骤数仍未完成
+	exitBudget      = 4   // 超出任务的token、费用或耗时预算
+	exitInterrupted = 130 // 被Ctrl+C中断，与shell中SIGINT的约定一致
+)
+
+// 单次运行结果中的状态，成功、失败和中断与定时任务的运行结果相同
+const (
+	runMaxSteps    = "max_steps"
+	runBudget      = "budget_exceeded"
+	runSetupFailed = "setup_failed"
+)
+
+// taskOutcome 返回任务结束时的状态和退出码
+func taskOutcome(err error) (string, int) {
+	var budgetErr *budgetError
+	switch {
+	case err == nil:
+		return runSuccess, exitSuccess
+	case errors.Is(err, errInterrupted):
+		return runInterrupted, exitInterrupted
+	case errors.Is(err, errMaxSteps):
+		return runMaxSteps, exitMaxSteps
+	case errors.As(err, &budgetErr):
+		return runBudget, exitBudget
+	}
+	return runFailed, exitFailure
+}
+
+// exitSetup 在初始化Agent、恢复会话或读取标准输入失败时输出错误并退出，退出码与配置错误相同
+//
+// 单次运行使用结构化输出时先写入result事件，调用方可以与任务的结果统一处理。
+func exitSetup(cfg *Config, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	if cfg.Prompt != "" {
+		if events := newEventWriter(os.Stdout, cfg.Output); events != nil {
+			code := exitUsage
+			events.finish(&agentEvent{Status: runSetupFailed, ExitCode: &code, Error: strings.TrimSpace(msg)})
+		}
+	}
+	os.Exit(exitUsage)
+}
+
+// RunOnce 非交互地执行单个任务，最终回答或结构化的事件写入标准输出，返回进程的退出码
+//
+// 无法询问用户，需要确认的操作按--auto-approve处理，未允许时拒绝。
+func (a *ECNUAgent) RunOnce(task string) int {
+	var runs runController
+	stopListening := runs.listen()
+	defer stopListening()
+
+	start := time.Now()
+	a.events.emit(&agentEvent{Type: eventStart, Task: task, Model: a.model()})
+	ctx, done := runs.begin(context.Background())
+	err := a.ProcessUserInput(ctx, task)
+	done()
+	log.Printf("[用量] 本次%s\n", formatStats(a.usage.turnStats()))
+
+	status, code := taskOutcome(err)
+	switch {
+	case errors.Is(err, errInterrupted):
+		log.Printf("[中断] %v\n", err)
+	case err != nil:
+		log.Printf("[错误] %v\n", err)
+	}
+
+	if a.events != nil {
+		result := &agentEvent{
+			Status:     status,
+			ExitCode:   &code,
+			Step:       int(a.step.Load()),
+			Answer:     a.finalAnswer(),
+			Usage:      newEventUsage(a.usage.turnStats()),
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		a.events.finish(result)
+		return code
+	}
+	// JSON模式下ProcessUserInput已输出回答
+	if err == nil && a.responseFormat() == nil {
+		fmt.Println(a.formatAssistant(a.finalAnswer()))
+	}
+	return code
+}
+
+// withStdin 标准输入不是终端时读取其内容，作为上下文附加到任务后面
+//
+// 内容超过工具输出的上限时与工具输出一样保留开头和结尾，完整内容可用read_tool_output读取。
+func (a *ECNUAgent) withStdin(task string, stdin *os.File) (string, error) {
+	if isTerminal(stdin) {
+		return task, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(stdin, stdinMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("读取标准输入失败: %v", err)
+	}
+	if len(data) > stdinMaxBytes {
+		return "", fmt.Errorf("标准输入超过%s，请改为保存到文件后让Agent读取", formatSize(stdinMaxBytes))
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return task, nil
+	}
+	text, encoding, ok := decodeText(data)
+	if !ok {
+		return "", fmt.Errorf("标准输入是二进制内容（%s），请改为保存到文件后让Agent读取", formatSize(int64(len(data))))
+	}
+	label := fmt.Sprintf("%d行", strings.Count(strings.TrimSuffix(text, "\n"), "\n")+1)
+	if encoding != encodingUTF8 {
+		label += "，编码" + encoding.name + "，已转换为UTF-8"
+	}
+	log.Printf("[输入] 已读取标准输入（%s，%s）\n", formatSize(int64(len(data))), label)
+
+	text, _ = a.truncateText(strings.TrimSuffix(text, "\n"), a.config.ToolOutputLimit)
+	return fmt.Sprintf("%s\n\n以下是通过管道传入的标准输入（%s）：\n```\n%s\n```", task, label, strings.TrimSuffix(text, "\n")), nil
+}
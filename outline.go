@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const outlineMaxMatches = 5 // 按符号读取时最多返回的同名定义数
+
+// outlineRule 识别一类定义的规则，name为名称所在的子匹配序号
+type outlineRule struct {
+	kind string
+	re   *regexp.Regexp
+	name int
+}
+
+// outlineLanguage 一种语言的定义规则和块的结束方式
+type outlineLanguage struct {
+	name  string
+	block string // braces按花括号配对，indent按缩进，heading到下一个同级标题
+	rules []outlineRule
+	// 定义不以关键字开头的语言需要排除形如定义的控制语句
+	control bool
+}
+
+// outlineSymbol 大纲中的一个定义
+type outlineSymbol struct {
+	kind   string
+	name   string
+	parent string // 所属的类型或类
+	start  int    // 起始行号，从1开始
+	end    int
+	depth  int // 嵌套层级，标题为标题级别
+	indent int // 定义行的缩进宽度
+}
+
+// label 返回带所属类型的完整名称
+func (s outlineSymbol) label() string {
+	if s.parent != "" {
+		return s.parent + "." + s.name
+	}
+	return s.name
+}
+
+var (
+	cLikeControl = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "else": true, "do": true, "sizeof": true, "new": true, "delete": true, "throw": true}
+
+	outlineGo = outlineLanguage{name: "Go", block: "braces", rules: []outlineRule{
+		{"func", regexp.MustCompile(`^func\s+(?:\(\s*(?:\w+\s+)?\*?\s*(\w+)[^)]*\)\s*)?(\w+)`), 2},
+		{"type", regexp.MustCompile(`^type\s+(\w+)`), 1},
+		{"var", regexp.MustCompile(`^(?:var|const)\s+(\w+)`), 1},
+	}}
+	outlinePython = outlineLanguage{name: "Python", block: "indent", rules: []outlineRule{
+		{"class", regexp.MustCompile(`^\s*class\s+(\w+)`), 1},
+		{"def", regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`), 1},
+	}}
+	outlineJS = outlineLanguage{name: "JavaScript/TypeScript", block: "braces", control: true, rules: []outlineRule{
+		{"class", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`), 1},
+		{"interface", regexp.MustCompile(`^\s*(?:export\s+)?(?:interface|enum|type)\s+(\w+)`), 1},
+		{"function", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`), 1},
+		{"function", regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*=>|\w+\s*=>)`), 1},
+		{"method", regexp.MustCompile(`^\s+(?:(?:public|private|protected|static|async|readonly|get|set|override)\s+)*(\w+)\s*\([^)]*\)\s*(?::\s*[^{]+)?\{`), 1},
+	}}
+	outlineJava = outlineLanguage{name: "Java/C#/Kotlin", block: "braces", control: true, rules: []outlineRule{
+		{"class", regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|final|abstract|sealed|partial|data|open)\s+)*(?:class|interface|enum|record|struct|object)\s+(\w+)`), 1},
+		{"method", regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|final|abstract|synchronized|override|virtual|async|suspend|open)\s+)+(?:fun\s+)?(?:[\w<>\[\],.?]+\s+)?(\w+)\s*\([^;]*$`), 1},
+		{"method", regexp.MustCompile(`^\s*(?:fun\s+|[\w<>\[\],.?]+\s+)(\w+)\s*\([^;]*$`), 1},
+	}}
+	outlineC = outlineLanguage{name: "C/C++", block: "braces", control: true, rules: []outlineRule{
+		{"class", regexp.MustCompile(`^(?:typedef\s+)?(?:class|struct|enum|union|namespace)\s+(\w+)\s*[^;]*$`), 1},
+		{"func", regexp.MustCompile(`^(?:[\w:<>,*&]+\s+)+\**&?((?:\w+::)*~?\w+)\s*\([^;]*$`), 1},
+	}}
+	outlineRust = outlineLanguage{name: "Rust", block: "braces", rules: []outlineRule{
+		{"fn", regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+(\w+)`), 1},
+		{"type", regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|mod|union)\s+(\w+)`), 1},
+		{"impl", regexp.MustCompile(`^\s*impl(?:<[^>]*>)?\s+(?:[\w:<>]+\s+for\s+)?([\w:]+)`), 1},
+	}}
+	outlineShell = outlineLanguage{name: "Shell", block: "braces", rules: []outlineRule{
+		{"function", regexp.MustCompile(`^\s*(?:function\s+)?([\w-]+)\s*\(\)\s*\{?`), 1},
+		{"function", regexp.MustCompile(`^\s*function\s+([\w-]+)`), 1},
+	}}
+	outlineMarkdown = outlineLanguage{name: "Markdown", block: "heading", rules: []outlineRule{
+		{"heading", regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*$`), 2},
+	}}
+	outlineLaTeX = outlineLanguage{name: "LaTeX", block: "heading", rules: []outlineRule{
+		{"heading", regexp.MustCompile(`^\s*\\(part|chapter|section|subsection|subsubsection)\*?\s*(?:\[[^\]]*\])?\{(.+)\}`), 2},
+	}}
+
+	outlineLanguages = map[string]*outlineLanguage{
+		".go": &outlineGo, ".py": &outlinePython, ".pyw": &outlinePython,
+		".js": &outlineJS, ".jsx": &outlineJS, ".mjs": &outlineJS, ".cjs": &outlineJS, ".ts": &outlineJS, ".tsx": &outlineJS, ".vue": &outlineJS,
+		".java": &outlineJava, ".cs": &outlineJava, ".kt": &outlineJava, ".kts": &outlineJava, ".scala": &outlineJava,
+		".c": &outlineC, ".h": &outlineC, ".cc": &outlineC, ".cpp": &outlineC, ".cxx": &outlineC, ".hpp": &outlineC, ".hh": &outlineC,
+		".rs": &outlineRust, ".sh": &outlineShell, ".bash": &outlineShell, ".zsh": &outlineShell,
+		".md": &outlineMarkdown, ".markdown": &outlineMarkdown, ".tex": &outlineLaTeX,
+	}
+	latexLevels = map[string]int{"part": 0, "chapter": 1, "section": 2, "subsection": 3, "subsubsection": 4}
+)
+
+// outlineLanguageFor 按扩展名返回文件的语言，不支持时返回nil
+func outlineLanguageFor(path string) *outlineLanguage {
+	return outlineLanguages[strings.ToLower(filepath.Ext(path))]
+}
+
+// buildOutline 提取文件中的定义及其行范围
+func buildOutline(lang *outlineLanguage, lines []string) []outlineSymbol {
+	var symbols []outlineSymbol
+	fenced := false
+	for i, raw := range lines {
+		line := strings.TrimRight(raw, "\r")
+		// Markdown代码块中的#注释不是标题
+		if lang == &outlineMarkdown && (strings.HasPrefix(strings.TrimSpace(line), "```") || strings.HasPrefix(strings.TrimSpace(line), "~~~")) {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		for _, rule := range lang.rules {
+			m := rule.re.FindStringSubmatch(line)
+			if m == nil || m[rule.name] == "" {
+				continue
+			}
+			name := m[rule.name]
+			// 排除return foo(、if (x) {这类语句
+			if first, _, _ := strings.Cut(strings.TrimSpace(line), " "); lang.control && (cLikeControl[name] || cLikeControl[first]) {
+				break
+			}
+			sym := outlineSymbol{kind: rule.kind, name: name, start: i + 1, indent: indentWidth(line)}
+			switch lang {
+			case &outlineGo:
+				// 方法的接收者类型作为所属类型
+				if rule.kind == "func" {
+					sym.parent = m[1]
+				}
+			case &outlineMarkdown:
+				sym.depth = len(m[1]) - 1
+			case &outlineLaTeX:
+				sym.depth = latexLevels[m[1]]
+			}
+			symbols = append(symbols, sym)
+			break
+		}
+	}
+
+	for i := range symbols {
+		s := &symbols[i]
+		switch lang.block {
+		case "indent":
+			s.end = indentBlockEnd(lines, s.start-1)
+		case "heading":
+			s.end = len(lines)
+			for _, next := range symbols[i+1:] {
+				if next.depth <= s.depth {
+					s.end = next.start - 1
+					break
+				}
+			}
+		default:
+			s.end = braceBlockEnd(lines, s.start-1)
+		}
+		// 嵌套在类中的方法归属于该类
+		if lang.block == "heading" {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if p := symbols[j]; p.end >= s.end && p.indent < s.indent {
+				s.depth = p.depth + 1
+				if s.parent == "" && (p.kind == "class" || p.kind == "impl" || p.kind == "type" || p.kind == "interface") {
+					s.parent = p.name
+				}
+				break
+			}
+		}
+	}
+	return symbols
+}
+
+// indentWidth 返回行首空白的宽度，制表符按4个空格计算
+func indentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// indentBlockEnd 返回以缩进划分的块的最后一行，块内的空行、更深缩进的行和多行字符串都属于该块
+func indentBlockEnd(lines []string, start int) int {
+	base := indentWidth(lines[start])
+	end := start
+	// 跨行的函数签名在括号闭合前都属于定义行
+	open := strings.Count(lines[start], "(") - strings.Count(lines[start], ")")
+	inString := tripleQuotes(lines[start])%2 == 1
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if inString || open > 0 {
+			inString = inString != (tripleQuotes(line)%2 == 1)
+			open += strings.Count(line, "(") - strings.Count(line, ")")
+			end = i
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if indentWidth(line) <= base {
+			break
+		}
+		inString = tripleQuotes(line)%2 == 1
+		end = i
+	}
+	return end + 1
+}
+
+// tripleQuotes 统计行中三引号的个数，为奇数时多行字符串在该行开始或结束
+func tripleQuotes(line string) int {
+	return strings.Count(line, `"""`) + strings.Count(line, "'''")
+}
+
+// braceBlockEnd 返回从start行开始的花括号块的最后一行，跳过字符串和注释中的括号。
+// 定义行之后没有出现花括号且括号已闭合、下一行也不以{开头时视为单行声明
+func braceBlockEnd(lines []string, start int) int {
+	depth, parens := 0, 0
+	opened, inBlockComment := false, false
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		var quote byte
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case inBlockComment:
+				if c == '*' && j+1 < len(line) && line[j+1] == '/' {
+					inBlockComment = false
+					j++
+				}
+			case quote != 0:
+				if c == '\\' {
+					j++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '/' && j+1 < len(line) && line[j+1] == '/':
+				j = len(line)
+			case c == '/' && j+1 < len(line) && line[j+1] == '*':
+				inBlockComment = true
+				j++
+			case c == '"' || c == '\'' || c == '`':
+				quote = c
+			case c == '(':
+				parens++
+			case c == ')':
+				parens--
+			case c == '{':
+				depth++
+				opened = true
+			case c == '}':
+				depth--
+				if opened && depth <= 0 {
+					return i + 1
+				}
+			case c == ';' && !opened && parens <= 0:
+				return i + 1
+			}
+		}
+		if opened || parens > 0 {
+			continue
+		}
+		text := strings.TrimSpace(line)
+		next := ""
+		for k := i + 1; k < len(lines) && next == ""; k++ {
+			next = strings.TrimSpace(lines[k])
+		}
+		if !strings.HasPrefix(next, "{") && !strings.HasPrefix(next, "where") && !strings.HasSuffix(text, "=>") && !strings.HasSuffix(text, ",") {
+			return i + 1
+		}
+	}
+	return len(lines)
+}
+
+// formatOutline 生成大纲文本，超过maxBytes时截断
+func formatOutline(label string, lang *outlineLanguage, symbols []outlineSymbol, totalLines, maxBytes int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "文件大纲 (%s，%s，共%d行，%d个定义):\n", label, lang.name, totalLines, len(symbols))
+	for i, s := range symbols {
+		line := fmt.Sprintf("%s%d-%d %s %s\n", strings.Repeat("  ", min(s.depth, 6)), s.start, s.end, s.kind, s.label())
+		if lang.block == "heading" {
+			line = fmt.Sprintf("%s%d-%d %s\n", strings.Repeat("  ", min(s.depth, 6)), s.start, s.end, s.name)
+		}
+		if maxBytes > 0 && b.Len()+len(line) > maxBytes {
+			fmt.Fprintf(&b, "...（还有%d个定义未显示，可用offset和limit分段读取）\n", len(symbols)-i)
+			break
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\n使用symbol参数读取某个定义的完整内容（如\"Name\"或\"Type.Name\"），或用offset和limit读取指定行")
+	return b.String()
+}
+
+// findSymbols 按名称查找定义，name可以带所属类型，不区分大小写
+func findSymbols(symbols []outlineSymbol, name string) []outlineSymbol {
+	var matches []outlineSymbol
+	for _, s := range symbols {
+		if strings.EqualFold(s.label(), name) || (!strings.Contains(name, ".") && strings.EqualFold(s.name, name)) {
+			matches = append(matches, s)
+		}
+	}
+	return matches
+}
+
+// readSymbol 返回符号定义所在的行，找不到时列出名称相近的定义
+func readSymbol(label, fullPath, text, name string, maxBytes int) string {
+	lang := outlineLanguageFor(fullPath)
+	if lang == nil {
+		return fmt.Sprintf("读取文件失败: 不支持按符号读取%s文件，请使用offset和limit", filepath.Ext(fullPath))
+	}
+	lines := splitLines(text)
+	symbols := buildOutline(lang, lines)
+	matches := findSymbols(symbols, name)
+	if len(matches) == 0 {
+		var similar []string
+		key := strings.ToLower(name[strings.LastIndex(name, ".")+1:])
+		for _, s := range symbols {
+			if strings.Contains(strings.ToLower(s.label()), key) && len(similar) < 10 {
+				similar = append(similar, fmt.Sprintf("%s（第%d行）", s.label(), s.start))
+			}
+		}
+		msg := fmt.Sprintf("%s 中没有找到定义%s", fullPath, name)
+		if len(similar) > 0 {
+			msg += "，名称相近的有: " + strings.Join(similar, "、")
+		} else {
+			msg += "，可用outline参数查看文件中的全部定义"
+		}
+		return msg
+	}
+
+	var b strings.Builder
+	for i, s := range matches {
+		if i == outlineMaxMatches {
+			fmt.Fprintf(&b, "...（还有%d个同名定义未显示）\n", len(matches)-i)
+			break
+		}
+		// 包含定义上方紧邻的注释、装饰器和注解
+		start := s.start - 1
+		for start > 0 {
+			prev := strings.TrimSpace(lines[start-1])
+			if !strings.HasPrefix(prev, "//") && !strings.HasPrefix(prev, "#") && !strings.HasPrefix(prev, "@") && !strings.HasPrefix(prev, "*") && !strings.HasPrefix(prev, "/*") {
+				break
+			}
+			if lang.block == "heading" || strings.HasPrefix(prev, "#!") {
+				break
+			}
+			start--
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(readFilePage(fmt.Sprintf("%s，%s %s", label, s.kind, s.label()), text, start+1, s.end-start, maxBytes))
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
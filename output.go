@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// jsonRepairAttempts 最终回答不符合JSON要求时允许模型修正的次数
+const jsonRepairAttempts = 2
+
+// jsonOutput 是否要求最终回答为JSON
+func (c *Config) jsonOutput() bool {
+	return c.JSONMode || c.JSONSchema != ""
+}
+
+// loadOutputSchema 读取约束最终回答的JSON Schema文件
+func loadOutputSchema(path string) (map[string]interface{}, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取JSON Schema失败: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("解析JSON Schema失败: %v", err)
+	}
+	return schema, nil
+}
+
+// responseFormat 返回对话请求使用的输出格式，未开启JSON输出或为子智能体时返回nil
+func (a *ECNUAgent) responseFormat() *openai.ChatCompletionResponseFormat {
+	if !a.config.jsonOutput() || a.subagent {
+		return nil
+	}
+	return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+}
+
+// jsonOutputPrompt 生成追加到系统提示词中的JSON输出要求
+//
+// 多数OpenAI兼容服务只支持json_object模式，因此Schema写入提示词，由客户端校验。
+func jsonOutputPrompt(schema map[string]interface{}) string {
+	prompt := "\n\n输出要求：需要调用工具时正常调用；给出最终回答时，只输出一个JSON对象，不要包含任何其他文字或代码块标记。"
+	if schema != nil {
+		data, _ := json.MarshalIndent(schema, "", "  ")
+		prompt += fmt.Sprintf("\n最终回答必须符合以下JSON Schema：\n%s", data)
+	}
+	return prompt
+}
+
+// extractJSONAnswer 去掉回答外层可能带有的代码块标记
+func extractJSONAnswer(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	}
+	return strings.TrimSpace(content)
+}
+
+// checkJSONAnswer 校验最终回答是否为合法JSON并符合输出Schema
+func (a *ECNUAgent) checkJSONAnswer(content string) []schemaProblem {
+	answer := extractJSONAnswer(content)
+	if answer == "" {
+		return []schemaProblem{{Path: "$", Message: "回答为空"}}
+	}
+	return validateArguments(a.outputSchema, answer)
+}
+
+// jsonRepairMessage 生成要求模型修正JSON回答的消息
+func jsonRepairMessage(problems []schemaProblem) openai.ChatCompletionMessage {
+	var b strings.Builder
+	b.WriteString("你的最终回答不符合要求的JSON格式：\n")
+	for _, p := range problems {
+		fmt.Fprintf(&b, "- %s: %s\n", p.Path, p.Message)
+	}
+	b.WriteString("请只输出修正后的JSON对象。")
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: b.String(),
+	}
+}
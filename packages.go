@@ -0,0 +1,649 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	packageQueryTimeout = 60 * time.Second // search和list的时间上限，install和remove只受tool-timeout限制
+	packageDefaultLimit = 100              // search和list默认返回的行数
+	packageMaxLimit     = 1000             // search和list最多返回的行数
+	packageMaxOutput    = 20               // 安装失败时最多返回的输出行数
+)
+
+// packageNamePattern 合法的包名，可以带版本约束，拒绝以-开头的选项和shell特殊字符
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9@_.+/:~][A-Za-z0-9@_.+/:~=<>!,\-^*\[\]]*$`)
+
+// goMajorVersionPattern Go模块路径末尾的主版本后缀
+var goMajorVersionPattern = regexp.MustCompile(`^v\d+$`)
+
+// packageSummaryPattern 安装和卸载输出中概括结果的行
+var packageSummaryPattern = regexp.MustCompile(`(?i)newly installed|to remove|successfully (un)?installed|^(added|removed|changed|up to date)\b|already (installed|satisfied)|is already the newest version|nothing to do|^(installed|removed|upgraded):|^complete!$|^\(\d+/\d+\) (installing|removing)|warning: .*(reinstalling|up to date)`)
+
+// packageErrorPattern 安装和卸载失败时输出中说明原因的行
+var packageErrorPattern = regexp.MustCompile(`(?i)^e:|error|unable to locate|no match for argument|not found|could not|cannot|permission denied|password is required|externally-managed|conflict|npm err!|^go: `)
+
+// packageManager 一种包管理器的命令，命令末尾依次追加查询词或包名
+type packageManager struct {
+	name    string
+	bin     string // 用于检测是否安装的命令
+	system  bool   // 系统包管理器，安装和卸载需要root权限
+	search  []string
+	list    []string
+	install []string
+	remove  []string
+	env     []string // 安装和卸载时额外的环境变量
+}
+
+// packageManagers 支持的包管理器，系统包管理器按自动检测的顺序排列
+var packageManagers = []packageManager{
+	{name: "apt", bin: "apt-get", system: true,
+		search:  []string{"apt-cache", "search"},
+		list:    []string{"dpkg-query", "-W", "-f=${Package}\t${Version}\t${db:Status-Abbrev}\n"},
+		install: []string{"apt-get", "install", "-y"},
+		remove:  []string{"apt-get", "remove", "-y"},
+		env:     []string{"DEBIAN_FRONTEND=noninteractive"}},
+	{name: "dnf", bin: "dnf", system: true,
+		search:  []string{"dnf", "search", "-q"},
+		list:    []string{"rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\n"},
+		install: []string{"dnf", "install", "-y"},
+		remove:  []string{"dnf", "remove", "-y"}},
+	{name: "yum", bin: "yum", system: true,
+		search:  []string{"yum", "search", "-q"},
+		list:    []string{"rpm", "-qa", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\n"},
+		install: []string{"yum", "install", "-y"},
+		remove:  []string{"yum", "remove", "-y"}},
+	{name: "pacman", bin: "pacman", system: true,
+		search:  []string{"pacman", "-Ss"},
+		list:    []string{"pacman", "-Q"},
+		install: []string{"pacman", "-S", "--noconfirm", "--needed"},
+		remove:  []string{"pacman", "-R", "--noconfirm"}},
+	{name: "apk", bin: "apk", system: true,
+		search:  []string{"apk", "search", "-v", "-d"},
+		list:    []string{"apk", "info", "-v"},
+		install: []string{"apk", "add"},
+		remove:  []string{"apk", "del"}},
+	{name: "brew", bin: "brew",
+		search:  []string{"brew", "search"},
+		list:    []string{"brew", "list", "--versions"},
+		install: []string{"brew", "install"},
+		remove:  []string{"brew", "uninstall"},
+		env:     []string{"HOMEBREW_NO_AUTO_UPDATE=1"}},
+	{name: "pip", bin: "python",
+		search:  []string{"-m", "pip", "index", "versions"},
+		list:    []string{"-m", "pip", "list", "--format=json"},
+		install: []string{"-m", "pip", "install", "--disable-pip-version-check"},
+		remove:  []string{"-m", "pip", "uninstall", "-y"}},
+	{name: "npm", bin: "npm",
+		search:  []string{"npm", "search", "--json"},
+		list:    []string{"npm", "ls", "--depth=0", "--json"},
+		install: []string{"npm", "install", "--no-fund", "--no-audit"},
+		remove:  []string{"npm", "uninstall", "--no-fund", "--no-audit"}},
+	{name: "go", bin: "go",
+		list:    []string{"go", "version", "-m"},
+		install: []string{"go", "install"}},
+}
+
+// managePackagesTool 管理软件包的工具定义
+var managePackagesTool = Tool{
+	Type:       "function",
+	Name:       "manage_packages",
+	Sequential: true,
+	Description: "通过apt、dnf/yum、pacman、apk、brew、pip、npm或go搜索、安装、列出和卸载软件包，代替直接执行安装命令，返回整理后的结果而不是完整的安装输出。" +
+		"不指定manager时自动检测系统包管理器；Python包用pip（优先使用VIRTUAL_ENV或工作目录下的.venv），Node包用npm（默认安装到工作目录，global为true时全局安装），Go命令行工具用go。install和remove执行前会询问用户确认。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"search", "list", "install", "remove"},
+				"description": "search搜索可安装的包（pip只能查询指定包名的可用版本）；list列出已安装的包；install安装；remove卸载",
+			},
+			"manager": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"apt", "dnf", "yum", "pacman", "apk", "brew", "pip", "npm", "go"},
+				"description": "使用的包管理器，默认自动检测系统包管理器",
+			},
+			"packages": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "install和remove的包名，可以带版本，如requests==2.31.0、lodash@4、golang.org/x/tools/gopls@latest",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "search的搜索词；list时只列出名称包含该文本的包",
+			},
+			"global": map[string]interface{}{
+				"type":        "boolean",
+				"description": "npm是否操作全局安装的包，默认false操作工作目录中的项目",
+				"default":     false,
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "search和list最多返回的行数，默认100",
+				"minimum":     1,
+				"maximum":     packageMaxLimit,
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// packageParams manage_packages的参数
+type packageParams struct {
+	Action   string   `json:"action"`
+	Manager  string   `json:"manager"`
+	Packages []string `json:"packages"`
+	Query    string   `json:"query"`
+	Global   bool     `json:"global"`
+	Limit    int      `json:"limit"`
+}
+
+// packageRow 搜索或列出的一个包
+type packageRow struct {
+	name, version, description string
+}
+
+// managePackages 根据action搜索、列出、安装或卸载软件包
+func (a *ECNUAgent) managePackages(ctx context.Context, args string) (string, error) {
+	params := packageParams{Limit: packageDefaultLimit}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	params.Limit = max(1, min(params.Limit, packageMaxLimit))
+	switch params.Action {
+	case "search":
+		if params.Query == "" {
+			return "", fmt.Errorf("search需要query参数")
+		}
+	case "install", "remove":
+		if len(params.Packages) == 0 {
+			return "", fmt.Errorf("%s需要packages参数", params.Action)
+		}
+		for _, p := range params.Packages {
+			if !packageNamePattern.MatchString(p) {
+				return "", fmt.Errorf("包名%q不合法", p)
+			}
+		}
+	case "list":
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+
+	m, err := a.findPackageManager(params.Manager)
+	if err != nil {
+		return fmt.Sprintf("管理软件包失败: %v", err), nil
+	}
+	log.Printf("[软件包] %s %s %s%s\n", m.name, params.Action, strings.Join(params.Packages, " "), params.Query)
+
+	switch params.Action {
+	case "search":
+		if m.search == nil {
+			return fmt.Sprintf("%s不支持搜索，请在 https://pkg.go.dev 查找模块路径后直接安装", m.name), nil
+		}
+		return a.queryPackages(ctx, m, params, append(slices.Clone(m.search), params.Query)), nil
+	case "list":
+		if m.name == "go" {
+			if dir := goBinDir(); dir == "" || !isDir(dir) {
+				return fmt.Sprintf("还没有通过go install安装的命令（%s不存在）", dir), nil
+			}
+		}
+		return a.queryPackages(ctx, m, params, a.packageListCommand(m, params)), nil
+	}
+	return a.changePackages(ctx, m, params), nil
+}
+
+// findPackageManager 返回指定的包管理器，name为空时返回第一个可用的系统包管理器
+func (a *ECNUAgent) findPackageManager(name string) (packageManager, error) {
+	if name != "" {
+		i := slices.IndexFunc(packageManagers, func(m packageManager) bool { return m.name == name })
+		if i < 0 {
+			return packageManager{}, fmt.Errorf("不支持的包管理器: %s", name)
+		}
+		m := packageManagers[i]
+		if !a.packageManagerAvailable(&m) {
+			if m.name == "pip" {
+				return m, fmt.Errorf("未找到Python解释器")
+			}
+			return m, fmt.Errorf("未找到%s命令", m.bin)
+		}
+		return m, nil
+	}
+	var available []string
+	for _, m := range packageManagers {
+		if !a.packageManagerAvailable(&m) {
+			continue
+		}
+		if m.system || m.name == "brew" {
+			return m, nil
+		}
+		available = append(available, m.name)
+	}
+	if len(available) == 0 {
+		return packageManager{}, fmt.Errorf("没有找到可用的包管理器")
+	}
+	return packageManager{}, fmt.Errorf("没有找到系统包管理器，可用的有: %s，请用manager参数指定", strings.Join(available, ", "))
+}
+
+// packageManagerAvailable 判断包管理器的命令是否存在，pip的bin替换为找到的Python解释器
+func (a *ECNUAgent) packageManagerAvailable(m *packageManager) bool {
+	if m.name == "pip" {
+		m.bin = a.pythonInterpreter()
+		return m.bin != ""
+	}
+	_, err := exec.LookPath(m.bin)
+	return err == nil
+}
+
+// pythonInterpreter 返回pip使用的Python解释器：已激活的虚拟环境、工作目录下的.venv或venv，最后是PATH中的python3
+func (a *ECNUAgent) pythonInterpreter() string {
+	bin := filepath.Join("bin", "python")
+	if runtime.GOOS == "windows" {
+		bin = filepath.Join("Scripts", "python.exe")
+	}
+	var candidates []string
+	if venv := os.Getenv("VIRTUAL_ENV"); venv != "" {
+		candidates = append(candidates, filepath.Join(venv, bin))
+	}
+	candidates = append(candidates, filepath.Join(a.workingDir, ".venv", bin), filepath.Join(a.workingDir, "venv", bin))
+	for _, p := range candidates {
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			return p
+		}
+	}
+	for _, name := range []string{"python3", "python"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// packageArgv 返回包管理器命令的完整参数，pip的命令以解释器开头
+func packageArgv(m packageManager, args []string) []string {
+	if m.name == "pip" {
+		return append([]string{m.bin}, args...)
+	}
+	return args
+}
+
+// packageListCommand 返回列出已安装包的命令
+func (a *ECNUAgent) packageListCommand(m packageManager, params packageParams) []string {
+	args := slices.Clone(m.list)
+	switch {
+	case m.name == "npm" && params.Global:
+		args = append(args, "-g")
+	case m.name == "go":
+		args = append(args, goBinDir())
+	}
+	return args
+}
+
+// goBinDir 返回go install安装命令的目录
+func goBinDir() string {
+	out, err := exec.Command("go", "env", "GOBIN", "GOPATH").Output()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+		return strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 {
+		return filepath.Join(filepath.SplitList(strings.TrimSpace(lines[1]))[0], "bin")
+	}
+	return ""
+}
+
+// runPackageCommand 在工作目录中执行包管理器命令，返回合并的输出
+func (a *ECNUAgent) runPackageCommand(ctx context.Context, argv []string, env []string) (string, error) {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = a.workingDir
+	cmd.Env = append(os.Environ(), env...)
+	setProcessGroup(cmd)
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// queryPackages 执行search或list并把输出整理为表格
+func (a *ECNUAgent) queryPackages(ctx context.Context, m packageManager, params packageParams, args []string) string {
+	qctx, cancel := context.WithTimeout(ctx, packageQueryTimeout)
+	defer cancel()
+	out, err := a.runPackageCommand(qctx, packageArgv(m, args), nil)
+	rows := parsePackageRows(m.name, params.Action, out)
+	if params.Action == "list" && params.Query != "" {
+		query := strings.ToLower(params.Query)
+		rows = slices.DeleteFunc(rows, func(r packageRow) bool {
+			return !strings.Contains(strings.ToLower(r.name), query)
+		})
+	}
+	if len(rows) == 0 {
+		// npm ls在依赖不完整时也返回非零，只有没解析出结果时才视为失败
+		if err != nil {
+			return fmt.Sprintf("%s %s失败: %v\n%s", m.name, params.Action, err, packageErrorLines(out))
+		}
+		if params.Action == "search" {
+			return fmt.Sprintf("%s中没有找到与%q匹配的包", m.name, params.Query)
+		}
+		return fmt.Sprintf("%s中没有符合条件的已安装包", m.name)
+	}
+
+	total := len(rows)
+	rows = rows[:min(total, params.Limit)]
+	table := make([][]string, len(rows))
+	for i, r := range rows {
+		table[i] = []string{r.name, r.version, r.description}
+	}
+	verb := "匹配的包"
+	if params.Action == "list" {
+		verb = "已安装的包"
+	}
+	result := fmt.Sprintf("%s中共%d个%s", m.name, total, verb)
+	if total > len(rows) {
+		result += fmt.Sprintf("，显示前%d个", len(rows))
+	}
+	return result + ":\n" + formatTableRows([]string{"NAME", "VERSION", "DESCRIPTION"}, table)
+}
+
+// parsePackageRows 按包管理器的输出格式解析search和list的结果
+func parsePackageRows(manager, action, out string) []packageRow {
+	var rows []packageRow
+	lines := strings.Split(out, "\n")
+	switch {
+	case manager == "pip" && action == "list":
+		var items []struct{ Name, Version string }
+		json.Unmarshal([]byte(out), &items)
+		for _, it := range items {
+			rows = append(rows, packageRow{name: it.Name, version: it.Version})
+		}
+	case manager == "pip":
+		// pip index versions的输出: name (latest)\nAvailable versions: ...
+		if len(lines) > 0 {
+			if name, ver, ok := strings.Cut(lines[0], " ("); ok {
+				r := packageRow{name: name, version: strings.TrimSuffix(ver, ")")}
+				for _, line := range lines[1:] {
+					if v, ok := strings.CutPrefix(strings.TrimSpace(line), "Available versions:"); ok {
+						r.description = "可用版本: " + strings.TrimSpace(v)
+					}
+				}
+				rows = append(rows, r)
+			}
+		}
+	case manager == "npm" && action == "search":
+		var items []struct{ Name, Version, Description string }
+		json.Unmarshal([]byte(out), &items)
+		for _, it := range items {
+			rows = append(rows, packageRow{it.Name, it.Version, it.Description})
+		}
+	case manager == "npm":
+		var tree struct {
+			Dependencies map[string]struct{ Version string } `json:"dependencies"`
+		}
+		json.Unmarshal([]byte(out), &tree)
+		for name, dep := range tree.Dependencies {
+			rows = append(rows, packageRow{name: name, version: dep.Version})
+		}
+		slices.SortFunc(rows, func(a, b packageRow) int { return strings.Compare(a.name, b.name) })
+	case manager == "go":
+		// go version -m的输出: 文件: go版本，其后以制表符开头的path和mod行
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if !strings.HasPrefix(line, "\t") {
+				if file, version, ok := strings.Cut(line, ": "); ok && strings.HasPrefix(version, "go") {
+					rows = append(rows, packageRow{name: filepath.Base(file)})
+				}
+				continue
+			}
+			switch {
+			case len(rows) == 0:
+			case len(fields) >= 2 && fields[0] == "path":
+				rows[len(rows)-1].description = fields[1]
+			case len(fields) >= 3 && fields[0] == "mod":
+				rows[len(rows)-1].version = fields[2]
+			}
+		}
+	case manager == "apt" && action == "list":
+		for _, line := range lines {
+			if f := strings.Split(line, "\t"); len(f) == 3 && strings.HasPrefix(f[2], "ii") {
+				rows = append(rows, packageRow{name: f[0], version: f[1]})
+			}
+		}
+	case (manager == "dnf" || manager == "yum") && action == "list":
+		for _, line := range lines {
+			if name, ver, ok := strings.Cut(line, "\t"); ok {
+				rows = append(rows, packageRow{name: name, version: ver})
+			}
+		}
+	case action == "list" && (manager == "pacman" || manager == "brew"):
+		for _, line := range lines {
+			if f := strings.Fields(line); len(f) >= 2 {
+				rows = append(rows, packageRow{name: f[0], version: strings.Join(f[1:], " ")})
+			}
+		}
+	case manager == "apk":
+		// apk的输出: name-1.2.3-r0 - 描述
+		for _, line := range lines {
+			full, desc, _ := strings.Cut(line, " - ")
+			if full = strings.TrimSpace(full); full == "" || strings.HasPrefix(full, "WARNING") {
+				continue
+			}
+			name, ver := splitAPKName(full)
+			rows = append(rows, packageRow{name, ver, desc})
+		}
+	case manager == "pacman":
+		// pacman -Ss的输出: repo/name version [installed]，下一行缩进的描述
+		for _, line := range lines {
+			if strings.HasPrefix(line, " ") && len(rows) > 0 {
+				rows[len(rows)-1].description = strings.TrimSpace(line)
+			} else if f := strings.Fields(line); len(f) >= 2 {
+				rows = append(rows, packageRow{name: f[0], version: strings.Join(f[1:], " ")})
+			}
+		}
+	case manager == "dnf" || manager == "yum":
+		// dnf search的输出: name.arch : 描述
+		for _, line := range lines {
+			if name, desc, ok := strings.Cut(line, " : "); ok && !strings.HasPrefix(line, "=") {
+				rows = append(rows, packageRow{name: strings.TrimSpace(name), description: strings.TrimSpace(desc)})
+			}
+		}
+	case manager == "apt":
+		for _, line := range lines {
+			if name, desc, ok := strings.Cut(line, " - "); ok {
+				rows = append(rows, packageRow{name: name, description: desc})
+			}
+		}
+	default:
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "==>") {
+				rows = append(rows, packageRow{name: line})
+			}
+		}
+	}
+	return rows
+}
+
+// splitAPKName 把apk的name-version-rN拆分为包名和版本
+func splitAPKName(full string) (string, string) {
+	end := strings.LastIndex(full, "-")
+	if end <= 0 {
+		return full, ""
+	}
+	if start := strings.LastIndex(full[:end], "-"); start > 0 {
+		return full[:start], full[start+1:]
+	}
+	return full[:end], full[end+1:]
+}
+
+// packageBaseName 去掉包名中的版本约束，用于安装后查询版本
+func packageBaseName(manager, spec string) string {
+	switch manager {
+	case "npm":
+		if i := strings.LastIndex(spec, "@"); i > 0 {
+			spec = spec[:i]
+		}
+	case "go":
+		spec, _, _ = strings.Cut(spec, "@")
+		parts := strings.Split(spec, "/")
+		// 主版本后缀不是命令名，如github.com/x/y/v2
+		for len(parts) > 1 && goMajorVersionPattern.MatchString(parts[len(parts)-1]) {
+			parts = parts[:len(parts)-1]
+		}
+		spec = parts[len(parts)-1]
+	default:
+		if i := strings.IndexAny(spec, "=<>!~[;:"); i > 0 {
+			spec = spec[:i]
+		}
+	}
+	return strings.ToLower(spec)
+}
+
+// changePackages 经命令策略检查和用户确认后安装或卸载软件包，返回整理后的结果
+func (a *ECNUAgent) changePackages(ctx context.Context, m packageManager, params packageParams) string {
+	args := slices.Clone(m.install)
+	if params.Action == "remove" {
+		args = slices.Clone(m.remove)
+	}
+	if args == nil {
+		return fmt.Sprintf("%s不支持%s，go install安装的命令可以直接删除%s中的文件", m.name, params.Action, goBinDir())
+	}
+	if m.name == "npm" && params.Global {
+		args = append(args, "-g")
+	}
+	for _, p := range params.Packages {
+		if m.name == "go" && params.Action == "install" && !strings.Contains(p, "@") {
+			p += "@latest"
+		}
+		args = append(args, p)
+	}
+	argv, env := packageArgv(m, args), m.env
+	// 非root用户通过sudo -n执行系统包管理器，需要密码时直接失败而不是等待输入；sudo会清除环境变量，改由env传入
+	if m.system && runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err == nil {
+			prefix := []string{"sudo", "-n"}
+			if len(env) > 0 {
+				prefix = append(append(prefix, "env"), env...)
+			}
+			argv, env = append(prefix, argv...), nil
+		}
+	}
+	command := strings.Join(argv, " ")
+	if refusal := a.policyDenied(command); refusal != "" {
+		return refusal
+	}
+	verb := map[string]string{"install": "安装", "remove": "卸载"}[params.Action]
+	ok, err := a.confirm(ctx, approveDangerous, fmt.Sprintf("\n即将使用%s%s: %s\n  $ %s\n是否执行？(y/N) ", m.name, verb, strings.Join(params.Packages, " "), command))
+	if err != nil {
+		return fmt.Sprintf("%s软件包失败: 需要用户确认: %v", verb, err)
+	}
+	if !ok {
+		return fmt.Sprintf("用户拒绝%s %s，软件包未改变。请询问用户原因或换一种方式完成任务。", verb, strings.Join(params.Packages, " "))
+	}
+
+	log.Printf("[软件包] 正在执行: %s\n", command)
+	start := time.Now()
+	out, runErr := a.runPackageCommand(ctx, argv, env)
+	if ctx.Err() != nil {
+		return fmt.Sprintf("%s软件包被中断: %v", verb, ctx.Err())
+	}
+
+	var b strings.Builder
+	if runErr != nil {
+		fmt.Fprintf(&b, "%s %s失败（%s）: %v\n", m.name, verb, time.Since(start).Round(time.Second), runErr)
+		b.WriteString(packageErrorLines(out))
+		switch {
+		case strings.Contains(out, "password is required") || strings.Contains(out, "permission denied") || strings.Contains(out, "Permission denied") || strings.Contains(out, "are you root"):
+			b.WriteString("权限不足，需要以root运行Agent或为当前用户配置免密码sudo，也可以请用户手动执行上面的命令\n")
+		case strings.Contains(out, "externally-managed-environment"):
+			b.WriteString("系统的Python不允许直接安装包，请先在工作目录创建虚拟环境（python3 -m venv .venv），之后pip会自动使用它\n")
+		}
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%s %s完成（%s）\n", m.name, verb, time.Since(start).Round(time.Second))
+	for _, line := range packageSummaryLines(out) {
+		b.WriteString("  " + line + "\n")
+	}
+	if params.Action == "install" {
+		b.WriteString(a.installedVersions(ctx, m, params))
+	}
+	return b.String()
+}
+
+// installedVersions 安装后列出所安装的包的版本
+func (a *ECNUAgent) installedVersions(ctx context.Context, m packageManager, params packageParams) string {
+	qctx, cancel := context.WithTimeout(ctx, packageQueryTimeout)
+	defer cancel()
+	out, _ := a.runPackageCommand(qctx, packageArgv(m, a.packageListCommand(m, params)), nil)
+	installed := map[string]string{}
+	for _, r := range parsePackageRows(m.name, "list", out) {
+		installed[strings.ToLower(r.name)] = r.version
+	}
+	var rows [][]string
+	for _, p := range params.Packages {
+		// 从本地路径或URL安装时包名与参数不同，无法对应
+		if strings.HasPrefix(p, ".") || strings.HasPrefix(p, "/") || strings.Contains(p, "://") {
+			continue
+		}
+		name := packageBaseName(m.name, p)
+		version, ok := installed[name]
+		if !ok {
+			// pip中-和_等价
+			version, ok = installed[strings.ReplaceAll(name, "_", "-")]
+		}
+		if !ok {
+			version = "未在已安装列表中找到"
+		}
+		rows = append(rows, []string{name, version})
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+	return "已安装的版本:\n" + formatTableRows([]string{"NAME", "VERSION"}, rows)
+}
+
+// packageSummaryLines 从安装输出中挑出概括结果的行
+func packageSummaryLines(out string) []string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); packageSummaryPattern.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines[:min(len(lines), 10)]
+}
+
+// packageErrorLines 从失败的输出中挑出说明原因的行，没有时返回最后几行
+func packageErrorLines(out string) string {
+	all := strings.Split(strings.TrimSpace(out), "\n")
+	var lines []string
+	for _, line := range all {
+		if line = strings.TrimSpace(line); line != "" && packageErrorPattern.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		lines = all[max(0, len(all)-packageMaxOutput):]
+	}
+	// 最终的错误通常在最后
+	lines = lines[max(0, len(lines)-packageMaxOutput):]
+	if len(lines) == 0 || (len(lines) == 1 && lines[0] == "") {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// isDir 判断路径是否为已存在的目录
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const pdfMaxPages = 50 // 单次调用最多提取的页数
+
+// readPDFTool 提取PDF文本的工具定义
+var readPDFTool = Tool{
+	Type:        "function",
+	Name:        "read_pdf",
+	Cacheable:   true,
+	Description: "提取PDF文件中的文本，按页输出，适合阅读论文、课程大纲和通知。可用pages指定页码范围，单次最多50页。安装了pdftotext时使用它提取以保留排版，否则使用内置解析。扫描件中的图片文字无法提取。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "PDF文件路径",
+			},
+			"pages": map[string]interface{}{
+				"type":        "string",
+				"description": "页码范围，如\"1-3,5,8-\"，从1开始，默认从第一页开始",
+			},
+			"password": map[string]interface{}{
+				"type":        "string",
+				"description": "加密PDF的打开密码",
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// parsePageRanges 解析页码范围，返回按顺序排列且不重复的页码，超过limit页时截断
+func parsePageRanges(spec string, total, limit int) ([]int, bool, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "1-"
+	}
+	seen := map[int]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || start < 1 {
+			return nil, false, fmt.Errorf("页码范围无效: %q", part)
+		}
+		end := start
+		if isRange {
+			end = total
+			if last = strings.TrimSpace(last); last != "" {
+				if end, err = strconv.Atoi(last); err != nil || end < start {
+					return nil, false, fmt.Errorf("页码范围无效: %q", part)
+				}
+			}
+		}
+		if start > total {
+			return nil, false, fmt.Errorf("第%d页超出范围，文档共%d页", start, total)
+		}
+		for p := start; p <= min(end, total); p++ {
+			seen[p] = true
+		}
+	}
+	pages := make([]int, 0, len(seen))
+	for p := range seen {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+	if len(pages) > limit {
+		return pages[:limit], true, nil
+	}
+	return pages, false, nil
+}
+
+// openPDF 打开PDF文档，解析库在遇到损坏的文件时会panic，这里转换为错误
+func openPDF(fullPath, password string) (f *os.File, r *pdf.Reader, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			if f != nil {
+				f.Close()
+			}
+			f, r, err = nil, nil, fmt.Errorf("解析PDF失败: %v", p)
+		}
+	}()
+	if f, err = os.Open(fullPath); err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	tried := false
+	r, err = pdf.NewReaderEncrypted(f, info.Size(), func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if err == pdf.ErrInvalidPassword {
+		f.Close()
+		if password == "" {
+			return nil, nil, fmt.Errorf("PDF已加密，请提供password参数")
+		}
+		return nil, nil, fmt.Errorf("PDF密码错误")
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, r, nil
+}
+
+// pageText 使用内置解析提取一页的文本，按坐标把字符还原为行
+func pageText(r *pdf.Reader, num int) (text string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	page := r.Page(num)
+	if page.V.IsNull() {
+		return "", nil
+	}
+	chars := page.Content().Text
+	sort.SliceStable(chars, func(i, j int) bool { return chars[i].Y > chars[j].Y })
+
+	// 纵坐标相差不到半个字高的字符属于同一行，行内按横坐标排列
+	var lines [][]pdf.Text
+	for _, c := range chars {
+		// 解析库会为换行插入单独的换行符，这里按坐标自行断行
+		if c.S == "\n" {
+			continue
+		}
+		if n := len(lines); n > 0 && math.Abs(lines[n-1][0].Y-c.Y) <= math.Max(c.FontSize, 1)/2 {
+			lines[n-1] = append(lines[n-1], c)
+			continue
+		}
+		lines = append(lines, []pdf.Text{c})
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].X < line[j].X })
+		var lb strings.Builder
+		for i, c := range line {
+			// 字符之间有明显间隔时补上空格
+			if i > 0 && c.S != " " && line[i-1].S != " " && c.X-(line[i-1].X+line[i-1].W) > c.FontSize*0.2 {
+				lb.WriteByte(' ')
+			}
+			lb.WriteString(c.S)
+		}
+		if text := strings.TrimSpace(lb.String()); text != "" {
+			b.WriteString(text + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// pdftotextPages 使用pdftotext提取first到last页的文本，各页之间以换页符分隔
+func pdftotextPages(ctx context.Context, bin, fullPath, password string, first, last int) ([]string, error) {
+	args := []string{"-layout", "-enc", "UTF-8", "-f", strconv.Itoa(first), "-l", strconv.Itoa(last)}
+	if password != "" {
+		args = append(args, "-upw", password)
+	}
+	args = append(args, fullPath, "-")
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return nil, err
+	}
+	pages := strings.Split(string(out), "\f")
+	// 输出以换页符结尾，最后一段为空
+	if len(pages) > last-first+1 {
+		pages = pages[:last-first+1]
+	}
+	return pages, nil
+}
+
+// readPDF 按页提取PDF文本
+func (a *ECNUAgent) readPDF(ctx context.Context, args string) (string, error) {
+	var params struct {
+		Path     string `json:"path"`
+		Pages    string `json:"pages"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	f, r, err := openPDF(fullPath, params.Password)
+	if err != nil {
+		return fmt.Sprintf("读取PDF失败: %v", err), nil
+	}
+	defer f.Close()
+	total := r.NumPage()
+	if total == 0 {
+		return fmt.Sprintf("%s 中没有页面", fullPath), nil
+	}
+	pages, truncated, err := parsePageRanges(params.Pages, total, pdfMaxPages)
+	if err != nil {
+		return fmt.Sprintf("读取PDF失败: %v", err), nil
+	}
+
+	// pdftotext能更好地处理多栏排版和复杂字体，不可用时使用内置解析
+	texts := make(map[int]string, len(pages))
+	engine := "pdftotext"
+	bin, lookErr := exec.LookPath("pdftotext")
+	if lookErr == nil {
+		extracted, err := pdftotextPages(ctx, bin, fullPath, params.Password, pages[0], pages[len(pages)-1])
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			log.Printf("[读取PDF] pdftotext失败，改用内置解析: %v\n", err)
+			lookErr = err
+		}
+		for i, text := range extracted {
+			texts[pages[0]+i] = text
+		}
+	}
+	if lookErr != nil {
+		engine = "内置"
+		for _, p := range pages {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			text, err := pageText(r, p)
+			if err != nil {
+				text = fmt.Sprintf("（解析该页失败: %v）", err)
+			}
+			texts[p] = text
+		}
+	}
+	log.Printf("[读取PDF] %s (共%d页, 提取%d页, 引擎: %s)\n", fullPath, total, len(pages), engine)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 共%d页，以下为第%s页的文本:\n", fullPath, total, formatPageList(pages))
+	empty := 0
+	for _, p := range pages {
+		text := strings.TrimSpace(strings.ReplaceAll(texts[p], "\r\n", "\n"))
+		fmt.Fprintf(&b, "\n--- 第%d页 ---\n", p)
+		if text == "" {
+			empty++
+			b.WriteString("（该页没有可提取的文本）\n")
+			continue
+		}
+		b.WriteString(text + "\n")
+	}
+	if empty == len(pages) {
+		b.WriteString("\n所选页面都没有文本，该PDF可能是扫描件，其中的文字是图片\n")
+	}
+	if truncated {
+		fmt.Fprintf(&b, "\n...（单次最多提取%d页，请用pages参数继续读取第%d页之后的内容）\n", pdfMaxPages, pages[len(pages)-1])
+	}
+	return b.String(), nil
+}
+
+// formatPageList 把页码列表压缩为"1-3,5"的形式
+func formatPageList(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(pages[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
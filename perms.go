@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// octalModeRe 合法的八进制权限，如755、0644、2775
+var octalModeRe = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+
+// makeDirectoryTool 创建目录的工具定义
+var makeDirectoryTool = Tool{
+	Type:        "function",
+	Name:        "make_directory",
+	Sequential:  true,
+	Description: "创建目录，默认同时创建不存在的父目录。目录已存在时不报错。只能在工作区内创建。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要创建的目录路径",
+			},
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"description": "八进制权限，如755、0700，默认755",
+				"default":     "755",
+			},
+			"parents": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否同时创建父目录，默认true",
+				"default":     true,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// changePermissionsTool 修改权限和所有者的工具定义
+var changePermissionsTool = Tool{
+	Type:        "function",
+	Name:        "change_permissions",
+	Sequential:  true,
+	Description: "修改文件或目录的权限（八进制，如644、755）和所有者、所属组，mode、owner、group至少指定一项。递归修改时会处理目录下的所有文件。只能修改工作区内的文件，修改所有者通常需要root权限。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "文件或目录路径",
+			},
+			"mode": map[string]interface{}{
+				"type":        "string",
+				"description": "八进制权限，如644、0755、2775",
+			},
+			"owner": map[string]interface{}{
+				"type":        "string",
+				"description": "新的所有者，用户名或uid",
+			},
+			"group": map[string]interface{}{
+				"type":        "string",
+				"description": "新的所属组，组名或gid",
+			},
+			"recursive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否递归修改目录下的所有文件，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// parseOctalMode 校验并解析八进制权限字符串
+func parseOctalMode(s string) (os.FileMode, error) {
+	s = strings.TrimSpace(s)
+	if !octalModeRe.MatchString(s) {
+		return 0, fmt.Errorf("权限%q无效，应为3到4位八进制数字，如644、0755", s)
+	}
+	n, _ := strconv.ParseUint(s, 8, 32)
+	mode := os.FileMode(n & 0777)
+	if n&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if n&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if n&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// lookupOwner 将用户名和组名解析为uid和gid，为空时返回-1表示不修改
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, lookupErr := user.Lookup(owner)
+			if lookupErr != nil {
+				return 0, 0, fmt.Errorf("找不到用户%s", owner)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, lookupErr := user.LookupGroup(group)
+			if lookupErr != nil {
+				return 0, 0, fmt.Errorf("找不到用户组%s", group)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// makeDirectory 创建目录
+func (a *ECNUAgent) makeDirectory(args string) (string, error) {
+	params := struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Parents bool   `json:"parents"`
+	}{Mode: "755", Parents: true}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	mode, err := parseOctalMode(params.Mode)
+	if err != nil {
+		return fmt.Sprintf("创建目录失败: %v", err), nil
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	if err := a.checkWorkspace(fullPath); err != nil {
+		return fmt.Sprintf("创建目录失败: %v", err), nil
+	}
+	log.Printf("[创建目录] %s (权限: %s)\n", fullPath, params.Mode)
+
+	if info, err := os.Stat(fullPath); err == nil {
+		if !info.IsDir() {
+			return fmt.Sprintf("创建目录失败: %s已存在且不是目录", fullPath), nil
+		}
+		return fmt.Sprintf("目录已存在: %s", fullPath), nil
+	}
+	if params.Parents {
+		err = os.MkdirAll(fullPath, mode.Perm())
+	} else {
+		err = os.Mkdir(fullPath, mode.Perm())
+	}
+	if err != nil {
+		return fmt.Sprintf("创建目录失败: %v", err), nil
+	}
+	// Mkdir受umask影响，显式设置一次以得到请求的权限
+	if err := os.Chmod(fullPath, mode); err != nil {
+		return fmt.Sprintf("目录已创建，但设置权限失败: %v", err), nil
+	}
+	a.activity.addFile(fullPath)
+	return fmt.Sprintf("成功创建目录: %s", fullPath), nil
+}
+
+// changePermissions 修改权限和所有者
+func (a *ECNUAgent) changePermissions(args string) (string, error) {
+	var params struct {
+		Path      string `json:"path"`
+		Mode      string `json:"mode"`
+		Owner     string `json:"owner"`
+		Group     string `json:"group"`
+		Recursive bool   `json:"recursive"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	if params.Mode == "" && params.Owner == "" && params.Group == "" {
+		return "修改失败: mode、owner、group至少需要指定一项", nil
+	}
+
+	var mode os.FileMode
+	if params.Mode != "" {
+		var err error
+		if mode, err = parseOctalMode(params.Mode); err != nil {
+			return fmt.Sprintf("修改失败: %v", err), nil
+		}
+	}
+	uid, gid, err := lookupOwner(params.Owner, params.Group)
+	if err != nil {
+		return fmt.Sprintf("修改失败: %v", err), nil
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	if err := a.checkWorkspace(fullPath); err != nil {
+		return fmt.Sprintf("修改失败: %v", err), nil
+	}
+	log.Printf("[修改权限] %s (权限: %q, 所有者: %q, 组: %q, 递归: %v)\n", fullPath, params.Mode, params.Owner, params.Group, params.Recursive)
+
+	apply := func(p string) error {
+		if params.Mode != "" {
+			if err := os.Chmod(p, mode); err != nil {
+				return err
+			}
+		}
+		if uid >= 0 || gid >= 0 {
+			if err := os.Lchown(p, uid, gid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	count := 0
+	if params.Recursive {
+		err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// chmod会作用于链接目标，递归时跳过符号链接以免修改到目录之外的文件
+			if d.Type()&os.ModeSymlink != 0 && params.Mode != "" {
+				return nil
+			}
+			count++
+			return apply(p)
+		})
+	} else {
+		count = 1
+		err = apply(fullPath)
+	}
+	if err != nil {
+		return fmt.Sprintf("修改失败: %v", err), nil
+	}
+	a.activity.addFile(fullPath)
+
+	var changes []string
+	if params.Mode != "" {
+		changes = append(changes, "权限 "+params.Mode)
+	}
+	if params.Owner != "" {
+		changes = append(changes, "所有者 "+params.Owner)
+	}
+	if params.Group != "" {
+		changes = append(changes, "组 "+params.Group)
+	}
+	if params.Recursive {
+		return fmt.Sprintf("已修改%s及其下共%d项的%s", fullPath, count, strings.Join(changes, "、")), nil
+	}
+	return fmt.Sprintf("已修改%s的%s", fullPath, strings.Join(changes, "、")), nil
+}
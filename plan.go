@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 计划步骤的状态
+const (
+	planPending = "待执行"
+	planRunning = "执行中"
+	planDone    = "已完成"
+	planFailed  = "失败"
+)
+
+// planStepRe 匹配"1. xxx"、"2、xxx"、"步骤3：xxx"等编号行
+var planStepRe = regexp.MustCompile(`^\s*(?:步骤\s*)?\d+\s*[.、)）:：]\s*(.+)$`)
+
+// planStep 计划中的一个步骤
+type planStep struct {
+	Text   string
+	Status string
+}
+
+// taskPlan 先规划后执行模式下的任务计划
+type taskPlan struct {
+	Goal  string
+	Steps []*planStep
+}
+
+// render 返回带状态的计划说明
+func (p *taskPlan) render() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  任务: %s\n", p.Goal)
+	for i, step := range p.Steps {
+		fmt.Fprintf(&b, "  [%s] %d. %s\n", step.Status, i+1, step.Text)
+	}
+	return b.String()
+}
+
+// parsePlan 从模型回复中提取编号步骤
+func parsePlan(text string) []string {
+	var steps []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := planStepRe.FindStringSubmatch(line); m != nil {
+			step := strings.TrimSpace(strings.Trim(m[1], "*"))
+			if step != "" {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return steps
+}
+
+// makePlan 请模型为任务制定编号计划，不调用任何工具
+func (a *ECNUAgent) makePlan(ctx context.Context, task string) (*taskPlan, error) {
+	prompt := fmt.Sprintf(`请为以下任务制定执行计划，暂时不要执行任何操作。
+
+任务：%s
+
+要求：
+1. 按执行顺序列出步骤，每行一步，格式为"1. 步骤说明"。
+2. 每一步应当具体、可独立完成和验证，通常不超过%d步。
+3. 只输出计划，不要输出其他内容。`, task, a.config.MaxSteps)
+
+	a.history = append(a.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: prompt,
+	})
+	a.compactHistory(ctx)
+	a.truncateHistory()
+
+	resp, err := a.complete(ctx, nil, nil, a.config.MaxRetries)
+	if err != nil {
+		a.history = a.history[:len(a.history)-1]
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		a.history = a.history[:len(a.history)-1]
+		return nil, fmt.Errorf("模型返回空响应")
+	}
+
+	message := resp.Choices[0].Message
+	steps := parsePlan(message.Content)
+	if len(steps) == 0 {
+		// 未按格式输出计划时撤回规划请求，避免干扰后续对话
+		a.history = a.history[:len(a.history)-1]
+		return nil, fmt.Errorf("未能从回复中解析出计划步骤")
+	}
+	a.history = append(a.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: message.Content,
+	})
+
+	plan := &taskPlan{Goal: task}
+	for _, step := range steps {
+		plan.Steps = append(plan.Steps, &planStep{Text: step, Status: planPending})
+	}
+	return plan, nil
+}
+
+// runPlanned 先制定计划并展示给用户，再逐步执行并更新每一步的状态
+func (a *ECNUAgent) runPlanned(ctx context.Context, task string) error {
+	log.Printf("[计划] 正在制定计划...\n")
+	plan, err := a.makePlan(ctx, task)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errInterrupted
+		}
+		log.Printf("[计划] 制定计划失败，直接执行任务: %v\n", err)
+		return a.runTask(ctx, task)
+	}
+	a.plan = plan
+	fmt.Fprintf(a.console, "\n[计划] 共%d步:\n%s", len(plan.Steps), plan.render())
+
+	for i, step := range plan.Steps {
+		step.Status = planRunning
+		log.Printf("[计划] 开始第%d/%d步: %s\n", i+1, len(plan.Steps), step.Text)
+
+		prompt := fmt.Sprintf("请执行计划的第%d步：%s\n\n当前计划进度：\n%s\n只完成这一步，完成后简要说明结果，不要开始后续步骤。", i+1, step.Text, plan.render())
+		if err := a.runTask(ctx, prompt); err != nil {
+			step.Status = planFailed
+			fmt.Fprintf(a.console, "\n[计划] 进度:\n%s", plan.render())
+			if errors.Is(err, errInterrupted) {
+				return err
+			}
+			return fmt.Errorf("计划第%d步失败: %w", i+1, err)
+		}
+		step.Status = planDone
+	}
+
+	fmt.Fprintf(a.console, "\n[计划] 全部完成:\n%s", plan.render())
+	return nil
+}
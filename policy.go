@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 命令策略对execute_command的处理方式
+const (
+	policyAllow = "allow" // 直接执行
+	policyAsk   = "ask"   // 执行前询问用户
+	policyDeny  = "deny"  // 拒绝执行
+)
+
+// policyRule 一条命令规则
+//
+// prefix按词匹配每个简单命令的开头，如"git status"匹配git status -s但不匹配git statusx；
+// regex匹配整条命令，适合描述管道等跨越多个简单命令的写法。
+type policyRule struct {
+	Action string `json:"action"`
+	Prefix string `json:"prefix,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	words []string
+	re    *regexp.Regexp
+}
+
+// policyFile 命令策略配置文件的内容
+type policyFile struct {
+	Default string       `json:"default,omitempty"`
+	Builtin *bool        `json:"builtin,omitempty"`
+	Rules   []policyRule `json:"rules"`
+}
+
+// builtinDenyRules 默认拒绝的危险命令
+var builtinDenyRules = []policyRule{
+	{Action: policyDeny, Regex: `(^|[\s;&|(])mkfs(\.\w+)?(\s|$)`, Reason: "格式化文件系统"},
+	{Action: policyDeny, Regex: `(^|[\s;&|(])rm\s+(-\S+\s+)*(--\s+)?("?/"?|/\*|~/?|~/\*|"?\$\{?HOME\}?/?"?)(\s|;|&|\||$)`, Reason: "删除根目录或主目录"},
+	{Action: policyDeny, Regex: `(^|[\s;&|(])dd\s.*\bof=/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, Reason: "覆盖磁盘设备"},
+	{Action: policyDeny, Regex: `>\s*/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, Reason: "覆盖磁盘设备"},
+	{Action: policyDeny, Regex: `:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, Reason: "fork炸弹"},
+	{Action: policyDeny, Regex: `(^|[\s;&|(])(curl|wget)\s[^|;&]*\|\s*(sudo\s+)?(ba|z|da|k)?sh(\s|$)`, Reason: "下载脚本直接执行"},
+	{Action: policyDeny, Regex: `(^|[\s;&|(])ch(mod|own)\s+(-\S+\s+)*-R\s+(\S+\s+)?/(\s|$)`, Reason: "递归修改根目录权限"},
+	{Action: policyDeny, Prefix: "shutdown", Reason: "关闭系统"},
+	{Action: policyDeny, Prefix: "reboot", Reason: "重启系统"},
+	{Action: policyDeny, Prefix: "halt", Reason: "关闭系统"},
+	{Action: policyDeny, Prefix: "poweroff", Reason: "关闭系统"},
+}
+
+// builtinAskRules 默认需要用户确认的危险或提升权限的命令，即使--command-default allow或匹配了允许规则也会询问
+var builtinAskRules = []policyRule{
+	{Action: policyAsk, Regex: `(^|[\s;&|(])(sudo|doas|su|pkexec)(\s|$)`, Reason: "以管理员权限执行"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])rm\s+([^;&|]*\s)?(-[a-zA-Z]*[rR][a-zA-Z]*|--recursive)(\s|$)`, Reason: "递归删除"},
+	{Action: policyAsk, Prefix: "rm", Reason: "删除文件"},
+	{Action: policyAsk, Prefix: "shred", Reason: "销毁文件"},
+	{Action: policyAsk, Prefix: "dd", Reason: "直接写入设备或文件"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])find\s[^;&|]*-delete(\s|$)`, Reason: "批量删除文件"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])(apt|apt-get|aptitude|yum|dnf|zypper)\s+(-\S+\s+)*(remove|purge|autoremove|erase)(\s|$)`, Reason: "卸载软件包"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])(pacman\s+-R|apk\s+del|snap\s+remove|brew\s+(uninstall|remove)|pip3?\s+uninstall|npm\s+(uninstall|remove|rm)\s+(-g|--global))`, Reason: "卸载软件包"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])git\s+(reset\s+--hard|clean\s+-\S*f|checkout\s+--\s|push\s+(\S+\s+)*(-f|--force))`, Reason: "丢弃未提交的修改或改写远程历史"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])git\s+branch\s+(\S+\s+)*(-[a-zA-Z]*[dDmMcCfu]|--delete|--move|--copy|--force|--set-upstream-to|--unset-upstream|--edit-description)(\s|=|$)`, Reason: "删除、改名或改写分支"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])(chmod|chown|chgrp)\s+(-\S+\s+)*-R(\s|$)`, Reason: "递归修改权限"},
+	{Action: policyAsk, Regex: `(^|[\s;&|(])(kill|pkill|killall)(\s|$)`, Reason: "结束进程"},
+}
+
+// builtinAllowPrefixes 默认直接执行的只读命令
+var builtinAllowPrefixes = []string{
+	"ls", "cat", "head", "tail", "wc", "pwd", "echo", "printf", "grep", "egrep", "rg", "which", "type", "file", "stat",
+	"du", "df", "tree", "date", "whoami", "id", "uname", "hostname", "printenv", "diff", "cmp", "sort", "uniq", "cut",
+	"basename", "dirname", "realpath", "readlink", "true", "false", "test", "cd",
+	"git status", "git diff", "git log", "git show", "git branch", "git rev-parse", "git blame", "git remote -v",
+	"go build", "go test", "go vet", "go version", "go env", "go list", "gofmt -l", "gofmt -d",
+	"python --version", "python3 --version", "node --version", "npm --version", "npm test", "cargo build", "cargo test", "cargo check",
+}
+
+// policyWriteOptions 只读命令中写入文件或执行其他程序的选项，带有这些选项的命令不按允许规则直接执行
+var policyWriteOptions = map[string][]string{
+	"sort": {"-o", "--output", "--compress-program"},
+	"tree": {"-o"},
+	"git":  {"--output"},
+	"go": {"-o", "-exec", "-toolexec", "-vettool", "-w", "-coverprofile", "-cpuprofile", "-memprofile", "-blockprofile",
+		"-mutexprofile", "-trace", "-outputdir"},
+	"gofmt": {"-w"},
+	"find":  {"-exec", "-execdir", "-ok", "-okdir", "-delete", "-fprint", "-fprint0", "-fprintf", "-fls"},
+}
+
+// policyGetoptCommands 短选项可以合写（-uo FILE）或与值连写（-oFILE）的命令
+var policyGetoptCommands = map[string]bool{"sort": true, "tree": true}
+
+// policyWrappers 执行其后命令的包装命令，匹配规则时跳过；经过sudo或doas的命令不会被直接允许
+var policyWrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "nohup": true, "time": true, "nice": true, "command": true, "exec": true,
+}
+
+// commandPolicy 决定execute_command的命令是直接执行、询问用户还是拒绝
+type commandPolicy struct {
+	defaultAction string
+	rules         []policyRule
+}
+
+// defaultPolicyFile 返回命令策略配置文件的默认路径
+func defaultPolicyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "policy.json")
+}
+
+// loadCommandPolicy 合并内置规则、策略文件和命令行中的规则
+//
+// 策略文件格式为 {"default": "ask", "builtin": true, "rules": [{"action": "allow", "prefix": "make test"},
+// {"action": "deny", "regex": "...", "reason": "..."}]}，builtin为false时不使用内置规则。
+// 未指定路径时读取~/.ecnu-agent/policy.json，文件不存在则忽略。
+func loadCommandPolicy(cfg *Config) (*commandPolicy, error) {
+	p := &commandPolicy{defaultAction: cfg.CommandDefault}
+	builtin := true
+
+	path, explicit := cfg.PolicyFile, cfg.PolicyFile != ""
+	if !explicit {
+		path = defaultPolicyFile()
+	}
+	var file policyFile
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("解析命令策略%s失败: %v", path, err)
+			}
+			if file.Builtin != nil {
+				builtin = *file.Builtin
+			}
+			// 命令行中指定的默认处理方式优先
+			if p.defaultAction == "" {
+				p.defaultAction = file.Default
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("读取命令策略失败: %v", err)
+		}
+	}
+	switch p.defaultAction {
+	case "":
+		p.defaultAction = policyAsk
+	case policyAllow, policyAsk, policyDeny:
+	default:
+		return nil, fmt.Errorf("命令策略的默认处理方式必须为allow、ask或deny，当前为%q", p.defaultAction)
+	}
+
+	var rules []policyRule
+	if builtin {
+		rules = append(rules, builtinDenyRules...)
+		rules = append(rules, builtinAskRules...)
+		for _, prefix := range builtinAllowPrefixes {
+			rules = append(rules, policyRule{Action: policyAllow, Prefix: prefix})
+		}
+	}
+	rules = append(rules, file.Rules...)
+	for _, s := range cfg.CommandAllow {
+		rules = append(rules, flagRule(policyAllow, s))
+	}
+	for _, s := range cfg.CommandDeny {
+		rules = append(rules, flagRule(policyDeny, s))
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+// flagRule 把命令行中的一项转换为规则，/.../表示正则表达式，否则为前缀
+func flagRule(action, s string) policyRule {
+	if len(s) > 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		return policyRule{Action: action, Regex: s[1 : len(s)-1]}
+	}
+	return policyRule{Action: action, Prefix: s}
+}
+
+// compile 检查规则并编译正则表达式
+func (r *policyRule) compile() error {
+	switch r.Action {
+	case policyAllow, policyAsk, policyDeny:
+	default:
+		return fmt.Errorf("命令规则的action必须为allow、ask或deny，当前为%q", r.Action)
+	}
+	if (r.Prefix == "") == (r.Regex == "") {
+		return fmt.Errorf("命令规则必须且只能指定prefix和regex中的一个")
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("命令规则的正则表达式%q无效: %v", r.Regex, err)
+		}
+		r.re = re
+		return nil
+	}
+	r.words = strings.Fields(r.Prefix)
+	return nil
+}
+
+// String 返回规则在提示中的写法，有说明时只显示说明
+func (r policyRule) String() string {
+	switch {
+	case r.Reason != "":
+		return r.Reason
+	case r.re != nil:
+		return "正则 " + r.Regex
+	}
+	return "前缀 " + r.Prefix
+}
+
+// matchSegment 判断简单命令是否以规则的前缀开头
+func (r policyRule) matchSegment(words []string) bool {
+	if r.re != nil || len(words) < len(r.words) {
+		return false
+	}
+	for i, w := range r.words {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// policyDecision 命令策略的判断结果
+type policyDecision struct {
+	action string
+	rule   *policyRule // 决定结果的规则，使用默认处理方式时为nil
+}
+
+// evaluate 判断命令的处理方式
+//
+// 任何一条拒绝规则匹配时拒绝；否则任何一个简单命令匹配询问规则时询问；
+// 所有简单命令都匹配允许规则、没有写入文件的重定向、也没有经过sudo时直接执行；其余情况使用默认处理方式。
+func (p *commandPolicy) evaluate(command string) policyDecision {
+	var segments [][]string
+	allowed := true
+	for _, segment := range shellWords(command) {
+		for _, w := range segment {
+			if w.redirect && w.text != "/dev/null" {
+				allowed = false
+			}
+		}
+		words, elevated := policyWords(segment)
+		if elevated {
+			allowed = false
+		}
+		if len(words) > 0 {
+			segments = append(segments, words)
+		}
+	}
+
+	for _, action := range []string{policyDeny, policyAsk} {
+		for i := range p.rules {
+			r := &p.rules[i]
+			if r.Action != action {
+				continue
+			}
+			if r.re != nil && r.re.MatchString(command) {
+				return policyDecision{action: action, rule: r}
+			}
+			for _, words := range segments {
+				if r.matchSegment(words) {
+					return policyDecision{action: action, rule: r}
+				}
+			}
+		}
+	}
+
+	if allowed && len(segments) > 0 {
+		for _, words := range segments {
+			if p.allowedSegment(words) == nil {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return policyDecision{action: policyAllow}
+		}
+	}
+	return policyDecision{action: p.defaultAction}
+}
+
+// allowedSegment 返回简单命令匹配的允许规则，带有写入文件或执行其他程序的选项时不匹配
+func (p *commandPolicy) allowedSegment(words []string) *policyRule {
+	if writesViaOptions(words) {
+		return nil
+	}
+	for i := range p.rules {
+		r := &p.rules[i]
+		if r.Action != policyAllow {
+			continue
+		}
+		if r.matchSegment(words) || r.re != nil && r.re.MatchString(strings.Join(words, " ")) {
+			return r
+		}
+	}
+	return nil
+}
+
+// writesViaOptions 判断简单命令是否通过选项写入文件或执行其他程序，如sort -o、go build -o、go test -exec，
+// 以及把第二个参数作为输出文件的uniq
+func writesViaOptions(words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+	name, args := words[0], words[1:]
+	if name == "uniq" {
+		files := 0
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				files++
+			}
+		}
+		return files > 1
+	}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, opt := range policyWriteOptions[name] {
+			if arg == opt || strings.HasPrefix(arg, opt+"=") {
+				return true
+			}
+			if policyGetoptCommands[name] && len(opt) == 2 && len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], opt[1]) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// policyWords 去掉简单命令开头的变量赋值和包装命令及其选项，返回用于匹配的词，elevated表示经过了sudo或doas
+func policyWords(segment []shellWord) ([]string, bool) {
+	var words []string
+	for _, w := range segment {
+		if !w.redirect {
+			words = append(words, w.text)
+		}
+	}
+	elevated := false
+	for len(words) > 0 {
+		switch {
+		case envAssignment(words[0]):
+			words = words[1:]
+		case policyWrappers[words[0]]:
+			if words[0] == "sudo" || words[0] == "doas" {
+				elevated = true
+			}
+			words = words[1:]
+			for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+				words = words[1:]
+			}
+		default:
+			return words, elevated
+		}
+	}
+	return words, elevated
+}
+
+// policyDenied 检查等价的命令是否被命令策略拒绝，返回拒绝的原因，未被拒绝时返回空字符串
+//
+// 供manage_processes等直接执行操作的工具使用，使--deny-command等规则对它们同样生效；这些工具自行询问确认。
+func (a *ECNUAgent) policyDenied(command string) string {
+	if a.policy == nil {
+		return ""
+	}
+	if d := a.policy.evaluate(command); d.action == policyDeny {
+		return policyRefusal(command, d)
+	}
+	return ""
+}
+
+// policyRefusal 记录并返回命令被策略拒绝的结果
+func policyRefusal(command string, d policyDecision) string {
+	reason := "未匹配允许规则，默认拒绝执行"
+	if d.rule != nil {
+		reason = "命令匹配规则 " + d.rule.String()
+	}
+	log.Printf("[策略] 拒绝执行: %s (%s)\n", command, reason)
+	return fmt.Sprintf("策略拒绝执行: %s。请换一种方式完成任务，或询问用户是否调整命令策略。", reason)
+}
+
+// checkCommandPolicy 按命令策略检查命令，需要时询问用户，返回拒绝执行的原因，允许执行时返回空字符串
+func (a *ECNUAgent) checkCommandPolicy(ctx context.Context, command string) string {
+	if a.policy == nil {
+		return ""
+	}
+	d := a.policy.evaluate(command)
+	switch d.action {
+	case policyAllow:
+		return ""
+	case policyDeny:
+		return policyRefusal(command, d)
+	}
+	// 匹配询问规则的命令与只是未匹配允许规则的命令分别确认
+	note, scope := "", approveSafe
+	if d.rule != nil {
+		note, scope = "原因: "+d.rule.String()+"\n", approveDangerous
+	}
+	ok, err := a.confirm(ctx, scope, fmt.Sprintf("\n即将执行命令:\n  $ %s\n%s是否执行？(y/N) ", command, note))
+	if err != nil {
+		return fmt.Sprintf("执行命令失败: 该命令需要用户确认: %v", err)
+	}
+	if !ok {
+		log.Printf("[策略] 用户拒绝执行: %s\n", command)
+		return "用户拒绝执行该命令，命令未执行。请询问用户原因或换一种方式完成任务。"
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	previewLines = 6   // 预览写入内容时显示的最大行数
+	previewWidth = 160 // 预览中单行的最大字符数
+)
+
+// showToolIntent 在执行前显示工具名称和参数预览，让用户实时看到Agent将要做什么
+func (a *ECNUAgent) showToolIntent(call openai.ToolCall) {
+	// 与日志写入同一位置，按相同的详细程度过滤
+	fmt.Fprintf(log.Writer(), "\n[工具] %s\n%s", call.Function.Name, toolPreview(call, a.config.colorDiagnostics()))
+}
+
+// toolPreview 根据工具类型生成易读的参数预览，每行以两个空格缩进，color为true时按文件的语言为代码着色
+func toolPreview(call openai.ToolCall, color bool) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+		return "  " + truncateRunes(call.Function.Arguments, previewWidth) + "\n"
+	}
+	str := func(key string) string {
+		s, _ := args[key].(string)
+		return s
+	}
+	code := func() *highlighter {
+		if !color {
+			return nil
+		}
+		return newHighlighter(languageFor(str("path")))
+	}
+
+	var b strings.Builder
+	switch call.Function.Name {
+	case "execute_command":
+		for _, line := range strings.Split(str("command"), "\n") {
+			fmt.Fprintf(&b, "  $ %s\n", truncateRunes(line, previewWidth))
+		}
+		if cwd := str("cwd"); cwd != "" {
+			fmt.Fprintf(&b, "  (目录 %s)\n", cwd)
+		}
+		if env, ok := args["env"].(map[string]interface{}); ok && len(env) > 0 {
+			vars := make([]string, 0, len(env))
+			for name, value := range env {
+				if value == nil {
+					vars = append(vars, "-"+name)
+				} else {
+					vars = append(vars, fmt.Sprintf("%s=%v", name, value))
+				}
+			}
+			sort.Strings(vars)
+			fmt.Fprintf(&b, "  (环境 %s)\n", truncateRunes(strings.Join(vars, " "), previewWidth))
+		}
+		if stdin, ok := args["stdin"].(string); ok {
+			fmt.Fprintf(&b, "  (标准输入 %d行，%d字节)\n", len(splitLines(stdin)), len(stdin))
+		}
+		if t, ok := args["timeout"].(float64); ok {
+			fmt.Fprintf(&b, "  (超时 %d秒)\n", int(t))
+		}
+	case "write_file":
+		mode := "覆盖"
+		if appendMode, _ := args["append"].(bool); appendMode {
+			mode = "追加"
+		}
+		fmt.Fprintf(&b, "  %s (%s)\n", str("path"), mode)
+		writePreviewLines(&b, str("content"), code())
+	case "edit_file":
+		start, _ := args["start_line"].(float64)
+		end, _ := args["end_line"].(float64)
+		if insert, _ := args["insert"].(bool); insert {
+			fmt.Fprintf(&b, "  %s (在第%d行前插入)\n", str("path"), int(start))
+		} else if end > start {
+			fmt.Fprintf(&b, "  %s (替换第%d-%d行)\n", str("path"), int(start), int(end))
+		} else {
+			fmt.Fprintf(&b, "  %s (替换第%d行)\n", str("path"), int(start))
+		}
+		writePreviewLines(&b, str("content"), code())
+	case "search_replace":
+		mode := "精确匹配"
+		if regex, _ := args["regex"].(bool); regex {
+			mode = "正则"
+		}
+		if all, _ := args["all"].(bool); all {
+			mode += "，全部替换"
+		}
+		fmt.Fprintf(&b, "  %s (%s)\n", str("path"), mode)
+		search := code()
+		for _, line := range strings.Split(str("search"), "\n") {
+			fmt.Fprintf(&b, "  - %s\n", search.line(truncateRunes(line, previewWidth)))
+		}
+		writePreviewLines(&b, str("replace"), code())
+	case "query_sqlite":
+		mode := "只读"
+		if write, _ := args["write"].(bool); write {
+			mode = "写入"
+		}
+		fmt.Fprintf(&b, "  %s (%s)\n", str("path"), mode)
+		for _, line := range strings.Split(str("sql"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "  > %s\n", truncateRunes(line, previewWidth))
+			}
+		}
+	case "read_file", "list_directory":
+		path := str("path")
+		if path == "" {
+			path = "."
+		}
+		fmt.Fprintf(&b, "  %s\n", path)
+	case "spawn_agent":
+		fmt.Fprintf(&b, "  %s\n", truncateRunes(str("task"), previewWidth))
+	default:
+		if len(args) > 0 {
+			fmt.Fprintf(&b, "  %s\n", truncateRunes(call.Function.Arguments, previewWidth))
+		}
+	}
+	return b.String()
+}
+
+// writePreviewLines 以"+ "前缀写出内容的前几行，code不为nil时为代码着色
+func writePreviewLines(b *strings.Builder, content string, code *highlighter) {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if i == previewLines {
+			fmt.Fprintf(b, "  ...（共%d行）\n", len(lines))
+			break
+		}
+		fmt.Fprintf(b, "  + %s\n", code.line(truncateRunes(line, previewWidth)))
+	}
+}
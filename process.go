@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	processDefaultLimit = 50              // list默认返回的最大进程数
+	processKillWait     = 2 * time.Second // 发送信号后等待进程退出的时间
+	processCmdlineWidth = 200             // 列表中命令行的最大字符数
+)
+
+// manageProcessesTool 查看和结束进程的工具定义
+var manageProcessesTool = Tool{
+	Type:        "function",
+	Name:        "manage_processes",
+	Sequential:  true,
+	Description: "查看和结束进程，代替ps | grep和kill。action为list时列出进程，可以按名称、用户或监听的端口筛选，按CPU时间或内存排序；details显示单个进程的命令行、工作目录、父子进程和监听的端口；kill向进程发送信号，默认TERM，发送前会询问用户确认并受命令策略约束，结果中说明进程是否已退出。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "details", "kill"},
+				"description": "list列出进程，details查看进程详情，kill发送信号",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "list时只显示进程名或命令行包含该字符串的进程（不区分大小写）",
+			},
+			"user": map[string]interface{}{
+				"type":        "string",
+				"description": "list时只显示该用户的进程",
+			},
+			"port": map[string]interface{}{
+				"type":        "integer",
+				"description": "list时只显示监听该TCP或UDP端口的进程",
+			},
+			"sort": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"cpu", "memory", "pid"},
+				"description": "list的排序方式：cpu按累计CPU时间，memory按常驻内存，pid按进程号，默认cpu",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "list最多返回的进程数，默认50",
+				"minimum":     1,
+			},
+			"pid": map[string]interface{}{
+				"type":        "integer",
+				"description": "details和kill的目标进程号",
+			},
+			"signal": map[string]interface{}{
+				"type":        "string",
+				"description": "kill发送的信号，如TERM、KILL、INT、HUP，默认TERM；先用TERM让进程正常退出，无效时再用KILL",
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// processParams manage_processes的参数
+type processParams struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	User   string `json:"user"`
+	Port   int    `json:"port"`
+	Sort   string `json:"sort"`
+	Limit  int    `json:"limit"`
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"`
+}
+
+// processInfo 一个进程的基本信息
+type processInfo struct {
+	pid     int
+	ppid    int
+	user    string
+	state   string
+	name    string
+	cmdline string
+	rss     int64 // 常驻内存（字节）
+	cpu     time.Duration
+	start   time.Time // 无法获取时为零值
+	threads int       // 无法获取时为0
+}
+
+// listenAddr 进程监听的一个地址
+type listenAddr struct {
+	proto string // tcp或udp
+	addr  string // 含端口的地址，如0.0.0.0:8080
+	port  int
+}
+
+func (l listenAddr) String() string { return l.addr + "/" + l.proto }
+
+// command 返回进程的命令行，读取不到时用进程名代替
+func (p processInfo) command() string {
+	if p.cmdline != "" {
+		return p.cmdline
+	}
+	return "[" + p.name + "]"
+}
+
+// manageProcesses 根据action列出、查看或结束进程
+func (a *ECNUAgent) manageProcesses(ctx context.Context, args string) (string, error) {
+	params := processParams{Sort: "cpu", Limit: processDefaultLimit}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	switch params.Action {
+	case "list":
+		return listProcessTable(params), nil
+	case "details", "kill":
+		if params.PID <= 0 {
+			return "", fmt.Errorf("%s需要pid参数", params.Action)
+		}
+		if params.Action == "details" {
+			return processDetailsText(params.PID), nil
+		}
+		return a.killProcess(ctx, params), nil
+	default:
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+}
+
+// listProcessTable 按条件筛选、排序并以表格返回进程
+func listProcessTable(params processParams) string {
+	procs, err := listProcesses()
+	if err != nil {
+		return fmt.Sprintf("列出进程失败: %v", err)
+	}
+	var ports map[int][]listenAddr
+	if params.Port > 0 {
+		if ports, err = listeningPorts(); err != nil {
+			return fmt.Sprintf("列出进程失败: 读取端口失败: %v", err)
+		}
+	}
+	name := strings.ToLower(params.Name)
+	var matched []processInfo
+	for _, p := range procs {
+		if name != "" && !strings.Contains(strings.ToLower(p.name), name) && !strings.Contains(strings.ToLower(p.cmdline), name) {
+			continue
+		}
+		if params.User != "" && p.user != params.User {
+			continue
+		}
+		if params.Port > 0 && !hasPort(ports[p.pid], params.Port) {
+			continue
+		}
+		matched = append(matched, p)
+	}
+	if len(matched) == 0 {
+		if params.Port > 0 {
+			return fmt.Sprintf("没有找到监听端口%d的进程（非root用户可能无法看到其他用户的进程监听的端口）", params.Port)
+		}
+		return "没有找到符合条件的进程"
+	}
+
+	switch params.Sort {
+	case "memory":
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].rss > matched[j].rss })
+	case "pid":
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].pid < matched[j].pid })
+	default:
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].cpu > matched[j].cpu })
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "共%d个进程", len(matched))
+	if params.Limit > 0 && len(matched) > params.Limit {
+		fmt.Fprintf(&b, "，显示前%d个", params.Limit)
+		matched = matched[:params.Limit]
+	}
+	b.WriteString(":\n")
+	rows := make([][]string, len(matched))
+	for i, p := range matched {
+		rows[i] = []string{strconv.Itoa(p.pid), strconv.Itoa(p.ppid), p.user, p.state,
+			p.cpu.Round(time.Second).String(), formatSize(p.rss), processStarted(p.start), truncateRunes(p.command(), processCmdlineWidth)}
+	}
+	b.WriteString(formatTableRows([]string{"PID", "PPID", "USER", "STATE", "CPU", "RSS", "START", "COMMAND"}, rows))
+	return b.String()
+}
+
+// processDetailsText 返回单个进程的详细信息
+func processDetailsText(pid int) string {
+	procs, err := listProcesses()
+	if err != nil {
+		return fmt.Sprintf("查看进程失败: %v", err)
+	}
+	var target *processInfo
+	var children []string
+	for i := range procs {
+		if procs[i].pid == pid {
+			target = &procs[i]
+		}
+		if procs[i].ppid == pid {
+			children = append(children, fmt.Sprintf("%d(%s)", procs[i].pid, procs[i].name))
+		}
+	}
+	if target == nil {
+		return fmt.Sprintf("进程%d不存在", pid)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "pid: %d\n", target.pid)
+	fmt.Fprintf(&b, "name: %s\n", target.name)
+	fmt.Fprintf(&b, "command: %s\n", target.command())
+	fmt.Fprintf(&b, "user: %s\n", target.user)
+	fmt.Fprintf(&b, "state: %s\n", target.state)
+	parent := ""
+	for _, p := range procs {
+		if p.pid == target.ppid {
+			parent = "(" + p.name + ")"
+		}
+	}
+	fmt.Fprintf(&b, "ppid: %d%s\n", target.ppid, parent)
+	if len(children) > 0 {
+		fmt.Fprintf(&b, "children: %s\n", strings.Join(children, ", "))
+	}
+	if !target.start.IsZero() {
+		fmt.Fprintf(&b, "started: %s（已运行%s）\n", target.start.Format("2006-01-02 15:04:05"), time.Since(target.start).Round(time.Second))
+	}
+	fmt.Fprintf(&b, "cpu_time: %s\n", target.cpu.Round(time.Millisecond))
+	fmt.Fprintf(&b, "rss: %s\n", formatSize(target.rss))
+	if target.threads > 0 {
+		fmt.Fprintf(&b, "threads: %d\n", target.threads)
+	}
+	for _, line := range processExtraDetails(pid) {
+		b.WriteString(line + "\n")
+	}
+	if ports, err := listeningPorts(); err == nil && len(ports[pid]) > 0 {
+		addrs := make([]string, len(ports[pid]))
+		for i, l := range ports[pid] {
+			addrs[i] = l.String()
+		}
+		fmt.Fprintf(&b, "listening: %s\n", strings.Join(addrs, ", "))
+	}
+	return b.String()
+}
+
+// killProcess 经命令策略检查和用户确认后向进程发送信号，并等待一段时间观察进程是否退出
+func (a *ECNUAgent) killProcess(ctx context.Context, params processParams) string {
+	name := strings.TrimPrefix(strings.ToUpper(defaultSignal(params.Signal)), "SIG")
+	sig, ok := processSignals[name]
+	if !ok {
+		names := make([]string, 0, len(processSignals))
+		for n := range processSignals {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Sprintf("结束进程失败: 不支持的信号%s，可用的信号: %s", params.Signal, strings.Join(names, "、"))
+	}
+	pid := params.PID
+	if pid == 1 || pid == os.Getpid() || pid == os.Getppid() {
+		return fmt.Sprintf("结束进程失败: 不能向进程%d发送信号（系统初始进程、Agent自身或启动Agent的进程）", pid)
+	}
+	var target *processInfo
+	if procs, err := listProcesses(); err == nil {
+		for i := range procs {
+			if procs[i].pid == pid {
+				target = &procs[i]
+			}
+		}
+		if target == nil {
+			return fmt.Sprintf("结束进程失败: 进程%d不存在", pid)
+		}
+	}
+
+	// 与等价的kill命令使用同一套策略，--deny-command kill等规则同样生效
+	command := fmt.Sprintf("kill -%s %d", name, pid)
+	what := fmt.Sprintf("进程 %d", pid)
+	if target != nil {
+		what = fmt.Sprintf("进程 %d（用户 %s）: %s", pid, target.user, truncateRunes(target.command(), processCmdlineWidth))
+	}
+	if refusal := a.policyDenied(command); refusal != "" {
+		return refusal
+	}
+	ok, err := a.confirm(ctx, approveDangerous, fmt.Sprintf("\n即将向%s发送信号 SIG%s\n是否执行？(y/N) ", what, name))
+	if err != nil {
+		return fmt.Sprintf("结束进程失败: 发送信号需要用户确认: %v", err)
+	}
+	if !ok {
+		return fmt.Sprintf("用户拒绝向进程%d发送信号，进程未受影响。请询问用户原因或换一种方式完成任务。", pid)
+	}
+
+	log.Printf("[进程] 向进程%d发送SIG%s\n", pid, name)
+	proc, err := os.FindProcess(pid)
+	if err == nil {
+		err = proc.Signal(sig)
+	}
+	if err != nil {
+		return fmt.Sprintf("结束进程失败: 向进程%d发送SIG%s失败: %v", pid, name, err)
+	}
+	// 只有结束进程的信号需要等待退出
+	if name != "TERM" && name != "KILL" && name != "INT" && name != "QUIT" {
+		return fmt.Sprintf("已向进程%d发送SIG%s", pid, name)
+	}
+
+	deadline := time.Now().Add(processKillWait)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return fmt.Sprintf("已向进程%d发送SIG%s，进程已退出", pid, name)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Sprintf("已向进程%d发送SIG%s，等待退出时被中断", pid, name)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	hint := "，如需强制结束可以发送KILL"
+	if name == "KILL" {
+		hint = "，进程可能处于不可中断的等待中或已成为僵尸进程"
+	}
+	return fmt.Sprintf("已向进程%d发送SIG%s，但%s后进程仍在运行%s", pid, name, processKillWait, hint)
+}
+
+// defaultSignal 未指定信号时使用TERM
+func defaultSignal(s string) string {
+	if s == "" {
+		return "TERM"
+	}
+	return s
+}
+
+// hasPort 判断监听的地址中是否包含port
+func hasPort(addrs []listenAddr, port int) bool {
+	for _, l := range addrs {
+		if l.port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// processStarted 返回进程的启动时间，当天启动的只显示时刻
+func processStarted(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return "-"
+	case t.Format("20060102") == time.Now().Format("20060102"):
+		return t.Format("15:04:05")
+	}
+	return t.Format("01-02 15:04")
+}
@@ -0,0 +1,229 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procClockTicks /proc中CPU时间的单位，Linux上的USER_HZ固定为100
+const procClockTicks = 100
+
+// listProcesses 从/proc读取所有进程，读取过程中退出的进程被忽略
+func listProcesses() ([]processInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	boot := procBootTime()
+	users := map[string]string{}
+	var procs []processInfo
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if p, ok := readProcess(pid, boot, users); ok {
+			procs = append(procs, p)
+		}
+	}
+	return procs, nil
+}
+
+// readProcess 读取/proc/PID中的进程信息，users缓存UID对应的用户名
+func readProcess(pid int, boot time.Time, users map[string]string) (processInfo, bool) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return processInfo{}, false
+	}
+	// 进程名可能包含空格和括号，以最后一个右括号为界
+	open, end := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if open < 0 || end < open {
+		return processInfo{}, false
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return processInfo{}, false
+	}
+	num := func(i int) int64 {
+		n, _ := strconv.ParseInt(fields[i], 10, 64)
+		return n
+	}
+	p := processInfo{
+		pid:     pid,
+		name:    string(stat[open+1 : end]),
+		state:   fields[0],
+		ppid:    int(num(1)),
+		cpu:     time.Duration(num(11)+num(12)) * time.Second / procClockTicks,
+		threads: int(num(17)),
+		rss:     num(21) * int64(os.Getpagesize()),
+	}
+	if !boot.IsZero() {
+		p.start = boot.Add(time.Duration(num(19)) * time.Second / procClockTicks)
+	}
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		p.cmdline = strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+	}
+	if status, err := os.ReadFile(filepath.Join(dir, "status")); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if uid, ok := strings.CutPrefix(line, "Uid:"); ok {
+				if f := strings.Fields(uid); len(f) > 0 {
+					p.user = lookupUser(f[0], users)
+				}
+				break
+			}
+		}
+	}
+	return p, true
+}
+
+// lookupUser 返回UID对应的用户名，查不到时返回UID
+func lookupUser(uid string, cache map[string]string) string {
+	if name, ok := cache[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	cache[uid] = name
+	return name
+}
+
+// procBootTime 读取系统启动时间，用于计算进程的启动时间
+func procBootTime() time.Time {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return time.Unix(sec, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// processExtraDetails 返回进程的可执行文件、工作目录和打开的文件数，没有权限读取的项省略
+func processExtraDetails(pid int) []string {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	var lines []string
+	if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+		lines = append(lines, "exe: "+exe)
+	}
+	if cwd, err := os.Readlink(filepath.Join(dir, "cwd")); err == nil {
+		lines = append(lines, "cwd: "+cwd)
+	}
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		lines = append(lines, fmt.Sprintf("open_files: %d", len(fds)))
+	} else {
+		lines = append(lines, "（没有权限读取该进程的工作目录和打开的文件）")
+	}
+	return lines
+}
+
+// listeningPorts 返回各进程监听的TCP端口和绑定的UDP端口
+//
+// 从/proc/net读取套接字，再通过/proc/PID/fd中的socket:[inode]找到所属进程；没有权限读取的进程不会出现在结果中。
+func listeningPorts() (map[int][]listenAddr, error) {
+	sockets := map[string]listenAddr{}
+	found := false
+	for _, name := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join("/proc/net", name))
+		if err != nil {
+			continue
+		}
+		found = true
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // 表头
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			proto := strings.TrimSuffix(name, "6")
+			// TCP只保留LISTEN状态，UDP保留所有绑定的套接字
+			if proto == "tcp" && fields[3] != "0A" {
+				continue
+			}
+			if addr, port, ok := parseProcAddr(fields[1]); ok {
+				sockets[fields[9]] = listenAddr{proto: proto, addr: net.JoinHostPort(addr, strconv.Itoa(port)), port: port}
+			}
+		}
+		f.Close()
+	}
+	if !found {
+		return nil, fmt.Errorf("无法读取/proc/net")
+	}
+
+	result := map[int][]listenAddr{}
+	entries, _ := os.ReadDir("/proc")
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", e.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if l, ok := sockets[inode]; ok && !seen[l.String()] {
+				seen[l.String()] = true
+				result[pid] = append(result[pid], l)
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseProcAddr 解析/proc/net中十六进制的"地址:端口"，地址按主机字节序的32位分组存放
+func parseProcAddr(s string) (string, int, bool) {
+	hexAddr, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || len(raw)%4 != 0 {
+		return "", 0, false
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.IP(raw).String(), int(port), true
+}
+
+// processAlive 判断进程是否仍在运行，僵尸进程视为已退出
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	end := bytes.LastIndexByte(stat, ')')
+	fields := strings.Fields(string(stat[end+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
@@ -0,0 +1,121 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listProcesses 通过ps读取所有进程
+func listProcesses() ([]processInfo, error) {
+	out, err := exec.Command("ps", "-axww", "-o", "pid=,ppid=,user=,state=,rss=,time=,etime=,args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("执行ps失败: %v", err)
+	}
+	now := time.Now()
+	var procs []processInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		rss, _ := strconv.ParseInt(fields[4], 10, 64)
+		p := processInfo{
+			pid:     pid,
+			ppid:    ppid,
+			user:    fields[2],
+			state:   fields[3],
+			rss:     rss * 1024,
+			cpu:     parsePSTime(fields[5]),
+			cmdline: strings.Join(fields[7:], " "),
+			name:    filepath.Base(fields[7]),
+		}
+		if elapsed := parsePSTime(fields[6]); elapsed > 0 {
+			p.start = now.Add(-elapsed)
+		}
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// parsePSTime 解析ps输出的[[dd-]hh:]mm:ss[.cc]格式的时长
+func parsePSTime(s string) time.Duration {
+	var days int
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		days, _ = strconv.Atoi(d)
+		s = rest
+	}
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		total = total*60 + v
+	}
+	return time.Duration(days)*24*time.Hour + time.Duration(total*float64(time.Second))
+}
+
+// processExtraDetails 通过lsof读取进程的工作目录，没有lsof时省略
+func processExtraDetails(pid int) []string {
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if cwd, ok := strings.CutPrefix(line, "n"); ok {
+			return []string{"cwd: " + cwd}
+		}
+	}
+	return nil
+}
+
+// listeningPorts 通过lsof读取各进程监听的TCP端口和绑定的UDP端口
+func listeningPorts() (map[int][]listenAddr, error) {
+	out, err := exec.Command("lsof", "-nP", "-iTCP", "-sTCP:LISTEN", "-iUDP", "-FpPn").Output()
+	if err != nil && len(out) == 0 {
+		if _, lookErr := exec.LookPath("lsof"); lookErr != nil {
+			return nil, fmt.Errorf("未找到lsof命令")
+		}
+		return map[int][]listenAddr{}, nil
+	}
+	result := map[int][]listenAddr{}
+	pid, proto := 0, "tcp"
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+		switch line[0] {
+		case 'p':
+			pid, _ = strconv.Atoi(line[1:])
+		case 'P':
+			proto = strings.ToLower(line[1:])
+		case 'n':
+			addr := line[1:]
+			i := strings.LastIndexByte(addr, ':')
+			if i < 0 {
+				continue
+			}
+			port, err := strconv.Atoi(addr[i+1:])
+			if err != nil {
+				continue
+			}
+			result[pid] = append(result[pid], listenAddr{proto: proto, addr: addr, port: port})
+		}
+	}
+	return result, nil
+}
+
+// processAlive 判断进程是否仍在运行，僵尸进程视为已退出
+func processAlive(pid int) bool {
+	out, err := exec.Command("ps", "-o", "state=", "-p", strconv.Itoa(pid)).Output()
+	state := strings.TrimSpace(string(out))
+	return err == nil && state != "" && !strings.HasPrefix(state, "Z")
+}
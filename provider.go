@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 服务商的认证方式
+const (
+	authBearer = "bearer"  // Authorization: Bearer <key>
+	authAPIKey = "api-key" // api-key: <key>（Azure等）
+	authNone   = "none"    // 不需要认证（本地Ollama等）
+)
+
+// Provider 描述一个OpenAI兼容的模型服务
+type Provider struct {
+	Name           string            `json:"-"`
+	BaseURL        string            `json:"base_url"`
+	Auth           string            `json:"auth,omitempty"`            // 认证方式，默认bearer
+	APIKeyEnv      string            `json:"api_key_env,omitempty"`     // 读取API密钥的环境变量
+	DefaultModel   string            `json:"default_model,omitempty"`   // 未指定模型时使用的模型
+	SummaryModel   string            `json:"summary_model,omitempty"`   // 生成历史摘要的廉价模型，为空时使用对话模型
+	Models         map[string]string `json:"models,omitempty"`          // 模型别名到实际模型名的映射
+	ContextWindows map[string]int    `json:"context_windows,omitempty"` // 各模型的上下文窗口大小
+	VisionModels   []string          `json:"vision_models,omitempty"`   // 支持图片输入的模型，未配置时按模型名判断
+}
+
+// builtinProviders 返回内置的服务商配置
+func builtinProviders() map[string]*Provider {
+	return map[string]*Provider{
+		"ecnu": {
+			BaseURL:      "https://chat.ecnu.edu.cn/open/api/v1",
+			APIKeyEnv:    "ECNU_API_KEY",
+			DefaultModel: "ecnu-plus",
+			SummaryModel: "ecnu-turbo",
+		},
+		"openai": {
+			BaseURL:      "https://api.openai.com/v1",
+			APIKeyEnv:    "OPENAI_API_KEY",
+			DefaultModel: "gpt-4o",
+			SummaryModel: "gpt-4o-mini",
+		},
+		"deepseek": {
+			BaseURL:      "https://api.deepseek.com/v1",
+			APIKeyEnv:    "DEEPSEEK_API_KEY",
+			DefaultModel: "deepseek-chat",
+		},
+		"ollama": {
+			BaseURL:      "http://localhost:11434/v1",
+			Auth:         authNone,
+			DefaultModel: "qwen2.5",
+		},
+	}
+}
+
+// defaultProvidersFile 返回自定义服务商配置文件的默认路径
+func defaultProvidersFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "providers.json")
+}
+
+// loadProviders 加载内置服务商，并用配置文件中的同名项覆盖或新增服务商
+//
+// 配置文件格式为 {"名称": {"base_url": "...", "auth": "bearer", "api_key_env": "...",
+// "default_model": "...", "models": {"别名": "实际模型名"}, "context_windows": {"模型": token数},
+// "vision_models": ["支持图片输入的模型"]}}。
+// 未显式指定的默认路径不存在时忽略。
+func loadProviders(path string) (map[string]*Provider, error) {
+	providers := builtinProviders()
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultProvidersFile()
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			var custom map[string]*Provider
+			if err := json.Unmarshal(data, &custom); err != nil {
+				return nil, fmt.Errorf("解析服务商配置%s失败: %v", path, err)
+			}
+			for name, p := range custom {
+				if p == nil || p.BaseURL == "" {
+					return nil, fmt.Errorf("服务商%s缺少base_url", name)
+				}
+				providers[name] = p
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("读取服务商配置失败: %v", err)
+		}
+	}
+
+	for name, p := range providers {
+		p.Name = name
+		if p.Auth == "" {
+			p.Auth = authBearer
+		}
+		switch p.Auth {
+		case authBearer, authAPIKey, authNone:
+		default:
+			return nil, fmt.Errorf("服务商%s的认证方式无效: %s", name, p.Auth)
+		}
+	}
+	return providers, nil
+}
+
+// providerNames 返回排序后的服务商名称列表
+func providerNames(providers map[string]*Provider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveModel 将模型别名映射为服务商的实际模型名
+func (p *Provider) resolveModel(name string) string {
+	if real, ok := p.Models[name]; ok {
+		return real
+	}
+	return name
+}
+
+// apiKeys 按认证方式获取API密钥列表
+//
+// explicit非空时优先使用；否则读取环境变量，多个密钥以逗号分隔；
+// keysFile非空时追加文件中的密钥。
+func (p *Provider) apiKeys(explicit, keysFile string) ([]string, error) {
+	var keys []string
+	if explicit != "" {
+		keys = splitList(explicit)
+	} else if p.APIKeyEnv != "" {
+		keys = splitList(os.Getenv(p.APIKeyEnv))
+	}
+	if keysFile != "" {
+		fileKeys, err := readKeysFile(keysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	if len(keys) == 0 && p.Auth != authNone {
+		if p.APIKeyEnv == "" {
+			return nil, fmt.Errorf("服务商%s未配置api_key_env", p.Name)
+		}
+		return nil, fmt.Errorf("%s环境变量未设置", p.APIKeyEnv)
+	}
+	return keys, nil
+}
+
+// authTransport 按服务商的认证方式，使用密钥池中的当前密钥设置请求头
+type authTransport struct {
+	base http.RoundTripper
+	auth string
+	keys *keyPool
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := t.keys.acquire()
+	if key == "" || t.auth == authNone {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	if t.auth == authAPIKey {
+		req.Header.Del("Authorization")
+		req.Header.Set("api-key", key)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return t.base.RoundTrip(req)
+}
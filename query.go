@@ -0,0 +1,713 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	queryMaxFileSize = 50 * 1024 * 1024 // 查询文件的大小上限
+	queryMaxResults  = 200              // 最多输出的结果数
+)
+
+// queryDataTool 查询JSON/YAML文件的工具定义
+var queryDataTool = Tool{
+	Type:      "function",
+	Name:      "query_data",
+	Cacheable: true,
+	Description: "读取JSON或YAML文件并用类似jq的表达式提取其中的值，只返回匹配的部分，避免把很大的配置文件整个读入上下文。" +
+		"支持.a.b、.[\"带空格的键\"]、[0]、[-1]、[1:3]、[]（展开数组或对象的值）、?（忽略类型错误）、|管道，" +
+		"以及keys、length、type、select(条件)，条件可用== != > >= < <=与JSON字面量比较，如 .items[] | select(.kind == \"Deployment\") | .metadata.name。" +
+		"多文档YAML会对每个文档分别求值。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "JSON或YAML文件路径",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "查询表达式，如.spec.containers[0].image，默认.（整个文件）",
+			},
+			"raw": map[string]interface{}{
+				"type":        "boolean",
+				"description": "字符串结果是否不加引号直接输出（类似jq -r），默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// queryStep 查询表达式中的一步，输入一个值输出零个或多个值
+type queryStep func(v interface{}) ([]interface{}, error)
+
+// queryParser 解析类jq表达式的递归下降解析器
+type queryParser struct {
+	src string
+	pos int
+}
+
+// parseQuery 把表达式编译为按管道顺序执行的步骤
+func parseQuery(src string) ([]queryStep, error) {
+	p := &queryParser{src: src}
+	steps, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("无法解析的内容 %q", p.src[p.pos:])
+	}
+	return steps, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("查询表达式第%d个字符处: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\n\r", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek 跳过空白后返回下一个字符，到达末尾时返回0
+func (p *queryParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// pipeline 解析以|分隔的多个项
+func (p *queryParser) pipeline() ([]queryStep, error) {
+	var steps []queryStep
+	for {
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, term...)
+		if p.peek() != '|' {
+			return steps, nil
+		}
+		p.pos++
+	}
+}
+
+// term 解析路径或内置函数
+func (p *queryParser) term() ([]queryStep, error) {
+	c := p.peek()
+	switch {
+	case c == '.' || c == '[':
+		return p.path()
+	case isIdentStart(c):
+		name := p.ident()
+		switch name {
+		case "keys":
+			return []queryStep{queryKeys}, nil
+		case "length":
+			return []queryStep{queryLength}, nil
+		case "type":
+			return []queryStep{func(v interface{}) ([]interface{}, error) { return []interface{}{valueType(v)}, nil }}, nil
+		case "select":
+			return p.selectCall()
+		}
+		return nil, p.errorf("不支持的函数 %s", name)
+	case c == 0:
+		return nil, p.errorf("表达式不完整")
+	}
+	return nil, p.errorf("无法解析的字符 %q", c)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// ident 读取函数名
+func (p *queryParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) && (isIdentStart(p.src[p.pos]) || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// path 解析.a.b[0]["c"][]这样的路径
+func (p *queryParser) path() ([]queryStep, error) {
+	var steps []queryStep
+	first := true
+	for {
+		c := p.peek()
+		switch {
+		case c == '.':
+			p.pos++
+			if p.pos >= len(p.src) {
+				return steps, nil
+			}
+			next := p.src[p.pos]
+			switch {
+			case next == '"':
+				key, err := p.stringLiteral()
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, p.optional(queryField(key)))
+			case isIdentStart(next) || next >= 0x80:
+				steps = append(steps, p.optional(queryField(p.unquotedKey())))
+			case next == '[':
+				// .[0]与[0]相同，由下一轮处理
+			default:
+				if first {
+					// 单独的.表示当前值
+					return steps, nil
+				}
+				return nil, p.errorf("点号后缺少键名")
+			}
+		case c == '[':
+			step, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, p.optional(step))
+		default:
+			return steps, nil
+		}
+		first = false
+	}
+}
+
+// unquotedKey 读取点号之后不带引号的键名，允许中文
+func (p *queryParser) unquotedKey() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '.' || c == '[' || c == '|' || c == '?' || c == ')' || c == ' ' || c == '\t' || c == '=' || c == '!' || c == '<' || c == '>' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// optional 路径步骤后跟?时忽略该步骤的类型错误
+func (p *queryParser) optional(step queryStep) queryStep {
+	if p.pos < len(p.src) && p.src[p.pos] == '?' {
+		p.pos++
+		return func(v interface{}) ([]interface{}, error) {
+			out, err := step(v)
+			if err != nil {
+				return nil, nil
+			}
+			return out, nil
+		}
+	}
+	return step
+}
+
+// stringLiteral 读取JSON格式的带引号字符串
+func (p *queryParser) stringLiteral() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return "", p.errorf("字符串缺少结束引号")
+	}
+	p.pos++
+	var s string
+	if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+		return "", p.errorf("字符串无效: %v", err)
+	}
+	return s, nil
+}
+
+// bracket 解析[]、[n]、[a:b]和["key"]
+func (p *queryParser) bracket() (queryStep, error) {
+	p.pos++
+	if p.peek() == ']' {
+		p.pos++
+		return queryIterate, nil
+	}
+	if p.peek() == '"' {
+		key, err := p.stringLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ']' {
+			return nil, p.errorf("缺少]")
+		}
+		p.pos++
+		return queryField(key), nil
+	}
+
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("缺少]")
+	}
+	inner := strings.TrimSpace(p.src[p.pos : p.pos+end])
+	p.pos += end + 1
+	if from, to, ok := strings.Cut(inner, ":"); ok {
+		var bounds [2]*int
+		for i, s := range []string{from, to} {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, p.errorf("切片下标无效: %q", s)
+			}
+			bounds[i] = &n
+		}
+		return querySlice(bounds[0], bounds[1]), nil
+	}
+	n, err := strconv.Atoi(inner)
+	if err != nil {
+		return nil, p.errorf("数组下标无效: %q", inner)
+	}
+	return queryIndex(n), nil
+}
+
+// selectCall 解析select(路径 运算符 字面量)或select(路径)
+func (p *queryParser) selectCall() ([]queryStep, error) {
+	if p.peek() != '(' {
+		return nil, p.errorf("select后缺少(")
+	}
+	p.pos++
+	left, err := p.pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	op := ""
+	p.skipSpace()
+	for _, candidate := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		if strings.HasPrefix(p.src[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	var literal interface{}
+	if op != "" {
+		p.skipSpace()
+		dec := json.NewDecoder(strings.NewReader(p.src[p.pos:]))
+		dec.UseNumber()
+		if err := dec.Decode(&literal); err != nil {
+			return nil, p.errorf("比较的值必须是JSON字面量，字符串需要加双引号")
+		}
+		p.pos += int(dec.InputOffset())
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("select缺少)")
+	}
+	p.pos++
+
+	return []queryStep{func(v interface{}) ([]interface{}, error) {
+		values, err := runQuery(left, []interface{}{v})
+		if err != nil {
+			return nil, err
+		}
+		for _, x := range values {
+			if op == "" && truthy(x) || op != "" && compareValues(x, op, literal) {
+				return []interface{}{v}, nil
+			}
+		}
+		return nil, nil
+	}}, nil
+}
+
+// runQuery 依次执行各步骤，每一步作用于上一步输出的每个值
+func runQuery(steps []queryStep, values []interface{}) ([]interface{}, error) {
+	for _, step := range steps {
+		var next []interface{}
+		for _, v := range values {
+			out, err := step(v)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// queryField 取对象的字段，null的字段仍为null
+func queryField(key string) queryStep {
+	return func(v interface{}) ([]interface{}, error) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			return []interface{}{x[key]}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("无法从%s中取字段%q", valueType(v), key)
+	}
+}
+
+// queryIndex 取数组的元素，负数从末尾开始计算
+func queryIndex(n int) queryStep {
+	return func(v interface{}) ([]interface{}, error) {
+		switch x := v.(type) {
+		case []interface{}:
+			i := n
+			if i < 0 {
+				i += len(x)
+			}
+			if i < 0 || i >= len(x) {
+				return []interface{}{nil}, nil
+			}
+			return []interface{}{x[i]}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("无法对%s使用下标[%d]", valueType(v), n)
+	}
+}
+
+// querySlice 取数组或字符串的一段
+func querySlice(from, to *int) queryStep {
+	return func(v interface{}) ([]interface{}, error) {
+		bounds := func(n int) (int, int) {
+			start, end := 0, n
+			if from != nil {
+				start = *from
+			}
+			if to != nil {
+				end = *to
+			}
+			if start < 0 {
+				start += n
+			}
+			if end < 0 {
+				end += n
+			}
+			start = max(0, min(start, n))
+			end = max(start, min(end, n))
+			return start, end
+		}
+		switch x := v.(type) {
+		case []interface{}:
+			start, end := bounds(len(x))
+			return []interface{}{x[start:end]}, nil
+		case string:
+			r := []rune(x)
+			start, end := bounds(len(r))
+			return []interface{}{string(r[start:end])}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("无法对%s使用切片", valueType(v))
+	}
+}
+
+// queryIterate 展开数组的元素或对象的值，对象按键名排序
+func queryIterate(v interface{}) ([]interface{}, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		return x, nil
+	case map[string]interface{}:
+		keys := sortedKeys(x)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = x[k]
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("无法展开%s", valueType(v))
+}
+
+// queryKeys 返回对象排序后的键名或数组的下标
+func queryKeys(v interface{}) ([]interface{}, error) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(x)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = k
+		}
+		return []interface{}{out}, nil
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i := range x {
+			out[i] = json.Number(strconv.Itoa(i))
+		}
+		return []interface{}{out}, nil
+	}
+	return nil, fmt.Errorf("%s没有keys", valueType(v))
+}
+
+// queryLength 返回数组、对象、字符串的长度，null为0
+func queryLength(v interface{}) ([]interface{}, error) {
+	n := 0
+	switch x := v.(type) {
+	case []interface{}:
+		n = len(x)
+	case map[string]interface{}:
+		n = len(x)
+	case string:
+		n = len([]rune(x))
+	case nil:
+	case json.Number:
+		return []interface{}{json.Number(strings.TrimPrefix(x.String(), "-"))}, nil
+	default:
+		return nil, fmt.Errorf("%s没有length", valueType(v))
+	}
+	return []interface{}{json.Number(strconv.Itoa(n))}, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// valueType 返回查询结果的JSON类型名，数字为json.Number
+func valueType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// truthy 与jq相同，只有false和null为假
+func truthy(v interface{}) bool {
+	b, isBool := v.(bool)
+	return v != nil && (!isBool || b)
+}
+
+// compareValues 比较两个值，数字按数值比较，其他类型只支持==和!=以及字符串的大小比较
+func compareValues(a interface{}, op string, b interface{}) bool {
+	cmp, ok := 0, true
+	an, aNum := a.(json.Number)
+	bn, bNum := b.(json.Number)
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	switch {
+	case aNum && bNum:
+		x, _ := an.Float64()
+		y, _ := bn.Float64()
+		cmp = compareFloat(x, y)
+	case aStr && bStr:
+		cmp = strings.Compare(as, bs)
+	default:
+		ok = false
+		ja, _ := json.Marshal(a)
+		jb, _ := json.Marshal(b)
+		if bytes.Equal(ja, jb) {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	}
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	if !ok {
+		return false
+	}
+	switch op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// normalizeYAML 把YAML解码的值转换为与JSON解码一致的类型
+func normalizeYAML(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			x[k] = normalizeYAML(val)
+		}
+		return x
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range x {
+			x[i] = normalizeYAML(val)
+		}
+		return x
+	case int:
+		return json.Number(strconv.Itoa(x))
+	case int64:
+		return json.Number(strconv.FormatInt(x, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(x, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(x, 'g', -1, 64))
+	case fmt.Stringer:
+		// 时间等类型按字符串处理
+		return x.String()
+	}
+	return v
+}
+
+// loadDocuments 读取JSON或YAML文件，YAML可能包含多个文档
+func loadDocuments(fullPath string, data []byte) ([]interface{}, string, error) {
+	ext := strings.ToLower(filepath.Ext(fullPath))
+	if ext != ".yaml" && ext != ".yml" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var docs []interface{}
+		for {
+			var v interface{}
+			err := dec.Decode(&v)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if ext == ".json" || len(docs) > 0 {
+					return nil, "", fmt.Errorf("解析JSON失败: %v", err)
+				}
+				// 扩展名不明确时再按YAML尝试
+				return loadYAML(data)
+			}
+			docs = append(docs, v)
+		}
+		return docs, "JSON", nil
+	}
+	return loadYAML(data)
+}
+
+func loadYAML(data []byte) ([]interface{}, string, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs []interface{}
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("解析YAML失败: %v", err)
+		}
+		docs = append(docs, normalizeYAML(v))
+	}
+	return docs, "YAML", nil
+}
+
+// queryData 对JSON/YAML文件求值查询表达式，只返回匹配的值
+func (a *ECNUAgent) queryData(args string) (string, error) {
+	params := struct {
+		Path  string `json:"path"`
+		Query string `json:"query"`
+		Raw   bool   `json:"raw"`
+	}{Query: "."}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	if strings.TrimSpace(params.Query) == "" {
+		params.Query = "."
+	}
+	steps, err := parseQuery(params.Query)
+	if err != nil {
+		return fmt.Sprintf("查询失败: %v", err), nil
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	log.Printf("[查询数据] %s (%s)\n", fullPath, params.Query)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("查询失败: %v", err), nil
+	}
+	if info.Size() > queryMaxFileSize {
+		return fmt.Sprintf("查询失败: 文件大小%s超过上限%s", formatSize(info.Size()), formatSize(queryMaxFileSize)), nil
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return fmt.Sprintf("查询失败: %v", err), nil
+	}
+	docs, format, err := loadDocuments(fullPath, data)
+	if err != nil {
+		return fmt.Sprintf("查询失败: %v", err), nil
+	}
+
+	// 多文档时逐个求值，出错时指出是哪个文档
+	var results []interface{}
+	for i, doc := range docs {
+		out, err := runQuery(steps, []interface{}{doc})
+		if err != nil {
+			if len(docs) > 1 {
+				return fmt.Sprintf("查询失败: 第%d个文档: %v（可在步骤后加?忽略不匹配的文档）", i+1, err), nil
+			}
+			return fmt.Sprintf("查询失败: %v", err), nil
+		}
+		results = append(results, out...)
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("%s 中没有匹配 %s 的值", fullPath, params.Query), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s（%s", fullPath, format)
+	if len(docs) > 1 {
+		fmt.Fprintf(&b, "，%d个文档", len(docs))
+	}
+	fmt.Fprintf(&b, "）中 %s 的结果，共%d个:\n", params.Query, len(results))
+	for i, v := range results {
+		if i == queryMaxResults {
+			fmt.Fprintf(&b, "...（另有%d个结果未显示，请缩小查询范围）\n", len(results)-i)
+			break
+		}
+		if s, ok := v.(string); ok && params.Raw {
+			b.WriteString(s + "\n")
+			continue
+		}
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("查询失败: %v", err), nil
+		}
+		b.Write(out)
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
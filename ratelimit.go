@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// rateWindow 限流统计的滑动窗口长度
+const rateWindow = time.Minute
+
+// rateEvent 记录窗口内的一次请求及其消耗的token数
+type rateEvent struct {
+	at     time.Time
+	tokens int
+}
+
+// rateLimiter 基于一分钟滑动窗口的客户端限流器，同时限制请求数和token数
+type rateLimiter struct {
+	rpm int // 每分钟最大请求数，0表示不限制
+	tpm int // 每分钟最大token数，0表示不限制
+
+	mu     sync.Mutex
+	events []*rateEvent
+}
+
+// newRateLimiter 创建限流器，两项限制都为0时返回nil
+func newRateLimiter(rpm, tpm int) *rateLimiter {
+	if rpm <= 0 && tpm <= 0 {
+		return nil
+	}
+	return &rateLimiter{rpm: rpm, tpm: tpm}
+}
+
+// wait 阻塞直到可以发送一个预计消耗tokens的请求，返回的事件可用record修正实际用量
+func (l *rateLimiter) wait(ctx context.Context, tokens int) (*rateEvent, error) {
+	if l == nil {
+		return nil, nil
+	}
+
+	logged := false
+	for {
+		ev, delay := l.tryAcquire(time.Now(), tokens)
+		if ev != nil {
+			return ev, nil
+		}
+
+		if !logged {
+			log.Printf("[限流] 已达到客户端速率限制，等待 %v...\n", delay.Round(time.Second))
+			logged = true
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// tryAcquire 尝试占用一次请求额度，成功返回新的记录，否则返回建议的等待时间
+func (l *rateLimiter) tryAcquire(now time.Time, tokens int) (*rateEvent, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 清理窗口外的记录
+	cutoff := now.Add(-rateWindow)
+	kept := l.events[:0]
+	for _, ev := range l.events {
+		if ev.at.After(cutoff) {
+			kept = append(kept, ev)
+		}
+	}
+	l.events = kept
+
+	used := 0
+	for _, ev := range l.events {
+		used += ev.tokens
+	}
+
+	rpmOK := l.rpm <= 0 || len(l.events) < l.rpm
+	// 单个请求超过整个token额度时，只要窗口为空就放行，避免永久阻塞
+	tpmOK := l.tpm <= 0 || used+tokens <= l.tpm || len(l.events) == 0
+	if rpmOK && tpmOK {
+		ev := &rateEvent{at: now, tokens: tokens}
+		l.events = append(l.events, ev)
+		return ev, 0
+	}
+
+	// 等到最早的记录移出窗口后再检查
+	delay := l.events[0].at.Add(rateWindow).Sub(now)
+	if delay < 100*time.Millisecond {
+		delay = 100 * time.Millisecond
+	}
+	return nil, delay
+}
+
+// record 用实际消耗的token数修正请求记录
+func (l *rateLimiter) record(ev *rateEvent, tokens int) {
+	if l == nil || ev == nil || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	ev.tokens = tokens
+	l.mu.Unlock()
+}
+
+// throttle 在发送请求前进行客户端限流，返回的函数用于登记实际用量
+func (a *ECNUAgent) throttle(ctx context.Context, req openai.ChatCompletionRequest) (func(openai.Usage), error) {
+	ev, err := a.limiter.wait(ctx, estimateHistoryTokens(req.Messages))
+	if err != nil {
+		return nil, err
+	}
+	return func(usage openai.Usage) {
+		a.limiter.record(ev, usage.TotalTokens)
+	}, nil
+}
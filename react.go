@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 工具调用方式
+const (
+	toolModeNative = "native" // 使用OpenAI tools接口
+	toolModeReact  = "react"  // 在提示词中描述工具，从文本中解析Action
+)
+
+// reactStop ReAct模式下的停止序列，防止模型自行编造工具结果
+const reactStop = "Observation:"
+
+var (
+	reactActionRe = regexp.MustCompile(`(?im)^[ \t]*Action[ \t]*:[ \t]*(\S[^\n]*)$`)
+	reactInputRe  = regexp.MustCompile(`(?i)Action[ \t]*Input[ \t]*:`)
+	reactFinalRe  = regexp.MustCompile(`(?i)Final[ \t]*Answer[ \t]*:`)
+)
+
+// reactPrompt 生成ReAct模式下追加到系统提示词中的工具说明和输出格式
+func reactPrompt(tools []Tool) string {
+	var b strings.Builder
+	b.WriteString("\n\n你可以使用以下工具（参数为JSON Schema描述的JSON对象）：\n")
+	for _, tool := range tools {
+		params, _ := json.Marshal(tool.Parameters)
+		fmt.Fprintf(&b, "- %s: %s\n  参数: %s\n", tool.Name, tool.Description, params)
+	}
+	b.WriteString(`
+请严格按照以下格式回复，每次只使用一个工具：
+
+Thought: 思考下一步要做什么
+Action: 工具名称
+Action Input: JSON格式的参数
+
+然后停止输出，等待用户以"Observation:"开头返回工具结果。得到足够的信息后，按以下格式给出最终回答：
+
+Thought: 我已经完成了任务
+Final Answer: 给用户的最终回答`)
+	return b.String()
+}
+
+// parseReactResponse 从模型的文本回复中解析工具调用或最终回答
+//
+// 找到Action时返回对应的工具调用；否则返回最终回答，未按格式输出时整段回复视为最终回答。
+func parseReactResponse(content string, step int) (*openai.ToolCall, string) {
+	action := reactActionRe.FindStringSubmatchIndex(content)
+	final := reactFinalRe.FindStringIndex(content)
+	if action == nil || (final != nil && final[0] < action[0]) {
+		if final != nil {
+			return nil, strings.TrimSpace(content[final[1]:])
+		}
+		return nil, strings.TrimSpace(content)
+	}
+
+	name := strings.Trim(strings.TrimSpace(content[action[2]:action[3]]), "`*")
+	input := "{}"
+	rest := content[action[1]:]
+	if loc := reactInputRe.FindStringIndex(rest); loc != nil {
+		input = extractJSONObject(rest[loc[1]:])
+	}
+
+	return &openai.ToolCall{
+		ID:   fmt.Sprintf("react-%d", step),
+		Type: openai.ToolTypeFunction,
+		Function: openai.FunctionCall{
+			Name:      name,
+			Arguments: input,
+		},
+	}, ""
+}
+
+// extractJSONObject 从Action Input之后的文本中取出JSON参数，去掉代码块标记和多余内容
+func extractJSONObject(text string) string {
+	if idx := strings.Index(text, reactStop); idx >= 0 {
+		text = text[:idx]
+	}
+	text = strings.TrimSpace(text)
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start >= 0 && end > start {
+		return text[start : end+1]
+	}
+	text = strings.Trim(text, "`")
+	if text == "" {
+		return "{}"
+	}
+	return text
+}
+
+// reactObservation 将工具结果转换为返回给模型的Observation消息
+func reactObservation(results []openai.ChatCompletionMessage) openai.ChatCompletionMessage {
+	parts := make([]string, 0, len(results))
+	for _, result := range results {
+		parts = append(parts, result.Content)
+	}
+	return openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: reactStop + " " + strings.Join(parts, "\n"),
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// runRecord 运行记录文件中的一行
+type runRecord struct {
+	Type     string                         `json:"type"` // session或completion
+	Time     time.Time                      `json:"time"`
+	Endpoint string                         `json:"endpoint,omitempty"`
+	Seed     int                            `json:"seed,omitempty"`
+	Request  *openai.ChatCompletionRequest  `json:"request,omitempty"`
+	Response *openai.ChatCompletionResponse `json:"response,omitempty"`
+	Error    string                         `json:"error,omitempty"`
+}
+
+// runRecorder 将每次请求和响应按JSON Lines格式追加到运行记录文件，便于复现和调试
+type runRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// newRunRecorder 打开运行记录文件并写入会话信息，path为空时返回nil
+func newRunRecorder(path string, cfg *Config) (*runRecorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("打开运行记录文件失败: %v", err)
+	}
+	r := &runRecorder{file: file, enc: json.NewEncoder(file)}
+	r.write(runRecord{Type: "session", Time: time.Now(), Endpoint: cfg.Provider, Seed: cfg.Seed})
+	return r, nil
+}
+
+// recordCompletion 记录一次对话请求及其结果
+func (r *runRecorder) recordCompletion(endpoint string, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, err error) {
+	if r == nil {
+		return
+	}
+	rec := runRecord{Type: "completion", Time: time.Now(), Endpoint: endpoint, Request: &req}
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Response = &resp
+	}
+	r.write(rec)
+}
+
+// write 写入一行记录，失败时只输出日志，不影响任务执行
+func (r *runRecorder) write(rec runRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(rec); err != nil {
+		log.Printf("[记录] 写入运行记录失败: %v\n", err)
+	}
+}
+
+// Close 关闭运行记录文件
+func (r *runRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.file.Close()
+}
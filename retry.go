@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	retryBaseDelay     = time.Second      // 首次重试的基础等待时间
+	retryMaxDelay      = 30 * time.Second // 指数退避的等待上限
+	retryAfterMaxDelay = 2 * time.Minute  // Retry-After允许的最长等待时间
+)
+
+// retryAfterTransport 记录服务端限流响应中的Retry-After头，供下一次重试使用
+type retryAfterTransport struct {
+	base http.RoundTripper
+
+	mu   sync.Mutex
+	wait time.Duration
+}
+
+// RoundTrip 实现http.RoundTripper
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			t.mu.Lock()
+			t.wait = wait
+			t.mu.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// take 取出最近一次记录的Retry-After等待时间并清空
+func (t *retryAfterTransport) take() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	wait := t.wait
+	t.wait = 0
+	return wait, wait > 0
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = at.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if wait <= 0 {
+		return 0, false
+	}
+	if wait > retryAfterMaxDelay {
+		wait = retryAfterMaxDelay
+	}
+	return wait, true
+}
+
+// retryDelay 计算第attempt次重试前的等待时间
+//
+// 限流错误优先遵循服务端的Retry-After，否则使用带抖动的指数退避，
+// 等待时间在 [d/2, d) 之间随机，其中 d = 基础时间 * 2^(attempt-1)。
+func (a *ECNUAgent) retryDelay(attempt int, err error) time.Duration {
+	if a.backend.retryAfter != nil {
+		wait, ok := a.backend.retryAfter.take()
+		code := statusCode(err)
+		if ok && (code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable) {
+			return wait
+		}
+	}
+
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// statusCode 提取API错误的HTTP状态码，非HTTP错误返回0
+func statusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// isRetryable 判断错误是否值得重试
+//
+// 请求参数错误、认证失败等配置问题重试也不会成功，应立即失败；
+// 限流、超时、服务端错误和网络错误则可以重试。
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	switch code := statusCode(err); {
+	case code == 0:
+		// 非HTTP错误：网络错误、超时或流被中断，均视为临时故障
+		return true
+	case code == http.StatusRequestTimeout, code == http.StatusConflict, code == http.StatusTooManyRequests:
+		return true
+	case code >= 500:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// execute_command的执行环境
+const (
+	sandboxNone   = "none"   // 直接在本机执行
+	sandboxDocker = "docker" // 在Docker容器中执行，工作区挂载到容器中
+	sandboxBwrap  = "bwrap"  // 用bubblewrap或用户命名空间隔离，只有工作区可见
+)
+
+// sandboxCommandEnv 标记沙箱中一条命令启动的所有进程，中断时据此结束容器中的进程
+const sandboxCommandEnv = "ECNU_SANDBOX_CMD"
+
+// sandbox 执行execute_command的环境
+type sandbox interface {
+	// command 创建以dir为当前目录、env为环境变量（为nil时使用初始环境）执行script的命令
+	command(ctx context.Context, script, dir string, env []string) (*exec.Cmd, error)
+	// environ 返回命令的初始环境变量
+	environ() []string
+	// isDir 判断沙箱中的路径是否为目录
+	isDir(path string) bool
+	// stateFile 返回命令结束时写入shell状态的文件路径
+	stateFile() (string, error)
+	// takeState 读取并删除状态文件，命令被强制结束时为空
+	takeState(path string) []byte
+	// describe 返回结果中显示的说明，本机执行时为空
+	describe() string
+	// note 返回加在execute_command说明中的执行环境介绍，本机执行时为空
+	note() string
+	// close 释放沙箱占用的资源
+	close()
+}
+
+// newSandbox 根据配置创建执行环境
+func newSandbox(cfg *Config, workspace string) (sandbox, error) {
+	if cfg.K8sPod != "" {
+		return newPodSandbox(cfg)
+	}
+	switch cfg.Sandbox {
+	case sandboxBwrap:
+		return newNamespaceSandbox(cfg, workspace)
+	case sandboxDocker:
+	default:
+		shell, err := findHostShell(cfg.Shell)
+		if err != nil {
+			return nil, err
+		}
+		return hostSandbox{shell: shell, env: detectHostEnvironment(shell)}, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("Windows上暂不支持docker沙箱")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("未找到docker命令: %v", err)
+	}
+	return &dockerSandbox{cfg: cfg, workspace: workspace}, nil
+}
+
+// hostOnlyToolNames 直接在本机执行程序或操作本机进程、服务和软件包的工具，使用沙箱时不提供，
+// 模型需要时改用execute_command在沙箱中执行
+var hostOnlyToolNames = map[string]bool{
+	"manage_packages": true, "git": true, "manage_service": true, "manage_processes": true,
+}
+
+// sandboxTools 去掉绕过沙箱在本机执行的工具
+func sandboxTools(tools []Tool) []Tool {
+	var kept []Tool
+	for _, t := range tools {
+		if !hostOnlyToolNames[t.Name] {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// hostSandbox 直接在本机执行命令
+type hostSandbox struct {
+	shell hostShell
+	env   hostEnvironment // 启动时检测到的系统版本和已安装的命令
+}
+
+func (h hostSandbox) command(ctx context.Context, script, dir string, env []string) (*exec.Cmd, error) {
+	cmd := h.shell.command(ctx, script)
+	cmd.Dir = dir
+	cmd.Env = env
+	setProcessGroup(cmd)
+	return cmd, nil
+}
+
+func (hostSandbox) environ() []string { return os.Environ() }
+
+func (hostSandbox) isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (hostSandbox) stateFile() (string, error)   { return localStateFile("") }
+func (hostSandbox) takeState(path string) []byte { return takeLocalState(path) }
+func (hostSandbox) describe() string             { return "" }
+func (h hostSandbox) note() string               { return h.shell.note() }
+func (hostSandbox) close()                       {}
+
+// localStateFile 在本机的dir目录中创建状态文件，dir为空时使用系统临时目录
+func localStateFile(dir string) (string, error) {
+	f, err := os.CreateTemp(dir, "ecnu-shell-*")
+	if err != nil {
+		return "", fmt.Errorf("创建shell状态文件失败: %v", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// takeLocalState 读取并删除本机上的状态文件
+func takeLocalState(path string) []byte {
+	data, _ := os.ReadFile(path)
+	os.Remove(path)
+	return data
+}
+
+// dockerSandbox 在Docker容器中执行命令
+//
+// 容器在第一条命令执行时启动并一直保留到Agent退出，安装的软件包和工作区之外的文件在命令之间保持。
+// 工作区和状态目录以相同路径挂载，文件工具和命令看到的路径一致。
+type dockerSandbox struct {
+	cfg       *Config
+	workspace string
+
+	mu        sync.Mutex
+	container string   // 已启动的容器名称
+	env       []string // 容器中的初始环境变量
+	tmp       string   // 挂载到容器中的状态目录
+	err       error    // 启动失败的原因，不再重试
+	nextID    int
+}
+
+// start 启动容器，已启动时直接返回，调用时需持有锁
+func (d *dockerSandbox) start() error {
+	if d.container != "" || d.err != nil {
+		return d.err
+	}
+	name := fmt.Sprintf("ecnu-agent-%d", os.Getpid())
+	tmp, err := os.MkdirTemp("", "ecnu-sandbox-*")
+	if err != nil {
+		d.err = fmt.Errorf("创建沙箱状态目录失败: %v", err)
+		return d.err
+	}
+	args := []string{"run", "-d", "--rm", "--name", name, "--label", "ecnu-agent=1",
+		"-v", d.workspace + ":" + d.workspace, "-v", tmp + ":" + tmp, "-w", d.workspace}
+	if !d.cfg.SandboxNetwork {
+		args = append(args, "--network", "none")
+	}
+	args = append(args, d.cfg.SandboxArgs...)
+	// 镜像中不一定有sleep infinity，用tail保持容器运行
+	args = append(args, d.cfg.SandboxImage, "tail", "-f", "/dev/null")
+
+	log.Printf("[沙箱] 启动Docker容器 %s (镜像: %s)，首次使用镜像时需要下载\n", name, d.cfg.SandboxImage)
+	if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		os.RemoveAll(tmp)
+		d.err = fmt.Errorf("启动Docker容器失败: %v: %s", err, strings.TrimSpace(string(out)))
+		return d.err
+	}
+	out, err := exec.Command("docker", "exec", name, "env", "-0").Output()
+	if err != nil {
+		exec.Command("docker", "rm", "-f", name).Run()
+		os.RemoveAll(tmp)
+		d.err = fmt.Errorf("读取容器环境变量失败: %v", err)
+		return d.err
+	}
+	for _, kv := range bytes.Split(bytes.TrimSuffix(out, []byte{0}), []byte{0}) {
+		if name, _, ok := strings.Cut(string(kv), "="); ok && !shellIgnoredVars[name] {
+			d.env = append(d.env, string(kv))
+		}
+	}
+	d.container, d.tmp = name, tmp
+	return nil
+}
+
+// command 通过docker exec在容器中执行script
+//
+// 环境变量用env -i完整替换，进程都带有编号标记，中断时结束容器中带该标记的进程，而不只是本机的docker客户端。
+func (d *dockerSandbox) command(ctx context.Context, script, dir string, env []string) (*exec.Cmd, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.start(); err != nil {
+		return nil, err
+	}
+	d.nextID++
+	marker := fmt.Sprintf("%s=%d", sandboxCommandEnv, d.nextID)
+
+	args := []string{"exec", "-i", d.container, "env"}
+	if env != nil {
+		args = append(args, "-i")
+		args = append(args, env...)
+	}
+	// 目录可能已在容器中被删除，此时留在工作区
+	cd := fmt.Sprintf("cd %s 2>/dev/null || echo %s >&2; ", shellQuote(dir), shellQuote("目录"+dir+"不存在，已在"+d.workspace+"中执行"))
+	args = append(args, marker, "sh", "-c", cd+script)
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	container := d.container
+	cmd.Cancel = func() error {
+		exec.Command("docker", "exec", container, "sh", "-c", markerKillScript(marker)).Run()
+		return cmd.Process.Kill()
+	}
+	return cmd, nil
+}
+
+// markerKillScript 返回结束环境变量中带有marker的所有进程的脚本，用于结束远程执行的命令
+func markerKillScript(marker string) string {
+	return fmt.Sprintf(`for p in /proc/[0-9]*; do tr '\0' '\n' <"$p/environ" 2>/dev/null | grep -qx '%s' && kill -9 "${p#/proc/}"; done`, marker)
+}
+
+func (d *dockerSandbox) environ() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.start() != nil {
+		return nil
+	}
+	return append([]string(nil), d.env...)
+}
+
+// isDir 只能检查挂载的目录，其他路径由命令执行时的cd判断
+func (d *dockerSandbox) isDir(path string) bool {
+	if !withinDir(d.workspace, path) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (d *dockerSandbox) stateFile() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.start(); err != nil {
+		return "", err
+	}
+	return localStateFile(d.tmp)
+}
+
+func (d *dockerSandbox) takeState(path string) []byte { return takeLocalState(path) }
+
+func (d *dockerSandbox) describe() string {
+	network := ""
+	if !d.cfg.SandboxNetwork {
+		network = "，无网络"
+	}
+	return fmt.Sprintf("docker（镜像%s%s）", d.cfg.SandboxImage, network)
+}
+
+func (d *dockerSandbox) note() string {
+	return fmt.Sprintf("命令在Docker容器（镜像%s）中执行，工作区挂载在相同路径，工作区之外的修改不影响本机。", d.cfg.SandboxImage) + networkNote(d.cfg)
+}
+
+// networkNote 沙箱禁止访问网络时返回的说明
+func networkNote(cfg *Config) string {
+	if cfg.SandboxNetwork {
+		return ""
+	}
+	return "命令无法访问网络。"
+}
+
+// close 删除Agent启动的容器
+func (d *dockerSandbox) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.container == "" {
+		return
+	}
+	log.Printf("[沙箱] 删除Docker容器 %s\n", d.container)
+	exec.Command("docker", "rm", "-f", d.container).Run()
+	os.RemoveAll(d.tmp)
+	d.container = ""
+}
+
+// shellQuote 用单引号包裹字符串，作为sh的一个参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,189 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// namespaceSystemDirs 沙箱中以只读方式可见的系统目录
+var namespaceSystemDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt"}
+
+// namespaceDevices 沙箱中可用的设备，其他设备都不可见
+var namespaceDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// namespaceSetup 没有bubblewrap时在新的用户和挂载命名空间中搭建根目录并chroot进去执行命令
+//
+// 参数依次为工作区、状态目录、主目录和命令脚本。
+const namespaceSetup = `set -e
+ws=$1 state=$2 home=$3 script=$4
+r=$state/root
+mkdir -p "$r"
+mount -t tmpfs -o mode=755 ecnu-sandbox "$r"
+for d in %s; do
+	if [ -L "$d" ]; then
+		ln -s "$(readlink "$d")" "$r$d"
+	elif [ -d "$d" ]; then
+		mkdir -p "$r$d"
+		mount --rbind "$d" "$r$d"
+		mount -o remount,bind,ro "$r$d"
+	fi
+done
+mkdir -p "$r/proc" "$r/dev" "$r/tmp"
+mount -t proc proc "$r/proc"
+mount -t tmpfs -o mode=755 ecnu-dev "$r/dev"
+for n in %s; do
+	touch "$r/dev/$n"
+	mount --bind "/dev/$n" "$r/dev/$n" 2>/dev/null || rm -f "$r/dev/$n"
+done
+ln -s /proc/self/fd "$r/dev/fd"
+ln -s /proc/self/fd/0 "$r/dev/stdin"
+ln -s /proc/self/fd/1 "$r/dev/stdout"
+ln -s /proc/self/fd/2 "$r/dev/stderr"
+mount -t tmpfs ecnu-tmp "$r/tmp"
+if [ -n "$home" ]; then
+	mkdir -p "$r$home"
+	mount -t tmpfs ecnu-home "$r$home"
+fi
+mkdir -p "$r$ws" "$r$state"
+mount --bind "$ws" "$r$ws"
+mount --bind "$state" "$r$state"
+exec chroot "$r" /bin/sh -c "$script"
+`
+
+// namespaceSandbox 用bubblewrap或用户命名空间隔离命令，不需要Docker
+//
+// 命令只能看到只读的系统目录和可写的工作区，主目录和/tmp是空的临时目录，没有/sys，/dev中只有null、zero、urandom等基本设备。
+// 命令在独立的PID命名空间中运行，结束时其中的所有进程都会被结束。
+type namespaceSandbox struct {
+	cfg       *Config
+	workspace string
+	bwrap     string // bubblewrap的路径，为空时使用unshare
+
+	mu  sync.Mutex
+	tmp string // 挂载到沙箱中同一路径的状态目录
+}
+
+// newNamespaceSandbox 优先使用bubblewrap，没有时检查unshare能否创建用户命名空间
+func newNamespaceSandbox(cfg *Config, workspace string) (sandbox, error) {
+	if path, err := exec.LookPath("bwrap"); err == nil {
+		return &namespaceSandbox{cfg: cfg, workspace: workspace, bwrap: path}, nil
+	}
+	if _, err := exec.LookPath("unshare"); err != nil {
+		return nil, fmt.Errorf("未找到bwrap或unshare命令，请安装bubblewrap")
+	}
+	if out, err := exec.Command("unshare", "--user", "--map-root-user", "--mount", "true").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("无法创建用户命名空间，请安装bubblewrap或开启非特权用户命名空间: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	log.Printf("[沙箱] 未找到bwrap，使用unshare创建用户命名空间\n")
+	return &namespaceSandbox{cfg: cfg, workspace: workspace}, nil
+}
+
+// home 返回需要用空目录替换的主目录，主目录包含工作区时不替换
+func (s *namespaceSandbox) home() string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "/" || withinDir(home, s.workspace) {
+		return ""
+	}
+	return home
+}
+
+func (s *namespaceSandbox) command(ctx context.Context, script, dir string, env []string) (*exec.Cmd, error) {
+	state, err := s.dir()
+	if err != nil {
+		return nil, err
+	}
+	// 目录可能不在沙箱中可见的范围内，此时留在工作区
+	script = fmt.Sprintf("cd %s 2>/dev/null || { echo %s >&2; cd %s; }; ", shellQuote(dir), shellQuote("目录"+dir+"在沙箱中不可见，已在"+s.workspace+"中执行"), shellQuote(s.workspace)) + script
+
+	var cmd *exec.Cmd
+	if s.bwrap != "" {
+		args := []string{"--die-with-parent", "--unshare-pid", "--unshare-ipc", "--unshare-uts", "--unshare-cgroup-try"}
+		if !s.cfg.SandboxNetwork {
+			args = append(args, "--unshare-net")
+		}
+		for _, d := range namespaceSystemDirs {
+			args = append(args, "--ro-bind-try", d, d)
+		}
+		args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+		if home := s.home(); home != "" {
+			args = append(args, "--tmpfs", home)
+		}
+		args = append(args, "--bind", s.workspace, s.workspace, "--bind", state, state, "--", "sh", "-c", script)
+		cmd = exec.CommandContext(ctx, s.bwrap, args...)
+	} else {
+		args := []string{"--user", "--map-root-user", "--mount", "--pid", "--fork", "--kill-child", "--ipc", "--uts"}
+		if !s.cfg.SandboxNetwork {
+			args = append(args, "--net")
+		}
+		setup := fmt.Sprintf(namespaceSetup, strings.Join(namespaceSystemDirs, " "), strings.Join(namespaceDevices, " "))
+		args = append(args, "sh", "-c", setup, "ecnu-sandbox", s.workspace, state, s.home(), script)
+		cmd = exec.CommandContext(ctx, "unshare", args...)
+	}
+	cmd.Dir = s.workspace
+	cmd.Env = env
+	setProcessGroup(cmd)
+	return cmd, nil
+}
+
+func (s *namespaceSandbox) environ() []string { return os.Environ() }
+
+func (s *namespaceSandbox) isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dir 返回挂载到沙箱中的状态目录，第一次使用时创建
+func (s *namespaceSandbox) dir() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tmp == "" {
+		tmp, err := os.MkdirTemp("", "ecnu-sandbox-*")
+		if err != nil {
+			return "", fmt.Errorf("创建沙箱状态目录失败: %v", err)
+		}
+		s.tmp = tmp
+	}
+	return s.tmp, nil
+}
+
+func (s *namespaceSandbox) stateFile() (string, error) {
+	dir, err := s.dir()
+	if err != nil {
+		return "", err
+	}
+	return localStateFile(dir)
+}
+
+func (s *namespaceSandbox) takeState(path string) []byte { return takeLocalState(path) }
+
+func (s *namespaceSandbox) describe() string {
+	tool := "bwrap"
+	if s.bwrap == "" {
+		tool = "unshare"
+	}
+	network := ""
+	if !s.cfg.SandboxNetwork {
+		network = "，无网络"
+	}
+	return fmt.Sprintf("%s（只能访问工作区%s）", tool, network)
+}
+
+func (s *namespaceSandbox) note() string {
+	return "命令在隔离的沙箱中执行，只能访问工作区和只读的系统目录，主目录和/tmp是空的临时目录，无法安装系统软件包。" + networkNote(s.cfg)
+}
+
+func (s *namespaceSandbox) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tmp != "" {
+		os.RemoveAll(s.tmp)
+		s.tmp = ""
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// newNamespaceSandbox 命名空间沙箱只支持Linux
+func newNamespaceSandbox(cfg *Config, workspace string) (sandbox, error) {
+	return nil, fmt.Errorf("bwrap沙箱只支持Linux，其他系统请使用docker沙箱")
+}
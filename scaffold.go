@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// scaffoldManifest 用户模板目录中描述模板的文件
+const scaffoldManifest = "template.json"
+
+var (
+	scaffoldNamePattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	scaffoldPackagePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// scaffoldProjectTool 从模板创建项目的工具定义
+var scaffoldProjectTool = Tool{
+	Type:       "function",
+	Name:       "scaffold_project",
+	Sequential: true,
+	Description: "从模板创建新项目，一次生成完整的目录结构和文件，变量（项目名称、作者等）会替换到文件名和内容中。内置模板: go-cli（Go命令行程序）、python-package（Python包）、latex-thesis（中文学位论文）、vue-app（Vue 3应用），" +
+		"~/.ecnu-agent/templates下的目录也可作为模板。用户要求新建这类项目时优先使用本工具，而不是逐个write_file。不会覆盖已有文件。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "create"},
+				"description": "list列出可用模板及其变量，create创建项目；提供template时默认为create",
+			},
+			"template": map[string]interface{}{
+				"type":        "string",
+				"description": "模板名称",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "项目目录，默认为工作目录下以项目名称命名的目录",
+			},
+			"variables": map[string]interface{}{
+				"type":        "object",
+				"description": "模板变量，如{\"name\": \"mytool\", \"author\": \"张三\"}，未提供的变量使用默认值",
+				"additionalProperties": map[string]interface{}{
+					"type": "string",
+				},
+			},
+		},
+	},
+}
+
+// scaffoldParams scaffold_project的参数
+type scaffoldParams struct {
+	Action    string            `json:"action"`
+	Template  string            `json:"template"`
+	Path      string            `json:"path"`
+	Variables map[string]string `json:"variables"`
+}
+
+// userTemplateDir 返回用户模板目录
+func userTemplateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "templates")
+}
+
+// loadUserTemplates 读取用户模板目录中的模板，每个子目录是一个模板，其中的template.json可以声明简介、变量和下一步提示
+func loadUserTemplates() []scaffoldTemplate {
+	root := userTemplateDir()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var templates []scaffoldTemplate
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		t := scaffoldTemplate{name: entry.Name(), description: "用户模板", dir: filepath.Join(root, entry.Name())}
+		if data, err := os.ReadFile(filepath.Join(t.dir, scaffoldManifest)); err == nil {
+			var manifest struct {
+				Description string            `json:"description"`
+				Variables   map[string]string `json:"variables"`
+				Next        string            `json:"next"`
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				log.Printf("[项目模板] 忽略%s: %v\n", filepath.Join(t.dir, scaffoldManifest), err)
+				continue
+			}
+			if manifest.Description != "" {
+				t.description = manifest.Description
+			}
+			t.next = manifest.Next
+			names := make([]string, 0, len(manifest.Variables))
+			for name := range manifest.Variables {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				t.vars = append(t.vars, scaffoldVar{name: name, defaultValue: manifest.Variables[name]})
+			}
+		}
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+// findTemplate 按名称查找模板，用户模板优先于同名的内置模板
+func findTemplate(name string) (scaffoldTemplate, bool) {
+	for _, t := range loadUserTemplates() {
+		if t.name == name {
+			return t, true
+		}
+	}
+	for _, t := range builtinTemplates {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return scaffoldTemplate{}, false
+}
+
+// listTemplates 列出全部模板及其变量
+func listTemplates() string {
+	var b strings.Builder
+	b.WriteString("可用的项目模板:\n")
+	user := loadUserTemplates()
+	overridden := make(map[string]bool)
+	for _, t := range user {
+		overridden[t.name] = true
+	}
+	write := func(t scaffoldTemplate) {
+		fmt.Fprintf(&b, "\n%s: %s\n", t.name, t.description)
+		if t.dir != "" {
+			fmt.Fprintf(&b, "  目录: %s\n", t.dir)
+		}
+		for _, v := range t.vars {
+			fmt.Fprintf(&b, "  %s", v.name)
+			if v.description != "" {
+				fmt.Fprintf(&b, " - %s", v.description)
+			}
+			if v.defaultValue != "" {
+				fmt.Fprintf(&b, "（默认%q）", v.defaultValue)
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, t := range builtinTemplates {
+		if !overridden[t.name] {
+			write(t)
+		}
+	}
+	for _, t := range user {
+		write(t)
+	}
+	b.WriteString("\n所有模板都支持的变量:\n")
+	for _, v := range scaffoldCommonVars {
+		fmt.Fprintf(&b, "  %s - %s\n", v.name, v.description)
+	}
+	fmt.Fprintf(&b, "\n文件名和内容中的[[变量名]]会被替换为变量的值，在%s下新建目录即可添加自己的模板。", userTemplateDir())
+	return b.String()
+}
+
+// defaultAuthor 返回git配置中的用户名，没有时使用系统用户名
+func defaultAuthor() string {
+	if out, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return name
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// templateVars 合并用户提供的变量和默认值，并检查变量名和取值
+func templateVars(t scaffoldTemplate, given map[string]string, target string) (map[string]string, error) {
+	known := make(map[string]bool)
+	vars := make(map[string]string)
+	for _, v := range append(append([]scaffoldVar{}, scaffoldCommonVars...), t.vars...) {
+		known[v.name] = true
+		if v.defaultValue != "" {
+			vars[v.name] = v.defaultValue
+		}
+	}
+	for name, value := range given {
+		if !known[name] {
+			names := make([]string, 0, len(known))
+			for k := range known {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("模板%s不支持变量%s，可用的变量: %s", t.name, name, strings.Join(names, ", "))
+		}
+		vars[name] = value
+	}
+
+	if vars["name"] == "" {
+		vars["name"] = filepath.Base(target)
+	}
+	if !scaffoldNamePattern.MatchString(vars["name"]) {
+		return nil, fmt.Errorf("项目名称%q无效，只能包含字母、数字、点、下划线和连字符", vars["name"])
+	}
+	if vars["author"] == "" {
+		vars["author"] = defaultAuthor()
+	}
+	if vars["year"] == "" {
+		vars["year"] = time.Now().Format("2006")
+	}
+	// 由项目名称推导的模板变量
+	derived := map[string]string{
+		"module":  vars["name"],
+		"package": strings.ToLower(strings.NewReplacer("-", "_", ".", "_").Replace(vars["name"])),
+		"title":   vars["name"],
+	}
+	for name, value := range derived {
+		if known[name] && vars[name] == "" {
+			vars[name] = value
+		}
+	}
+	if pkg, ok := vars["package"]; ok && known["package"] && !scaffoldPackagePattern.MatchString(pkg) {
+		return nil, fmt.Errorf("Python包名%q无效，只能包含小写字母、数字和下划线且不以数字开头，请通过package变量指定", pkg)
+	}
+	return vars, nil
+}
+
+// renderTemplate 返回替换变量后的文件列表，用户模板从目录中读取
+func renderTemplate(t scaffoldTemplate, vars map[string]string) ([]scaffoldFile, error) {
+	pairs := make([]string, 0, len(vars)*2)
+	for name, value := range vars {
+		pairs = append(pairs, "[["+name+"]]", value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	files := t.files
+	if t.dir != "" {
+		files = nil
+		err := filepath.WalkDir(t.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(t.dir, path)
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if rel == scaffoldManifest || !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, scaffoldFile{path: filepath.ToSlash(rel), content: string(data), mode: uint32(info.Mode().Perm()), binary: !utf8.Valid(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取模板目录失败: %v", err)
+		}
+	}
+
+	rendered := make([]scaffoldFile, 0, len(files))
+	for _, f := range files {
+		out := scaffoldFile{path: replacer.Replace(f.path), content: f.content, mode: f.mode}
+		if !f.binary {
+			out.content = replacer.Replace(f.content)
+		}
+		if out.mode == 0 {
+			out.mode = 0644
+		}
+		rel := filepath.Clean(filepath.FromSlash(out.path))
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("模板文件%s位于项目目录之外", out.path)
+		}
+		out.path = rel
+		rendered = append(rendered, out)
+	}
+	return rendered, nil
+}
+
+// scaffoldProject 从模板创建项目
+func (a *ECNUAgent) scaffoldProject(args string) (string, error) {
+	var params scaffoldParams
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Action == "" {
+		params.Action = "list"
+		if params.Template != "" {
+			params.Action = "create"
+		}
+	}
+	switch params.Action {
+	case "list":
+		return listTemplates(), nil
+	case "create":
+		if params.Template == "" {
+			return "", fmt.Errorf("create操作缺少template参数")
+		}
+	default:
+		return "", fmt.Errorf("不支持的操作: %s", params.Action)
+	}
+
+	t, ok := findTemplate(params.Template)
+	if !ok {
+		return fmt.Sprintf("创建项目失败: 没有名为%s的模板，可用action为list查看全部模板", params.Template), nil
+	}
+	path := params.Path
+	if path == "" {
+		path = params.Variables["name"]
+	}
+	if path == "" {
+		return "", fmt.Errorf("缺少path参数或name变量")
+	}
+	target := a.resolvePath(path)
+	vars, err := templateVars(t, params.Variables, target)
+	if err != nil {
+		return "", err
+	}
+	files, err := renderTemplate(t, vars)
+	if err != nil {
+		return fmt.Sprintf("创建项目失败: %v", err), nil
+	}
+	log.Printf("[项目模板] %s -> %s (%d个文件)\n", t.name, target, len(files))
+
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		return fmt.Sprintf("创建项目失败: %s已存在且不是目录", target), nil
+	}
+	// 先检查全部文件，避免只创建了一部分
+	var conflicts []string
+	for _, f := range files {
+		if _, err := os.Lstat(filepath.Join(target, f.path)); err == nil {
+			conflicts = append(conflicts, f.path)
+		}
+	}
+	if len(conflicts) > 0 {
+		if len(conflicts) > 10 {
+			conflicts = append(conflicts[:10], fmt.Sprintf("...（共%d个）", len(conflicts)))
+		}
+		return fmt.Sprintf("创建项目失败: %s中已存在以下文件，为避免覆盖未做任何修改: %s。请换一个目录，或询问用户是否删除这些文件。", target, strings.Join(conflicts, ", ")), nil
+	}
+
+	var b strings.Builder
+	created := 0
+	for _, f := range files {
+		fullPath := filepath.Join(target, f.path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Sprintf("创建项目失败: 已创建%d个文件，创建目录失败: %v", created, err), nil
+		}
+		change, err := a.snapshotFile(fullPath)
+		if err != nil {
+			return fmt.Sprintf("创建项目失败: 已创建%d个文件: %v", created, err), nil
+		}
+		if err := os.WriteFile(fullPath, []byte(f.content), fs.FileMode(f.mode)); err != nil {
+			return fmt.Sprintf("创建项目失败: 已创建%d个文件，写入%s失败: %v", created, f.path, err), nil
+		}
+		a.undo.record(change)
+		a.activity.addFile(fullPath)
+		created++
+		fmt.Fprintf(&b, "  %s\n", filepath.ToSlash(f.path))
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	settings := make([]string, 0, len(names))
+	for _, name := range names {
+		settings = append(settings, fmt.Sprintf("%s=%q", name, vars[name]))
+	}
+	result := fmt.Sprintf("已使用模板%s在%s创建%d个文件:\n%s变量: %s", t.name, target, created, b.String(), strings.Join(settings, ", "))
+	if t.next != "" {
+		next := strings.ReplaceAll(t.next, "[[name]]", path)
+		for _, name := range names {
+			next = strings.ReplaceAll(next, "[["+name+"]]", vars[name])
+		}
+		result += "\n下一步: " + next
+	}
+	return result, nil
+}
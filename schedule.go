@@ -0,0 +1,687 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	scheduleDefaultProfile = "readonly"
+	scheduleDefaultTimeout = 30  // 每次运行默认的时间上限（分钟）
+	scheduleKeepRuns       = 100 // 每个任务保留的运行记录数
+	schedulePreviewRunes   = 60  // 列表中回答和提示词预览的长度
+)
+
+// 一次运行的结果
+const (
+	runSuccess     = "success"
+	runFailed      = "failed"
+	runTimeout     = "timeout"
+	runInterrupted = "interrupted"
+)
+
+// scheduleNamePattern 任务名，同时用作运行记录的目录名
+var scheduleNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-]*$`)
+
+// scheduleProfiles 定时任务可选的策略预设，对应启动Agent时的参数。定时任务在后台运行，
+// 需要确认的操作无法询问用户，预设决定了这些操作直接通过还是被拒绝
+var scheduleProfiles = map[string][]string{
+	// 只执行内置的只读命令和策略文件中允许的命令，其他命令和需要确认的操作都会被拒绝
+	"readonly": {"--auto-approve=false", "--command-default=deny"},
+	// 直接执行未匹配规则的命令，危险命令、覆盖和删除文件等操作仍然被拒绝
+	"safe": {"--auto-approve=safe"},
+	// 直接通过所有需要确认的操作，只有命令策略中拒绝的命令不会执行
+	"full": {"--auto-approve=all"},
+}
+
+// scheduleJob 一个定时执行的提示词
+type scheduleJob struct {
+	Name       string    `json:"name"`
+	Spec       string    `json:"spec"` // cron表达式
+	Prompt     string    `json:"prompt"`
+	Profile    string    `json:"profile"`
+	Args       []string  `json:"args,omitempty"` // 额外的Agent参数，在预设之后生效
+	WorkingDir string    `json:"working_dir"`
+	Timeout    int       `json:"timeout"` // 每次运行的时间上限（分钟）
+	Paused     bool      `json:"paused,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+// scheduleRun 一次运行的记录
+type scheduleRun struct {
+	ID       string    `json:"id"`
+	Job      string    `json:"job"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Answer   string    `json:"answer,omitempty"`
+	Usage    string    `json:"usage,omitempty"`
+	Log      string    `json:"log"` // 运行过程的日志文件
+}
+
+// scheduleStore 把任务定义保存在 <目录>/jobs.json，每次运行的记录保存在 <目录>/runs/<任务名>/
+type scheduleStore struct {
+	dir string
+}
+
+// defaultScheduleDir 返回定时任务的默认目录
+func defaultScheduleDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ecnu-agent", "schedules")
+}
+
+// agentArgs 返回运行任务时的Agent参数：预设在前，任务中的额外参数可以覆盖预设
+func (j scheduleJob) agentArgs() []string {
+	args := append([]string{}, scheduleProfiles[j.Profile]...)
+	args = append(args, "--workspace", j.WorkingDir, "--no-persist", "--no-stream", "--no-live-output")
+	return append(args, j.Args...)
+}
+
+// load 读取全部任务，文件不存在时返回空列表
+func (s *scheduleStore) load() ([]scheduleJob, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "jobs.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取定时任务失败: %v", err)
+	}
+	var jobs []scheduleJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("解析定时任务失败: %v", err)
+	}
+	return jobs, nil
+}
+
+// save 写入全部任务
+func (s *scheduleStore) save(jobs []scheduleJob) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("创建定时任务目录失败: %v", err)
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, "jobs.json"), append(data, '\n'), 0600)
+}
+
+// find 返回指定名称的任务
+func (s *scheduleStore) find(name string) (scheduleJob, error) {
+	jobs, err := s.load()
+	if err != nil {
+		return scheduleJob{}, err
+	}
+	for _, job := range jobs {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return scheduleJob{}, fmt.Errorf("没有名为%s的定时任务", name)
+}
+
+// runsDir 返回任务的运行记录目录
+func (s *scheduleStore) runsDir(name string) string {
+	return filepath.Join(s.dir, "runs", name)
+}
+
+// runs 返回任务的运行记录，按时间从早到晚排列
+func (s *scheduleStore) runs(name string) ([]scheduleRun, error) {
+	entries, err := os.ReadDir(s.runsDir(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取运行记录失败: %v", err)
+	}
+	var runs []scheduleRun
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.runsDir(name), entry.Name()))
+		if err != nil {
+			continue
+		}
+		var run scheduleRun
+		if json.Unmarshal(data, &run) == nil {
+			runs = append(runs, run)
+		}
+	}
+	slices.SortFunc(runs, func(a, b scheduleRun) int { return a.Started.Compare(b.Started) })
+	return runs, nil
+}
+
+// record 保存运行记录，并删除超出保留数量的旧记录和日志
+func (s *scheduleStore) record(run scheduleRun) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.runsDir(run.Job), run.ID+".json"), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("保存运行记录失败: %v", err)
+	}
+	runs, err := s.runs(run.Job)
+	if err != nil {
+		return err
+	}
+	for _, old := range runs[:max(0, len(runs)-scheduleKeepRuns)] {
+		os.Remove(filepath.Join(s.runsDir(run.Job), old.ID+".json"))
+		os.Remove(old.Log)
+	}
+	return nil
+}
+
+// execute 在当前进程中无人值守地运行一次任务，运行期间的日志和输出写入该次运行的日志文件
+func (s *scheduleStore) execute(ctx context.Context, job scheduleJob) scheduleRun {
+	run := scheduleRun{ID: time.Now().Format("20060102-150405"), Job: job.Name, Started: time.Now()}
+	log.Printf("[定时] 开始运行 %s\n", job.Name)
+	finish := func(status string, err error) scheduleRun {
+		run.Finished, run.Status = time.Now(), status
+		if err != nil {
+			run.Error = err.Error()
+		}
+		if err := s.record(run); err != nil {
+			log.Printf("[定时] %v\n", err)
+		}
+		log.Printf("[定时] %s 运行结束: %s，用时%s\n", job.Name, status, run.Finished.Sub(run.Started).Round(time.Second))
+		return run
+	}
+
+	if err := os.MkdirAll(s.runsDir(job.Name), 0700); err != nil {
+		return finish(runFailed, fmt.Errorf("创建运行记录目录失败: %v", err))
+	}
+	run.Log = filepath.Join(s.runsDir(job.Name), run.ID+".log")
+	logFile, err := os.OpenFile(run.Log, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return finish(runFailed, fmt.Errorf("创建日志文件失败: %v", err))
+	}
+	defer logFile.Close()
+
+	// 任务依次运行，运行期间把日志和标准输出都转到日志文件
+	prevLog, prevStdout := log.Writer(), os.Stdout
+	log.SetOutput(logFile)
+	os.Stdout = logFile
+	status, err := s.runAgent(ctx, job, &run)
+	log.SetOutput(prevLog)
+	os.Stdout = prevStdout
+	return finish(status, err)
+}
+
+// runAgent 按任务的参数创建Agent并执行提示词，结果写入run
+func (s *scheduleStore) runAgent(ctx context.Context, job scheduleJob, run *scheduleRun) (string, error) {
+	log.Printf("[定时] 任务 %s，策略预设 %s，参数 %s\n", job.Name, job.Profile, strings.Join(job.agentArgs(), " "))
+	cfg, err := loadConfig(job.agentArgs())
+	if err != nil {
+		return runFailed, fmt.Errorf("加载配置失败: %v", err)
+	}
+	agent, err := NewECNUAgent("", cfg)
+	if err != nil {
+		return runFailed, fmt.Errorf("初始化Agent失败: %v", err)
+	}
+	defer agent.recorder.Close()
+	defer agent.sandbox.close()
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(job.Timeout)*time.Minute)
+	defer cancel()
+	err = agent.ProcessUserInput(runCtx, job.Prompt)
+	run.Answer = agent.finalAnswer()
+	run.Usage = formatStats(agent.usage.turnStats())
+	log.Printf("[用量] %s\n", run.Usage)
+	switch {
+	case ctx.Err() != nil:
+		return runInterrupted, err
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		return runTimeout, fmt.Errorf("超过%d分钟的时间上限", job.Timeout)
+	case err != nil:
+		return runFailed, err
+	}
+	return runSuccess, nil
+}
+
+// daemon 持续运行，在每个任务的下一次执行时间到达时运行它，收到SIGINT或SIGTERM时退出。
+// 任务定义每分钟重新读取一次，错过的执行时间不会补做
+func (s *scheduleStore) daemon(ctx context.Context) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	log.Printf("[定时] 守护进程已启动（PID %d），任务定义: %s\n", os.Getpid(), filepath.Join(s.dir, "jobs.json"))
+
+	type plan struct {
+		spec string
+		next time.Time
+	}
+	plans := map[string]plan{}
+	for {
+		jobs, err := s.load()
+		if err != nil {
+			log.Printf("[定时] %v\n", err)
+		}
+		now := time.Now()
+		seen := map[string]bool{}
+		for _, job := range jobs {
+			seen[job.Name] = true
+			if job.Paused {
+				delete(plans, job.Name)
+				continue
+			}
+			p, ok := plans[job.Name]
+			if !ok || p.spec != job.Spec {
+				// 新增、恢复或修改了执行时间的任务从现在开始计算
+				spec, err := parseCron(job.Spec)
+				if err != nil {
+					log.Printf("[定时] 跳过任务 %s: %v\n", job.Name, err)
+					continue
+				}
+				plans[job.Name] = plan{job.Spec, spec.next(now)}
+				log.Printf("[定时] %s 下次运行于 %s\n", job.Name, formatScheduleTime(plans[job.Name].next))
+				continue
+			}
+			if p.next.IsZero() || now.Before(p.next) {
+				continue
+			}
+			s.execute(ctx, job)
+			if ctx.Err() != nil {
+				return nil
+			}
+			// 运行期间错过的执行时间跳过，从运行结束时重新计算
+			spec, _ := parseCron(job.Spec)
+			plans[job.Name] = plan{job.Spec, spec.next(time.Now())}
+			log.Printf("[定时] %s 下次运行于 %s\n", job.Name, formatScheduleTime(plans[job.Name].next))
+		}
+		for name := range plans {
+			if !seen[name] {
+				delete(plans, name)
+			}
+		}
+
+		// 在下一分钟开始时再检查
+		wait := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))
+		select {
+		case <-ctx.Done():
+			log.Printf("[定时] 守护进程已退出\n")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// lock 记录守护进程的PID，避免同时运行两个守护进程使任务重复执行
+func (s *scheduleStore) lock() (func(), error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建定时任务目录失败: %v", err)
+	}
+	path := filepath.Join(s.dir, "daemon.pid")
+	if data, err := os.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && processAlive(pid) {
+			return nil, fmt.Errorf("已有守护进程在运行（PID %d），如果确认没有，请删除%s", pid, path)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("写入%s失败: %v", path, err)
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// formatScheduleTime 格式化执行时间，找不到下一次执行时间时说明原因
+func formatScheduleTime(t time.Time) string {
+	if t.IsZero() {
+		return "不会再运行"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// scheduleUsage schedule子命令的用法
+const scheduleUsage = `用法: chatecnu-agent schedule [--dir 目录] <命令> [参数]
+
+命令:
+  add [选项] <任务名> <提示词> [-- Agent参数]   添加定时任务，提示词为-时从标准输入读取
+      --cron 表达式    执行时间，5字段cron表达式（分 时 日 月 星期），如"0 8 * * *"，
+                       也可以使用@daily、@hourly或"@every 30m"
+      --profile 预设   策略预设：readonly（默认，只执行只读命令）、safe（直接执行未匹配规则的命令）、
+                       full（直接通过所有需要确认的操作）
+      --workspace 目录 任务的工作目录，默认为当前目录
+      --timeout 分钟   每次运行的时间上限，默认30
+  list                         列出任务、下次运行时间和最近一次结果
+  remove <任务名>              删除任务及其运行记录
+  pause <任务名>               暂停任务
+  resume <任务名>              恢复任务
+  run <任务名>                 立即运行一次任务
+  history <任务名> [-n 条数]   列出最近的运行记录
+  show <任务名> [运行ID]       显示一次运行的结果，默认为最近一次
+  daemon                       在前台运行守护进程，按时执行任务
+
+任务定义和运行记录默认保存在~/.ecnu-agent/schedules，可以用--dir或ECNU_AGENT_SCHEDULE_DIR指定。
+`
+
+// scheduleCommand 执行schedule子命令
+func scheduleCommand(args []string) error {
+	fs := flag.NewFlagSet("chatecnu-agent schedule", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), scheduleUsage) }
+	dir := fs.String("dir", os.Getenv("ECNU_AGENT_SCHEDULE_DIR"), "定时任务目录")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	store := &scheduleStore{dir: *dir}
+	if store.dir == "" {
+		store.dir = defaultScheduleDir()
+	}
+
+	command, rest := "list", []string(nil)
+	if fs.NArg() > 0 {
+		command, rest = fs.Arg(0), fs.Args()[1:]
+	}
+	needName := func() (string, error) {
+		if len(rest) == 0 {
+			return "", fmt.Errorf("%s需要任务名，运行 chatecnu-agent schedule list 查看已有的任务", command)
+		}
+		return rest[0], nil
+	}
+
+	switch command {
+	case "add":
+		return store.addCommand(rest)
+	case "list":
+		return store.listCommand()
+	case "history":
+		return store.historyCommand(rest)
+	case "daemon":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return store.daemon(ctx)
+	case "remove", "pause", "resume", "run", "show":
+		name, err := needName()
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "remove":
+			return store.removeCommand(name)
+		case "pause", "resume":
+			return store.pauseCommand(name, command == "pause")
+		case "run":
+			return store.runCommand(name)
+		}
+		return store.showCommand(name, rest[1:])
+	case "help":
+		fmt.Print(scheduleUsage)
+		return nil
+	}
+	return fmt.Errorf("未知的命令: %s\n%s", command, scheduleUsage)
+}
+
+// addCommand 解析参数并添加任务
+func (s *scheduleStore) addCommand(args []string) error {
+	fs := flag.NewFlagSet("chatecnu-agent schedule add", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), scheduleUsage) }
+	spec := fs.String("cron", "", "执行时间")
+	profile := fs.String("profile", scheduleDefaultProfile, "策略预设")
+	workspace := fs.String("workspace", "", "工作目录")
+	timeout := fs.Int("timeout", scheduleDefaultTimeout, "每次运行的时间上限（分钟）")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	rest := fs.Args()
+	var agentArgs []string
+	if i := slices.Index(rest, "--"); i >= 0 {
+		rest, agentArgs = rest[:i], rest[i+1:]
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("需要任务名和提示词，例如: schedule add --cron \"0 8 * * *\" disk-check \"检查/data的磁盘使用率\"")
+	}
+
+	job := scheduleJob{
+		Name:    rest[0],
+		Spec:    strings.TrimSpace(*spec),
+		Prompt:  strings.TrimSpace(strings.Join(rest[1:], " ")),
+		Profile: *profile,
+		Args:    agentArgs,
+		Timeout: *timeout,
+		Created: time.Now(),
+	}
+	if job.Prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("读取提示词失败: %v", err)
+		}
+		job.Prompt = strings.TrimSpace(string(data))
+	}
+	switch {
+	case !scheduleNamePattern.MatchString(job.Name):
+		return fmt.Errorf("任务名%q只能包含字母、数字、下划线、点和连字符", job.Name)
+	case job.Spec == "":
+		return fmt.Errorf("需要用--cron指定执行时间，如--cron \"0 8 * * *\"表示每天8点")
+	case job.Prompt == "":
+		return fmt.Errorf("提示词不能为空")
+	case scheduleProfiles[job.Profile] == nil:
+		return fmt.Errorf("未知的策略预设%q，可选: readonly、safe、full", job.Profile)
+	case job.Timeout < 1:
+		return fmt.Errorf("timeout必须大于0，当前为%d", job.Timeout)
+	}
+	cron, err := parseCron(job.Spec)
+	if err != nil {
+		return err
+	}
+	next := cron.next(time.Now())
+	if next.IsZero() {
+		return fmt.Errorf("cron表达式%q在%d年内都不会触发", job.Spec, cronSearchYears)
+	}
+
+	dir := *workspace
+	if dir == "" {
+		dir = "."
+	}
+	if job.WorkingDir, err = filepath.Abs(dir); err != nil {
+		return fmt.Errorf("解析工作目录失败: %v", err)
+	}
+	if err := checkDirExists(job.WorkingDir); err != nil {
+		return fmt.Errorf("工作目录不可用: %v", err)
+	}
+	// 提前检查额外的Agent参数，避免到运行时才发现写错
+	if _, err := loadConfig(job.agentArgs()); err != nil {
+		return fmt.Errorf("Agent参数无效: %v", err)
+	}
+
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(jobs, func(j scheduleJob) bool { return j.Name == job.Name }) {
+		return fmt.Errorf("已有名为%s的任务，请换一个名称或先删除", job.Name)
+	}
+	if err := s.save(append(jobs, job)); err != nil {
+		return err
+	}
+	fmt.Printf("已添加定时任务 %s，下次运行于 %s（策略预设: %s）\n", job.Name, formatScheduleTime(next), job.Profile)
+	fmt.Println("任务由守护进程执行，请确认已在后台运行 chatecnu-agent schedule daemon")
+	return nil
+}
+
+// listCommand 列出全部任务
+func (s *scheduleStore) listCommand() error {
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("没有定时任务，使用 chatecnu-agent schedule add 添加")
+		return nil
+	}
+	rows := make([][]string, len(jobs))
+	for i, job := range jobs {
+		next := "已暂停"
+		if !job.Paused {
+			if cron, err := parseCron(job.Spec); err != nil {
+				next = "表达式无效"
+			} else {
+				next = formatScheduleTime(cron.next(time.Now()))
+			}
+		}
+		last, status := "-", "-"
+		if runs, _ := s.runs(job.Name); len(runs) > 0 {
+			run := runs[len(runs)-1]
+			last, status = run.Started.Format("2006-01-02 15:04"), run.Status
+		}
+		rows[i] = []string{job.Name, job.Spec, job.Profile, next, last, status, truncateRunes(firstLine(job.Prompt), schedulePreviewRunes)}
+	}
+	fmt.Print(formatTableRows([]string{"NAME", "SCHEDULE", "PROFILE", "NEXT RUN", "LAST RUN", "STATUS", "PROMPT"}, rows))
+	return nil
+}
+
+// removeCommand 删除任务及其运行记录
+func (s *scheduleStore) removeCommand(name string) error {
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(jobs, func(j scheduleJob) bool { return j.Name == name })
+	if i < 0 {
+		return fmt.Errorf("没有名为%s的定时任务", name)
+	}
+	if err := s.save(slices.Delete(jobs, i, i+1)); err != nil {
+		return err
+	}
+	os.RemoveAll(s.runsDir(name))
+	fmt.Printf("已删除定时任务 %s\n", name)
+	return nil
+}
+
+// pauseCommand 暂停或恢复任务
+func (s *scheduleStore) pauseCommand(name string, paused bool) error {
+	jobs, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(jobs, func(j scheduleJob) bool { return j.Name == name })
+	if i < 0 {
+		return fmt.Errorf("没有名为%s的定时任务", name)
+	}
+	jobs[i].Paused = paused
+	if err := s.save(jobs); err != nil {
+		return err
+	}
+	if paused {
+		fmt.Printf("已暂停定时任务 %s\n", name)
+	} else {
+		fmt.Printf("已恢复定时任务 %s\n", name)
+	}
+	return nil
+}
+
+// runCommand 立即运行一次任务并显示结果
+func (s *scheduleStore) runCommand(name string) error {
+	job, err := s.find(name)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	printScheduleRun(s.execute(ctx, job))
+	return nil
+}
+
+// historyCommand 列出任务最近的运行记录
+func (s *scheduleStore) historyCommand(args []string) error {
+	fs := flag.NewFlagSet("chatecnu-agent schedule history", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "显示的条数")
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		// 任务名可以写在选项之前
+		args = append(args[1:], args[0])
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("history需要任务名")
+	}
+	job, err := s.find(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	runs, err := s.runs(job.Name)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Printf("任务 %s 还没有运行过\n", job.Name)
+		return nil
+	}
+	runs = runs[max(0, len(runs)-*limit):]
+	rows := make([][]string, len(runs))
+	for i, run := range runs {
+		summary := run.Answer
+		if run.Error != "" {
+			summary = run.Error
+		}
+		rows[i] = []string{run.ID, run.Started.Format("2006-01-02 15:04:05"), run.Finished.Sub(run.Started).Round(time.Second).String(), run.Status, truncateRunes(firstLine(summary), schedulePreviewRunes)}
+	}
+	fmt.Print(formatTableRows([]string{"RUN", "STARTED", "DURATION", "STATUS", "RESULT"}, rows))
+	return nil
+}
+
+// showCommand 显示一次运行的完整结果
+func (s *scheduleStore) showCommand(name string, args []string) error {
+	runs, err := s.runs(name)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("任务 %s 没有运行记录", name)
+	}
+	run := runs[len(runs)-1]
+	if len(args) > 0 {
+		i := slices.IndexFunc(runs, func(r scheduleRun) bool { return r.ID == args[0] })
+		if i < 0 {
+			return fmt.Errorf("任务 %s 没有ID为%s的运行记录", name, args[0])
+		}
+		run = runs[i]
+	}
+	printScheduleRun(run)
+	return nil
+}
+
+// printScheduleRun 输出一次运行的结果
+func printScheduleRun(run scheduleRun) {
+	fmt.Printf("任务: %s  运行: %s\n", run.Job, run.ID)
+	fmt.Printf("状态: %s  开始: %s  用时: %s\n", run.Status, run.Started.Format("2006-01-02 15:04:05"), run.Finished.Sub(run.Started).Round(time.Second))
+	if run.Usage != "" {
+		fmt.Printf("用量: %s\n", run.Usage)
+	}
+	if run.Error != "" {
+		fmt.Printf("错误: %s\n", run.Error)
+	}
+	if run.Log != "" {
+		fmt.Printf("日志: %s\n", run.Log)
+	}
+	if run.Answer != "" {
+		fmt.Printf("\n%s\n", run.Answer)
+	}
+}
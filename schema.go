@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// schemaFailureWarn 同一工具连续校验失败达到该次数时提示模型检查工具定义
+const schemaFailureWarn = 3
+
+// schemaProblem 一处参数校验错误
+type schemaProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// validationResult 参数校验失败时返回给模型的结构化结果
+type validationResult struct {
+	Error    string          `json:"error"`
+	Tool     string          `json:"tool"`
+	Problems []schemaProblem `json:"problems"`
+	Failures int             `json:"consecutive_failures"`
+	Hint     string          `json:"hint"`
+}
+
+// schemaTracker 记录各工具连续参数校验失败的次数
+type schemaTracker struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// fail 记录一次失败并返回连续失败次数
+func (t *schemaTracker) fail(tool string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failures == nil {
+		t.failures = make(map[string]int)
+	}
+	t.failures[tool]++
+	return t.failures[tool]
+}
+
+// succeed 清除工具的失败计数
+func (t *schemaTracker) succeed(tool string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, tool)
+}
+
+// checkToolArguments 按工具声明的JSON Schema校验参数，失败时返回结构化错误文本
+func (a *ECNUAgent) checkToolArguments(tool Tool, args string) (string, bool) {
+	problems := validateArguments(tool.Parameters, args)
+	if len(problems) == 0 {
+		a.schemaFailures.succeed(tool.Name)
+		return "", true
+	}
+
+	failures := a.schemaFailures.fail(tool.Name)
+	log.Printf("[校验] %s 参数不符合定义（连续%d次）: %s\n", tool.Name, failures, problems[0].Message)
+
+	hint := "请根据problems修正参数后重新调用该工具，参数必须是符合工具定义的JSON对象。"
+	if failures >= schemaFailureWarn {
+		hint = fmt.Sprintf("该工具已连续%d次参数错误。请仔细核对工具定义中的参数名、类型和必填项，或改用其他方法完成任务。", failures)
+	}
+
+	data, _ := json.Marshal(validationResult{
+		Error:    "invalid_arguments",
+		Tool:     tool.Name,
+		Problems: problems,
+		Failures: failures,
+		Hint:     hint,
+	})
+	return string(data), false
+}
+
+// validateArguments 解析JSON参数并按Schema校验
+func validateArguments(schema map[string]interface{}, args string) []schemaProblem {
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(args), &value); err != nil {
+		return []schemaProblem{{Path: "$", Message: fmt.Sprintf("参数不是合法的JSON: %v", err)}}
+	}
+	if schema == nil {
+		return nil
+	}
+
+	var problems []schemaProblem
+	validateValue(schema, value, "$", &problems)
+	return problems
+}
+
+// validateValue 校验单个值，支持type、properties、required、items、enum、minimum和maximum
+func validateValue(schema map[string]interface{}, value interface{}, path string, problems *[]schemaProblem) {
+	add := func(format string, args ...interface{}) {
+		*problems = append(*problems, schemaProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if typ, ok := schema["type"].(string); ok && !matchesType(typ, value) {
+		add("类型应为%s，实际为%s", typ, jsonType(value))
+		return
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		if !enumContains(enum, value) {
+			add("取值应为%v之一", enum)
+		}
+	}
+
+	if n, ok := value.(float64); ok {
+		if min, ok := toFloat(schema["minimum"]); ok && n < min {
+			add("取值不能小于%g", min)
+		}
+		if max, ok := toFloat(schema["maximum"]); ok && n > max {
+			add("取值不能大于%g", max)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		for _, name := range toStrings(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, schemaProblem{Path: path + "." + name, Message: "缺少必填参数"})
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propSchema, known := props[name].(map[string]interface{})
+			if !known {
+				if props != nil {
+					*problems = append(*problems, schemaProblem{Path: path + "." + name, Message: "未定义的参数"})
+				}
+				continue
+			}
+			validateValue(propSchema, v[name], path+"."+name, problems)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+// matchesType 判断值是否符合JSON Schema类型
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// jsonType 返回值的JSON类型名称
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// enumContains 判断值是否在枚举列表中
+func enumContains(enum interface{}, value interface{}) bool {
+	switch list := enum.(type) {
+	case []string:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if item == s {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range list {
+			if fmt.Sprint(item) == fmt.Sprint(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toStrings 将Schema中的字符串列表统一转换为[]string
+func toStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// toFloat 将Schema中的数值统一转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	searchDefaultContext = 2                // search_content默认的上下文行数
+	searchMaxContext     = 10               // 上下文行数的上限
+	searchDefaultMatches = 100              // 默认的最大匹配数
+	searchMaxFileSize    = 10 * 1024 * 1024 // 内置实现跳过超过该大小的文件
+	searchLineWidth      = 300              // 结果中单行的最大字符数
+)
+
+// searchContentTool 按正则表达式搜索文件内容的工具定义
+var searchContentTool = Tool{
+	Type:        "function",
+	Name:        "search_content",
+	Cacheable:   true,
+	Description: "按正则表达式在目录下的文件内容中搜索，返回\"文件:行号: 内容\"形式的匹配及上下文。安装了ripgrep时使用rg（遵循.gitignore），否则使用内置实现；默认跳过二进制文件、隐藏文件和.git、node_modules等目录。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "要搜索的正则表达式（RE2语法），literal为true时按普通字符串匹配",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "搜索的目录或文件，默认为当前工作目录",
+				"default":     ".",
+			},
+			"glob": map[string]interface{}{
+				"type":        "string",
+				"description": "只搜索匹配该glob的文件，如*.go、src/**/*.py",
+			},
+			"literal": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否按普通字符串匹配，默认false",
+				"default":     false,
+			},
+			"ignore_case": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否忽略大小写，默认false",
+				"default":     false,
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": "每处匹配前后显示的行数，默认2，最多10",
+				"minimum":     0,
+				"maximum":     searchMaxContext,
+			},
+			"max_matches": map[string]interface{}{
+				"type":        "integer",
+				"description": "最多返回的匹配行数，默认100",
+				"minimum":     1,
+			},
+			"include_hidden": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否搜索隐藏文件和默认跳过的目录，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"pattern"},
+	},
+}
+
+// searchParams search_content的参数
+type searchParams struct {
+	Pattern       string `json:"pattern"`
+	Path          string `json:"path"`
+	Glob          string `json:"glob"`
+	Literal       bool   `json:"literal"`
+	IgnoreCase    bool   `json:"ignore_case"`
+	Context       int    `json:"context"`
+	MaxMatches    int    `json:"max_matches"`
+	IncludeHidden bool   `json:"include_hidden"`
+}
+
+// searchLine 结果中的一行，match为false时是上下文
+type searchLine struct {
+	number int
+	text   string
+	match  bool
+}
+
+// searchResults 按文件收集搜索结果，匹配数达到上限后停止
+type searchResults struct {
+	limit     int
+	matches   int
+	files     []string
+	lines     map[string][]searchLine
+	truncated bool
+}
+
+// add 添加一行结果，返回false表示已达到匹配上限
+func (r *searchResults) add(file string, line searchLine) bool {
+	if line.match {
+		if r.matches >= r.limit {
+			r.truncated = true
+			return false
+		}
+		r.matches++
+	}
+	if _, ok := r.lines[file]; !ok {
+		r.files = append(r.files, file)
+	}
+	r.lines[file] = append(r.lines[file], line)
+	return true
+}
+
+// format 按grep -n -C的格式输出结果，匹配行为"文件:行号:"，上下文为"文件-行号-"
+func (r *searchResults) format() string {
+	var b strings.Builder
+	for i, file := range r.files {
+		if i > 0 {
+			b.WriteString("--\n")
+		}
+		last := 0
+		for _, line := range r.lines[file] {
+			// 匹配达到上限时可能多出之后的上下文行
+			if last > 0 && line.number > last+1 {
+				b.WriteString("--\n")
+			}
+			sep := "-"
+			if line.match {
+				sep = ":"
+			}
+			fmt.Fprintf(&b, "%s%s%d%s %s\n", file, sep, line.number, sep, truncateRunes(line.text, searchLineWidth))
+			last = line.number
+		}
+	}
+	return b.String()
+}
+
+// searchContent 在文件内容中搜索正则表达式，优先使用ripgrep
+func (a *ECNUAgent) searchContent(ctx context.Context, args string) (string, error) {
+	params := searchParams{Path: ".", Context: searchDefaultContext, MaxMatches: searchDefaultMatches}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Pattern == "" {
+		return "", fmt.Errorf("pattern参数不能为空")
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+	if params.Context > searchMaxContext {
+		params.Context = searchMaxContext
+	}
+
+	expr := params.Pattern
+	if params.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if params.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Sprintf("搜索失败: 正则表达式无效: %v", err), nil
+	}
+
+	root := a.resolvePath(params.Path)
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Sprintf("搜索失败: %v", err), nil
+	}
+
+	results := &searchResults{limit: params.MaxMatches, lines: make(map[string][]searchLine)}
+	engine := "rg"
+	if rg, err := exec.LookPath("rg"); err == nil {
+		err = ripgrepSearch(ctx, rg, root, params, results)
+		if err != nil {
+			return fmt.Sprintf("搜索失败: %v", err), nil
+		}
+	} else {
+		engine = "内置"
+		builtinSearch(ctx, root, info.IsDir(), re, params, results)
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	log.Printf("[搜索内容] %s (模式: %q, 引擎: %s, 匹配: %d)\n", root, params.Pattern, engine, results.matches)
+
+	if results.matches == 0 {
+		return fmt.Sprintf("在%s中没有找到匹配 %q 的内容", root, params.Pattern), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "在%s中找到%d处匹配（%d个文件）:\n", root, results.matches, len(results.files))
+	b.WriteString(results.format())
+	if results.truncated {
+		fmt.Fprintf(&b, "...（匹配超过%d处，已停止搜索，请缩小范围或增加max_matches）\n", params.MaxMatches)
+	}
+	return b.String(), nil
+}
+
+// ripgrepSearch 使用rg --json搜索并解析结果，rg的退出码1表示没有匹配
+func ripgrepSearch(ctx context.Context, rg, root string, params searchParams, results *searchResults) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := []string{"--json", "-C", fmt.Sprint(params.Context)}
+	if params.Literal {
+		args = append(args, "-F")
+	}
+	if params.IgnoreCase {
+		args = append(args, "-i")
+	}
+	if params.IncludeHidden {
+		args = append(args, "--hidden", "--no-ignore")
+	}
+	if params.Glob != "" {
+		args = append(args, "-g", params.Glob)
+	}
+	args = append(args, "-e", params.Pattern, root)
+
+	cmd := exec.CommandContext(ctx, rg, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("启动rg失败: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动rg失败: %v", err)
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Path struct {
+				Text string `json:"text"`
+			} `json:"path"`
+			Lines struct {
+				Text string `json:"text"`
+			} `json:"lines"`
+			LineNumber int `json:"line_number"`
+		} `json:"data"`
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	stopped := false
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if event.Type != "match" && event.Type != "context" {
+			continue
+		}
+		line := searchLine{number: event.Data.LineNumber, text: strings.TrimRight(event.Data.Lines.Text, "\r\n"), match: event.Type == "match"}
+		if !results.add(relativeTo(root, event.Data.Path.Text), line) {
+			stopped = true
+			cancel()
+			break
+		}
+	}
+
+	err = cmd.Wait()
+	if stopped {
+		return nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("rg执行失败: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// builtinSearch 未安装rg时的内置搜索实现，会识别GBK等编码
+func builtinSearch(ctx context.Context, root string, isDir bool, re *regexp.Regexp, params searchParams, results *searchResults) {
+	searchFile := func(p, rel string) bool {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return true
+		}
+		text, _, ok := decodeText(data)
+		if !ok {
+			return true
+		}
+		lines := splitLines(strings.ReplaceAll(text, "\r\n", "\n"))
+		// emitted为已输出的最后一行，避免相邻匹配的上下文重复
+		emitted := 0
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			for j := max(i-params.Context, emitted); j < i; j++ {
+				results.add(rel, searchLine{number: j + 1, text: lines[j]})
+			}
+			if !results.add(rel, searchLine{number: i + 1, text: line, match: true}) {
+				return false
+			}
+			end := min(i+params.Context+1, len(lines))
+			for j := i + 1; j < end; j++ {
+				if re.MatchString(lines[j]) {
+					end = j
+					break
+				}
+				results.add(rel, searchLine{number: j + 1, text: lines[j]})
+			}
+			emitted = end
+		}
+		return true
+	}
+
+	if !isDir {
+		searchFile(root, filepath.Base(root))
+		return
+	}
+	// 与rg一致，不包含隐藏文件时同时遵循各级目录的.gitignore
+	rules := map[string]ignoreRules{}
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if p == root {
+			if !params.IncludeHidden {
+				rules[p] = ignoreRules(nil).withDir(p, "")
+			}
+			return nil
+		}
+		rel := relativeTo(root, p)
+		if !params.IncludeHidden {
+			parent := rules[filepath.Dir(p)]
+			if strings.HasPrefix(d.Name(), ".") || (d.IsDir() && skippedDirs[d.Name()]) || parent.ignored(rel, d.IsDir()) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				rules[p] = parent.withDir(p, rel)
+			}
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if params.Glob != "" && !matchGlobPath(params.Glob, rel) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > searchMaxFileSize {
+			return nil
+		}
+		if !searchFile(p, rel) {
+			return errStopWalk
+		}
+		return nil
+	})
+}
+
+// matchGlobPath 用glob匹配相对路径，模式不含/时只匹配文件名
+func matchGlobPath(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchGlob(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// relativeTo 返回p相对root的路径，无法计算时原样返回
+func relativeTo(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		return filepath.Base(p)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	serviceTimeout     = 90 * time.Second // 单次systemctl调用的时间上限
+	serviceSettle      = 2 * time.Second  // 启动或重启后等待服务状态稳定的时间
+	serviceDefaultLogs = 50               // logs默认返回的日志行数
+	serviceMaxLogs     = 1000             // logs最多返回的日志行数
+	serviceStatusLogs  = 10               // status和操作失败时附带的日志行数
+)
+
+// serviceUnitPattern 合法的systemd单元名称，拒绝选项和shell特殊字符
+var serviceUnitPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:\-]*$`)
+
+// serviceProperties status显示的单元属性
+var serviceProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "Result", "MainPID",
+	"ExecMainStartTimestamp", "ExecMainStatus", "NRestarts", "MemoryCurrent", "FragmentPath",
+}
+
+// serviceChangeActions 会改变服务状态、需要用户确认的action
+var serviceChangeActions = map[string]bool{
+	"start": true, "stop": true, "restart": true, "reload": true, "enable": true, "disable": true,
+}
+
+// manageServiceTool 管理systemd服务的工具定义
+var manageServiceTool = Tool{
+	Type:        "function",
+	Name:        "manage_service",
+	Sequential:  true,
+	Description: "通过systemctl和journalctl管理systemd服务，代替直接执行systemctl命令。list列出服务（可按状态筛选，如failed）；status显示服务的状态、主进程、重启次数和最近的日志；logs读取服务日志；start、stop、restart、reload、enable、disable改变服务状态，执行前会询问用户确认，结果中给出操作后的状态，失败时附带最近的日志，便于排查原因。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "status", "logs", "start", "stop", "restart", "reload", "enable", "disable"},
+				"description": "要执行的操作",
+			},
+			"unit": map[string]interface{}{
+				"type":        "string",
+				"description": "服务名称，如nginx或nginx.service；list以外的操作必填",
+			},
+			"state": map[string]interface{}{
+				"type":        "string",
+				"description": "list时只列出该状态的服务，如running、failed、inactive，默认列出所有已加载的服务",
+			},
+			"lines": map[string]interface{}{
+				"type":        "integer",
+				"description": "logs返回的最多行数，默认50，最多1000",
+				"minimum":     1,
+				"maximum":     serviceMaxLogs,
+			},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "logs只返回该时间之后的日志，格式同journalctl --since，如\"1 hour ago\"、\"2024-05-01 10:00\"、today",
+			},
+			"priority": map[string]interface{}{
+				"type":        "string",
+				"description": "logs只返回该级别及更严重的日志，如err、warning、info",
+			},
+			"user": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否操作当前用户的服务（systemctl --user），默认false操作系统服务",
+				"default":     false,
+			},
+		},
+		"required": []string{"action"},
+	},
+}
+
+// serviceParams manage_service的参数
+type serviceParams struct {
+	Action   string `json:"action"`
+	Unit     string `json:"unit"`
+	State    string `json:"state"`
+	Lines    int    `json:"lines"`
+	Since    string `json:"since"`
+	Priority string `json:"priority"`
+	User     bool   `json:"user"`
+}
+
+// manageService 根据action查看或改变systemd服务
+func (a *ECNUAgent) manageService(ctx context.Context, args string) (string, error) {
+	params := serviceParams{Lines: serviceDefaultLogs}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Action != "list" {
+		if params.Unit == "" {
+			return "", fmt.Errorf("%s需要unit参数", params.Action)
+		}
+		if !serviceUnitPattern.MatchString(params.Unit) {
+			return "", fmt.Errorf("服务名称%q不合法", params.Unit)
+		}
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return "管理服务失败: 未找到systemctl命令，当前系统可能没有使用systemd", nil
+	}
+	log.Printf("[服务] %s %s\n", params.Action, params.Unit)
+
+	switch params.Action {
+	case "list":
+		return serviceList(ctx, params), nil
+	case "status":
+		return serviceStatus(ctx, params), nil
+	case "logs":
+		if params.Lines <= 0 || params.Lines > serviceMaxLogs {
+			params.Lines = serviceMaxLogs
+		}
+		return serviceLogs(ctx, params, params.Lines), nil
+	}
+	if !serviceChangeActions[params.Action] {
+		return "", fmt.Errorf("未知的action: %s", params.Action)
+	}
+	return a.changeService(ctx, params), nil
+}
+
+// systemctl 执行systemctl，不询问密码，返回合并的输出
+func systemctl(ctx context.Context, user bool, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, serviceTimeout)
+	defer cancel()
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	args = append([]string{"--no-pager", "--no-ask-password"}, args...)
+	out, err := exec.CommandContext(ctx, "systemctl", args...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// serviceCommand 返回与操作等价的命令，用于命令策略检查和显示
+func serviceCommand(params serviceParams) string {
+	if params.User {
+		return fmt.Sprintf("systemctl --user %s %s", params.Action, params.Unit)
+	}
+	return fmt.Sprintf("systemctl %s %s", params.Action, params.Unit)
+}
+
+// serviceList 列出服务
+func serviceList(ctx context.Context, params serviceParams) string {
+	args := []string{"list-units", "--type=service", "--plain", "--no-legend"}
+	if params.State != "" {
+		args = append(args, "--state="+params.State)
+	} else {
+		args = append(args, "--all")
+	}
+	out, err := systemctl(ctx, params.User, args...)
+	if err != nil && out == "" {
+		return fmt.Sprintf("列出服务失败: %v", err)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		rows = append(rows, []string{fields[0], fields[1], fields[2], fields[3], strings.Join(fields[4:], " ")})
+	}
+	if len(rows) == 0 {
+		return "没有找到符合条件的服务"
+	}
+	return fmt.Sprintf("共%d个服务:\n", len(rows)) + formatTableRows([]string{"UNIT", "LOAD", "ACTIVE", "SUB", "DESCRIPTION"}, rows)
+}
+
+// serviceStatus 返回服务的主要属性和最近的日志
+func serviceStatus(ctx context.Context, params serviceParams) string {
+	out, err := systemctl(ctx, params.User, "show", params.Unit, "--property="+strings.Join(serviceProperties, ","))
+	if err != nil {
+		return fmt.Sprintf("查看服务状态失败: %v: %s", err, out)
+	}
+	props := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = v
+		}
+	}
+	if props["LoadState"] == "not-found" {
+		return fmt.Sprintf("服务%s不存在", params.Unit)
+	}
+
+	var b strings.Builder
+	for _, name := range serviceProperties {
+		v := props[name]
+		switch {
+		case v == "" || v == "[not set]":
+			continue
+		case name == "MainPID" && v == "0":
+			continue
+		case name == "MemoryCurrent":
+			if n, ok := parseNumber(v); ok {
+				v = formatSize(int64(n))
+			} else {
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, v)
+	}
+	b.WriteString(serviceLogs(ctx, params, serviceStatusLogs))
+	return b.String()
+}
+
+// serviceLogs 返回服务最近的日志
+func serviceLogs(ctx context.Context, params serviceParams, lines int) string {
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return "读取日志失败: 未找到journalctl命令\n"
+	}
+	ctx, cancel := context.WithTimeout(ctx, serviceTimeout)
+	defer cancel()
+	args := []string{"--no-pager", "-o", "short-iso", "-n", fmt.Sprint(lines)}
+	if params.User {
+		args = append(args, "--user-unit", params.Unit)
+	} else {
+		args = append(args, "-u", params.Unit)
+	}
+	if params.Since != "" {
+		args = append(args, "--since", params.Since)
+	}
+	if params.Priority != "" {
+		args = append(args, "-p", params.Priority)
+	}
+	out, err := exec.CommandContext(ctx, "journalctl", args...).CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if err != nil {
+		return fmt.Sprintf("读取日志失败: %v: %s\n", err, text)
+	}
+	if text == "" || text == "-- No entries --" {
+		return "<logs>\n（没有日志，非root用户可能需要加入systemd-journal或adm组才能读取系统服务的日志）\n</logs>\n"
+	}
+	return "<logs>\n" + text + "\n</logs>\n"
+}
+
+// changeService 经命令策略检查和用户确认后改变服务状态，返回操作后的状态
+func (a *ECNUAgent) changeService(ctx context.Context, params serviceParams) string {
+	command := serviceCommand(params)
+	if refusal := a.policyDenied(command); refusal != "" {
+		return refusal
+	}
+	ok, err := a.confirm(ctx, approveDangerous, fmt.Sprintf("\n即将执行服务操作:\n  $ %s\n是否执行？(y/N) ", command))
+	if err != nil {
+		return fmt.Sprintf("管理服务失败: 改变服务状态需要用户确认: %v", err)
+	}
+	if !ok {
+		return fmt.Sprintf("用户拒绝执行 %s，服务未受影响。请询问用户原因或换一种方式完成任务。", command)
+	}
+
+	out, runErr := systemctl(ctx, params.User, params.Action, params.Unit)
+	var b strings.Builder
+	if runErr != nil {
+		fmt.Fprintf(&b, "$ %s 失败: %v\n", command, runErr)
+		if strings.Contains(out, "Interactive authentication required") || strings.Contains(out, "Access denied") {
+			b.WriteString("权限不足，需要以root运行Agent，或由用户手动执行该操作\n")
+		}
+	} else {
+		fmt.Fprintf(&b, "$ %s 成功\n", command)
+	}
+	if out != "" {
+		b.WriteString(out + "\n")
+	}
+	if params.Action == "enable" || params.Action == "disable" {
+		return b.String()
+	}
+
+	// 服务可能在启动后很快退出，稍等后再读取状态
+	if runErr == nil && (params.Action == "start" || params.Action == "restart") {
+		select {
+		case <-ctx.Done():
+			return b.String()
+		case <-time.After(serviceSettle):
+		}
+	}
+	b.WriteString("\n操作后的状态:\n")
+	b.WriteString(serviceStatus(ctx, params))
+	return b.String()
+}
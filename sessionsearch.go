@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	searchDefaultLimit = 20 // 默认显示的匹配消息数
+	searchContextRunes = 40 // 匹配位置前后显示的字符数
+)
+
+// sessionMatch 保存的会话中与查询匹配的一条消息
+type sessionMatch struct {
+	session sessionInfo
+	index   int // 消息在历史中的位置，系统提示为0
+	role    string
+	text    string
+	snippet string
+}
+
+// label 返回消息角色的显示名称
+func (m sessionMatch) label() string {
+	if m.role == openai.ChatMessageRoleUser {
+		return "用户"
+	}
+	return "助手"
+}
+
+// searchSessions 在保存的会话中查找同时包含query中所有词的用户输入和助手回复，不区分大小写
+//
+// 结果按会话的更新时间从新到旧排列，同一会话中按消息顺序排列，最多返回limit条。
+func searchSessions(dir, query string, limit int) ([]sessionMatch, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("查询不能为空")
+	}
+	sessions, err := listSessions(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []sessionMatch
+	for _, info := range sessions {
+		history, err := loadSessionHistory(dir, info.ID)
+		if err != nil {
+			continue
+		}
+		for i, msg := range history {
+			if msg.Role != openai.ChatMessageRoleUser && msg.Role != openai.ChatMessageRoleAssistant {
+				continue
+			}
+			text := messageText(msg)
+			lower := strings.ToLower(text)
+			if text == "" || !containsAll(lower, terms) {
+				continue
+			}
+			matches = append(matches, sessionMatch{session: info, index: i, role: msg.Role, text: text, snippet: matchSnippet(text, terms[0])})
+			if len(matches) == limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// loadSessionHistory 读取会话的对话历史
+func loadSessionHistory(dir, id string) ([]openai.ChatCompletionMessage, error) {
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state.History, nil
+}
+
+// containsAll 判断text是否包含全部词
+func containsAll(text string, terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSnippet 返回term第一次出现位置前后的一段文字，合并为一行
+func matchSnippet(text, term string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// 个别字符转换大小写后长度变化，直接在转换后的文字中截取
+		runes = lower
+	}
+	pos := strings.Index(string(lower), term)
+	if pos < 0 {
+		return oneLine(text, searchContextRunes*2)
+	}
+	at := len([]rune(string(lower)[:pos]))
+	start, end := max(0, at-searchContextRunes), min(len(runes), at+len([]rune(term))+searchContextRunes)
+	snippet := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet += "..."
+	}
+	return snippet
+}
+
+// printSessionMatches 按会话分组输出匹配结果，每条结果带有编号
+func printSessionMatches(matches []sessionMatch) {
+	current := ""
+	for i, m := range matches {
+		if m.session.ID != current {
+			current = m.session.ID
+			fmt.Printf("\n%s  %s  %s\n", m.session.ID, m.session.Updated.Format("2006-01-02 15:04"), m.session.Title)
+		}
+		fmt.Printf("  [%d] #%d %s: %s\n", i+1, m.index, m.label(), m.snippet)
+	}
+}
+
+const historyUsage = `用法: chatecnu-agent history [--state-dir 目录] <命令> [参数]
+
+命令:
+  search [-n 条数] <关键词...>    在保存的会话中查找包含全部关键词的输入和回复
+  show <会话ID> [消息编号]        显示会话的对话内容，指定编号时只显示该条消息
+
+会话默认保存在~/.ecnu-agent/sessions，可以用--state-dir或ECNU_AGENT_STATE_DIR指定。
+找到的会话可以用 chatecnu-agent --resume <会话ID> 继续。
+`
+
+// historySubcommand 执行history子命令
+func historySubcommand(args []string) error {
+	fs := flag.NewFlagSet("chatecnu-agent history", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), historyUsage) }
+	dir := fs.String("state-dir", os.Getenv("ECNU_AGENT_STATE_DIR"), "会话状态目录")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *dir == "" {
+		*dir = defaultStateDir()
+	}
+	if fs.NArg() == 0 {
+		fmt.Print(historyUsage)
+		return nil
+	}
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "search":
+		sub := flag.NewFlagSet("chatecnu-agent history search", flag.ContinueOnError)
+		limit := sub.Int("n", searchDefaultLimit, "显示的条数")
+		if err := sub.Parse(rest); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		query := strings.Join(sub.Args(), " ")
+		matches, err := searchSessions(*dir, query, *limit)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			fmt.Printf("没有找到包含\"%s\"的对话\n", query)
+			return nil
+		}
+		printSessionMatches(matches)
+		fmt.Println("\n使用 chatecnu-agent history show <会话ID> <消息编号> 查看完整内容，chatecnu-agent --resume <会话ID> 继续该会话")
+		return nil
+	case "show":
+		if len(rest) == 0 {
+			return fmt.Errorf("show需要会话ID")
+		}
+		history, err := loadSessionHistory(*dir, strings.TrimSuffix(rest[0], ".json"))
+		if err != nil {
+			return fmt.Errorf("读取会话失败: %v", err)
+		}
+		if len(rest) > 1 {
+			var index int
+			if _, err := fmt.Sscan(rest[1], &index); err != nil || index < 1 || index >= len(history) {
+				return fmt.Errorf("消息编号应在1~%d之间", len(history)-1)
+			}
+			fmt.Println(messageText(history[index]))
+			return nil
+		}
+		printTranscript(history)
+		return nil
+	case "help":
+		fmt.Print(historyUsage)
+		return nil
+	}
+	return fmt.Errorf("未知的命令: %s\n%s", command, historyUsage)
+}
+
+// printTranscript 输出对话中的用户输入、工具调用和助手回复，不包含系统提示和工具结果
+func printTranscript(history []openai.ChatCompletionMessage) {
+	for i, msg := range history {
+		switch msg.Role {
+		case openai.ChatMessageRoleUser:
+			fmt.Printf("\n#%d 用户:\n%s\n", i, messageText(msg))
+		case openai.ChatMessageRoleAssistant:
+			for _, call := range msg.ToolCalls {
+				fmt.Printf("#%d [工具] %s %s\n", i, call.Function.Name, oneLine(call.Function.Arguments, 100))
+			}
+			if msg.Content != "" {
+				fmt.Printf("\n#%d 助手:\n%s\n", i, msg.Content)
+			}
+		}
+	}
+}
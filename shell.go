@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// shellStateEnv 保存shell状态的文件路径通过该环境变量传给命令
+const shellStateEnv = "ECNU_SHELL_STATE"
+
+// shellStateTrap 在命令之前执行，命令结束（包括exit）时把当前目录和导出的环境变量以NUL分隔写入状态文件
+const shellStateTrap = `ecnu_save_state() { ecnu_status=$?; { printf '%s\000' "$PWD"; env -0; } >"$ECNU_SHELL_STATE" 2>/dev/null; exit $ecnu_status; }; trap ecnu_save_state EXIT; `
+
+// shellIgnoredVars 由shell自行维护、不需要在命令之间保留的环境变量
+var shellIgnoredVars = map[string]bool{shellStateEnv: true, sandboxCommandEnv: true, "PWD": true, "SHLVL": true, "_": true}
+
+// shellSession 在多次execute_command之间保持当前目录和导出的环境变量，使cd、export和激活虚拟环境像在真实终端中一样生效
+//
+// 每条命令仍然在新的sh进程中执行，超时和中断时可以整体结束进程组；被强制结束的命令不会更新状态。
+type shellSession struct {
+	mu  sync.Mutex
+	box sandbox  // 执行命令的环境
+	dir string   // 当前目录，为空时使用Agent的工作目录
+	env []string // 导出的环境变量，为nil时使用执行环境的初始环境
+}
+
+// fork 返回当前状态的副本，子智能体从主智能体的目录和环境开始，但不影响主智能体
+func (s *shellSession) fork() *shellSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &shellSession{box: s.box, dir: s.dir, env: append([]string(nil), s.env...)}
+}
+
+// reset 恢复为初始状态
+func (s *shellSession) reset() {
+	s.mu.Lock()
+	s.dir, s.env = "", nil
+	s.mu.Unlock()
+}
+
+// current 返回执行下一条命令时的目录和环境变量，目录已被删除时回到工作目录
+func (s *shellSession) current(workingDir string) (string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir != "" && !s.box.isDir(s.dir) {
+		s.dir = ""
+	}
+	dir := s.dir
+	if dir == "" {
+		dir = workingDir
+	}
+	env := s.env
+	if env == nil {
+		env = s.box.environ()
+	}
+	return dir, append([]string(nil), env...)
+}
+
+// prepare 生成带状态保存的脚本，返回脚本、目录、环境变量和状态文件路径
+func (s *shellSession) prepare(command, workingDir string) (script, dir string, env []string, statePath string, err error) {
+	if statePath, err = s.box.stateFile(); err != nil {
+		return "", "", nil, "", err
+	}
+	dir, env = s.current(workingDir)
+	env = append(env, shellStateEnv+"="+statePath)
+	script = shellStateTrap + command
+	if host, ok := s.box.(hostSandbox); ok {
+		script = host.shell.withState(command)
+	}
+	return script, dir, env, statePath, nil
+}
+
+// update 从状态文件读取命令结束时的目录和环境变量并删除该文件，命令被强制结束时文件为空，保持原状态
+func (s *shellSession) update(statePath string) {
+	data := s.box.takeState(statePath)
+	if len(data) == 0 {
+		return
+	}
+	fields := bytes.Split(bytes.TrimSuffix(data, []byte{0}), []byte{0})
+	dir := string(fields[0])
+	var env []string
+	for _, field := range fields[1:] {
+		name, _, ok := strings.Cut(string(field), "=")
+		if ok && !shellIgnoredVars[name] {
+			env = append(env, string(field))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.box.isDir(dir) {
+		s.dir = dir
+	}
+	// 不支持env -0的系统上只保留目录
+	if len(env) > 0 {
+		s.env = env
+	}
+}
+
+// directory 返回当前目录，为空表示仍在工作目录
+func (s *shellSession) directory() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+// envNamePattern 合法的环境变量名
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// applyEnv 返回在env基础上设置或删除变量后的环境，值为null表示删除该变量
+func applyEnv(env []string, overrides map[string]interface{}) ([]string, error) {
+	set := make(map[string]string)
+	for name, value := range overrides {
+		if !envNamePattern.MatchString(name) || name == shellStateEnv {
+			return nil, fmt.Errorf("无效的环境变量名: %q", name)
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			set[name] = v
+		case float64, bool:
+			set[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("环境变量%s的值必须是字符串", name)
+		}
+	}
+	result := make([]string, 0, len(env)+len(set))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, overridden := overrides[name]; !overridden {
+			result = append(result, kv)
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result = append(result, name+"="+set[name])
+	}
+	return result, nil
+}
+
+// commandDir 解析execute_command的cwd参数，相对路径相对于工作目录，并检查是否位于工作区内
+func (a *ECNUAgent) commandDir(path string) (string, error) {
+	dir := a.resolvePath(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s不是目录", dir)
+	}
+	if err := a.checkWorkspace(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
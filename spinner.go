@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// spinnerDelay 等待超过该时间才显示指示符，避免很快结束的请求造成闪烁
+const spinnerDelay = 300 * time.Millisecond
+
+// spinner 等待模型回复或工具执行时在终端上显示转动的指示符、当前步骤和已等待时间
+//
+// 同时作为诊断信息的输出：写入前先清除指示符所在的行，下一次刷新时再重新显示，
+// 因此日志不会与指示符混在同一行。
+type spinner struct {
+	mu    sync.Mutex
+	out   io.Writer
+	label string
+	start time.Time
+	frame int
+	shown bool // 终端上是否正显示指示符
+	stop  chan struct{}
+}
+
+// newSpinner 创建在out上显示的指示符，out不是终端时返回nil
+func newSpinner(out *os.File) *spinner {
+	if !isTerminal(out) {
+		return nil
+	}
+	return &spinner{out: out}
+}
+
+// begin 开始显示label，已在显示时只更新文字和开始时间
+func (s *spinner) begin(label string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.label, s.start = label, time.Now()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.tick(s.stop)
+	}
+}
+
+// end 停止显示并清除指示符，未在显示时不做任何事
+func (s *spinner) end() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.clear()
+}
+
+// tick 定时刷新指示符，直到stop被关闭
+func (s *spinner) tick(stop chan struct{}) {
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.stop == stop && time.Since(s.start) >= spinnerDelay {
+				s.frame = (s.frame + 1) % len(monitorFrames)
+				fmt.Fprintf(s.out, "\r\033[K%s %s %s", monitorFrames[s.frame], s.label, formatElapsed(time.Since(s.start)))
+				s.shown = true
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// clear 清除终端上的指示符，调用时需持有锁
+func (s *spinner) clear() {
+	if s.shown {
+		fmt.Fprint(s.out, "\r\033[K")
+		s.shown = false
+	}
+}
+
+// Write 实现io.Writer，先清除指示符再写入
+func (s *spinner) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clear()
+	return s.out.Write(p)
+}
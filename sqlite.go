@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteDefaultLimit = 100  // 默认返回的最大行数
+	sqliteMaxLimit     = 1000 // limit参数的上限
+)
+
+// sqliteHeader SQLite数据库文件的文件头
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// querySQLiteTool 查询SQLite数据库的工具定义
+var querySQLiteTool = Tool{
+	Type:       "function",
+	Name:       "query_sqlite",
+	Sequential: true,
+	Description: "查看和查询SQLite数据库文件（.db、.sqlite、.sqlite3）。action为tables时列出表和视图及行数，schema时显示建表语句和索引，query时执行SQL并以表格返回结果。" +
+		"默认以只读方式打开，INSERT、UPDATE、DELETE、CREATE等修改需要设置write为true，并会请用户确认。不要用execute_command调用sqlite3。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "数据库文件路径",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"tables", "schema", "query"},
+				"description": "操作类型，提供sql时默认为query，否则为tables",
+			},
+			"table": map[string]interface{}{
+				"type":        "string",
+				"description": "schema时只显示该表，默认显示全部",
+			},
+			"sql": map[string]interface{}{
+				"type":        "string",
+				"description": "要执行的SQL，只读模式下只能查询；write为true时可以包含多条以分号分隔的语句",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "最多返回的行数，默认100，最大1000",
+				"default":     sqliteDefaultLimit,
+			},
+			"write": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否允许修改数据库，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// sqliteParams query_sqlite的参数
+type sqliteParams struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Table  string `json:"table"`
+	SQL    string `json:"sql"`
+	Limit  int    `json:"limit"`
+	Write  bool   `json:"write"`
+}
+
+// openSQLite 打开数据库文件，只读模式下拒绝任何写入，写入模式下文件不存在时新建
+func openSQLite(fullPath string, write bool) (*sql.DB, error) {
+	f, err := os.Open(fullPath)
+	switch {
+	case err == nil:
+		header := make([]byte, len(sqliteHeader))
+		n, _ := f.Read(header)
+		f.Close()
+		// 空文件会被SQLite当作新数据库
+		if n > 0 && !bytes.Equal(header[:n], sqliteHeader) {
+			return nil, fmt.Errorf("%s不是SQLite数据库", fullPath)
+		}
+	case os.IsNotExist(err) && write:
+		// 写入模式下新建数据库
+	default:
+		return nil, err
+	}
+
+	dsn := "file:" + (&url.URL{Path: filepath.ToSlash(fullPath)}).EscapedPath() + "?_pragma=busy_timeout(5000)"
+	if !write {
+		dsn += "&mode=ro&_pragma=query_only(1)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// isQueryStatement 判断语句是否返回结果行
+func isQueryStatement(stmt string) bool {
+	fields := strings.Fields(strings.TrimLeft(stmt, "( \t\r\n"))
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "PRAGMA", "EXPLAIN", "VALUES":
+		return true
+	}
+	return false
+}
+
+// sqliteValue 把查询结果中的值转换为表格中显示的文本
+func sqliteValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if utf8.Valid(v) && !bytes.ContainsRune(v, 0) {
+			return string(v)
+		}
+		return fmt.Sprintf("[BLOB %s]", formatSize(int64(len(v))))
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// sqliteRows 读取最多limit行结果，返回列名、数据和是否还有更多行
+func sqliteRows(rows *sql.Rows, limit int) ([]string, [][]string, bool, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var data [][]string
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(data) == limit {
+			return columns, data, true, nil
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, false, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = sqliteValue(v)
+		}
+		data = append(data, row)
+	}
+	return columns, data, false, rows.Err()
+}
+
+// sqliteTables 列出表和视图，表附带行数
+func sqliteTables(ctx context.Context, db *sql.DB, fullPath string) (string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY type, name")
+	if err != nil {
+		return "", err
+	}
+	type entry struct{ name, kind string }
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.name, &e.kind); err != nil {
+			rows.Close()
+			return "", err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("%s 中没有表", fullPath), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 中的表和视图:\n", fullPath)
+	for _, e := range entries {
+		if e.kind == "view" {
+			fmt.Fprintf(&b, "  %s（视图）\n", e.name)
+			continue
+		}
+		var count int64
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(e.name)).Scan(&count); err != nil {
+			fmt.Fprintf(&b, "  %s（统计行数失败: %v）\n", e.name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s（%d行）\n", e.name, count)
+	}
+	b.WriteString("使用action: \"schema\"查看表结构\n")
+	return b.String(), nil
+}
+
+// sqliteSchema 显示建表语句，table为空时显示全部表、视图、索引和触发器
+func sqliteSchema(ctx context.Context, db *sql.DB, fullPath, table string) (string, error) {
+	query := "SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'"
+	var args []interface{}
+	if table != "" {
+		query += " AND tbl_name = ? COLLATE NOCASE"
+		args = append(args, table)
+	}
+	query += " ORDER BY tbl_name, type = 'index', name"
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	count := 0
+	for rows.Next() {
+		var kind, name, stmt string
+		if err := rows.Scan(&kind, &name, &stmt); err != nil {
+			return "", err
+		}
+		b.WriteString(strings.TrimSpace(stmt) + ";\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if count == 0 {
+		if table != "" {
+			return fmt.Sprintf("%s 中没有表%s，可用action: \"tables\"查看全部表", fullPath, table), nil
+		}
+		return fmt.Sprintf("%s 中没有表", fullPath), nil
+	}
+	return fmt.Sprintf("%s 的结构:\n%s", fullPath, b.String()), nil
+}
+
+// quoteIdent 为SQL标识符加上双引号
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteQuery 执行SQL，查询语句返回表格，其他语句返回影响的行数
+func sqliteQuery(ctx context.Context, db *sql.DB, stmt string, limit int) (string, error) {
+	if !isQueryStatement(stmt) {
+		res, err := db.ExecContext(ctx, stmt)
+		if err != nil {
+			return "", err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			return fmt.Sprintf("执行成功，影响%d行\n", n), nil
+		}
+		return "执行成功\n", nil
+	}
+
+	rows, err := db.QueryContext(ctx, stmt)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, data, more, err := sqliteRows(rows, limit)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "执行成功\n", nil
+	}
+	if len(data) == 0 {
+		return strings.Join(columns, " | ") + "\n（没有结果）\n", nil
+	}
+	var b strings.Builder
+	b.WriteString(formatTableRows(columns, data))
+	if more {
+		fmt.Fprintf(&b, "...（只显示前%d行，请在SQL中加上WHERE或LIMIT缩小范围）\n", limit)
+	} else {
+		fmt.Fprintf(&b, "（共%d行）\n", len(data))
+	}
+	return b.String(), nil
+}
+
+// querySQLite 查看SQLite数据库的表和结构或执行SQL
+func (a *ECNUAgent) querySQLite(ctx context.Context, args string) (string, error) {
+	params := sqliteParams{Limit: sqliteDefaultLimit}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	params.SQL = strings.TrimSpace(params.SQL)
+	if params.Action == "" {
+		params.Action = "tables"
+		if params.SQL != "" {
+			params.Action = "query"
+		}
+	}
+	switch params.Action {
+	case "tables", "schema":
+	case "query":
+		if params.SQL == "" {
+			return "", fmt.Errorf("query操作缺少sql参数")
+		}
+	default:
+		return "", fmt.Errorf("不支持的操作: %s", params.Action)
+	}
+	params.Limit = max(1, min(params.Limit, sqliteMaxLimit))
+	write := params.Write && params.Action == "query"
+
+	fullPath := a.resolvePath(params.Path)
+	log.Printf("[SQLite] %s (%s, 写入: %v)\n", fullPath, params.Action, write)
+
+	var change fileChange
+	var before string
+	if write {
+		ok, err := a.confirm(ctx, approveWrite, fmt.Sprintf("\n即将修改数据库 %s:\n%s\n是否执行？(y/N) ", fullPath, params.SQL))
+		if err != nil {
+			return fmt.Sprintf("执行SQL失败: 修改数据库需要用户确认: %v", err), nil
+		}
+		if !ok {
+			return fmt.Sprintf("用户拒绝修改数据库 %s，SQL未执行。请询问用户原因或换一种方式完成任务。", fullPath), nil
+		}
+		if change, err = a.snapshotFile(fullPath); err != nil {
+			return fmt.Sprintf("执行SQL失败: %v", err), nil
+		}
+		before = contentSum(fullPath)
+	}
+
+	db, err := openSQLite(fullPath, write)
+	if err != nil {
+		return fmt.Sprintf("打开数据库失败: %v", err), nil
+	}
+	defer db.Close()
+
+	var result string
+	switch params.Action {
+	case "tables":
+		result, err = sqliteTables(ctx, db, fullPath)
+	case "schema":
+		result, err = sqliteSchema(ctx, db, fullPath, params.Table)
+	default:
+		result, err = sqliteQuery(ctx, db, params.SQL, params.Limit)
+	}
+	if write {
+		// 先关闭连接使修改写回数据库文件，内容变化时才记录修改供撤销
+		db.Close()
+		if after := contentSum(fullPath); after != before {
+			a.undo.record(change)
+			a.activity.addFile(fullPath)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		msg := fmt.Sprintf("执行SQL失败: %v", err)
+		if !write && strings.Contains(err.Error(), "readonly") {
+			msg += "\n数据库以只读方式打开，如需修改请设置write为true"
+		}
+		return msg, nil
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// statFileTool 查看文件元数据的工具定义
+var statFileTool = Tool{
+	Type:        "function",
+	Name:        "stat_file",
+	Cacheable:   true,
+	Description: "查看文件或目录的完整元数据：类型、大小、权限、所有者和组、修改时间、符号链接目标、MIME类型以及当前用户的读写执行权限。排查权限问题时比解析ls -la的输出更可靠。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "文件或目录路径（绝对路径或相对路径）",
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// statFile 返回文件的元数据，符号链接同时显示链接本身和目标的信息
+func (a *ECNUAgent) statFile(args string) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	log.Printf("[文件信息] %s\n", fullPath)
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return fmt.Sprintf("获取文件信息失败: %v", err), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "路径: %s\n", fullPath)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, _ := os.Readlink(fullPath)
+		fmt.Fprintf(&b, "类型: 符号链接 -> %s\n", target)
+		resolved, err := os.Stat(fullPath)
+		if err != nil {
+			fmt.Fprintf(&b, "链接目标不可访问: %v\n", err)
+			return b.String(), nil
+		}
+		b.WriteString("目标信息:\n")
+		info = resolved
+	}
+	writeFileInfo(&b, fullPath, info)
+	return b.String(), nil
+}
+
+// writeFileInfo 写出类型、大小、权限、所有者、时间和MIME类型
+func writeFileInfo(b *strings.Builder, fullPath string, info os.FileInfo) {
+	mode := info.Mode()
+	fmt.Fprintf(b, "类型: %s\n", fileKind(mode))
+	if !info.IsDir() {
+		fmt.Fprintf(b, "大小: %d字节 (%s)\n", info.Size(), formatSize(info.Size()))
+	}
+	fmt.Fprintf(b, "权限: %s (%04o)\n", mode.String(), mode.Perm()|specialBits(mode))
+	b.WriteString(fileOwnership(info))
+	fmt.Fprintf(b, "修改时间: %s\n", info.ModTime().Format("2006-01-02 15:04:05 -0700"))
+	fmt.Fprintf(b, "当前用户权限: %s\n", fileAccess(fullPath))
+
+	if mode.IsRegular() {
+		if mime := sniffFileType(fullPath); mime != "" {
+			fmt.Fprintf(b, "MIME类型: %s\n", mime)
+		}
+	}
+}
+
+// fileKind 返回文件类型的中文名称
+func fileKind(mode os.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "目录"
+	case mode.IsRegular():
+		return "普通文件"
+	case mode&os.ModeSymlink != 0:
+		return "符号链接"
+	case mode&os.ModeNamedPipe != 0:
+		return "命名管道"
+	case mode&os.ModeSocket != 0:
+		return "套接字"
+	case mode&os.ModeCharDevice != 0:
+		return "字符设备"
+	case mode&os.ModeDevice != 0:
+		return "块设备"
+	default:
+		return "其他"
+	}
+}
+
+// specialBits 将setuid、setgid和粘滞位转换为八进制权限的高位
+func specialBits(mode os.FileMode) os.FileMode {
+	var bits os.FileMode
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// sniffFileType 根据文件开头的内容识别MIME类型或二进制格式
+func sniffFileType(fullPath string) string {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if n == 0 && err != nil {
+		return ""
+	}
+	return detectFileType(head[:n])
+}
@@ -0,0 +1,46 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// fileOwnership 返回文件的所有者、所属组以及inode和硬链接数
+func fileOwnership(info os.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	uid, gid := strconv.FormatUint(uint64(st.Uid), 10), strconv.FormatUint(uint64(st.Gid), 10)
+	owner, group := uid, gid
+	if u, err := user.LookupId(uid); err == nil {
+		owner = u.Username
+	}
+	if g, err := user.LookupGroupId(gid); err == nil {
+		group = g.Name
+	}
+	return fmt.Sprintf("所有者: %s (uid %s)  组: %s (gid %s)\ninode: %d  硬链接数: %d\n", owner, uid, group, gid, uint64(st.Ino), uint64(st.Nlink))
+}
+
+// fileAccess 返回当前用户对文件的读、写、执行权限
+func fileAccess(path string) string {
+	var granted []string
+	for _, check := range []struct {
+		mode uint32
+		name string
+	}{{4, "读"}, {2, "写"}, {1, "执行"}} {
+		if syscall.Access(path, check.mode) == nil {
+			granted = append(granted, check.name)
+		}
+	}
+	if len(granted) == 0 {
+		return "无"
+	}
+	return strings.Join(granted, "、")
+}
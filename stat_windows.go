@@ -0,0 +1,30 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// fileOwnership 在Windows上不提供所有者信息
+func fileOwnership(info os.FileInfo) string {
+	return ""
+}
+
+// fileAccess 在Windows上根据能否打开文件判断读写权限
+func fileAccess(path string) string {
+	access := ""
+	if f, err := os.Open(path); err == nil {
+		f.Close()
+		access = "读"
+	}
+	if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+		f.Close()
+		if access != "" {
+			access += "、"
+		}
+		access += "写"
+	}
+	if access == "" {
+		return "无"
+	}
+	return access
+}
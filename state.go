@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// resumeLast --resume使用该值时恢复最近的会话
+const resumeLast = "last"
+
+// sessionState 持久化到磁盘的会话状态
+type sessionState struct {
+	ID         string                         `json:"id"`
+	Created    time.Time                      `json:"created"`
+	Updated    time.Time                      `json:"updated"`
+	Title      string                         `json:"title,omitempty"` // 会话中第一个任务的开头，用于在列表中辨认会话
+	WorkingDir string                         `json:"working_dir"`
+	Workspace  string                         `json:"workspace,omitempty"` // 启动时指定的工作区，未指定时为空
+	Provider   string                         `json:"provider"`
+	Model      string                         `json:"model"`
+	Task       string                         `json:"task,omitempty"`    // 最近一次任务的用户输入
+	Running    bool                           `json:"running"`           // 任务是否仍在执行，进程异常退出时保持为true
+	Pending    *openai.ChatCompletionMessage  `json:"pending,omitempty"` // 已发起但尚未得到结果的工具调用
+	History    []openai.ChatCompletionMessage `json:"history"`
+	Turns      []int                          `json:"turns"` // 用户每次输入在历史中的位置，早期版本的会话中没有
+}
+
+// sessionStore 将会话状态保存到 <目录>/<会话ID>.json，进程退出、崩溃或断线后可以恢复
+type sessionStore struct {
+	id      string
+	path    string
+	created time.Time
+	title   string
+	task    string
+	running bool
+	pending *openai.ChatCompletionMessage
+	failed  bool // 已输出过保存失败的日志
+}
+
+// sessionTitleRunes 会话标题的最大长度
+const sessionTitleRunes = 60
+
+// sessionNamePattern --session指定的会话名称，同时用作状态文件名
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-]*$`)
+
+// defaultStateDir 返回会话状态的默认保存目录
+//
+// 早期版本保存在~/.ecnu-agent/state，新目录不存在时把旧目录整体移过来。
+func defaultStateDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	dir := filepath.Join(home, ".ecnu-agent", "sessions")
+	legacy := filepath.Join(home, ".ecnu-agent", "state")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+			if err := os.Rename(legacy, dir); err == nil {
+				log.Printf("[状态] 会话目录已从 %s 迁移到 %s\n", legacy, dir)
+			}
+		}
+	}
+	return dir
+}
+
+// sessionDir 返回保存会话状态的目录
+func (c *Config) sessionDir() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	return defaultStateDir()
+}
+
+// newSessionStore 创建新会话的状态存储，dir为空时使用默认目录，name为空时以当前时间作为会话ID
+func newSessionStore(dir, name string) (*sessionStore, error) {
+	if dir == "" {
+		dir = defaultStateDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建状态目录失败: %v", err)
+	}
+	now := time.Now()
+	id := name
+	if id == "" {
+		id = now.Format("20060102-150405")
+	}
+	return &sessionStore{id: id, path: filepath.Join(dir, id+".json"), created: now}, nil
+}
+
+// loadSessionState 读取会话状态，id为last时读取最近更新的会话；workingDir不为空时读取在该目录中最近更新的会话
+func loadSessionState(dir, id, workingDir string) (*sessionState, string, error) {
+	if dir == "" {
+		dir = defaultStateDir()
+	}
+	if id == resumeLast {
+		latest, err := latestSession(dir, workingDir)
+		if err != nil {
+			return nil, "", err
+		}
+		id = latest
+	}
+
+	path := filepath.Join(dir, strings.TrimSuffix(id, ".json")+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取会话状态失败: %w", err)
+	}
+	var state sessionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, "", fmt.Errorf("解析会话状态失败: %v", err)
+	}
+	if len(state.History) == 0 {
+		return nil, "", fmt.Errorf("会话%s没有可恢复的历史记录", id)
+	}
+	return &state, path, nil
+}
+
+// latestSession 返回目录中最近更新的会话ID，workingDir不为空时只考虑在该目录中进行的会话
+func latestSession(dir, workingDir string) (string, error) {
+	sessions, err := listSessions(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range sessions {
+		if workingDir == "" || info.WorkingDir == workingDir {
+			return info.ID, nil
+		}
+	}
+	if workingDir != "" {
+		return "", fmt.Errorf("%s中没有在 %s 中进行过的会话", dir, workingDir)
+	}
+	return "", fmt.Errorf("%s中没有保存的会话", dir)
+}
+
+// sessionInfo 会话列表中的一项，不包含对话历史
+type sessionInfo struct {
+	ID         string
+	Created    time.Time
+	Updated    time.Time
+	Title      string
+	WorkingDir string
+	Model      string
+	Messages   int
+	Running    bool
+}
+
+// listSessions 读取目录中保存的全部会话，按最后更新时间从新到旧排列，无法解析的文件跳过
+func listSessions(dir string) ([]sessionInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取状态目录失败: %v", err)
+	}
+	var sessions []sessionInfo
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var state sessionState
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+		info := sessionInfo{
+			ID:         strings.TrimSuffix(entry.Name(), ".json"),
+			Created:    state.Created,
+			Updated:    state.Updated,
+			Title:      state.Title,
+			WorkingDir: state.WorkingDir,
+			Model:      state.Model,
+			Messages:   len(state.History),
+			Running:    state.Running,
+		}
+		if info.Title == "" {
+			// 早期版本没有保存标题，使用第一条用户消息
+			info.Title = sessionTitle(state.History)
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+	return sessions, nil
+}
+
+// sessionTitle 返回历史中第一条用户消息的开头
+func sessionTitle(history []openai.ChatCompletionMessage) string {
+	for _, msg := range history {
+		if msg.Role == openai.ChatMessageRoleUser {
+			return truncateRunes(firstLine(strings.TrimSpace(messageText(msg))), sessionTitleRunes)
+		}
+	}
+	return ""
+}
+
+// restoreSession 用保存的状态恢复会话，之后的状态继续写入同一个文件
+func (a *ECNUAgent) restoreSession(state *sessionState, path string) {
+	log.Printf("[恢复] 已恢复会话 %s（%d条消息，最后更新于 %s）\n", state.ID, len(state.History), state.Updated.Format("2006-01-02 15:04:05"))
+	a.history = state.History
+	a.turnStarts = state.Turns
+	if state.Turns == nil {
+		// 早期版本没有记录轮次，把每条用户消息都作为一轮的开始
+		for i, msg := range state.History {
+			if i > 0 && msg.Role == openai.ChatMessageRoleUser {
+				a.turnStarts = append(a.turnStarts, i)
+			}
+		}
+	}
+	if state.WorkingDir != "" {
+		if err := a.checkSwitchDir(state.WorkingDir); err != nil {
+			log.Printf("[警告] %v，仍在 %s 中继续\n", err, a.workingDir)
+		} else {
+			a.workingDir = state.WorkingDir
+		}
+	}
+	if !a.config.Persist {
+		return
+	}
+	a.session = &sessionStore{
+		id:      state.ID,
+		path:    path,
+		created: state.Created,
+		title:   state.Title,
+		task:    state.Task,
+		running: state.Running,
+		pending: state.Pending,
+	}
+}
+
+// checkSwitchDir 检查能否把工作目录切换到恢复的会话所在的dir
+//
+// 沙箱只挂载了启动时的工作区，--workspace-only也以它为界，这两种情况下只能留在启动时的工作区。
+func (a *ECNUAgent) checkSwitchDir(dir string) error {
+	if dir == a.workingDir {
+		return nil
+	}
+	if _, host := a.sandbox.(hostSandbox); !host {
+		return fmt.Errorf("会话的工作目录 %s 与当前工作区 %s 不同，命令在%s中执行，不能切换", dir, a.workingDir, a.sandbox.describe())
+	}
+	if a.config.WorkspaceOnly {
+		return fmt.Errorf("会话的工作目录 %s 与当前工作区 %s 不同，--workspace-only模式下不能切换", dir, a.workingDir)
+	}
+	return nil
+}
+
+// saveState 将当前会话状态原子地写入磁盘，失败时只输出一次日志
+func (a *ECNUAgent) saveState() {
+	s := a.session
+	if s == nil {
+		return
+	}
+	state := sessionState{
+		ID:         s.id,
+		Created:    s.created,
+		Updated:    time.Now(),
+		Title:      s.title,
+		WorkingDir: a.workingDir,
+		Workspace:  a.config.Workspace,
+		Provider:   a.config.Provider,
+		Model:      a.model(),
+		Task:       s.task,
+		Running:    s.running,
+		Pending:    s.pending,
+		History:    a.history,
+		Turns:      a.turnStarts,
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil && !s.failed {
+		s.failed = true
+		log.Printf("[状态] 保存会话状态失败: %v\n", err)
+	}
+}
+
+// beginTask 标记任务开始执行
+func (a *ECNUAgent) beginTask(task string) {
+	if a.session == nil {
+		return
+	}
+	if a.session.title == "" {
+		a.session.title = truncateRunes(firstLine(strings.TrimSpace(task)), sessionTitleRunes)
+	}
+	a.session.task = task
+	a.session.running = true
+	a.session.pending = nil
+	a.saveState()
+}
+
+// endTask 标记任务结束（无论成功与否）
+func (a *ECNUAgent) endTask() {
+	if a.session == nil {
+		return
+	}
+	a.session.running = false
+	a.session.pending = nil
+	a.saveState()
+}
+
+// setPending 记录即将执行的工具调用，执行完毕后传入nil清除
+func (a *ECNUAgent) setPending(message *openai.ChatCompletionMessage) {
+	if a.session == nil {
+		return
+	}
+	a.session.pending = message
+	a.saveState()
+}
+
+// interruptedTask 返回上次异常退出时未完成的任务
+func (a *ECNUAgent) interruptedTask() (string, bool) {
+	if a.session == nil || !a.session.running {
+		return "", false
+	}
+	return a.session.task, true
+}
+
+// resumeTask 从上次中断的位置继续执行任务
+//
+// 中断时正在执行的工具调用无法确定是否已经生效，因此不会自动重新执行，
+// 而是告知模型结果未知，由模型检查状态后决定下一步。
+func (a *ECNUAgent) resumeTask(ctx context.Context) error {
+	task, _ := a.interruptedTask()
+	pending := a.session.pending
+	a.startTurn()
+	a.beginTask(task)
+	defer a.endTask()
+
+	if pending != nil && len(pending.ToolCalls) > 0 {
+		var results []openai.ChatCompletionMessage
+		for _, call := range pending.ToolCalls {
+			results = append(results, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				ToolCallID: call.ID,
+				Content:    "工具执行期间进程意外退出，无法确定该操作是否已经完成。请先检查相关状态，再决定是否需要重新执行。",
+			})
+		}
+		a.appendToolResults(*pending, results)
+	}
+	return a.runTask(ctx, "")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// inputLines 在后台逐行读取用户输入，使任务执行期间也能接收输入
+type inputLines struct {
+	lines  chan string
+	err    error       // 读取结束后的错误，在lines关闭前设置
+	editor *lineEditor // 交互式终端上编辑主提示符下的输入，管道输入时为nil
+}
+
+// readInputLines 开始在后台读取输入
+func readInputLines(r io.Reader) *inputLines {
+	in := &inputLines{lines: make(chan string)}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			in.lines <- scanner.Text()
+		}
+		in.err = scanner.Err()
+		close(in.lines)
+	}()
+	return in
+}
+
+// readTerminalLines 开始在后台读取交互式终端的输入，主提示符下支持行编辑和历史记录
+func readTerminalLines(in, out *os.File, history *inputHistory) *inputLines {
+	lines := &inputLines{lines: make(chan string), editor: newLineEditor(in, out, history)}
+	go func() {
+		lines.err = lines.editor.run(lines.lines)
+		close(lines.lines)
+	}()
+	return lines
+}
+
+// prompt 显示提示符并读取下一行输入，输入结束时返回false
+func (in *inputLines) prompt(w io.Writer, prompt string) (string, bool) {
+	if in.editor != nil {
+		in.editor.begin(prompt)
+	} else {
+		fmt.Fprint(w, prompt)
+	}
+	return in.next()
+}
+
+// restore 恢复终端原来的模式，退出前调用
+func (in *inputLines) restore() {
+	if in.editor != nil {
+		in.editor.restore()
+	}
+}
+
+// remember 把主提示符下提交的输入加入历史，管道输入时不保存
+func (in *inputLines) remember(text string) {
+	if in.editor != nil {
+		in.editor.remember(text)
+	}
+}
+
+// suspend 暂停后台读取，使外部程序可以独占终端，调用返回的函数后继续读取
+func (in *inputLines) suspend() (resume func()) {
+	if in.editor == nil {
+		return func() {}
+	}
+	return in.editor.suspend()
+}
+
+// next 读取下一行输入，输入结束时返回false
+func (in *inputLines) next() (string, bool) {
+	line, ok := <-in.lines
+	return line, ok
+}
+
+// isTerminal 判断文件是否为交互式终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// steeringQueue 任务执行期间用户输入的补充指示
+type steeringQueue struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+// push 加入一条指示
+func (q *steeringQueue) push(msg string) {
+	q.mu.Lock()
+	q.msgs = append(q.msgs, msg)
+	q.mu.Unlock()
+}
+
+// drain 取出所有尚未处理的指示
+func (q *steeringQueue) drain() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msgs := q.msgs
+	q.msgs = nil
+	return msgs
+}
+
+// injectSteering 将用户在执行过程中输入的指示作为用户消息加入历史，在下一次调用模型前生效
+func (a *ECNUAgent) injectSteering() {
+	msgs := a.steering.drain()
+	if len(msgs) == 0 {
+		return
+	}
+	log.Printf("[引导] 已将%d条补充指示发送给模型\n", len(msgs))
+	a.history = append(a.history, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: "（执行过程中用户补充了以下指示，请据此调整接下来的操作）\n" + strings.Join(msgs, "\n"),
+	})
+}
+
+// runSteerable 执行任务，执行期间读取到的输入作为补充指示排队，工具等待确认时作为确认的回答
+//
+// 只有交互式终端才启用引导；管道输入时保持逐行执行，避免后续任务被当作补充指示。
+func (a *ECNUAgent) runSteerable(in *inputLines, task func() error) error {
+	if a.steering == nil {
+		return task()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- task() }()
+
+	lines := in.lines
+	var pending *confirmRequest
+	for {
+		select {
+		case err := <-done:
+			return err
+		case req := <-a.approver.requests:
+			fmt.Fprint(a.console, req.prompt)
+			a.notifier.confirmNeeded(req.prompt)
+			pending = &req
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				if pending != nil {
+					pending.reply <- false
+					pending = nil
+				}
+				continue
+			}
+			// 等待确认的工具调用已被取消时，输入仍作为补充指示
+			if pending != nil && pending.ctx.Err() == nil {
+				pending.reply <- answerYes(line)
+				pending = nil
+				continue
+			}
+			pending = nil
+			if line = strings.TrimSpace(line); line != "" {
+				a.steering.push(line)
+				log.Printf("[引导] 已收到补充指示，将在下一次调用模型前发送: %s\n", truncateRunes(line, 100))
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errStreamUnsupported 表示服务端不支持流式响应
+var errStreamUnsupported = errors.New("服务端不支持流式响应")
+
+// streamCompletion 以流式方式调用API，逐字输出助手回复，并将分片组装为完整响应
+func (a *ECNUAgent) streamCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := a.backend.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		if isStreamUnsupported(err) {
+			return openai.ChatCompletionResponse{}, errStreamUnsupported
+		}
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer stream.Close()
+
+	var resp openai.ChatCompletionResponse
+	var content strings.Builder
+	var toolCalls []openai.ToolCall
+	var finishReason openai.FinishReason
+	chunks := 0
+	printed := false
+	announced := 0 // 已显示预览的工具调用数
+	out := newMarkdownWriter(os.Stdout, a.renderMarkdown())
+
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if printed {
+				out.flush()
+				fmt.Println()
+			}
+			return openai.ChatCompletionResponse{}, err
+		}
+		chunks++
+
+		if resp.ID == "" {
+			resp.ID = chunk.ID
+			resp.Model = chunk.Model
+			resp.Created = chunk.Created
+		}
+		if chunk.Usage != nil {
+			resp.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+
+		if delta := choice.Delta.Content; delta != "" {
+			if !printed {
+				a.spinner.end()
+				fmt.Print("\n[助手] ")
+				printed = true
+			}
+			out.write(delta)
+			content.WriteString(delta)
+		}
+
+		toolCalls = mergeToolCallDeltas(toolCalls, choice.Delta.ToolCalls)
+
+		// 后一个工具调用开始时，前一个的参数已经完整，立即显示预览
+		for ; announced < len(toolCalls)-1; announced++ {
+			if printed {
+				out.flush()
+				fmt.Println()
+				printed = false
+			}
+			a.showToolIntent(toolCalls[announced])
+		}
+	}
+
+	if printed {
+		out.flush()
+		fmt.Println()
+	}
+	for ; announced < len(toolCalls); announced++ {
+		a.showToolIntent(toolCalls[announced])
+	}
+
+	// 服务端直接返回了非SSE响应，视为不支持流式
+	if chunks == 0 {
+		return openai.ChatCompletionResponse{}, errStreamUnsupported
+	}
+
+	resp.Choices = []openai.ChatCompletionChoice{
+		{
+			Index: 0,
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   content.String(),
+				ToolCalls: toolCalls,
+			},
+			FinishReason: finishReason,
+		},
+	}
+	return resp, nil
+}
+
+// mergeToolCallDeltas 将流式分片中的工具调用按Index合并
+func mergeToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, delta := range deltas {
+		idx := len(calls)
+		if delta.Index != nil {
+			idx = *delta.Index
+		}
+		for len(calls) <= idx {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+
+		call := &calls[idx]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+
+	// 最终消息中不应携带分片索引
+	for i := range calls {
+		calls[i].Index = nil
+	}
+	return calls
+}
+
+// isStreamUnsupported 判断错误是否表示服务端不支持流式请求
+func isStreamUnsupported(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.HTTPStatusCode {
+		case http.StatusNotFound, http.StatusNotImplemented:
+			return true
+		case http.StatusBadRequest:
+			return strings.Contains(strings.ToLower(apiErr.Message), "stream")
+		}
+	}
+	return false
+}
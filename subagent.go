@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// spawnAgentTool 委派子任务的工具定义，只提供给主智能体，子智能体不能继续委派
+var spawnAgentTool = Tool{
+	Type:        "function",
+	Name:        "spawn_agent",
+	Sequential:  true,
+	Description: "创建一个拥有独立上下文的子智能体来完成一项范围明确的子任务（例如“找出X在哪里配置”），只返回子智能体的最终总结。适合需要大量探索、但只关心结论的工作，可以避免中间过程占用当前对话的上下文。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "交给子智能体的任务，应当具体且可以独立完成",
+			},
+			"context": map[string]interface{}{
+				"type":        "string",
+				"description": "子智能体完成任务需要的背景信息，例如已知的路径或约束，可选",
+			},
+		},
+		"required": []string{"task"},
+	},
+}
+
+// newSubAgent 创建子智能体：共享端点、限流器和用量统计，使用独立的历史记录
+func (a *ECNUAgent) newSubAgent() *ECNUAgent {
+	cfg := *a.config
+	cfg.Stream = false
+	cfg.Plan = false
+	cfg.Verify = false
+	cfg.JSONMode = false
+	cfg.JSONSchema = ""
+
+	child := &ECNUAgent{
+		backend:    a.backend,
+		backends:   a.backends,
+		backendIdx: a.backendIdx,
+		limiter:    a.limiter,
+		usage:      a.usage,
+		recorder:   a.recorder,
+		budget:     a.budget,
+		trash:      a.trash,
+		backups:    a.backups,
+		undo:       a.undo,
+		sandbox:    a.sandbox,
+		policy:     a.policy,
+		dryRun:     a.dryRun,
+		shell:      a.shell.fork(),
+		monitor:    a.monitor,
+		approver:   a.approver,
+		workingDir: a.workingDir,
+		config:     &cfg,
+		subagent:   true,
+		console:    a.console,
+	}
+	child.initTools()
+	child.initSystemPrompt()
+	return child
+}
+
+// spawnAgent 在子智能体中运行子任务，返回其最终总结
+func (a *ECNUAgent) spawnAgent(ctx context.Context, args string) (string, error) {
+	var params struct {
+		Task    string `json:"task"`
+		Context string `json:"context"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Task == "" {
+		return "", fmt.Errorf("缺少task参数")
+	}
+
+	prompt := params.Task
+	if params.Context != "" {
+		prompt += "\n\n背景信息：\n" + params.Context
+	}
+	prompt += "\n\n完成后请简洁地总结结果，包括关键发现、相关的文件路径以及做过的修改。这份总结会返回给委派任务的主智能体。"
+
+	log.Printf("[子任务] 开始: %s\n", truncateRunes(params.Task, 100))
+	child := a.newSubAgent()
+	err := child.runTask(ctx, prompt)
+
+	// 子智能体的修改同样计入本轮任务，供验证使用
+	files, commands := child.activity.snapshot()
+	for _, f := range files {
+		a.activity.addFile(f)
+	}
+	for _, c := range commands {
+		a.activity.addCommand(c)
+	}
+
+	summary := child.finalAnswer()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		log.Printf("[子任务] 未完成: %v\n", err)
+		return fmt.Sprintf("子任务未完成: %v\n已有结果:\n%s", err, defaultString(summary == "", summary)), nil
+	}
+	log.Printf("[子任务] 完成\n")
+	return "子任务结果:\n" + summary, nil
+}
+
+// finalAnswer 返回历史中最后一条助手回复的内容
+func (a *ECNUAgent) finalAnswer() string {
+	for i := len(a.history) - 1; i >= 0; i-- {
+		msg := a.history[i]
+		if msg.Role != openai.ChatMessageRoleAssistant || msg.Content == "" {
+			continue
+		}
+		if a.config.ToolMode == toolModeReact {
+			_, final := parseReactResponse(msg.Content, 0)
+			return final
+		}
+		return msg.Content
+	}
+	return ""
+}
@@ -0,0 +1,840 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	tableMaxFileSize    = 100 * 1024 * 1024 // 读取表格文件的大小上限
+	tableDefaultLimit   = 20                // 默认返回的行数
+	tableMaxLimit       = 500               // 单次最多返回的行数
+	tableMaxGroups      = 200               // 分组聚合最多显示的分组数
+	tableMaxCellDisplay = 200               // 单元格显示的最大字符数
+)
+
+// readTableTool 读取和查询CSV/XLSX表格的工具定义
+var readTableTool = Tool{
+	Type:        "function",
+	Name:        "read_table",
+	Cacheable:   true,
+	Description: "读取CSV、TSV或XLSX表格。action为info时返回工作表、表头、行数和各列的类型与示例；rows返回筛选后的部分行和列；aggregate按列分组统计count、sum、avg、min、max。回答关于数据文件的问题时优先使用该工具，避免把整张表读入上下文。CSV会自动识别GBK等编码和分隔符。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "表格文件路径（.csv、.tsv、.xlsx）",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"info", "rows", "aggregate"},
+				"description": "info查看结构，rows返回数据行，aggregate分组统计，默认rows",
+				"default":     "rows",
+			},
+			"sheet": map[string]interface{}{
+				"type":        "string",
+				"description": "XLSX的工作表名称或序号（从1开始），默认第一个",
+			},
+			"columns": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "要返回的列，可用表头名称或列字母（如A、C），默认全部",
+			},
+			"where": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "筛选条件，同时满足时保留该行，格式为\"列 运算符 值\"，运算符为= != > >= < <= contains，如[\"成绩 >= 90\", \"班级 = 3班\"]",
+			},
+			"group_by": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "aggregate时分组的列，不指定时统计全部行",
+			},
+			"metrics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "aggregate时的统计项，如[\"count\", \"avg(成绩)\", \"max(成绩)\"]，默认count",
+			},
+			"sort_by": map[string]interface{}{
+				"type":        "string",
+				"description": "rows时排序的列，前面加-表示降序，如\"-成绩\"",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "rows时跳过的行数，默认0",
+				"minimum":     0,
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "rows时返回的最多行数，默认20，最多500",
+				"minimum":     1,
+				"maximum":     tableMaxLimit,
+			},
+			"no_header": map[string]interface{}{
+				"type":        "boolean",
+				"description": "第一行是否不是表头，为true时列名为A、B、C...，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// tableParams read_table的参数
+type tableParams struct {
+	Path     string   `json:"path"`
+	Action   string   `json:"action"`
+	Sheet    string   `json:"sheet"`
+	Columns  []string `json:"columns"`
+	Where    []string `json:"where"`
+	GroupBy  []string `json:"group_by"`
+	Metrics  []string `json:"metrics"`
+	SortBy   string   `json:"sort_by"`
+	Offset   int      `json:"offset"`
+	Limit    int      `json:"limit"`
+	NoHeader bool     `json:"no_header"`
+}
+
+// dataTable 读入内存的表格，rows中的每一行都与headers等长
+type dataTable struct {
+	headers []string
+	rows    [][]string
+	sheets  []string // XLSX的全部工作表
+	sheet   string   // 读取的工作表
+	note    string   // 编码、分隔符等说明
+}
+
+// columnLetter 把从0开始的列序号转换为A、B...AA形式的列字母
+func columnLetter(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// columnIndex 把列字母转换为从0开始的列序号，不是列字母时返回-1
+func columnIndex(letters string) int {
+	if letters == "" || len(letters) > 3 {
+		return -1
+	}
+	n := 0
+	for _, c := range strings.ToUpper(letters) {
+		if c < 'A' || c > 'Z' {
+			return -1
+		}
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
+
+// column 按表头名称或列字母查找列，表头名称优先且不区分大小写
+func (t *dataTable) column(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	for i, h := range t.headers {
+		if h == name {
+			return i, nil
+		}
+	}
+	for i, h := range t.headers {
+		if strings.EqualFold(h, name) {
+			return i, nil
+		}
+	}
+	if i := columnIndex(name); i >= 0 && i < len(t.headers) {
+		return i, nil
+	}
+	return -1, fmt.Errorf("找不到列%q，可用的列: %s", name, strings.Join(t.headers, ", "))
+}
+
+// loadTable 根据扩展名读取CSV或XLSX表格
+func loadTable(fullPath string, params tableParams) (*dataTable, error) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > tableMaxFileSize {
+		return nil, fmt.Errorf("文件大小%s超过上限%s", formatSize(info.Size()), formatSize(tableMaxFileSize))
+	}
+
+	var t *dataTable
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(fullPath)) {
+	case ".xlsx", ".xlsm":
+		t, records, err = loadXLSX(fullPath, params.Sheet)
+	case ".xls":
+		return nil, fmt.Errorf("不支持旧版.xls格式，请先另存为.xlsx或.csv")
+	default:
+		t, records, err = loadCSV(fullPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 去掉完全空白的行，并把各行补齐到相同的列数
+	kept := records[:0]
+	width := 0
+	for _, r := range records {
+		if strings.TrimSpace(strings.Join(r, "")) == "" {
+			continue
+		}
+		kept = append(kept, r)
+		width = max(width, len(r))
+	}
+	records = kept
+	for i := range records {
+		for len(records[i]) < width {
+			records[i] = append(records[i], "")
+		}
+	}
+	if params.NoHeader || len(records) == 0 {
+		for i := 0; i < width; i++ {
+			t.headers = append(t.headers, columnLetter(i))
+		}
+		t.rows = records
+		return t, nil
+	}
+	t.headers = records[0]
+	for i, h := range t.headers {
+		if t.headers[i] = strings.TrimSpace(h); t.headers[i] == "" {
+			t.headers[i] = columnLetter(i)
+		}
+	}
+	t.rows = records[1:]
+	return t, nil
+}
+
+// loadCSV 读取CSV，自动识别编码和分隔符
+func loadCSV(fullPath string) (*dataTable, [][]string, error) {
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	text, enc, ok := decodeText(data)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s不是文本文件", fullPath)
+	}
+
+	firstLine, _, _ := strings.Cut(text, "\n")
+	delim := ','
+	if strings.ToLower(filepath.Ext(fullPath)) == ".tsv" {
+		delim = '\t'
+	} else {
+		best := strings.Count(firstLine, ",")
+		for _, d := range []rune{'\t', ';', '|'} {
+			if n := strings.Count(firstLine, string(d)); n > best {
+				delim, best = d, n
+			}
+		}
+	}
+
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = delim
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析CSV失败: %v", err)
+	}
+	names := map[rune]string{',': "逗号", '\t': "制表符", ';': "分号", '|': "竖线"}
+	return &dataTable{note: fmt.Sprintf("编码%s，分隔符为%s", enc.name, names[delim])}, records, nil
+}
+
+// loadXLSX 读取XLSX中的一个工作表，公式单元格使用文件中保存的计算结果
+func loadXLSX(fullPath, sheet string) (*dataTable, [][]string, error) {
+	zr, err := zip.OpenReader(fullPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开XLSX失败: %v", err)
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	readXML := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return os.ErrNotExist
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readXML("xl/workbook.xml", &workbook); err != nil {
+		return nil, nil, fmt.Errorf("读取工作簿失败: %v", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, nil, fmt.Errorf("工作簿中没有工作表")
+	}
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	readXML("xl/_rels/workbook.xml.rels", &rels)
+
+	t := &dataTable{}
+	chosen := -1
+	for i, s := range workbook.Sheets {
+		t.sheets = append(t.sheets, s.Name)
+		if s.Name == sheet || (sheet != "" && strings.EqualFold(s.Name, sheet)) {
+			chosen = i
+		}
+	}
+	if n, err := strconv.Atoi(sheet); err == nil && chosen < 0 && n >= 1 && n <= len(workbook.Sheets) {
+		chosen = n - 1
+	}
+	switch {
+	case sheet == "":
+		chosen = 0
+	case chosen < 0:
+		return nil, nil, fmt.Errorf("找不到工作表%q，可用的工作表: %s", sheet, strings.Join(t.sheets, ", "))
+	}
+	t.sheet = workbook.Sheets[chosen].Name
+
+	target := fmt.Sprintf("worksheets/sheet%d.xml", chosen+1)
+	for _, r := range rels.Items {
+		if r.ID == workbook.Sheets[chosen].RID {
+			target = r.Target
+		}
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	var shared []string
+	var sst struct {
+		Items []struct {
+			T    string `xml:"t"`
+			Runs []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := readXML("xl/sharedStrings.xml", &sst); err == nil {
+		for _, si := range sst.Items {
+			s := si.T
+			for _, r := range si.Runs {
+				s += r.T
+			}
+			shared = append(shared, s)
+		}
+	}
+
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					T    string `xml:"t"`
+					Runs []struct {
+						T string `xml:"t"`
+					} `xml:"r"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXML(target, &ws); err != nil {
+		return nil, nil, fmt.Errorf("读取工作表%s失败: %v", t.sheet, err)
+	}
+
+	var records [][]string
+	for _, row := range ws.Rows {
+		var record []string
+		for _, c := range row.Cells {
+			col := len(record)
+			if c.Ref != "" {
+				letters := strings.TrimRight(c.Ref, "0123456789")
+				if i := columnIndex(letters); i >= 0 {
+					col = i
+				}
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+			value := c.Value
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(c.Value); err == nil && i >= 0 && i < len(shared) {
+					value = shared[i]
+				}
+			case "inlineStr":
+				value = c.Inline.T
+				for _, r := range c.Inline.Runs {
+					value += r.T
+				}
+			case "b":
+				value = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			}
+			record[col] = value
+		}
+		records = append(records, record)
+	}
+	return t, records, nil
+}
+
+// tableCondition 一个筛选条件
+type tableCondition struct {
+	col   int
+	op    string
+	value string
+	num   float64
+	isNum bool
+}
+
+// tableOperators 支持的运算符，较长的放在前面以便优先匹配
+var tableOperators = []string{">=", "<=", "!=", " contains ", "=", ">", "<"}
+
+// parseCondition 解析"列 运算符 值"形式的筛选条件
+func (t *dataTable) parseCondition(expr string) (tableCondition, error) {
+	for _, op := range tableOperators {
+		name, value, ok := strings.Cut(expr, op)
+		if !ok {
+			continue
+		}
+		col, err := t.column(name)
+		if err != nil {
+			return tableCondition{}, err
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		c := tableCondition{col: col, op: strings.TrimSpace(op), value: value}
+		c.num, c.isNum = parseNumber(value)
+		return c, nil
+	}
+	return tableCondition{}, fmt.Errorf("筛选条件%q无效，格式为\"列 运算符 值\"", expr)
+}
+
+// match 判断一行是否满足条件，两边都是数字时按数值比较
+func (c tableCondition) match(row []string) bool {
+	cell := strings.TrimSpace(row[c.col])
+	if c.op == "contains" {
+		return strings.Contains(strings.ToLower(cell), strings.ToLower(c.value))
+	}
+	cmp := strings.Compare(cell, c.value)
+	if n, ok := parseNumber(cell); ok && c.isNum {
+		cmp = compareFloat(n, c.num)
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// parseNumber 把单元格解析为数字，允许千位分隔符和百分号
+func parseNumber(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, false
+	}
+	if percent {
+		n /= 100
+	}
+	return n, true
+}
+
+// compareFloat 比较两个数字
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// formatNumber 格式化统计结果，去掉多余的小数位
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*1e6)/1e6, 'f', -1, 64)
+}
+
+// formatTableRows 以竖线分隔的形式输出表头和数据行
+func formatTableRows(headers []string, rows [][]string) string {
+	var b strings.Builder
+	b.WriteString(strings.Join(headers, " | ") + "\n")
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cell = strings.ReplaceAll(strings.ReplaceAll(cell, "\r\n", " "), "\n", " ")
+			if r := []rune(cell); len(r) > tableMaxCellDisplay {
+				cell = string(r[:tableMaxCellDisplay]) + "..."
+			}
+			cells[i] = cell
+		}
+		b.WriteString(strings.Join(cells, " | ") + "\n")
+	}
+	return b.String()
+}
+
+// readTable 读取表格并按action返回结构、数据行或统计结果
+func (a *ECNUAgent) readTable(args string) (string, error) {
+	params := tableParams{Action: "rows", Limit: tableDefaultLimit}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	params.Limit = max(1, min(params.Limit, tableMaxLimit))
+	params.Offset = max(0, params.Offset)
+
+	fullPath := a.resolvePath(params.Path)
+	log.Printf("[读取表格] %s (%s)\n", fullPath, params.Action)
+	t, err := loadTable(fullPath, params)
+	if err != nil {
+		return fmt.Sprintf("读取表格失败: %v", err), nil
+	}
+
+	label := fullPath
+	if t.sheet != "" {
+		label += " 工作表" + t.sheet
+	}
+	if params.Action == "info" {
+		return t.describe(label), nil
+	}
+
+	var conds []tableCondition
+	for _, expr := range params.Where {
+		c, err := t.parseCondition(expr)
+		if err != nil {
+			return fmt.Sprintf("读取表格失败: %v", err), nil
+		}
+		conds = append(conds, c)
+	}
+	var rows [][]string
+	for _, row := range t.rows {
+		ok := true
+		for _, c := range conds {
+			if !c.match(row) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+
+	switch params.Action {
+	case "rows":
+		result, err := t.selectRows(label, rows, params)
+		if err != nil {
+			return fmt.Sprintf("读取表格失败: %v", err), nil
+		}
+		return result, nil
+	case "aggregate":
+		result, err := t.aggregate(label, rows, params)
+		if err != nil {
+			return fmt.Sprintf("统计失败: %v", err), nil
+		}
+		return result, nil
+	}
+	return "", fmt.Errorf("未知的action: %s", params.Action)
+}
+
+// describe 返回表格的工作表、行数以及各列的类型和示例值
+func (t *dataTable) describe(label string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d行数据，%d列", label, len(t.rows), len(t.headers))
+	if t.note != "" {
+		b.WriteString("（" + t.note + "）")
+	}
+	b.WriteString("\n")
+	if len(t.sheets) > 1 {
+		fmt.Fprintf(&b, "工作表: %s\n", strings.Join(t.sheets, ", "))
+	}
+	b.WriteString("列:\n")
+	for i, h := range t.headers {
+		numbers, filled := 0, 0
+		sample := ""
+		for _, row := range t.rows {
+			cell := strings.TrimSpace(row[i])
+			if cell == "" {
+				continue
+			}
+			filled++
+			if _, ok := parseNumber(cell); ok {
+				numbers++
+			}
+			if sample == "" {
+				sample = cell
+			}
+		}
+		kind := "文本"
+		switch {
+		case filled == 0:
+			kind = "空"
+		case numbers == filled:
+			kind = "数字"
+		case numbers*2 > filled:
+			kind = "多为数字"
+		}
+		if r := []rune(sample); len(r) > 40 {
+			sample = string(r[:40]) + "..."
+		}
+		fmt.Fprintf(&b, "  %s %s: %s，%d个非空值", columnLetter(i), h, kind, filled)
+		if sample != "" {
+			fmt.Fprintf(&b, "，例如 %q", sample)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// selectRows 排序并返回指定范围内的行和列
+func (t *dataTable) selectRows(label string, rows [][]string, params tableParams) (string, error) {
+	cols := make([]int, 0, len(t.headers))
+	if len(params.Columns) == 0 {
+		for i := range t.headers {
+			cols = append(cols, i)
+		}
+	}
+	for _, name := range params.Columns {
+		col, err := t.column(name)
+		if err != nil {
+			return "", err
+		}
+		cols = append(cols, col)
+	}
+	if params.SortBy != "" {
+		desc := strings.HasPrefix(params.SortBy, "-")
+		col, err := t.column(strings.TrimPrefix(params.SortBy, "-"))
+		if err != nil {
+			return "", err
+		}
+		rows = append([][]string(nil), rows...)
+		sort.SliceStable(rows, func(i, j int) bool {
+			x, y := rows[i][col], rows[j][col]
+			cmp := strings.Compare(x, y)
+			if nx, ok := parseNumber(x); ok {
+				if ny, ok := parseNumber(y); ok {
+					cmp = compareFloat(nx, ny)
+				}
+			}
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+	}
+
+	total := len(rows)
+	start := min(params.Offset, total)
+	end := min(start+params.Limit, total)
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = t.headers[c]
+	}
+	selected := make([][]string, 0, end-start)
+	for _, row := range rows[start:end] {
+		cells := make([]string, len(cols))
+		for i, c := range cols {
+			cells[i] = row[c]
+		}
+		selected = append(selected, cells)
+	}
+
+	var b strings.Builder
+	matched := "共"
+	if len(params.Where) > 0 {
+		matched = "符合条件的有"
+	}
+	fmt.Fprintf(&b, "%s: %s%d行", label, matched, total)
+	if total == 0 {
+		return b.String(), nil
+	}
+	fmt.Fprintf(&b, "，以下为第%d-%d行:\n", start+1, end)
+	b.WriteString(formatTableRows(headers, selected))
+	if end < total {
+		fmt.Fprintf(&b, "...（还有%d行，可设置offset为%d继续读取）\n", total-end, end)
+	}
+	return b.String(), nil
+}
+
+// tableMetric 一个统计项，col为-1表示count
+type tableMetric struct {
+	name string
+	fn   string
+	col  int
+}
+
+// aggregate 按分组列统计各项指标，非数字的单元格不参与sum、avg、min、max
+func (t *dataTable) aggregate(label string, rows [][]string, params tableParams) (string, error) {
+	var groupCols []int
+	for _, name := range params.GroupBy {
+		col, err := t.column(name)
+		if err != nil {
+			return "", err
+		}
+		groupCols = append(groupCols, col)
+	}
+	if len(params.Metrics) == 0 {
+		params.Metrics = []string{"count"}
+	}
+	var metrics []tableMetric
+	for _, m := range params.Metrics {
+		m = strings.TrimSpace(m)
+		if strings.EqualFold(m, "count") || strings.EqualFold(m, "count(*)") {
+			metrics = append(metrics, tableMetric{name: "count", fn: "count", col: -1})
+			continue
+		}
+		fn, rest, ok := strings.Cut(m, "(")
+		fn = strings.ToLower(strings.TrimSpace(fn))
+		if !ok || !strings.HasSuffix(rest, ")") {
+			return "", fmt.Errorf("统计项%q无效，格式为count或sum(列)、avg(列)、min(列)、max(列)", m)
+		}
+		switch fn {
+		case "count", "sum", "avg", "min", "max":
+		default:
+			return "", fmt.Errorf("不支持的统计函数: %s", fn)
+		}
+		col, err := t.column(strings.TrimSuffix(rest, ")"))
+		if err != nil {
+			return "", err
+		}
+		metrics = append(metrics, tableMetric{name: fmt.Sprintf("%s(%s)", fn, t.headers[col]), fn: fn, col: col})
+	}
+
+	type groupStats struct {
+		key    []string
+		rows   int
+		counts []int
+		sums   []float64
+		mins   []float64
+		maxs   []float64
+	}
+	groups := map[string]*groupStats{}
+	var order []*groupStats
+	for _, row := range rows {
+		key := make([]string, len(groupCols))
+		for i, c := range groupCols {
+			key[i] = strings.TrimSpace(row[c])
+		}
+		id := strings.Join(key, "\x00")
+		g := groups[id]
+		if g == nil {
+			n := len(metrics)
+			g = &groupStats{key: key, counts: make([]int, n), sums: make([]float64, n), mins: make([]float64, n), maxs: make([]float64, n)}
+			groups[id] = g
+			order = append(order, g)
+		}
+		g.rows++
+		for i, m := range metrics {
+			if m.col < 0 {
+				continue
+			}
+			cell := strings.TrimSpace(row[m.col])
+			if m.fn == "count" {
+				if cell != "" {
+					g.counts[i]++
+				}
+				continue
+			}
+			n, ok := parseNumber(cell)
+			if !ok {
+				continue
+			}
+			if g.counts[i] == 0 || n < g.mins[i] {
+				g.mins[i] = n
+			}
+			if g.counts[i] == 0 || n > g.maxs[i] {
+				g.maxs[i] = n
+			}
+			g.counts[i]++
+			g.sums[i] += n
+		}
+	}
+	if len(groupCols) == 0 && len(order) == 0 {
+		order = append(order, &groupStats{counts: make([]int, len(metrics)), sums: make([]float64, len(metrics)), mins: make([]float64, len(metrics)), maxs: make([]float64, len(metrics))})
+	}
+
+	var headers []string
+	for _, c := range groupCols {
+		headers = append(headers, t.headers[c])
+	}
+	for _, m := range metrics {
+		headers = append(headers, m.name)
+	}
+	var out [][]string
+	for _, g := range order {
+		cells := append([]string(nil), g.key...)
+		for i, m := range metrics {
+			value := ""
+			switch {
+			case m.col < 0:
+				value = strconv.Itoa(g.rows)
+			case m.fn == "count":
+				value = strconv.Itoa(g.counts[i])
+			case g.counts[i] == 0:
+				value = "-"
+			case m.fn == "sum":
+				value = formatNumber(g.sums[i])
+			case m.fn == "avg":
+				value = formatNumber(g.sums[i] / float64(g.counts[i]))
+			case m.fn == "min":
+				value = formatNumber(g.mins[i])
+			case m.fn == "max":
+				value = formatNumber(g.maxs[i])
+			}
+			cells = append(cells, value)
+		}
+		out = append(out, cells)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: 统计%d行", label, len(rows))
+	if len(groupCols) > 0 {
+		fmt.Fprintf(&b, "，共%d组", len(out))
+	}
+	b.WriteString(":\n")
+	shown := out
+	if len(shown) > tableMaxGroups {
+		shown = shown[:tableMaxGroups]
+	}
+	b.WriteString(formatTableRows(headers, shown))
+	if len(out) > len(shown) {
+		fmt.Fprintf(&b, "...（还有%d组未显示，可用where缩小范围）\n", len(out)-len(shown))
+	}
+	return b.String(), nil
+}
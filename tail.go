@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	tailDefaultLines   = 50                     // tail_file默认返回的行数
+	tailMaxLines       = 1000                   // 返回行数的上限
+	tailDefaultSeconds = 10                     // 跟踪模式默认的时长
+	tailMaxSeconds     = 300                    // 跟踪时长的上限
+	tailMaxFollowBytes = 1024 * 1024            // 跟踪期间最多读取的新内容
+	tailPollInterval   = 250 * time.Millisecond // 跟踪时检查文件变化的间隔
+)
+
+// tailFileTool 读取文件末尾并可持续跟踪的工具定义
+var tailFileTool = Tool{
+	Type:        "function",
+	Name:        "tail_file",
+	Sequential:  true,
+	Description: "读取文件的最后N行，适合查看日志。设置follow后会继续跟踪文件一段时间，把期间新写入的行一并返回（类似tail -f），文件被截断或轮转时从头读取。可用filter只保留匹配正则表达式的行。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "文件路径",
+			},
+			"lines": map[string]interface{}{
+				"type":        "integer",
+				"description": "返回的最后行数，默认50，最多1000",
+				"minimum":     0,
+				"maximum":     tailMaxLines,
+			},
+			"follow": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否继续跟踪新写入的内容，默认false",
+				"default":     false,
+			},
+			"duration": map[string]interface{}{
+				"type":        "integer",
+				"description": "跟踪的时长（秒），默认10，最多300",
+				"minimum":     1,
+				"maximum":     tailMaxSeconds,
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "只返回匹配该正则表达式的行，如ERROR|WARN",
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// tailLines 从文件末尾向前读取，返回最后n行和文件当前大小
+func tailLines(f *os.File, n int) ([]string, int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := info.Size()
+	if n == 0 {
+		return nil, size, nil
+	}
+
+	const chunk = 64 * 1024
+	var buf []byte
+	offset := size
+	// 多读一个换行符，保证第一行是完整的
+	for offset > 0 && bytes.Count(buf, []byte{'\n'}) <= n {
+		readSize := min(int64(chunk), offset)
+		offset -= readSize
+		part := make([]byte, readSize)
+		if _, err := f.ReadAt(part, offset); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		buf = append(part, buf...)
+	}
+	lines := splitLines(decodeTail(buf))
+	if offset > 0 && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, size, nil
+}
+
+// decodeTail 把读取的内容解码为文本并统一换行符，无法识别的编码按UTF-8处理
+func decodeTail(data []byte) string {
+	text, _, ok := decodeText(data)
+	if !ok {
+		text = string(data)
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// tailFile 返回文件的最后几行，follow时继续收集新写入的行
+func (a *ECNUAgent) tailFile(ctx context.Context, args string) (string, error) {
+	params := struct {
+		Path     string `json:"path"`
+		Lines    int    `json:"lines"`
+		Follow   bool   `json:"follow"`
+		Duration int    `json:"duration"`
+		Filter   string `json:"filter"`
+	}{Lines: tailDefaultLines, Duration: tailDefaultSeconds}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	params.Lines = max(0, min(params.Lines, tailMaxLines))
+	params.Duration = max(1, min(params.Duration, tailMaxSeconds))
+	if limit := a.config.ToolTimeout; limit > 0 && params.Duration >= limit {
+		params.Duration = max(1, limit-5)
+	}
+	var filter *regexp.Regexp
+	if params.Filter != "" {
+		var err error
+		if filter, err = regexp.Compile(params.Filter); err != nil {
+			return fmt.Sprintf("读取失败: filter不是有效的正则表达式: %v", err), nil
+		}
+	}
+	keep := func(lines []string) []string {
+		if filter == nil {
+			return lines
+		}
+		var kept []string
+		for _, line := range lines {
+			if filter.MatchString(line) {
+				kept = append(kept, line)
+			}
+		}
+		return kept
+	}
+
+	fullPath := a.resolvePath(params.Path)
+	log.Printf("[文件末尾] %s (行数: %d, 跟踪: %v)\n", fullPath, params.Lines, params.Follow)
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Sprintf("读取失败: %v", err), nil
+	}
+	defer f.Close()
+
+	// 有过滤条件时从更多的行中筛选，尽量凑够请求的行数
+	scan := params.Lines
+	if filter != nil && scan > 0 {
+		scan = tailMaxLines * 10
+	}
+	lines, offset, err := tailLines(f, scan)
+	if err != nil {
+		return fmt.Sprintf("读取失败: %v", err), nil
+	}
+	lines = keep(lines)
+	if len(lines) > params.Lines {
+		lines = lines[len(lines)-params.Lines:]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 的最后%d行", fullPath, len(lines))
+	if filter != nil {
+		fmt.Fprintf(&b, "（匹配 %s）", params.Filter)
+	}
+	b.WriteString(":\n")
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	if !params.Follow {
+		return b.String(), nil
+	}
+
+	added, notes, err := followFile(ctx, fullPath, f, offset, time.Duration(params.Duration)*time.Second)
+	if err != nil {
+		return "", err
+	}
+	added = keep(added)
+	fmt.Fprintf(&b, "\n跟踪%d秒，新增%d行:\n", params.Duration, len(added))
+	for _, note := range notes {
+		b.WriteString("（" + note + "）\n")
+	}
+	for _, line := range added {
+		b.WriteString(line + "\n")
+	}
+	return b.String(), nil
+}
+
+// followFile 在给定时长内轮询文件，返回新写入的完整行，文件被截断或替换时从头读取
+func followFile(ctx context.Context, path string, f *os.File, offset int64, duration time.Duration) ([]string, []string, error) {
+	var lines, notes []string
+	var partial []byte
+	var opened *os.File
+	read := int64(0)
+	deadline := time.After(duration)
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	// 轮转后打开的新文件由这里关闭，原文件由调用方关闭
+	defer func() {
+		if opened != nil {
+			opened.Close()
+		}
+	}()
+
+	flush := func(data []byte) {
+		partial = append(partial, data...)
+		if i := bytes.LastIndexByte(partial, '\n'); i >= 0 {
+			lines = append(lines, splitLines(decodeTail(partial[:i+1]))...)
+			partial = append([]byte(nil), partial[i+1:]...)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-deadline:
+			if len(partial) > 0 {
+				lines = append(lines, decodeTail(partial))
+			}
+			return lines, notes, nil
+		case <-ticker.C:
+		}
+
+		// 日志轮转时路径指向新文件，改为读取新文件
+		if info, err := os.Stat(path); err == nil {
+			if current, err := f.Stat(); err == nil && !os.SameFile(info, current) {
+				if nf, err := os.Open(path); err == nil {
+					if opened != nil {
+						opened.Close()
+					}
+					opened, f, offset = nf, nf, 0
+					notes = append(notes, "文件已被替换，从新文件开头读取")
+				}
+			}
+		}
+		info, err := f.Stat()
+		if err != nil {
+			continue
+		}
+		if info.Size() < offset {
+			notes = append(notes, "文件被截断，从头读取")
+			offset = 0
+		}
+		if info.Size() == offset || read >= tailMaxFollowBytes {
+			continue
+		}
+		data := make([]byte, min(info.Size()-offset, tailMaxFollowBytes-read))
+		n, err := f.ReadAt(data, offset)
+		if n > 0 {
+			offset += int64(n)
+			read += int64(n)
+			flush(data[:n])
+		}
+		if err != nil && err != io.EOF {
+			return lines, notes, nil
+		}
+		if read >= tailMaxFollowBytes {
+			notes = append(notes, fmt.Sprintf("新内容超过%s，之后的内容未读取", formatSize(tailMaxFollowBytes)))
+		}
+	}
+}
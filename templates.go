@@ -0,0 +1,494 @@
+package main
+
+// scaffoldVar 模板变量，defaultValue为空时根据其他变量推导
+type scaffoldVar struct {
+	name         string
+	description  string
+	defaultValue string
+}
+
+// scaffoldFile 模板中的一个文件，路径和内容中的[[变量名]]会被替换
+type scaffoldFile struct {
+	path    string
+	content string
+	mode    uint32
+	binary  bool // 用户模板中的二进制文件，内容不做替换
+}
+
+// scaffoldTemplate 一个项目模板
+type scaffoldTemplate struct {
+	name        string
+	description string
+	vars        []scaffoldVar
+	files       []scaffoldFile
+	next        string // 创建后的下一步操作提示
+	dir         string // 用户模板所在的目录，内置模板为空
+}
+
+// scaffoldCommonVars 所有模板都支持的变量
+var scaffoldCommonVars = []scaffoldVar{
+	{name: "name", description: "项目名称，默认为目标目录名"},
+	{name: "description", description: "项目简介", defaultValue: "A new project"},
+	{name: "author", description: "作者，默认读取git的user.name"},
+	{name: "year", description: "年份，默认为今年"},
+}
+
+// builtinTemplates 内置的项目模板
+var builtinTemplates = []scaffoldTemplate{
+	{
+		name:        "go-cli",
+		description: "Go命令行程序（go.mod、flag参数解析、Makefile）",
+		vars: []scaffoldVar{
+			{name: "module", description: "Go模块路径，默认为项目名称"},
+		},
+		next: "cd [[name]] && go build ./... && ./[[name]] -h",
+		files: []scaffoldFile{
+			{path: "go.mod", content: `module [[module]]
+
+go 1.21
+`},
+			{path: "main.go", content: `// [[name]]: [[description]]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+var version = "0.1.0"
+
+func main() {
+	showVersion := flag.Bool("version", false, "显示版本号")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s [选项] [参数...]\n\n[[description]]\n\n选项:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("[[name]]", version)
+		return
+	}
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		os.Exit(1)
+	}
+}
+
+// run 程序的主要逻辑
+func run(args []string) error {
+	fmt.Println("Hello from [[name]]!", args)
+	return nil
+}
+`},
+			{path: "main_test.go", content: `package main
+
+import "testing"
+
+func TestRun(t *testing.T) {
+	if err := run(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+`},
+			{path: "Makefile", content: `BINARY := [[name]]
+
+.PHONY: build test clean
+
+build:
+	go build -o $(BINARY) .
+
+test:
+	go test ./...
+
+clean:
+	rm -f $(BINARY)
+`},
+			{path: ".gitignore", content: `/[[name]]
+*.exe
+*.test
+*.out
+`},
+			{path: "README.md", content: `# [[name]]
+
+[[description]]
+
+## 构建
+
+    go build -o [[name]] .
+
+## 使用
+
+    ./[[name]] -h
+
+Copyright (c) [[year]] [[author]]
+`},
+		},
+	},
+	{
+		name:        "python-package",
+		description: "Python包（pyproject.toml、src布局、命令行入口、pytest测试）",
+		vars: []scaffoldVar{
+			{name: "package", description: "Python包名，默认由项目名称转换而来（小写，-替换为_）"},
+		},
+		next: "cd [[name]] && python -m venv .venv && . .venv/bin/activate && pip install -e '.[dev]' && pytest",
+		files: []scaffoldFile{
+			{path: "pyproject.toml", content: `[build-system]
+requires = ["setuptools>=61"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "[[name]]"
+version = "0.1.0"
+description = "[[description]]"
+readme = "README.md"
+requires-python = ">=3.8"
+authors = [{ name = "[[author]]" }]
+dependencies = []
+
+[project.optional-dependencies]
+dev = ["pytest"]
+
+[project.scripts]
+[[name]] = "[[package]].cli:main"
+
+[tool.setuptools.packages.find]
+where = ["src"]
+`},
+			{path: "src/[[package]]/__init__.py", content: `"""[[description]]"""
+
+__version__ = "0.1.0"
+`},
+			{path: "src/[[package]]/__main__.py", content: `from .cli import main
+
+raise SystemExit(main())
+`},
+			{path: "src/[[package]]/cli.py", content: `"""[[name]] 的命令行入口"""
+
+import argparse
+
+from . import __version__
+
+
+def main(argv=None):
+    parser = argparse.ArgumentParser(prog="[[name]]", description="[[description]]")
+    parser.add_argument("--version", action="version", version=f"%(prog)s {__version__}")
+    parser.add_argument("args", nargs="*", help="参数")
+    ns = parser.parse_args(argv)
+    print(f"Hello from [[name]]! {ns.args}")
+    return 0
+`},
+			{path: "tests/test_cli.py", content: `from [[package]].cli import main
+
+
+def test_main():
+    assert main([]) == 0
+`},
+			{path: ".gitignore", content: `__pycache__/
+*.py[cod]
+*.egg-info/
+.venv/
+build/
+dist/
+.pytest_cache/
+`},
+			{path: "README.md", content: `# [[name]]
+
+[[description]]
+
+## 安装
+
+    pip install -e '.[dev]'
+
+## 使用
+
+    [[name]] --help
+    python -m [[package]] --help
+
+Copyright (c) [[year]] [[author]]
+`},
+		},
+	},
+	{
+		name:        "latex-thesis",
+		description: "中文学位论文（ctexbook、按章节拆分、BibLaTeX参考文献、latexmk）",
+		vars: []scaffoldVar{
+			{name: "title", description: "论文题目，默认为项目名称"},
+			{name: "school", description: "学校", defaultValue: "华东师范大学"},
+			{name: "degree", description: "学位", defaultValue: "硕士"},
+			{name: "major", description: "专业", defaultValue: "计算机科学与技术"},
+			{name: "supervisor", description: "指导教师", defaultValue: "某某 教授"},
+		},
+		next: "cd [[name]] && latexmk main.tex（需要安装TeX Live，使用XeLaTeX编译）",
+		files: []scaffoldFile{
+			{path: "main.tex", content: `\documentclass[UTF8,a4paper,zihao=-4,openany]{ctexbook}
+
+\usepackage[top=2.5cm,bottom=2.5cm,left=3cm,right=2.5cm]{geometry}
+\usepackage{amsmath,amssymb,amsthm}
+\usepackage{graphicx}
+\usepackage{booktabs}
+\usepackage[backend=biber,style=gb7714-2015]{biblatex}
+\usepackage[hidelinks]{hyperref}
+
+\addbibresource{references.bib}
+\graphicspath{{figures/}}
+
+\newtheorem{theorem}{定理}[chapter]
+\newtheorem{definition}{定义}[chapter]
+
+\title{[[title]]}
+\author{[[author]]}
+\date{[[year]]年}
+
+\begin{document}
+
+\frontmatter
+\begin{titlepage}
+  \centering
+  \vspace*{3cm}
+  {\zihao{2}\bfseries [[school]]\par}
+  \vspace{1cm}
+  {\zihao{3} [[degree]]学位论文\par}
+  \vspace{2cm}
+  {\zihao{2}\bfseries [[title]]\par}
+  \vfill
+  {\zihao{4}
+  \begin{tabular}{rl}
+    作\quad 者： & [[author]] \\
+    专\quad 业： & [[major]] \\
+    指导教师： & [[supervisor]] \\
+  \end{tabular}\par}
+  \vspace{2cm}
+  {\zihao{4} [[year]]年\par}
+\end{titlepage}
+
+\input{chapters/abstract}
+\tableofcontents
+
+\mainmatter
+\input{chapters/introduction}
+\input{chapters/method}
+\input{chapters/conclusion}
+
+\backmatter
+\printbibliography[heading=bibintoc,title={参考文献}]
+\input{chapters/acknowledgements}
+
+\end{document}
+`},
+			{path: "chapters/abstract.tex", content: `\chapter*{摘要}
+\addcontentsline{toc}{chapter}{摘要}
+
+在此撰写中文摘要。
+
+\textbf{关键词：}关键词1；关键词2；关键词3
+
+\chapter*{Abstract}
+\addcontentsline{toc}{chapter}{Abstract}
+
+Write the English abstract here.
+
+\textbf{Keywords:} keyword1; keyword2; keyword3
+`},
+			{path: "chapters/introduction.tex", content: `\chapter{绪论}
+\label{chap:introduction}
+
+\section{研究背景}
+
+在此介绍研究背景，引用文献示例\cite{knuth1984}。
+
+\section{本文的主要工作}
+
+\section{论文结构}
+`},
+			{path: "chapters/method.tex", content: `\chapter{研究方法}
+\label{chap:method}
+
+\section{问题定义}
+
+\begin{definition}
+在此给出定义。
+\end{definition}
+
+\section{实验结果}
+
+\begin{table}[htbp]
+  \centering
+  \caption{示例表格}
+  \begin{tabular}{lcc}
+    \toprule
+    方法 & 准确率 & 耗时 \\
+    \midrule
+    基线 & 0.80 & 1.0 \\
+    本文 & 0.90 & 0.8 \\
+    \bottomrule
+  \end{tabular}
+\end{table}
+`},
+			{path: "chapters/conclusion.tex", content: `\chapter{总结与展望}
+\label{chap:conclusion}
+
+\section{总结}
+
+\section{展望}
+`},
+			{path: "chapters/acknowledgements.tex", content: `\chapter*{致谢}
+\addcontentsline{toc}{chapter}{致谢}
+
+感谢[[supervisor]]的悉心指导。
+`},
+			{path: "references.bib", content: `@book{knuth1984,
+  author    = {Donald E. Knuth},
+  title     = {The {\TeX}book},
+  publisher = {Addison-Wesley},
+  year      = {1984},
+}
+`},
+			{path: "figures/.gitkeep", content: ""},
+			{path: ".latexmkrc", content: `$pdf_mode = 5;
+$xelatex = 'xelatex -interaction=nonstopmode -synctex=1 %O %S';
+$bibtex_use = 2;
+`},
+			{path: ".gitignore", content: `*.aux
+*.bbl
+*.bcf
+*.blg
+*.fdb_latexmk
+*.fls
+*.log
+*.out
+*.run.xml
+*.synctex.gz
+*.toc
+*.xdv
+main.pdf
+`},
+			{path: "README.md", content: `# [[title]]
+
+[[school]][[degree]]学位论文，作者[[author]]。
+
+## 编译
+
+需要TeX Live（含ctex、biblatex-gb7714-2015和biber）：
+
+    latexmk main.tex
+
+章节位于 chapters/ 目录，参考文献在 references.bib，图片放在 figures/。
+`},
+		},
+	},
+	{
+		name:        "vue-app",
+		description: "Vue 3单页应用（Vite构建、单文件组件）",
+		next:        "cd [[name]] && npm install && npm run dev",
+		files: []scaffoldFile{
+			{path: "package.json", content: `{
+  "name": "[[name]]",
+  "version": "0.1.0",
+  "private": true,
+  "description": "[[description]]",
+  "author": "[[author]]",
+  "type": "module",
+  "scripts": {
+    "dev": "vite",
+    "build": "vite build",
+    "preview": "vite preview"
+  },
+  "dependencies": {
+    "vue": "^3.4.0"
+  },
+  "devDependencies": {
+    "@vitejs/plugin-vue": "^5.0.0",
+    "vite": "^5.0.0"
+  }
+}
+`},
+			{path: "vite.config.js", content: `import { defineConfig } from 'vite'
+import vue from '@vitejs/plugin-vue'
+
+export default defineConfig({
+  plugins: [vue()],
+})
+`},
+			{path: "index.html", content: `<!DOCTYPE html>
+<html lang="zh-CN">
+  <head>
+    <meta charset="UTF-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>[[name]]</title>
+  </head>
+  <body>
+    <div id="app"></div>
+    <script type="module" src="/src/main.js"></script>
+  </body>
+</html>
+`},
+			{path: "src/main.js", content: `import { createApp } from 'vue'
+import App from './App.vue'
+import './style.css'
+
+createApp(App).mount('#app')
+`},
+			{path: "src/App.vue", content: `<script setup>
+import HelloWorld from './components/HelloWorld.vue'
+</script>
+
+<template>
+  <main>
+    <h1>[[name]]</h1>
+    <p>[[description]]</p>
+    <HelloWorld />
+  </main>
+</template>
+
+<style scoped>
+main {
+  max-width: 720px;
+  margin: 0 auto;
+  padding: 2rem;
+}
+</style>
+`},
+			{path: "src/components/HelloWorld.vue", content: `<script setup>
+import { ref } from 'vue'
+
+const count = ref(0)
+</script>
+
+<template>
+  <button type="button" @click="count++">点击次数: {{ count }}</button>
+</template>
+`},
+			{path: "src/style.css", content: `:root {
+  font-family: system-ui, -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif;
+  line-height: 1.5;
+}
+
+body {
+  margin: 0;
+}
+`},
+			{path: "public/.gitkeep", content: ""},
+			{path: ".gitignore", content: `node_modules/
+dist/
+*.local
+`},
+			{path: "README.md", content: `# [[name]]
+
+[[description]]
+
+## 开发
+
+    npm install
+    npm run dev
+
+## 构建
+
+    npm run build
+
+Copyright (c) [[year]] [[author]]
+`},
+		},
+	},
+}
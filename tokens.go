@@ -0,0 +1,69 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 与OpenAI计费规则一致的消息格式开销
+const (
+	tokensPerMessage = 4 // 每条消息的角色与分隔符开销
+	tokensPerReply   = 3 // 每次回复的起始标记开销
+)
+
+// estimateTokens 估算文本的token数，结果近似cl100k_base分词器
+//
+// 英文单词、数字按约4个字符一个token计算，中日韩文字和标点按每字一个token计算，
+// 空白字符并入相邻单词。估算值略偏保守，用于预算控制而非精确计费。
+func estimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// estimateMessageTokens 估算单条消息的token数，包含工具调用参数
+func estimateMessageTokens(msg openai.ChatCompletionMessage) int {
+	tokens := tokensPerMessage + estimateTokens(msg.Role) + estimateTokens(msg.Content)
+	for _, part := range msg.MultiContent {
+		tokens += estimateTokens(part.Text)
+		if part.ImageURL != nil {
+			tokens += imageTokens
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		tokens += estimateTokens(call.ID) + estimateTokens(call.Function.Name) + estimateTokens(call.Function.Arguments)
+	}
+	if msg.ToolCallID != "" {
+		tokens += estimateTokens(msg.ToolCallID)
+	}
+	return tokens
+}
+
+// estimateHistoryTokens 估算整段消息列表作为请求发送时的token数
+func estimateHistoryTokens(messages []openai.ChatCompletionMessage) int {
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += estimateMessageTokens(msg)
+	}
+	return tokens
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// runToolCalls 执行一条助手消息中的全部工具调用，结果按调用顺序返回
+//
+// 连续的可并行工具由有限大小的工作池并发执行；带副作用、声明为顺序执行的工具
+// 作为屏障单独执行，保证其前后的调用不会与之交错。
+func (a *ECNUAgent) runToolCalls(ctx context.Context, calls []openai.ToolCall) []openai.ChatCompletionMessage {
+	results := make([]openai.ChatCompletionMessage, len(calls))
+
+	start := 0
+	for start < len(calls) {
+		end := start + 1
+		if !a.isSequentialCall(calls[start]) {
+			for end < len(calls) && !a.isSequentialCall(calls[end]) {
+				end++
+			}
+		}
+		a.runBatch(ctx, calls[start:end], results[start:end])
+		start = end
+	}
+	return results
+}
+
+// runBatch 使用工作池并发执行一批互不依赖的工具调用
+func (a *ECNUAgent) runBatch(ctx context.Context, calls []openai.ToolCall, results []openai.ChatCompletionMessage) {
+	workers := a.config.ToolWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call openai.ToolCall) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    a.runToolCall(ctx, call),
+				ToolCallID: call.ID,
+			}
+		}(i, call)
+	}
+	wg.Wait()
+}
+
+// runToolCall 执行单个工具调用，启用缓存时只读调用可以直接复用本轮任务中的结果
+func (a *ECNUAgent) runToolCall(ctx context.Context, call openai.ToolCall) string {
+	// 中断后仍需为每个工具调用补齐结果，保证历史记录可以继续使用
+	if ctx.Err() != nil {
+		return "工具调用已取消：用户中断了任务"
+	}
+	step := int(a.step.Load())
+	a.events.toolCall(step, call)
+	ok := true // 使用缓存的结果时视为成功
+	run := func() (string, bool) {
+		var result string
+		result, ok = a.invokeTool(ctx, call)
+		return result, ok
+	}
+	var result string
+	if a.config.ToolCache {
+		result = a.cachedToolCall(call, run)
+	} else {
+		result, _ = run()
+	}
+	a.events.toolResult(step, call, result, ok)
+	return result
+}
+
+// invokeTool 在单个工具的超时限制内执行调用，失败和超时都转换为结果文本，ok表示执行成功
+func (a *ECNUAgent) invokeTool(ctx context.Context, call openai.ToolCall) (result string, ok bool) {
+	defer func() {
+		a.toolStats.record(call.Function.Name, result, ok)
+		if a.config.logLevel() == logVerbose {
+			log.Printf("[结果] %s\n%s", call.Function.Name, resultPreview(call, result, a.config.colorDiagnostics()))
+		}
+	}()
+
+	toolCtx := ctx
+	if timeout := a.config.ToolTimeout; timeout > 0 {
+		var deadline *toolDeadline
+		toolCtx, deadline = withToolDeadline(ctx, time.Duration(timeout)*time.Second)
+		defer deadline.stop()
+	}
+
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := a.executeTool(toolCtx, call)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return fmt.Sprintf("工具执行失败: %v", out.err), false
+		}
+		if call.Function.Name == readToolOutputTool.Name {
+			return out.result, true
+		}
+		return a.truncateToolOutput(out.result), true
+	case <-toolCtx.Done():
+		if a.isSequentialCall(call) {
+			// 不响应取消的工具仍可能在修改文件，等它真正结束，保证不与之后的调用交错
+			select {
+			case <-done:
+			default:
+				log.Printf("[警告] %s 已被取消，等待其结束后再继续\n", call.Function.Name)
+				<-done
+			}
+		}
+		if ctx.Err() != nil {
+			return "工具调用已取消：用户中断了任务", false
+		}
+		if errors.Is(context.Cause(toolCtx), errToolTimeout) {
+			return fmt.Sprintf("工具执行失败: 超过单个工具的时间限制（%d秒）", a.config.ToolTimeout), false
+		}
+		return fmt.Sprintf("工具执行失败: %v", toolCtx.Err()), false
+	}
+}
+
+// errToolTimeout 工具调用超过时间限制时取消的原因
+var errToolTimeout = errors.New("超过单个工具的时间限制")
+
+// toolDeadlineKey 在context中保存工具调用时间限制的键
+type toolDeadlineKey struct{}
+
+// toolDeadline 单个工具调用的时间限制，等待用户确认的时间不计入
+//
+// 子智能体的工具调用嵌套在spawn_agent之内，暂停时外层的时间限制一并暂停。
+type toolDeadline struct {
+	mu        sync.Mutex
+	parent    *toolDeadline
+	cancel    context.CancelCauseFunc
+	timer     *time.Timer
+	started   time.Time     // 本次计时开始的时间
+	remaining time.Duration // 本次计时开始时剩余的时间
+	paused    int           // 正在等待的确认数，并发的确认可能重叠
+	expired   bool
+}
+
+// withToolDeadline 返回limit后以errToolTimeout取消的context，结束时需调用stop
+func withToolDeadline(ctx context.Context, limit time.Duration) (context.Context, *toolDeadline) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	d := &toolDeadline{parent: toolDeadlineFrom(ctx), cancel: cancel, remaining: limit}
+	d.start()
+	return context.WithValue(ctx, toolDeadlineKey{}, d), d
+}
+
+// toolDeadlineFrom 返回ctx所属工具调用的时间限制，不在工具调用中或未设置时间限制时返回nil
+func toolDeadlineFrom(ctx context.Context) *toolDeadline {
+	d, _ := ctx.Value(toolDeadlineKey{}).(*toolDeadline)
+	return d
+}
+
+// start 开始计时，调用时需持有锁或尚未共享
+func (d *toolDeadline) start() {
+	d.started = time.Now()
+	d.timer = time.AfterFunc(d.remaining, func() {
+		d.mu.Lock()
+		d.expired = true
+		d.mu.Unlock()
+		d.cancel(errToolTimeout)
+	})
+}
+
+// pause 暂停计时，与resume成对调用
+func (d *toolDeadline) pause() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.paused++
+	if d.paused == 1 && d.timer.Stop() {
+		d.remaining -= time.Since(d.started)
+	}
+	d.mu.Unlock()
+	d.parent.pause()
+}
+
+// resume 继续计时，已经超时的不再计时
+func (d *toolDeadline) resume() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.paused--
+	if d.paused == 0 && !d.expired {
+		d.start()
+	}
+	d.mu.Unlock()
+	d.parent.resume()
+}
+
+// stop 结束计时并释放context
+func (d *toolDeadline) stop() {
+	d.mu.Lock()
+	d.timer.Stop()
+	d.expired = true
+	d.mu.Unlock()
+	d.cancel(nil)
+}
+
+// isSequentialCall 判断工具调用是否需要单独顺序执行
+//
+// execute_command可以执行任意命令，只有保守判断为只读的命令才与其他调用并发；
+// 只读命令不会改变保留的shell状态，并发执行时各自写回的状态相同。
+func (a *ECNUAgent) isSequentialCall(call openai.ToolCall) bool {
+	if call.Function.Name == "execute_command" {
+		var params struct {
+			Command string `json:"command"`
+			Reset   bool   `json:"reset"`
+		}
+		if json.Unmarshal([]byte(call.Function.Arguments), &params) == nil && !params.Reset && isReadOnlyCommand(params.Command) {
+			return false
+		}
+	}
+	return a.isSequentialTool(call.Function.Name)
+}
+
+// isSequentialTool 判断工具是否需要单独顺序执行
+func (a *ECNUAgent) isSequentialTool(name string) bool {
+	for _, tool := range a.tools {
+		if tool.Name == name {
+			return tool.Sequential
+		}
+	}
+	return true
+}
+
+// toolStat 单个工具在本次会话中的调用情况
+type toolStat struct {
+	calls     int
+	failures  int
+	lastError string // 最近一次失败的结果
+}
+
+// toolStats 本次会话中各工具的调用次数和失败次数，供/tools显示
+type toolStats struct {
+	mu    sync.Mutex
+	stats map[string]toolStat
+}
+
+// record 记录一次调用的结果
+func (t *toolStats) record(name, result string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stats == nil {
+		t.stats = make(map[string]toolStat)
+	}
+	stat := t.stats[name]
+	stat.calls++
+	if !ok {
+		stat.failures++
+		stat.lastError = result
+	}
+	t.stats[name] = stat
+}
+
+// get 返回工具的调用情况，未调用过时ok为false
+func (t *toolStats) get(name string) (toolStat, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stat, ok := t.stats[name]
+	return stat, ok
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sshDialTimeout = 15 * time.Second // 建立SSH连接的超时时间
+
+// transferFileTool 通过SFTP在本地和远程主机之间传输文件的工具定义
+var transferFileTool = Tool{
+	Type:       "function",
+	Name:       "transfer_file",
+	Sequential: true,
+	Description: "通过SFTP在工作区和远程主机之间传输文件或目录，代替需要交互输入的scp。action为push时上传本地文件，pull时下载远程文件，目录会递归传输。" +
+		"使用~/.ssh/config中的主机别名、用户名、端口和密钥，以及ssh-agent中的密钥，不支持密码登录。上传前会请用户确认。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"push", "pull"},
+				"description": "push上传到远程主机，pull从远程主机下载",
+			},
+			"host": map[string]interface{}{
+				"type":        "string",
+				"description": "远程主机，可以是~/.ssh/config中的别名或user@host:port",
+			},
+			"local": map[string]interface{}{
+				"type":        "string",
+				"description": "本地路径",
+			},
+			"remote": map[string]interface{}{
+				"type":        "string",
+				"description": "远程路径，相对路径从登录用户的主目录开始；以/结尾或为已有目录时保留原文件名",
+			},
+		},
+		"required": []string{"action", "host", "local", "remote"},
+	},
+}
+
+// sshHost 连接远程主机所需的配置
+type sshHost struct {
+	alias      string
+	hostname   string
+	user       string
+	port       int
+	identities []string
+}
+
+// address 返回host:port形式的地址
+func (h sshHost) address() string {
+	return net.JoinHostPort(h.hostname, strconv.Itoa(h.port))
+}
+
+// sshDir 返回~/.ssh目录
+func sshDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh")
+}
+
+// expandTilde 把开头的~替换为用户主目录
+func expandTilde(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
+
+// matchSSHHost 判断别名是否匹配Host行中的模式，以!开头的模式匹配时整行不生效
+func matchSSHHost(patterns []string, alias string) bool {
+	matched := false
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		ok, _ := path.Match(strings.ToLower(strings.TrimPrefix(p, "!")), strings.ToLower(alias))
+		if ok && negate {
+			return false
+		}
+		matched = matched || ok
+	}
+	return matched
+}
+
+// parseSSHTarget 解析[user@]host[:port]，再按~/.ssh/config补全主机名、用户、端口和密钥，同一配置以最先出现的为准
+func parseSSHTarget(target, configPath string) (sshHost, error) {
+	var h sshHost
+	if u, rest, ok := strings.Cut(target, "@"); ok {
+		h.user, target = u, rest
+	}
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return h, fmt.Errorf("端口无效: %q", port)
+		}
+		target, h.port = host, n
+	}
+	if target == "" {
+		return h, fmt.Errorf("缺少主机名")
+	}
+	h.alias = target
+
+	if data, err := os.ReadFile(configPath); err == nil {
+		active := true
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, _ := strings.Cut(strings.Replace(line, "=", " ", 1), " ")
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			switch strings.ToLower(key) {
+			case "host":
+				active = matchSSHHost(strings.Fields(value), h.alias)
+			case "match":
+				// 不支持Match条件，其后的配置一律忽略
+				active = false
+			case "hostname":
+				if active && h.hostname == "" {
+					h.hostname = strings.ReplaceAll(value, "%h", h.alias)
+				}
+			case "user":
+				if active && h.user == "" {
+					h.user = value
+				}
+			case "port":
+				if active && h.port == 0 {
+					h.port, _ = strconv.Atoi(value)
+				}
+			case "identityfile":
+				if active {
+					h.identities = append(h.identities, expandTilde(value))
+				}
+			}
+		}
+	}
+
+	if h.hostname == "" {
+		h.hostname = h.alias
+	}
+	if h.port == 0 {
+		h.port = 22
+	}
+	if h.user == "" {
+		if u, err := user.Current(); err == nil {
+			// Windows上的用户名带有域名前缀
+			h.user = u.Username[strings.LastIndex(u.Username, `\`)+1:]
+		}
+	}
+	if len(h.identities) == 0 {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			h.identities = append(h.identities, filepath.Join(sshDir(), name))
+		}
+	}
+	return h, nil
+}
+
+// sshAuth 收集ssh-agent和密钥文件中可用的认证方式，加密且不在ssh-agent中的密钥无法使用，返回的agent连接由调用方关闭
+func sshAuth(h sshHost) ([]ssh.AuthMethod, []string, net.Conn) {
+	var methods []ssh.AuthMethod
+	var notes []string
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, file := range h.identities {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			notes = append(notes, fmt.Sprintf("密钥%s设置了密码，请先用ssh-add加入ssh-agent", file))
+			continue
+		}
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("无法读取密钥%s: %v", file, err))
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, notes, agentConn
+}
+
+// hostKeyCallback 按~/.ssh/known_hosts校验主机密钥，首次连接的主机经用户确认后写入known_hosts，密钥不符时拒绝连接
+func (a *ECNUAgent) hostKeyCallback(ctx context.Context) (ssh.HostKeyCallback, error) {
+	file := filepath.Join(sshDir(), "known_hosts")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	check, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取%s失败: %v", file, err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("主机%s的密钥（%s）与%s第%d行记录的不一致，可能遭到中间人攻击，已拒绝连接", hostname, fingerprint, file, keyErr.Want[0].Line)
+		}
+		ok, err := a.confirm(ctx, approveRemote, fmt.Sprintf("\n首次连接主机 %s，密钥指纹为 %s %s\n是否信任并写入known_hosts？(y/N) ", hostname, key.Type(), fingerprint))
+		if err != nil {
+			return fmt.Errorf("主机%s不在known_hosts中，需要用户确认: %v", hostname, err)
+		}
+		if !ok {
+			return fmt.Errorf("用户拒绝信任主机%s", hostname)
+		}
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}, nil
+}
+
+// dialSFTP 连接远程主机并打开SFTP会话
+func (a *ECNUAgent) dialSFTP(ctx context.Context, h sshHost) (*sftp.Client, func(), error) {
+	auth, notes, agentConn := sshAuth(h)
+	if agentConn != nil {
+		// 认证只在建立连接时进行，之后不再需要agent
+		defer agentConn.Close()
+	}
+	if len(auth) == 0 {
+		msg := "没有可用的SSH密钥，请在~/.ssh/config中为该主机配置IdentityFile或启动ssh-agent"
+		if len(notes) > 0 {
+			msg += "（" + strings.Join(notes, "；") + "）"
+		}
+		return nil, nil, errors.New(msg)
+	}
+	callback, err := a.hostKeyCallback(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	dialer := net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", h.address())
+	if err != nil {
+		return nil, nil, err
+	}
+	cc, chans, reqs, err := ssh.NewClientConn(conn, h.address(), &ssh.ClientConfig{
+		User:            h.user,
+		Auth:            auth,
+		HostKeyCallback: callback,
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		if len(notes) > 0 {
+			err = fmt.Errorf("%v（%s）", err, strings.Join(notes, "；"))
+		}
+		return nil, nil, err
+	}
+	client := ssh.NewClient(cc, chans, reqs)
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("打开SFTP会话失败: %v", err)
+	}
+	// 取消时关闭连接以中断正在进行的读写
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	closeAll := func() {
+		stop()
+		sc.Close()
+		client.Close()
+	}
+	return sc, closeAll, nil
+}
+
+// transferItem 一个待传输的文件
+type transferItem struct {
+	src, dst string
+	size     int64
+	mode     fs.FileMode
+}
+
+// remotePath 把相对路径和~/开头的路径解析为远程主目录下的路径
+func remotePath(sc *sftp.Client, p string) string {
+	if p == "~" {
+		p = "."
+	}
+	p = strings.TrimPrefix(p, "~/")
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	home, err := sc.Getwd()
+	if err != nil {
+		return path.Clean(p)
+	}
+	return path.Join(home, p)
+}
+
+// transferFile 通过SFTP上传或下载文件和目录
+func (a *ECNUAgent) transferFile(ctx context.Context, args string) (string, error) {
+	var params struct {
+		Action string `json:"action"`
+		Host   string `json:"host"`
+		Local  string `json:"local"`
+		Remote string `json:"remote"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Action != "push" && params.Action != "pull" {
+		return "", fmt.Errorf("action只能是push或pull")
+	}
+	if params.Host == "" || params.Local == "" || params.Remote == "" {
+		return "", fmt.Errorf("缺少host、local或remote参数")
+	}
+	h, err := parseSSHTarget(params.Host, filepath.Join(sshDir(), "config"))
+	if err != nil {
+		return fmt.Sprintf("传输失败: %v", err), nil
+	}
+	localPath := a.resolvePath(params.Local)
+	log.Printf("[传输] %s %s@%s (%s, 远程: %s)\n", params.Action, h.user, h.address(), localPath, params.Remote)
+
+	sc, closeAll, err := a.dialSFTP(ctx, h)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return fmt.Sprintf("连接%s@%s失败: %v", h.user, h.address(), err), nil
+	}
+	defer closeAll()
+
+	var result string
+	if params.Action == "push" {
+		result, err = a.pushFiles(ctx, sc, h, localPath, params.Remote)
+	} else {
+		keepName := strings.HasSuffix(params.Local, "/") || strings.HasSuffix(params.Local, `\`)
+		result, err = a.pullFiles(ctx, sc, h, params.Remote, localPath, keepName)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return fmt.Sprintf("传输失败: %v", err), nil
+	}
+	return result, nil
+}
+
+// pushFiles 把本地文件或目录上传到远程主机
+func (a *ECNUAgent) pushFiles(ctx context.Context, sc *sftp.Client, h sshHost, localPath, remote string) (string, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	dest := remotePath(sc, remote)
+	if st, err := sc.Stat(dest); strings.HasSuffix(remote, "/") || err == nil && st.IsDir() {
+		dest = path.Join(dest, filepath.Base(localPath))
+	}
+
+	var items []transferItem
+	var total int64
+	if !info.IsDir() {
+		items = append(items, transferItem{src: localPath, dst: dest, size: info.Size(), mode: info.Mode()})
+		total = info.Size()
+	} else {
+		err := filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(localPath, p)
+			items = append(items, transferItem{src: p, dst: path.Join(dest, filepath.ToSlash(rel)), size: fi.Size(), mode: fi.Mode()})
+			total += fi.Size()
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(items) == 0 {
+			return fmt.Sprintf("%s 中没有文件", localPath), nil
+		}
+	}
+
+	ok, err := a.confirm(ctx, approveRemote, fmt.Sprintf("\n即将上传%d个文件（%s）到 %s@%s:%s，已有的同名文件会被覆盖，是否继续？(y/N) ", len(items), formatSize(total), h.user, h.alias, dest))
+	if err != nil {
+		return fmt.Sprintf("传输失败: 上传到远程主机需要用户确认: %v", err), nil
+	}
+	if !ok {
+		return fmt.Sprintf("用户拒绝上传到 %s，未传输任何文件。请询问用户原因或换一种方式完成任务。", h.alias), nil
+	}
+
+	progress := &transferProgress{tag: "传输", name: filepath.Base(localPath), total: total, start: time.Now(), last: time.Now()}
+	var sum string
+	for _, item := range items {
+		if sum, err = pushOne(sc, item, progress); err != nil {
+			return "", fmt.Errorf("上传%s失败: %v", item.src, err)
+		}
+	}
+	progress.report(true)
+	return transferSummary("上传", items, total, progress, fmt.Sprintf("%s@%s:%s", h.user, h.alias, dest), sum), nil
+}
+
+// pushOne 上传单个文件并保留权限，返回内容的SHA256
+func pushOne(sc *sftp.Client, item transferItem, progress *transferProgress) (string, error) {
+	src, err := os.Open(item.src)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	if err := sc.MkdirAll(path.Dir(item.dst)); err != nil {
+		return "", err
+	}
+	dst, err := sc.OpenFile(item.dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if err := copyWithProgress(dst, src, hash, progress, 0); err != nil {
+		dst.Close()
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	sc.Chmod(item.dst, item.mode.Perm())
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// pullFiles 把远程文件或目录下载到本地，keepName为true或本地路径为已有目录时保留原名，覆盖本地已有文件前请用户确认
+func (a *ECNUAgent) pullFiles(ctx context.Context, sc *sftp.Client, h sshHost, remote, localPath string, keepName bool) (string, error) {
+	src := remotePath(sc, remote)
+	info, err := sc.Stat(src)
+	if err != nil {
+		return "", fmt.Errorf("远程路径%s: %v", src, err)
+	}
+	dest := localPath
+	if st, err := os.Stat(dest); keepName || err == nil && st.IsDir() {
+		dest = filepath.Join(dest, path.Base(src))
+	}
+
+	var items []transferItem
+	var total int64
+	if !info.IsDir() {
+		items = append(items, transferItem{src: src, dst: dest, size: info.Size(), mode: info.Mode()})
+		total = info.Size()
+	} else {
+		walker := sc.Walk(src)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return "", err
+			}
+			st := walker.Stat()
+			if !st.Mode().IsRegular() {
+				continue
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), src), "/")
+			items = append(items, transferItem{src: walker.Path(), dst: filepath.Join(dest, filepath.FromSlash(rel)), size: st.Size(), mode: st.Mode()})
+			total += st.Size()
+		}
+		if len(items) == 0 {
+			return fmt.Sprintf("%s:%s 中没有文件", h.alias, src), nil
+		}
+	}
+
+	var existing []string
+	for _, item := range items {
+		if _, err := os.Stat(item.dst); err == nil {
+			existing = append(existing, item.dst)
+		}
+	}
+	if len(existing) > 0 {
+		list := strings.Join(existing[:min(len(existing), 10)], "\n  ")
+		if len(existing) > 10 {
+			list += fmt.Sprintf("\n  ...（共%d个）", len(existing))
+		}
+		ok, err := a.confirm(ctx, approveWrite, fmt.Sprintf("\n从 %s 下载将覆盖以下本地文件:\n  %s\n是否覆盖？(y/N) ", h.alias, list))
+		if err != nil {
+			return fmt.Sprintf("传输失败: 覆盖本地文件需要用户确认: %v", err), nil
+		}
+		if !ok {
+			return "用户拒绝覆盖本地文件，未传输任何文件。请询问用户原因或换一种方式完成任务。", nil
+		}
+	}
+
+	progress := &transferProgress{tag: "传输", name: path.Base(src), total: total, start: time.Now(), last: time.Now()}
+	var sum string
+	for _, item := range items {
+		if sum, err = a.pullOne(sc, item, progress); err != nil {
+			return "", fmt.Errorf("下载%s失败: %v", item.src, err)
+		}
+	}
+	progress.report(true)
+	return transferSummary("下载", items, total, progress, dest, sum), nil
+}
+
+// pullOne 下载单个文件，先写入临时文件再重命名，并记录修改供撤销
+func (a *ECNUAgent) pullOne(sc *sftp.Client, item transferItem, progress *transferProgress) (string, error) {
+	src, err := sc.Open(item.src)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(item.dst), 0755); err != nil {
+		return "", err
+	}
+	partPath := item.dst + ".part"
+	dst, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, item.mode.Perm()|0600)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if err := copyWithProgress(dst, src, hash, progress, 0); err != nil {
+		dst.Close()
+		os.Remove(partPath)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	change, err := a.snapshotFile(item.dst)
+	if err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	if err := os.Rename(partPath, item.dst); err != nil {
+		os.Remove(partPath)
+		return "", err
+	}
+	a.undo.record(change)
+	a.activity.addFile(item.dst)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// transferSummary 生成传输结果，单个文件时附带SHA256
+func transferSummary(verb string, items []transferItem, total int64, progress *transferProgress, dest, sum string) string {
+	elapsed := time.Since(progress.start).Round(100 * time.Millisecond)
+	if len(items) == 1 {
+		return fmt.Sprintf("已%s %s -> %s（%s，用时%s）\nSHA256: %s", verb, items[0].src, dest, formatSize(total), elapsed, sum)
+	}
+	return fmt.Sprintf("已%s%d个文件到 %s（共%s，用时%s）", verb, len(items), dest, formatSize(total), elapsed)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	treeDefaultDepth   = 3   // tree默认显示的层数
+	treeDefaultEntries = 300 // tree默认最多显示的条目数
+)
+
+// treeTool 递归显示目录结构的工具定义
+var treeTool = Tool{
+	Type:        "function",
+	Name:        "tree",
+	Cacheable:   true,
+	Description: "以树形结构递归显示目录内容，适合一次性了解项目结构。默认显示3层、最多300项，遵循.gitignore并跳过隐藏文件以及.git、node_modules等目录；超出深度的目录只显示其中的条目数。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要显示的目录，默认为当前工作目录",
+				"default":     ".",
+			},
+			"max_depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "显示的最大层数，默认3",
+				"minimum":     1,
+			},
+			"max_entries": map[string]interface{}{
+				"type":        "integer",
+				"description": "最多显示的条目数，默认300",
+				"minimum":     1,
+			},
+			"dirs_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否只显示目录，默认false",
+				"default":     false,
+			},
+			"include_hidden": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否显示隐藏文件和默认跳过的目录，默认false",
+				"default":     false,
+			},
+			"no_ignore": map[string]interface{}{
+				"type":        "boolean",
+				"description": "是否忽略.gitignore规则，默认false",
+				"default":     false,
+			},
+		},
+	},
+}
+
+// treeParams tree的参数
+type treeParams struct {
+	Path          string `json:"path"`
+	MaxDepth      int    `json:"max_depth"`
+	MaxEntries    int    `json:"max_entries"`
+	DirsOnly      bool   `json:"dirs_only"`
+	IncludeHidden bool   `json:"include_hidden"`
+	NoIgnore      bool   `json:"no_ignore"`
+}
+
+// treeWalker 生成树形输出并统计条目
+type treeWalker struct {
+	params  treeParams
+	b       strings.Builder
+	entries int
+	dirs    int
+	files   int
+	omitted bool
+}
+
+// tree 以树形结构显示目录
+func (a *ECNUAgent) tree(args string) (string, error) {
+	params := treeParams{Path: ".", MaxDepth: treeDefaultDepth, MaxEntries: treeDefaultEntries}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		params.Path = "."
+	}
+
+	root := a.resolvePath(params.Path)
+	log.Printf("[目录树] %s (深度: %d)\n", root, params.MaxDepth)
+	if err := checkDirExists(root); err != nil {
+		return fmt.Sprintf("读取目录失败: %v", err), nil
+	}
+
+	w := &treeWalker{params: params}
+	var rules ignoreRules
+	if !params.NoIgnore {
+		rules = rules.withDir(root, "")
+	}
+	fmt.Fprintf(&w.b, "%s/\n", root)
+	w.walk(root, "", "", 1, rules)
+
+	fmt.Fprintf(&w.b, "\n%d个目录，%d个文件", w.dirs, w.files)
+	if w.omitted {
+		fmt.Fprintf(&w.b, "（超过%d项，其余未显示，可指定子目录或增加max_entries）", params.MaxEntries)
+	}
+	return w.b.String(), nil
+}
+
+// walk 输出目录中的条目，prefix为当前层的缩进线
+func (w *treeWalker) walk(dir, rel, prefix string, depth int, rules ignoreRules) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(&w.b, "%s└── (无法读取: %v)\n", prefix, err)
+		return
+	}
+
+	var shown []os.DirEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if !w.params.IncludeHidden && (strings.HasPrefix(name, ".") || (entry.IsDir() && skippedDirs[name])) {
+			continue
+		}
+		if rules.ignored(joinRel(rel, name), entry.IsDir()) {
+			continue
+		}
+		if w.params.DirsOnly && !entry.IsDir() {
+			continue
+		}
+		shown = append(shown, entry)
+	}
+
+	for i, entry := range shown {
+		if w.entries >= w.params.MaxEntries {
+			w.omitted = true
+			fmt.Fprintf(&w.b, "%s└── ...（本目录另有%d项）\n", prefix, len(shown)-i)
+			return
+		}
+		w.entries++
+
+		branch, indent := "├── ", "│   "
+		if i == len(shown)-1 {
+			branch, indent = "└── ", "    "
+		}
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if !entry.IsDir() {
+			w.files++
+			size := ""
+			if info, err := entry.Info(); err == nil {
+				size = " (" + formatSize(info.Size()) + ")"
+			}
+			if entry.Type()&os.ModeSymlink != 0 {
+				if target, err := os.Readlink(path); err == nil {
+					size = " -> " + target
+				}
+			}
+			fmt.Fprintf(&w.b, "%s%s%s%s\n", prefix, branch, name, size)
+			continue
+		}
+
+		w.dirs++
+		if depth >= w.params.MaxDepth {
+			count := ""
+			if children, err := os.ReadDir(path); err == nil && len(children) > 0 {
+				count = fmt.Sprintf(" (%d项)", len(children))
+			}
+			fmt.Fprintf(&w.b, "%s%s%s/%s\n", prefix, branch, name, count)
+			continue
+		}
+		fmt.Fprintf(&w.b, "%s%s%s/\n", prefix, branch, name)
+		childRel := joinRel(rel, name)
+		childRules := rules
+		if !w.params.NoIgnore {
+			childRules = rules.withDir(path, childRel)
+		}
+		w.walk(path, childRel, prefix+indent, depth+1, childRules)
+		if w.omitted {
+			return
+		}
+	}
+}
+
+// joinRel 拼接以/分隔的相对路径
+func joinRel(rel, name string) string {
+	if rel == "" {
+		return name
+	}
+	return rel + "/" + name
+}
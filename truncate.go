@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+const (
+	toolOutputHeadRatio = 0.6 // 截断时开头部分占预算的比例，其余留给结尾
+	toolOutputKeep      = 20  // 最多保存的完整输出数量
+)
+
+// readToolOutputTool 获取被截断的工具输出中指定行范围的工具定义
+var readToolOutputTool = Tool{
+	Type:        "function",
+	Name:        "read_tool_output",
+	Description: "读取之前因过长而被截断的工具输出中的指定行。截断提示中会给出输出ID和被省略的行号范围。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "截断提示中给出的输出ID，例如out-1",
+			},
+			"start_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "起始行号（从1开始，包含）",
+				"minimum":     1,
+			},
+			"end_line": map[string]interface{}{
+				"type":        "integer",
+				"description": "结束行号（包含），默认读取到输出大小限制为止",
+				"minimum":     1,
+			},
+		},
+		"required": []string{"id", "start_line"},
+	},
+}
+
+// outputStore 保存被截断的完整工具输出，供模型按需读取
+type outputStore struct {
+	mu    sync.Mutex
+	seq   int
+	items map[string][]string
+	order []string
+}
+
+// put 保存一份完整输出并返回其ID，超出数量上限时丢弃最早的输出
+func (s *outputStore) put(lines []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		s.items = make(map[string][]string)
+	}
+	s.seq++
+	id := fmt.Sprintf("out-%d", s.seq)
+	s.items[id] = lines
+	s.order = append(s.order, id)
+	if len(s.order) > toolOutputKeep {
+		delete(s.items, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+// get 取出保存的输出
+func (s *outputStore) get(id string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines, ok := s.items[id]
+	return lines, ok
+}
+
+// truncateToolOutput 工具输出超过限制时保留开头和结尾，中间替换为省略说明并保存完整输出
+func (a *ECNUAgent) truncateToolOutput(output string) string {
+	truncated, _ := a.truncateText(output, a.config.ToolOutputLimit)
+	return truncated
+}
+
+// truncateText 文本超过limit字节时保留开头和结尾，返回截断后的文本和保存完整内容的输出ID，未截断时ID为空
+func (a *ECNUAgent) truncateText(output string, limit int) (string, string) {
+	if limit <= 0 || len(output) <= limit {
+		return output, ""
+	}
+
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	headBudget := int(float64(limit) * toolOutputHeadRatio)
+	tailBudget := limit - headBudget
+
+	// 按整行保留开头和结尾
+	head, size := 0, 0
+	for head < len(lines) && size+len(lines[head]) <= headBudget {
+		size += len(lines[head])
+		head++
+	}
+	tail, size := 0, 0
+	for tail < len(lines)-head && size+len(lines[len(lines)-1-tail]) <= tailBudget {
+		size += len(lines[len(lines)-1-tail])
+		tail++
+	}
+
+	id := a.outputs.put(lines)
+	omitted := len(lines) - head - tail
+	omittedBytes := len(output)
+	for _, line := range lines[:head] {
+		omittedBytes -= len(line)
+	}
+	for _, line := range lines[len(lines)-tail:] {
+		omittedBytes -= len(line)
+	}
+	log.Printf("[截断] 工具输出共%d字节，已省略第%d-%d行，完整输出保存为%s\n", len(output), head+1, head+omitted, id)
+
+	var b strings.Builder
+	b.WriteString(strings.Join(lines[:head], ""))
+	if head == 0 && len(lines) > 0 {
+		// 单行过长时按字节截取开头
+		b.WriteString(truncateBytes(lines[0], headBudget))
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "...[输出过长，已省略第%d-%d行（约%d字节）。完整输出ID: %s，可使用read_tool_output工具读取指定行]...\n", head+1, head+omitted, omittedBytes, id)
+	b.WriteString(strings.Join(lines[len(lines)-tail:], ""))
+	return b.String(), id
+}
+
+// truncateBytes 按字节截取字符串，不拆分UTF-8字符
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// utf8RuneStart 判断字节是否为UTF-8字符的起始字节
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// readToolOutput 读取保存的完整输出中的指定行，结果同样受输出大小限制
+func (a *ECNUAgent) readToolOutput(args string) (string, error) {
+	var params struct {
+		ID        string `json:"id"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+
+	lines, ok := a.outputs.get(params.ID)
+	if !ok {
+		return "", fmt.Errorf("找不到输出%s，可能已过期，请重新执行原来的操作", params.ID)
+	}
+	start := params.StartLine
+	if start < 1 {
+		start = 1
+	}
+	if start > len(lines) {
+		return "", fmt.Errorf("起始行%d超出范围，输出%s共%d行", start, params.ID, len(lines))
+	}
+	end := params.EndLine
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if end < start {
+		return "", fmt.Errorf("结束行不能小于起始行")
+	}
+
+	// 至少返回一行，之后受输出大小限制
+	limit := a.config.ToolOutputLimit
+	var body strings.Builder
+	last := start
+	body.WriteString(lines[start-1])
+	for last < end && (limit <= 0 || body.Len()+len(lines[last]) <= limit) {
+		body.WriteString(lines[last])
+		last++
+	}
+
+	result := fmt.Sprintf("输出%s 第%d-%d行（共%d行）:\n%s", params.ID, start, last, len(lines), body.String())
+	if last < end {
+		result += fmt.Sprintf("\n...[超出输出大小限制，仅返回到第%d行，请从第%d行继续读取]", last, last+1)
+	}
+	return result, nil
+}
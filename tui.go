@@ -0,0 +1,429 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	tuiMaxLines      = 5000                   // 每个窗格最多保留的行数
+	tuiMaxInputRows  = 5                      // 输入区最多显示的行数
+	tuiStatusRefresh = 500 * time.Millisecond // 状态栏的刷新间隔
+)
+
+// tuiPane TUI中的一个输出窗格
+type tuiPane struct {
+	title  string
+	lines  []string // 按换行分开的原始输出，最后一行可能尚未结束
+	scroll int      // 从底部向上滚动的行数，0表示跟随最新输出
+}
+
+// write 追加输出，超出行数上限时丢弃最早的行
+func (p *tuiPane) write(text string) {
+	if len(p.lines) == 0 {
+		p.lines = []string{""}
+	}
+	parts := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	p.lines[len(p.lines)-1] += parts[0]
+	p.lines = append(p.lines, parts[1:]...)
+	if len(p.lines) > tuiMaxLines {
+		p.lines = p.lines[len(p.lines)-tuiMaxLines:]
+	}
+}
+
+// render 按宽度折行后返回窗格中可见的height行，不足时在上方补空行
+func (p *tuiPane) render(width, height int) []string {
+	var rows []string
+	for i := len(p.lines) - 1; i >= 0 && len(rows) < height+p.scroll; i-- {
+		rows = append(wrapDisplay(cleanTerminalText(p.lines[i]), width), rows...)
+	}
+	// 已经滚动到最早的输出时不再继续向上滚动
+	p.scroll = max(min(p.scroll, len(rows)-height), 0)
+	end := len(rows) - p.scroll
+	rows = rows[max(end-height, 0):end]
+	for len(rows) < height {
+		rows = append([]string{""}, rows...)
+	}
+	return rows
+}
+
+// cleanTerminalText 去掉输出中的ANSI转义序列和控制字符，回车之前的内容（如进度条）只保留最后一次
+func cleanTerminalText(s string) string {
+	if i := strings.LastIndex(strings.TrimRight(s, "\r"), "\r"); i >= 0 {
+		s = s[i+1:]
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\x1b' && i+1 < len(s) {
+			switch s[i+1] {
+			case '[':
+				// CSI序列以0x40-0x7e之间的字符结束
+				i += 2
+				for i < len(s) && (s[i] < 0x40 || s[i] > 0x7e) {
+					i++
+				}
+			case ']':
+				// OSC序列以BEL或ST结束
+				i += 2
+				for i < len(s) && s[i] != '\a' && !(s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\') {
+					i++
+				}
+				if i < len(s) && s[i] == '\x1b' {
+					i++
+				}
+			default:
+				i++
+			}
+			continue
+		}
+		switch {
+		case c == '\t':
+			b.WriteString("    ")
+		case c < ' ' || c == 0x7f:
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// wrapDisplay 按显示宽度把一行文本折成多行，空行返回一个空字符串
+func wrapDisplay(s string, width int) []string {
+	if width <= 0 {
+		return []string{s}
+	}
+	var rows []string
+	var row strings.Builder
+	w := 0
+	for _, r := range s {
+		rw := displayWidth(string(r))
+		if w+rw > width {
+			rows = append(rows, row.String())
+			row.Reset()
+			w = 0
+		}
+		row.WriteRune(r)
+		w += rw
+	}
+	return append(rows, row.String())
+}
+
+// padDisplay 把文本补齐或截断到指定的显示宽度
+func padDisplay(s string, width int) string {
+	row := wrapDisplay(s, width)[0]
+	return row + strings.Repeat(" ", max(width-displayWidth(row), 0))
+}
+
+// tuiOutputMsg 写入某个窗格的输出
+type tuiOutputMsg struct {
+	pane *tuiPane
+	text string
+}
+
+// tuiDoneMsg 交互循环已经结束
+type tuiDoneMsg struct{}
+
+// tuiTickMsg 定时刷新状态栏
+type tuiTickMsg struct{}
+
+// tuiWriter 把写入的内容发送到TUI的某个窗格
+type tuiWriter struct {
+	program *tea.Program
+	pane    *tuiPane
+}
+
+func (w tuiWriter) Write(b []byte) (int, error) {
+	w.program.Send(tuiOutputMsg{pane: w.pane, text: string(b)})
+	return len(b), nil
+}
+
+// tuiModel 全屏界面：上方为对话，中间为工具调用日志和命令输出，下方为状态栏和输入区
+type tuiModel struct {
+	agent  *ECNUAgent
+	runs   *runController
+	lines  chan string // 提交的输入，关闭表示退出
+	closed bool
+
+	chat    tuiPane
+	tools   tuiPane
+	focus   *tuiPane // PgUp/PgDn滚动的窗格
+	input   []rune
+	pos     int
+	width   int
+	height  int
+	message string // 状态栏中的临时提示
+}
+
+// newTUIModel 创建界面模型
+func newTUIModel(a *ECNUAgent, runs *runController) *tuiModel {
+	m := &tuiModel{
+		agent: a,
+		runs:  runs,
+		lines: make(chan string, 16),
+		chat:  tuiPane{title: "对话"},
+		tools: tuiPane{title: "工具日志"},
+	}
+	m.focus = &m.chat
+	return m
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tuiTick()
+}
+
+// tuiTick 等待下一次刷新状态栏
+func tuiTick() tea.Cmd {
+	return tea.Tick(tuiStatusRefresh, func(time.Time) tea.Msg { return tuiTickMsg{} })
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tuiOutputMsg:
+		msg.pane.write(msg.text)
+	case tuiTickMsg:
+		return m, tuiTick()
+	case tuiDoneMsg:
+		return m, tea.Quit
+	case tea.KeyMsg:
+		m.handleKey(msg)
+	}
+	return m, nil
+}
+
+// handleKey 处理按键，Enter提交输入，Alt+Enter和粘贴的换行插入到输入中
+func (m *tuiModel) handleKey(msg tea.KeyMsg) {
+	m.message = ""
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.input, m.pos = nil, 0
+		if m.runs.interrupt() {
+			m.tools.write("\n[中断] 正在取消当前任务...\n")
+		} else {
+			m.message = "输入 exit 或 quit 退出"
+		}
+	case tea.KeyCtrlD:
+		if len(m.input) == 0 {
+			m.runs.interrupt()
+			m.close()
+		}
+	case tea.KeyEnter:
+		if msg.Alt {
+			m.insert([]rune{'\n'})
+			break
+		}
+		m.submit()
+	case tea.KeyRunes, tea.KeySpace:
+		m.insert(msg.Runes)
+	case tea.KeyTab:
+		if m.focus == &m.chat {
+			m.focus = &m.tools
+		} else {
+			m.focus = &m.chat
+		}
+	case tea.KeyPgUp:
+		m.focus.scroll += max(m.paneHeight(m.focus)-1, 1)
+	case tea.KeyPgDown:
+		m.focus.scroll = max(m.focus.scroll-max(m.paneHeight(m.focus)-1, 1), 0)
+	case tea.KeyBackspace:
+		if m.pos > 0 {
+			m.input = append(m.input[:m.pos-1], m.input[m.pos:]...)
+			m.pos--
+		}
+	case tea.KeyDelete:
+		if m.pos < len(m.input) {
+			m.input = append(m.input[:m.pos], m.input[m.pos+1:]...)
+		}
+	case tea.KeyLeft, tea.KeyCtrlB:
+		m.pos = max(m.pos-1, 0)
+	case tea.KeyRight, tea.KeyCtrlF:
+		m.pos = min(m.pos+1, len(m.input))
+	case tea.KeyHome, tea.KeyCtrlA:
+		m.pos = 0
+	case tea.KeyEnd, tea.KeyCtrlE:
+		m.pos = len(m.input)
+	case tea.KeyCtrlU:
+		m.input, m.pos = m.input[m.pos:], 0
+	case tea.KeyCtrlK:
+		m.input = m.input[:m.pos]
+	}
+}
+
+// insert 在光标处插入文字，粘贴的内容中的回车转换为换行，其他控制字符忽略
+func (m *tuiModel) insert(runes []rune) {
+	var text []rune
+	for _, r := range strings.ReplaceAll(strings.ReplaceAll(string(runes), "\r\n", "\n"), "\r", "\n") {
+		if r == '\n' || r == '\t' || unicode.IsPrint(r) {
+			text = append(text, r)
+		}
+	}
+	m.input = append(m.input[:m.pos], append(text, m.input[m.pos:]...)...)
+	m.pos += len(text)
+}
+
+// submit 提交输入，并回显到对话窗格中提示符的后面
+func (m *tuiModel) submit() {
+	if m.closed {
+		return
+	}
+	text := string(m.input)
+	select {
+	case m.lines <- text:
+		m.chat.write(text + "\n")
+		m.chat.scroll = 0
+		m.input, m.pos = nil, 0
+	default:
+		m.message = "尚有未处理的输入，请稍候"
+	}
+}
+
+// close 结束输入，交互循环处理完已提交的输入后退出
+func (m *tuiModel) close() {
+	if !m.closed {
+		m.closed = true
+		close(m.lines)
+	}
+}
+
+// inputRows 返回输入区显示的各行，光标位置反色显示，行数较多时只显示光标附近的几行
+func (m *tuiModel) inputRows() []string {
+	const cursor = "\x1b[7m \x1b[0m"
+	text := string(m.input[:m.pos]) + "\x00" + string(m.input[m.pos:])
+	var rows []string
+	for i, line := range strings.Split(text, "\n") {
+		prefix := "> "
+		if i > 0 {
+			prefix = "… "
+		}
+		rows = append(rows, wrapDisplay(prefix+line, m.width-1)...)
+	}
+	at := 0
+	for i, row := range rows {
+		if strings.Contains(row, "\x00") {
+			at = i
+		}
+		rows[i] = strings.Replace(row, "\x00", cursor, 1)
+	}
+	if len(rows) > tuiMaxInputRows {
+		start := min(max(at-tuiMaxInputRows+1, 0), len(rows)-tuiMaxInputRows)
+		rows = rows[start : start+tuiMaxInputRows]
+	}
+	return rows
+}
+
+// paneHeight 返回窗格可显示的行数，对话窗格占输出区域的五分之三
+func (m *tuiModel) paneHeight(p *tuiPane) int {
+	available := max(m.height-3-len(m.inputRows()), 2)
+	chat := max(available*3/5, 1)
+	if p == &m.chat {
+		return chat
+	}
+	return max(available-chat, 1)
+}
+
+// statusLine 返回状态栏：模型、本轮步骤、token用量和运行状态
+func (m *tuiModel) statusLine() string {
+	a := m.agent
+	state := "空闲"
+	if m.runs.running() {
+		state = "执行中"
+	}
+	status := fmt.Sprintf(" %s │ 模型: %s │ 步骤: %d/%d │ 本轮: %d tokens │ 会话: %d tokens",
+		state, a.model(), a.step.Load(), a.config.MaxSteps, a.usage.turnStats().total(), a.usage.sessionStats().total())
+	if m.message != "" {
+		status += " │ " + m.message
+	}
+	return "\x1b[7m" + padDisplay(status, m.width) + "\x1b[0m"
+}
+
+// title 返回窗格的标题行，当前可以滚动的窗格加粗显示
+func (m *tuiModel) title(p *tuiPane) string {
+	title := "── " + p.title + " "
+	if p.scroll > 0 {
+		title += fmt.Sprintf("(向上%d行) ", p.scroll)
+	}
+	title += strings.Repeat("─", max(m.width-displayWidth(title), 0))
+	if p == m.focus {
+		return "\x1b[1m" + title + "\x1b[0m"
+	}
+	return title
+}
+
+func (m *tuiModel) View() string {
+	if m.width <= 0 || m.height <= 0 {
+		return ""
+	}
+	var rows []string
+	for _, p := range []*tuiPane{&m.chat, &m.tools} {
+		height := m.paneHeight(p)
+		rows = append(rows, m.title(p))
+		rows = append(rows, p.render(m.width, height)...)
+	}
+	rows = append(rows, m.statusLine())
+	rows = append(rows, m.inputRows()...)
+	return strings.Join(rows, "\n")
+}
+
+// RunTUI 以全屏界面运行交互式循环
+//
+// 对话和提示输出到上方的窗格，日志、工具调用和命令的实时输出显示在工具日志窗格。
+// 运行期间标准输出和日志被重定向到界面，退出后恢复并打印会话统计。
+func (a *ECNUAgent) RunTUI() error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return errors.New("TUI模式需要在交互式终端中运行")
+	}
+
+	var runs runController
+	m := newTUIModel(a, &runs)
+	terminal := os.Stdout
+	program := tea.NewProgram(m, tea.WithAltScreen(), tea.WithOutput(terminal))
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("重定向输出失败: %v", err)
+	}
+	chat, tools := tuiWriter{program, &m.chat}, tuiWriter{program, &m.tools}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(chat, r)
+		close(copied)
+	}()
+
+	console, monitor, logOutput := a.console, a.monitor, log.Writer()
+	os.Stdout, a.console = w, w
+	if monitor != nil {
+		a.monitor = newCommandMonitor(tools)
+	}
+	log.SetOutput(newLogWriter(tools, a.config.logLevel(), false))
+	restore := func() {
+		os.Stdout, a.console, a.monitor = terminal, console, monitor
+		log.SetOutput(logOutput)
+		w.Close()
+		<-copied
+		r.Close()
+	}
+
+	in := &inputLines{lines: m.lines}
+	go func() {
+		a.repl(in, &runs)
+		program.Send(tuiDoneMsg{})
+	}()
+
+	_, err = program.Run()
+	restore()
+	if err != nil {
+		return fmt.Errorf("运行TUI失败: %v", err)
+	}
+	a.printSessionSummary()
+	return nil
+}
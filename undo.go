@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const undoMemoryLimit = 8 * 1024 * 1024 // 关闭备份时在内存中保存修改前内容的大小上限
+
+// undoLastChangeTool 撤销最近修改的工具定义
+var undoLastChangeTool = Tool{
+	Type:        "function",
+	Name:        "undo_last_change",
+	Sequential:  true,
+	Description: "撤销本次会话中最近一次文件修改（write_file、edit_file、search_replace、delete_file、move_file、copy_file），或撤销最近一轮任务中的全部修改。文件在修改之后又被改动过时默认拒绝撤销，以免丢失之后的改动。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"scope": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"change", "task"},
+				"description": "change撤销最近一次修改，task撤销最近一轮任务中的全部修改，默认change",
+				"default":     "change",
+			},
+			"force": map[string]interface{}{
+				"type":        "boolean",
+				"description": "文件在修改后又发生变化时是否仍然撤销，默认false",
+				"default":     false,
+			},
+		},
+	},
+}
+
+// fileChange 一次可撤销的文件修改及修改前后的快照
+type fileChange struct {
+	task     int
+	op       string      // write、delete、move、copy
+	path     string      // 被修改的路径，移动和复制时为目标
+	source   string      // 移动的源路径
+	existed  bool        // write之前文件是否已存在
+	mode     os.FileMode // write之前文件的权限
+	backup   string      // write之前内容的备份文件，delete时为回收站中的位置
+	data     []byte      // 关闭备份时保存在内存中的修改前内容
+	partial  bool        // 修改前的内容过大未能保存
+	replaced string      // 被覆盖的目标在回收站中的位置
+	afterSum string      // 修改后文件内容的sha256，目录为空
+	time     time.Time
+}
+
+// describe 返回修改的简短描述
+func (c fileChange) describe() string {
+	switch c.op {
+	case "write":
+		if !c.existed {
+			return "创建 " + c.path
+		}
+		return "修改 " + c.path
+	case "delete":
+		return "删除 " + c.path
+	case "move":
+		return fmt.Sprintf("移动 %s -> %s", c.source, c.path)
+	case "copy":
+		return "复制到 " + c.path
+	}
+	return c.op + " " + c.path
+}
+
+// undoJournal 记录本次会话的文件修改，按任务编号分组
+type undoJournal struct {
+	mu      sync.Mutex
+	task    int
+	changes []fileChange
+}
+
+// nextTask 开始新一轮任务
+func (j *undoJournal) nextTask() {
+	j.mu.Lock()
+	j.task++
+	j.mu.Unlock()
+}
+
+// record 记录一次修改，afterSum根据修改后的文件计算
+func (j *undoJournal) record(c fileChange) {
+	c.afterSum = contentSum(c.path)
+	c.time = time.Now()
+	j.mu.Lock()
+	c.task = j.task
+	j.changes = append(j.changes, c)
+	j.mu.Unlock()
+}
+
+// pop 取出要撤销的修改，scope为task时取出最近一轮任务的全部修改，按从新到旧排列
+func (j *undoJournal) pop(scope string) []fileChange {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n := len(j.changes)
+	if n == 0 {
+		return nil
+	}
+	start := n - 1
+	if scope == "task" {
+		for start > 0 && j.changes[start-1].task == j.changes[n-1].task {
+			start--
+		}
+	}
+	popped := make([]fileChange, 0, n-start)
+	for i := n - 1; i >= start; i-- {
+		popped = append(popped, j.changes[i])
+	}
+	j.changes = j.changes[:start]
+	return popped
+}
+
+// push 把未能撤销的修改放回记录，changes按从新到旧排列
+func (j *undoJournal) push(changes []fileChange) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(changes) - 1; i >= 0; i-- {
+		j.changes = append(j.changes, changes[i])
+	}
+}
+
+// list 返回按时间顺序排列的修改记录
+func (j *undoJournal) list() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.changes) == 0 {
+		return "本次会话没有可撤销的修改\n"
+	}
+	var b strings.Builder
+	for _, c := range j.changes {
+		fmt.Fprintf(&b, "  [任务%d %s] %s\n", c.task, c.time.Format("15:04:05"), c.describe())
+	}
+	return b.String()
+}
+
+// contentSum 计算普通文件内容的sha256，其他类型返回空字符串
+func contentSum(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	sum, _, err := hashFile(path, sha256.New)
+	if err != nil {
+		return ""
+	}
+	return sum
+}
+
+// snapshotFile 保存文件修改前的内容，开启备份时写入备份目录，否则在内存中保存
+func (a *ECNUAgent) snapshotFile(path string) (fileChange, error) {
+	change := fileChange{op: "write", path: path}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return change, nil
+	}
+	change.existed = true
+	change.mode = info.Mode().Perm()
+	if a.config.Backup {
+		backup, err := a.backups.save(path)
+		if err != nil {
+			return change, err
+		}
+		change.backup = backup
+		change.partial = backup == ""
+		return change, nil
+	}
+	if info.Size() > undoMemoryLimit {
+		change.partial = true
+		return change, nil
+	}
+	if change.data, err = os.ReadFile(path); err != nil {
+		return change, fmt.Errorf("读取原文件失败: %v", err)
+	}
+	return change, nil
+}
+
+// undoChanges 撤销最近的修改，返回每项的处理结果
+func (a *ECNUAgent) undoChanges(scope string, force bool) string {
+	changes := a.undo.pop(scope)
+	if len(changes) == 0 {
+		return "本次会话没有可撤销的修改"
+	}
+
+	var b strings.Builder
+	for i, c := range changes {
+		if err := a.revertChange(c, force); err != nil {
+			// 之后的修改依赖于这一项，放回记录等待处理
+			a.undo.push(changes[i:])
+			fmt.Fprintf(&b, "撤销失败: %s: %v\n", c.describe(), err)
+			if i < len(changes)-1 {
+				fmt.Fprintf(&b, "其余%d项修改未撤销\n", len(changes)-1-i)
+			}
+			break
+		}
+		log.Printf("[撤销] %s\n", c.describe())
+		fmt.Fprintf(&b, "已撤销: %s\n", c.describe())
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// revertChange 把一次修改恢复到修改前的状态
+func (a *ECNUAgent) revertChange(c fileChange, force bool) error {
+	if c.afterSum != "" && !force {
+		if current := contentSum(c.path); current != c.afterSum {
+			return fmt.Errorf("%s在修改之后又发生了变化，如仍要撤销请使用force", c.path)
+		}
+	}
+
+	switch c.op {
+	case "write":
+		if !c.existed {
+			if _, err := os.Lstat(c.path); err != nil {
+				return nil
+			}
+			_, err := a.trash.put(c.path)
+			return err
+		}
+		if c.partial {
+			return fmt.Errorf("修改前的内容过大，没有保存快照")
+		}
+		data := c.data
+		if c.backup != "" {
+			var err error
+			if data, err = os.ReadFile(c.backup); err != nil {
+				return fmt.Errorf("读取备份失败: %v", err)
+			}
+		}
+		if _, err := a.backupBeforeWrite(c.path); err != nil {
+			return err
+		}
+		// 修改可能替换了文件（如下载完成后重命名），权限按修改前的恢复
+		if err := writeFileAtomic(c.path, data, c.mode); err != nil {
+			return err
+		}
+		return os.Chmod(c.path, c.mode)
+	case "delete":
+		if _, err := os.Lstat(c.path); err == nil {
+			return fmt.Errorf("%s已存在，无法从回收站恢复", c.path)
+		}
+		if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+			return err
+		}
+		return movePath(c.backup, c.path)
+	case "move", "copy":
+		if _, err := os.Lstat(c.path); err != nil {
+			return fmt.Errorf("%s已不存在", c.path)
+		}
+		if c.op == "move" {
+			if _, err := os.Lstat(c.source); err == nil {
+				return fmt.Errorf("%s已存在，无法移回", c.source)
+			}
+			if err := movePath(c.path, c.source); err != nil {
+				return err
+			}
+		} else if _, err := a.trash.put(c.path); err != nil {
+			return err
+		}
+		if c.replaced != "" {
+			return movePath(c.replaced, c.path)
+		}
+		return nil
+	}
+	return fmt.Errorf("未知的修改类型: %s", c.op)
+}
+
+// undoLastChange 撤销最近一次或最近一轮任务的修改
+func (a *ECNUAgent) undoLastChange(args string) (string, error) {
+	params := struct {
+		Scope string `json:"scope"`
+		Force bool   `json:"force"`
+	}{Scope: "change"}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Scope != "change" && params.Scope != "task" {
+		return "", fmt.Errorf("scope只能是change或task")
+	}
+	return a.undoChanges(params.Scope, params.Force), nil
+}
+
+// undoCommand 处理/undo命令，撤销后告知模型文件已恢复
+func (a *ECNUAgent) undoCommand(fields []string) {
+	scope, force := "change", false
+	for _, f := range fields {
+		switch f {
+		case "task":
+			scope = "task"
+		case "force":
+			force = true
+		case "list":
+			fmt.Println("可撤销的修改:")
+			fmt.Print(a.undo.list())
+			return
+		default:
+			fmt.Println("用法: /undo [task] [force]，/undo list 查看可撤销的修改")
+			return
+		}
+	}
+
+	result := a.undoChanges(scope, force)
+	fmt.Println(result)
+	if strings.Contains(result, "已撤销") {
+		a.history = append(a.history, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: "（用户通过/undo撤销了以下修改，相关文件已恢复，之后请以文件的当前内容为准）\n" + result,
+		})
+		a.saveState()
+	}
+}
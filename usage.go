@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// usageStats 累计的token用量
+type usageStats struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        int     // 服务端未返回用量、使用估算值的请求数
+	Cost             float64 // 预计费用，未配置价格表时为0
+}
+
+// total 返回总token数
+func (u usageStats) total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// modelPrice 模型单价，单位为每百万token
+type modelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// priceTable 模型价格表
+type priceTable struct {
+	Currency string                `json:"currency"`
+	Models   map[string]modelPrice `json:"models"`
+}
+
+// loadPriceTable 读取价格表文件，格式为 {"currency": "CNY", "models": {"模型": {"input": 每百万输入token价格, "output": 每百万输出token价格}}}
+func loadPriceTable(path string) (*priceTable, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取价格表失败: %v", err)
+	}
+	var table priceTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("解析价格表失败: %v", err)
+	}
+	if table.Currency == "" {
+		table.Currency = "CNY"
+	}
+	return &table, nil
+}
+
+// usageTracker 统计本轮任务和整个会话的token用量
+type usageTracker struct {
+	mu      sync.Mutex
+	turn    usageStats
+	session usageStats
+	byModel map[string]*usageStats
+	prices  *priceTable
+}
+
+// newUsageTracker 创建用量统计器，prices为nil时不计算费用
+func newUsageTracker(prices *priceTable) *usageTracker {
+	return &usageTracker{byModel: make(map[string]*usageStats), prices: prices}
+}
+
+// record 记录一次请求的用量，服务端未返回用量时根据请求和回复估算
+func (t *usageTracker) record(model string, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) {
+	usage := resp.Usage
+	estimated := 0
+	if usage.TotalTokens == 0 && usage.PromptTokens == 0 {
+		usage.PromptTokens = estimateHistoryTokens(req.Messages)
+		for _, choice := range resp.Choices {
+			usage.CompletionTokens += estimateMessageTokens(choice.Message)
+		}
+		estimated = 1
+	}
+
+	cost, _ := t.costOf(model, usageStats{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := t.byModel[model]
+	if stats == nil {
+		stats = &usageStats{}
+		t.byModel[model] = stats
+	}
+	for _, s := range []*usageStats{&t.turn, &t.session, stats} {
+		s.Requests++
+		s.PromptTokens += usage.PromptTokens
+		s.CompletionTokens += usage.CompletionTokens
+		s.Estimated += estimated
+		s.Cost += cost
+	}
+}
+
+// startTurn 开始统计新一轮任务
+func (t *usageTracker) startTurn() {
+	t.mu.Lock()
+	t.turn = usageStats{}
+	t.mu.Unlock()
+}
+
+// turnStats 返回本轮任务的用量
+func (t *usageTracker) turnStats() usageStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.turn
+}
+
+// sessionStats 返回整个会话的用量
+func (t *usageTracker) sessionStats() usageStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// costOf 计算某个模型的费用，价格表中没有该模型时found为false
+func (t *usageTracker) costOf(model string, stats usageStats) (float64, bool) {
+	if t.prices == nil {
+		return 0, false
+	}
+	price, found := t.prices.Models[model]
+	if !found {
+		return 0, false
+	}
+	return (float64(stats.PromptTokens)*price.Input + float64(stats.CompletionTokens)*price.Output) / 1e6, true
+}
+
+// formatStats 将用量格式化为一行说明
+func formatStats(s usageStats) string {
+	line := fmt.Sprintf("%d次请求，输入 %d + 输出 %d = %d tokens", s.Requests, s.PromptTokens, s.CompletionTokens, s.total())
+	if s.Estimated > 0 {
+		line += fmt.Sprintf("（其中%d次为估算）", s.Estimated)
+	}
+	return line
+}
+
+// report 返回本轮、会话及按模型分类的用量报告
+func (t *usageTracker) report() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  本轮: %s\n", formatStats(t.turn))
+	fmt.Fprintf(&b, "  会话: %s\n", formatStats(t.session))
+
+	models := make([]string, 0, len(t.byModel))
+	for model := range t.byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	total := 0.0
+	for _, model := range models {
+		stats := *t.byModel[model]
+		fmt.Fprintf(&b, "  - %s: %s", model, formatStats(stats))
+		if cost, ok := t.costOf(model, stats); ok {
+			fmt.Fprintf(&b, "，费用 %.4f %s", cost, t.prices.Currency)
+			total += cost
+		}
+		b.WriteString("\n")
+	}
+	if t.prices != nil {
+		fmt.Fprintf(&b, "  预计总费用: %.4f %s\n", total, t.prices.Currency)
+	}
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// verifyFailedPrefix 模型确认任务未完成时回复的开头
+const verifyFailedPrefix = "验证未通过"
+
+// turnActivity 记录本轮任务修改的文件和执行的命令，供完成后的验证使用
+type turnActivity struct {
+	mu       sync.Mutex
+	files    []string
+	commands []string
+}
+
+// reset 清空记录
+func (t *turnActivity) reset() {
+	t.mu.Lock()
+	t.files, t.commands = nil, nil
+	t.mu.Unlock()
+}
+
+// addFile 记录一个被修改的文件，重复的路径只记录一次
+func (t *turnActivity) addFile(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, f := range t.files {
+		if f == path {
+			return
+		}
+	}
+	t.files = append(t.files, path)
+}
+
+// addCommand 记录一条执行过的命令
+func (t *turnActivity) addCommand(command string) {
+	t.mu.Lock()
+	t.commands = append(t.commands, command)
+	t.mu.Unlock()
+}
+
+// snapshot 返回当前记录的副本
+func (t *turnActivity) snapshot() (files, commands []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.files...), append([]string(nil), t.commands...)
+}
+
+// verifyPrompt 生成要求模型核实任务结果的提示
+func verifyPrompt(files, commands []string) string {
+	var b strings.Builder
+	b.WriteString("在结束任务前，请验证任务确实已经完成。\n")
+	if len(files) > 0 {
+		b.WriteString("\n本轮修改的文件：\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	}
+	if len(commands) > 0 {
+		b.WriteString("\n本轮执行的命令：\n")
+		for _, c := range commands {
+			fmt.Fprintf(&b, "- %s\n", truncateRunes(c, 200))
+		}
+	}
+	fmt.Fprintf(&b, `
+请重新读取修改过的文件或运行检查命令（如查看服务状态、运行测试、检查输出）确认结果是否符合用户的要求。
+如果发现问题，请直接修正并再次确认。
+最后以"验证通过"或"%s"开头，简要说明验证的方法和结果。`, verifyFailedPrefix)
+	return b.String()
+}
+
+// verifyTask 任务完成后追加一轮验证，由模型检查修改结果并在必要时自行修正
+//
+// 本轮没有修改文件或执行命令时无需验证。
+func (a *ECNUAgent) verifyTask(ctx context.Context) error {
+	files, commands := a.activity.snapshot()
+	if len(files) == 0 && len(commands) == 0 {
+		return nil
+	}
+
+	log.Printf("[验证] 检查任务结果（修改%d个文件，执行%d条命令）\n", len(files), len(commands))
+	if err := a.runTask(ctx, verifyPrompt(files, commands)); err != nil {
+		return err
+	}
+
+	last := a.history[len(a.history)-1]
+	if last.Role == openai.ChatMessageRoleAssistant && strings.HasPrefix(strings.TrimSpace(last.Content), verifyFailedPrefix) {
+		log.Printf("[验证] 模型报告任务未能完成，请检查上面的说明\n")
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	watchDefaultSeconds = 30  // watch_path默认的监视时长
+	watchMaxSeconds     = 600 // 监视时长的上限
+	watchMaxEvents      = 200 // 最多记录的事件数
+)
+
+// watchPathTool 监视文件变化的工具定义
+var watchPathTool = Tool{
+	Type:        "function",
+	Name:        "watch_path",
+	Sequential:  true,
+	Description: "在一段时间内监视文件或目录，报告其中文件的创建、修改、删除和重命名事件。可用于等待构建产物或日志文件出现，例如在后台启动构建后设置stop_on_first等待输出文件生成。路径不存在时监视其父目录，等待该文件被创建。",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "要监视的文件或目录",
+			},
+			"duration": map[string]interface{}{
+				"type":        "integer",
+				"description": "最长监视时间（秒），默认30，最多600",
+				"minimum":     1,
+				"maximum":     watchMaxSeconds,
+			},
+			"recursive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "监视目录时是否包含子目录（跳过.git、node_modules等），默认false",
+				"default":     false,
+			},
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "只报告文件名匹配该glob的事件，如*.log",
+			},
+			"events": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": []string{"create", "modify", "delete", "rename"}},
+				"description": "只报告这些类型的事件，默认全部",
+			},
+			"stop_on_first": map[string]interface{}{
+				"type":        "boolean",
+				"description": "收到第一个符合条件的事件后立即返回，默认false",
+				"default":     false,
+			},
+		},
+		"required": []string{"path"},
+	},
+}
+
+// watchParams watch_path的参数
+type watchParams struct {
+	Path        string   `json:"path"`
+	Duration    int      `json:"duration"`
+	Recursive   bool     `json:"recursive"`
+	Pattern     string   `json:"pattern"`
+	Events      []string `json:"events"`
+	StopOnFirst bool     `json:"stop_on_first"`
+}
+
+// watchEventName 把fsnotify的事件转换为事件类型，一个事件可能同时包含多种操作
+func watchEventName(op fsnotify.Op) string {
+	switch {
+	case op.Has(fsnotify.Create):
+		return "create"
+	case op.Has(fsnotify.Remove):
+		return "delete"
+	case op.Has(fsnotify.Rename):
+		return "rename"
+	case op.Has(fsnotify.Write):
+		return "modify"
+	}
+	return ""
+}
+
+// watchEventLabels 事件类型的中文名称
+var watchEventLabels = map[string]string{
+	"create": "创建",
+	"modify": "修改",
+	"delete": "删除",
+	"rename": "重命名",
+}
+
+// watchPath 监视路径并汇总期间发生的事件
+func (a *ECNUAgent) watchPath(ctx context.Context, args string) (string, error) {
+	params := watchParams{Duration: watchDefaultSeconds}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return "", fmt.Errorf("解析参数失败: %v", err)
+	}
+	if params.Path == "" {
+		return "", fmt.Errorf("缺少path参数")
+	}
+	params.Duration = max(1, min(params.Duration, watchMaxSeconds))
+	// 留出余量，避免先触发单个工具的时间限制
+	if limit := a.config.ToolTimeout; limit > 0 && params.Duration >= limit {
+		params.Duration = max(1, limit-5)
+	}
+	wanted := map[string]bool{}
+	for _, e := range params.Events {
+		if watchEventLabels[e] == "" {
+			return "", fmt.Errorf("未知的事件类型: %s", e)
+		}
+		wanted[e] = true
+	}
+
+	target := a.resolvePath(params.Path)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Sprintf("监视失败: %v", err), nil
+	}
+	defer watcher.Close()
+
+	// onlyName不为空时监视的是父目录，只报告该文件的事件
+	root, onlyName := target, ""
+	info, err := os.Stat(target)
+	switch {
+	case os.IsNotExist(err):
+		root, onlyName = filepath.Dir(target), filepath.Base(target)
+		if err := checkDirExists(root); err != nil {
+			return fmt.Sprintf("监视失败: %s不存在，其父目录也不可用: %v", target, err), nil
+		}
+	case err != nil:
+		return fmt.Sprintf("监视失败: %v", err), nil
+	}
+	dirs := 0
+	addDir := func(dir string) {
+		if err := watcher.Add(dir); err == nil {
+			dirs++
+		}
+	}
+	if info != nil && info.IsDir() && params.Recursive {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if p != root && skippedDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			addDir(p)
+			return nil
+		})
+	} else if err := watcher.Add(root); err != nil {
+		return fmt.Sprintf("监视失败: %v", err), nil
+	} else {
+		dirs++
+	}
+	log.Printf("[监视] %s (%d秒, %d个目录)\n", target, params.Duration, dirs)
+
+	start := time.Now()
+	timer := time.NewTimer(time.Duration(params.Duration) * time.Second)
+	defer timer.Stop()
+
+	var events []string
+	total := 0
+	stopped := ""
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timer.C:
+			break loop
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				break loop
+			}
+			log.Printf("[监视] %v\n", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				break loop
+			}
+			name := watchEventName(ev.Op)
+			if name == "" {
+				continue
+			}
+			// 递归监视时把新建的子目录也加入监视
+			if name == "create" && params.Recursive {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() && !skippedDirs[fi.Name()] {
+					addDir(ev.Name)
+				}
+			}
+			base := filepath.Base(ev.Name)
+			if onlyName != "" && base != onlyName {
+				continue
+			}
+			if params.Pattern != "" {
+				if ok, _ := filepath.Match(params.Pattern, base); !ok {
+					continue
+				}
+			}
+			if len(wanted) > 0 && !wanted[name] {
+				continue
+			}
+			total++
+			if len(events) < watchMaxEvents {
+				events = append(events, fmt.Sprintf("+%.1fs %s %s", time.Since(start).Seconds(), watchEventLabels[name], ev.Name))
+			}
+			if params.StopOnFirst {
+				stopped = "收到事件后停止"
+				break loop
+			}
+		}
+	}
+
+	elapsed := time.Since(start).Round(100 * time.Millisecond)
+	if total == 0 {
+		return fmt.Sprintf("监视%s %v，没有发生符合条件的变化", target, elapsed), nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "监视%s %v，共%d个事件", target, elapsed, total)
+	if stopped != "" {
+		b.WriteString("（" + stopped + "）")
+	}
+	b.WriteString(":\n")
+	b.WriteString(strings.Join(events, "\n"))
+	if total > len(events) {
+		fmt.Fprintf(&b, "\n...（另有%d个事件未显示）", total-len(events))
+	}
+	return b.String(), nil
+}